@@ -2,9 +2,12 @@ package main
 
 import (
 	"aibo/internal/server"
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	_ "aibo/docs"
 
@@ -70,10 +73,15 @@ func main() {
 	slog.Info("Server created", "address", addr)
 	slog.Info("Swagger UI available at", "url", "http://"+appURL+"/swagger/index.html")
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s.StartJobs(ctx)
+
 	slog.Info("Server starting", "address", addr)
 
-	err = s.Run(addr)
+	err = s.Run(ctx, addr)
 	if err != nil {
 		panic(fmt.Sprintf("cannot start server: %s", err))
 	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,45 @@
+// Package attachments reads the files attached to the transactions and the CatBuds: it finds
+// their content type from their bytes, and makes the thumbnails of the images.
+package attachments
+
+import (
+	"mime"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// allowedTypes are the content types of the files that can be attached: photos and scans of
+// receipts, PDF documents and plain text.
+var allowedTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/heic",
+	"image/heif",
+	"application/pdf",
+	"text/plain",
+}
+
+// Sniff finds the content type of a file from its bytes, ignoring the type and the extension
+// given by the client, and reports whether it can be attached. The type has no parameter, such
+// as the charset of a text. A text in a richer format, such as HTML or SVG, is not plain text and
+// cannot be attached.
+func Sniff(data []byte) (string, bool) {
+	detected := mimetype.Detect(data)
+	for _, allowed := range allowedTypes {
+		if detected.Is(allowed) {
+			return allowed, true
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(detected.String())
+	if err != nil {
+		return detected.String(), false
+	}
+	return mediaType, false
+}
+
+// AllowedTypes returns the content types of the files that can be attached.
+func AllowedTypes() []string {
+	return append([]string(nil), allowedTypes...)
+}
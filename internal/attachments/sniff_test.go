@@ -0,0 +1,28 @@
+package attachments
+
+import "testing"
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		want      string
+		wantAllow bool
+	}{
+		{"pdf", []byte("%PDF-1.7\n1 0 obj\n"), "application/pdf", true},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png", true},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "image/jpeg", true},
+		{"text", []byte("Coffee 3.50\nBread 2.10\n"), "text/plain", true},
+		{"html", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), "text/html", false},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"></svg>`), "image/svg+xml", false},
+		{"zip", []byte("PK\x03\x04\x14\x00\x00\x00"), "application/zip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, allowed := Sniff(tt.data)
+			if got != tt.want || allowed != tt.wantAllow {
+				t.Fatalf("Sniff = %q, %v, want %q, %v", got, allowed, tt.want, tt.wantAllow)
+			}
+		})
+	}
+}
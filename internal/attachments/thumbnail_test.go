@@ -0,0 +1,92 @@
+package attachments
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// pngHeader returns the start of a PNG declaring the dimensions, without any pixel.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 0, 17)
+	ihdr = append(ihdr, "IHDR"...)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, 13)
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+	}{
+		{"landscape", 1280, 640, ThumbnailSize, ThumbnailSize / 2},
+		{"portrait", 400, 800, ThumbnailSize / 2, ThumbnailSize},
+		{"small", 100, 50, 100, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumbnail, err := Thumbnail(encodePNG(t, tt.width, tt.height))
+			if err != nil {
+				t.Fatalf("Thumbnail: %v", err)
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+			if err != nil {
+				t.Fatalf("the thumbnail is not a JPEG: %v", err)
+			}
+			if config.Width != tt.wantW || config.Height != tt.wantH {
+				t.Fatalf("thumbnail of %dx%d, want %dx%d", config.Width, config.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestThumbnailRejectsHugeImages(t *testing.T) {
+	for _, size := range [][2]uint32{{100_000, 100_000}, {4097, 4096}, {8000, 6000}} {
+		if _, err := Thumbnail(pngHeader(size[0], size[1])); !errors.Is(err, ErrImageTooLarge) {
+			t.Fatalf("%dx%d: err = %v, want ErrImageTooLarge", size[0], size[1], err)
+		}
+	}
+}
+
+func TestHasThumbnail(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"image/jpeg":      true,
+		"image/png":       true,
+		"image/gif":       true,
+		"image/webp":      false,
+		"image/heic":      false,
+		"application/pdf": false,
+	} {
+		if got := HasThumbnail(contentType); got != want {
+			t.Errorf("HasThumbnail(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
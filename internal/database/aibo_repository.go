@@ -2,6 +2,7 @@ package database
 
 import (
 	"aibo/internal/types"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -47,8 +48,30 @@ func (r *AiboRepository) GetAiboByID(id string) (*types.Aibo, error) {
 
 // UpdateAibo updates an existing Aibo in the database.
 //
-// The Aibo is updated using the provided Aibo instance. If the Aibo is updated successfully, a
-// nil error is returned. If there is an error updating the Aibo, a gorm.error is returned.
+// The Aibo is updated using the provided Aibo instance and its CurrentDelta is recalculated from
+// the ledger in the same database transaction, since it depends on the daily budget. The columns
+// maintained by the ledger and the daily rollover are never overwritten from the instance. When
+// the base currency changes, every transaction of the Aibo is converted into the new one; budgets
+// keep their values. If the Aibo is updated successfully, a nil error is returned. If there is an
+// error updating the Aibo, a gorm.error is returned, or an error wrapping ErrNoExchangeRate if a
+// transaction cannot be converted.
 func (r *AiboRepository) UpdateAibo(Aibo *types.Aibo) error {
-	return r.db.Save(Aibo).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockAibo(tx, Aibo.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit("CatBuds", "CurrentDelta", "CarriedDelta", "BudgetDay").Save(Aibo).Error; err != nil {
+			return err
+		}
+		if current.BaseCurrency != Aibo.BaseCurrency {
+			if err := refreshBaseAmounts(tx, Aibo, time.Time{}); err != nil {
+				return err
+			}
+		}
+		if err := RecalculateLedger(tx, Aibo.ID); err != nil {
+			return err
+		}
+		return tx.First(Aibo, "id = ?", Aibo.ID).Error
+	})
 }
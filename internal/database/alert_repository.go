@@ -0,0 +1,221 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AlertRepository struct {
+	db *gorm.DB
+}
+
+// NewAlertRepository creates a new AlertRepository instance.
+//
+// The AlertRepository instance is configured with the provided db instance.
+func NewAlertRepository(db *gorm.DB) *AlertRepository {
+	return &AlertRepository{db: db}
+}
+
+// CreateRule records a new alert rule and evaluates it at once, so that a limit already crossed
+// raises its alert without waiting for the next expense.
+func (r *AlertRepository) CreateRule(rule *types.AlertRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		return evaluateRule(tx, rule)
+	})
+}
+
+// GetRuleByID retrieves an alert rule by its ID.
+//
+// If the rule is not found, a gorm.NotFound error is returned.
+func (r *AlertRepository) GetRuleByID(id snowflake.ID) (*types.AlertRule, error) {
+	var rule types.AlertRule
+	err := r.db.First(&rule, "id = ?", id).Error
+	return &rule, err
+}
+
+// GetRulesByAiboID retrieves the alert rules of an Aibo, oldest first.
+//
+// An empty slice is returned when the Aibo has no rule.
+func (r *AlertRepository) GetRulesByAiboID(aiboID uuid.UUID) ([]types.AlertRule, error) {
+	rules := []types.AlertRule{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// UpdateRule saves the changes made to an alert rule and evaluates it again.
+//
+// A rule that already raised its alert for the current period does not raise another one.
+func (r *AlertRepository) UpdateRule(rule *types.AlertRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(rule).Error; err != nil {
+			return err
+		}
+		return evaluateRule(tx, rule)
+	})
+}
+
+// DeleteRule removes an alert rule. The alerts it raised are kept.
+func (r *AlertRepository) DeleteRule(rule *types.AlertRule) error {
+	return r.db.Delete(&types.AlertRule{}, "id = ?", rule.ID).Error
+}
+
+// GetAlertByID retrieves an alert by its ID.
+//
+// If the alert is not found, a gorm.NotFound error is returned.
+func (r *AlertRepository) GetAlertByID(id snowflake.ID) (*types.Alert, error) {
+	var alert types.Alert
+	err := r.db.First(&alert, "id = ?", id).Error
+	return &alert, err
+}
+
+// GetAlertsByAiboID retrieves the alerts of an Aibo, most recent first, optionally only the
+// unread ones.
+//
+// An empty slice is returned when nothing matches.
+func (r *AlertRepository) GetAlertsByAiboID(aiboID uuid.UUID, unreadOnly bool) ([]types.Alert, error) {
+	query := r.db.Where("aibo_id = ?", aiboID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	alerts := []types.Alert{}
+	err := query.Order("id DESC").Find(&alerts).Error
+	return alerts, err
+}
+
+// CountUnread returns the number of alerts of an Aibo it has not read yet.
+func (r *AlertRepository) CountUnread(aiboID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&types.Alert{}).Where("aibo_id = ? AND read_at IS NULL", aiboID).Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks an alert as read. Reading an alert twice keeps the time of the first read.
+func (r *AlertRepository) MarkRead(alert *types.Alert) error {
+	if alert.ReadAt != nil {
+		return nil
+	}
+	now := time.Now()
+	alert.ReadAt = &now
+	return r.db.Model(&types.Alert{}).Where("id = ? AND read_at IS NULL", alert.ID).Update("read_at", now).Error
+}
+
+// MarkAllRead marks every unread alert of an Aibo as read and returns how many were.
+func (r *AlertRepository) MarkAllRead(aiboID uuid.UUID) (int64, error) {
+	result := r.db.Model(&types.Alert{}).Where("aibo_id = ? AND read_at IS NULL", aiboID).Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// GetUndeliveredAlerts retrieves at most limit alerts that were not handed to the notifier yet,
+// oldest first.
+func (r *AlertRepository) GetUndeliveredAlerts(limit int) ([]types.Alert, error) {
+	var alerts []types.Alert
+	err := r.db.Where("delivered_at IS NULL").Order("id").Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
+
+// MarkDelivered records that the alerts were handed to the notifier.
+func (r *AlertRepository) MarkDelivered(ids []snowflake.ID, now time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&types.Alert{}).Where("id IN ?", ids).Update("delivered_at", now).Error
+}
+
+// evaluateRule evaluates a single rule on the current state of the ledger.
+func evaluateRule(tx *gorm.DB, rule *types.AlertRule) error {
+	if rule.Kind == types.AlertBudgetUsed {
+		var catBud types.CatBud
+		if err := tx.Select("aibo_id").First(&catBud, "id = ?", *rule.CatBudID).Error; err != nil {
+			return err
+		}
+		return evaluateCatBudAlerts(tx, catBud.AiboID)
+	}
+	return evaluateDailyAlerts(tx, rule.AiboID)
+}
+
+// evaluateCatBudAlerts raises the budget_used alerts watching the CatBuds held by the Aibo, from
+// their freshly recalculated amounts.
+//
+// The rules watching a shared CatBud belong to any member of its Household: a rule is ignored
+// while its Aibo can no longer see the CatBud.
+func evaluateCatBudAlerts(tx *gorm.DB, holderID uuid.UUID) error {
+	var rules []types.AlertRule
+	err := tx.Model(&types.AlertRule{}).
+		Select("alert_rules.*").
+		Joins("JOIN cat_buds ON cat_buds.id = alert_rules.cat_bud_id").
+		Where("cat_buds.aibo_id = ? AND alert_rules.kind = ? AND alert_rules.muted = ?", holderID, types.AlertBudgetUsed, false).
+		Where(`(cat_buds.household_id IS NULL AND cat_buds.aibo_id = alert_rules.aibo_id)
+			OR EXISTS (SELECT 1 FROM household_members WHERE household_members.household_id = cat_buds.household_id
+				AND household_members.aibo_id = alert_rules.aibo_id)`).
+		Find(&rules).Error
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	ids := make([]snowflake.ID, 0, len(rules))
+	for _, rule := range rules {
+		ids = append(ids, *rule.CatBudID)
+	}
+	var catBuds []types.CatBud
+	if err := tx.Where("id IN ?", ids).Find(&catBuds).Error; err != nil {
+		return err
+	}
+	byID := make(map[snowflake.ID]*types.CatBud, len(catBuds))
+	for i := range catBuds {
+		byID[catBuds[i].ID] = &catBuds[i]
+	}
+
+	for _, rule := range rules {
+		cb := byID[*rule.CatBudID]
+		if cb == nil {
+			continue
+		}
+		if alert := rule.CatBudAlert(cb); alert != nil {
+			if err := raiseAlert(tx, alert); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evaluateDailyAlerts raises the daily budget alerts of the Aibo, from its freshly recalculated
+// CurrentDelta. The alerts are raised for the open budget day.
+func evaluateDailyAlerts(tx *gorm.DB, aiboID uuid.UUID) error {
+	var rules []types.AlertRule
+	err := tx.Where("aibo_id = ? AND kind IN ? AND muted = ?", aiboID,
+		[]types.AlertKind{types.AlertDailyBudgetExceeded, types.AlertDeltaBelow}, false).
+		Find(&rules).Error
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	var aibo types.Aibo
+	if err := tx.First(&aibo, "id = ?", aiboID).Error; err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if alert := rule.DailyAlert(&aibo); alert != nil {
+			if err := raiseAlert(tx, alert); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// raiseAlert records an alert unless its rule already raised one for the same period.
+func raiseAlert(tx *gorm.DB, alert *types.Alert) error {
+	alert.ID = utilitaries.GenerateSnowflakeID()
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(alert).Error
+}
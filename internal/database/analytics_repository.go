@@ -0,0 +1,316 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AnalyticsRepository struct {
+	db *gorm.DB
+}
+
+// AnalyticsScope selects the transactions a report is computed from.
+//
+// With a HouseholdID, the report covers the amounts booked on the CatBuds shared by the Household,
+// by any of its members. Otherwise it covers the transactions of the Aibo.
+//
+// The amounts of a Household are converted into its currency, since its members may keep their
+// books in different base currencies; the amounts of an Aibo are its base amounts.
+type AnalyticsScope struct {
+	AiboID      uuid.UUID
+	HouseholdID *uuid.UUID
+
+	// lineRates selects the rates converting the lines of a Household into its currency, set by
+	// convertLines.
+	lineRates string
+}
+
+// NewAnalyticsRepository creates a new AnalyticsRepository instance.
+//
+// The AnalyticsRepository instance is configured with the provided db instance.
+func NewAnalyticsRepository(db *gorm.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// GetSpendingReport sums the approved transactions of the range [from, to] grouped by the given
+// dimension, and compares each group with the previous range. A calendar grouping is widened to
+// whole buckets, and each bucket is compared with the bucket right before it.
+//
+// The aggregation is done by the database in a single query per report part. An empty slice of
+// groups is returned when nothing was spent.
+func (r *AnalyticsRepository) GetSpendingReport(scope AnalyticsScope, groupBy types.SpendingGrouping, from, to time.Time) (*types.SpendingReport, error) {
+	report := types.SpendingReport{GroupBy: groupBy, Groups: []types.SpendingGroup{}}
+	report.From, report.To = groupBy.Range(from, to)
+	report.PreviousFrom, report.PreviousTo = groupBy.PreviousRange(report.From, report.To)
+
+	args := map[string]interface{}{
+		"aibo":       scope.AiboID,
+		"household":  scope.HouseholdID,
+		"from":       report.From,
+		"to":         report.To,
+		"lines_from": report.PreviousFrom,
+		"lines_to":   report.To,
+	}
+	if err := scope.convertLines(r.db, report.PreviousFrom, report.To); err != nil {
+		return nil, err
+	}
+	lines := spendingLinesSQL(scope.transactions, scope.amount)
+
+	var grouped string
+	switch groupBy {
+	case types.GroupByCategory:
+		grouped = `spending_groups AS (
+				SELECT spending_lines.cat_bud_id, ` + rangeSumsSQL + `
+				FROM spending_lines GROUP BY spending_lines.cat_bud_id),
+			compared AS (
+				SELECT COALESCE(CAST(spending_groups.cat_bud_id AS CHAR), '') AS group_key, spending_groups.cat_bud_id,
+					COALESCE(cat_buds.category, '') AS label, spending_groups.expenses, spending_groups.income,
+					spending_groups.transaction_count, spending_groups.previous_net
+				FROM spending_groups LEFT JOIN cat_buds ON cat_buds.id = spending_groups.cat_bud_id)`
+	case types.GroupByPayee:
+		grouped = `spending_groups AS (
+				SELECT LOWER(spending_lines.payee) AS group_key, MIN(spending_lines.payee) AS label, ` + rangeSumsSQL + `
+				FROM spending_lines GROUP BY LOWER(spending_lines.payee)),
+			compared AS (SELECT spending_groups.*, NULL AS cat_bud_id FROM spending_groups)`
+	default:
+		bucket, step := bucketSQL(groupBy)
+		grouped = `spending_groups AS (
+				SELECT ` + bucket + ` AS bucket, SUM(spending_lines.expense) AS expenses, SUM(spending_lines.income) AS income,
+					COUNT(DISTINCT spending_lines.transaction_id) AS transaction_count
+				FROM spending_lines GROUP BY bucket),
+			compared AS (
+				SELECT DATE_FORMAT(cur.bucket, '%Y-%m-%d') AS group_key, NULL AS cat_bud_id, DATE_FORMAT(cur.bucket, '%Y-%m-%d') AS label,
+					cur.expenses, cur.income, cur.transaction_count, COALESCE(prev.expenses - prev.income, 0) AS previous_net
+				FROM spending_groups cur
+				LEFT JOIN spending_groups prev ON prev.bucket = DATE_SUB(cur.bucket, ` + step + `)
+				WHERE cur.bucket >= @from)`
+	}
+
+	order := "net DESC, group_key"
+	if groupBy.IsTime() {
+		order = "group_key"
+	}
+	err := r.db.Raw(scope.withSQL()+`spending_lines AS (`+lines+`), `+grouped+`
+		SELECT compared.group_key, compared.cat_bud_id, compared.label, `+comparedColumnsSQL+`
+		FROM compared ORDER BY `+order, args).Scan(&report.Groups).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Raw(scope.withSQL()+`spending_lines AS (`+lines+`),
+			compared AS (SELECT `+rangeSumsSQL+` FROM spending_lines)
+		SELECT `+comparedColumnsSQL+` FROM compared`, args).Scan(&report.Total).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// GetBudgetReport compares, for every CatBud in the scope, its budget pro-rated over the range
+// [from, to] with the amounts actually booked on it, and with the amounts booked during the same
+// number of days right before.
+//
+// Without a Household, the CatBuds in the scope are the ones the Aibo can see. The budget is
+// pro-rated from the current period of each CatBud. An empty slice is returned when there is no
+// CatBud in the scope.
+func (r *AnalyticsRepository) GetBudgetReport(scope AnalyticsScope, from, to time.Time) (*types.BudgetReport, error) {
+	report := types.BudgetReport{CatBuds: []types.BudgetComparison{}}
+	report.From, report.To = types.GroupByDay.Range(from, to)
+	report.PreviousFrom, report.PreviousTo = types.PreviousRange(report.From, report.To)
+
+	args := map[string]interface{}{
+		"aibo":       scope.AiboID,
+		"household":  scope.HouseholdID,
+		"from":       report.From,
+		"to":         report.To,
+		"lines_from": report.PreviousFrom,
+		"lines_to":   report.To,
+		"days":       types.PeriodDays(report.From, report.To),
+	}
+
+	if err := scope.convertLines(r.db, report.PreviousFrom, report.To); err != nil {
+		return nil, err
+	}
+	err := r.db.Raw(scope.withSQL()+`spending_lines AS (`+spendingLinesSQL(scope.catBuds, scope.amount)+`),
+			actuals AS (
+				SELECT spending_lines.cat_bud_id, `+rangeSumsSQL+`
+				FROM spending_lines GROUP BY spending_lines.cat_bud_id),
+			compared AS (
+				SELECT cat_buds.id AS cat_bud_id, cat_buds.parent_id, cat_buds.household_id, cat_buds.category,
+					cat_buds.period, cat_buds.budget,
+					ROUND(cat_buds.budget * @days / (DATEDIFF(cat_buds.period_end, cat_buds.period_start) + 1), 2) AS budgeted,
+					COALESCE(actuals.expenses - actuals.income, 0) AS actual,
+					COALESCE(actuals.previous_net, 0) AS previous_actual
+				FROM cat_buds LEFT JOIN actuals ON actuals.cat_bud_id = cat_buds.id
+				WHERE cat_buds.id IN (`+scope.catBudIDsSQL()+`))
+		SELECT compared.*,
+			compared.budgeted - compared.actual AS difference,
+			ROUND(compared.actual * 100 / NULLIF(compared.budgeted, 0), 1) AS used_percent,
+			compared.actual - compared.previous_actual AS change_amount,
+			CASE WHEN compared.previous_actual = 0 THEN NULL
+				ELSE ROUND((compared.actual - compared.previous_actual) * 100 / ABS(compared.previous_actual), 1) END AS change_percent
+		FROM compared ORDER BY compared.category, compared.cat_bud_id`, args).Scan(&report.CatBuds).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// transactions is the condition keeping the amounts of the scope, given the column of the CatBud
+// they are booked on.
+func (s AnalyticsScope) transactions(catBudColumn string) string {
+	if s.HouseholdID == nil {
+		return "transactions.aibo_id = @aibo"
+	}
+	return s.catBuds(catBudColumn)
+}
+
+// catBuds is the condition keeping the amounts booked on the CatBuds of the scope, given the
+// column of the CatBud they are booked on.
+func (s AnalyticsScope) catBuds(catBudColumn string) string {
+	return catBudColumn + " IN (" + s.catBudIDsSQL() + ")"
+}
+
+// catBudIDsSQL selects the IDs of the CatBuds of the scope: the ones shared by the Household, or
+// the ones the Aibo can see.
+func (s AnalyticsScope) catBudIDsSQL() string {
+	if s.HouseholdID != nil {
+		return "SELECT id FROM cat_buds WHERE household_id = @household"
+	}
+	return `SELECT id FROM cat_buds WHERE (aibo_id = @aibo AND household_id IS NULL)
+		OR household_id IN (SELECT household_id FROM household_members WHERE aibo_id = @aibo)`
+}
+
+// amount is the SQL expression of the amount of a spending line in the currency of the scope, given
+// the table holding the line.
+func (s AnalyticsScope) amount(table string) string {
+	if s.HouseholdID == nil {
+		return baseAmount(table)
+	}
+	return "ROUND(" + table + ".amount * COALESCE((SELECT line_rates.rate FROM line_rates " +
+		"WHERE line_rates.currency = transactions.currency AND line_rates.date = transactions.date), 1), 2)"
+}
+
+// baseAmount is the SQL expression of the base amount of a spending line, given the table holding
+// the line.
+func baseAmount(table string) string {
+	return table + ".base_amount"
+}
+
+// withSQL opens the WITH clause of a report query, with the line_rates table of a Household.
+func (s AnalyticsScope) withSQL() string {
+	if s.HouseholdID == nil {
+		return "WITH "
+	}
+	return "WITH line_rates (currency, date, rate) AS (" + s.lineRates + "), "
+}
+
+// convertLines looks up the rates converting the approved amounts booked on the CatBuds of the
+// Household between from and to into the currency of the Household, one per currency and day, and
+// keeps them for the line_rates table. It does nothing for the scope of an Aibo.
+//
+// If a rate is missing, an error wrapping ErrNoExchangeRate is returned.
+func (s *AnalyticsScope) convertLines(db *gorm.DB, from, to time.Time) error {
+	if s.HouseholdID == nil {
+		return nil
+	}
+	var household types.Household
+	if err := db.Select("id", "currency").First(&household, "id = ?", *s.HouseholdID).Error; err != nil {
+		return err
+	}
+
+	type lineDay struct {
+		Currency types.Currency
+		Date     time.Time
+	}
+	var days []lineDay
+	err := db.Raw(`SELECT DISTINCT transactions.currency, transactions.date FROM transactions
+		WHERE transactions.currency <> @currency AND `+approvedSQL+` AND transactions.date BETWEEN @from AND @to
+			AND (transactions.cat_bud_id IN (SELECT id FROM cat_buds WHERE household_id = @household)
+				OR EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_splits.transaction_id = transactions.id
+					AND transaction_splits.cat_bud_id IN (SELECT id FROM cat_buds WHERE household_id = @household)))`,
+		map[string]interface{}{"currency": household.Currency, "household": *s.HouseholdID, "from": from, "to": to}).
+		Scan(&days).Error
+	if err != nil {
+		return err
+	}
+
+	rates := newRateCache(db, household.Currency)
+	rows := make([]string, 0, len(days))
+	for _, day := range days {
+		// The values are written in the query: the currency codes are checked to be plain letters.
+		if !day.Currency.IsValid() {
+			return fmt.Errorf("invalid currency %q", day.Currency)
+		}
+		rate, err := rates.rate(day.Currency, day.Date)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, fmt.Sprintf("SELECT '%s', DATE '%s', %s", day.Currency, day.Date.Format("2006-01-02"),
+			strconv.FormatFloat(rate, 'f', -1, 64)))
+	}
+	if len(rows) == 0 {
+		rows = append(rows, "SELECT NULL, NULL, NULL FROM DUAL WHERE FALSE")
+	}
+	s.lineRates = strings.Join(rows, " UNION ALL ")
+	return nil
+}
+
+// spendingLinesSQL selects the approved amounts between @lines_from and @lines_to, one line per
+// transaction that is not split and one per split line, with the CatBud they are booked on and the
+// RecurringRule that generated them.
+//
+// scope builds the condition keeping the lines of the report from the column of their CatBud, and
+// amount gives the amount of a line from the table holding it.
+func spendingLinesSQL(scope func(catBudColumn string) string, amount func(table string) string) string {
+	direct, split := amount("transactions"), amount("transaction_splits")
+	return `SELECT transactions.id AS transaction_id, transactions.date, TRIM(transactions.payee) AS payee,
+			transactions.cat_bud_id, transactions.recurring_rule_id,
+			CASE WHEN transactions.kind = 'income' THEN 0 ELSE ` + direct + ` END AS expense,
+			CASE WHEN transactions.kind = 'income' THEN ` + direct + ` ELSE 0 END AS income
+		FROM transactions
+		WHERE ` + scope("transactions.cat_bud_id") + ` AND ` + approvedSQL + `
+			AND transactions.date BETWEEN @lines_from AND @lines_to
+			AND NOT EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_splits.transaction_id = transactions.id)
+		UNION ALL
+		SELECT transactions.id, transactions.date, TRIM(transactions.payee), transaction_splits.cat_bud_id, transactions.recurring_rule_id,
+			CASE WHEN transactions.kind = 'income' THEN 0 ELSE ` + split + ` END,
+			CASE WHEN transactions.kind = 'income' THEN ` + split + ` ELSE 0 END
+		FROM transaction_splits JOIN transactions ON transactions.id = transaction_splits.transaction_id
+		WHERE ` + scope("transaction_splits.cat_bud_id") + ` AND ` + approvedSQL + `
+			AND transactions.date BETWEEN @lines_from AND @lines_to`
+}
+
+// rangeSumsSQL sums the spending lines of the range from @from, and the net amount of the lines
+// of the previous range, before @from.
+const rangeSumsSQL = `COALESCE(SUM(CASE WHEN spending_lines.date >= @from THEN spending_lines.expense ELSE 0 END), 0) AS expenses,
+	COALESCE(SUM(CASE WHEN spending_lines.date >= @from THEN spending_lines.income ELSE 0 END), 0) AS income,
+	COUNT(DISTINCT CASE WHEN spending_lines.date >= @from THEN spending_lines.transaction_id END) AS transaction_count,
+	COALESCE(SUM(CASE WHEN spending_lines.date < @from THEN spending_lines.expense - spending_lines.income ELSE 0 END), 0) AS previous_net`
+
+// comparedColumnsSQL derives the columns of types.SpendingTotals from the sums of the compared
+// table.
+const comparedColumnsSQL = `compared.expenses, compared.income, compared.expenses - compared.income AS net,
+	compared.transaction_count, compared.previous_net,
+	compared.expenses - compared.income - compared.previous_net AS change_amount,
+	CASE WHEN compared.previous_net = 0 THEN NULL
+		ELSE ROUND((compared.expenses - compared.income - compared.previous_net) * 100 / ABS(compared.previous_net), 1) END AS change_percent`
+
+// bucketSQL returns the SQL expression of the first day of the calendar bucket of a spending line,
+// and the interval between two buckets.
+func bucketSQL(groupBy types.SpendingGrouping) (string, string) {
+	switch groupBy {
+	case types.GroupByWeek:
+		return "DATE_SUB(spending_lines.date, INTERVAL WEEKDAY(spending_lines.date) DAY)", "INTERVAL 1 WEEK"
+	case types.GroupByMonth:
+		return "DATE_SUB(spending_lines.date, INTERVAL DAYOFMONTH(spending_lines.date) - 1 DAY)", "INTERVAL 1 MONTH"
+	default:
+		return "spending_lines.date", "INTERVAL 1 DAY"
+	}
+}
@@ -0,0 +1,382 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// anomalyLookbackDays is how many days of expenses before a new one the usual amounts of its
+	// CatBuds are learned from.
+	anomalyLookbackDays = 180
+	// anomalyMinHistory is the number of past transactions an Aibo needs before a first payment to a
+	// payee is unusual: everything is new in a fresh ledger.
+	anomalyMinHistory = 20
+	// anomalyFixedChargeDays is how many days of charges of a payee are looked at to tell whether it
+	// always charges the same amount.
+	anomalyFixedChargeDays = 400
+)
+
+type AnomalyRepository struct {
+	db *gorm.DB
+}
+
+// NewAnomalyRepository creates a new AnomalyRepository instance.
+//
+// The AnomalyRepository instance is configured with the provided db instance.
+func NewAnomalyRepository(db *gorm.DB) *AnomalyRepository {
+	return &AnomalyRepository{db: db}
+}
+
+// GetSettings retrieves the anomaly detection settings of an Aibo, or the defaults when it never
+// changed them.
+func (r *AnomalyRepository) GetSettings(aiboID uuid.UUID) (*types.AnomalySettings, error) {
+	return anomalySettings(r.db, aiboID)
+}
+
+// SaveSettings creates or replaces the anomaly detection settings of an Aibo.
+func (r *AnomalyRepository) SaveSettings(settings *types.AnomalySettings) error {
+	return r.db.Save(settings).Error
+}
+
+// GetAnomalyByID retrieves a finding by its ID.
+//
+// If the finding is not found, a gorm.NotFound error is returned.
+func (r *AnomalyRepository) GetAnomalyByID(id snowflake.ID) (*types.Anomaly, error) {
+	var anomaly types.Anomaly
+	err := r.db.First(&anomaly, "id = ?", id).Error
+	return &anomaly, err
+}
+
+// GetAnomaliesByAiboID retrieves the findings of an Aibo, most recent expense first, optionally
+// only the ones with the given status.
+//
+// An empty slice is returned when nothing matches.
+func (r *AnomalyRepository) GetAnomaliesByAiboID(aiboID uuid.UUID, status types.AnomalyStatus) ([]types.Anomaly, error) {
+	query := r.db.Where("aibo_id = ?", aiboID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	anomalies := []types.Anomaly{}
+	err := query.Order("date DESC, id DESC").Find(&anomalies).Error
+	return anomalies, err
+}
+
+// CountOpen returns the number of findings of an Aibo it has not reviewed yet.
+func (r *AnomalyRepository) CountOpen(aiboID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&types.Anomaly{}).Where("aibo_id = ? AND status = ?", aiboID, types.AnomalyOpen).Count(&count).Error
+	return count, err
+}
+
+// Review records the verdict of the Aibo on a finding. A finding can be reviewed again, to change
+// its mind.
+func (r *AnomalyRepository) Review(anomaly *types.Anomaly, status types.AnomalyStatus) error {
+	now := time.Now()
+	err := r.db.Model(anomaly).Updates(map[string]interface{}{"status": status, "reviewed_at": now}).Error
+	if err != nil {
+		return err
+	}
+	anomaly.Status = status
+	anomaly.ReviewedAt = &now
+	return nil
+}
+
+// Scan checks the expenses of an Aibo between two days, included, and records the findings that
+// were not made yet. It returns the number of expenses checked and of new findings.
+//
+// The expenses are checked against the history they had on their day, as if they had just been
+// recorded. The contributions to savings goals and the debt payments are left out. The new findings are already shown
+// to the Aibo by the scan, so they are not sent through the notification channels.
+func (r *AnomalyRepository) Scan(aiboID uuid.UUID, from, to time.Time) (int, int, error) {
+	settings, err := anomalySettings(r.db, aiboID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var transactions []types.Transaction
+	err = r.db.Preload("Splits", orderSplits).
+		Where("aibo_id = ? AND kind = ? AND status <> ? AND date BETWEEN ? AND ?", aiboID, types.TransactionExpense, types.TransactionRejected, from, to).
+		Where("id NOT IN (?)", r.db.Model(&types.SavingsContribution{}).Select("transaction_id").Where("transaction_id IS NOT NULL")).
+		Where("id NOT IN (?)", r.db.Model(&types.DebtPayment{}).Select("transaction_id").Where("transaction_id IS NOT NULL")).
+		Order("date, id").Find(&transactions).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	found := 0
+	now := time.Now()
+	for i := range transactions {
+		findings, err := findAnomalies(r.db, &transactions[i], settings)
+		if err != nil {
+			return 0, 0, err
+		}
+		for j := range findings {
+			findings[j].DeliveredAt = &now
+		}
+		n, err := recordAnomalies(r.db, findings)
+		if err != nil {
+			return 0, 0, err
+		}
+		found += n
+	}
+	return len(transactions), found, nil
+}
+
+// GetUndeliveredAnomalies retrieves at most limit findings that were not handed to the notifier
+// yet, oldest first.
+func (r *AnomalyRepository) GetUndeliveredAnomalies(limit int) ([]types.Anomaly, error) {
+	var anomalies []types.Anomaly
+	err := r.db.Where("delivered_at IS NULL").Order("id").Limit(limit).Find(&anomalies).Error
+	return anomalies, err
+}
+
+// MarkDelivered records that the findings were handed to the notifier.
+func (r *AnomalyRepository) MarkDelivered(ids []snowflake.ID, now time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&types.Anomaly{}).Where("id IN ?", ids).Update("delivered_at", now).Error
+}
+
+// anomalySettings loads the anomaly detection settings of an Aibo, or the defaults.
+func anomalySettings(tx *gorm.DB, aiboID uuid.UUID) (*types.AnomalySettings, error) {
+	var settings types.AnomalySettings
+	err := tx.First(&settings, "aibo_id = ?", aiboID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settings = types.DefaultAnomalySettings(aiboID)
+		return &settings, nil
+	}
+	return &settings, err
+}
+
+// checkAnomalies looks for anomalies in a Transaction that was just recorded, unless the Aibo
+// turned the detection off.
+//
+// It must be called with the database transaction of the ledger write, so that a finding is never
+// made, nor sent, for a change that was rolled back.
+func checkAnomalies(tx *gorm.DB, t *types.Transaction) error {
+	settings, err := anomalySettings(tx, t.AiboID)
+	if err != nil || !settings.Enabled {
+		return err
+	}
+	findings, err := findAnomalies(tx, t, settings)
+	if err != nil {
+		return err
+	}
+	_, err = recordAnomalies(tx, findings)
+	return err
+}
+
+// recheckAnomalies drops the open findings of a changed Transaction and looks for anomalies in it
+// again. The findings the Aibo already reviewed are kept.
+func recheckAnomalies(tx *gorm.DB, t *types.Transaction) error {
+	err := tx.Delete(&types.Anomaly{}, "transaction_id = ? AND status = ?", t.ID, types.AnomalyOpen).Error
+	if err != nil {
+		return err
+	}
+	return checkAnomalies(tx, t)
+}
+
+// deleteAnomalies removes the findings about a Transaction that leaves the ledger, including the
+// ones flagging another expense as its duplicate.
+func deleteAnomalies(tx *gorm.DB, transactionID snowflake.ID) error {
+	return tx.Delete(&types.Anomaly{}, "transaction_id = ? OR related_transaction_id = ?", transactionID, transactionID).Error
+}
+
+// recordAnomalies inserts the findings that were not made yet and returns how many were.
+func recordAnomalies(tx *gorm.DB, findings []types.Anomaly) (int, error) {
+	found := 0
+	for i := range findings {
+		findings[i].ID = utilitaries.GenerateSnowflakeID()
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&findings[i])
+		if result.Error != nil {
+			return found, result.Error
+		}
+		found += int(result.RowsAffected)
+	}
+	return found, nil
+}
+
+// findAnomalies checks an expense against the history of its Aibo and returns the findings, at
+// most one of each kind. Incomes and rejected expenses are never unusual.
+//
+// The history is what was recorded before the expense: the earlier days, and the transactions
+// recorded earlier the same day. The occurrences of a RecurringRule are never flagged for their
+// payee or their amount, which the Aibo chose when setting up the rule.
+func findAnomalies(tx *gorm.DB, t *types.Transaction, settings *types.AnomalySettings) ([]types.Anomaly, error) {
+	if t.Kind != types.TransactionExpense || t.Status == types.TransactionRejected {
+		return nil, nil
+	}
+
+	var aibo types.Aibo
+	if err := tx.Select("base_currency").First(&aibo, "id = ?", t.AiboID).Error; err != nil {
+		return nil, err
+	}
+
+	var findings []types.Anomaly
+	finding := func(kind types.AnomalyKind, score float64, message string) *types.Anomaly {
+		findings = append(findings, types.Anomaly{
+			AiboID:        t.AiboID,
+			TransactionID: t.ID,
+			Kind:          kind,
+			Payee:         t.Payee,
+			Date:          t.Date,
+			Amount:        t.BaseAmount,
+			Score:         math.Round(score*100) / 100,
+			Message:       message,
+			Status:        types.AnomalyOpen,
+		})
+		return &findings[len(findings)-1]
+	}
+
+	outlier, err := categoryOutlier(tx, t, settings.ZScoreThreshold)
+	if err != nil {
+		return nil, err
+	}
+	if outlier != nil {
+		f := finding(types.AnomalyCategoryOutlier, outlier.z, fmt.Sprintf("%s: %s %s is %.1f standard deviations above the usual %s",
+			outlier.category, outlier.amount, aibo.BaseCurrency, outlier.z, outlier.mean))
+		f.CatBudID = &outlier.catBudID
+		f.Amount = outlier.amount
+	}
+
+	payee := strings.TrimSpace(t.Payee)
+	if payee != "" && t.RecurringRuleID == nil && t.BaseAmount >= settings.NewPayeeMinAmount {
+		var history struct {
+			Transactions int64
+			SamePayee    int64
+		}
+		err := tx.Raw(`SELECT COUNT(*) AS transactions, COALESCE(SUM(LOWER(TRIM(payee)) = LOWER(?)), 0) AS same_payee
+			FROM transactions WHERE aibo_id = ? AND id <> ? AND (date < ? OR (date = ? AND id < ?))`,
+			payee, t.AiboID, t.ID, t.Date, t.Date, t.ID).Scan(&history).Error
+		if err != nil {
+			return nil, err
+		}
+		if history.Transactions >= anomalyMinHistory && history.SamePayee == 0 {
+			finding(types.AnomalyNewPayee, settings.NewPayeeScore(t.BaseAmount), fmt.Sprintf("First payment to %s: %s %s", payee, t.Amount, t.Currency))
+		}
+	}
+
+	if payee != "" && t.RecurringRuleID == nil {
+		var charges types.ChargeHistory
+		err := tx.Raw(`SELECT COUNT(*) AS charges, COALESCE(MIN(amount), 0) AS low, COALESCE(MAX(amount), 0) AS high
+			FROM transactions
+			WHERE aibo_id = ? AND id <> ? AND kind = ? AND status <> ? AND currency = ? AND LOWER(TRIM(payee)) = LOWER(?)
+				AND date BETWEEN ? AND ?`,
+			t.AiboID, t.ID, types.TransactionExpense, types.TransactionRejected, t.Currency, payee,
+			t.Date.AddDate(0, 0, -anomalyFixedChargeDays), t.Date.AddDate(0, 0, -1)).Scan(&charges).Error
+		if err != nil {
+			return nil, err
+		}
+		if change, ok := charges.AmountChange(t.Amount); ok {
+			finding(types.AnomalyAmountChanged, change, fmt.Sprintf("%s charged %s %s instead of the usual %s", payee, t.Amount, t.Currency, charges.Low))
+		}
+	}
+
+	if payee != "" || (t.CatBudID != nil && len(t.Splits) == 0) {
+		query := tx.Where("aibo_id = ? AND id < ? AND kind = ? AND status <> ? AND amount = ? AND currency = ? AND date BETWEEN ? AND ?",
+			t.AiboID, t.ID, types.TransactionExpense, types.TransactionRejected, t.Amount, t.Currency,
+			t.Date.AddDate(0, 0, -settings.DuplicateWindowDays), t.Date.AddDate(0, 0, settings.DuplicateWindowDays))
+		if payee != "" {
+			query = query.Where("LOWER(TRIM(payee)) = LOWER(?)", payee)
+		} else {
+			query = query.Where("TRIM(payee) = '' AND cat_bud_id = ?", *t.CatBudID)
+		}
+		// Two occurrences of the same rule are expected to be alike.
+		if t.RecurringRuleID != nil {
+			query = query.Where("(recurring_rule_id IS NULL OR recurring_rule_id <> ?)", *t.RecurringRuleID)
+		}
+
+		var original types.Transaction
+		err := query.Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "ABS(DATEDIFF(date, ?)), id DESC", Vars: []interface{}{t.Date}}}).
+			Take(&original).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			what := original.Payee
+			if what == "" {
+				what = "the same budget"
+			}
+			f := finding(types.AnomalyDuplicateCharge, 1, fmt.Sprintf("Possible duplicate of the %s %s charge from %s on %s",
+				original.Amount, original.Currency, what, original.Date.Format("2006-01-02")))
+			f.RelatedTransactionID = &original.ID
+		}
+	}
+
+	return findings, nil
+}
+
+// outlierLine is the line of an expense furthest above the usual expenses of its CatBud.
+type outlierLine struct {
+	catBudID snowflake.ID
+	category string
+	amount   types.Money
+	mean     types.Money
+	z        float64
+}
+
+// categoryOutlier returns the line of the expense whose z-score against the past expenses of its
+// CatBud is the highest, if it reaches the threshold. The usual amounts are the approved expense
+// lines of the CatBud over the last anomalyLookbackDays days, by any member of its Household.
+func categoryOutlier(tx *gorm.DB, t *types.Transaction, threshold float64) (*outlierLine, error) {
+	type line struct {
+		catBudID snowflake.ID
+		amount   types.Money
+	}
+	var lines []line
+	if len(t.Splits) == 0 && t.CatBudID != nil {
+		lines = append(lines, line{catBudID: *t.CatBudID, amount: t.BaseAmount})
+	}
+	for _, split := range t.Splits {
+		if split.CatBudID != nil {
+			lines = append(lines, line{catBudID: *split.CatBudID, amount: split.BaseAmount})
+		}
+	}
+
+	var outlier *outlierLine
+	for _, l := range lines {
+		var stats types.ExpenseStats
+		err := tx.Raw(`WITH spending_lines AS (`+spendingLinesSQL(func(column string) string { return column + " = @cat_bud" }, baseAmount)+`)
+			SELECT COUNT(*) AS samples, COALESCE(AVG(spending_lines.expense), 0) AS mean, COALESCE(STDDEV_POP(spending_lines.expense), 0) AS std_dev
+			FROM spending_lines
+			WHERE spending_lines.expense > 0 AND spending_lines.transaction_id <> @transaction
+				AND (spending_lines.date < @date OR spending_lines.transaction_id < @transaction)`,
+			map[string]interface{}{
+				"cat_bud":     l.catBudID,
+				"transaction": t.ID,
+				"date":        t.Date,
+				"lines_from":  t.Date.AddDate(0, 0, -anomalyLookbackDays),
+				"lines_to":    t.Date,
+			}).Scan(&stats).Error
+		if err != nil {
+			return nil, err
+		}
+		z, ok := stats.ZScore(l.amount)
+		if !ok || z < threshold || (outlier != nil && z <= outlier.z) {
+			continue
+		}
+		outlier = &outlierLine{catBudID: l.catBudID, amount: l.amount, mean: types.MoneyFromFloat(stats.Mean), z: z}
+	}
+
+	if outlier != nil {
+		var catBud types.CatBud
+		if err := tx.Select("category").First(&catBud, "id = ?", outlier.catBudID).Error; err != nil {
+			return nil, err
+		}
+		outlier.category = catBud.Category
+	}
+	return outlier, nil
+}
@@ -0,0 +1,458 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRuleCatBud is returned when the CatBud of an approval rule is not shared by its
+	// Household.
+	ErrInvalidRuleCatBud = errors.New("the cat bud is not shared by the household")
+	// ErrOwnRequest is returned when an Aibo decides on an approval request for its own expense.
+	ErrOwnRequest = errors.New("an expense cannot be approved by the member who recorded it")
+	// ErrAlreadyDecided is returned when an Aibo decides twice on the same approval request.
+	ErrAlreadyDecided = errors.New("you already decided on this approval request")
+	// ErrRequestClosed is returned when deciding on an approval request that is no longer pending.
+	ErrRequestClosed = errors.New("the approval request is no longer pending")
+)
+
+type ApprovalRepository struct {
+	db *gorm.DB
+}
+
+// NewApprovalRepository creates a new ApprovalRepository instance.
+//
+// The ApprovalRepository instance is configured with the provided db instance.
+func NewApprovalRepository(db *gorm.DB) *ApprovalRepository {
+	return &ApprovalRepository{db: db}
+}
+
+// CreateRule records a new approval rule.
+//
+// If the CatBud of the rule is not shared by its Household, ErrInvalidRuleCatBud is returned.
+func (r *ApprovalRepository) CreateRule(rule *types.ApprovalRule) error {
+	if err := checkRuleCatBud(r.db, rule); err != nil {
+		return err
+	}
+	return r.db.Create(rule).Error
+}
+
+// GetRuleByID retrieves an approval rule by its ID.
+//
+// If the rule is not found, a gorm.NotFound error is returned.
+func (r *ApprovalRepository) GetRuleByID(id snowflake.ID) (*types.ApprovalRule, error) {
+	var rule types.ApprovalRule
+	err := r.db.First(&rule, "id = ?", id).Error
+	return &rule, err
+}
+
+// GetRulesByHouseholdID retrieves the approval rules of a Household, oldest first.
+//
+// An empty slice is returned when the Household has no rule.
+func (r *ApprovalRepository) GetRulesByHouseholdID(householdID uuid.UUID) ([]types.ApprovalRule, error) {
+	rules := []types.ApprovalRule{}
+	err := r.db.Where("household_id = ?", householdID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// UpdateRule saves the changes made to an approval rule. The rule applies to the expenses
+// recorded afterwards; pending requests keep their settings.
+//
+// If the CatBud of the rule is not shared by its Household, ErrInvalidRuleCatBud is returned.
+func (r *ApprovalRepository) UpdateRule(rule *types.ApprovalRule) error {
+	if err := checkRuleCatBud(r.db, rule); err != nil {
+		return err
+	}
+	return r.db.Save(rule).Error
+}
+
+// DeleteRule removes an approval rule. Pending requests raised by the rule stay pending.
+func (r *ApprovalRepository) DeleteRule(rule *types.ApprovalRule) error {
+	return r.db.Delete(&types.ApprovalRule{}, "id = ?", rule.ID).Error
+}
+
+// GetRequestByID retrieves an approval request with its decisions and its Transaction.
+//
+// If the request is not found, a gorm.NotFound error is returned.
+func (r *ApprovalRepository) GetRequestByID(id snowflake.ID) (*types.ApprovalRequest, error) {
+	var request types.ApprovalRequest
+	if err := r.db.Preload("Decisions", orderDecisions).First(&request, "id = ?", id).Error; err != nil {
+		return &request, err
+	}
+	requests := []types.ApprovalRequest{request}
+	err := fillTransactions(r.db, requests)
+	return &requests[0], err
+}
+
+// GetRequestsByHouseholdID retrieves the approval requests of a Household, most recent first,
+// optionally narrowed down to one status.
+//
+// An empty slice is returned when nothing matches.
+func (r *ApprovalRepository) GetRequestsByHouseholdID(householdID uuid.UUID, status types.ApprovalStatus) ([]types.ApprovalRequest, error) {
+	query := r.db.Where("household_id = ?", householdID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	requests := []types.ApprovalRequest{}
+	if err := query.Preload("Decisions", orderDecisions).Order("id DESC").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, fillTransactions(r.db, requests)
+}
+
+// GetRequestsToDecide retrieves the pending approval requests an Aibo can still decide on: the
+// ones of the Households where it is an editor or an owner, for the expenses of other members,
+// that it did not answer yet. The oldest come first.
+func (r *ApprovalRepository) GetRequestsToDecide(aiboID uuid.UUID) ([]types.ApprovalRequest, error) {
+	requests := []types.ApprovalRequest{}
+	err := r.db.Where("status = ? AND requested_by <> ?", types.ApprovalPending, aiboID).
+		Where("household_id IN (?)", r.db.Model(&types.HouseholdMember{}).Select("household_id").
+			Where("aibo_id = ? AND role IN ?", aiboID, []types.HouseholdRole{types.RoleEditor, types.RoleOwner})).
+		Where("id NOT IN (?)", r.db.Model(&types.ApprovalDecision{}).Select("approval_request_id").Where("aibo_id = ?", aiboID)).
+		Preload("Decisions", orderDecisions).Order("id").Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, fillTransactions(r.db, requests)
+}
+
+// Decide records the decision of a member on an approval request.
+//
+// A rejection rejects the Transaction at once and closes its other requests. Once every request of
+// the Transaction received enough approvals, the Transaction is approved. Either way the ledger of
+// the Aibo that recorded the Transaction is recalculated in the same database transaction, so an
+// approved expense starts counting in the budgets and a rejected one stops showing as pending.
+//
+// If the Aibo recorded the expense, ErrOwnRequest is returned. If it already decided,
+// ErrAlreadyDecided is returned. If the request is no longer pending, ErrRequestClosed is returned.
+func (r *ApprovalRepository) Decide(request *types.ApprovalRequest, aiboID uuid.UUID, decision types.ApprovalDecisionKind, comment string) error {
+	if request.RequestedBy == aiboID {
+		return ErrOwnRequest
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// The ledger lock comes first, as for every other write on the Transaction.
+		if _, err := lockAibo(tx, request.RequestedBy); err != nil {
+			return err
+		}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(request, "id = ?", request.ID).Error
+		if err != nil {
+			return err
+		}
+		if request.Status != types.ApprovalPending {
+			return ErrRequestClosed
+		}
+
+		var decided int64
+		err = tx.Model(&types.ApprovalDecision{}).
+			Where("approval_request_id = ? AND aibo_id = ?", request.ID, aiboID).Count(&decided).Error
+		if err != nil {
+			return err
+		}
+		if decided > 0 {
+			return ErrAlreadyDecided
+		}
+
+		record := types.ApprovalDecision{
+			ID:                utilitaries.GenerateSnowflakeID(),
+			ApprovalRequestID: request.ID,
+			AiboID:            aiboID,
+			Decision:          decision,
+			Comment:           comment,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{}
+		if decision == types.DecisionReject {
+			request.Status = types.ApprovalRejected
+		} else {
+			request.Approvals++
+			updates["approvals"] = request.Approvals
+			if request.Approvals >= request.RequiredApprovals {
+				request.Status = types.ApprovalApproved
+			}
+		}
+		updates["status"] = request.Status
+		if request.Status != types.ApprovalPending {
+			request.ResolvedAt = &now
+			updates["resolved_at"] = now
+		}
+		if err := tx.Model(&types.ApprovalRequest{}).Where("id = ?", request.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := resolveTransaction(tx, request.TransactionID, now); err != nil {
+			return err
+		}
+		if err := RecalculateLedger(tx, request.RequestedBy); err != nil {
+			return err
+		}
+
+		if err := tx.Where("approval_request_id = ?", request.ID).Order("created_at, id").Find(&request.Decisions).Error; err != nil {
+			return err
+		}
+		requests := []types.ApprovalRequest{*request}
+		err = fillTransactions(tx, requests)
+		*request = requests[0]
+		return err
+	})
+}
+
+// resolveTransaction derives the status of a Transaction from its approval requests: rejected as
+// soon as one of them is rejected, in which case the others are closed, and approved once all of
+// them are approved.
+func resolveTransaction(tx *gorm.DB, transactionID snowflake.ID, now time.Time) error {
+	var requests []types.ApprovalRequest
+	err := tx.Where("transaction_id = ? AND status <> ?", transactionID, types.ApprovalCancelled).Find(&requests).Error
+	if err != nil {
+		return err
+	}
+
+	status := types.TransactionApproved
+	for _, request := range requests {
+		if request.Status == types.ApprovalRejected {
+			status = types.TransactionRejected
+			break
+		}
+		if request.Status == types.ApprovalPending {
+			status = types.TransactionPending
+		}
+	}
+
+	if status == types.TransactionRejected {
+		if err := cancelApprovals(tx, transactionID, now); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&types.Transaction{}).Where("id = ?", transactionID).Update("status", status).Error
+}
+
+// requestApprovals raises the approval requests an expense needs and marks it pending when it
+// needs any.
+//
+// The shares of the expense booked on the CatBuds of a Household are checked against the rules of
+// that Household: a rule applies to its CatBud and every subcategory of it, or to every CatBud of
+// the Household when it has none, and is triggered when the shares it covers add up to more than
+// its threshold, the shares being converted into the currency of the Household first. When several
+// rules are triggered, the most demanding one is kept. One request is
+// raised per Household, unless no other member of the Household can approve. Incomes never need
+// approval.
+func requestApprovals(tx *gorm.DB, t *types.Transaction) error {
+	t.Status = types.TransactionApproved
+	if t.Kind != types.TransactionExpense {
+		return nil
+	}
+
+	shares := t.CatBudShares()
+	if len(shares) == 0 {
+		return nil
+	}
+	ids := make([]snowflake.ID, 0, len(shares))
+	for id := range shares {
+		ids = append(ids, id)
+	}
+
+	var booked []types.CatBud
+	if err := tx.Where("id IN ? AND household_id IS NOT NULL", ids).Find(&booked).Error; err != nil {
+		return err
+	}
+	byHousehold := make(map[uuid.UUID][]types.CatBud)
+	for _, cb := range booked {
+		byHousehold[*cb.HouseholdID] = append(byHousehold[*cb.HouseholdID], cb)
+	}
+
+	for householdID, catBuds := range byHousehold {
+		var household types.Household
+		if err := tx.Select("id", "currency").First(&household, "id = ?", householdID).Error; err != nil {
+			return err
+		}
+		rate, err := rateOn(tx, t.Currency, household.Currency, t.Date)
+		if err != nil {
+			return err
+		}
+		converted := make(map[snowflake.ID]types.Money, len(catBuds))
+		for _, cb := range catBuds {
+			converted[cb.ID] = shares[cb.ID].Mul(rate)
+		}
+
+		rule, amount, err := triggeredRule(tx, householdID, converted)
+		if err != nil {
+			return err
+		}
+		if rule == nil {
+			continue
+		}
+
+		var approvers int64
+		err = tx.Model(&types.HouseholdMember{}).
+			Where("household_id = ? AND aibo_id <> ? AND role IN ?", householdID, t.AiboID,
+				[]types.HouseholdRole{types.RoleEditor, types.RoleOwner}).
+			Count(&approvers).Error
+		if err != nil {
+			return err
+		}
+		if approvers == 0 {
+			continue
+		}
+
+		request := types.ApprovalRequest{
+			ID:                utilitaries.GenerateSnowflakeID(),
+			TransactionID:     t.ID,
+			HouseholdID:       householdID,
+			RuleID:            rule.ID,
+			RequestedBy:       t.AiboID,
+			Amount:            amount,
+			RequiredApprovals: min(rule.RequiredApprovals, int(approvers)),
+			Status:            types.ApprovalPending,
+		}
+		if err := tx.Omit("Decisions").Create(&request).Error; err != nil {
+			return err
+		}
+		t.Status = types.TransactionPending
+	}
+
+	if t.Status == types.TransactionPending {
+		return tx.Model(&types.Transaction{}).Where("id = ?", t.ID).Update("status", t.Status).Error
+	}
+	return nil
+}
+
+// triggeredRule returns the most demanding rule of the Household triggered by the shares booked on
+// its CatBuds, along with the amount it covers, or nil when no rule is triggered, as described by
+// types.TriggeredApprovalRule.
+func triggeredRule(tx *gorm.DB, householdID uuid.UUID, shares map[snowflake.ID]types.Money) (*types.ApprovalRule, types.Money, error) {
+	var rules []types.ApprovalRule
+	if err := tx.Where("household_id = ?", householdID).Order("id").Find(&rules).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(rules) == 0 {
+		return nil, 0, nil
+	}
+
+	var all []types.CatBud
+	if err := tx.Select("id", "parent_id").Where("household_id = ?", householdID).Find(&all).Error; err != nil {
+		return nil, 0, err
+	}
+	parents := make(map[snowflake.ID]*snowflake.ID, len(all))
+	for _, cb := range all {
+		parents[cb.ID] = cb.ParentID
+	}
+
+	rule, amount := types.TriggeredApprovalRule(rules, parents, shares)
+	return rule, amount, nil
+}
+
+// needsNewApproval reports whether an update changes what the members were asked to approve: the
+// kind or the currency of the Transaction, or the amounts booked on its CatBuds.
+func needsNewApproval(stored, updated *types.Transaction) bool {
+	if stored.Kind != updated.Kind || stored.Currency != updated.Currency {
+		return true
+	}
+	before, after := stored.CatBudShares(), updated.CatBudShares()
+	if len(before) != len(after) {
+		return true
+	}
+	for id, amount := range after {
+		if previous, ok := before[id]; !ok || previous != amount {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelApprovals closes the pending approval requests of a Transaction, which no longer apply.
+func cancelApprovals(tx *gorm.DB, transactionID snowflake.ID, now time.Time) error {
+	return tx.Model(&types.ApprovalRequest{}).
+		Where("transaction_id = ? AND status = ?", transactionID, types.ApprovalPending).
+		Updates(map[string]interface{}{"status": types.ApprovalCancelled, "resolved_at": now}).Error
+}
+
+// closeHouseholdApprovals cancels the pending approval requests of a Household and settles the
+// status of their transactions without them. It returns the Aibos that recorded these
+// transactions, whose ledgers must be recalculated.
+func closeHouseholdApprovals(tx *gorm.DB, householdID uuid.UUID) ([]uuid.UUID, error) {
+	var requests []types.ApprovalRequest
+	err := tx.Where("household_id = ? AND status = ?", householdID, types.ApprovalPending).Find(&requests).Error
+	if err != nil || len(requests) == 0 {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = tx.Model(&types.ApprovalRequest{}).
+		Where("household_id = ? AND status = ?", householdID, types.ApprovalPending).
+		Updates(map[string]interface{}{"status": types.ApprovalCancelled, "resolved_at": now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var requesters []uuid.UUID
+	for _, request := range requests {
+		if err := resolveTransaction(tx, request.TransactionID, now); err != nil {
+			return nil, err
+		}
+		if !seen[request.RequestedBy] {
+			seen[request.RequestedBy] = true
+			requesters = append(requesters, request.RequestedBy)
+		}
+	}
+	return requesters, nil
+}
+
+// checkRuleCatBud returns ErrInvalidRuleCatBud unless the rule has no CatBud or its CatBud is
+// shared by the Household of the rule.
+func checkRuleCatBud(db *gorm.DB, rule *types.ApprovalRule) error {
+	if rule.CatBudID == nil {
+		return nil
+	}
+	var count int64
+	err := db.Model(&types.CatBud{}).Where("id = ? AND household_id = ?", *rule.CatBudID, rule.HouseholdID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidRuleCatBud
+	}
+	return nil
+}
+
+// fillTransactions sets the Transaction, with its split lines, on each approval request.
+func fillTransactions(db *gorm.DB, requests []types.ApprovalRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	ids := make([]snowflake.ID, 0, len(requests))
+	for _, request := range requests {
+		ids = append(ids, request.TransactionID)
+	}
+
+	var transactions []types.Transaction
+	if err := db.Preload("Splits", orderSplits).Where("id IN ?", ids).Find(&transactions).Error; err != nil {
+		return err
+	}
+	byID := make(map[snowflake.ID]*types.Transaction, len(transactions))
+	for i := range transactions {
+		byID[transactions[i].ID] = &transactions[i]
+	}
+	for i := range requests {
+		requests[i].Transaction = byID[requests[i].TransactionID]
+	}
+	return nil
+}
+
+// orderDecisions returns the decisions in the order they were made.
+func orderDecisions(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at, id")
+}
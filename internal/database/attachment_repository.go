@@ -0,0 +1,113 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrStorageFull is returned when a file would take an Aibo over the storage of its plan.
+var ErrStorageFull = errors.New("the storage of your plan is full")
+
+// AttachmentRepository handles the files attached to the transactions and the CatBuds. The files
+// themselves are in the storage; the repository only keeps track of them.
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+// NewAttachmentRepository creates a new AttachmentRepository instance.
+//
+// The AttachmentRepository instance is configured with the provided db instance.
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// CreateAttachment records a file uploaded to the storage, under the lock of its Aibo so that
+// concurrent uploads cannot go over the storage of its plan together.
+//
+// The file counts in the storage with its thumbnail. If they would take the Aibo over its storage,
+// the error wraps ErrStorageFull.
+func (r *AttachmentRepository) CreateAttachment(attachment *types.Attachment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, attachment.AiboID)
+		if err != nil {
+			return err
+		}
+		used, err := usedStorage(tx, attachment.AiboID)
+		if err != nil {
+			return err
+		}
+		limits := types.AttachmentLimitsFor(aibo)
+		if used+attachment.StoredSize() > limits.MaxTotalSize {
+			return fmt.Errorf("%w: %d of %d MB used", ErrStorageFull, used>>20, limits.MaxTotalSize>>20)
+		}
+		return tx.Create(attachment).Error
+	})
+}
+
+// GetAttachmentByID retrieves an Attachment by its ID.
+//
+// If the Attachment is not found, a gorm.NotFound error is returned.
+func (r *AttachmentRepository) GetAttachmentByID(id snowflake.ID) (*types.Attachment, error) {
+	var attachment types.Attachment
+	err := r.db.First(&attachment, "id = ?", id).Error
+	return &attachment, err
+}
+
+// GetAttachmentsByTransactionID retrieves the files attached to a Transaction, most recent first.
+//
+// An empty slice is returned when there is none.
+func (r *AttachmentRepository) GetAttachmentsByTransactionID(transactionID snowflake.ID) ([]types.Attachment, error) {
+	attachments := []types.Attachment{}
+	err := r.db.Where("transaction_id = ?", transactionID).Order("id DESC").Find(&attachments).Error
+	return attachments, err
+}
+
+// GetAttachmentsByCatBudID retrieves the files attached to a CatBud, most recent first.
+//
+// An empty slice is returned when there is none.
+func (r *AttachmentRepository) GetAttachmentsByCatBudID(catBudID snowflake.ID) ([]types.Attachment, error) {
+	attachments := []types.Attachment{}
+	err := r.db.Where("cat_bud_id = ?", catBudID).Order("id DESC").Find(&attachments).Error
+	return attachments, err
+}
+
+// GetUsedStorage returns the total size of the files an Aibo attached and of their thumbnails, in
+// bytes.
+func (r *AttachmentRepository) GetUsedStorage(aiboID uuid.UUID) (int64, error) {
+	return usedStorage(r.db, aiboID)
+}
+
+// DeleteAttachment removes the record of a file, once it is removed from the storage.
+func (r *AttachmentRepository) DeleteAttachment(attachment *types.Attachment) error {
+	return r.db.Delete(&types.Attachment{}, "id = ?", attachment.ID).Error
+}
+
+// GetOrphanedAttachments retrieves at most limit files whose Transaction or CatBud was deleted,
+// oldest first, to be removed from the storage.
+func (r *AttachmentRepository) GetOrphanedAttachments(limit int) ([]types.Attachment, error) {
+	var attachments []types.Attachment
+	err := r.db.Where("transaction_id IS NULL AND cat_bud_id IS NULL").Order("id").Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+// usedStorage sums the sizes of the files an Aibo attached and of their thumbnails. The orphaned files waiting to be
+// removed from the storage no longer count.
+func usedStorage(tx *gorm.DB, aiboID uuid.UUID) (int64, error) {
+	var used int64
+	err := tx.Model(&types.Attachment{}).
+		Where("aibo_id = ? AND (transaction_id IS NOT NULL OR cat_bud_id IS NOT NULL)", aiboID).
+		Select("COALESCE(SUM(size + thumbnail_size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// detachAttachments detaches the files from a Transaction or a CatBud being deleted, given the
+// column naming it. They are left orphaned, for the attachment cleanup job to remove them from the
+// storage once the database transaction is committed.
+func detachAttachments(tx *gorm.DB, column string, id snowflake.ID) error {
+	return tx.Model(&types.Attachment{}).Where(column+" = ?", id).Update(column, nil).Error
+}
@@ -2,13 +2,20 @@ package database
 
 import (
 	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/bwmarrin/snowflake"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrInvalidParent is returned when the parent of a CatBud does not exist, belongs to another
+// Aibo or would make the categories loop.
+var ErrInvalidParent = errors.New("invalid parent category")
+
 type CatBudRepository struct {
 	db *gorm.DB
 }
@@ -22,18 +29,52 @@ func NewCatBudRepository(db *gorm.DB) *CatBudRepository {
 
 // CreateCatBud creates a new CatBud entry in the database.
 //
-// The CatBud is created using the provided CatBud instance. If the CatBud is created successfully,
-// a nil error is returned. If there is an error during creation, a gorm error is returned.
+// The CatBud is created using the provided CatBud instance and its current period and amounts
+// are derived from the ledger in the same database transaction. If the CatBud is created
+// successfully, a nil error is returned. If its parent is invalid, ErrInvalidParent is returned.
+// If there is an error during creation, a gorm error is returned.
 func (r *CatBudRepository) CreateCatBud(catBud *types.CatBud) error {
-	return r.db.Create(catBud).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, catBud.AiboID); err != nil {
+			return err
+		}
+		if err := checkParent(tx, catBud); err != nil {
+			return err
+		}
+		if err := tx.Create(catBud).Error; err != nil {
+			return err
+		}
+		if err := RecalculateLedger(tx, catBud.AiboID); err != nil {
+			return err
+		}
+		return tx.First(catBud, "id = ?", catBud.ID).Error
+	})
 }
 
 // UpdateCatBud updates an existing CatBud entry in the database.
 //
-// The CatBud is updated using the provided CatBud instance. If the CatBud is updated successfully,
-// a nil error is returned. If there is an error during updating, a gorm error is returned.
+// The CatBud is updated using the provided CatBud instance and its derived amounts are recalculated
+// from the ledger in the same database transaction. Changing its parent moves the CatBud along with
+// its subcategories, transactions and envelope history; the roll-ups of the old and new parents
+// follow since they are derived from the tree. If the CatBud is updated successfully, a nil error
+// is returned. If its new parent is invalid, ErrInvalidParent is returned. If there is an error
+// during updating, a gorm error is returned.
 func (r *CatBudRepository) UpdateCatBud(catBud *types.CatBud) error {
-	return r.db.Save(catBud).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, catBud.AiboID); err != nil {
+			return err
+		}
+		if err := checkParent(tx, catBud); err != nil {
+			return err
+		}
+		if err := tx.Save(catBud).Error; err != nil {
+			return err
+		}
+		if err := RecalculateLedger(tx, catBud.AiboID); err != nil {
+			return err
+		}
+		return tx.First(catBud, "id = ?", catBud.ID).Error
+	})
 }
 
 // GetCatBudByID retrieves a CatBud entry by its ID from the database.
@@ -46,31 +87,246 @@ func (r *CatBudRepository) GetCatBudByID(id snowflake.ID) (*types.CatBud, error)
 	return &catBud, err
 }
 
-// GetAllCatBudsByAiboID retrieves all CatBud entries associated with a specific AiboID from the database.
+// GetCatBudRole returns the rights of an Aibo on a CatBud: the role of the Aibo in the Household
+// of a shared CatBud, owner for its own personal CatBud, and an empty role otherwise.
+func (r *CatBudRepository) GetCatBudRole(aiboID uuid.UUID, catBud *types.CatBud) (types.HouseholdRole, error) {
+	if catBud.HouseholdID == nil {
+		if catBud.AiboID == aiboID {
+			return types.RoleOwner, nil
+		}
+		return "", nil
+	}
+	return NewHouseholdRepository(r.db).GetRole(*catBud.HouseholdID, aiboID)
+}
+
+// GetAllCatBudsByAiboID retrieves all CatBud entries an Aibo can see from the database.
 //
-// The function queries the database for CatBud entries that match the provided AiboID. If entries are found,
-// they are returned as a slice. If no entries are found, a custom error is returned indicating that no CatBuds
-// were found for the given AiboID.
+// The function queries the database for the personal CatBuds of the Aibo and the CatBuds of the
+// Households it is a member of, and returns them as a slice. An empty slice is returned when the
+// Aibo has no CatBud yet.
 func (r *CatBudRepository) GetAllCatBudsByAiboID(aiboID uuid.UUID) ([]types.CatBud, error) {
-	var catBuds []types.CatBud
-	result := r.db.Where("aibo_id = ?", aiboID).Find(&catBuds)
-	if result.Error != nil {
-		return nil, result.Error
+	catBuds := []types.CatBud{}
+	err := r.db.Where("aibo_id = ? AND household_id IS NULL", aiboID).
+		Or("household_id IN (?)", r.db.Model(&types.HouseholdMember{}).Select("household_id").Where("aibo_id = ?", aiboID)).
+		Find(&catBuds).Error
+	if err != nil {
+		return nil, err
 	}
+	return catBuds, nil
+}
+
+// GetCatBudsByHouseholdID retrieves the CatBuds shared by a Household.
+//
+// An empty slice is returned when the Household has no CatBud yet.
+func (r *CatBudRepository) GetCatBudsByHouseholdID(householdID uuid.UUID) ([]types.CatBud, error) {
+	catBuds := []types.CatBud{}
+	err := r.db.Where("household_id = ?", householdID).Find(&catBuds).Error
+	return catBuds, err
+}
+
+// ApplyTemplate creates the categories of a budget template as personal CatBuds of an Aibo, with
+// their subcategories, budgets, periods and envelope rules, in a single database transaction.
+//
+// Applying a template is idempotent: a category whose name already exists under the same parent is
+// kept as is, and only its missing subcategories are created. The number of CatBuds created is
+// returned. If there is an error during creation, a gorm error is returned and nothing is created.
+func (r *CatBudRepository) ApplyTemplate(aiboID uuid.UUID, template types.BudgetTemplate) (int, error) {
+	created := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, aiboID); err != nil {
+			return err
+		}
 
-	// If no records are found, Find() will return an empty slice without an error
-	// We can check if the slice is empty and return a custom error if needed
-	if result.RowsAffected == 0 {
-		return nil, fmt.Errorf("no CatBuds found for AiboID: %v", aiboID)
+		var existing []types.CatBud
+		err := tx.Select("id", "parent_id", "category").Where("aibo_id = ? AND household_id IS NULL", aiboID).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		byParent := map[string]snowflake.ID{}
+		for _, cb := range existing {
+			byParent[templateKey(cb.ParentID, cb.Category)] = cb.ID
+		}
+
+		var apply func(categories []types.TemplateCategory, parentID *snowflake.ID) error
+		apply = func(categories []types.TemplateCategory, parentID *snowflake.ID) error {
+			for _, category := range categories {
+				id, ok := byParent[templateKey(parentID, category.Category)]
+				if !ok {
+					catBud := types.CatBud{
+						ID:           utilitaries.GenerateSnowflakeID(),
+						AiboID:       aiboID,
+						ParentID:     parentID,
+						Category:     category.Category,
+						Budget:       category.Budget,
+						Period:       category.Period,
+						RolloverRule: category.RolloverRule,
+					}
+					if catBud.Period == "" {
+						catBud.Period = types.PeriodMonthly
+					}
+					if catBud.RolloverRule == "" {
+						catBud.RolloverRule = types.EnvelopeReset
+					}
+					if err := tx.Create(&catBud).Error; err != nil {
+						return err
+					}
+					id = catBud.ID
+					created++
+				}
+				if err := apply(category.Children, &id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := apply(template.Categories, nil); err != nil {
+			return err
+		}
+
+		if created == 0 {
+			return nil
+		}
+		return RecalculateLedger(tx, aiboID)
+	})
+	if err != nil {
+		return 0, err
 	}
+	return created, nil
+}
 
-	return catBuds, nil
+// templateKey identifies a category by its parent and its case-insensitive name.
+func templateKey(parentID *snowflake.ID, category string) string {
+	parent := "root"
+	if parentID != nil {
+		parent = parentID.String()
+	}
+	return parent + "/" + strings.ToLower(category)
 }
 
 // DeleteCatBudByID deletes a CatBud entry by its ID from the database.
 //
-// The CatBud is deleted using the provided ID. If the CatBud is deleted successfully,
-// a nil error is returned. If there is an error during deletion, a gorm error is returned.
+// The Transactions and split lines booked on the CatBud are kept in the ledger but detached from it, and its
+// subcategories are moved up to its own parent. The approval and alert rules on the CatBud are
+// deleted; the pending requests and the alerts they raised are kept. The recurring rules booking on
+// the CatBud are deleted with their overrides; the occurrences already in the ledger are kept.
+// The derived amounts of the Aibo holding the CatBud, or only its household CatBuds for a shared
+// CatBud, are recalculated in the same database transaction. If the CatBud is deleted
+// successfully, a nil error is returned. If there is an error during deletion, a gorm error is
+// returned.
 func (r *CatBudRepository) DeleteCatBudByID(id snowflake.ID) error {
-	return r.db.Delete(&types.CatBud{}, "id = ?", id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var catBud types.CatBud
+		if err := tx.First(&catBud, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if _, err := lockAibo(tx, catBud.AiboID); err != nil {
+			return err
+		}
+		if err := tx.First(&catBud, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := deleteCatBud(tx, &catBud); err != nil {
+			return err
+		}
+		if catBud.HouseholdID != nil {
+			return recalculateSharedCatBuds(tx, catBud.AiboID)
+		}
+		return RecalculateLedger(tx, catBud.AiboID)
+	})
+}
+
+// deleteCatBud removes a CatBud, detaching its Transactions and split lines, moving its
+// subcategories up to its parent, deleting its envelope history, its approval and alert rules and
+// the corrections to it, deleting the recurring rules booking on it and their overrides, leaving the
+// CategoryRules booking on it, the debts repaid on it and the savings goals contributed to from it
+// without a CatBud, and leaving its attachments to be removed from the storage. The transactions
+// already generated by the recurring rules are kept in the ledger.
+func deleteCatBud(tx *gorm.DB, catBud *types.CatBud) error {
+	id := catBud.ID
+	if err := tx.Model(&types.CatBud{}).Where("parent_id = ?", id).Update("parent_id", catBud.ParentID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&types.Transaction{}).Where("cat_bud_id = ?", id).Update("cat_bud_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&types.TransactionSplit{}).Where("cat_bud_id = ?", id).Update("cat_bud_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&types.CatBudPeriodBalance{}, "cat_bud_id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&types.ApprovalRule{}, "cat_bud_id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&types.AlertRule{}, "cat_bud_id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&types.CategoryRule{}).Where("cat_bud_id = ?", id).Update("cat_bud_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&types.CategoryCorrection{}, "to_cat_bud_id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&types.CategoryCorrection{}).Where("from_cat_bud_id = ?", id).Update("from_cat_bud_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&types.Debt{}).Where("cat_bud_id = ?", id).Update("cat_bud_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&types.SavingsGoal{}).Where("cat_bud_id = ?", id).Update("cat_bud_id", nil).Error; err != nil {
+		return err
+	}
+	rules := tx.Model(&types.RecurringRule{}).Select("id").Where("cat_bud_id = ?", id)
+	if err := tx.Delete(&types.RecurringException{}, "recurring_rule_id IN (?)", rules).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&types.RecurringRule{}, "cat_bud_id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := detachAttachments(tx, "cat_bud_id", id); err != nil {
+		return err
+	}
+	return tx.Delete(&types.CatBud{}, "id = ?", id).Error
+}
+
+// GetPeriodBalances retrieves the closed periods of a CatBud, most recent first.
+//
+// An empty slice is returned when no period has been closed yet.
+func (r *CatBudRepository) GetPeriodBalances(catBudID snowflake.ID) ([]types.CatBudPeriodBalance, error) {
+	balances := []types.CatBudPeriodBalance{}
+	err := r.db.Where("cat_bud_id = ?", catBudID).Order("period_start DESC").Find(&balances).Error
+	return balances, err
+}
+
+// checkParent verifies that the parent of the CatBud, if any, is a CatBud of the same Household,
+// or a personal CatBud of the same Aibo, that is neither the CatBud itself nor one of its
+// subcategories.
+func checkParent(tx *gorm.DB, catBud *types.CatBud) error {
+	visited := map[snowflake.ID]bool{}
+	for parentID := catBud.ParentID; parentID != nil; {
+		if *parentID == catBud.ID || visited[*parentID] {
+			return fmt.Errorf("%w: a category cannot be moved under itself or one of its subcategories", ErrInvalidParent)
+		}
+		visited[*parentID] = true
+
+		var parent types.CatBud
+		err := tx.Select("id", "aibo_id", "household_id", "parent_id").First(&parent, "id = ?", *parentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && !sameScope(&parent, catBud) {
+			return fmt.Errorf("%w: parent category not found", ErrInvalidParent)
+		}
+		if err != nil {
+			return err
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// sameScope reports whether two CatBuds are shared by the same Household, or are both personal
+// CatBuds of the same Aibo.
+func sameScope(a, b *types.CatBud) bool {
+	if a.HouseholdID != nil || b.HouseholdID != nil {
+		return a.HouseholdID != nil && b.HouseholdID != nil && *a.HouseholdID == *b.HouseholdID
+	}
+	return a.AiboID == b.AiboID
 }
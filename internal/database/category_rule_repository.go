@@ -0,0 +1,429 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CategoryRuleRepository handles the auto-categorization rules and the corrections they are
+// suggested from.
+type CategoryRuleRepository struct {
+	db *gorm.DB
+}
+
+// NewCategoryRuleRepository creates a new CategoryRuleRepository instance.
+//
+// The CategoryRuleRepository instance is configured with the provided db instance.
+func NewCategoryRuleRepository(db *gorm.DB) *CategoryRuleRepository {
+	return &CategoryRuleRepository{db: db}
+}
+
+// CreateRule records a new CategoryRule.
+func (r *CategoryRuleRepository) CreateRule(rule *types.CategoryRule) error {
+	return r.db.Create(rule).Error
+}
+
+// GetRuleByID retrieves a CategoryRule by its ID.
+//
+// If the rule is not found, a gorm.NotFound error is returned.
+func (r *CategoryRuleRepository) GetRuleByID(id snowflake.ID) (*types.CategoryRule, error) {
+	var rule types.CategoryRule
+	err := r.db.First(&rule, "id = ?", id).Error
+	return &rule, err
+}
+
+// GetRulesByAiboID retrieves the CategoryRules of an Aibo in the order they are applied: highest
+// priority first, then oldest first.
+//
+// An empty slice is returned when the Aibo has no rule.
+func (r *CategoryRuleRepository) GetRulesByAiboID(aiboID uuid.UUID) ([]types.CategoryRule, error) {
+	rules := []types.CategoryRule{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("priority DESC, id").Find(&rules).Error
+	return rules, err
+}
+
+// UpdateRule saves the changes made to an existing CategoryRule.
+func (r *CategoryRuleRepository) UpdateRule(rule *types.CategoryRule) error {
+	return r.db.Save(rule).Error
+}
+
+// DeleteRule removes a CategoryRule. The transactions it booked keep their CatBud, as if they
+// had been booked by hand.
+func (r *CategoryRuleRepository) DeleteRule(rule *types.CategoryRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&types.Transaction{}).Where("category_rule_id = ?", rule.ID).Update("category_rule_id", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&types.CategoryRule{}, "id = ?", rule.ID).Error
+	})
+}
+
+// ApplyToRows applies the rules of an Aibo to the rows of a bank statement before they are
+// imported, the rows of the given ImportAccount, if any. A rule booking a row on a CatBud wins
+// over the category of the row and over the default CatBud of the import.
+func (r *CategoryRuleRepository) ApplyToRows(aiboID uuid.UUID, accountID *snowflake.ID, rows []types.ImportRow) error {
+	set, err := activeRuleSet(r.db, aiboID, nil)
+	if err != nil || set.Len() == 0 {
+		return err
+	}
+	for i := range rows {
+		row := &rows[i]
+		if row.Status == types.ImportRowInvalid {
+			continue
+		}
+		fields := types.CategoryRuleFields{CatBudID: row.CatBudID, Tags: row.Tags, Note: row.Note}
+		target := types.CategoryRuleTarget{Payee: row.Payee, Note: row.Note, Kind: row.Kind, Amount: row.Amount, ImportAccountID: accountID}
+		if ruleID := set.Apply(target, &fields, true); ruleID != nil {
+			row.CategoryRuleID = ruleID
+		}
+		row.CatBudID, row.Tags, row.Note = fields.CatBudID, fields.Tags, fields.Note
+	}
+	return nil
+}
+
+// ApplyRules applies the rules of an Aibo again to its transactions of the range [from, to], or
+// only the given rules, in a single database transaction under the lock of the Aibo. Both bounds
+// are required, so that the range is bounded by the caller.
+//
+// The rules move the transactions booked by a rule or imported, unless they were corrected by
+// hand since, and book the ones on no CatBud; the transactions booked by hand or by a recurring
+// rule keep their CatBud. Every transaction can get tags and a note. The rejected transactions are
+// left out. A transaction that moves is submitted for approval again if it needs to, and checked
+// for anomalies again, as when it is changed by hand.
+//
+// The changes are returned in the order of the days, along with the number of transactions
+// checked. With dryRun, they are only computed, outside of any database transaction and without
+// locking the Aibo.
+func (r *CategoryRuleRepository) ApplyRules(aiboID uuid.UUID, ruleIDs []snowflake.ID, from, to time.Time, dryRun bool) ([]types.CategoryRuleChange, int, error) {
+	if from.IsZero() || to.IsZero() {
+		return nil, 0, errors.New("the range of the transactions must be bounded")
+	}
+	changes := []types.CategoryRuleChange{}
+	checked := 0
+	apply := func(tx *gorm.DB) error {
+		set, err := activeRuleSet(tx, aiboID, ruleIDs)
+		if err != nil || set.Len() == 0 {
+			return err
+		}
+
+		var batches []types.ImportBatch
+		err = tx.Select("id", "import_account_id").Where("aibo_id = ? AND import_account_id IS NOT NULL", aiboID).Find(&batches).Error
+		if err != nil {
+			return err
+		}
+		accounts := make(map[snowflake.ID]*snowflake.ID, len(batches))
+		for _, batch := range batches {
+			accounts[batch.ID] = batch.ImportAccountID
+		}
+		var correctedIDs []snowflake.ID
+		if err := tx.Model(&types.CategoryCorrection{}).Where("aibo_id = ?", aiboID).Pluck("transaction_id", &correctedIDs).Error; err != nil {
+			return err
+		}
+		corrected := make(map[snowflake.ID]bool, len(correctedIDs))
+		for _, id := range correctedIDs {
+			corrected[id] = true
+		}
+
+		query := tx.Where("aibo_id = ? AND status <> ? AND date BETWEEN ? AND ?", aiboID, types.TransactionRejected, from, to)
+		var transactions []types.Transaction
+		if err := query.Preload("Splits", orderSplits).Order("date, id").Find(&transactions).Error; err != nil {
+			return err
+		}
+		checked = len(transactions)
+
+		now := time.Now()
+		for i := range transactions {
+			t := &transactions[i]
+			target := types.CategoryRuleTarget{Payee: t.Payee, Note: t.Note, Kind: t.Kind, Amount: t.Amount, Split: len(t.Splits) > 0}
+			if t.ImportBatchID != nil {
+				target.ImportAccountID = accounts[*t.ImportBatchID]
+			}
+			replace := t.RecurringRuleID == nil && (t.CategoryRuleID != nil || t.ImportBatchID != nil) && !corrected[t.ID]
+
+			before := types.CategoryRuleFields{CatBudID: t.CatBudID, Tags: t.Tags, Note: t.Note}
+			after := before
+			ruleID := set.Apply(target, &after, replace)
+			moved := !sameID(before.CatBudID, after.CatBudID)
+			if !moved && len(after.Tags) == len(before.Tags) && after.Note == before.Note {
+				continue
+			}
+			change := types.CategoryRuleChange{
+				TransactionID: t.ID,
+				Date:          t.Date,
+				Payee:         t.Payee,
+				Kind:          t.Kind,
+				Amount:        t.Amount,
+				Currency:      t.Currency,
+				Before:        before,
+				After:         after,
+			}
+			if moved {
+				change.CategoryRuleID = ruleID
+			}
+			changes = append(changes, change)
+			if dryRun {
+				continue
+			}
+
+			stored := *t
+			t.CatBudID, t.Tags, t.Note = after.CatBudID, after.Tags, after.Note
+			if moved {
+				t.CategoryRuleID = ruleID
+			}
+			review := needsNewApproval(&stored, t)
+			if review {
+				if err := cancelApprovals(tx, t.ID, now); err != nil {
+					return err
+				}
+				t.Status = types.TransactionApproved
+			}
+			if err := tx.Omit("Splits").Save(t).Error; err != nil {
+				return err
+			}
+			if review {
+				if err := requestApprovals(tx, t); err != nil {
+					return err
+				}
+			}
+			if err := recheckAnomalies(tx, t); err != nil {
+				return err
+			}
+		}
+		if dryRun || len(changes) == 0 {
+			return nil
+		}
+		return RecalculateLedger(tx, aiboID)
+	}
+
+	if dryRun {
+		return changes, checked, apply(r.db)
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, aiboID); err != nil {
+			return err
+		}
+		return apply(tx)
+	})
+	return changes, checked, err
+}
+
+// GetSuggestions suggests rules from the corrections an Aibo made by hand: a payee whose
+// transactions it moved at least MinCorrectionsForSuggestion times to the same CatBud, and left
+// there, gets a rule booking it on that CatBud, unless the rules already do. A payee moved to
+// several CatBuds gets the one it was moved to most often.
+//
+// An empty slice is returned when there is nothing to suggest.
+func (r *CategoryRuleRepository) GetSuggestions(aiboID uuid.UUID) ([]types.CategoryRuleSuggestion, error) {
+	suggestions := []types.CategoryRuleSuggestion{}
+
+	var corrections []struct {
+		types.CategoryCorrection
+		Kind   types.TransactionKind
+		Amount types.Money
+	}
+	err := r.db.Table("category_corrections").
+		Select("category_corrections.*, transactions.kind, transactions.amount").
+		Joins("JOIN transactions ON transactions.id = category_corrections.transaction_id AND transactions.cat_bud_id = category_corrections.to_cat_bud_id").
+		Where("category_corrections.aibo_id = ?", aiboID).
+		Order("category_corrections.id DESC").
+		Scan(&corrections).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		suggestion types.CategoryRuleSuggestion
+		target     types.CategoryRuleTarget
+		rules      map[snowflake.ID]int
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	seen := make(map[snowflake.ID]bool)
+	for _, correction := range corrections {
+		payee := strings.Join(strings.Fields(correction.Payee), " ")
+		if payee == "" || seen[correction.TransactionID] {
+			continue
+		}
+		seen[correction.TransactionID] = true
+
+		key := fmt.Sprintf("%s|%d", strings.ToLower(payee), correction.ToCatBudID)
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{
+				suggestion: types.CategoryRuleSuggestion{Payee: payee, CatBudID: correction.ToCatBudID},
+				target:     types.CategoryRuleTarget{Payee: payee, Kind: correction.Kind, Amount: correction.Amount},
+				rules:      make(map[snowflake.ID]int),
+			}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.suggestion.Corrections++
+		if correction.CategoryRuleID != nil {
+			g.rules[*correction.CategoryRuleID]++
+		}
+	}
+
+	// The most corrected CatBud of each payee, the most recent one on a tie.
+	best := make(map[string]*group)
+	for _, g := range groups {
+		payee := strings.ToLower(g.suggestion.Payee)
+		if g.suggestion.Corrections < types.MinCorrectionsForSuggestion {
+			continue
+		}
+		if current, ok := best[payee]; !ok || g.suggestion.Corrections > current.suggestion.Corrections {
+			best[payee] = g
+		}
+	}
+	if len(best) == 0 {
+		return suggestions, nil
+	}
+
+	rules, err := r.GetRulesByAiboID(aiboID)
+	if err != nil {
+		return nil, err
+	}
+	set, err := activeRuleSet(r.db, aiboID, nil)
+	if err != nil {
+		return nil, err
+	}
+	priorities := make(map[snowflake.ID]int, len(rules))
+	for _, rule := range rules {
+		priorities[rule.ID] = rule.Priority
+	}
+	catBudIDs := make([]snowflake.ID, 0, len(best))
+	for _, g := range best {
+		catBudIDs = append(catBudIDs, g.suggestion.CatBudID)
+	}
+	var catBuds []types.CatBud
+	if err := r.db.Select("id", "category").Where("id IN ?", catBudIDs).Find(&catBuds).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[snowflake.ID]string, len(catBuds))
+	for _, cb := range catBuds {
+		names[cb.ID] = cb.Category
+	}
+
+	for _, g := range groups {
+		if best[strings.ToLower(g.suggestion.Payee)] != g {
+			continue
+		}
+		var fields types.CategoryRuleFields
+		if set.Apply(g.target, &fields, true); sameID(fields.CatBudID, &g.suggestion.CatBudID) {
+			continue
+		}
+
+		suggestion := g.suggestion
+		suggestion.Category = names[suggestion.CatBudID]
+		priority, corrected := 0, 0
+		for id, count := range g.rules {
+			rulePriority, exists := priorities[id]
+			if !exists || count < corrected || count == corrected && id > *suggestion.ConflictingRuleID {
+				continue
+			}
+			ruleID := id
+			suggestion.ConflictingRuleID, corrected, priority = &ruleID, count, rulePriority+1
+		}
+		catBudID := suggestion.CatBudID
+		suggestion.Rule = types.CreateCategoryRuleRequest{
+			Name:          truncateRuneString(fmt.Sprintf("%s to %s", suggestion.Payee, suggestion.Category), 100),
+			Priority:      priority,
+			PayeeContains: truncateRuneString(suggestion.Payee, 255),
+			CatBudID:      &catBudID,
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Corrections > suggestions[j].Corrections
+	})
+	return suggestions, nil
+}
+
+// activeRuleSet compiles the enabled rules of an Aibo, or only the given ones, leaving out the
+// rules booking on a CatBud the Aibo may no longer book on, such as the CatBud of a household it
+// left.
+func activeRuleSet(tx *gorm.DB, aiboID uuid.UUID, ruleIDs []snowflake.ID) (*types.CategoryRuleSet, error) {
+	query := tx.Where("aibo_id = ? AND enabled = ?", aiboID, true).
+		Where(`cat_bud_id IS NULL OR cat_bud_id IN (SELECT id FROM cat_buds WHERE (aibo_id = ? AND household_id IS NULL)
+			OR household_id IN (SELECT household_id FROM household_members WHERE aibo_id = ? AND role IN ?))`,
+			aiboID, aiboID, []types.HouseholdRole{types.RoleEditor, types.RoleOwner})
+	if len(ruleIDs) > 0 {
+		query = query.Where("id IN ?", ruleIDs)
+	}
+	var rules []types.CategoryRule
+	if err := query.Order("priority DESC, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return types.NewCategoryRuleSet(rules), nil
+}
+
+// applyCategoryRules applies the rules of the Aibo to a new Transaction, recorded by hand or
+// generated by a recurring rule: they book it
+// on a CatBud only when it is booked on none and not split, set its note only when it has none,
+// and add their tags.
+func applyCategoryRules(tx *gorm.DB, t *types.Transaction) error {
+	set, err := activeRuleSet(tx, t.AiboID, nil)
+	if err != nil || set.Len() == 0 {
+		return err
+	}
+	fields := types.CategoryRuleFields{CatBudID: t.CatBudID, Tags: t.Tags, Note: t.Note}
+	target := types.CategoryRuleTarget{Payee: t.Payee, Note: t.Note, Kind: t.Kind, Amount: t.Amount, Split: len(t.Splits) > 0}
+	if ruleID := set.Apply(target, &fields, false); ruleID != nil {
+		t.CategoryRuleID = ruleID
+	}
+	t.CatBudID, t.Tags, t.Note = fields.CatBudID, fields.Tags, fields.Note
+	return nil
+}
+
+// recordCorrection records that the Aibo moved a Transaction to another CatBud by hand, given the
+// Transaction as stored. A Transaction moved by hand is no longer booked by a rule.
+func recordCorrection(tx *gorm.DB, stored, t *types.Transaction) error {
+	if sameID(stored.CatBudID, t.CatBudID) {
+		return nil
+	}
+	t.CategoryRuleID = nil
+	if t.CatBudID == nil || len(t.Splits) > 0 {
+		return nil
+	}
+	return tx.Create(&types.CategoryCorrection{
+		ID:             utilitaries.GenerateSnowflakeID(),
+		AiboID:         t.AiboID,
+		TransactionID:  t.ID,
+		Payee:          truncateRuneString(t.Payee, 255),
+		FromCatBudID:   stored.CatBudID,
+		ToCatBudID:     *t.CatBudID,
+		CategoryRuleID: stored.CategoryRuleID,
+	}).Error
+}
+
+// deleteCorrections removes the corrections of a Transaction that leaves the ledger.
+func deleteCorrections(tx *gorm.DB, transactionID snowflake.ID) error {
+	return tx.Delete(&types.CategoryCorrection{}, "transaction_id = ?", transactionID).Error
+}
+
+// sameID reports whether two optional IDs are both null or equal.
+func sameID(a, b *snowflake.ID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// truncateRuneString cuts a string to at most n characters.
+func truncateRuneString(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DailyBudgetRepository struct {
+	db *gorm.DB
+}
+
+// NewDailyBudgetRepository creates a new DailyBudgetRepository instance.
+//
+// The DailyBudgetRepository instance is configured with the provided db instance.
+func NewDailyBudgetRepository(db *gorm.DB) *DailyBudgetRepository {
+	return &DailyBudgetRepository{db: db}
+}
+
+// GetDueAiboIDs returns the IDs of the Aibos whose open budget day is over at the given instant.
+//
+// Local dates are computed in Go for each distinct timezone, so the query does not depend on
+// the MySQL timezone tables being loaded. Aibos without an open budget day are also returned
+// so that the rollover can initialize them.
+func (r *DailyBudgetRepository) GetDueAiboIDs(now time.Time) ([]uuid.UUID, error) {
+	var timezones []string
+	if err := r.db.Model(&types.Aibo{}).Distinct().Pluck("timezone", &timezones).Error; err != nil {
+		return nil, err
+	}
+
+	ids := []uuid.UUID{}
+	for _, timezone := range timezones {
+		today := utilitaries.LocalDate(now, utilitaries.LoadLocation(timezone))
+
+		var due []uuid.UUID
+		err := r.db.Model(&types.Aibo{}).
+			Where("timezone = ? AND (budget_day IS NULL OR budget_day < ?)", timezone, today).
+			Pluck("id", &due).Error
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, due...)
+	}
+
+	return ids, nil
+}
+
+// CloseDueDays closes every budget day of the Aibo that is over at the given instant.
+//
+// For each closed day, the day's surplus or deficit is carried according to the Aibo's rollover
+// policy and a DailyBudgetHistory row is recorded. The Aibo row is locked for the whole operation
+// and the open budget day is re-read under that lock, so running it twice, or concurrently from
+// several replicas, closes each day exactly once. It returns the number of days closed.
+func (r *DailyBudgetRepository) CloseDueDays(aiboID uuid.UUID, now time.Time) (int, error) {
+	closed := 0
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, aiboID)
+		if err != nil {
+			return err
+		}
+
+		today := utilitaries.LocalDate(now, utilitaries.LoadLocation(aibo.Timezone))
+		if aibo.BudgetDay == nil {
+			// First rollover for this Aibo: only open the current day.
+			if err := tx.Model(aibo).Update("budget_day", today).Error; err != nil {
+				return err
+			}
+			return RecalculateLedger(tx, aiboID)
+		}
+
+		carried := aibo.CarriedDelta
+		day := *aibo.BudgetDay
+		for day.Before(today) {
+			var spent types.Money
+			err := tx.Model(&types.Transaction{}).
+				Select("COALESCE(SUM("+signedAmountSQL+"), 0)").
+				Where("aibo_id = ? AND date = ?", aiboID, day).
+				Where(approvedSQL).
+				Scan(&spent).Error
+			if err != nil {
+				return err
+			}
+
+			dayDelta := aibo.DailyBudget - spent
+			after := aibo.RolloverPolicy.Carry(carried, dayDelta)
+
+			history := types.DailyBudgetHistory{
+				ID:            utilitaries.GenerateSnowflakeID(),
+				AiboID:        aiboID,
+				Day:           day,
+				DailyBudget:   aibo.DailyBudget,
+				Spent:         spent,
+				DayDelta:      dayDelta,
+				CarriedBefore: carried,
+				CarriedAfter:  after,
+				Policy:        aibo.RolloverPolicy,
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&history).Error; err != nil {
+				return err
+			}
+
+			carried = after
+			day = day.AddDate(0, 0, 1)
+			closed++
+		}
+
+		if closed == 0 {
+			return nil
+		}
+
+		err = tx.Model(aibo).Updates(map[string]interface{}{
+			"carried_delta": carried,
+			"budget_day":    day,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return RecalculateLedger(tx, aiboID)
+	})
+
+	return closed, err
+}
+
+// OpenBudgetDay sets the open budget day of a freshly created Aibo to its current local day.
+func (r *DailyBudgetRepository) OpenBudgetDay(aibo *types.Aibo, now time.Time) error {
+	today := utilitaries.LocalDate(now, utilitaries.LoadLocation(aibo.Timezone))
+	aibo.BudgetDay = &today
+	return r.db.Model(aibo).Update("budget_day", today).Error
+}
+
+// GetHistoryByAiboID returns the closed days of an Aibo, most recent first.
+//
+// Zero from and to values mean "no restriction". An empty slice is returned when nothing matches.
+func (r *DailyBudgetRepository) GetHistoryByAiboID(aiboID uuid.UUID, from, to time.Time) ([]types.DailyBudgetHistory, error) {
+	query := r.db.Where("aibo_id = ?", aiboID)
+	if !from.IsZero() {
+		query = query.Where("day >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("day <= ?", to)
+	}
+
+	days := []types.DailyBudgetHistory{}
+	err := query.Order("day DESC").Find(&days).Error
+	return days, err
+}
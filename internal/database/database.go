@@ -39,6 +39,14 @@ type service struct {
 	db *gorm.DB
 }
 
+// legacyMoneyColumns are the columns that held amounts as floating-point numbers before the
+// Money type was introduced.
+var legacyMoneyColumns = []struct{ table, column string }{
+	{"aibos", "daily_budget"},
+	{"aibos", "current_delta"},
+	{"aibos", "carried_delta"},
+}
+
 var (
 	dbname     = os.Getenv("DB_DATABASE")
 	password   = os.Getenv("DB_PASSWORD")
@@ -187,8 +195,54 @@ func (s *service) Close() error {
 // Migrate runs the database migrations. It is called automatically during the startup of the server.
 // If there is an error migrating the database, it returns a non-nil error.
 func (s *service) Migrate() error {
-	// Auto-migrate the Aibo and CatBud models
-	err := s.db.AutoMigrate(&types.Aibo{}, &types.CatBud{})
+	// Convert the amounts stored as floats before the auto-migration redefines their columns
+	if err := migrateMoneyColumns(s.db); err != nil {
+		return err
+	}
+
+	// Auto-migrate the models
+	err := s.db.AutoMigrate(
+		&types.Aibo{},
+		&types.CatBud{},
+		&types.Transaction{},
+		&types.TransactionSplit{},
+		&types.DailyBudgetHistory{},
+		&types.CatBudPeriodBalance{},
+		&types.RecurringRule{},
+		&types.RecurringException{},
+		&types.SavingsGoal{},
+		&types.SavingsContribution{},
+		&types.Debt{},
+		&types.DebtPayment{},
+		&types.ExchangeRate{},
+		&types.ExchangeRateRefresh{},
+		&types.Household{},
+		&types.HouseholdMember{},
+		&types.HouseholdInvitation{},
+		&types.ApprovalRule{},
+		&types.ApprovalRequest{},
+		&types.ApprovalDecision{},
+		&types.AlertRule{},
+		&types.Alert{},
+		&types.Notification{},
+		&types.NotificationDelivery{},
+		&types.NotificationSettings{},
+		&types.PushSubscription{},
+		&types.Anomaly{},
+		&types.AnomalySettings{},
+		&types.ImportMapping{},
+		&types.ImportBatch{},
+		&types.ImportAccount{},
+		&types.CategoryRule{},
+		&types.CategoryCorrection{},
+		&types.Attachment{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Transactions recorded before multi-currency support are in the base currency
+	err = s.db.Exec("UPDATE transactions SET base_amount = amount WHERE base_amount IS NULL").Error
 	if err != nil {
 		return err
 	}
@@ -213,3 +267,66 @@ func (s *service) Migrate() error {
 
 	return nil
 }
+
+// migrateMoneyColumns converts the legacy floating-point amount columns to DECIMAL(10,2).
+//
+// Each value is copied into a new decimal column, rounded to the cent half away from zero after
+// an exact DECIMAL(30,10) cast, so the binary representation of the float cannot change the
+// rounding. The old column is then replaced by the new one. Converted columns are skipped and
+// an interrupted conversion is resumed, so the migration can run on every startup.
+func migrateMoneyColumns(db *gorm.DB) error {
+	migrator := db.Migrator()
+
+	for _, c := range legacyMoneyColumns {
+		if !migrator.HasTable(c.table) {
+			continue
+		}
+		converted := c.column + "_money"
+
+		if migrator.HasColumn(c.table, c.column) {
+			columnTypes, err := migrator.ColumnTypes(c.table)
+			if err != nil {
+				return err
+			}
+
+			legacy := false
+			for _, columnType := range columnTypes {
+				if columnType.Name() == c.column {
+					switch strings.ToUpper(columnType.DatabaseTypeName()) {
+					case "DOUBLE", "FLOAT", "REAL":
+						legacy = true
+					}
+				}
+			}
+			if !legacy {
+				continue
+			}
+
+			slog.Info("Converting amounts to decimals", "table", c.table, "column", c.column)
+			if migrator.HasColumn(c.table, converted) {
+				// Leftover of an interrupted conversion, the legacy column is still the reference
+				if err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", c.table, converted)).Error; err != nil {
+					return err
+				}
+			}
+			statements := []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s DECIMAL(10,2) NOT NULL DEFAULT 0", c.table, converted),
+				fmt.Sprintf("UPDATE %s SET %s = ROUND(CAST(%s AS DECIMAL(30,10)), 2)", c.table, converted, c.column),
+				fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", c.table, c.column),
+			}
+			for _, statement := range statements {
+				if err := db.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if migrator.HasColumn(c.table, converted) {
+			if err := migrator.RenameColumn(c.table, converted, c.column); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPaymentExceedsBalance is returned when a payment is larger than the balance of its debt.
+var ErrPaymentExceedsBalance = errors.New("the payment is larger than the balance of the debt")
+
+// ErrDebtPaymentTransaction is returned when a change to the ledger transaction of a debt payment
+// would make it disagree with the payment.
+var ErrDebtPaymentTransaction = errors.New("the transaction records a debt payment: delete the payment to change its kind, amount, currency or day")
+
+// DebtRepository handles the debts an Aibo pays down and their payments.
+type DebtRepository struct {
+	db *gorm.DB
+}
+
+// NewDebtRepository creates a new DebtRepository instance.
+//
+// The DebtRepository instance is configured with the provided db instance.
+func NewDebtRepository(db *gorm.DB) *DebtRepository {
+	return &DebtRepository{db: db}
+}
+
+// CreateDebt creates a new Debt in the database. A debt created without a balance is paid off.
+func (r *DebtRepository) CreateDebt(debt *types.Debt) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(debt).Error; err != nil {
+			return err
+		}
+		if err := refreshDebt(tx, debt.ID); err != nil {
+			return err
+		}
+		return tx.First(debt, "id = ?", debt.ID).Error
+	})
+}
+
+// GetDebtByID retrieves a Debt by its ID.
+//
+// If the debt is not found, a gorm.NotFound error is returned.
+func (r *DebtRepository) GetDebtByID(id snowflake.ID) (*types.Debt, error) {
+	var debt types.Debt
+	err := r.db.First(&debt, "id = ?", id).Error
+	return &debt, err
+}
+
+// GetDebtsByAiboID retrieves the Debts of an Aibo.
+//
+// An empty slice is returned when the Aibo has no debt.
+func (r *DebtRepository) GetDebtsByAiboID(aiboID uuid.UUID) ([]types.Debt, error) {
+	debts := []types.Debt{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("created_at, id").Find(&debts).Error
+	return debts, err
+}
+
+// UpdateDebt saves the changes made to a Debt, such as a balance taken from a statement, and
+// re-evaluates whether it is paid off.
+func (r *DebtRepository) UpdateDebt(debt *types.Debt) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("PaidOffAt").Save(debt).Error; err != nil {
+			return err
+		}
+		if err := refreshDebt(tx, debt.ID); err != nil {
+			return err
+		}
+		return tx.First(debt, "id = ?", debt.ID).Error
+	})
+}
+
+// DeleteDebt deletes a Debt and its payments.
+//
+// The ledger transactions recorded for the payments are kept, as the money was spent.
+func (r *DebtRepository) DeleteDebt(debt *types.Debt) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&types.DebtPayment{}, "debt_id = ?", debt.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&types.Debt{}, "id = ?", debt.ID).Error
+	})
+}
+
+// GetPayments retrieves the payments of a Debt, most recent first.
+func (r *DebtRepository) GetPayments(debtID snowflake.ID) ([]types.DebtPayment, error) {
+	payments := []types.DebtPayment{}
+	err := r.db.Where("debt_id = ?", debtID).Order("date DESC, id DESC").Find(&payments).Error
+	return payments, err
+}
+
+// GetPaymentByID retrieves a DebtPayment by its ID.
+//
+// If the payment is not found, a gorm.NotFound error is returned.
+func (r *DebtRepository) GetPaymentByID(id snowflake.ID) (*types.DebtPayment, error) {
+	var payment types.DebtPayment
+	err := r.db.First(&payment, "id = ?", id).Error
+	return &payment, err
+}
+
+// AddPayment records a payment on the debt and lowers its balance.
+//
+// When the debt is linked to a debt repayment CatBud, the payment is also booked on it as an
+// expense. The balance of the debt and the ledger balances are updated in the same database
+// transaction. If the payment is larger than the balance, ErrPaymentExceedsBalance is returned.
+func (r *DebtRepository) AddPayment(debt *types.Debt, payment *types.DebtPayment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, debt.AiboID)
+		if err != nil {
+			return err
+		}
+		var locked types.Debt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ?", debt.ID).Error; err != nil {
+			return err
+		}
+		if payment.Amount > locked.Balance {
+			return ErrPaymentExceedsBalance
+		}
+
+		payment.DebtID = locked.ID
+		var transaction *types.Transaction
+		if locked.CatBudID != nil {
+			catBudID := *locked.CatBudID
+			transaction = &types.Transaction{
+				ID:         utilitaries.GenerateSnowflakeID(),
+				AiboID:     locked.AiboID,
+				CatBudID:   &catBudID,
+				Kind:       types.TransactionExpense,
+				Status:     types.TransactionApproved,
+				Amount:     payment.Amount,
+				BaseAmount: payment.Amount,
+				Currency:   aibo.BaseCurrency,
+				Date:       payment.Date,
+				Payee:      locked.Name,
+				Note:       "Debt payment",
+			}
+			payment.TransactionID = &transaction.ID
+		}
+
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		if err := adjustDebtBalance(tx, locked.ID, -payment.Amount); err != nil {
+			return err
+		}
+		if transaction == nil {
+			return nil
+		}
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		return RecalculateLedger(tx, locked.AiboID)
+	})
+}
+
+// DeletePayment removes a payment from the debt, along with its ledger transaction, and gives
+// its amount back to the balance.
+func (r *DebtRepository) DeletePayment(debt *types.Debt, payment *types.DebtPayment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, debt.AiboID); err != nil {
+			return err
+		}
+		if payment.TransactionID != nil {
+			if err := cancelApprovals(tx, *payment.TransactionID, time.Now()); err != nil {
+				return err
+			}
+			if err := deleteAnomalies(tx, *payment.TransactionID); err != nil {
+				return err
+			}
+			if err := deleteSplits(tx, *payment.TransactionID); err != nil {
+				return err
+			}
+			if err := tx.Delete(&types.Transaction{}, "id = ?", *payment.TransactionID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&types.DebtPayment{}, "id = ?", payment.ID).Error; err != nil {
+			return err
+		}
+		if err := adjustDebtBalance(tx, debt.ID, payment.Amount); err != nil {
+			return err
+		}
+		if payment.TransactionID == nil {
+			return nil
+		}
+		return RecalculateLedger(tx, debt.AiboID)
+	})
+}
+
+// adjustDebtBalance adds an amount to the balance of a debt, then refreshes whether it is paid
+// off.
+func adjustDebtBalance(tx *gorm.DB, debtID snowflake.ID, amount types.Money) error {
+	err := tx.Model(&types.Debt{}).Where("id = ?", debtID).
+		Update("balance", gorm.Expr("balance + ?", amount)).Error
+	if err != nil {
+		return err
+	}
+	return refreshDebt(tx, debtID)
+}
+
+// refreshDebt marks the debt as paid off when its balance reaches zero, and as owed again when a
+// deleted payment or a new statement brings the balance back up.
+func refreshDebt(tx *gorm.DB, debtID snowflake.ID) error {
+	var debt types.Debt
+	if err := tx.First(&debt, "id = ?", debtID).Error; err != nil {
+		return err
+	}
+
+	paidOff := debt.Balance == 0
+	switch {
+	case paidOff && debt.PaidOffAt == nil:
+		return tx.Model(&debt).Update("paid_off_at", time.Now()).Error
+	case !paidOff && debt.PaidOffAt != nil:
+		return tx.Model(&debt).Update("paid_off_at", nil).Error
+	}
+	return nil
+}
+
+// paymentOfTransaction returns the debt payment recorded by the ledger transaction, or nil when
+// the transaction records none.
+func paymentOfTransaction(tx *gorm.DB, transactionID snowflake.ID) (*types.DebtPayment, error) {
+	var payment types.DebtPayment
+	err := tx.Where("transaction_id = ?", transactionID).Take(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// checkPaymentTransaction returns ErrDebtPaymentTransaction when the update of a ledger transaction
+// recording a debt payment changes what the payment is about: its kind, amount, currency or day.
+func checkPaymentTransaction(tx *gorm.DB, stored, updated *types.Transaction) error {
+	if stored.Kind == updated.Kind && stored.Amount == updated.Amount && stored.Currency == updated.Currency &&
+		stored.Date.Equal(updated.Date) {
+		return nil
+	}
+	payment, err := paymentOfTransaction(tx, stored.ID)
+	if err != nil {
+		return err
+	}
+	if payment != nil {
+		return ErrDebtPaymentTransaction
+	}
+	return nil
+}
+
+// releasePayment deletes the debt payment recorded by a ledger transaction being deleted, if any,
+// and gives its amount back to the balance of its debt.
+func releasePayment(tx *gorm.DB, transactionID snowflake.ID) error {
+	payment, err := paymentOfTransaction(tx, transactionID)
+	if err != nil || payment == nil {
+		return err
+	}
+	var debt types.Debt
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&debt, "id = ?", payment.DebtID).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&types.DebtPayment{}, "id = ?", payment.ID).Error; err != nil {
+		return err
+	}
+	return adjustDebtBalance(tx, debt.ID, payment.Amount)
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoExchangeRate is returned when an amount cannot be converted because no rate between the
+// two currencies was imported for the day or any day before it.
+var ErrNoExchangeRate = errors.New("no exchange rate available")
+
+// pivotCurrencies are the currencies tried for a cross rate when there is no direct rate
+// between two currencies, reference rates being usually published against one of them.
+var pivotCurrencies = []types.Currency{"EUR", "USD"}
+
+// importBatchSize is the number of rates inserted per statement by ImportRates.
+const importBatchSize = 500
+
+type ExchangeRateRepository struct {
+	db *gorm.DB
+}
+
+// NewExchangeRateRepository creates a new ExchangeRateRepository instance.
+//
+// The ExchangeRateRepository instance is configured with the provided db instance.
+func NewExchangeRateRepository(db *gorm.DB) *ExchangeRateRepository {
+	return &ExchangeRateRepository{db: db}
+}
+
+// ImportRates stores the given rates, replacing the rate already stored for the same pair and
+// day, and returns how many rates were imported.
+//
+// The rates are shared by every Aibo. The Aibos with transactions the new rates apply to are
+// queued for a refresh, in the same database transaction, and RefreshAibo converts their base
+// amounts again and recalculates their ledger in the background.
+func (r *ExchangeRateRepository) ImportRates(rates []types.ExchangeRate) (int, error) {
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	from := rates[0].Date
+	for _, rate := range rates {
+		if rate.Date.Before(from) {
+			from = rate.Date
+		}
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "base"}, {Name: "quote"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate"}),
+		}).CreateInBatches(rates, importBatchSize).Error
+		if err != nil {
+			return err
+		}
+
+		var aiboIDs []uuid.UUID
+		err = tx.Model(&types.Transaction{}).
+			Distinct("transactions.aibo_id").
+			Joins("JOIN aibos ON aibos.id = transactions.aibo_id").
+			Where("transactions.currency <> aibos.base_currency AND transactions.date >= ?", from).
+			Pluck("transactions.aibo_id", &aiboIDs).Error
+		if err != nil || len(aiboIDs) == 0 {
+			return err
+		}
+
+		refreshes := make([]types.ExchangeRateRefresh, len(aiboIDs))
+		for i, aiboID := range aiboIDs {
+			refreshes[i] = types.ExchangeRateRefresh{AiboID: aiboID, From: from}
+		}
+		// A refresh already queued keeps the earliest of the two days.
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "aibo_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"from_date": gorm.Expr("LEAST(from_date, VALUES(from_date))")}),
+		}).CreateInBatches(refreshes, importBatchSize).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// GetPendingRefreshes returns up to limit queued refreshes, oldest first.
+func (r *ExchangeRateRepository) GetPendingRefreshes(limit int) ([]types.ExchangeRateRefresh, error) {
+	var refreshes []types.ExchangeRateRefresh
+	err := r.db.Order("created_at, aibo_id").Limit(limit).Find(&refreshes).Error
+	return refreshes, err
+}
+
+// RefreshAibo converts again the base amounts of the transactions of the Aibo dated on or after
+// the day of its queued refresh, recalculates its ledger and removes the refresh from the queue.
+//
+// The queued refresh is locked first, so that an import queueing it again meanwhile waits for
+// this one to be done and queues a new one. It does nothing when the refresh is not queued
+// anymore.
+func (r *ExchangeRateRepository) RefreshAibo(aiboID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var refresh types.ExchangeRateRefresh
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&refresh, "aibo_id = ?", aiboID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		aibo, err := lockAibo(tx, aiboID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Delete(&refresh).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := refreshBaseAmounts(tx, aibo, refresh.From); err != nil {
+			return err
+		}
+		if err := RecalculateLedger(tx, aiboID); err != nil {
+			return err
+		}
+		return tx.Delete(&refresh).Error
+	})
+}
+
+// GetRates lists the stored rates of a currency pair between two days, most recent first.
+//
+// Zero days mean "no restriction". An empty slice is returned when nothing matches.
+func (r *ExchangeRateRepository) GetRates(base, quote types.Currency, from, to time.Time) ([]types.ExchangeRate, error) {
+	query := r.db.Where("base = ? AND quote = ?", base, quote)
+	if !from.IsZero() {
+		query = query.Where("date >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("date <= ?", to)
+	}
+
+	rates := []types.ExchangeRate{}
+	err := query.Order("date DESC").Find(&rates).Error
+	return rates, err
+}
+
+// Convert converts an amount between two currencies at the rate in effect on the given day and
+// returns the converted amount along with the rate used.
+//
+// If no rate is available, an error wrapping ErrNoExchangeRate is returned.
+func (r *ExchangeRateRepository) Convert(amount types.Money, from, to types.Currency, day time.Time) (types.Money, float64, error) {
+	rate, err := rateOn(r.db, from, to, day)
+	if err != nil {
+		return 0, 0, err
+	}
+	return amount.Mul(rate), rate, nil
+}
+
+// rateOn returns the value of one unit of from in to on the given day.
+//
+// The rate in effect on a day is the most recent rate imported for that day or before it. When
+// there is no rate between the two currencies, in either direction, a cross rate through one of
+// the pivot currencies is used.
+func rateOn(tx *gorm.DB, from, to types.Currency, day time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	rate, ok, err := directRate(tx, from, to, day)
+	if err != nil || ok {
+		return rate, err
+	}
+
+	for _, pivot := range pivotCurrencies {
+		if pivot == from || pivot == to {
+			continue
+		}
+		in, ok, err := directRate(tx, from, pivot, day)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		out, ok, err := directRate(tx, pivot, to, day)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return in * out, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w from %s to %s on %s", ErrNoExchangeRate, from, to, day.Format("2006-01-02"))
+}
+
+// rateCache looks up the rates into one currency, remembering the rate of each currency and day.
+type rateCache struct {
+	tx    *gorm.DB
+	to    types.Currency
+	rates map[rateKey]float64
+}
+
+// rateKey identifies the rate of a currency on a day.
+type rateKey struct {
+	currency types.Currency
+	day      string
+}
+
+// newRateCache creates a cache of the rates into the given currency.
+func newRateCache(tx *gorm.DB, to types.Currency) *rateCache {
+	return &rateCache{tx: tx, to: to, rates: make(map[rateKey]float64)}
+}
+
+// rate returns the value of one unit of from in the currency of the cache on the given day, as
+// rateOn does.
+func (c *rateCache) rate(from types.Currency, day time.Time) (float64, error) {
+	key := rateKey{currency: from, day: day.Format("2006-01-02")}
+	if rate, ok := c.rates[key]; ok {
+		return rate, nil
+	}
+	rate, err := rateOn(c.tx, from, c.to, day)
+	if err != nil {
+		return 0, err
+	}
+	c.rates[key] = rate
+	return rate, nil
+}
+
+// directRate looks up the rate in effect on the given day between two currencies, stored in
+// either direction. It reports false when there is none.
+func directRate(tx *gorm.DB, from, to types.Currency, day time.Time) (float64, bool, error) {
+	var rate types.ExchangeRate
+	err := tx.Where("((base = ? AND quote = ?) OR (base = ? AND quote = ?)) AND date <= ?", from, to, to, from, day).
+		Order("date DESC").
+		Take(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if rate.Base == from {
+		return rate.Rate, true, nil
+	}
+	return 1 / rate.Rate, true, nil
+}
+
+// setBaseAmount converts the amount of the transaction into the given base currency at the rate
+// of the transaction's day, and shares the result between its split lines. A transaction without
+// currency is taken as being in the base currency.
+func setBaseAmount(tx *gorm.DB, t *types.Transaction, base types.Currency) error {
+	if t.Currency == "" {
+		t.Currency = base
+	}
+
+	rate, err := rateOn(tx, t.Currency, base, t.Date)
+	if err != nil {
+		return err
+	}
+	t.BaseAmount = t.Amount.Mul(rate)
+	t.AllocateBaseAmount()
+	return nil
+}
+
+// refreshBaseAmounts recomputes the base amount of the transactions of the Aibo dated on or after
+// the given day (every transaction for a zero day), after its base currency or the rates changed.
+//
+// The caller is responsible for recalculating the ledger.
+func refreshBaseAmounts(tx *gorm.DB, aibo *types.Aibo, from time.Time) error {
+	query := tx.Model(&types.Transaction{}).Where("aibo_id = ?", aibo.ID)
+	if !from.IsZero() {
+		query = query.Where("date >= ?", from)
+	}
+	query = query.Session(&gorm.Session{})
+
+	err := query.Where("currency = ?", aibo.BaseCurrency).
+		Update("base_amount", gorm.Expr("amount")).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&types.TransactionSplit{}).
+		Where("transaction_id IN (?)", query.Select("id").Where("currency = ?", aibo.BaseCurrency)).
+		Update("base_amount", gorm.Expr("amount")).Error
+	if err != nil {
+		return err
+	}
+
+	var foreign []types.Transaction
+	if err := query.Preload("Splits").Where("currency <> ?", aibo.BaseCurrency).Find(&foreign).Error; err != nil {
+		return err
+	}
+
+	for _, t := range foreign {
+		previous := t.BaseAmount
+		if err := setBaseAmount(tx, &t, aibo.BaseCurrency); err != nil {
+			return err
+		}
+		if t.BaseAmount == previous {
+			continue
+		}
+		if err := tx.Model(&types.Transaction{}).Where("id = ?", t.ID).Update("base_amount", t.BaseAmount).Error; err != nil {
+			return err
+		}
+		for _, split := range t.Splits {
+			if err := tx.Model(&types.TransactionSplit{}).Where("id = ?", split.ID).Update("base_amount", split.BaseAmount).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExportRepository reads the rows of the exports.
+type ExportRepository struct {
+	db *gorm.DB
+}
+
+// NewExportRepository creates a new ExportRepository instance.
+//
+// The ExportRepository instance is configured with the provided db instance.
+func NewExportRepository(db *gorm.DB) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+// CountTransactions returns the number of rows of the transactions export of the scope over the
+// range [from, to].
+func (r *ExportRepository) CountTransactions(scope AnalyticsScope, from, to time.Time) (int64, error) {
+	var count int64
+	err := r.db.Raw(`SELECT COUNT(*) FROM (`+exportLinesSQL(scope)+`) AS export_lines`, exportArgs(scope, from, to)).
+		Scan(&count).Error
+	return count, err
+}
+
+// StreamTransactions calls fn with each row of the transactions export of the scope over the range
+// [from, to], in the order of the days: one row per Transaction that is not split and one per
+// line of a split Transaction, whatever their status.
+//
+// Without a Household, the rows are the Transactions of the Aibo. With one, they are the amounts
+// booked on the CatBuds shared by the Household, by any of its members.
+//
+// The rows are read from the database one at a time, so that a long history is never held in
+// memory. The iteration stops at the first error, returned by fn or by the database.
+func (r *ExportRepository) StreamTransactions(scope AnalyticsScope, from, to time.Time, fn func(line *types.ExportTransaction) error) error {
+	rows, err := r.db.Raw(`SELECT export_lines.*,
+			COALESCE(cat_buds.category, '') AS category, COALESCE(parents.category, '') AS category_group
+		FROM (`+exportLinesSQL(scope)+`) AS export_lines
+			LEFT JOIN cat_buds ON cat_buds.id = export_lines.cat_bud_id
+			LEFT JOIN cat_buds AS parents ON parents.id = cat_buds.parent_id
+		ORDER BY export_lines.date, export_lines.transaction_id, export_lines.split_id`, exportArgs(scope, from, to)).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line types.ExportTransaction
+		if err := r.db.ScanRows(rows, &line); err != nil {
+			return err
+		}
+		if err := fn(&line); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportArgs returns the named arguments of exportLinesSQL.
+func exportArgs(scope AnalyticsScope, from, to time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"aibo":      scope.AiboID,
+		"household": scope.HouseholdID,
+		"from":      from,
+		"to":        to,
+	}
+}
+
+// exportLinesSQL selects the Transactions of the scope between @from and @to that are not split,
+// and the lines of the split ones, with the amount, the note and the CatBud of the line.
+func exportLinesSQL(scope AnalyticsScope) string {
+	return `SELECT transactions.id AS transaction_id, NULL AS split_id, transactions.aibo_id, transactions.date,
+			transactions.kind, transactions.status, transactions.amount, transactions.currency,
+			transactions.base_amount, transactions.payee, transactions.note, transactions.tags, transactions.cat_bud_id,
+			transactions.recurring_rule_id, transactions.import_batch_id, COALESCE(transactions.external_id, '') AS external_id
+		FROM transactions
+		WHERE ` + scope.transactions("transactions.cat_bud_id") + `
+			AND transactions.date BETWEEN @from AND @to
+			AND NOT EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_splits.transaction_id = transactions.id)
+		UNION ALL
+		SELECT transactions.id, transaction_splits.id, transactions.aibo_id, transactions.date,
+			transactions.kind, transactions.status, transaction_splits.amount, transactions.currency,
+			transaction_splits.base_amount, transactions.payee, COALESCE(NULLIF(transaction_splits.note, ''), transactions.note),
+			transactions.tags, transaction_splits.cat_bud_id, transactions.recurring_rule_id, transactions.import_batch_id,
+			COALESCE(transactions.external_id, '')
+		FROM transaction_splits JOIN transactions ON transactions.id = transaction_splits.transaction_id
+		WHERE ` + scope.transactions("transaction_splits.cat_bud_id") + `
+			AND transactions.date BETWEEN @from AND @to`
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"gorm.io/gorm"
+)
+
+type ForecastRepository struct {
+	db *gorm.DB
+}
+
+// NewForecastRepository creates a new ForecastRepository instance.
+//
+// The ForecastRepository instance is configured with the provided db instance.
+func NewForecastRepository(db *gorm.DB) *ForecastRepository {
+	return &ForecastRepository{db: db}
+}
+
+// patternRow is the discretionary spending history of a CatBud, or of the Aibo as a whole.
+type patternRow struct {
+	CatBudID   *snowflake.ID
+	FirstDay   *time.Time
+	Total      types.Money
+	SumSquares float64
+	Spent      types.Money
+}
+
+// GetForecast projects the spending of the CatBuds of the scope to the end of their current
+// periods and, without a Household, the spending of the daily budget of the Aibo to the end of the
+// current month.
+//
+// The daily spending pattern is learned in SQL from the types.ForecastHistory window, which ends
+// the day before the open budget day, or since the CatBud or the Aibo was created, leaving out the transactions generated by recurring
+// rules: the occurrences still to come are taken from the rules instead. The amounts are converted
+// into the currency of the Household, or into the base currency of the Aibo without a Household.
+// The forecast is made on the open budget day of the Aibo.
+func (r *ForecastRepository) GetForecast(scope AnalyticsScope) (*types.ForecastReport, error) {
+	var aibo types.Aibo
+	if err := r.db.First(&aibo, "id = ?", scope.AiboID).Error; err != nil {
+		return nil, err
+	}
+	today := utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	if aibo.BudgetDay != nil {
+		today = *aibo.BudgetDay
+	}
+
+	report := types.ForecastReport{Today: today, CatBuds: []types.Forecast{}}
+	historyFrom, historyTo := types.ForecastHistory(today)
+	args := map[string]interface{}{
+		"aibo":       scope.AiboID,
+		"household":  scope.HouseholdID,
+		"history_to": historyTo,
+		"lines_from": historyFrom,
+		"lines_to":   today,
+	}
+	currency := aibo.BaseCurrency
+	if scope.HouseholdID != nil {
+		var household types.Household
+		if err := r.db.Select("id", "currency").First(&household, "id = ?", *scope.HouseholdID).Error; err != nil {
+			return nil, err
+		}
+		currency = household.Currency
+	}
+	rates := map[types.Currency]float64{currency: 1}
+
+	var catBuds []types.CatBud
+	err := r.db.Where("id IN ("+scope.catBudIDsSQL()+") AND period_start IS NOT NULL AND period_end IS NOT NULL", args).
+		Order("category, id").Find(&catBuds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(catBuds) > 0 {
+		if err := scope.convertLines(r.db, historyFrom, today); err != nil {
+			return nil, err
+		}
+		var rows []patternRow
+		err := r.db.Raw(scope.withSQL()+`spending_lines AS (`+spendingLinesSQL(scope.catBuds, scope.amount)+`),
+				daily AS (
+					SELECT spending_lines.cat_bud_id, spending_lines.date, SUM(spending_lines.expense - spending_lines.income) AS net
+					FROM spending_lines WHERE spending_lines.recurring_rule_id IS NULL AND spending_lines.date <= @history_to
+					GROUP BY spending_lines.cat_bud_id, spending_lines.date)
+			SELECT daily.cat_bud_id, MIN(daily.date) AS first_day, SUM(daily.net) AS total, SUM(daily.net * daily.net) AS sum_squares
+			FROM daily GROUP BY daily.cat_bud_id`, args).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		patterns := make(map[snowflake.ID]patternRow, len(rows))
+		for _, row := range rows {
+			if row.CatBudID != nil {
+				patterns[*row.CatBudID] = row
+			}
+		}
+
+		until := today
+		ids := make([]snowflake.ID, 0, len(catBuds))
+		for _, cb := range catBuds {
+			ids = append(ids, cb.ID)
+			if cb.PeriodEnd.After(until) {
+				until = *cb.PeriodEnd
+			}
+		}
+		var rules []types.RecurringRule
+		if err := r.db.Where("cat_bud_id IN ?", ids).Find(&rules).Error; err != nil {
+			return nil, err
+		}
+		scheduled, err := r.scheduledAmounts(rules, until, currency, today, rates)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cb := range catBuds {
+			id := cb.ID
+			forecast := types.Forecast{
+				CatBudID:    &id,
+				Category:    cb.Category,
+				PeriodStart: *cb.PeriodStart,
+				PeriodEnd:   *cb.PeriodEnd,
+				Spent:       cb.Spent,
+			}
+			if cb.Budget != nil {
+				envelope := *cb.Budget + cb.CarriedOver
+				forecast.Budget = &envelope
+			}
+			row := patterns[cb.ID]
+			forecast.Project(today, types.NewSpendingPattern(today, cb.CreatedAt, row.FirstDay, row.Total, row.SumSquares), scheduled[cb.ID])
+			report.CatBuds = append(report.CatBuds, forecast)
+		}
+	}
+
+	if scope.HouseholdID != nil || aibo.DailyBudget <= 0 {
+		return &report, nil
+	}
+
+	monthStart, monthEnd := types.PeriodMonthly.Bounds(nil, nil, today)
+	args["period_start"] = monthStart
+	var row patternRow
+	err = r.db.Raw(`WITH spending_lines AS (`+spendingLinesSQL(scope.transactions, baseAmount)+`),
+			daily AS (
+				SELECT spending_lines.date,
+					SUM(CASE WHEN spending_lines.recurring_rule_id IS NULL THEN spending_lines.expense - spending_lines.income ELSE 0 END) AS net,
+					SUM(spending_lines.expense - spending_lines.income) AS gross
+				FROM spending_lines GROUP BY spending_lines.date)
+		SELECT MIN(CASE WHEN daily.date <= @history_to THEN daily.date END) AS first_day,
+			COALESCE(SUM(CASE WHEN daily.date <= @history_to THEN daily.net END), 0) AS total,
+			COALESCE(SUM(CASE WHEN daily.date <= @history_to THEN daily.net * daily.net END), 0) AS sum_squares,
+			COALESCE(SUM(CASE WHEN daily.date >= @period_start THEN daily.gross END), 0) AS spent
+		FROM daily`, args).Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []types.RecurringRule
+	if err := r.db.Where("aibo_id = ?", aibo.ID).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	scheduled, err := r.scheduledAmounts(rules, monthEnd, aibo.BaseCurrency, today, rates)
+	if err != nil {
+		return nil, err
+	}
+	var all []types.ScheduledAmount
+	for _, amounts := range scheduled {
+		all = append(all, amounts...)
+	}
+
+	budget := aibo.DailyBudget * types.Money(types.PeriodDays(monthStart, monthEnd))
+	forecast := types.Forecast{
+		PeriodStart: monthStart,
+		PeriodEnd:   monthEnd,
+		Budget:      &budget,
+		Spent:       row.Spent,
+	}
+	forecast.Project(today, types.NewSpendingPattern(today, aibo.CreatedAt, row.FirstDay, row.Total, row.SumSquares), all)
+	report.DailyBudget = &forecast
+
+	return &report, nil
+}
+
+// scheduledAmounts returns the occurrences of the rules still to come up to the given day, by
+// CatBud, signed and converted into the given currency at the rate of today. Skipped occurrences
+// are left out. rates caches the rates already looked up.
+func (r *ForecastRepository) scheduledAmounts(rules []types.RecurringRule, until time.Time, base types.Currency, today time.Time, rates map[types.Currency]float64) (map[snowflake.ID][]types.ScheduledAmount, error) {
+	occurrences, err := upcomingOccurrences(r.db, rules, until)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled := make(map[snowflake.ID][]types.ScheduledAmount)
+	for _, occurrence := range occurrences {
+		if occurrence.Skipped {
+			continue
+		}
+		rate, ok := rates[occurrence.Currency]
+		if !ok {
+			if rate, err = rateOn(r.db, occurrence.Currency, base, today); err != nil {
+				return nil, err
+			}
+			rates[occurrence.Currency] = rate
+		}
+
+		amount := occurrence.Amount.Mul(rate)
+		if occurrence.Kind == types.TransactionIncome {
+			amount = -amount
+		}
+		scheduled[occurrence.CatBudID] = append(scheduled[occurrence.CatBudID], types.ScheduledAmount{Date: occurrence.Date, Amount: amount})
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,474 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrLastOwner is returned when a change would leave a Household without any owner.
+	ErrLastOwner = errors.New("a household must keep at least one owner")
+	// ErrAlreadyMember is returned when inviting or adding an Aibo that is already a member.
+	ErrAlreadyMember = errors.New("already a member of the household")
+	// ErrAlreadyInvited is returned when an email already has a pending invitation to the Household.
+	ErrAlreadyInvited = errors.New("an invitation is already pending for this email")
+	// ErrInvitationClosed is returned when answering an invitation that was already answered,
+	// revoked or that expired.
+	ErrInvitationClosed = errors.New("the invitation is no longer pending")
+)
+
+type HouseholdRepository struct {
+	db *gorm.DB
+}
+
+// NewHouseholdRepository creates a new HouseholdRepository instance.
+//
+// The HouseholdRepository instance is configured with the provided db instance.
+func NewHouseholdRepository(db *gorm.DB) *HouseholdRepository {
+	return &HouseholdRepository{db: db}
+}
+
+// CreateHousehold creates a Household with the given Aibo as its first owner.
+//
+// A Household without currency takes the base currency of its owner.
+func (r *HouseholdRepository) CreateHousehold(household *types.Household, ownerID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if household.Currency == "" {
+			var owner types.Aibo
+			if err := tx.Select("id", "base_currency").First(&owner, "id = ?", ownerID).Error; err != nil {
+				return err
+			}
+			household.Currency = owner.BaseCurrency
+		}
+		if err := tx.Omit("Members").Create(household).Error; err != nil {
+			return err
+		}
+		owner := types.HouseholdMember{
+			ID:          utilitaries.GenerateSnowflakeID(),
+			HouseholdID: household.ID,
+			AiboID:      ownerID,
+			Role:        types.RoleOwner,
+		}
+		if err := tx.Create(&owner).Error; err != nil {
+			return err
+		}
+		return loadMembers(tx, household)
+	})
+}
+
+// GetHouseholdByID retrieves a Household with its members.
+//
+// If the Household is not found, a gorm.NotFound error is returned.
+func (r *HouseholdRepository) GetHouseholdByID(id uuid.UUID) (*types.Household, error) {
+	var household types.Household
+	if err := r.db.First(&household, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &household, loadMembers(r.db, &household)
+}
+
+// GetHouseholdsByAiboID retrieves the Households an Aibo is a member of, with their members.
+//
+// An empty slice is returned when the Aibo is not a member of any Household.
+func (r *HouseholdRepository) GetHouseholdsByAiboID(aiboID uuid.UUID) ([]types.Household, error) {
+	households := []types.Household{}
+	err := r.db.Where("id IN (?)", r.db.Model(&types.HouseholdMember{}).Select("household_id").Where("aibo_id = ?", aiboID)).
+		Order("name").Find(&households).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range households {
+		if err := loadMembers(r.db, &households[i]); err != nil {
+			return nil, err
+		}
+	}
+	return households, nil
+}
+
+// UpdateHousehold saves the name and the currency of a Household.
+//
+// When the currency changes, the amounts of the shared CatBuds are recalculated in the new currency
+// in the same database transaction; their budgets are kept as they are. If a rate is missing, an
+// error wrapping ErrNoExchangeRate is returned and nothing is saved.
+func (r *HouseholdRepository) UpdateHousehold(household *types.Household) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHousehold(tx, household.ID); err != nil {
+			return err
+		}
+		var current types.Household
+		if err := tx.Select("id", "currency").First(&current, "id = ?", household.ID).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(household).Updates(map[string]interface{}{"name": household.Name, "currency": household.Currency}).Error
+		if err != nil || current.Currency == household.Currency {
+			return err
+		}
+
+		var holders []uuid.UUID
+		err = tx.Model(&types.CatBud{}).Distinct("aibo_id").Where("household_id = ?", household.ID).Pluck("aibo_id", &holders).Error
+		if err != nil {
+			return err
+		}
+		for _, holder := range holders {
+			if err := recalculateSharedCatBuds(tx, holder); err != nil {
+				return err
+			}
+			if err := evaluateCatBudAlerts(tx, holder); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteHousehold deletes a Household, its memberships and its invitations.
+//
+// The CatBuds of the Household become personal CatBuds of the owner deleting it; the transactions
+// booked on them by the other members stay booked on them. Its approval rules are deleted and the
+// expenses still waiting for the approval of its members are approved. The ledgers of the owner and
+// of the members whose expenses were approved are recalculated in the same database transaction.
+func (r *HouseholdRepository) DeleteHousehold(household *types.Household, ownerID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, ownerID); err != nil {
+			return err
+		}
+		err := tx.Model(&types.CatBud{}).Where("household_id = ?", household.ID).
+			Updates(map[string]interface{}{"household_id": nil, "aibo_id": ownerID}).Error
+		if err != nil {
+			return err
+		}
+		requesters, err := closeHouseholdApprovals(tx, household.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&types.ApprovalRule{}, "household_id = ?", household.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&types.HouseholdInvitation{}, "household_id = ?", household.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&types.HouseholdMember{}, "household_id = ?", household.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&types.Household{}, "id = ?", household.ID).Error; err != nil {
+			return err
+		}
+		for _, requester := range requesters {
+			if requester == ownerID {
+				continue
+			}
+			if _, err := lockAibo(tx, requester); err != nil {
+				return err
+			}
+			if err := RecalculateLedger(tx, requester); err != nil {
+				return err
+			}
+		}
+		return RecalculateLedger(tx, ownerID)
+	})
+}
+
+// GetRole returns the role of an Aibo in a Household, or an empty role when it is not a member.
+func (r *HouseholdRepository) GetRole(householdID, aiboID uuid.UUID) (types.HouseholdRole, error) {
+	var member types.HouseholdMember
+	err := r.db.Where("household_id = ? AND aibo_id = ?", householdID, aiboID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return member.Role, err
+}
+
+// UpdateMemberRole changes the role of a member of a Household.
+//
+// If the Aibo is not a member, a gorm.NotFound error is returned. If the member is the last owner
+// and loses the owner role, ErrLastOwner is returned.
+func (r *HouseholdRepository) UpdateMemberRole(householdID, aiboID uuid.UUID, role types.HouseholdRole) (*types.HouseholdMember, error) {
+	var member types.HouseholdMember
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHousehold(tx, householdID); err != nil {
+			return err
+		}
+		if err := tx.Where("household_id = ? AND aibo_id = ?", householdID, aiboID).First(&member).Error; err != nil {
+			return err
+		}
+		if member.Role == types.RoleOwner && role != types.RoleOwner {
+			if err := checkOtherOwner(tx, householdID, aiboID); err != nil {
+				return err
+			}
+		}
+		member.Role = role
+		return tx.Model(&member).Update("role", role).Error
+	})
+	return &member, err
+}
+
+// RemoveMember removes an Aibo from a Household.
+//
+// The shared CatBuds held by the Aibo are handed over to an owner of the Household, whose budget
+// days then drive their periods. If the Aibo is not a member, a gorm.NotFound error is returned.
+// If it is the last owner, ErrLastOwner is returned.
+func (r *HouseholdRepository) RemoveMember(householdID, aiboID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHousehold(tx, householdID); err != nil {
+			return err
+		}
+		var member types.HouseholdMember
+		if err := tx.Where("household_id = ? AND aibo_id = ?", householdID, aiboID).First(&member).Error; err != nil {
+			return err
+		}
+
+		var owner types.HouseholdMember
+		err := tx.Where("household_id = ? AND aibo_id <> ? AND role = ?", householdID, aiboID, types.RoleOwner).
+			Order("created_at").First(&owner).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrLastOwner
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&member).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&types.CatBud{}).Where("household_id = ? AND aibo_id = ?", householdID, aiboID).
+			Update("aibo_id", owner.AiboID).Error
+		if err != nil {
+			return err
+		}
+		return RecalculateLedger(tx, owner.AiboID)
+	})
+}
+
+// CreateInvitation records an invitation to join a Household.
+//
+// If the email belongs to a member, ErrAlreadyMember is returned. If a pending invitation was
+// already sent to it, ErrAlreadyInvited is returned.
+func (r *HouseholdRepository) CreateInvitation(invitation *types.HouseholdInvitation) error {
+	invitation.Email = strings.ToLower(strings.TrimSpace(invitation.Email))
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHousehold(tx, invitation.HouseholdID); err != nil {
+			return err
+		}
+
+		var members int64
+		err := tx.Model(&types.HouseholdMember{}).
+			Joins("JOIN aibos ON aibos.id = household_members.aibo_id").
+			Where("household_members.household_id = ? AND LOWER(aibos.email) = ?", invitation.HouseholdID, invitation.Email).
+			Count(&members).Error
+		if err != nil {
+			return err
+		}
+		if members > 0 {
+			return ErrAlreadyMember
+		}
+
+		var pending int64
+		err = tx.Model(&types.HouseholdInvitation{}).
+			Where("household_id = ? AND email = ? AND status = ? AND expires_at > ?", invitation.HouseholdID, invitation.Email, types.InvitationPending, time.Now()).
+			Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrAlreadyInvited
+		}
+
+		return tx.Create(invitation).Error
+	})
+}
+
+// GetInvitationByID retrieves an invitation with the name of its Household.
+//
+// If the invitation is not found, a gorm.NotFound error is returned.
+func (r *HouseholdRepository) GetInvitationByID(id snowflake.ID) (*types.HouseholdInvitation, error) {
+	var invitation types.HouseholdInvitation
+	if err := r.db.First(&invitation, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	invitations := []types.HouseholdInvitation{invitation}
+	if err := fillHouseholdNames(r.db, invitations); err != nil {
+		return nil, err
+	}
+	return &invitations[0], nil
+}
+
+// GetInvitationsByHouseholdID retrieves the invitations sent for a Household, most recent first.
+func (r *HouseholdRepository) GetInvitationsByHouseholdID(householdID uuid.UUID) ([]types.HouseholdInvitation, error) {
+	invitations := []types.HouseholdInvitation{}
+	err := r.db.Where("household_id = ?", householdID).Order("created_at DESC").Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, fillHouseholdNames(r.db, invitations)
+}
+
+// GetPendingInvitationsByEmail retrieves the invitations sent to an email that can still be
+// answered, most recent first.
+func (r *HouseholdRepository) GetPendingInvitationsByEmail(email string, now time.Time) ([]types.HouseholdInvitation, error) {
+	invitations := []types.HouseholdInvitation{}
+	err := r.db.Where("email = ? AND status = ? AND expires_at > ?", strings.ToLower(email), types.InvitationPending, now).
+		Order("created_at DESC").Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, fillHouseholdNames(r.db, invitations)
+}
+
+// GetUnsentInvitations retrieves at most limit open invitations that were not emailed to their
+// invitee yet, oldest first, with the name of their Household.
+func (r *HouseholdRepository) GetUnsentInvitations(limit int, now time.Time) ([]types.HouseholdInvitation, error) {
+	invitations := []types.HouseholdInvitation{}
+	err := r.db.Where("emailed_at IS NULL AND status = ? AND expires_at > ?", types.InvitationPending, now).
+		Order("id").Limit(limit).Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, fillHouseholdNames(r.db, invitations)
+}
+
+// MarkInvitationsEmailed records that the invitations were emailed to their invitee.
+func (r *HouseholdRepository) MarkInvitationsEmailed(ids []snowflake.ID, now time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&types.HouseholdInvitation{}).Where("id IN ?", ids).Update("emailed_at", now).Error
+}
+
+// AcceptInvitation makes the Aibo a member of the Household of the invitation, with the role of
+// the invitation.
+//
+// If the invitation can no longer be answered, ErrInvitationClosed is returned. If the Aibo is
+// already a member, ErrAlreadyMember is returned.
+func (r *HouseholdRepository) AcceptInvitation(invitation *types.HouseholdInvitation, aiboID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHousehold(tx, invitation.HouseholdID); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := closeInvitation(tx, invitation, types.InvitationAccepted, now); err != nil {
+			return err
+		}
+
+		var members int64
+		err := tx.Model(&types.HouseholdMember{}).Where("household_id = ? AND aibo_id = ?", invitation.HouseholdID, aiboID).Count(&members).Error
+		if err != nil {
+			return err
+		}
+		if members > 0 {
+			return ErrAlreadyMember
+		}
+
+		return tx.Create(&types.HouseholdMember{
+			ID:          utilitaries.GenerateSnowflakeID(),
+			HouseholdID: invitation.HouseholdID,
+			AiboID:      aiboID,
+			Role:        invitation.Role,
+		}).Error
+	})
+}
+
+// DeclineInvitation records that the invitee refused the invitation.
+//
+// If the invitation can no longer be answered, ErrInvitationClosed is returned.
+func (r *HouseholdRepository) DeclineInvitation(invitation *types.HouseholdInvitation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return closeInvitation(tx, invitation, types.InvitationDeclined, time.Now())
+	})
+}
+
+// RevokeInvitation withdraws a pending invitation.
+//
+// If the invitation is no longer pending, ErrInvitationClosed is returned.
+func (r *HouseholdRepository) RevokeInvitation(invitation *types.HouseholdInvitation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return closeInvitation(tx, invitation, types.InvitationRevoked, time.Now())
+	})
+}
+
+// closeInvitation moves a pending invitation to its final status, under a row lock so that an
+// invitation is answered only once.
+func closeInvitation(tx *gorm.DB, invitation *types.HouseholdInvitation, status types.InvitationStatus, now time.Time) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(invitation, "id = ?", invitation.ID).Error
+	if err != nil {
+		return err
+	}
+	open := invitation.IsOpen(now)
+	if status == types.InvitationRevoked {
+		// An expired invitation can still be revoked, to allow inviting the same email again.
+		open = invitation.Status == types.InvitationPending
+	}
+	if !open {
+		return ErrInvitationClosed
+	}
+
+	invitation.Status = status
+	invitation.RespondedAt = &now
+	return tx.Model(invitation).Updates(map[string]interface{}{"status": status, "responded_at": now}).Error
+}
+
+// lockHousehold takes a row lock on the Household for the rest of the database transaction, so
+// that membership changes are serialized.
+func lockHousehold(tx *gorm.DB, householdID uuid.UUID) error {
+	var household types.Household
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&household, "id = ?", householdID).Error
+}
+
+// checkOtherOwner returns ErrLastOwner unless the Household has an owner other than the Aibo.
+func checkOtherOwner(tx *gorm.DB, householdID, aiboID uuid.UUID) error {
+	var owners int64
+	err := tx.Model(&types.HouseholdMember{}).
+		Where("household_id = ? AND aibo_id <> ? AND role = ?", householdID, aiboID, types.RoleOwner).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// loadMembers fills the members of the Household, with their emails, oldest first.
+func loadMembers(db *gorm.DB, household *types.Household) error {
+	household.Members = []types.HouseholdMember{}
+	err := db.Model(&types.HouseholdMember{}).
+		Select("household_members.*, aibos.email AS email").
+		Joins("JOIN aibos ON aibos.id = household_members.aibo_id").
+		Where("household_members.household_id = ?", household.ID).
+		Order("household_members.created_at, household_members.id").
+		Scan(&household.Members).Error
+	return err
+}
+
+// fillHouseholdNames sets the name of the Household on each invitation.
+func fillHouseholdNames(db *gorm.DB, invitations []types.HouseholdInvitation) error {
+	if len(invitations) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(invitations))
+	for _, invitation := range invitations {
+		ids = append(ids, invitation.HouseholdID)
+	}
+
+	var households []types.Household
+	if err := db.Select("id", "name").Where("id IN ?", ids).Find(&households).Error; err != nil {
+		return err
+	}
+	names := make(map[uuid.UUID]string, len(households))
+	for _, household := range households {
+		names[household.ID] = household.Name
+	}
+	for i := range invitations {
+		invitations[i].HouseholdName = names[invitations[i].HouseholdID]
+	}
+	return nil
+}
@@ -0,0 +1,535 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ImportRepository struct {
+	db *gorm.DB
+}
+
+// NewImportRepository creates a new ImportRepository instance.
+//
+// The ImportRepository instance is configured with the provided db instance.
+func NewImportRepository(db *gorm.DB) *ImportRepository {
+	return &ImportRepository{db: db}
+}
+
+// CreateMapping records a new CSV column mapping.
+func (r *ImportRepository) CreateMapping(mapping *types.ImportMapping) error {
+	return r.db.Create(mapping).Error
+}
+
+// GetMappingByID retrieves a CSV column mapping by its ID.
+//
+// If the mapping is not found, a gorm.NotFound error is returned.
+func (r *ImportRepository) GetMappingByID(id snowflake.ID) (*types.ImportMapping, error) {
+	var mapping types.ImportMapping
+	err := r.db.First(&mapping, "id = ?", id).Error
+	return &mapping, err
+}
+
+// GetMappingByName retrieves the CSV column mapping of an Aibo with the given name.
+//
+// If the mapping is not found, a gorm.NotFound error is returned.
+func (r *ImportRepository) GetMappingByName(aiboID uuid.UUID, name string) (*types.ImportMapping, error) {
+	var mapping types.ImportMapping
+	err := r.db.First(&mapping, "aibo_id = ? AND name = ?", aiboID, name).Error
+	return &mapping, err
+}
+
+// GetMappingsByAiboID retrieves the CSV column mappings of an Aibo, by name.
+//
+// An empty slice is returned when the Aibo has no mapping.
+func (r *ImportRepository) GetMappingsByAiboID(aiboID uuid.UUID) ([]types.ImportMapping, error) {
+	mappings := []types.ImportMapping{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("name").Find(&mappings).Error
+	return mappings, err
+}
+
+// UpdateMapping saves the changes made to a CSV column mapping.
+func (r *ImportRepository) UpdateMapping(mapping *types.ImportMapping) error {
+	return r.db.Save(mapping).Error
+}
+
+// DeleteMapping removes a CSV column mapping. The batches imported with it are kept.
+func (r *ImportRepository) DeleteMapping(mapping *types.ImportMapping) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&types.ImportBatch{}).Where("mapping_id = ?", mapping.ID).Update("mapping_id", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&types.ImportMapping{}, "id = ?", mapping.ID).Error
+	})
+}
+
+// CreateAccount records a new bank account of the statements of an Aibo.
+func (r *ImportRepository) CreateAccount(account *types.ImportAccount) error {
+	return r.db.Create(account).Error
+}
+
+// GetAccountByID retrieves a bank account by its ID.
+//
+// If the account is not found, a gorm.NotFound error is returned.
+func (r *ImportRepository) GetAccountByID(id snowflake.ID) (*types.ImportAccount, error) {
+	var account types.ImportAccount
+	err := r.db.First(&account, "id = ?", id).Error
+	return &account, err
+}
+
+// GetAccountByNumber retrieves the bank account of an Aibo with the given bank and number.
+//
+// If the account is not found, a gorm.NotFound error is returned.
+func (r *ImportRepository) GetAccountByNumber(aiboID uuid.UUID, bankID, number string) (*types.ImportAccount, error) {
+	var account types.ImportAccount
+	err := r.db.First(&account, "aibo_id = ? AND bank_id = ? AND number = ?", aiboID, bankID, number).Error
+	return &account, err
+}
+
+// GetAccountsByAiboID retrieves the bank accounts an Aibo imported statements of, by number.
+//
+// An empty slice is returned when the Aibo has no account.
+func (r *ImportRepository) GetAccountsByAiboID(aiboID uuid.UUID) ([]types.ImportAccount, error) {
+	accounts := []types.ImportAccount{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("bank_id, number").Find(&accounts).Error
+	return accounts, err
+}
+
+// UpdateAccount saves the changes made to a bank account.
+func (r *ImportRepository) UpdateAccount(account *types.ImportAccount) error {
+	return r.db.Save(account).Error
+}
+
+// DeleteAccount removes a bank account. The batches and the transactions imported from its
+// statements are kept, and so are their external IDs: a statement imported again is still
+// recognized. The CategoryRules matching the account are disabled rather than left matching every
+// account.
+func (r *ImportRepository) DeleteAccount(account *types.ImportAccount) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&types.ImportBatch{}).Where("import_account_id = ?", account.ID).Update("import_account_id", nil).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&types.CategoryRule{}).Where("import_account_id = ?", account.ID).
+			Updates(map[string]interface{}{"import_account_id": nil, "enabled": false}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&types.ImportAccount{}, "id = ?", account.ID).Error
+	})
+}
+
+// GetBatchesByAiboID retrieves the files imported by an Aibo, most recent first.
+//
+// An empty slice is returned when the Aibo never imported a file.
+func (r *ImportRepository) GetBatchesByAiboID(aiboID uuid.UUID) ([]types.ImportBatch, error) {
+	batches := []types.ImportBatch{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("id DESC").Find(&batches).Error
+	return batches, err
+}
+
+// MarkDuplicates fingerprints the parsed rows of an Aibo and marks the ones already in its ledger
+// as duplicates, without recording anything. The rows without currency are in the base currency
+// of the Aibo.
+func (r *ImportRepository) MarkDuplicates(aiboID uuid.UUID, rows []types.ImportRow) error {
+	var aibo types.Aibo
+	if err := r.db.Select("base_currency").First(&aibo, "id = ?", aiboID).Error; err != nil {
+		return err
+	}
+	return markDuplicates(r.db, aiboID, aibo.BaseCurrency, rows)
+}
+
+// Import records the new rows of a parsed file as transactions of the batch, in a single database
+// transaction: either every new row is recorded, or none is.
+//
+// The duplicates are marked again under the lock of the Aibo, so that a file imported twice at
+// the same time is only recorded once. The rows are recorded like the transactions created one by
+// one: converted into the base currency, left pending when a household approval rule applies, and
+// checked for anomalies. The counts of the batch are filled from the rows. If there is no exchange
+// rate for the day of a row, the error wraps ErrNoExchangeRate.
+//
+// The bank accounts the rows are of are created, or updated when they exist, in the same database
+// transaction.
+func (r *ImportRepository) Import(batch *types.ImportBatch, rows []types.ImportRow, accounts ...*types.ImportAccount) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, batch.AiboID)
+		if err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			if err := saveAccount(tx, account); err != nil {
+				return err
+			}
+		}
+		if err := recordRows(tx, aibo, batch, rows); err != nil {
+			return err
+		}
+		if batch.Imported == 0 {
+			return nil
+		}
+		return RecalculateLedger(tx, aibo.ID)
+	})
+}
+
+// PreviewMigration resolves the categories of another budgeting app into the personal CatBuds of
+// an Aibo and marks the duplicate rows, without recording anything. The categories without CatBud
+// are marked as created.
+func (r *ImportRepository) PreviewMigration(aiboID uuid.UUID, categories []types.ImportCategory, rows []types.ImportRow) error {
+	var aibo types.Aibo
+	if err := r.db.Select("base_currency").First(&aibo, "id = ?", aiboID).Error; err != nil {
+		return err
+	}
+	if err := resolveCategories(r.db, aiboID, nil, categories); err != nil {
+		return err
+	}
+	bookOnCategories(categories, rows)
+	return markDuplicates(r.db, aiboID, aibo.BaseCurrency, rows)
+}
+
+// Migrate records the export of another budgeting app in a single database transaction: the
+// categories without CatBud are created as personal CatBuds of the Aibo, under a CatBud for their
+// group, with their monthly budget; then the rows are booked on the CatBuds of their categories and
+// recorded like with Import. The CatBuds and the transactions belong to the batch, so that the
+// whole import can be rolled back.
+func (r *ImportRepository) Migrate(batch *types.ImportBatch, categories []types.ImportCategory, rows []types.ImportRow) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, batch.AiboID)
+		if err != nil {
+			return err
+		}
+		if err := resolveCategories(tx, aibo.ID, batch, categories); err != nil {
+			return err
+		}
+		bookOnCategories(categories, rows)
+		if err := recordRows(tx, aibo, batch, rows); err != nil {
+			return err
+		}
+		if batch.Imported == 0 && batch.CatBuds == 0 {
+			return nil
+		}
+		return RecalculateLedger(tx, aibo.ID)
+	})
+}
+
+// Rollback removes what a batch imported, in a single database transaction: its transactions, and
+// the CatBuds it created that nothing else was booked on or attached to since. The batch is kept,
+// marked as rolled back. The numbers of transactions and CatBuds removed are returned.
+func (r *ImportRepository) Rollback(batch *types.ImportBatch, now time.Time) (int, int, error) {
+	transactions, catBuds := 0, 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, batch.AiboID); err != nil {
+			return err
+		}
+
+		var ids []snowflake.ID
+		if err := tx.Model(&types.Transaction{}).Where("import_batch_id = ?", batch.ID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := cancelApprovals(tx, id, now); err != nil {
+				return err
+			}
+			if err := deleteAnomalies(tx, id); err != nil {
+				return err
+			}
+			if err := deleteCorrections(tx, id); err != nil {
+				return err
+			}
+			if err := detachAttachments(tx, "transaction_id", id); err != nil {
+				return err
+			}
+			if err := deleteSplits(tx, id); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&types.Transaction{}, "import_batch_id = ?", batch.ID).Error; err != nil {
+			return err
+		}
+		transactions = len(ids)
+
+		var created []types.CatBud
+		if err := tx.Where("import_batch_id = ?", batch.ID).Find(&created).Error; err != nil {
+			return err
+		}
+		// A group can only go once its categories are gone, so the CatBuds are tried again until
+		// none can be removed.
+		for removed := true; removed; {
+			removed = false
+			for i := 0; i < len(created); i++ {
+				used, err := catBudInUse(tx, created[i].ID)
+				if err != nil {
+					return err
+				}
+				if used {
+					continue
+				}
+				if err := deleteCatBud(tx, &created[i]); err != nil {
+					return err
+				}
+				created = append(created[:i], created[i+1:]...)
+				i--
+				catBuds++
+				removed = true
+			}
+		}
+
+		batch.RolledBackAt = &now
+		if err := tx.Model(batch).Update("rolled_back_at", now).Error; err != nil {
+			return err
+		}
+		return RecalculateLedger(tx, batch.AiboID)
+	})
+	return transactions, catBuds, err
+}
+
+// GetBatchByID retrieves an imported file by its ID.
+//
+// If the batch is not found, a gorm.NotFound error is returned.
+func (r *ImportRepository) GetBatchByID(id snowflake.ID) (*types.ImportBatch, error) {
+	var batch types.ImportBatch
+	err := r.db.First(&batch, "id = ?", id).Error
+	return &batch, err
+}
+
+// saveAccount creates the bank account, or saves its changes when it exists.
+func saveAccount(tx *gorm.DB, account *types.ImportAccount) error {
+	var count int64
+	if err := tx.Model(&types.ImportAccount{}).Where("id = ?", account.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return tx.Create(account).Error
+	}
+	return tx.Save(account).Error
+}
+
+// recordRows marks the duplicate rows again under the lock of the Aibo, creates the batch with its
+// counts, and records the new rows as its transactions. The rows from another budgeting app are
+// history and are not checked for anomalies.
+func recordRows(tx *gorm.DB, aibo *types.Aibo, batch *types.ImportBatch, rows []types.ImportRow) error {
+	if err := markDuplicates(tx, aibo.ID, aibo.BaseCurrency, rows); err != nil {
+		return err
+	}
+	batch.Imported, batch.Duplicates, batch.Invalid = types.CountImportRows(rows)
+	if err := tx.Create(batch).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if row.Status != types.ImportRowNew {
+			continue
+		}
+		t := types.Transaction{
+			ID:             utilitaries.GenerateSnowflakeID(),
+			AiboID:         aibo.ID,
+			CatBudID:       row.CatBudID,
+			Kind:           row.Kind,
+			Status:         types.TransactionApproved,
+			Amount:         row.Amount,
+			Currency:       row.Currency,
+			Date:           row.Date,
+			Payee:          row.Payee,
+			Note:           row.Note,
+			Tags:           row.Tags,
+			CategoryRuleID: row.CategoryRuleID,
+			ImportBatchID:  &batch.ID,
+			ExternalID:     row.ExternalID,
+		}
+		if err := setBaseAmount(tx, &t, aibo.BaseCurrency); err != nil {
+			return err
+		}
+		if err := tx.Omit("Splits").Create(&t).Error; err != nil {
+			return err
+		}
+		if err := requestApprovals(tx, &t); err != nil {
+			return err
+		}
+		if batch.Source.IsMigration() {
+			continue
+		}
+		if err := checkAnomalies(tx, &t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveCategories finds the personal CatBud of the Aibo for each category: a top-level CatBud
+// named after the group, or after the category without group, and the subcategory named after the
+// category under it, without case. Without batch, the missing CatBuds are only marked as created.
+// With a batch, they are created with the monthly budget of the category and counted in the batch.
+func resolveCategories(tx *gorm.DB, aiboID uuid.UUID, batch *types.ImportBatch, categories []types.ImportCategory) error {
+	var existing []types.CatBud
+	err := tx.Select("id", "parent_id", "category").Where("aibo_id = ? AND household_id IS NULL", aiboID).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	byParent := make(map[string]snowflake.ID, len(existing))
+	for _, cb := range existing {
+		byParent[templateKey(cb.ParentID, cb.Category)] = cb.ID
+	}
+
+	find := func(parentID *snowflake.ID, name string, budget *types.Money) (*snowflake.ID, bool, error) {
+		if id, ok := byParent[templateKey(parentID, name)]; ok {
+			return &id, false, nil
+		}
+		if batch == nil {
+			return nil, true, nil
+		}
+		catBud := types.CatBud{
+			ID:            utilitaries.GenerateSnowflakeID(),
+			AiboID:        aiboID,
+			ParentID:      parentID,
+			Category:      name,
+			Budget:        budget,
+			Period:        types.PeriodMonthly,
+			RolloverRule:  types.EnvelopeReset,
+			ImportBatchID: &batch.ID,
+		}
+		if err := tx.Create(&catBud).Error; err != nil {
+			return nil, false, err
+		}
+		byParent[templateKey(parentID, name)] = catBud.ID
+		batch.CatBuds++
+		return &catBud.ID, true, nil
+	}
+
+	for i := range categories {
+		category := &categories[i]
+		var parentID *snowflake.ID
+		if category.Group != "" {
+			id, created, err := find(nil, category.Group, nil)
+			if err != nil {
+				return err
+			}
+			if created && id == nil {
+				category.Created = true
+				continue
+			}
+			parentID = id
+		}
+		id, created, err := find(parentID, category.Name, category.Budget)
+		if err != nil {
+			return err
+		}
+		category.CatBudID, category.Created = id, created
+	}
+	return nil
+}
+
+// bookOnCategories books each row with a category on the CatBud of the category.
+func bookOnCategories(categories []types.ImportCategory, rows []types.ImportRow) {
+	byKey := make(map[string]*snowflake.ID, len(categories))
+	for i := range categories {
+		byKey[categories[i].Key()] = categories[i].CatBudID
+	}
+	for i := range rows {
+		if rows[i].Category != "" {
+			rows[i].CatBudID = byKey[types.ImportCategoryKey(rows[i].CategoryGroup, rows[i].Category)]
+		}
+	}
+}
+
+// catBudInUse reports whether a CatBud has Transactions, split lines, subcategories, recurring
+// rules, savings goals, debts or attachments.
+func catBudInUse(tx *gorm.DB, id snowflake.ID) (bool, error) {
+	for _, model := range []interface{}{&types.Transaction{}, &types.TransactionSplit{}, &types.RecurringRule{}, &types.SavingsGoal{}, &types.Debt{}, &types.Attachment{}} {
+		var count int64
+		if err := tx.Model(model).Where("cat_bud_id = ?", id).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	var children int64
+	if err := tx.Model(&types.CatBud{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+		return false, err
+	}
+	return children > 0, nil
+}
+
+// markDuplicates gives each valid row its fingerprint and marks the rows whose fingerprint is
+// already taken by a transaction of the Aibo, and the rows whose external ID is.
+//
+// The transactions of the days of the rows are fingerprinted the same way, whether they were
+// imported or recorded by hand: the n-th row sharing a types.FingerprintKey is a duplicate when
+// the ledger already holds n such transactions. A row with the external ID of a transaction, or of
+// an earlier row, is a duplicate whatever its day or amount, since banks may correct them.
+func markDuplicates(tx *gorm.DB, aiboID uuid.UUID, base types.Currency, rows []types.ImportRow) error {
+	var externalIDs []string
+	for _, row := range rows {
+		if row.Status != types.ImportRowInvalid && row.ExternalID != "" {
+			externalIDs = append(externalIDs, row.ExternalID)
+		}
+	}
+	imported := make(map[string]bool)
+	if len(externalIDs) > 0 {
+		var known []string
+		err := tx.Model(&types.Transaction{}).Where("aibo_id = ? AND external_id IN ?", aiboID, externalIDs).
+			Pluck("external_id", &known).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range known {
+			imported[id] = true
+		}
+	}
+
+	var from, to time.Time
+	for i := range rows {
+		if rows[i].Status == types.ImportRowInvalid {
+			continue
+		}
+		rows[i].Status = types.ImportRowNew
+		if rows[i].Currency == "" {
+			rows[i].Currency = base
+		}
+		if from.IsZero() || rows[i].Date.Before(from) {
+			from = rows[i].Date
+		}
+		if rows[i].Date.After(to) {
+			to = rows[i].Date
+		}
+	}
+	if from.IsZero() {
+		return nil
+	}
+
+	var existing []types.Transaction
+	err := tx.Select("date", "kind", "amount", "currency", "payee").
+		Where("aibo_id = ? AND date BETWEEN ? AND ?", aiboID, from, to).Order("date, id").Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	taken := make(map[string]bool, len(existing))
+	occurrences := make(map[string]int)
+	for _, t := range existing {
+		key := types.FingerprintKey(t.Date, t.Kind, t.Amount, t.Currency, t.Payee)
+		occurrences[key]++
+		taken[types.Fingerprint(key, occurrences[key])] = true
+	}
+
+	occurrences = make(map[string]int)
+	for i := range rows {
+		if rows[i].Status == types.ImportRowInvalid {
+			continue
+		}
+		key := types.FingerprintKey(rows[i].Date, rows[i].Kind, rows[i].Amount, rows[i].Currency, rows[i].Payee)
+		occurrences[key]++
+		rows[i].Fingerprint = types.Fingerprint(key, occurrences[key])
+		if taken[rows[i].Fingerprint] || imported[rows[i].ExternalID] {
+			rows[i].Status = types.ImportRowDuplicate
+		}
+		if rows[i].ExternalID != "" {
+			imported[rows[i].ExternalID] = true
+		}
+	}
+	return nil
+}
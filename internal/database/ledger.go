@@ -0,0 +1,328 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// signedAmountSQL is the SQL counterpart of types.Transaction.SignedAmount.
+const signedAmountSQL = "CASE WHEN kind = 'income' THEN -base_amount ELSE base_amount END"
+
+// signedSplitAmountSQL is the signed base amount of a split line, joined with its transaction.
+const signedSplitAmountSQL = "CASE WHEN transactions.kind = 'income' THEN -transaction_splits.base_amount ELSE transaction_splits.base_amount END"
+
+// approvedSQL keeps the transactions that count in the budgets: pending and rejected ones do not.
+const approvedSQL = "transactions.status = '" + string(types.TransactionApproved) + "'"
+
+// pendingSQL keeps the transactions waiting for approval.
+const pendingSQL = "transactions.status = '" + string(types.TransactionPending) + "'"
+
+// lockAibo takes a row lock on the Aibo for the rest of the database transaction.
+//
+// Every ledger write goes through this lock so that two concurrent writes for the
+// same Aibo cannot interleave their recalculations.
+func lockAibo(tx *gorm.DB, aiboID uuid.UUID) (*types.Aibo, error) {
+	var aibo types.Aibo
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&aibo, "id = ?", aiboID).Error
+	return &aibo, err
+}
+
+// RecalculateLedger derives the current period, spent and remaining amounts of every CatBud
+// of the Aibo and the Aibo's CurrentDelta from the transactions table.
+//
+// A split transaction weighs on each CatBud of its lines for the share booked on it, and on
+// CurrentDelta for its whole amount. The transactions of every member of a Household weigh
+// on its CatBuds, so the CatBuds of the households of the Aibo are recalculated as well.
+// Only approved transactions count; the ones waiting for approval are summed apart as pending.
+// The alert rules watching the recalculated amounts are evaluated on the way.
+//
+// It must be called with the database transaction that performed the ledger write, so
+// that the derived values are committed (or rolled back) together with the write.
+// Periods are evaluated on the Aibo's open budget day, so they move forward with the
+// daily rollover. CurrentDelta is the carried delta plus the daily budget minus what
+// was spent on the open budget day.
+func RecalculateLedger(tx *gorm.DB, aiboID uuid.UUID) error {
+	if err := recalculateCatBuds(tx, aiboID); err != nil {
+		return err
+	}
+
+	err := tx.Exec(`UPDATE aibos SET
+			current_delta = carried_delta + daily_budget - COALESCE((SELECT SUM(`+signedAmountSQL+`) FROM transactions WHERE transactions.aibo_id = aibos.id AND transactions.date = aibos.budget_day AND `+approvedSQL+`), 0)
+		WHERE id = ?`, aiboID).Error
+	if err != nil {
+		return err
+	}
+	if err := evaluateDailyAlerts(tx, aiboID); err != nil {
+		return err
+	}
+
+	// The shared CatBuds held by the other members follow the budget days of these members.
+	// Their amounts are derived from the ledger alone, so they are not locked: a concurrent
+	// recalculation converges to the same values.
+	var holders []uuid.UUID
+	err = tx.Model(&types.CatBud{}).Distinct("aibo_id").
+		Where("household_id IN (?) AND aibo_id <> ?",
+			tx.Model(&types.HouseholdMember{}).Select("household_id").Where("aibo_id = ?", aiboID), aiboID).
+		Pluck("aibo_id", &holders).Error
+	if err != nil {
+		return err
+	}
+	for _, holder := range holders {
+		if err := recalculateCatBuds(tx, holder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recalculateCatBuds derives the current period, spent and remaining amounts of the CatBuds
+// held by the Aibo, on its open budget day, and raises the alerts they call for.
+func recalculateCatBuds(tx *gorm.DB, aiboID uuid.UUID) error {
+	var aibo types.Aibo
+	if err := tx.First(&aibo, "id = ?", aiboID).Error; err != nil {
+		return err
+	}
+
+	today := utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	if aibo.BudgetDay != nil {
+		today = *aibo.BudgetDay
+	}
+
+	if err := refreshPeriods(tx, aiboID, today); err != nil {
+		return err
+	}
+
+	// MySQL evaluates single-table UPDATE assignments left to right, so remaining
+	// is computed from the freshly updated spent value.
+	err := tx.Exec(`UPDATE cat_buds SET
+			spent = `+periodSumSQL(approvedSQL)+`,
+			pending = `+periodSumSQL(pendingSQL)+`,
+			remaining = budget + carried_over - spent
+		WHERE aibo_id = ? AND household_id IS NULL`, aiboID).Error
+	if err != nil {
+		return err
+	}
+	if err := recalculateSharedCatBuds(tx, aiboID); err != nil {
+		return err
+	}
+	return evaluateCatBudAlerts(tx, aiboID)
+}
+
+// recalculateSharedCatBuds derives the spent, pending and remaining amounts of the CatBuds of a
+// Household held by the Aibo, in the currency of the Household.
+//
+// The members of a Household may keep their books in different base currencies, so the base
+// amounts of their transactions cannot be added in SQL: each line is converted from the currency
+// of its transaction at the rate of its day instead.
+func recalculateSharedCatBuds(tx *gorm.DB, aiboID uuid.UUID) error {
+	var catBuds []types.CatBud
+	if err := tx.Where("aibo_id = ? AND household_id IS NOT NULL", aiboID).Find(&catBuds).Error; err != nil {
+		return err
+	}
+
+	caches := make(map[uuid.UUID]*rateCache)
+	for _, cb := range catBuds {
+		var spent, pending types.Money
+		if cb.PeriodStart != nil && cb.PeriodEnd != nil {
+			rates, ok := caches[*cb.HouseholdID]
+			if !ok {
+				var err error
+				if rates, err = householdRateCache(tx, *cb.HouseholdID); err != nil {
+					return err
+				}
+				caches[*cb.HouseholdID] = rates
+			}
+
+			var err error
+			if spent, err = householdSum(tx, cb.ID, *cb.PeriodStart, *cb.PeriodEnd, approvedSQL, rates); err != nil {
+				return err
+			}
+			if pending, err = householdSum(tx, cb.ID, *cb.PeriodStart, *cb.PeriodEnd, pendingSQL, rates); err != nil {
+				return err
+			}
+		}
+
+		remaining := cb.RemainingAfter(spent)
+		if spent == cb.Spent && pending == cb.Pending && sameAmount(cb.Remaining, remaining) {
+			continue
+		}
+
+		err := tx.Model(&types.CatBud{}).Where("id = ?", cb.ID).Updates(map[string]interface{}{
+			"spent":     spent,
+			"pending":   pending,
+			"remaining": remaining,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// householdRateCache returns a cache of the rates into the currency of the Household.
+func householdRateCache(tx *gorm.DB, householdID uuid.UUID) (*rateCache, error) {
+	var household types.Household
+	if err := tx.Select("id", "currency").First(&household, "id = ?", householdID).Error; err != nil {
+		return nil, err
+	}
+	return newRateCache(tx, household.Currency), nil
+}
+
+// householdSum adds the amounts booked on a CatBud of a Household between start and end inclusive,
+// from its own transactions and from the lines of split transactions, keeping the transactions
+// matching status. Each line is converted into the currency of the Household with rates.
+func householdSum(tx *gorm.DB, catBudID snowflake.ID, start, end time.Time, status string, rates *rateCache) (types.Money, error) {
+	var direct, split []types.HouseholdLine
+	err := tx.Model(&types.Transaction{}).
+		Select("transactions.kind, transactions.amount, transactions.currency, transactions.date").
+		Where("transactions.cat_bud_id = ? AND transactions.date BETWEEN ? AND ?", catBudID, start, end).
+		Where(status).
+		Scan(&direct).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Model(&types.TransactionSplit{}).
+		Joins("JOIN transactions ON transactions.id = transaction_splits.transaction_id").
+		Select("transactions.kind, transaction_splits.amount, transactions.currency, transactions.date").
+		Where("transaction_splits.cat_bud_id = ? AND transactions.date BETWEEN ? AND ?", catBudID, start, end).
+		Where(status).
+		Scan(&split).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return types.SumHouseholdLines(append(direct, split...), rates.rate)
+}
+
+// periodSumSQL is the SQL expression summing the signed base amounts booked on a CatBud during its
+// current period, from its own transactions and from the lines of split transactions, keeping the
+// transactions matching status.
+func periodSumSQL(status string) string {
+	return `COALESCE((SELECT SUM(` + signedAmountSQL + `) FROM transactions
+				WHERE transactions.cat_bud_id = cat_buds.id AND ` + status + `
+				AND transactions.date BETWEEN cat_buds.period_start AND cat_buds.period_end), 0)
+				+ COALESCE((SELECT SUM(` + signedSplitAmountSQL + `) FROM transaction_splits
+				JOIN transactions ON transactions.id = transaction_splits.transaction_id
+				WHERE transaction_splits.cat_bud_id = cat_buds.id AND ` + status + `
+				AND transactions.date BETWEEN cat_buds.period_start AND cat_buds.period_end), 0)`
+}
+
+// refreshPeriods stores the bounds and daily allowance of the period containing day
+// on every CatBud of the Aibo whose values changed.
+//
+// When the stored period of a CatBud is over, it is closed (along with any period that
+// went by since) and the envelope rule of the CatBud decides what is carried over.
+func refreshPeriods(tx *gorm.DB, aiboID uuid.UUID, day time.Time) error {
+	var catBuds []types.CatBud
+	if err := tx.Where("aibo_id = ?", aiboID).Find(&catBuds).Error; err != nil {
+		return err
+	}
+
+	for _, cb := range catBuds {
+		carried := cb.CarriedOver
+		if cb.PeriodOver(day) {
+			var err error
+			if carried, err = closePeriods(tx, &cb, day); err != nil {
+				return err
+			}
+		}
+
+		start, end := cb.CurrentBounds(day)
+		allowance := cb.AllowanceOver(start, end)
+
+		if sameDay(cb.PeriodStart, start) && sameDay(cb.PeriodEnd, end) && sameAmount(cb.DailyAllowance, allowance) && carried == cb.CarriedOver {
+			continue
+		}
+
+		err := tx.Model(&types.CatBud{}).Where("id = ?", cb.ID).Updates(map[string]interface{}{
+			"period_start":    start,
+			"period_end":      end,
+			"daily_allowance": allowance,
+			"carried_over":    carried,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closePeriods closes the stored period of the CatBud and every following period that
+// ended before day, recording a CatBudPeriodBalance for each of them.
+//
+// It returns the amount carried into the period containing day. History rows are inserted
+// with a no-op ON DUPLICATE KEY UPDATE on the CatBud and period start, so closing an already
+// closed period has no effect.
+func closePeriods(tx *gorm.DB, cb *types.CatBud, day time.Time) (types.Money, error) {
+	carried := cb.CarriedOver
+	start, end := *cb.PeriodStart, *cb.PeriodEnd
+	for end.Before(day) {
+		spent, err := spentOnCatBud(tx, cb, start, end)
+		if err != nil {
+			return 0, err
+		}
+
+		history := cb.ClosePeriod(start, end, carried, spent)
+		history.ID = utilitaries.GenerateSnowflakeID()
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&history).Error; err != nil {
+			return 0, err
+		}
+
+		carried = history.CarriedOut
+		start, end = cb.PeriodAfter(end)
+	}
+
+	return carried, nil
+}
+
+// spentOnCatBud sums the signed base amounts booked on the CatBud between start and end
+// inclusive, from its own approved transactions and from the lines of approved split transactions.
+// The amounts booked on a CatBud of a Household are converted into the currency of the Household.
+func spentOnCatBud(tx *gorm.DB, cb *types.CatBud, start, end time.Time) (types.Money, error) {
+	if cb.HouseholdID != nil {
+		rates, err := householdRateCache(tx, *cb.HouseholdID)
+		if err != nil {
+			return 0, err
+		}
+		return householdSum(tx, cb.ID, start, end, approvedSQL, rates)
+	}
+
+	catBudID := cb.ID
+	var direct, split types.Money
+	err := tx.Model(&types.Transaction{}).
+		Select("COALESCE(SUM("+signedAmountSQL+"), 0)").
+		Where("cat_bud_id = ? AND date BETWEEN ? AND ?", catBudID, start, end).
+		Where(approvedSQL).
+		Scan(&direct).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Model(&types.TransactionSplit{}).
+		Joins("JOIN transactions ON transactions.id = transaction_splits.transaction_id").
+		Select("COALESCE(SUM("+signedSplitAmountSQL+"), 0)").
+		Where("transaction_splits.cat_bud_id = ? AND transactions.date BETWEEN ? AND ?", catBudID, start, end).
+		Where(approvedSQL).
+		Scan(&split).Error
+	return direct + split, err
+}
+
+func sameDay(a *time.Time, b time.Time) bool {
+	return a != nil && a.Equal(b)
+}
+
+func sameAmount(a, b *types.Money) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
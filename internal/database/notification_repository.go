@@ -0,0 +1,250 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+// NewNotificationRepository creates a new NotificationRepository instance.
+//
+// The NotificationRepository instance is configured with the provided db instance.
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// GetSettings returns the notification settings of an Aibo, or the default settings when it never
+// changed them.
+func (r *NotificationRepository) GetSettings(aiboID uuid.UUID) (*types.NotificationSettings, error) {
+	var settings types.NotificationSettings
+	err := r.db.First(&settings, "aibo_id = ?", aiboID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settings = types.DefaultNotificationSettings(aiboID)
+		return &settings, nil
+	}
+	return &settings, err
+}
+
+// SaveSettings stores the notification settings of an Aibo.
+func (r *NotificationRepository) SaveSettings(settings *types.NotificationSettings) error {
+	return r.db.Save(settings).Error
+}
+
+// SavePushSubscription records a browser subscription. Subscribing the same endpoint again
+// replaces its keys and moves it to the Aibo.
+func (r *NotificationRepository) SavePushSubscription(subscription *types.PushSubscription) error {
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"aibo_id", "p256dh", "auth"}),
+	}).Create(subscription).Error
+	if err != nil {
+		return err
+	}
+	// The subscription keeps its first ID when the endpoint was already known.
+	return r.db.First(subscription, "endpoint = ?", subscription.Endpoint).Error
+}
+
+// GetPushSubscriptionByID retrieves a browser subscription by its ID.
+//
+// If the subscription is not found, a gorm.NotFound error is returned.
+func (r *NotificationRepository) GetPushSubscriptionByID(id snowflake.ID) (*types.PushSubscription, error) {
+	var subscription types.PushSubscription
+	err := r.db.First(&subscription, "id = ?", id).Error
+	return &subscription, err
+}
+
+// GetPushSubscriptionsByAiboID retrieves the browser subscriptions of an Aibo, oldest first.
+//
+// An empty slice is returned when the Aibo has no subscription.
+func (r *NotificationRepository) GetPushSubscriptionsByAiboID(aiboID uuid.UUID) ([]types.PushSubscription, error) {
+	subscriptions := []types.PushSubscription{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// DeletePushSubscription removes a browser subscription. Its pending deliveries are given up.
+func (r *NotificationRepository) DeletePushSubscription(id snowflake.ID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&types.NotificationDelivery{}).
+			Where("push_subscription_id = ? AND status = ?", id, types.DeliveryPending).
+			Updates(map[string]interface{}{"status": types.DeliveryFailed, "last_error": "subscription removed"}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&types.PushSubscription{}, "id = ?", id).Error
+	})
+}
+
+// Enqueue records a Notification and queues its deliveries through the given channels, in a
+// single database transaction.
+//
+// The in-app channel is not queued: it lists the Notification in the inbox. A web_push delivery
+// is queued for each browser subscribed by the Aibo.
+func (r *NotificationRepository) Enqueue(n *types.Notification, channels []types.NotificationChannel, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		n.InApp = false
+		var deliveries []types.NotificationDelivery
+		for _, channel := range channels {
+			switch channel {
+			case types.ChannelInApp:
+				n.InApp = true
+			case types.ChannelWebPush:
+				var subscriptions []types.PushSubscription
+				if err := tx.Where("aibo_id = ?", n.AiboID).Find(&subscriptions).Error; err != nil {
+					return err
+				}
+				for _, subscription := range subscriptions {
+					deliveries = append(deliveries, newDelivery(n, channel, &subscription.ID, now))
+				}
+			default:
+				deliveries = append(deliveries, newDelivery(n, channel, nil, now))
+			}
+		}
+
+		if err := tx.Create(n).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		return tx.Omit("Notification").Create(&deliveries).Error
+	})
+}
+
+// newDelivery returns a pending delivery of the Notification through the channel, due now.
+func newDelivery(n *types.Notification, channel types.NotificationChannel, subscriptionID *snowflake.ID, now time.Time) types.NotificationDelivery {
+	return types.NotificationDelivery{
+		ID:                 utilitaries.GenerateSnowflakeID(),
+		NotificationID:     n.ID,
+		Channel:            channel,
+		PushSubscriptionID: subscriptionID,
+		Status:             types.DeliveryPending,
+		NextAttemptAt:      now,
+	}
+}
+
+// ClaimDueDeliveries returns at most limit pending deliveries whose next attempt is due, with their
+// Notification, oldest first.
+//
+// The deliveries are claimed for the lease duration by moving their next attempt forward, so that
+// the other replicas skip them while they are being sent. A delivery whose sender died before
+// recording the outcome is attempted again once the lease is over.
+func (r *NotificationRepository) ClaimDueDeliveries(now time.Time, limit int, lease time.Duration) ([]types.NotificationDelivery, error) {
+	var deliveries []types.NotificationDelivery
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", types.DeliveryPending, now).
+			Order("next_attempt_at, id").Limit(limit).Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		return tx.Model(&types.NotificationDelivery{}).Where("id IN ?", deliveryIDs(deliveries)).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+
+	err = r.db.Preload("Notification").Where("id IN ?", deliveryIDs(deliveries)).
+		Order("next_attempt_at, id").Find(&deliveries).Error
+	return deliveries, err
+}
+
+// deliveryIDs returns the IDs of the deliveries.
+func deliveryIDs(deliveries []types.NotificationDelivery) []snowflake.ID {
+	ids := make([]snowflake.ID, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	return ids
+}
+
+// MarkSent records that the channel accepted the delivery.
+func (r *NotificationRepository) MarkSent(delivery *types.NotificationDelivery, now time.Time) error {
+	delivery.RecordSent(now)
+	return r.db.Model(&types.NotificationDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":     delivery.Status,
+		"attempts":   delivery.Attempts,
+		"sent_at":    now,
+		"last_error": "",
+	}).Error
+}
+
+// MarkFailedAttempt records a failed attempt, as described by NotificationDelivery.RecordFailure.
+func (r *NotificationRepository) MarkFailedAttempt(delivery *types.NotificationDelivery, cause error, final bool, now time.Time) error {
+	delivery.RecordFailure(cause, final, now)
+	return r.db.Model(&types.NotificationDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_error":      delivery.LastError,
+	}).Error
+}
+
+// Postpone moves the next attempt of a delivery to the given time without counting an attempt,
+// such as the end of the quiet hours of its recipient.
+func (r *NotificationRepository) Postpone(delivery *types.NotificationDelivery, at time.Time) error {
+	delivery.NextAttemptAt = at
+	return r.db.Model(&types.NotificationDelivery{}).Where("id = ?", delivery.ID).Update("next_attempt_at", at).Error
+}
+
+// GetInbox retrieves the notifications listed in the in-app inbox of an Aibo, most recent first,
+// optionally only the unread ones.
+//
+// An empty slice is returned when nothing matches.
+func (r *NotificationRepository) GetInbox(aiboID uuid.UUID, unreadOnly bool) ([]types.Notification, error) {
+	query := r.db.Where("aibo_id = ? AND in_app = ?", aiboID, true)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	notifications := []types.Notification{}
+	err := query.Order("id DESC").Find(&notifications).Error
+	return notifications, err
+}
+
+// CountUnread returns the number of notifications of the in-app inbox of an Aibo it has not read.
+func (r *NotificationRepository) CountUnread(aiboID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&types.Notification{}).
+		Where("aibo_id = ? AND in_app = ? AND read_at IS NULL", aiboID, true).Count(&count).Error
+	return count, err
+}
+
+// GetNotificationByID retrieves a notification by its ID.
+//
+// If the notification is not found, a gorm.NotFound error is returned.
+func (r *NotificationRepository) GetNotificationByID(id snowflake.ID) (*types.Notification, error) {
+	var n types.Notification
+	err := r.db.First(&n, "id = ?", id).Error
+	return &n, err
+}
+
+// MarkRead marks a notification as read. Reading it twice keeps the time of the first read.
+func (r *NotificationRepository) MarkRead(n *types.Notification) error {
+	if n.ReadAt != nil {
+		return nil
+	}
+	now := time.Now()
+	n.ReadAt = &now
+	return r.db.Model(&types.Notification{}).Where("id = ? AND read_at IS NULL", n.ID).Update("read_at", now).Error
+}
+
+// MarkAllRead marks every unread notification of the inbox of an Aibo as read and returns how
+// many were.
+func (r *NotificationRepository) MarkAllRead(aiboID uuid.UUID) (int64, error) {
+	result := r.db.Model(&types.Notification{}).
+		Where("aibo_id = ? AND in_app = ? AND read_at IS NULL", aiboID, true).Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxMaterializedOccurrences is the largest number of occurrences of a rule MaterializeDue records
+// at once, so that a rule far behind is caught up over several runs of the job.
+const maxMaterializedOccurrences = 500
+
+type RecurringRepository struct {
+	db *gorm.DB
+}
+
+// NewRecurringRepository creates a new RecurringRepository instance.
+//
+// The RecurringRepository instance is configured with the provided db instance.
+func NewRecurringRepository(db *gorm.DB) *RecurringRepository {
+	return &RecurringRepository{db: db}
+}
+
+// CreateRule creates a new RecurringRule in the database.
+//
+// The first occurrence of the rule is scheduled from its start date. The occurrences are
+// materialized in the ledger by MaterializeDue.
+func (r *RecurringRepository) CreateRule(rule *types.RecurringRule) error {
+	rule.NextIndex = 0
+	rule.NextOccurrence = nextOccurrence(rule)
+	return r.db.Create(rule).Error
+}
+
+// GetRuleByID retrieves a RecurringRule by its ID.
+//
+// If the rule is not found, a gorm.NotFound error is returned.
+func (r *RecurringRepository) GetRuleByID(id snowflake.ID) (*types.RecurringRule, error) {
+	var rule types.RecurringRule
+	err := r.db.First(&rule, "id = ?", id).Error
+	return &rule, err
+}
+
+// GetRulesByAiboID retrieves the RecurringRules of an Aibo.
+//
+// An empty slice is returned when the Aibo has no rule.
+func (r *RecurringRepository) GetRulesByAiboID(aiboID uuid.UUID) ([]types.RecurringRule, error) {
+	rules := []types.RecurringRule{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("start_date, id").Find(&rules).Error
+	return rules, err
+}
+
+// GetExceptions retrieves the single occurrence overrides of a RecurringRule.
+func (r *RecurringRepository) GetExceptions(ruleID snowflake.ID) ([]types.RecurringException, error) {
+	exceptions := []types.RecurringException{}
+	err := r.db.Where("recurring_rule_id = ?", ruleID).Order("occurrence_date").Find(&exceptions).Error
+	return exceptions, err
+}
+
+// UpdateRule saves the changes made to a RecurringRule.
+//
+// The changes only apply to the occurrences that are not in the ledger yet. The next
+// occurrence is rescheduled since the count or until limits may have changed.
+func (r *RecurringRepository) UpdateRule(rule *types.RecurringRule) error {
+	rule.NextOccurrence = nextOccurrence(rule)
+	return r.db.Save(rule).Error
+}
+
+// DeleteRule deletes a RecurringRule and its overrides.
+//
+// The transactions already generated by the rule are kept in the ledger.
+func (r *RecurringRepository) DeleteRule(rule *types.RecurringRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&types.RecurringException{}, "recurring_rule_id = ?", rule.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&types.RecurringRule{}, "id = ?", rule.ID).Error
+	})
+}
+
+// GetDueRuleIDs returns the IDs of the rules that may have an occurrence due at the given instant.
+//
+// The query is based on the furthest timezone ahead of UTC, MaterializeDue then checks each rule
+// against the local day of its Aibo.
+func (r *RecurringRepository) GetDueRuleIDs(now time.Time) ([]snowflake.ID, error) {
+	latest := utilitaries.LocalDate(now, time.UTC).AddDate(0, 0, 1)
+
+	ids := []snowflake.ID{}
+	err := r.db.Model(&types.RecurringRule{}).
+		Where("next_occurrence IS NOT NULL AND next_occurrence <= ?", latest).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// MaterializeDue records in the ledger every occurrence of the rule that is due on the local
+// day of its Aibo, applying the single occurrence overrides, and returns how many transactions
+// were created. The new occurrences go through the same checks as a transaction recorded by hand:
+// the category rules apply to them, they raise the approval requests they need and they are
+// checked for anomalies, such as the same charge already recorded by hand. At most maxMaterializedOccurrences occurrences are handled per call; the next
+// ones stay due for the next call.
+//
+// The Aibo and the rule are locked for the whole operation and the generated transactions are
+// unique per rule and occurrence, so running it twice, or concurrently from several replicas,
+// never records an occurrence twice.
+func (r *RecurringRepository) MaterializeDue(ruleID snowflake.ID, now time.Time) (int, error) {
+	created := 0
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var rule types.RecurringRule
+		if err := tx.First(&rule, "id = ?", ruleID).Error; err != nil {
+			return err
+		}
+
+		aibo, err := lockAibo(tx, rule.AiboID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&rule, "id = ?", ruleID).Error; err != nil {
+			return err
+		}
+
+		today := utilitaries.LocalDate(now, utilitaries.LoadLocation(aibo.Timezone))
+		for handled := 0; rule.NextOccurrence != nil && !rule.NextOccurrence.After(today) && handled < maxMaterializedOccurrences; handled++ {
+			exception, err := findException(tx, rule.ID, *rule.NextOccurrence)
+			if err != nil {
+				return err
+			}
+
+			if exception == nil || !exception.Skip {
+				t := rule.Transaction(*rule.NextOccurrence, exception)
+				t.ID = utilitaries.GenerateSnowflakeID()
+				if err := prepareOccurrence(tx, &t, aibo.BaseCurrency); err != nil {
+					return err
+				}
+				result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&t)
+				if result.Error != nil {
+					return result.Error
+				}
+				created += int(result.RowsAffected)
+				if result.RowsAffected > 0 {
+					if err := reviewOccurrence(tx, &t); err != nil {
+						return err
+					}
+				}
+			}
+
+			rule.NextIndex++
+			rule.NextOccurrence = nextOccurrence(&rule)
+		}
+
+		err = tx.Model(&rule).Updates(map[string]interface{}{
+			"next_index":      rule.NextIndex,
+			"next_occurrence": rule.NextOccurrence,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if created == 0 {
+			return nil
+		}
+		return RecalculateLedger(tx, rule.AiboID)
+	})
+
+	return created, err
+}
+
+// SetException skips or overrides the occurrence of the rule scheduled on occurrenceDate.
+//
+// If the occurrence is already in the ledger, its transaction is updated (or deleted when the
+// occurrence is skipped) in the same database transaction, so the series stays consistent.
+// An error is returned if the rule has no occurrence on that day, or if an occurrence that is not
+// in the ledger yet is moved before the day it is scheduled on: MaterializeDue only books an
+// occurrence once its scheduled day comes.
+func (r *RecurringRepository) SetException(rule *types.RecurringRule, exception *types.RecurringException) error {
+	index, ok := rule.IndexOf(exception.OccurrenceDate)
+	if !ok {
+		return errors.New("the rule has no occurrence on this day")
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, rule.AiboID)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(rule, "id = ?", rule.ID).Error; err != nil {
+			return err
+		}
+		if !exception.Skip && exception.MovesEarlier() && index >= rule.NextIndex {
+			return errors.New("an occurrence that is not recorded yet cannot be moved before its scheduled day")
+		}
+
+		existing, err := findException(tx, rule.ID, exception.OccurrenceDate)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			exception.ID = existing.ID
+			exception.CreatedAt = existing.CreatedAt
+		} else {
+			exception.ID = utilitaries.GenerateSnowflakeID()
+		}
+		exception.RecurringRuleID = rule.ID
+		if err := tx.Save(exception).Error; err != nil {
+			return err
+		}
+
+		var current types.Transaction
+		err = tx.Where("recurring_rule_id = ? AND occurrence_date = ?", rule.ID, exception.OccurrenceDate).First(&current).Error
+		found := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		fresh := rule.Transaction(exception.OccurrenceDate, exception)
+		if !exception.Skip {
+			if err := prepareOccurrence(tx, &fresh, aibo.BaseCurrency); err != nil {
+				return err
+			}
+		}
+		if found {
+			// The occurrence is booked on the CatBud of the rule again, replacing any split, and
+			// checked again like a new occurrence.
+			if err := cancelApprovals(tx, current.ID, time.Now()); err != nil {
+				return err
+			}
+			if err := deleteAnomalies(tx, current.ID); err != nil {
+				return err
+			}
+			if err := deleteSplits(tx, current.ID); err != nil {
+				return err
+			}
+		}
+		switch {
+		case exception.Skip && found:
+			err = tx.Delete(&types.Transaction{}, "id = ?", current.ID).Error
+		case !exception.Skip && found:
+			fresh.ID = current.ID
+			fresh.CreatedAt = current.CreatedAt
+			err = tx.Save(&fresh).Error
+		case !exception.Skip && index < rule.NextIndex:
+			// The occurrence was skipped when it came due: un-skipping it records it now.
+			fresh.ID = utilitaries.GenerateSnowflakeID()
+			err = tx.Create(&fresh).Error
+		default:
+			// The occurrence is not due yet: MaterializeDue will apply the exception.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !exception.Skip {
+			if err := reviewOccurrence(tx, &fresh); err != nil {
+				return err
+			}
+		}
+
+		return RecalculateLedger(tx, rule.AiboID)
+	})
+}
+
+// GetUpcoming lists the occurrences of the Aibo's rules that are not in the ledger yet and
+// are scheduled up to the given day, in chronological order, with their overrides applied.
+func (r *RecurringRepository) GetUpcoming(aiboID uuid.UUID, until time.Time) ([]types.UpcomingOccurrence, error) {
+	rules, err := r.GetRulesByAiboID(aiboID)
+	if err != nil {
+		return nil, err
+	}
+
+	return upcomingOccurrences(r.db, rules, until)
+}
+
+// upcomingOccurrences lists the occurrences of the rules that are not in the ledger yet and are
+// scheduled up to the given day, in chronological order, with their overrides applied.
+func upcomingOccurrences(tx *gorm.DB, rules []types.RecurringRule, until time.Time) ([]types.UpcomingOccurrence, error) {
+	upcoming := []types.UpcomingOccurrence{}
+	for _, rule := range rules {
+		if rule.NextOccurrence == nil || rule.NextOccurrence.After(until) {
+			continue
+		}
+
+		var exceptions []types.RecurringException
+		if err := tx.Where("recurring_rule_id = ?", rule.ID).Find(&exceptions).Error; err != nil {
+			return nil, err
+		}
+		byDate := make(map[string]*types.RecurringException, len(exceptions))
+		for i := range exceptions {
+			byDate[exceptions[i].OccurrenceDate.Format("2006-01-02")] = &exceptions[i]
+		}
+
+		for n := rule.NextIndex; ; n++ {
+			day, ok := rule.Occurrence(n)
+			if !ok || day.After(until) {
+				break
+			}
+
+			exception := byDate[day.Format("2006-01-02")]
+			t := rule.Transaction(day, exception)
+			upcoming = append(upcoming, types.UpcomingOccurrence{
+				RecurringRuleID: rule.ID,
+				CatBudID:        rule.CatBudID,
+				OccurrenceDate:  day,
+				Date:            t.Date,
+				Kind:            t.Kind,
+				Amount:          t.Amount,
+				Currency:        t.Currency,
+				Payee:           t.Payee,
+				Skipped:         exception != nil && exception.Skip,
+			})
+		}
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].Date.Before(upcoming[j].Date)
+	})
+
+	return upcoming, nil
+}
+
+// nextOccurrence returns the day of the next occurrence to materialize, or nil once the series is over.
+func nextOccurrence(rule *types.RecurringRule) *time.Time {
+	day, ok := rule.Occurrence(rule.NextIndex)
+	if !ok {
+		return nil
+	}
+	return &day
+}
+
+// prepareOccurrence readies an occurrence generated by a rule to be stored, like CreateTransaction
+// does for a transaction recorded by hand: the category rules of the Aibo apply to it and its
+// amount is converted into the base currency.
+func prepareOccurrence(tx *gorm.DB, t *types.Transaction, baseCurrency types.Currency) error {
+	if err := applyCategoryRules(tx, t); err != nil {
+		return err
+	}
+	return setBaseAmount(tx, t, baseCurrency)
+}
+
+// reviewOccurrence raises the approval requests a stored occurrence needs and checks it for
+// anomalies, like CreateTransaction does for a transaction recorded by hand.
+func reviewOccurrence(tx *gorm.DB, t *types.Transaction) error {
+	if err := requestApprovals(tx, t); err != nil {
+		return err
+	}
+	return checkAnomalies(tx, t)
+}
+
+// findException returns the override of the occurrence scheduled on day, or nil if there is none.
+func findException(tx *gorm.DB, ruleID snowflake.ID, day time.Time) (*types.RecurringException, error) {
+	var exception types.RecurringException
+	err := tx.Where("recurring_rule_id = ? AND occurrence_date = ?", ruleID, day).First(&exception).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &exception, nil
+}
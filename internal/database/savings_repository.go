@@ -0,0 +1,329 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// paceWindowDays is how far back manual contributions are averaged to compute the monthly pace.
+const paceWindowDays = 90
+
+type SavingsRepository struct {
+	db *gorm.DB
+}
+
+// NewSavingsRepository creates a new SavingsRepository instance.
+//
+// The SavingsRepository instance is configured with the provided db instance.
+func NewSavingsRepository(db *gorm.DB) *SavingsRepository {
+	return &SavingsRepository{db: db}
+}
+
+// CreateGoal creates a new SavingsGoal in the database.
+//
+// The first automatic contribution, if any, is scheduled from the automatic start date.
+func (r *SavingsRepository) CreateGoal(goal *types.SavingsGoal) error {
+	goal.AutoNextIndex = 0
+	goal.NextAutoDate = goal.AutoContributionDate(0)
+	return r.db.Create(goal).Error
+}
+
+// GetGoalByID retrieves a SavingsGoal by its ID.
+//
+// If the goal is not found, a gorm.NotFound error is returned.
+func (r *SavingsRepository) GetGoalByID(id snowflake.ID) (*types.SavingsGoal, error) {
+	var goal types.SavingsGoal
+	err := r.db.First(&goal, "id = ?", id).Error
+	return &goal, err
+}
+
+// GetGoalsByAiboID retrieves the SavingsGoals of an Aibo.
+//
+// An empty slice is returned when the Aibo has no goal.
+func (r *SavingsRepository) GetGoalsByAiboID(aiboID uuid.UUID) ([]types.SavingsGoal, error) {
+	goals := []types.SavingsGoal{}
+	err := r.db.Where("aibo_id = ?", aiboID).Order("created_at, id").Find(&goals).Error
+	return goals, err
+}
+
+// UpdateGoal saves the changes made to a SavingsGoal.
+//
+// The saved amount is never overwritten from the instance, and the completion of the goal is
+// re-evaluated since its target may have changed.
+func (r *SavingsRepository) UpdateGoal(goal *types.SavingsGoal) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		goal.NextAutoDate = goal.AutoContributionDate(goal.AutoNextIndex)
+		if err := tx.Omit("SavedAmount", "CompletedAt").Save(goal).Error; err != nil {
+			return err
+		}
+		if err := refreshGoal(tx, goal.ID); err != nil {
+			return err
+		}
+		return tx.First(goal, "id = ?", goal.ID).Error
+	})
+}
+
+// DeleteGoal deletes a SavingsGoal and its contributions.
+//
+// The ledger transactions recorded for the contributions are kept, as the money was spent.
+func (r *SavingsRepository) DeleteGoal(goal *types.SavingsGoal) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&types.SavingsContribution{}, "savings_goal_id = ?", goal.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&types.SavingsGoal{}, "id = ?", goal.ID).Error
+	})
+}
+
+// GetContributions retrieves the contributions of a SavingsGoal, most recent first.
+func (r *SavingsRepository) GetContributions(goalID snowflake.ID) ([]types.SavingsContribution, error) {
+	contributions := []types.SavingsContribution{}
+	err := r.db.Where("savings_goal_id = ?", goalID).Order("date DESC, id DESC").Find(&contributions).Error
+	return contributions, err
+}
+
+// GetContributionByID retrieves a SavingsContribution by its ID.
+//
+// If the contribution is not found, a gorm.NotFound error is returned.
+func (r *SavingsRepository) GetContributionByID(id snowflake.ID) (*types.SavingsContribution, error) {
+	var contribution types.SavingsContribution
+	err := r.db.First(&contribution, "id = ?", id).Error
+	return &contribution, err
+}
+
+// AddContribution records a contribution to the goal.
+//
+// When the goal is linked to a CatBud, the contribution is also booked on it as an expense (or as
+// an income for a withdrawal). The saved amount of the goal and the ledger balances are updated in
+// the same database transaction.
+func (r *SavingsRepository) AddContribution(goal *types.SavingsGoal, contribution *types.SavingsContribution) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		_, err := addContribution(tx, goal, contribution)
+		return err
+	})
+}
+
+// DeleteContribution removes a contribution from the goal, along with its ledger transaction.
+func (r *SavingsRepository) DeleteContribution(goal *types.SavingsGoal, contribution *types.SavingsContribution) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, goal.AiboID); err != nil {
+			return err
+		}
+		if contribution.TransactionID != nil {
+			if err := cancelApprovals(tx, *contribution.TransactionID, time.Now()); err != nil {
+				return err
+			}
+			if err := deleteAnomalies(tx, *contribution.TransactionID); err != nil {
+				return err
+			}
+			if err := deleteSplits(tx, *contribution.TransactionID); err != nil {
+				return err
+			}
+			if err := tx.Delete(&types.Transaction{}, "id = ?", *contribution.TransactionID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&types.SavingsContribution{}, "id = ?", contribution.ID).Error; err != nil {
+			return err
+		}
+		if err := refreshGoal(tx, goal.ID); err != nil {
+			return err
+		}
+		if contribution.TransactionID == nil {
+			return nil
+		}
+		return RecalculateLedger(tx, goal.AiboID)
+	})
+}
+
+// GetMonthlyPace returns how much is currently put aside per month for the goal: the monthly
+// equivalent of its automatic contributions plus the average of the manual contributions of
+// the last 90 days.
+func (r *SavingsRepository) GetMonthlyPace(goal *types.SavingsGoal, today time.Time) (types.Money, error) {
+	var manual types.Money
+	err := r.db.Model(&types.SavingsContribution{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("savings_goal_id = ? AND source = ? AND date > ? AND date <= ?",
+			goal.ID, types.ContributionManual, today.AddDate(0, 0, -paceWindowDays), today).
+		Scan(&manual).Error
+	if err != nil {
+		return 0, err
+	}
+
+	monthlyManual := manual.Mul(types.DaysPerMonth / paceWindowDays)
+	return max(monthlyManual, 0) + goal.AutoMonthlyEquivalent(), nil
+}
+
+// GetDueGoalIDs returns the IDs of the goals that may have an automatic contribution due at the
+// given instant.
+//
+// The query is based on the furthest timezone ahead of UTC, ContributeDue then checks each goal
+// against the local day of its Aibo.
+func (r *SavingsRepository) GetDueGoalIDs(now time.Time) ([]snowflake.ID, error) {
+	latest := utilitaries.LocalDate(now, time.UTC).AddDate(0, 0, 1)
+
+	ids := []snowflake.ID{}
+	err := r.db.Model(&types.SavingsGoal{}).
+		Where("next_auto_date IS NOT NULL AND next_auto_date <= ?", latest).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ContributeDue records every automatic contribution of the goal that is due on the local day
+// of its Aibo and returns how many were recorded. Contributions stop once the goal is completed.
+//
+// The Aibo and the goal are locked for the whole operation and automatic contributions are unique
+// per goal and scheduled day, so running it twice, or concurrently from several replicas, never
+// records a contribution twice.
+func (r *SavingsRepository) ContributeDue(goalID snowflake.ID, now time.Time) (int, error) {
+	created := 0
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var goal types.SavingsGoal
+		if err := tx.First(&goal, "id = ?", goalID).Error; err != nil {
+			return err
+		}
+
+		aibo, err := lockAibo(tx, goal.AiboID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&goal, "id = ?", goalID).Error; err != nil {
+			return err
+		}
+
+		today := utilitaries.LocalDate(now, utilitaries.LoadLocation(aibo.Timezone))
+		for goal.NextAutoDate != nil && !goal.NextAutoDate.After(today) {
+			day := *goal.NextAutoDate
+			contribution := types.SavingsContribution{
+				ID:       utilitaries.GenerateSnowflakeID(),
+				Amount:   *goal.AutoAmount,
+				Date:     day,
+				Source:   types.ContributionAutomatic,
+				AutoDate: &day,
+				Note:     "Automatic contribution",
+			}
+
+			inserted, err := addContribution(tx, &goal, &contribution)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				created++
+			}
+
+			// Reload the goal to pick up its completion, keeping the schedule position.
+			next := goal.AutoNextIndex + 1
+			if err := tx.First(&goal, "id = ?", goalID).Error; err != nil {
+				return err
+			}
+			goal.AutoNextIndex = next
+			goal.NextAutoDate = goal.AutoContributionDate(next)
+		}
+
+		return tx.Model(&goal).Updates(map[string]interface{}{
+			"auto_next_index": goal.AutoNextIndex,
+			"next_auto_date":  goal.NextAutoDate,
+		}).Error
+	})
+
+	return created, err
+}
+
+// addContribution inserts the contribution and its ledger transaction, then refreshes the goal
+// and the ledger balances. It reports false when the contribution already existed.
+func addContribution(tx *gorm.DB, goal *types.SavingsGoal, contribution *types.SavingsContribution) (bool, error) {
+	aibo, err := lockAibo(tx, goal.AiboID)
+	if err != nil {
+		return false, err
+	}
+
+	contribution.SavingsGoalID = goal.ID
+
+	var transaction *types.Transaction
+	if goal.CatBudID != nil {
+		catBudID := *goal.CatBudID
+		transaction = &types.Transaction{
+			ID:       utilitaries.GenerateSnowflakeID(),
+			AiboID:   goal.AiboID,
+			CatBudID: &catBudID,
+			Kind:     types.TransactionExpense,
+			Status:   types.TransactionApproved,
+			Amount:   contribution.Amount,
+			Currency: aibo.BaseCurrency,
+			Date:     contribution.Date,
+			Payee:    goal.Name,
+			Note:     "Savings goal contribution",
+		}
+		if contribution.Amount < 0 {
+			transaction.Kind = types.TransactionIncome
+			transaction.Amount = -contribution.Amount
+			transaction.Note = "Savings goal withdrawal"
+		}
+		transaction.BaseAmount = transaction.Amount
+		contribution.TransactionID = &transaction.ID
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(contribution)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if transaction != nil {
+		if err := tx.Create(transaction).Error; err != nil {
+			return false, err
+		}
+	}
+
+	if err := refreshGoal(tx, goal.ID); err != nil {
+		return false, err
+	}
+
+	if transaction == nil {
+		return true, nil
+	}
+	return true, RecalculateLedger(tx, goal.AiboID)
+}
+
+// refreshGoal derives the saved amount of the goal from its contributions and updates its
+// completion: automatic contributions stop when the target is reached and resume if a
+// withdrawal brings the goal back under its target.
+func refreshGoal(tx *gorm.DB, goalID snowflake.ID) error {
+	err := tx.Exec(`UPDATE savings_goals SET
+			saved_amount = COALESCE((SELECT SUM(amount) FROM savings_contributions WHERE savings_contributions.savings_goal_id = savings_goals.id), 0)
+		WHERE id = ?`, goalID).Error
+	if err != nil {
+		return err
+	}
+
+	var goal types.SavingsGoal
+	if err := tx.First(&goal, "id = ?", goalID).Error; err != nil {
+		return err
+	}
+
+	reached := goal.SavedAmount >= goal.TargetAmount
+	switch {
+	case reached && goal.CompletedAt == nil:
+		return tx.Model(&goal).Updates(map[string]interface{}{
+			"completed_at":   time.Now(),
+			"next_auto_date": nil,
+		}).Error
+	case !reached && goal.CompletedAt != nil:
+		goal.CompletedAt = nil
+		return tx.Model(&goal).Updates(map[string]interface{}{
+			"completed_at":   nil,
+			"next_auto_date": goal.AutoContributionDate(goal.AutoNextIndex),
+		}).Error
+	}
+
+	return nil
+}
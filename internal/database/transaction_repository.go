@@ -0,0 +1,225 @@
+package database
+
+import (
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TransactionRepository struct {
+	db *gorm.DB
+}
+
+// TransactionFilter narrows down the Transactions returned by GetTransactionsByAiboID.
+//
+// Zero values mean "no restriction".
+type TransactionFilter struct {
+	From     time.Time
+	To       time.Time
+	CatBudID *snowflake.ID
+}
+
+// NewTransactionRepository creates a new TransactionRepository instance.
+//
+// The TransactionRepository instance is configured with the provided db instance.
+func NewTransactionRepository(db *gorm.DB) *TransactionRepository {
+	return &TransactionRepository{db: db}
+}
+
+// CreateTransaction records a new Transaction in the ledger.
+//
+// The rules of the Aibo are applied first: they book the Transaction on a CatBud when it is booked
+// on none, and set its tags and note. The amount is converted into the base currency of the Aibo,
+// then the Transaction is inserted with its split lines. An expense booked on the CatBuds of a Household whose approval rules it
+// triggers is left pending, with its approval requests, and an unusual expense is recorded as an
+// anomaly finding. The derived balances of its Aibo are
+// recalculated in the same database transaction. If anything fails, nothing is written and the
+// error is returned. If there is no exchange rate for the day of the Transaction, the error wraps
+// ErrNoExchangeRate.
+func (r *TransactionRepository) CreateTransaction(t *types.Transaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, t.AiboID)
+		if err != nil {
+			return err
+		}
+		if err := applyCategoryRules(tx, t); err != nil {
+			return err
+		}
+		if err := setBaseAmount(tx, t, aibo.BaseCurrency); err != nil {
+			return err
+		}
+		t.Status = types.TransactionApproved
+		if err := tx.Omit("Splits").Create(t).Error; err != nil {
+			return err
+		}
+		if err := saveSplits(tx, t); err != nil {
+			return err
+		}
+		if err := requestApprovals(tx, t); err != nil {
+			return err
+		}
+		if err := checkAnomalies(tx, t); err != nil {
+			return err
+		}
+		return RecalculateLedger(tx, t.AiboID)
+	})
+}
+
+// GetTransactionByID retrieves a Transaction by its ID.
+//
+// The Transaction is queried by its ID and returned with its split lines if found. If the
+// Transaction is not found, a gorm.NotFound error is returned.
+func (r *TransactionRepository) GetTransactionByID(id snowflake.ID) (*types.Transaction, error) {
+	var t types.Transaction
+	err := r.db.Preload("Splits", orderSplits).First(&t, "id = ?", id).Error
+	return &t, err
+}
+
+// GetTransactionsByAiboID retrieves the Transactions of an Aibo, most recent first.
+//
+// The result can be narrowed down with the provided filter; a split Transaction matches a CatBud
+// when one of its lines is booked on it. An empty slice is returned when nothing matches.
+func (r *TransactionRepository) GetTransactionsByAiboID(aiboID uuid.UUID, filter TransactionFilter) ([]types.Transaction, error) {
+	query := r.db.Where("aibo_id = ?", aiboID)
+	if !filter.From.IsZero() {
+		query = query.Where("date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("date <= ?", filter.To)
+	}
+	if filter.CatBudID != nil {
+		query = query.Where("cat_bud_id = ? OR id IN (?)", *filter.CatBudID,
+			r.db.Model(&types.TransactionSplit{}).Select("transaction_id").Where("cat_bud_id = ?", *filter.CatBudID))
+	}
+
+	transactions := []types.Transaction{}
+	err := query.Preload("Splits", orderSplits).Order("date DESC, id DESC").Find(&transactions).Error
+	return transactions, err
+}
+
+// UpdateTransaction saves the changes made to an existing Transaction.
+//
+// The amount is converted again into the base currency of the Aibo, since the amount, the
+// currency or the day may have changed, the split lines are replaced by the ones of the
+// Transaction, its open anomaly findings are made again, and the derived balances of the Aibo are
+// recalculated in the same database transaction.
+//
+// When the kind or the amounts booked on the CatBuds change, the pending approval requests of the
+// Transaction are cancelled and the approval rules are checked again, so a rejected expense can be
+// submitted again by changing it.
+//
+// A Transaction moved to another CatBud is no longer booked by a rule, and the move is recorded as
+// a correction the rules are suggested from.
+//
+// The kind, amount, currency and day of a Transaction recording a debt payment cannot change: the
+// payment must be deleted instead, and ErrDebtPaymentTransaction is returned.
+func (r *TransactionRepository) UpdateTransaction(t *types.Transaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		aibo, err := lockAibo(tx, t.AiboID)
+		if err != nil {
+			return err
+		}
+		var stored types.Transaction
+		if err := tx.Preload("Splits", orderSplits).First(&stored, "id = ?", t.ID).Error; err != nil {
+			return err
+		}
+		if err := setBaseAmount(tx, t, aibo.BaseCurrency); err != nil {
+			return err
+		}
+		if err := checkPaymentTransaction(tx, &stored, t); err != nil {
+			return err
+		}
+		if err := recordCorrection(tx, &stored, t); err != nil {
+			return err
+		}
+		review := needsNewApproval(&stored, t)
+		if review {
+			if err := cancelApprovals(tx, t.ID, time.Now()); err != nil {
+				return err
+			}
+			t.Status = types.TransactionApproved
+		}
+		if err := tx.Omit("Splits").Save(t).Error; err != nil {
+			return err
+		}
+		if err := deleteSplits(tx, t.ID); err != nil {
+			return err
+		}
+		if err := saveSplits(tx, t); err != nil {
+			return err
+		}
+		if review {
+			if err := requestApprovals(tx, t); err != nil {
+				return err
+			}
+		}
+		if err := recheckAnomalies(tx, t); err != nil {
+			return err
+		}
+		return RecalculateLedger(tx, t.AiboID)
+	})
+}
+
+// DeleteTransaction removes a Transaction and its split lines from the ledger, cancelling its
+// pending approval requests, dropping the anomaly findings and the corrections about it, and
+// leaving its attachments to be removed from the storage. When the Transaction records a debt
+// payment, the payment is deleted too and its amount is given back to the balance of the debt.
+//
+// The derived balances of the Aibo are recalculated in the same database transaction.
+func (r *TransactionRepository) DeleteTransaction(t *types.Transaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAibo(tx, t.AiboID); err != nil {
+			return err
+		}
+		if err := cancelApprovals(tx, t.ID, time.Now()); err != nil {
+			return err
+		}
+		if err := deleteAnomalies(tx, t.ID); err != nil {
+			return err
+		}
+		if err := deleteCorrections(tx, t.ID); err != nil {
+			return err
+		}
+		if err := detachAttachments(tx, "transaction_id", t.ID); err != nil {
+			return err
+		}
+		if err := releasePayment(tx, t.ID); err != nil {
+			return err
+		}
+		if err := deleteSplits(tx, t.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&types.Transaction{}, "id = ?", t.ID).Error; err != nil {
+			return err
+		}
+		return RecalculateLedger(tx, t.AiboID)
+	})
+}
+
+// saveSplits inserts the split lines of the Transaction, giving an ID to the new ones.
+func saveSplits(tx *gorm.DB, t *types.Transaction) error {
+	if len(t.Splits) == 0 {
+		return nil
+	}
+	for i := range t.Splits {
+		if t.Splits[i].ID == 0 {
+			t.Splits[i].ID = utilitaries.GenerateSnowflakeID()
+		}
+		t.Splits[i].TransactionID = t.ID
+	}
+	return tx.Create(&t.Splits).Error
+}
+
+// deleteSplits removes the split lines of a Transaction.
+func deleteSplits(tx *gorm.DB, transactionID snowflake.ID) error {
+	return tx.Delete(&types.TransactionSplit{}, "transaction_id = ?", transactionID).Error
+}
+
+// orderSplits returns the split lines in the order they were entered.
+func orderSplits(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
@@ -0,0 +1,232 @@
+package exports
+
+import (
+	"aibo/internal/types"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// Kind tells how the values of a column are written.
+type Kind int
+
+const (
+	// Text is written as is. The identifiers are text, so that spreadsheets keep all their digits.
+	// The tags are a list in JSON Lines, and are joined with commas elsewhere.
+	Text Kind = iota
+	// Amount is a types.Money, written with two decimals.
+	Amount
+	// Date is a time.Time, written as a day.
+	Date
+	// Percent is a float64 percentage, written with one decimal.
+	Percent
+)
+
+// Column is a column of an export.
+type Column struct {
+	// Name of the column, in the header and as the JSON key
+	Name string
+	// How the values are written
+	Kind Kind
+	// Whether the column is exported when no columns are asked for
+	Default bool
+}
+
+// TransactionColumns are the columns of the transactions export, in their default order.
+var TransactionColumns = []Column{
+	{Name: "id", Kind: Text},
+	{Name: "split_id", Kind: Text},
+	{Name: "aibo_id", Kind: Text},
+	{Name: "date", Kind: Date, Default: true},
+	{Name: "kind", Kind: Text, Default: true},
+	{Name: "status", Kind: Text, Default: true},
+	{Name: "payee", Kind: Text, Default: true},
+	{Name: "amount", Kind: Amount, Default: true},
+	{Name: "currency", Kind: Text, Default: true},
+	{Name: "base_amount", Kind: Amount, Default: true},
+	{Name: "cat_bud_id", Kind: Text},
+	{Name: "category_group", Kind: Text, Default: true},
+	{Name: "category", Kind: Text, Default: true},
+	{Name: "note", Kind: Text, Default: true},
+	{Name: "tags", Kind: Text, Default: true},
+	{Name: "recurring_rule_id", Kind: Text},
+	{Name: "import_batch_id", Kind: Text},
+	{Name: "external_id", Kind: Text},
+}
+
+// CatBudColumns are the columns of the CatBuds export, in their default order.
+var CatBudColumns = []Column{
+	{Name: "id", Kind: Text},
+	{Name: "parent_id", Kind: Text},
+	{Name: "household_id", Kind: Text},
+	{Name: "category_group", Kind: Text, Default: true},
+	{Name: "category", Kind: Text, Default: true},
+	{Name: "period", Kind: Text, Default: true},
+	{Name: "budget", Kind: Amount, Default: true},
+	{Name: "budgeted", Kind: Amount, Default: true},
+	{Name: "actual", Kind: Amount, Default: true},
+	{Name: "difference", Kind: Amount, Default: true},
+	{Name: "used_percent", Kind: Percent, Default: true},
+	{Name: "previous_actual", Kind: Amount},
+	{Name: "change", Kind: Amount},
+	{Name: "change_percent", Kind: Percent},
+}
+
+// SelectColumns returns the columns named in a comma-separated list, in its order, or the
+// default columns when the list is empty. It returns an error naming the first unknown or
+// repeated column.
+func SelectColumns(available []Column, list string) ([]Column, error) {
+	if strings.TrimSpace(list) == "" {
+		var columns []Column
+		for _, column := range available {
+			if column.Default {
+				columns = append(columns, column)
+			}
+		}
+		return columns, nil
+	}
+
+	byName := make(map[string]Column, len(available))
+	for _, column := range available {
+		byName[column.Name] = column
+	}
+	var columns []Column
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		column, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q is repeated", name)
+		}
+		seen[name] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// TransactionValues returns the values of a row of the transactions export, in the order of the
+// columns.
+func TransactionValues(line *types.ExportTransaction, columns []Column) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column.Name {
+		case "id":
+			values[i] = line.TransactionID.String()
+		case "split_id":
+			values[i] = idText(line.SplitID)
+		case "aibo_id":
+			values[i] = line.AiboID.String()
+		case "date":
+			values[i] = line.Date
+		case "kind":
+			values[i] = string(line.Kind)
+		case "status":
+			values[i] = string(line.Status)
+		case "payee":
+			values[i] = line.Payee
+		case "amount":
+			values[i] = line.Amount
+		case "currency":
+			values[i] = string(line.Currency)
+		case "base_amount":
+			values[i] = line.BaseAmount
+		case "cat_bud_id":
+			values[i] = idText(line.CatBudID)
+		case "category_group":
+			values[i] = line.CategoryGroup
+		case "category":
+			values[i] = line.Category
+		case "note":
+			values[i] = line.Note
+		case "tags":
+			values[i] = line.Tags
+		case "recurring_rule_id":
+			values[i] = idText(line.RecurringRuleID)
+		case "import_batch_id":
+			values[i] = idText(line.ImportBatchID)
+		case "external_id":
+			values[i] = line.ExternalID
+		}
+	}
+	return values
+}
+
+// CatBudValues returns the values of a row of the CatBuds export, in the order of the columns.
+// The group of a CatBud is the category of its parent, found in groups.
+func CatBudValues(line *types.BudgetComparison, groups map[snowflake.ID]string, columns []Column) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column.Name {
+		case "id":
+			values[i] = line.CatBudID.String()
+		case "parent_id":
+			values[i] = idText(line.ParentID)
+		case "household_id":
+			values[i] = uuidText(line.HouseholdID)
+		case "category_group":
+			if line.ParentID != nil {
+				values[i] = groups[*line.ParentID]
+			} else {
+				values[i] = ""
+			}
+		case "category":
+			values[i] = line.Category
+		case "period":
+			values[i] = string(line.Period)
+		case "budget":
+			values[i] = moneyValue(line.Budget)
+		case "budgeted":
+			values[i] = moneyValue(line.Budgeted)
+		case "actual":
+			values[i] = line.Actual
+		case "difference":
+			values[i] = moneyValue(line.Difference)
+		case "used_percent":
+			values[i] = percentValue(line.UsedPercent)
+		case "previous_actual":
+			values[i] = line.PreviousActual
+		case "change":
+			values[i] = line.Change
+		case "change_percent":
+			values[i] = percentValue(line.ChangePercent)
+		}
+	}
+	return values
+}
+
+// idText returns an optional identifier as text, empty when it is null.
+func idText(id *snowflake.ID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// uuidText returns an optional UUID as text, empty when it is null.
+func uuidText(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// moneyValue returns an optional amount, nil when it is null, which leaves the cell empty.
+func moneyValue(m *types.Money) interface{} {
+	if m == nil {
+		return nil
+	}
+	return *m
+}
+
+// percentValue returns an optional percentage, nil when it is null, which leaves the cell empty.
+func percentValue(p *float64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
@@ -0,0 +1,99 @@
+package exports
+
+import (
+	"aibo/internal/types"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+func TestSelectColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"defaults", "", []string{"date", "kind", "status", "payee", "amount", "currency", "base_amount", "category_group", "category", "note", "tags"}, false},
+		{"blank", "  ", []string{"date", "kind", "status", "payee", "amount", "currency", "base_amount", "category_group", "category", "note", "tags"}, false},
+		{"in the given order", "amount, ID ,date", []string{"amount", "id", "date"}, false},
+		{"unknown", "date,price", nil, true},
+		{"repeated", "date,Date", nil, true},
+		{"empty name", "date,,amount", nil, true},
+	}
+	for _, tt := range tests {
+		columns, err := SelectColumns(TransactionColumns, tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: SelectColumns() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: SelectColumns() = %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+func TestTransactionValues(t *testing.T) {
+	split, catBud := snowflake.ID(2), snowflake.ID(3)
+	aiboID := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	day := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	line := &types.ExportTransaction{
+		TransactionID: 1, SplitID: &split, AiboID: aiboID, Date: day, Kind: types.TransactionExpense,
+		Status: types.TransactionApproved, Amount: 1000, Currency: "USD", BaseAmount: 900, Payee: "Shop",
+		Note: "note", Tags: types.Tags{"a"}, CatBudID: &catBud, Category: "Food", CategoryGroup: "Living", ExternalID: "x/1",
+	}
+	got := TransactionValues(line, TransactionColumns)
+	want := []interface{}{
+		"1", "2", aiboID.String(), day, "expense", string(types.TransactionApproved), "Shop", types.Money(1000), "USD",
+		types.Money(900), "3", "Living", "Food", "note", types.Tags{"a"}, "", "", "x/1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TransactionValues() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestCatBudValues(t *testing.T) {
+	parent := snowflake.ID(10)
+	household := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	budget, used := types.Money(5000), 80.0
+	groups := map[snowflake.ID]string{parent: "Living"}
+
+	tests := []struct {
+		name string
+		line types.BudgetComparison
+		want []interface{}
+	}{
+		{
+			name: "child with a budget",
+			line: types.BudgetComparison{
+				CatBudID: 11, ParentID: &parent, HouseholdID: &household, Category: "Food", Period: types.PeriodMonthly,
+				Budget: &budget, Budgeted: &budget, Actual: 4000, Difference: &budget, UsedPercent: &used,
+				PreviousActual: 3000, Change: 1000,
+			},
+			want: []interface{}{
+				"11", "10", household.String(), "Living", "Food", string(types.PeriodMonthly), budget, budget, types.Money(4000),
+				budget, used, types.Money(3000), types.Money(1000), nil,
+			},
+		},
+		{
+			name: "top-level without a budget",
+			line: types.BudgetComparison{CatBudID: 10, Category: "Living", Period: types.PeriodMonthly, Actual: 4000},
+			want: []interface{}{
+				"10", "", "", "", "Living", string(types.PeriodMonthly), nil, nil, types.Money(4000),
+				nil, nil, types.Money(0), types.Money(0), nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := CatBudValues(&tt.line, groups, CatBudColumns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: CatBudValues() =\n%v\nwant\n%v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package exports
+
+import (
+	"sort"
+	"strings"
+)
+
+// Locale tells how the numbers and dates of a CSV or XLSX export are written. JSON Lines exports
+// always use decimal points and ISO 8601 dates.
+type Locale struct {
+	// Tag of the locale, such as de-DE, empty for the default
+	Name string
+	// Decimal separator of the amounts and percentages in CSV
+	Decimal string
+	// Layout of the dates in CSV, in the syntax of the time package
+	DateLayout string
+	// Number format of the dates in XLSX, in the syntax of the spreadsheets
+	DateFormat string
+	// Field delimiter in CSV: a semicolon where the decimal separator is a comma, so that
+	// spreadsheets set to the locale split the fields right
+	Delimiter rune
+}
+
+// defaultLocale writes ISO 8601 dates and decimal points, which every tool reads.
+var defaultLocale = Locale{Decimal: ".", DateLayout: "2006-01-02", DateFormat: "yyyy-mm-dd", Delimiter: ','}
+
+// locales are the supported locales, by lowercase tag.
+var locales = map[string]Locale{
+	"en-us": {Name: "en-US", Decimal: ".", DateLayout: "01/02/2006", DateFormat: "mm/dd/yyyy", Delimiter: ','},
+	"en-gb": {Name: "en-GB", Decimal: ".", DateLayout: "02/01/2006", DateFormat: "dd/mm/yyyy", Delimiter: ','},
+	"de-de": {Name: "de-DE", Decimal: ",", DateLayout: "02.01.2006", DateFormat: "dd.mm.yyyy", Delimiter: ';'},
+	"de-ch": {Name: "de-CH", Decimal: ".", DateLayout: "02.01.2006", DateFormat: "dd.mm.yyyy", Delimiter: ';'},
+	"fr-fr": {Name: "fr-FR", Decimal: ",", DateLayout: "02/01/2006", DateFormat: "dd/mm/yyyy", Delimiter: ';'},
+	"es-es": {Name: "es-ES", Decimal: ",", DateLayout: "02/01/2006", DateFormat: "dd/mm/yyyy", Delimiter: ';'},
+	"it-it": {Name: "it-IT", Decimal: ",", DateLayout: "02/01/2006", DateFormat: "dd/mm/yyyy", Delimiter: ';'},
+	"nl-nl": {Name: "nl-NL", Decimal: ",", DateLayout: "02-01-2006", DateFormat: "dd-mm-yyyy", Delimiter: ';'},
+	"pt-br": {Name: "pt-BR", Decimal: ",", DateLayout: "02/01/2006", DateFormat: "dd/mm/yyyy", Delimiter: ';'},
+	"ja-jp": {Name: "ja-JP", Decimal: ".", DateLayout: "2006/01/02", DateFormat: "yyyy/mm/dd", Delimiter: ','},
+}
+
+// languages map a bare language tag to the locale it stands for.
+var languages = map[string]string{
+	"en": "en-us", "de": "de-de", "fr": "fr-fr", "es": "es-es", "it": "it-it", "nl": "nl-nl", "pt": "pt-br", "ja": "ja-jp",
+}
+
+// LookupLocale returns the locale of a tag such as de-DE, de_DE or de, case-insensitively. An
+// empty tag gives the default locale. It reports false when the locale is not supported.
+func LookupLocale(tag string) (Locale, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if tag == "" {
+		return defaultLocale, true
+	}
+	if language, ok := languages[tag]; ok {
+		tag = language
+	}
+	locale, ok := locales[tag]
+	return locale, ok
+}
+
+// Locales returns the tags of the supported locales, sorted.
+func Locales() []string {
+	tags := make([]string, 0, len(locales))
+	for _, locale := range locales {
+		tags = append(tags, locale.Name)
+	}
+	sort.Strings(tags)
+	return tags
+}
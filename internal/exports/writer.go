@@ -0,0 +1,171 @@
+package exports
+
+import (
+	"aibo/internal/types"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bufferSize is the amount of output kept in memory before it is written out.
+const bufferSize = 32 * 1024
+
+// Writer writes the rows of an export one by one, so that the whole export never has to be held
+// in memory. The values of a row are in the order of the columns, and are a string, a types.Money,
+// a time.Time, a float64, or nil for an empty cell.
+type Writer interface {
+	// WriteRow writes the values of a row.
+	WriteRow(values []interface{}) error
+	// Close writes out the end of the file. It does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer of the format to w, and writes the header naming the columns.
+//
+// The output is buffered: nothing reaches w before some rows are written or the Writer is
+// closed.
+func NewWriter(format types.ExportFormat, w io.Writer, columns []Column, locale Locale) (Writer, error) {
+	switch format {
+	case types.ExportCSV:
+		return newCSVWriter(w, columns, locale)
+	case types.ExportJSONL:
+		return newJSONLWriter(w, columns), nil
+	case types.ExportXLSX:
+		return newXLSXWriter(w, columns, locale)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// ContentType returns the media type of the files of the format.
+func ContentType(format types.ExportFormat) string {
+	switch format {
+	case types.ExportJSONL:
+		return "application/x-ndjson"
+	case types.ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// csvWriter writes a CSV file with a header line.
+type csvWriter struct {
+	out    *csv.Writer
+	locale Locale
+	record []string
+}
+
+// newCSVWriter starts a CSV file. With a locale, the file starts with a byte order mark, without
+// which Excel does not read it as UTF-8.
+func newCSVWriter(w io.Writer, columns []Column, locale Locale) (*csvWriter, error) {
+	buffered := bufio.NewWriterSize(w, bufferSize)
+	if locale.Name != "" {
+		if _, err := buffered.WriteString("\ufeff"); err != nil {
+			return nil, err
+		}
+	}
+	out := csv.NewWriter(buffered)
+	out.Comma = locale.Delimiter
+	writer := &csvWriter{out: out, locale: locale, record: make([]string, len(columns))}
+	for i, column := range columns {
+		writer.record[i] = column.Name
+	}
+	if err := out.Write(writer.record); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// WriteRow writes the values of a row, formatted for the locale.
+func (w *csvWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		w.record[i] = w.format(value)
+	}
+	return w.out.Write(w.record)
+}
+
+// format formats a value for the locale. The amounts have no thousands separator, so that
+// spreadsheets set to the locale read them as numbers. A text a spreadsheet would run as a
+// formula, such as a payee of an imported statement starting with =, is quoted with an
+// apostrophe.
+func (w *csvWriter) format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case types.Tags:
+		return w.format(strings.Join(v, ", "))
+	case types.Money:
+		return strings.Replace(v.String(), ".", w.locale.Decimal, 1)
+	case time.Time:
+		return v.Format(w.locale.DateLayout)
+	case float64:
+		return strings.Replace(strconv.FormatFloat(v, 'f', 1, 64), ".", w.locale.Decimal, 1)
+	}
+	return fmt.Sprint(value)
+}
+
+// Close writes out the buffered lines.
+func (w *csvWriter) Close() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+// jsonlWriter writes a JSON object per row, keyed by the column names in their order. The
+// amounts are decimal strings, as everywhere in the API, and the dates are YYYY-MM-DD.
+type jsonlWriter struct {
+	out  *bufio.Writer
+	keys [][]byte
+}
+
+// newJSONLWriter starts a JSON Lines file. The file has no header: the keys name the columns.
+func newJSONLWriter(w io.Writer, columns []Column) *jsonlWriter {
+	writer := &jsonlWriter{out: bufio.NewWriterSize(w, bufferSize), keys: make([][]byte, len(columns))}
+	for i, column := range columns {
+		writer.keys[i], _ = json.Marshal(column.Name)
+	}
+	return writer
+}
+
+// WriteRow writes the values of a row as a line.
+func (w *jsonlWriter) WriteRow(values []interface{}) error {
+	w.out.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			w.out.WriteByte(',')
+		}
+		w.out.Write(w.keys[i])
+		w.out.WriteByte(':')
+
+		var encoded []byte
+		var err error
+		switch v := value.(type) {
+		case time.Time:
+			encoded, err = json.Marshal(v.Format("2006-01-02"))
+		case types.Money:
+			encoded, err = json.Marshal(v.String())
+		default:
+			encoded, err = json.Marshal(v)
+		}
+		if err != nil {
+			return err
+		}
+		w.out.Write(encoded)
+	}
+	w.out.WriteByte('}')
+	_, err := w.out.WriteString("\n")
+	return err
+}
+
+// Close writes out the buffered lines.
+func (w *jsonlWriter) Close() error {
+	return w.out.Flush()
+}
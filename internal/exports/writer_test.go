@@ -0,0 +1,226 @@
+package exports
+
+import (
+	"aibo/internal/types"
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var writerColumns = []Column{
+	{Name: "date", Kind: Date},
+	{Name: "payee", Kind: Text},
+	{Name: "amount", Kind: Amount},
+	{Name: "tags", Kind: Text},
+	{Name: "used_percent", Kind: Percent},
+}
+
+var writerRows = [][]interface{}{
+	{time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), "=SUM(A1)", types.Money(123456), types.Tags{"food", "work"}, 12.34},
+	{time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC), "Café <b> & \"co\"", types.Money(-450), types.Tags(nil), nil},
+}
+
+// export writes the rows with a Writer of the format and returns the file.
+func export(t *testing.T, format types.ExportFormat, locale Locale) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, writerColumns, locale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range writerRows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVWriter(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", "date,payee,amount,tags,used_percent\n" +
+			"2024-01-05,'=SUM(A1),1234.56,\"food, work\",12.3\n" +
+			"2024-01-06,\"Café <b> & \"\"co\"\"\",-4.50,,\n"},
+		{"en-US", "\ufeffdate,payee,amount,tags,used_percent\n" +
+			"01/05/2024,'=SUM(A1),1234.56,\"food, work\",12.3\n" +
+			"01/06/2024,\"Café <b> & \"\"co\"\"\",-4.50,,\n"},
+		{"de-DE", "\ufeffdate;payee;amount;tags;used_percent\n" +
+			"05.01.2024;'=SUM(A1);1234,56;food, work;12,3\n" +
+			"06.01.2024;\"Café <b> & \"\"co\"\"\";-4,50;;\n"},
+	}
+	for _, tt := range tests {
+		locale, ok := LookupLocale(tt.locale)
+		if !ok {
+			t.Fatalf("LookupLocale(%q) not found", tt.locale)
+		}
+		if got := string(export(t, types.ExportCSV, locale)); got != tt.want {
+			t.Errorf("%q: CSV =\n%s\nwant\n%s", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestCSVWriterQuotesFormulas(t *testing.T) {
+	w := &csvWriter{locale: defaultLocale}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"=HYPERLINK()", "'=HYPERLINK()"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM", "'@SUM"},
+		{"\tTab", "'\tTab"},
+		{"Shop = fine", "Shop = fine"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := w.format(tt.value); got != tt.want {
+			t.Errorf("format(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	got := string(export(t, types.ExportJSONL, defaultLocale))
+	want := `{"date":"2024-01-05","payee":"=SUM(A1)","amount":"1234.56","tags":["food","work"],"used_percent":12.34}` + "\n" +
+		`{"date":"2024-01-06","payee":"Café \u003cb\u003e \u0026 \"co\"","amount":"-4.50","tags":[],"used_percent":null}` + "\n"
+	if got != want {
+		t.Errorf("JSONL =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// xlsxParts returns the parts of a workbook by name.
+func xlsxParts(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name] = string(content)
+	}
+	return parts
+}
+
+func TestXLSXWriter(t *testing.T) {
+	locale, _ := LookupLocale("de-DE")
+	parts := xlsxParts(t, export(t, types.ExportXLSX, locale))
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		content, ok := parts[name]
+		if !ok {
+			t.Fatalf("the workbook has no %s", name)
+		}
+		decoder := xml.NewDecoder(strings.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not valid XML: %v", name, err)
+			}
+		}
+	}
+
+	if !strings.Contains(parts["xl/styles.xml"], `formatCode="dd.mm.yyyy"`) {
+		t.Errorf("styles.xml does not hold the date format of the locale")
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr" s="4"><is><t xml:space="preserve">date</t></is></c>`,
+		`<c r="E1" t="inlineStr" s="4"><is><t xml:space="preserve">used_percent</t></is></c>`,
+		`<row r="2"><c r="A2" s="2"><v>45296</v></c>`,
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">=SUM(A1)</t></is></c>`,
+		`<c r="C2" s="1"><v>1234.56</v></c>`,
+		`<c r="D2" t="inlineStr"><is><t xml:space="preserve">food, work</t></is></c>`,
+		`<c r="E2" s="3"><v>12.34</v></c></row>`,
+		`<c r="B3" t="inlineStr"><is><t xml:space="preserve">Café &lt;b&gt; &amp; &#34;co&#34;</t></is></c>`,
+		`<c r="C3" s="1"><v>-4.50</v></c></row>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet1.xml does not hold %s", want)
+		}
+	}
+	if strings.Contains(sheet, `r="D3"`) || strings.Contains(sheet, `r="E3"`) {
+		t.Errorf("sheet1.xml holds the empty cells of the second row")
+	}
+}
+
+func TestXLSXWriterRowLimit(t *testing.T) {
+	w, err := newXLSXWriter(io.Discard, writerColumns, defaultLocale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.rows = MaxSpreadsheetRows - 1
+	if err := w.WriteRow(writerRows[0]); err != nil {
+		t.Fatalf("last row: %v", err)
+	}
+	if err := w.WriteRow(writerRows[0]); err == nil {
+		t.Error("no error past the last row of a sheet")
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard, writerColumns, defaultLocale); err == nil {
+		t.Error("no error for an unknown format")
+	}
+}
+
+func TestColumnRef(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {27, "AB"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := columnRef(tt.index); got != tt.want {
+			t.Errorf("columnRef(%d) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		tag      string
+		wantName string
+		wantOK   bool
+	}{
+		{"", "", true},
+		{"de-DE", "de-DE", true},
+		{"de_de", "de-DE", true},
+		{" FR ", "fr-FR", true},
+		{"pt", "pt-BR", true},
+		{"en", "en-US", true},
+		{"en-GB", "en-GB", true},
+		{"xx-YY", "", false},
+		{"de-AT", "", false},
+	}
+	for _, tt := range tests {
+		locale, ok := LookupLocale(tt.tag)
+		if ok != tt.wantOK || locale.Name != tt.wantName {
+			t.Errorf("LookupLocale(%q) = %q, %v, want %q, %v", tt.tag, locale.Name, ok, tt.wantName, tt.wantOK)
+		}
+	}
+	if tags := Locales(); len(tags) != len(locales) || tags[0] != "de-CH" {
+		t.Errorf("Locales() = %v", tags)
+	}
+}
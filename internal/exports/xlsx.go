@@ -0,0 +1,212 @@
+package exports
+
+import (
+	"aibo/internal/types"
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSpreadsheetRows is the largest number of rows of an XLSX export, below its header: the
+// spreadsheets hold 1,048,576 rows per sheet.
+const MaxSpreadsheetRows = 1048575
+
+// The styles of the cells, as indexes of the cellXfs of xlsxStyles.
+const (
+	xlsxStyleAmount  = 1
+	xlsxStyleDate    = 2
+	xlsxStylePercent = 3
+	xlsxStyleHeader  = 4
+)
+
+// xlsxEpoch is the day the spreadsheets count the dates from.
+var xlsxEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles is the style sheet, given the number format of the dates. The amounts are written
+// with the thousands and decimal separators of whoever opens the file.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="3"><numFmt numFmtId="164" formatCode="#,##0.00"/><numFmt numFmtId="165" formatCode="%s"/><numFmt numFmtId="166" formatCode="0.0"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// xlsxWriter writes a workbook of a single sheet. The sheet is the last part of the archive, and
+// is written row by row; its end and the directory of the archive are written on Close.
+type xlsxWriter struct {
+	buffered *bufio.Writer
+	archive  *zip.Writer
+	sheet    *bufio.Writer
+	refs     []string
+	rows     int
+}
+
+// newXLSXWriter starts a workbook, the header row in bold and frozen. The text is written in the
+// cells (inline strings), so that no table of the strings has to be kept until the end.
+func newXLSXWriter(w io.Writer, columns []Column, locale Locale) (*xlsxWriter, error) {
+	buffered := bufio.NewWriterSize(w, bufferSize)
+	archive := zip.NewWriter(buffered)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", fmt.Sprintf(xlsxStyles, locale.DateFormat)},
+	}
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &xlsxWriter{
+		buffered: buffered,
+		archive:  archive,
+		sheet:    bufio.NewWriterSize(file, bufferSize),
+		refs:     make([]string, len(columns)),
+	}
+	writer.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<cols>`)
+	for i, column := range columns {
+		writer.refs[i] = columnRef(i)
+		width := 20
+		switch column.Kind {
+		case Amount, Date:
+			width = 14
+		case Percent:
+			width = 10
+		}
+		fmt.Fprintf(writer.sheet, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+	}
+	writer.sheet.WriteString(`</cols><sheetData><row r="1">`)
+	for i, column := range columns {
+		writer.writeText(i, 1, column.Name, xlsxStyleHeader)
+	}
+	_, err = writer.sheet.WriteString(`</row>`)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// WriteRow writes the values of a row. The amounts, dates and percentages are numbers, formatted
+// by the style of their cell. It returns an error past MaxSpreadsheetRows rows.
+func (w *xlsxWriter) WriteRow(values []interface{}) error {
+	if w.rows == MaxSpreadsheetRows {
+		return errors.New("the export has more rows than a spreadsheet holds")
+	}
+	w.rows++
+	row := w.rows + 1
+	fmt.Fprintf(w.sheet, `<row r="%d">`, row)
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				w.writeText(i, row, v, 0)
+			}
+		case types.Tags:
+			if len(v) > 0 {
+				w.writeText(i, row, strings.Join(v, ", "), 0)
+			}
+		case types.Money:
+			w.writeNumber(i, row, v.String(), xlsxStyleAmount)
+		case time.Time:
+			day := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+			w.writeNumber(i, row, strconv.Itoa(int(day.Sub(xlsxEpoch).Hours()/24)), xlsxStyleDate)
+		case float64:
+			w.writeNumber(i, row, strconv.FormatFloat(v, 'f', -1, 64), xlsxStylePercent)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+// writeText writes a cell holding a text.
+func (w *xlsxWriter) writeText(column, row int, text string, style int) {
+	fmt.Fprintf(w.sheet, `<c r="%s%d" t="inlineStr"`, w.refs[column], row)
+	if style != 0 {
+		fmt.Fprintf(w.sheet, ` s="%d"`, style)
+	}
+	w.sheet.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(w.sheet, []byte(text))
+	w.sheet.WriteString(`</t></is></c>`)
+}
+
+// writeNumber writes a cell holding a number.
+func (w *xlsxWriter) writeNumber(column, row int, number string, style int) {
+	fmt.Fprintf(w.sheet, `<c r="%s%d" s="%d"><v>%s</v></c>`, w.refs[column], row, style, number)
+}
+
+// Close ends the sheet and the archive, and writes them out.
+func (w *xlsxWriter) Close() error {
+	if _, err := w.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	if err := w.archive.Close(); err != nil {
+		return err
+	}
+	return w.buffered.Flush()
+}
+
+// columnRef returns the letters of the column of the given index: A to Z, then AA, AB...
+func columnRef(index int) string {
+	ref := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		ref = string(rune('A'+(index-1)%26)) + ref
+	}
+	return ref
+}
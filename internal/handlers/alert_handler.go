@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AlertService handles the budget alert rules and the in-app list of alerts.
+type AlertService struct {
+	DB               *gorm.DB
+	AlertRepository  *database.AlertRepository
+	CatBudRepository *database.CatBudRepository
+}
+
+// NewAlertService creates a new AlertService instance.
+//
+// The AlertService instance is configured with the provided db instance.
+func NewAlertService(db *gorm.DB) *AlertService {
+	return &AlertService{
+		DB:               db,
+		AlertRepository:  database.NewAlertRepository(db),
+		CatBudRepository: database.NewCatBudRepository(db),
+	}
+}
+
+// GetAlertRules lists the alert rules of the aibo that made the request.
+// @Summary List alert rules
+// @Description List the budget alert rules of the authenticated aibo
+// @Tags alerts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListAlertRulesResponse
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules [get]
+func (s *AlertService) GetAlertRules(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	rules, err := s.AlertRepository.GetRulesByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get alert rules", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get alert rules"})
+		return
+	}
+
+	c.JSON(200, types.ListAlertRulesResponse{Rules: rules})
+}
+
+// CreateAlertRule creates an alert rule for the aibo that made the request.
+//
+// A budget_used rule fires when the spent amount of a CatBud reaches a percentage of its budget
+// plus the amount carried over; create several rules for several steps, such as 50, 80 and 100.
+// A daily_budget_exceeded rule fires when the spending of the day goes over the daily budget, and
+// a delta_below rule when CurrentDelta falls below a floor. Each rule raises at most one alert per
+// period of its CatBud, or per day for the daily budget rules. The rule is evaluated at once.
+//
+// If the request body is invalid, it returns a 400 error. If the CatBud is not visible to the
+// aibo, it returns a 404 error.
+// @Summary Create an alert rule
+// @Description Create a budget alert rule for the authenticated aibo
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rule body types.CreateAlertRuleRequest true "Alert rule details"
+// @Success 201 {object} types.AlertRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules [post]
+func (s *AlertService) CreateAlertRule(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := types.AlertRule{
+		ID:       utilitaries.GenerateSnowflakeID(),
+		AiboID:   aiboID,
+		Kind:     req.Kind,
+		CatBudID: req.CatBudID,
+		Percent:  req.Percent,
+		Floor:    req.Floor,
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if rule.CatBudID != nil {
+		if _, ok := authorizeCatBud(c, s.CatBudRepository, aiboID, *rule.CatBudID, types.RoleViewer); !ok {
+			return
+		}
+	}
+
+	if err := s.AlertRepository.CreateRule(&rule); err != nil {
+		slog.Error("Failed to create alert rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create alert rule"})
+		return
+	}
+
+	c.JSON(201, types.AlertRuleResponse{Rule: rule})
+}
+
+// UpdateAlertRule changes the percentage, the floor or the muted state of an alert rule of the
+// aibo that made the request. The rule is evaluated again at once.
+//
+// If the request body is invalid, it returns a 400 error. If the rule does not exist or belongs to
+// another aibo, it returns a 404 error.
+// @Summary Update an alert rule
+// @Description Update a budget alert rule of the authenticated aibo
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Alert rule ID"
+// @Param rule body types.UpdateAlertRuleRequest true "Alert rule update details"
+// @Success 200 {object} types.AlertRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules/{id} [put]
+func (s *AlertService) UpdateAlertRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Percent != nil {
+		rule.Percent = *req.Percent
+	}
+	if req.Floor != nil {
+		rule.Floor = req.Floor
+	}
+	if req.Muted != nil {
+		rule.Muted = *req.Muted
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.AlertRepository.UpdateRule(rule); err != nil {
+		slog.Error("Failed to update alert rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update alert rule"})
+		return
+	}
+
+	c.JSON(200, types.AlertRuleResponse{Rule: *rule})
+}
+
+// DeleteAlertRule deletes an alert rule of the aibo that made the request. The alerts it raised
+// are kept.
+//
+// If the rule does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete an alert rule
+// @Description Delete a budget alert rule of the authenticated aibo
+// @Tags alerts
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Alert rule ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules/{id} [delete]
+func (s *AlertService) DeleteAlertRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := s.AlertRepository.DeleteRule(rule); err != nil {
+		slog.Error("Failed to delete alert rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Alert rule deleted successfully"})
+}
+
+// GetAlerts lists the alerts of the aibo that made the request, most recent first, with the
+// number of unread ones.
+//
+// If a query parameter is invalid, it returns a 400 error.
+// @Summary List alerts
+// @Description List the budget alerts of the authenticated aibo
+// @Tags alerts
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only list the alerts not read yet"
+// @Success 200 {object} types.ListAlertsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alerts [get]
+func (s *AlertService) GetAlerts(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ListAlertsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	alerts, err := s.AlertRepository.GetAlertsByAiboID(aiboID, req.Unread)
+	if err != nil {
+		slog.Error("Failed to get alerts", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get alerts"})
+		return
+	}
+	unread, err := s.AlertRepository.CountUnread(aiboID)
+	if err != nil {
+		slog.Error("Failed to count unread alerts", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get alerts"})
+		return
+	}
+
+	c.JSON(200, types.ListAlertsResponse{Alerts: alerts, Unread: unread})
+}
+
+// ReadAlert marks an alert of the aibo that made the request as read.
+//
+// If the alert does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Mark an alert as read
+// @Description Mark a budget alert of the authenticated aibo as read
+// @Tags alerts
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Alert ID"
+// @Success 200 {object} types.AlertResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alerts/{id}/read [post]
+func (s *AlertService) ReadAlert(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+	alert, err := s.AlertRepository.GetAlertByID(id)
+	if err != nil || alert.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get alert", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+
+	if err := s.AlertRepository.MarkRead(alert); err != nil {
+		slog.Error("Failed to mark alert as read", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to mark alert as read"})
+		return
+	}
+
+	c.JSON(200, types.AlertResponse{Alert: *alert})
+}
+
+// ReadAllAlerts marks every alert of the aibo that made the request as read.
+// @Summary Mark all alerts as read
+// @Description Mark every budget alert of the authenticated aibo as read
+// @Tags alerts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]int64
+// @Failure 500 {object} map[string]string
+// @Router /alerts/read [post]
+func (s *AlertService) ReadAllAlerts(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	read, err := s.AlertRepository.MarkAllRead(aiboID)
+	if err != nil {
+		slog.Error("Failed to mark alerts as read", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to mark alerts as read"})
+		return
+	}
+
+	c.JSON(200, gin.H{"read": read})
+}
+
+// loadRule fetches the alert rule designated by the ":id" path parameter and checks that it
+// belongs to the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *AlertService) loadRule(c *gin.Context) (*types.AlertRule, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "alert rule not found"})
+		return nil, false
+	}
+	rule, err := s.AlertRepository.GetRuleByID(id)
+	if err != nil || rule.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get alert rule", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "alert rule not found"})
+		return nil, false
+	}
+	return rule, true
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AnalyticsService handles the spending reports and forecasts.
+type AnalyticsService struct {
+	DB                  *gorm.DB
+	AnalyticsRepository *database.AnalyticsRepository
+	ForecastRepository  *database.ForecastRepository
+	AiboRepository      *database.AiboRepository
+	HouseholdRepository *database.HouseholdRepository
+}
+
+// NewAnalyticsService creates a new AnalyticsService instance.
+//
+// The AnalyticsService instance is configured with the provided db instance.
+func NewAnalyticsService(db *gorm.DB) *AnalyticsService {
+	return &AnalyticsService{
+		DB:                  db,
+		AnalyticsRepository: database.NewAnalyticsRepository(db),
+		ForecastRepository:  database.NewForecastRepository(db),
+		AiboRepository:      database.NewAiboRepository(db),
+		HouseholdRepository: database.NewHouseholdRepository(db),
+	}
+}
+
+// GetSpendingReport sums the approved transactions of the aibo that made the request over a range,
+// grouped by category, day, week, month or payee, and compares each group with the previous range.
+//
+// Incomes are subtracted from the expenses in the net amounts. With the category grouping, the
+// lines of a split transaction count in their own CatBuds. A calendar grouping is widened to
+// whole weeks or months, and each bucket is compared with the one before it; the other groupings
+// compare with the same number of days right before the range. With household_id, the report
+// covers the amounts booked on the CatBuds shared by the household, by any of its members.
+//
+// If a query parameter is invalid, it returns a 400 error. If the aibo is not a member of the
+// household, it returns a 404 error.
+// @Summary Get a spending report
+// @Description Spending totals grouped by category, day, week, month or payee, with period-over-period change
+// @Tags analytics
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day of the range (YYYY-MM-DD)"
+// @Param to query string false "Last day of the range (YYYY-MM-DD)"
+// @Param group_by query string false "category (default), day, week, month or payee"
+// @Param household_id query string false "Report on the CatBuds shared by this household"
+// @Success 200 {object} types.SpendingReport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /analytics/spending [get]
+func (s *AnalyticsService) GetSpendingReport(c *gin.Context) {
+	var req types.SpendingReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.GroupBy == "" {
+		req.GroupBy = types.GroupByCategory
+	}
+	if !req.GroupBy.IsValid() {
+		c.JSON(400, gin.H{"error": "group_by must be one of category, day, week, month or payee"})
+		return
+	}
+
+	scope, from, to, ok := reportRange(c, s.AiboRepository, s.HouseholdRepository, req.From, req.To, req.HouseholdID)
+	if !ok {
+		return
+	}
+
+	report, err := s.AnalyticsRepository.GetSpendingReport(scope, req.GroupBy, from, to)
+	if err != nil {
+		slog.Error("Failed to get spending report", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get spending report"})
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+// GetBudgetReport compares the budget of each CatBud the aibo that made the request can see with
+// what was actually spent on it over a range, and with the same number of days right before.
+//
+// The budget of a CatBud is pro-rated over the days of the range from its current period, and the
+// actual amount of a shared CatBud includes the transactions of every member of its household.
+// With household_id, only the CatBuds shared by the household are compared.
+//
+// If a query parameter is invalid, it returns a 400 error. If the aibo is not a member of the
+// household, it returns a 404 error.
+// @Summary Get a budget versus actual report
+// @Description Budget pro-rated over a range versus the actual spending, per CatBud
+// @Tags analytics
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day of the range (YYYY-MM-DD)"
+// @Param to query string false "Last day of the range (YYYY-MM-DD)"
+// @Param household_id query string false "Only compare the CatBuds shared by this household"
+// @Success 200 {object} types.BudgetReport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /analytics/budget-vs-actual [get]
+func (s *AnalyticsService) GetBudgetReport(c *gin.Context) {
+	var req types.BudgetReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, from, to, ok := reportRange(c, s.AiboRepository, s.HouseholdRepository, req.From, req.To, req.HouseholdID)
+	if !ok {
+		return
+	}
+
+	report, err := s.AnalyticsRepository.GetBudgetReport(scope, from, to)
+	if err != nil {
+		slog.Error("Failed to get budget report", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get budget report"})
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+// GetForecast projects the spending of the CatBuds the aibo that made the request can see to the
+// end of their current periods, and the spending of its daily budget to the end of the month.
+//
+// The rest of each period is projected at the average daily pace of the last 90 days, leaving out
+// the recurring transactions, plus the recurring transactions still to come. Each projection comes
+// with an 80% confidence range, the probability of going over the budget and the day the budget is
+// expected to run out. With household_id, only the CatBuds shared by the household are projected.
+//
+// If a query parameter is invalid, it returns a 400 error. If the aibo is not a member of the
+// household, it returns a 404 error.
+// @Summary Get a spending forecast
+// @Description End-of-period spending projections of the daily budget and of each CatBud
+// @Tags analytics
+// @Produce json
+// @Security BearerAuth
+// @Param household_id query string false "Only project the CatBuds shared by this household"
+// @Success 200 {object} types.ForecastReport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /analytics/forecast [get]
+func (s *AnalyticsService) GetForecast(c *gin.Context) {
+	scope, ok := reportScope(c, s.HouseholdRepository, c.Query("household_id"))
+	if !ok {
+		return
+	}
+
+	report, err := s.ForecastRepository.GetForecast(scope)
+	if err != nil {
+		slog.Error("Failed to get forecast", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get forecast"})
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+// reportRange parses the range and the household of a report. The range defaults to the current
+// month in the timezone of the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func reportRange(c *gin.Context, aibos *database.AiboRepository, households *database.HouseholdRepository, rawFrom, rawTo, rawHouseholdID string) (database.AnalyticsScope, time.Time, time.Time, bool) {
+	scope, ok := reportScope(c, households, rawHouseholdID)
+	if !ok {
+		return scope, time.Time{}, time.Time{}, false
+	}
+
+	from, err := parseDate(rawFrom)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid from date format"})
+		return scope, time.Time{}, time.Time{}, false
+	}
+	to, err := parseDate(rawTo)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid to date format"})
+		return scope, time.Time{}, time.Time{}, false
+	}
+	if from.IsZero() || to.IsZero() {
+		aibo, err := aibos.GetAiboByID(scope.AiboID.String())
+		if err != nil {
+			slog.Error("Failed to get aibo", "error", err)
+			c.JSON(404, gin.H{"error": "aibo not found"})
+			return scope, time.Time{}, time.Time{}, false
+		}
+		monthStart, monthEnd := types.PeriodMonthly.Bounds(nil, nil, utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone)))
+		if from.IsZero() {
+			from = monthStart
+		}
+		if to.IsZero() {
+			to = monthEnd
+		}
+	}
+	if to.Before(from) {
+		c.JSON(400, gin.H{"error": "to must not be before from"})
+		return scope, time.Time{}, time.Time{}, false
+	}
+
+	return scope, from, to, true
+}
+
+// reportScope builds the scope of a report for the aibo that made the request, restricted to the
+// household when one is given. Viewing the reports of a household takes the viewer role in it.
+//
+// On failure, the response is already written and false is returned.
+func reportScope(c *gin.Context, households *database.HouseholdRepository, rawHouseholdID string) (database.AnalyticsScope, bool) {
+	var scope database.AnalyticsScope
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return scope, false
+	}
+	scope.AiboID = aiboID
+
+	if rawHouseholdID != "" {
+		householdID, err := uuid.Parse(rawHouseholdID)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid household_id"})
+			return scope, false
+		}
+		if !hasHouseholdRole(c, households, householdID, aiboID, types.RoleViewer) {
+			return scope, false
+		}
+		scope.HouseholdID = &householdID
+	}
+
+	return scope, true
+}
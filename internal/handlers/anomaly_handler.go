@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// anomalyScanDays is how far back a scan checks the expenses by default.
+const anomalyScanDays = 90
+
+// anomalyMaxScanDays is how far back a scan can check the expenses.
+const anomalyMaxScanDays = 366
+
+// AnomalyService handles the unusual expenses found in the ledger and their review.
+type AnomalyService struct {
+	DB                *gorm.DB
+	AnomalyRepository *database.AnomalyRepository
+	AiboRepository    *database.AiboRepository
+}
+
+// NewAnomalyService creates a new AnomalyService instance.
+//
+// The AnomalyService instance is configured with the provided db instance.
+func NewAnomalyService(db *gorm.DB) *AnomalyService {
+	return &AnomalyService{
+		DB:                db,
+		AnomalyRepository: database.NewAnomalyRepository(db),
+		AiboRepository:    database.NewAiboRepository(db),
+	}
+}
+
+// GetAnomalies lists the unusual expenses found in the ledger of the aibo that made the request,
+// most recent first.
+//
+// An expense is checked when it is recorded or changed: against the usual expenses of its CatBuds,
+// for a large first payment to a payee, for a change in the amount a payee always charges, and for
+// the same charge recorded a few days apart.
+//
+// If the status is invalid, it returns a 400 error.
+// @Summary List anomalies
+// @Description List the unusual expenses of the authenticated aibo
+// @Tags anomalies
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "open, confirmed or dismissed"
+// @Success 200 {object} types.ListAnomaliesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /anomalies [get]
+func (s *AnomalyService) GetAnomalies(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ListAnomaliesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != "" && !req.Status.IsValid() {
+		c.JSON(400, gin.H{"error": "status must be one of open, confirmed or dismissed"})
+		return
+	}
+
+	anomalies, err := s.AnomalyRepository.GetAnomaliesByAiboID(aiboID, req.Status)
+	if err != nil {
+		slog.Error("Failed to get anomalies", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get anomalies"})
+		return
+	}
+	open, err := s.AnomalyRepository.CountOpen(aiboID)
+	if err != nil {
+		slog.Error("Failed to count open anomalies", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get anomalies"})
+		return
+	}
+
+	c.JSON(200, types.ListAnomaliesResponse{Anomalies: anomalies, Open: open})
+}
+
+// ConfirmAnomaly confirms that an unusual expense of the aibo that made the request is a real
+// problem, such as a fraudulent or double charge.
+//
+// If the finding does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Confirm an anomaly
+// @Description Confirm an unusual expense of the authenticated aibo as a real problem
+// @Tags anomalies
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Anomaly ID"
+// @Success 200 {object} types.AnomalyResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /anomalies/{id}/confirm [post]
+func (s *AnomalyService) ConfirmAnomaly(c *gin.Context) {
+	s.reviewAnomaly(c, types.AnomalyConfirmed)
+}
+
+// DismissAnomaly dismisses an unusual expense of the aibo that made the request as expected.
+//
+// If the finding does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Dismiss an anomaly
+// @Description Dismiss an unusual expense of the authenticated aibo as expected
+// @Tags anomalies
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Anomaly ID"
+// @Success 200 {object} types.AnomalyResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /anomalies/{id}/dismiss [post]
+func (s *AnomalyService) DismissAnomaly(c *gin.Context) {
+	s.reviewAnomaly(c, types.AnomalyDismissed)
+}
+
+// reviewAnomaly records the verdict of the aibo that made the request on one of its findings.
+func (s *AnomalyService) reviewAnomaly(c *gin.Context, status types.AnomalyStatus) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "anomaly not found"})
+		return
+	}
+	anomaly, err := s.AnomalyRepository.GetAnomalyByID(id)
+	if err != nil || anomaly.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get anomaly", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "anomaly not found"})
+		return
+	}
+
+	if err := s.AnomalyRepository.Review(anomaly, status); err != nil {
+		slog.Error("Failed to review anomaly", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to review anomaly"})
+		return
+	}
+
+	c.JSON(200, types.AnomalyResponse{Anomaly: *anomaly})
+}
+
+// GetAnomalySettings returns the anomaly detection settings of the aibo that made the request.
+// @Summary Get anomaly settings
+// @Description Get the anomaly detection settings of the authenticated aibo
+// @Tags anomalies
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.AnomalySettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /anomalies/settings [get]
+func (s *AnomalyService) GetAnomalySettings(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	settings, err := s.AnomalyRepository.GetSettings(aiboID)
+	if err != nil {
+		slog.Error("Failed to get anomaly settings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get anomaly settings"})
+		return
+	}
+
+	c.JSON(200, types.AnomalySettingsResponse{Settings: *settings})
+}
+
+// UpdateAnomalySettings tunes the anomaly detection of the aibo that made the request.
+//
+// With notify, the new findings are also sent through the notification channels of the aibo.
+// The settings apply to the expenses recorded from now on; the findings already made are kept.
+//
+// If the request body is invalid, it returns a 400 error.
+// @Summary Update anomaly settings
+// @Description Update the anomaly detection settings of the authenticated aibo
+// @Tags anomalies
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body types.UpdateAnomalySettingsRequest true "Anomaly settings"
+// @Success 200 {object} types.AnomalySettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /anomalies/settings [put]
+func (s *AnomalyService) UpdateAnomalySettings(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateAnomalySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := s.AnomalyRepository.GetSettings(aiboID)
+	if err != nil {
+		slog.Error("Failed to get anomaly settings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get anomaly settings"})
+		return
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.ZScoreThreshold != nil {
+		settings.ZScoreThreshold = *req.ZScoreThreshold
+	}
+	if req.NewPayeeMinAmount != nil {
+		settings.NewPayeeMinAmount = *req.NewPayeeMinAmount
+	}
+	if req.DuplicateWindowDays != nil {
+		settings.DuplicateWindowDays = *req.DuplicateWindowDays
+	}
+	if req.Notify != nil {
+		settings.Notify = *req.Notify
+	}
+	if err := settings.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.AnomalyRepository.SaveSettings(settings); err != nil {
+		slog.Error("Failed to save anomaly settings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to save anomaly settings"})
+		return
+	}
+
+	c.JSON(200, types.AnomalySettingsResponse{Settings: *settings})
+}
+
+// ScanAnomalies checks the past expenses of the aibo that made the request for anomalies, such as
+// the ones recorded before the detection was turned on or tuned.
+//
+// The expenses from the given day to today are checked against the history they had on their day.
+// A finding already made, reviewed or not, is not made again, and the new findings are not sent
+// through the notification channels.
+//
+// If the request body is invalid or the day is more than a year ago, it returns a 400 error.
+// @Summary Scan for anomalies
+// @Description Check the past expenses of the authenticated aibo for anomalies
+// @Tags anomalies
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param scan body types.ScanAnomaliesRequest false "Scan range"
+// @Success 200 {object} types.ScanAnomaliesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /anomalies/scan [post]
+func (s *AnomalyService) ScanAnomalies(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ScanAnomaliesRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			slog.Error("Failed to bind JSON", "error", err)
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	from, err := parseDate(req.From)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid from date format"})
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+	today := utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	if from.IsZero() {
+		from = today.AddDate(0, 0, -anomalyScanDays)
+	}
+	if from.Before(today.AddDate(0, 0, -anomalyMaxScanDays)) {
+		c.JSON(400, gin.H{"error": "from must be within the last year"})
+		return
+	}
+
+	checked, found, err := s.AnomalyRepository.Scan(aiboID, from, today)
+	if err != nil {
+		slog.Error("Failed to scan for anomalies", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to scan for anomalies"})
+		return
+	}
+
+	c.JSON(200, types.ScanAnomaliesResponse{Checked: checked, Found: found})
+}
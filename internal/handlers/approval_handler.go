@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ApprovalService handles the approval rules of the households and the approval requests of their
+// members.
+type ApprovalService struct {
+	DB                  *gorm.DB
+	ApprovalRepository  *database.ApprovalRepository
+	HouseholdRepository *database.HouseholdRepository
+}
+
+// NewApprovalService creates a new ApprovalService instance.
+//
+// The ApprovalService instance is configured with the provided db instance.
+func NewApprovalService(db *gorm.DB) *ApprovalService {
+	return &ApprovalService{
+		DB:                  db,
+		ApprovalRepository:  database.NewApprovalRepository(db),
+		HouseholdRepository: database.NewHouseholdRepository(db),
+	}
+}
+
+// GetApprovalRules lists the approval rules of a household.
+//
+// If the aibo is not a member of the household, it returns a 404 error.
+// @Summary List approval rules
+// @Description List the approval rules of a household of the authenticated aibo
+// @Tags approvals
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Success 200 {object} types.ListApprovalRulesResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/approval-rules [get]
+func (s *ApprovalService) GetApprovalRules(c *gin.Context) {
+	householdID, _, ok := s.householdParam(c, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	rules, err := s.ApprovalRepository.GetRulesByHouseholdID(householdID)
+	if err != nil {
+		slog.Error("Failed to get approval rules", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get approval rules"})
+		return
+	}
+
+	c.JSON(200, types.ListApprovalRulesResponse{Rules: rules})
+}
+
+// CreateApprovalRule creates an approval rule for a household. It takes the owner role.
+//
+// From then on, the expenses booked on the CatBuds covered by the rule for more than its threshold
+// wait for the approval of the other members before counting in the budgets.
+//
+// If the request body is invalid or the CatBud is not shared by the household, it returns a 400
+// error. If the aibo is not a member of the household, it returns a 404 error. If it is not an
+// owner, it returns a 403 error.
+// @Summary Create an approval rule
+// @Description Require approval for the expenses of a household over a threshold
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param rule body types.CreateApprovalRuleRequest true "Approval rule details"
+// @Success 201 {object} types.ApprovalRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/approval-rules [post]
+func (s *ApprovalService) CreateApprovalRule(c *gin.Context) {
+	householdID, aiboID, ok := s.householdParam(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var req types.CreateApprovalRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := types.ApprovalRule{
+		ID:                utilitaries.GenerateSnowflakeID(),
+		HouseholdID:       householdID,
+		CatBudID:          req.CatBudID,
+		Threshold:         *req.Threshold,
+		RequiredApprovals: req.RequiredApprovals,
+		CreatedBy:         aiboID,
+	}
+	if rule.RequiredApprovals == 0 {
+		rule.RequiredApprovals = 1
+	}
+
+	if !s.saveRule(c, &rule, s.ApprovalRepository.CreateRule) {
+		return
+	}
+
+	c.JSON(201, types.ApprovalRuleResponse{Rule: rule})
+}
+
+// UpdateApprovalRule changes an approval rule of a household. It takes the owner role.
+//
+// The new settings apply to the expenses recorded afterwards; pending requests keep theirs.
+//
+// If the request body is invalid or the CatBud is not shared by the household, it returns a 400
+// error. If the aibo is not a member of the household or the rule is not one of the household, it
+// returns a 404 error. If the aibo is not an owner, it returns a 403 error.
+// @Summary Update an approval rule
+// @Description Change the CatBud, threshold or required approvals of an approval rule
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param ruleId path string true "Approval rule ID"
+// @Param rule body types.UpdateApprovalRuleRequest true "Approval rule update details"
+// @Success 200 {object} types.ApprovalRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/approval-rules/{ruleId} [put]
+func (s *ApprovalService) UpdateApprovalRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateApprovalRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AllCatBuds {
+		rule.CatBudID = nil
+	} else if req.CatBudID != nil {
+		rule.CatBudID = req.CatBudID
+	}
+	if req.Threshold != nil {
+		rule.Threshold = *req.Threshold
+	}
+	if req.RequiredApprovals != nil {
+		rule.RequiredApprovals = *req.RequiredApprovals
+	}
+
+	if !s.saveRule(c, rule, s.ApprovalRepository.UpdateRule) {
+		return
+	}
+
+	c.JSON(200, types.ApprovalRuleResponse{Rule: *rule})
+}
+
+// DeleteApprovalRule deletes an approval rule of a household. It takes the owner role.
+//
+// The pending requests raised by the rule stay pending.
+//
+// If the aibo is not a member of the household or the rule is not one of the household, it
+// returns a 404 error. If the aibo is not an owner, it returns a 403 error.
+// @Summary Delete an approval rule
+// @Description Delete an approval rule of a household
+// @Tags approvals
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param ruleId path string true "Approval rule ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/approval-rules/{ruleId} [delete]
+func (s *ApprovalService) DeleteApprovalRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := s.ApprovalRepository.DeleteRule(rule); err != nil {
+		slog.Error("Failed to delete approval rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete approval rule"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Approval rule deleted successfully"})
+}
+
+// GetHouseholdApprovals lists the approval requests of a household, most recent first.
+//
+// If the status filter is invalid, it returns a 400 error. If the aibo is not a member of the
+// household, it returns a 404 error.
+// @Summary List the approval requests of a household
+// @Description List the approval requests of a household with their decisions and transactions
+// @Tags approvals
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param status query string false "Only list the requests with this status" Enums(pending, approved, rejected, cancelled)
+// @Success 200 {object} types.ListApprovalRequestsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/approvals [get]
+func (s *ApprovalService) GetHouseholdApprovals(c *gin.Context) {
+	householdID, _, ok := s.householdParam(c, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var req types.ListApprovalRequestsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	requests, err := s.ApprovalRepository.GetRequestsByHouseholdID(householdID, req.Status)
+	if err != nil {
+		slog.Error("Failed to get approval requests", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get approval requests"})
+		return
+	}
+
+	c.JSON(200, types.ListApprovalRequestsResponse{Requests: requests})
+}
+
+// GetApprovals lists the pending approval requests the aibo that made the request can still
+// decide on, across all its households, oldest first.
+// @Summary List my approval requests
+// @Description List the pending approval requests waiting for the decision of the authenticated aibo
+// @Tags approvals
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListApprovalRequestsResponse
+// @Failure 500 {object} map[string]string
+// @Router /approvals [get]
+func (s *ApprovalService) GetApprovals(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	requests, err := s.ApprovalRepository.GetRequestsToDecide(aiboID)
+	if err != nil {
+		slog.Error("Failed to get approval requests", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get approval requests"})
+		return
+	}
+
+	c.JSON(200, types.ListApprovalRequestsResponse{Requests: requests})
+}
+
+// ApproveRequest approves the expense of another member of a household. It takes the editor role.
+//
+// Once the request has enough approvals, and no other household rejected it, the expense counts in
+// the budgets.
+//
+// If the request body is invalid or the aibo recorded the expense, it returns a 400 error. If the
+// request does not exist or the aibo is not a member of its household, it returns a 404 error. If
+// its household role does not allow it, it returns a 403 error. If the aibo already decided or the
+// request is no longer pending, it returns a 409 error.
+// @Summary Approve an expense
+// @Description Approve a pending approval request of a household
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Approval request ID"
+// @Param decision body types.DecideApprovalRequest false "Optional comment"
+// @Success 200 {object} types.ApprovalRequestResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /approvals/{id}/approve [post]
+func (s *ApprovalService) ApproveRequest(c *gin.Context) {
+	s.decide(c, types.DecisionApprove)
+}
+
+// RejectRequest rejects the expense of another member of a household. It takes the editor role.
+//
+// The expense is rejected at once and never counts in the budgets; its recorder can change it to
+// submit it again.
+//
+// If the request body is invalid or the aibo recorded the expense, it returns a 400 error. If the
+// request does not exist or the aibo is not a member of its household, it returns a 404 error. If
+// its household role does not allow it, it returns a 403 error. If the aibo already decided or the
+// request is no longer pending, it returns a 409 error.
+// @Summary Reject an expense
+// @Description Reject a pending approval request of a household
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Approval request ID"
+// @Param decision body types.DecideApprovalRequest false "Optional comment"
+// @Success 200 {object} types.ApprovalRequestResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /approvals/{id}/reject [post]
+func (s *ApprovalService) RejectRequest(c *gin.Context) {
+	s.decide(c, types.DecisionReject)
+}
+
+// decide records the decision of the aibo that made the request on the approval request
+// designated by the ":id" path parameter and writes the response.
+func (s *ApprovalService) decide(c *gin.Context, decision types.ApprovalDecisionKind) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.DecideApprovalRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			slog.Error("Failed to bind JSON", "error", err)
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "approval request not found"})
+		return
+	}
+	request, err := s.ApprovalRepository.GetRequestByID(id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get approval request", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "approval request not found"})
+		return
+	}
+
+	if !hasHouseholdRole(c, s.HouseholdRepository, request.HouseholdID, aiboID, types.RoleEditor) {
+		return
+	}
+
+	err = s.ApprovalRepository.Decide(request, aiboID, decision, req.Comment)
+	switch {
+	case errors.Is(err, database.ErrOwnRequest):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, database.ErrAlreadyDecided), errors.Is(err, database.ErrRequestClosed):
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		slog.Error("Failed to record approval decision", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to record approval decision"})
+		return
+	}
+
+	c.JSON(200, types.ApprovalRequestResponse{Request: *request})
+}
+
+// saveRule validates and stores an approval rule with the given repository method, writing a 400
+// or 500 response when it cannot be saved.
+func (s *ApprovalService) saveRule(c *gin.Context, rule *types.ApprovalRule, save func(*types.ApprovalRule) error) bool {
+	if err := rule.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+
+	err := save(rule)
+	if errors.Is(err, database.ErrInvalidRuleCatBud) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to save approval rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to save approval rule"})
+		return false
+	}
+	return true
+}
+
+// loadRule fetches the approval rule designated by the ":ruleId" path parameter, checking that it
+// belongs to the household of the ":id" path parameter and that the aibo that made the request is
+// one of its owners.
+//
+// On failure, the response is already written and false is returned.
+func (s *ApprovalService) loadRule(c *gin.Context) (*types.ApprovalRule, bool) {
+	householdID, _, ok := s.householdParam(c, types.RoleOwner)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("ruleId"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "approval rule not found"})
+		return nil, false
+	}
+	rule, err := s.ApprovalRepository.GetRuleByID(id)
+	if err != nil || rule.HouseholdID != householdID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get approval rule", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "approval rule not found"})
+		return nil, false
+	}
+	return rule, true
+}
+
+// householdParam reads the household designated by the ":id" path parameter and checks that the
+// aibo that made the request has at least the required role in it.
+//
+// On failure, the response is already written and false is returned.
+func (s *ApprovalService) householdParam(c *gin.Context, required types.HouseholdRole) (uuid.UUID, uuid.UUID, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	householdID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "household not found"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if !hasHouseholdRole(c, s.HouseholdRepository, householdID, aiboID, required) {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return householdID, aiboID, true
+}
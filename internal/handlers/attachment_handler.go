@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"aibo/internal/attachments"
+	"aibo/internal/database"
+	"aibo/internal/storage"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultAttachmentURLExpiry is how long a signed download URL works when no expiry is asked
+	// for.
+	defaultAttachmentURLExpiry = 15 * time.Minute
+	// maxAttachmentNameLength is the size of the file name column.
+	maxAttachmentNameLength = 255
+)
+
+// AttachmentService handles the files attached to the transactions and the CatBuds, such as the
+// receipts kept for warranties and reimbursements.
+type AttachmentService struct {
+	DB                    *gorm.DB
+	AttachmentRepository  *database.AttachmentRepository
+	TransactionRepository *database.TransactionRepository
+	CatBudRepository      *database.CatBudRepository
+	AiboRepository        *database.AiboRepository
+	// Storage keeps the files. It is nil when the storage configured in the environment is
+	// invalid, which disables the attachments.
+	Storage storage.Storage
+	// PublicURL is the scheme and host the application is reached at, such as
+	// https://aibo.example.com, put before the paths linked by the local storage. They are left
+	// relative when it is empty.
+	PublicURL string
+}
+
+// NewAttachmentService creates a new AttachmentService instance.
+//
+// The AttachmentService instance is configured with the provided db instance, with the storage
+// configured in the environment as described by storage.FromEnv, and with the PUBLIC_URL
+// environment variable as its public URL.
+func NewAttachmentService(db *gorm.DB) *AttachmentService {
+	store, err := storage.FromEnv()
+	if err != nil {
+		slog.Error("Attachments disabled", "error", err)
+		store = nil
+	}
+	return &AttachmentService{
+		DB:                    db,
+		AttachmentRepository:  database.NewAttachmentRepository(db),
+		TransactionRepository: database.NewTransactionRepository(db),
+		CatBudRepository:      database.NewCatBudRepository(db),
+		AiboRepository:        database.NewAiboRepository(db),
+		Storage:               store,
+		PublicURL:             strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/"),
+	}
+}
+
+// UploadAttachment attaches a file to a transaction of the aibo that made the request, or to a
+// CatBud it may book on.
+//
+// The content type is found from the bytes of the file, whatever its name: photos (JPEG, PNG,
+// GIF, WebP, HEIC), PDF documents and plain text can be attached. The size of a file and the
+// total size of the files of the aibo, with their thumbnails, are limited by its plan. A thumbnail
+// is made of the JPEG, PNG and GIF images.
+//
+// If the form is invalid, it returns a 400 error. If the transaction or the CatBud is not visible
+// to the aibo, it returns a 404 error, and if its household role does not allow booking on the
+// CatBud, a 403 error. If the file or the storage of the plan is too large, it returns a 413
+// error. If the file cannot be attached, it returns a 415 error. If the storage is not configured,
+// it returns a 503 error.
+// @Summary Attach a file
+// @Description Attach a receipt or a document to a transaction or a CatBud of the authenticated aibo
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "File to attach"
+// @Param transaction_id formData string false "Transaction to attach the file to"
+// @Param cat_bud_id formData string false "CatBud to attach the file to"
+// @Success 201 {object} types.AttachmentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /attachments [post]
+func (s *AttachmentService) UploadAttachment(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok || !s.storageReady(c) {
+		return
+	}
+
+	var req types.UploadAttachmentRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	attachment := types.Attachment{ID: utilitaries.GenerateSnowflakeID(), AiboID: aiboID}
+	if !s.loadTarget(c, aiboID, req.TransactionID, req.CatBudID, types.RoleEditor, &attachment) {
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+	limits := types.AttachmentLimitsFor(aibo)
+	data, fileName, ok := readAttachmentFile(c, limits.MaxFileSize)
+	if !ok {
+		return
+	}
+	contentType, ok := attachments.Sniff(data)
+	if !ok {
+		c.JSON(415, gin.H{"error": fmt.Sprintf("files of type %s cannot be attached, only %s", contentType, strings.Join(attachments.AllowedTypes(), ", "))})
+		return
+	}
+
+	used, err := s.AttachmentRepository.GetUsedStorage(aiboID)
+	if err != nil {
+		slog.Error("Failed to get used storage", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+	if used+int64(len(data)) > limits.MaxTotalSize {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("%s: %d of %d MB used", database.ErrStorageFull, used>>20, limits.MaxTotalSize>>20)})
+		return
+	}
+
+	checksum := sha256.Sum256(data)
+	attachment.FileName = fileName
+	attachment.ContentType = contentType
+	attachment.Size = int64(len(data))
+	attachment.Checksum = hex.EncodeToString(checksum[:])
+	attachment.StorageKey = fmt.Sprintf("attachments/%s/%s", aiboID, attachment.ID)
+
+	ctx := c.Request.Context()
+	if err := s.Storage.Put(ctx, attachment.StorageKey, data, contentType); err != nil {
+		slog.Error("Failed to store attachment", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+	if attachments.HasThumbnail(contentType) {
+		// A thumbnail is a convenience: the file is kept without one when it cannot be made.
+		thumbnail, err := attachments.Thumbnail(data)
+		if err == nil {
+			attachment.HasThumbnail = true
+			attachment.ThumbnailSize = int64(len(thumbnail))
+			err = s.Storage.Put(ctx, attachment.ThumbnailKey(), thumbnail, attachments.ThumbnailContentType)
+		}
+		if err != nil {
+			slog.Error("Failed to make thumbnail", "attachment_id", attachment.ID, "error", err)
+			attachment.HasThumbnail, attachment.ThumbnailSize = false, 0
+		}
+	}
+
+	err = s.AttachmentRepository.CreateAttachment(&attachment)
+	if err != nil {
+		s.removeFiles(context.WithoutCancel(ctx), &attachment)
+	}
+	if errors.Is(err, database.ErrStorageFull) {
+		c.JSON(413, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create attachment", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	c.JSON(201, types.AttachmentResponse{Attachment: attachment})
+}
+
+// GetAttachments lists the files attached to a transaction of the aibo that made the request, or
+// to a CatBud it can see, with the storage the aibo uses and the limits of its plan.
+//
+// If the query is invalid, it returns a 400 error. If the transaction or the CatBud is not
+// visible to the aibo, it returns a 404 error.
+// @Summary List attachments
+// @Description List the files attached to a transaction or a CatBud
+// @Tags attachments
+// @Produce json
+// @Security BearerAuth
+// @Param transaction_id query string false "Transaction whose files are listed"
+// @Param cat_bud_id query string false "CatBud whose files are listed"
+// @Success 200 {object} types.ListAttachmentsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /attachments [get]
+func (s *AttachmentService) GetAttachments(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ListAttachmentsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var target types.Attachment
+	if !s.loadTarget(c, aiboID, req.TransactionID, req.CatBudID, types.RoleViewer, &target) {
+		return
+	}
+
+	var list []types.Attachment
+	var err error
+	if target.TransactionID != nil {
+		list, err = s.AttachmentRepository.GetAttachmentsByTransactionID(*target.TransactionID)
+	} else {
+		list, err = s.AttachmentRepository.GetAttachmentsByCatBudID(*target.CatBudID)
+	}
+	if err != nil {
+		slog.Error("Failed to get attachments", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get attachments"})
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+	used, err := s.AttachmentRepository.GetUsedStorage(aiboID)
+	if err != nil {
+		slog.Error("Failed to get used storage", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get attachments"})
+		return
+	}
+
+	c.JSON(200, types.ListAttachmentsResponse{Attachments: list, Used: used, Limits: types.AttachmentLimitsFor(aibo)})
+}
+
+// GetAttachment returns a file attached to a transaction of the aibo that made the request, or to
+// a CatBud it can see.
+//
+// If the attachment does not exist or is not visible to the aibo, it returns a 404 error.
+// @Summary Get an attachment
+// @Description Get a file attached to a transaction or a CatBud
+// @Tags attachments
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Attachment ID"
+// @Success 200 {object} types.AttachmentResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /attachments/{id} [get]
+func (s *AttachmentService) GetAttachment(c *gin.Context) {
+	attachment, ok := s.loadAttachment(c, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, types.AttachmentResponse{Attachment: *attachment})
+}
+
+// GetAttachmentURL returns a signed URL downloading a file attached to a transaction of the aibo
+// that made the request, or to a CatBud it can see, or its thumbnail. The URL needs no
+// authentication and works until it expires, 15 minutes by default, so it can be opened by a
+// browser or an image tag. A URL of the local storage starts with the public URL of the
+// application, or is a path of the application when none is configured.
+//
+// If the query is invalid, it returns a 400 error. If the attachment does not exist, is not
+// visible to the aibo or has no thumbnail, it returns a 404 error. If the storage is not
+// configured, it returns a 503 error.
+// @Summary Get a download URL
+// @Description Get a time-limited signed URL downloading an attachment or its thumbnail
+// @Tags attachments
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Attachment ID"
+// @Param thumbnail query bool false "Link the thumbnail of the image"
+// @Param inline query bool false "Let the browser show the file rather than save it"
+// @Param expires_in query int false "Validity of the URL in seconds, from 60 to 86400 (default 900)"
+// @Success 200 {object} types.AttachmentURLResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /attachments/{id}/url [get]
+func (s *AttachmentService) GetAttachmentURL(c *gin.Context) {
+	if !s.storageReady(c) {
+		return
+	}
+	var req types.AttachmentURLRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	attachment, ok := s.loadAttachment(c, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	key := attachment.StorageKey
+	download := storage.Download{FileName: attachment.FileName, ContentType: attachment.ContentType, Inline: req.Inline}
+	if req.Thumbnail {
+		if !attachment.HasThumbnail {
+			c.JSON(404, gin.H{"error": "the attachment has no thumbnail"})
+			return
+		}
+		key = attachment.ThumbnailKey()
+		download.FileName = strings.TrimSuffix(attachment.FileName, path.Ext(attachment.FileName)) + "-thumbnail.jpg"
+		download.ContentType = attachments.ThumbnailContentType
+	}
+	expiry := defaultAttachmentURLExpiry
+	if req.ExpiresIn > 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	expiresAt := time.Now().Add(expiry)
+	url, err := s.Storage.SignedURL(c.Request.Context(), key, download, expiry)
+	if err != nil {
+		slog.Error("Failed to sign attachment URL", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get download URL"})
+		return
+	}
+	// The local storage links a path of the application.
+	if strings.HasPrefix(url, "/") {
+		url = s.PublicURL + url
+	}
+
+	c.JSON(200, types.AttachmentURLResponse{URL: url, ExpiresAt: expiresAt.UTC().Truncate(time.Second)})
+}
+
+// DeleteAttachment removes a file attached to a transaction of the aibo that made the request, or
+// to a CatBud it may book on, from the storage.
+//
+// If the attachment does not exist or is not visible to the aibo, it returns a 404 error. If the
+// household role of the aibo does not allow booking on the CatBud, it returns a 403 error. If the
+// storage is not configured, it returns a 503 error.
+// @Summary Delete an attachment
+// @Description Delete a file attached to a transaction or a CatBud
+// @Tags attachments
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Attachment ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /attachments/{id} [delete]
+func (s *AttachmentService) DeleteAttachment(c *gin.Context) {
+	if !s.storageReady(c) {
+		return
+	}
+	attachment, ok := s.loadAttachment(c, types.RoleEditor)
+	if !ok {
+		return
+	}
+
+	if err := s.removeFiles(c.Request.Context(), attachment); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	if err := s.AttachmentRepository.DeleteAttachment(attachment); err != nil {
+		slog.Error("Failed to delete attachment", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// ServeFile serves a file of the local storage through a signed URL made by GetAttachmentURL.
+// It needs no authentication: the signature stands for it.
+//
+// If the signature is invalid, it returns a 403 error. If the file does not exist, or the files
+// are not kept in the local storage, it returns a 404 error. If the URL has expired, it returns a
+// 410 error.
+// @Summary Download a file
+// @Description Download an attachment through a signed URL of the local storage
+// @Tags attachments
+// @Produce octet-stream
+// @Param key path string true "Key of the file"
+// @Param expires query int true "Expiry of the URL, in seconds since the epoch"
+// @Param signature query string true "Signature of the URL"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 410 {object} map[string]string
+// @Router /files/{key} [get]
+func (s *AttachmentService) ServeFile(c *gin.Context) {
+	local, ok := s.Storage.(*storage.Local)
+	if !ok {
+		c.JSON(404, gin.H{"error": "file not found"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	download, err := local.Verify(key, c.Request.URL.Query(), time.Now())
+	if errors.Is(err, storage.ErrExpired) {
+		c.JSON(410, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	file, err := local.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "file not found"})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to open attachment", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to download file"})
+		return
+	}
+	defer file.Close()
+
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(200, -1, contentType, file, map[string]string{
+		"Content-Disposition":     storage.ContentDisposition(download),
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'",
+		"Cache-Control":           "private, no-store",
+	})
+}
+
+// loadTarget checks the transaction or the CatBud a file is attached to, exactly one of the raw
+// IDs, and sets it on the attachment. The aibo must own the transaction, and have at least the
+// required role on the CatBud.
+//
+// On failure, the response is already written and false is returned.
+func (s *AttachmentService) loadTarget(c *gin.Context, aiboID uuid.UUID, rawTransactionID, rawCatBudID string, required types.HouseholdRole, attachment *types.Attachment) bool {
+	if (rawTransactionID == "") == (rawCatBudID == "") {
+		c.JSON(400, gin.H{"error": "either transaction_id or cat_bud_id is required"})
+		return false
+	}
+
+	if rawCatBudID != "" {
+		id, err := snowflake.ParseString(rawCatBudID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "cat bud not found"})
+			return false
+		}
+		if _, ok := authorizeCatBud(c, s.CatBudRepository, aiboID, id, required); !ok {
+			return false
+		}
+		attachment.CatBudID = &id
+		return true
+	}
+
+	id, err := snowflake.ParseString(rawTransactionID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "transaction not found"})
+		return false
+	}
+	transaction, err := s.TransactionRepository.GetTransactionByID(id)
+	if err != nil || transaction.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get transaction", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "transaction not found"})
+		return false
+	}
+	attachment.TransactionID = &id
+	return true
+}
+
+// loadAttachment fetches the attachment designated by the ":id" path parameter and checks that
+// the aibo that made the request owns its transaction, or has at least the required role on its
+// CatBud.
+//
+// On failure, the response is already written and false is returned.
+func (s *AttachmentService) loadAttachment(c *gin.Context, required types.HouseholdRole) (*types.Attachment, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "attachment not found"})
+		return nil, false
+	}
+	attachment, err := s.AttachmentRepository.GetAttachmentByID(id)
+	if err != nil || attachment.TransactionID == nil && attachment.CatBudID == nil {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get attachment", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "attachment not found"})
+		return nil, false
+	}
+
+	rawTransactionID, rawCatBudID := "", ""
+	if attachment.TransactionID != nil {
+		rawTransactionID = attachment.TransactionID.String()
+	} else {
+		rawCatBudID = attachment.CatBudID.String()
+	}
+	var target types.Attachment
+	if !s.loadTarget(c, aiboID, rawTransactionID, rawCatBudID, required, &target) {
+		return nil, false
+	}
+	return attachment, true
+}
+
+// storageReady checks that the storage of the attachments is configured.
+//
+// If it is not, a 503 error is written and false is returned.
+func (s *AttachmentService) storageReady(c *gin.Context) bool {
+	if s.Storage == nil {
+		c.JSON(503, gin.H{"error": "attachments are not available"})
+		return false
+	}
+	return true
+}
+
+// removeFiles removes a file and its thumbnail from the storage. A failure is logged and
+// returned.
+func (s *AttachmentService) removeFiles(ctx context.Context, attachment *types.Attachment) error {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey()} {
+		if key == "" {
+			continue
+		}
+		if err := s.Storage.Delete(ctx, key); err != nil {
+			slog.Error("Failed to delete attachment file", "key", key, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// readAttachmentFile reads the "file" field of the form, of at most maxSize bytes, and returns its
+// bytes and its base name. The body of the request is cut off past that size.
+//
+// On failure, the response is already written and false is returned.
+func readAttachmentFile(c *gin.Context, maxSize int64) ([]byte, string, bool) {
+	tooLarge := fmt.Sprintf("file must not be larger than %d MB on your plan", maxSize>>20)
+	limitUploadBody(c, maxSize)
+	header, err := c.FormFile("file")
+	if isBodyTooLarge(err) {
+		c.JSON(413, gin.H{"error": tooLarge})
+		return nil, "", false
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file is required"})
+		return nil, "", false
+	}
+	if header.Size > maxSize {
+		c.JSON(413, gin.H{"error": tooLarge})
+		return nil, "", false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		slog.Error("Failed to open uploaded file", "error", err)
+		c.JSON(400, gin.H{"error": "Failed to read file"})
+		return nil, "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		slog.Error("Failed to read uploaded file", "error", err)
+		c.JSON(400, gin.H{"error": "Failed to read file"})
+		return nil, "", false
+	}
+	if int64(len(data)) > maxSize {
+		c.JSON(413, gin.H{"error": tooLarge})
+		return nil, "", false
+	}
+	if len(data) == 0 {
+		c.JSON(400, gin.H{"error": "file is empty"})
+		return nil, "", false
+	}
+
+	// Browsers send the base name, but some clients send a whole path.
+	name := strings.TrimSpace(path.Base(strings.ReplaceAll(header.Filename, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if utf8.RuneCountInString(name) > maxAttachmentNameLength {
+		ext := path.Ext(name)
+		if utf8.RuneCountInString(ext) > 16 {
+			ext = ""
+		}
+		name = string([]rune(name)[:maxAttachmentNameLength-utf8.RuneCountInString(ext)]) + ext
+	}
+	return data, name, true
+}
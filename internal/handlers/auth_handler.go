@@ -2,35 +2,47 @@ package handlers
 
 import (
 	"aibo/internal/database"
+	"aibo/internal/templates"
 	"aibo/internal/types"
 	"aibo/internal/utilitaries"
-	"fmt"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // AuthService handles authentication-related requests.
 type AuthService struct {
-	DB             *gorm.DB
-	AiboRepository *database.AiboRepository
+	DB                    *gorm.DB
+	AiboRepository        *database.AiboRepository
+	DailyBudgetRepository *database.DailyBudgetRepository
+	CatBudRepository      *database.CatBudRepository
 }
 
 // NewAuthService returns a new AuthService instance.
 //
 // The AuthService instance is configured with the provided db instance.
 func NewAuthService(db *gorm.DB) *AuthService {
-	return &AuthService{DB: db, AiboRepository: database.NewAiboRepository(db)}
+	return &AuthService{
+		DB:                    db,
+		AiboRepository:        database.NewAiboRepository(db),
+		DailyBudgetRepository: database.NewDailyBudgetRepository(db),
+		CatBudRepository:      database.NewCatBudRepository(db),
+	}
 }
 
 // Register creates a new aibo and returns a 201 status with a JSON response containing a message "aibo created successfully".
 //
 // The request body should contain an "email", a "password", and a "daily_budget" field.
 //
-// If the request body is invalid, it returns a 400 error with a JSON response containing the error message.
+// A budget template can be given to start with its categories, with its budgets scaled to the
+// monthly income when one is given.
+//
+// If the request body or the template is invalid, it returns a 400 error with a JSON response containing the error message.
 //
 // If the aibo already exists, it returns a 409 error with a JSON response containing the error message.
 //
@@ -62,10 +74,44 @@ func (h *AuthService) Register(c *gin.Context) {
 
 	req.Password = string(hashedPassword)
 
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		slog.Error("Failed to load timezone", "error", err)
+		c.JSON(400, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	if req.BaseCurrency == "" {
+		req.BaseCurrency = types.DefaultCurrency
+	}
+	if !req.BaseCurrency.IsSupported() {
+		c.JSON(400, gin.H{"error": "Invalid base currency"})
+		return
+	}
+
+	var template types.BudgetTemplate
+	if req.Template != "" {
+		template, err = templates.Get(req.Template, 0)
+		if err != nil {
+			slog.Error("Failed to get budget template", "error", err)
+			c.JSON(400, gin.H{"error": "Invalid template"})
+			return
+		}
+		if req.MonthlyIncome != nil {
+			template = template.ScaledTo(*req.MonthlyIncome)
+		}
+	}
+
 	var aibo types.Aibo = types.Aibo{
-		Email:        req.Email,
-		Password:     req.Password,
-		CurrentDelta: 0,
+		ID:             uuid.New(),
+		Email:          req.Email,
+		Password:       req.Password,
+		CurrentDelta:   0,
+		Timezone:       req.Timezone,
+		RolloverPolicy: types.RolloverCarryAll,
+		BaseCurrency:   req.BaseCurrency,
 	}
 
 	if err := h.AiboRepository.CreateAibo(&aibo); err != nil {
@@ -74,6 +120,18 @@ func (h *AuthService) Register(c *gin.Context) {
 		return
 	}
 
+	if err := h.DailyBudgetRepository.OpenBudgetDay(&aibo, time.Now()); err != nil {
+		// The daily rollover job opens the budget day of aibos that have none.
+		slog.Error("Failed to open budget day", "error", err)
+	}
+
+	if req.Template != "" {
+		// The template can still be applied from the onboarding endpoint.
+		if _, err := h.CatBudRepository.ApplyTemplate(aibo.ID, template); err != nil {
+			slog.Error("Failed to apply budget template", "error", err)
+		}
+	}
+
 	c.JSON(201, gin.H{"message": "aibo created successfully"})
 }
 
@@ -120,7 +178,7 @@ func (h *AuthService) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := utilitaries.GenerateJWT(fmt.Sprintf("%d", aibo.ID))
+	token, err := utilitaries.GenerateJWT(aibo.ID.String())
 	if err != nil {
 		slog.Error("Failed to generate token", "error", err)
 		c.JSON(500, gin.H{"error": "Failed to generate token"})
@@ -207,8 +265,37 @@ func (h *AuthService) UpdateProfile(c *gin.Context) {
 		}
 		aibo.BirthDate = birthDate
 	}
+	if req.DailyBudget != nil {
+		aibo.DailyBudget = *req.DailyBudget
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			slog.Error("Failed to load timezone", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+			return
+		}
+		aibo.Timezone = req.Timezone
+	}
+	if req.RolloverPolicy != "" {
+		if !req.RolloverPolicy.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rollover policy"})
+			return
+		}
+		aibo.RolloverPolicy = req.RolloverPolicy
+	}
+	if req.BaseCurrency != "" {
+		if !req.BaseCurrency.IsSupported() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid base currency"})
+			return
+		}
+		aibo.BaseCurrency = req.BaseCurrency
+	}
 
 	err = h.AiboRepository.UpdateAibo(aibo)
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to update aibo", "error", err)
 		c.JSON(500, gin.H{"error": "Failed to update aibo"})
@@ -289,3 +376,52 @@ func (h *AuthService) Logout(c *gin.Context) {
 	c.Set("aibo_id", "")
 	c.JSON(200, gin.H{"message": "aibo logged out successfully"})
 }
+
+// GetDailyHistory returns the closed days of the daily budget of the aibo that made the request.
+//
+// The days can be filtered by date range.
+// If a filter is invalid, it returns a 400 error.
+// @Summary Get daily budget history
+// @Description Get the closed days of the daily budget of the authenticated aibo
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Success 200 {object} types.DailyBudgetHistoryResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /profile/daily-history [get]
+func (h *AuthService) GetDailyHistory(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.DailyBudgetHistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		slog.Error("Failed to bind query", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, err := parseDate(req.From)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid from date format"})
+		return
+	}
+	to, err := parseDate(req.To)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid to date format"})
+		return
+	}
+
+	days, err := h.DailyBudgetRepository.GetHistoryByAiboID(aiboID, from, to)
+	if err != nil {
+		slog.Error("Failed to get daily history", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get daily history"})
+		return
+	}
+
+	c.JSON(200, types.DailyBudgetHistoryResponse{Days: days})
+}
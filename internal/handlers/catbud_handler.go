@@ -3,16 +3,20 @@ package handlers
 import (
 	"aibo/internal/database"
 	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
 	"log/slog"
 
+	"github.com/bwmarrin/snowflake"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type CatBudService struct {
-	DB               *gorm.DB
-	CatBudRepository *database.CatBudRepository
+	DB                  *gorm.DB
+	CatBudRepository    *database.CatBudRepository
+	HouseholdRepository *database.HouseholdRepository
 }
 
 // NewCatBudService creates a new CatBudService instance.
@@ -20,27 +24,48 @@ type CatBudService struct {
 // The CatBudService instance is configured with the provided db instance.
 func NewCatBudService(db *gorm.DB) *CatBudService {
 	return &CatBudService{
-		DB:               db,
-		CatBudRepository: database.NewCatBudRepository(db),
+		DB:                  db,
+		CatBudRepository:    database.NewCatBudRepository(db),
+		HouseholdRepository: database.NewHouseholdRepository(db),
 	}
 }
 
 // GetCatBuds retrieves all CatBud entries from the database.
 //
-// The function queries the database for all CatBud entries and returns them as a slice.
+// The function queries the database for all CatBud entries and returns them as a tree of
+// categories and subcategories. Each CatBud carries the bounds of its current period, its
+// pro-rated daily allowance and the amounts spent and remaining in that period, along with
+// the budgets and spent amounts rolled up from its subcategories.
 //
-// If no entries are found, a custom error is returned indicating that no CatBuds were found.
+// The list holds the personal CatBuds of the aibo and the CatBuds of the households it is a member
+// of. An Aibo without any CatBud gets an empty list.
+//
+// If the aibo ID is not the one of the aibo that made the request, it returns a 403 error.
 func (s *CatBudService) GetCatBuds(c *gin.Context) {
-	aiboID := c.Param("aiboID")
+	currentID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
 
-	catBuds, err := s.CatBudRepository.GetAllCatBudsByAiboID(uuid.MustParse(aiboID))
+	aiboID, err := uuid.Parse(c.Param("aiboId"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid aibo ID"})
+		return
+	}
+	if aiboID != currentID {
+		c.JSON(403, gin.H{"error": "cat buds can only be listed for your own aibo"})
+		return
+	}
+
+	catBuds, err := s.CatBudRepository.GetAllCatBudsByAiboID(aiboID)
 	if err != nil {
 		slog.Error("Failed to get cat buds", "error", err)
-		c.JSON(404, gin.H{"error": err.Error()})
+		c.JSON(500, gin.H{"error": "Failed to get cat buds"})
+		return
 	}
 
 	var resp types.GetCatBudsResponse
-	resp.CatBuds = catBuds
+	resp.CatBuds = types.BuildCatBudTree(catBuds)
 
 	c.JSON(200, resp)
 }
@@ -49,10 +74,24 @@ func (s *CatBudService) GetCatBuds(c *gin.Context) {
 //
 // The function reads the request body and creates a new CatBud entry using the provided data.
 //
-// If the request body is invalid, it returns a 400 error.
+// A CatBud can be created under an existing parent CatBud of the same aibo with parent_id. Only
+// the settings of a CatBud are read: the amounts derived from the ledger, such as spent or
+// carried_over, and its periods are computed once it is created.
+//
+// With household_id, the CatBuds are shared by the household; creating them takes the editor
+// role in it.
+//
+// If the request body or a parent is invalid, it returns a 400 error. If the aibo ID is not the
+// one of the aibo that made the request, or its household role does not allow it, it returns a
+// 403 error.
 //
 // If the CatBud is created successfully, it returns a 201 status with a JSON response containing the created CatBud.
 func (s *CatBudService) CreateCatBuds(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
 	var req types.CreateCatBudsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		slog.Error("Failed to bind JSON", "error", err)
@@ -60,18 +99,38 @@ func (s *CatBudService) CreateCatBuds(c *gin.Context) {
 		return
 	}
 
-	authRepo := database.NewAiboRepository(s.DB)
-
-	_, err := authRepo.GetAiboByID(req.AiboID.String())
+	if req.AiboID != uuid.Nil && req.AiboID != aiboID {
+		c.JSON(403, gin.H{"error": "cat buds can only be created for your own aibo"})
+		return
+	}
 
-	if err != nil {
-		slog.Error("Failed to get aibo", "error", err)
-		c.JSON(404, gin.H{"messge": "aibo not found", "error": err.Error()})
+	if req.HouseholdID != nil && !hasHouseholdRole(c, s.HouseholdRepository, *req.HouseholdID, aiboID, types.RoleEditor) {
 		return
 	}
 
-	for _, catBud := range req.CatBuds {
-		if err := s.CatBudRepository.CreateCatBud(&catBud); err != nil {
+	catBuds := make([]types.CatBud, len(req.CatBuds))
+	for i := range req.CatBuds {
+		catBuds[i] = req.CatBuds[i].CatBud(aiboID, req.HouseholdID)
+		if catBuds[i].ID == 0 {
+			catBuds[i].ID = utilitaries.GenerateSnowflakeID()
+		}
+		if err := catBuds[i].ValidatePeriod(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := catBuds[i].ValidateRollover(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	for i := range catBuds {
+		err := s.CatBudRepository.CreateCatBud(&catBuds[i])
+		if errors.Is(err, database.ErrInvalidParent) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
 			slog.Error("Failed to create cat bud", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -84,11 +143,21 @@ func (s *CatBudService) CreateCatBuds(c *gin.Context) {
 // UpdateCatBud updates an existing CatBud entry in the database.
 //
 // The function reads the request body and updates the CatBud entry using the provided data.
+// The CatBud is moved, with its subcategories, under parent_id or to the top level with move_to_root.
 //
-// If the request body is invalid, it returns a 400 error.
+// The aibo needs the editor role on a CatBud shared by a household.
+//
+// If the request body or the new parent is invalid, it returns a 400 error. If the CatBud is not
+// visible to the aibo, it returns a 404 error. If its household role does not allow it, it
+// returns a 403 error.
 //
 // If the CatBud is updated successfully, it returns a 200 status with a JSON response containing the updated CatBud.
 func (s *CatBudService) UpdateCatBud(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
 	var req types.UpdateCatBudRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		slog.Error("Failed to bind JSON", "error", err)
@@ -96,11 +165,8 @@ func (s *CatBudService) UpdateCatBud(c *gin.Context) {
 		return
 	}
 
-	cb, err := s.CatBudRepository.GetCatBudByID(req.ID)
-
-	if err != nil {
-		slog.Error("Failed to get cat bud", "error", err)
-		c.JSON(404, gin.H{"error": err.Error()})
+	cb, ok := authorizeCatBud(c, s.CatBudRepository, aiboID, req.ID, types.RoleEditor)
+	if !ok {
 		return
 	}
 
@@ -112,8 +178,58 @@ func (s *CatBudService) UpdateCatBud(c *gin.Context) {
 		cb.Budget = req.Budget
 	}
 
-	err = s.CatBudRepository.UpdateCatBud(cb)
+	if req.Period != "" {
+		cb.Period = req.Period
+	}
+
+	if req.PeriodAnchor != "" {
+		anchor, err := parseDate(req.PeriodAnchor)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid period_anchor format"})
+			return
+		}
+		cb.PeriodAnchor = &anchor
+	}
 
+	if req.CustomEnd != "" {
+		customEnd, err := parseDate(req.CustomEnd)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid custom_end format"})
+			return
+		}
+		cb.CustomEnd = &customEnd
+	}
+
+	if req.RolloverRule != "" {
+		cb.RolloverRule = req.RolloverRule
+	}
+
+	if req.RolloverCap != nil {
+		cb.RolloverCap = req.RolloverCap
+	}
+
+	if req.MoveToRoot {
+		cb.ParentID = nil
+	} else if req.ParentID != nil {
+		cb.ParentID = req.ParentID
+	}
+
+	if err := cb.ValidatePeriod(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := cb.ValidateRollover(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.CatBudRepository.UpdateCatBud(cb)
+
+	if errors.Is(err, database.ErrInvalidParent) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to update cat bud", "error", err)
 		c.JSON(500, gin.H{"error": err.Error()})
@@ -125,10 +241,19 @@ func (s *CatBudService) UpdateCatBud(c *gin.Context) {
 
 // DeleteCatBud deletes an existing CatBud entry in the database.
 //
-// The function reads the ID of the CatBud to be deleted from the request body.
+// The function reads the ID of the CatBud to be deleted from the request body. The aibo needs the
+// editor role on a CatBud shared by a household.
+//
+// If the CatBud is not visible to the aibo, it returns a 404 error. If its household role does not
+// allow it, it returns a 403 error.
 //
 // If the CatBud is deleted successfully, it returns a 200 status with a JSON response indicating success.
 func (s *CatBudService) DeleteCatBud(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
 	var req types.DeleteCatBudRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		slog.Error("Failed to bind JSON", "error", err)
@@ -136,6 +261,10 @@ func (s *CatBudService) DeleteCatBud(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeCatBud(c, s.CatBudRepository, aiboID, req.ID, types.RoleEditor); !ok {
+		return
+	}
+
 	if err := s.CatBudRepository.DeleteCatBudByID(req.ID); err != nil {
 		slog.Error("Failed to delete cat bud", "error", err)
 		c.JSON(500, gin.H{"error": err.Error()})
@@ -144,3 +273,37 @@ func (s *CatBudService) DeleteCatBud(c *gin.Context) {
 
 	c.JSON(200, gin.H{"message": "Cat bud deleted successfully"})
 }
+
+// GetCatBudBalances returns the envelope history of a CatBud visible to the aibo that made the
+// request, one of its own or one of its households.
+//
+// Each closed period lists its budget, the amount carried in, the amount spent, the resulting
+// balance and what was carried out according to the rollover rule.
+//
+// If the CatBud does not exist or is not visible to the aibo, it returns a 404 error.
+func (s *CatBudService) GetCatBudBalances(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "cat bud not found"})
+		return
+	}
+
+	cb, ok := authorizeCatBud(c, s.CatBudRepository, aiboID, id, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	balances, err := s.CatBudRepository.GetPeriodBalances(id)
+	if err != nil {
+		slog.Error("Failed to get cat bud balances", "error", err)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, types.CatBudBalancesResponse{CatBud: *cb, Balances: balances})
+}
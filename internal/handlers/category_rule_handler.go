@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// categoryRuleMaxApplyDays is the longest range the rules are applied again to at once.
+const categoryRuleMaxApplyDays = 366
+
+// CategoryRuleService handles the auto-categorization rules, their suggestions and their
+// application to the past transactions.
+type CategoryRuleService struct {
+	DB                     *gorm.DB
+	AiboRepository         *database.AiboRepository
+	CategoryRuleRepository *database.CategoryRuleRepository
+	CatBudRepository       *database.CatBudRepository
+	ImportRepository       *database.ImportRepository
+}
+
+// NewCategoryRuleService creates a new CategoryRuleService instance.
+//
+// The CategoryRuleService instance is configured with the provided db instance.
+func NewCategoryRuleService(db *gorm.DB) *CategoryRuleService {
+	return &CategoryRuleService{
+		DB:                     db,
+		AiboRepository:         database.NewAiboRepository(db),
+		CategoryRuleRepository: database.NewCategoryRuleRepository(db),
+		CatBudRepository:       database.NewCatBudRepository(db),
+		ImportRepository:       database.NewImportRepository(db),
+	}
+}
+
+// GetCategoryRules lists the auto-categorization rules of the aibo that made the request, in the
+// order they are applied.
+// @Summary List category rules
+// @Description List the auto-categorization rules of the authenticated aibo, highest priority first
+// @Tags category-rules
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListCategoryRulesResponse
+// @Failure 500 {object} map[string]string
+// @Router /category-rules [get]
+func (s *CategoryRuleService) GetCategoryRules(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	rules, err := s.CategoryRuleRepository.GetRulesByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get category rules", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get category rules"})
+		return
+	}
+
+	c.JSON(200, types.ListCategoryRulesResponse{Rules: rules})
+}
+
+// CreateCategoryRule creates an auto-categorization rule for the aibo that made the request.
+//
+// A rule matches the transactions meeting all of its conditions: text the payee or the note
+// contains, a regular expression the payee matches, a kind, a range of amounts, or the bank
+// account they were imported from. It books them on a CatBud, adds tags and sets a note. The
+// rules are applied, highest priority first, to the transactions recorded by hand, which they
+// only book when no CatBud is given, and to the rows of the bank statements imported, which they
+// book whatever their category. The first matching rule with a CatBud wins.
+//
+// If the request body is invalid, it returns a 400 error. If the CatBud is not one the aibo may
+// book on, it returns a 403 or 404 error. If the import account is not one of the aibo, it returns
+// a 404 error.
+// @Summary Create a category rule
+// @Description Create an auto-categorization rule for the authenticated aibo
+// @Tags category-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rule body types.CreateCategoryRuleRequest true "Category rule details"
+// @Success 201 {object} types.CategoryRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /category-rules [post]
+func (s *CategoryRuleService) CreateCategoryRule(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateCategoryRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tags, err := types.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := types.CategoryRule{
+		ID:              utilitaries.GenerateSnowflakeID(),
+		AiboID:          aiboID,
+		Name:            req.Name,
+		Priority:        req.Priority,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+		PayeeContains:   req.PayeeContains,
+		PayeePattern:    req.PayeePattern,
+		NoteContains:    req.NoteContains,
+		Kind:            req.Kind,
+		MinAmount:       req.MinAmount,
+		MaxAmount:       req.MaxAmount,
+		ImportAccountID: req.ImportAccountID,
+		CatBudID:        req.CatBudID,
+		Tags:            tags,
+		Note:            req.Note,
+	}
+	if !s.checkRule(c, aiboID, &rule) {
+		return
+	}
+
+	if err := s.CategoryRuleRepository.CreateRule(&rule); err != nil {
+		slog.Error("Failed to create category rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create category rule"})
+		return
+	}
+
+	c.JSON(201, types.CategoryRuleResponse{Rule: rule})
+}
+
+// UpdateCategoryRule changes an auto-categorization rule of the aibo that made the request. The
+// transactions it already booked are left as they are until the rules are applied again.
+//
+// If the request body is invalid, it returns a 400 error. If the rule does not exist or belongs to
+// another aibo, or the import account is not one of the aibo, it returns a 404 error. If the
+// CatBud is not one the aibo may book on, it returns a 403 or 404 error.
+// @Summary Update a category rule
+// @Description Update an auto-categorization rule of the authenticated aibo
+// @Tags category-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Category rule ID"
+// @Param rule body types.UpdateCategoryRuleRequest true "Category rule update details"
+// @Success 200 {object} types.CategoryRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /category-rules/{id} [put]
+func (s *CategoryRuleService) UpdateCategoryRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateCategoryRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.PayeeContains != nil {
+		rule.PayeeContains = *req.PayeeContains
+	}
+	if req.PayeePattern != nil {
+		rule.PayeePattern = *req.PayeePattern
+	}
+	if req.NoteContains != nil {
+		rule.NoteContains = *req.NoteContains
+	}
+	if req.Kind != nil {
+		rule.Kind = *req.Kind
+	}
+	if req.ClearMinAmount {
+		rule.MinAmount = nil
+	} else if req.MinAmount != nil {
+		rule.MinAmount = req.MinAmount
+	}
+	if req.ClearMaxAmount {
+		rule.MaxAmount = nil
+	} else if req.MaxAmount != nil {
+		rule.MaxAmount = req.MaxAmount
+	}
+	if req.ClearImportAccount {
+		rule.ImportAccountID = nil
+	} else if req.ImportAccountID != nil {
+		rule.ImportAccountID = req.ImportAccountID
+	}
+	if req.ClearCatBud {
+		rule.CatBudID = nil
+	} else if req.CatBudID != nil {
+		rule.CatBudID = req.CatBudID
+	}
+	if req.Tags != nil {
+		tags, err := types.NormalizeTags(*req.Tags)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		rule.Tags = tags
+	}
+	if req.Note != nil {
+		rule.Note = *req.Note
+	}
+	if !s.checkRule(c, rule.AiboID, rule) {
+		return
+	}
+
+	if err := s.CategoryRuleRepository.UpdateRule(rule); err != nil {
+		slog.Error("Failed to update category rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update category rule"})
+		return
+	}
+
+	c.JSON(200, types.CategoryRuleResponse{Rule: *rule})
+}
+
+// DeleteCategoryRule deletes an auto-categorization rule of the aibo that made the request. The
+// transactions it booked keep their CatBud, their tags and their note.
+//
+// If the rule does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a category rule
+// @Description Delete an auto-categorization rule of the authenticated aibo
+// @Tags category-rules
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Category rule ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /category-rules/{id} [delete]
+func (s *CategoryRuleService) DeleteCategoryRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := s.CategoryRuleRepository.DeleteRule(rule); err != nil {
+		slog.Error("Failed to delete category rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete category rule"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Category rule deleted successfully"})
+}
+
+// ApplyCategoryRules applies the rules of the aibo that made the request again to its past
+// transactions, over a range of at most a year, all of them or only the given ones. The range
+// ends today and starts a year before its end by default.
+//
+// The transactions booked by a rule or imported move to the CatBud the rules book them on now,
+// unless the aibo moved them by hand since; the ones on no CatBud are booked. The transactions
+// booked by hand or by a recurring rule, and the split ones, keep their CatBud. The rules add their
+// tags and set a note on the transactions without one. The rejected transactions are left out.
+//
+// With dry_run, the changes are only previewed. Otherwise they are saved in a single database
+// transaction, and a transaction that moves is submitted for approval again if needed.
+//
+// If the request body or a date is invalid, or the range is longer than a year, it returns a 400
+// error.
+// @Summary Apply the category rules again
+// @Description Apply the auto-categorization rules of the authenticated aibo to its past transactions
+// @Tags category-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body types.ApplyCategoryRulesRequest true "Range and rules to apply"
+// @Success 200 {object} types.ApplyCategoryRulesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /category-rules/apply [post]
+func (s *CategoryRuleService) ApplyCategoryRules(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ApplyCategoryRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseDate(req.From)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+	to, err := parseDate(req.To)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid to date, expected YYYY-MM-DD"})
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+	if to.IsZero() {
+		to = utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -categoryRuleMaxApplyDays)
+	}
+	if to.Before(from) {
+		c.JSON(400, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if from.Before(to.AddDate(0, 0, -categoryRuleMaxApplyDays)) {
+		c.JSON(400, gin.H{"error": "the range must not be longer than a year"})
+		return
+	}
+
+	changes, checked, err := s.CategoryRuleRepository.ApplyRules(aiboID, req.RuleIDs, from, to, req.DryRun)
+	if err != nil {
+		slog.Error("Failed to apply category rules", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to apply category rules"})
+		return
+	}
+
+	c.JSON(200, types.ApplyCategoryRulesResponse{DryRun: req.DryRun, Checked: checked, Changes: changes})
+}
+
+// GetCategoryRuleSuggestions suggests rules to the aibo that made the request from the
+// transactions it moved to another CatBud by hand: a payee moved to the same CatBud several times
+// gets a rule booking it there, ready to be created, unless the rules already do. When a rule had
+// booked the payee elsewhere, the suggested rule gets a higher priority.
+// @Summary Suggest category rules
+// @Description Suggest auto-categorization rules from the manual corrections of the authenticated aibo
+// @Tags category-rules
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListCategoryRuleSuggestionsResponse
+// @Failure 500 {object} map[string]string
+// @Router /category-rules/suggestions [get]
+func (s *CategoryRuleService) GetCategoryRuleSuggestions(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	suggestions, err := s.CategoryRuleRepository.GetSuggestions(aiboID)
+	if err != nil {
+		slog.Error("Failed to get category rule suggestions", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get category rule suggestions"})
+		return
+	}
+
+	c.JSON(200, types.ListCategoryRuleSuggestionsResponse{Suggestions: suggestions})
+}
+
+// checkRule validates a rule, and checks that the aibo may book on its CatBud and owns its import
+// account.
+//
+// On failure, the response is already written and false is returned.
+func (s *CategoryRuleService) checkRule(c *gin.Context, aiboID uuid.UUID, rule *types.CategoryRule) bool {
+	if err := rule.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+	if rule.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *rule.CatBudID) {
+		return false
+	}
+	if rule.ImportAccountID != nil {
+		account, err := s.ImportRepository.GetAccountByID(*rule.ImportAccountID)
+		if err != nil || account.AiboID != aiboID {
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				slog.Error("Failed to get import account", "error", err)
+			}
+			c.JSON(404, gin.H{"error": "import account not found"})
+			return false
+		}
+	}
+	return true
+}
+
+// loadRule fetches the category rule designated by the ":id" path parameter and checks that it
+// belongs to the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *CategoryRuleService) loadRule(c *gin.Context) (*types.CategoryRule, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "category rule not found"})
+		return nil, false
+	}
+	rule, err := s.CategoryRuleRepository.GetRuleByID(id)
+	if err != nil || rule.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get category rule", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "category rule not found"})
+		return nil, false
+	}
+	return rule, true
+}
@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DebtService handles the debts requests and the payoff planner.
+type DebtService struct {
+	DB               *gorm.DB
+	DebtRepository   *database.DebtRepository
+	CatBudRepository *database.CatBudRepository
+	AiboRepository   *database.AiboRepository
+}
+
+// NewDebtService creates a new DebtService instance.
+//
+// The DebtService instance is configured with the provided db instance.
+func NewDebtService(db *gorm.DB) *DebtService {
+	return &DebtService{
+		DB:               db,
+		DebtRepository:   database.NewDebtRepository(db),
+		CatBudRepository: database.NewCatBudRepository(db),
+		AiboRepository:   database.NewAiboRepository(db),
+	}
+}
+
+// CreateDebt creates a debt, such as a credit card or a loan, for the aibo that made the request.
+//
+// If the request body is invalid, it returns a 400 error.
+// If the debt repayment CatBud is not visible to the aibo, it returns a 404 error. If the
+// household role of the aibo does not allow booking on it, it returns a 403 error.
+// @Summary Create a debt
+// @Description Create a debt for the authenticated aibo
+// @Tags debts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param debt body types.CreateDebtRequest true "Debt details"
+// @Success 201 {object} types.DebtResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts [post]
+func (s *DebtService) CreateDebt(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateDebtRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	debt := types.Debt{
+		ID:             utilitaries.GenerateSnowflakeID(),
+		AiboID:         aiboID,
+		Name:           req.Name,
+		Kind:           req.Kind,
+		Lender:         req.Lender,
+		Balance:        req.Balance,
+		APR:            req.APR,
+		MinimumPayment: req.MinimumPayment,
+		DueDay:         req.DueDay,
+		CatBudID:       req.CatBudID,
+	}
+	if err := debt.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if debt.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *debt.CatBudID) {
+		return
+	}
+
+	if err := s.DebtRepository.CreateDebt(&debt); err != nil {
+		slog.Error("Failed to create debt", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create debt"})
+		return
+	}
+
+	c.JSON(201, debtResponse(&debt, s.today(aiboID)))
+}
+
+// GetDebts lists the debts of the aibo that made the request, with what is owed on them.
+// @Summary List debts
+// @Description List the debts of the authenticated aibo
+// @Tags debts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListDebtsResponse
+// @Failure 500 {object} map[string]string
+// @Router /debts [get]
+func (s *DebtService) GetDebts(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	debts, err := s.DebtRepository.GetDebtsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get debts", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get debts"})
+		return
+	}
+
+	today := s.today(aiboID)
+	resp := types.ListDebtsResponse{Debts: []types.DebtResponse{}}
+	for i := range debts {
+		resp.Debts = append(resp.Debts, debtResponse(&debts[i], today))
+		resp.TotalBalance += debts[i].Balance
+		if debts[i].Balance > 0 {
+			resp.TotalMinimumPayment += debts[i].MinimumPayment
+		}
+	}
+
+	c.JSON(200, resp)
+}
+
+// GetDebtPlan compares the avalanche and the snowball strategies for paying off the debts of the
+// aibo that made the request, given an extra amount paid each month on top of the minimum
+// payments: payoff date, total interest and month by month schedule of each strategy.
+//
+// If the query is invalid, it returns a 400 error.
+// @Summary Plan the payoff of the debts
+// @Description Compare the avalanche and snowball payoff strategies for the debts of the authenticated aibo
+// @Tags debts
+// @Produce json
+// @Security BearerAuth
+// @Param extra_payment query string false "Amount paid each month on top of the minimum payments"
+// @Success 200 {object} types.DebtPlanComparison
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts/plan [get]
+func (s *DebtService) GetDebtPlan(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.DebtPlanRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	debts, err := s.DebtRepository.GetDebtsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get debts", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to plan debt payoff"})
+		return
+	}
+
+	c.JSON(200, types.CompareDebtStrategies(debts, req.ExtraPayment, s.today(aiboID)))
+}
+
+// GetDebt returns a debt of the aibo that made the request.
+//
+// If the debt does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Get a debt
+// @Description Get a debt of the authenticated aibo
+// @Tags debts
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Debt ID"
+// @Success 200 {object} types.DebtResponse
+// @Failure 404 {object} map[string]string
+// @Router /debts/{id} [get]
+func (s *DebtService) GetDebt(c *gin.Context) {
+	debt, ok := s.loadDebt(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, debtResponse(debt, s.today(debt.AiboID)))
+}
+
+// UpdateDebt updates a debt of the aibo that made the request. Setting the balance from a
+// statement accounts for the interest and the new charges since the last payment.
+//
+// Only the provided fields are changed.
+//
+// If the request body is invalid, it returns a 400 error.
+// If the debt or the new debt repayment CatBud does not exist or is not visible to the aibo, it
+// returns a 404 error. If the household role of the aibo does not allow booking on the CatBud, it
+// returns a 403 error.
+// @Summary Update a debt
+// @Description Update a debt of the authenticated aibo
+// @Tags debts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Debt ID"
+// @Param debt body types.UpdateDebtRequest true "Debt update details"
+// @Success 200 {object} types.DebtResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts/{id} [put]
+func (s *DebtService) UpdateDebt(c *gin.Context) {
+	debt, ok := s.loadDebt(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateDebtRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		debt.Name = req.Name
+	}
+	if req.Kind != "" {
+		debt.Kind = req.Kind
+	}
+	if req.Lender != nil {
+		debt.Lender = *req.Lender
+	}
+	if req.Balance != nil {
+		debt.Balance = *req.Balance
+	}
+	if req.APR != nil {
+		debt.APR = *req.APR
+	}
+	if req.MinimumPayment != nil {
+		debt.MinimumPayment = *req.MinimumPayment
+	}
+	if req.DueDay != nil {
+		debt.DueDay = *req.DueDay
+	}
+	if req.CatBudID != nil {
+		if !canBookOnCatBud(c, s.CatBudRepository, debt.AiboID, *req.CatBudID) {
+			return
+		}
+		debt.CatBudID = req.CatBudID
+	}
+	if req.UnlinkCatBud {
+		debt.CatBudID = nil
+	}
+
+	if err := debt.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.DebtRepository.UpdateDebt(debt); err != nil {
+		slog.Error("Failed to update debt", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update debt"})
+		return
+	}
+
+	c.JSON(200, debtResponse(debt, s.today(debt.AiboID)))
+}
+
+// DeleteDebt deletes a debt of the aibo that made the request.
+//
+// The ledger transactions recorded for its payments are kept.
+//
+// If the debt does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a debt
+// @Description Delete a debt of the authenticated aibo
+// @Tags debts
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Debt ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts/{id} [delete]
+func (s *DebtService) DeleteDebt(c *gin.Context) {
+	debt, ok := s.loadDebt(c)
+	if !ok {
+		return
+	}
+
+	if err := s.DebtRepository.DeleteDebt(debt); err != nil {
+		slog.Error("Failed to delete debt", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete debt"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Debt deleted successfully"})
+}
+
+// GetDebtPayments lists the payments of a debt of the aibo that made the request.
+//
+// If the debt does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary List debt payments
+// @Description List the payments of a debt
+// @Tags debts
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Debt ID"
+// @Success 200 {object} types.ListDebtPaymentsResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts/{id}/payments [get]
+func (s *DebtService) GetDebtPayments(c *gin.Context) {
+	debt, ok := s.loadDebt(c)
+	if !ok {
+		return
+	}
+
+	payments, err := s.DebtRepository.GetPayments(debt.ID)
+	if err != nil {
+		slog.Error("Failed to get debt payments", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get debt payments"})
+		return
+	}
+
+	c.JSON(200, types.ListDebtPaymentsResponse{Payments: payments})
+}
+
+// CreateDebtPayment records a payment on a debt of the aibo that made the request and lowers its
+// balance.
+//
+// When the debt is linked to a debt repayment CatBud, the payment is also booked on it in the
+// ledger.
+//
+// If the request body is invalid, or the payment is larger than the balance, it returns a 400
+// error. If the debt does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Pay a debt
+// @Description Record a payment on a debt
+// @Tags debts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Debt ID"
+// @Param payment body types.CreateDebtPaymentRequest true "Payment details"
+// @Success 201 {object} types.DebtResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts/{id}/payments [post]
+func (s *DebtService) CreateDebtPayment(c *gin.Context) {
+	debt, ok := s.loadDebt(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateDebtPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	date, err := parseDate(req.Date)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if date.IsZero() {
+		date = s.today(debt.AiboID)
+	}
+
+	payment := types.DebtPayment{
+		ID:     utilitaries.GenerateSnowflakeID(),
+		Amount: req.Amount,
+		Date:   date,
+		Note:   req.Note,
+	}
+
+	err = s.DebtRepository.AddPayment(debt, &payment)
+	if errors.Is(err, database.ErrPaymentExceedsBalance) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create debt payment", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create debt payment"})
+		return
+	}
+
+	s.respondWithDebt(c, 201, debt.ID)
+}
+
+// DeleteDebtPayment removes a payment from a debt of the aibo that made the request, along with
+// its ledger transaction, and gives its amount back to the balance.
+//
+// If the debt or the payment does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a debt payment
+// @Description Remove a payment from a debt
+// @Tags debts
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Debt ID"
+// @Param paymentId path string true "Payment ID"
+// @Success 200 {object} types.DebtResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /debts/{id}/payments/{paymentId} [delete]
+func (s *DebtService) DeleteDebtPayment(c *gin.Context) {
+	debt, ok := s.loadDebt(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("paymentId"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "payment not found"})
+		return
+	}
+
+	payment, err := s.DebtRepository.GetPaymentByID(id)
+	if err != nil || payment.DebtID != debt.ID {
+		c.JSON(404, gin.H{"error": "payment not found"})
+		return
+	}
+
+	if err := s.DebtRepository.DeletePayment(debt, payment); err != nil {
+		slog.Error("Failed to delete debt payment", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete debt payment"})
+		return
+	}
+
+	s.respondWithDebt(c, 200, debt.ID)
+}
+
+// loadDebt fetches the debt designated by the ":id" path parameter and checks that it belongs to
+// the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *DebtService) loadDebt(c *gin.Context) (*types.Debt, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "debt not found"})
+		return nil, false
+	}
+
+	debt, err := s.DebtRepository.GetDebtByID(id)
+	if err != nil || debt.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get debt", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "debt not found"})
+		return nil, false
+	}
+
+	return debt, true
+}
+
+// respondWithDebt writes the debt, as freshly read from the database.
+func (s *DebtService) respondWithDebt(c *gin.Context, status int, id snowflake.ID) {
+	debt, err := s.DebtRepository.GetDebtByID(id)
+	if err != nil {
+		slog.Error("Failed to get debt", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get debt"})
+		return
+	}
+
+	c.JSON(status, debtResponse(debt, s.today(debt.AiboID)))
+}
+
+// today returns the current day in the timezone of the aibo, or in UTC if it cannot be loaded.
+func (s *DebtService) today(aiboID uuid.UUID) time.Time {
+	loc := time.UTC
+	if aibo, err := s.AiboRepository.GetAiboByID(aiboID.String()); err == nil {
+		loc = utilitaries.LoadLocation(aibo.Timezone)
+	}
+	return utilitaries.LocalDate(time.Now(), loc)
+}
+
+// debtResponse describes the debt with its next due date and the interest it accrues.
+func debtResponse(debt *types.Debt, today time.Time) types.DebtResponse {
+	resp := types.DebtResponse{Debt: *debt, MonthlyInterest: debt.MonthlyInterest(debt.Balance)}
+	if debt.Balance > 0 {
+		due := debt.NextDueDate(today)
+		resp.NextDueDate = &due
+	}
+	return resp
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxExchangeRatesFileSize is the largest file of exchange rates accepted by the import, in bytes.
+const maxExchangeRatesFileSize = 5 << 20
+
+// exchangeRateColumns are the columns expected in the header of an exchange rates CSV file.
+var exchangeRateColumns = []string{"date", "base", "quote", "rate"}
+
+// ExchangeRateService handles the currency and exchange rates requests.
+type ExchangeRateService struct {
+	DB             *gorm.DB
+	RateRepository *database.ExchangeRateRepository
+}
+
+// NewExchangeRateService creates a new ExchangeRateService instance.
+//
+// The ExchangeRateService instance is configured with the provided db instance.
+func NewExchangeRateService(db *gorm.DB) *ExchangeRateService {
+	return &ExchangeRateService{
+		DB:             db,
+		RateRepository: database.NewExchangeRateRepository(db),
+	}
+}
+
+// ImportExchangeRates imports the exchange rates of an uploaded CSV file.
+//
+// The rates are shared by every Aibo, so only an administrator can import them. The file must
+// have a header with the date, base, quote and rate columns, in any order. A rate already stored
+// for the same pair and day is replaced, and the transactions it applies to are converted again
+// in the background.
+//
+// If the file is missing, malformed or larger than 5 MB, it returns a 400 error.
+// @Summary Import exchange rates
+// @Description Import historical exchange rates from a CSV file (columns: date, base, quote, rate), administrators only
+// @Tags currencies
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV file of exchange rates"
+// @Success 200 {object} types.ImportExchangeRatesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exchange-rates/import [post]
+func (s *ExchangeRateService) ImportExchangeRates(c *gin.Context) {
+	data, _, ok := readImportFile(c, maxExchangeRatesFileSize)
+	if !ok {
+		return
+	}
+
+	rates, err := parseExchangeRatesCSV(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	imported, err := s.RateRepository.ImportRates(rates)
+	if err != nil {
+		slog.Error("Failed to import exchange rates", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to import exchange rates"})
+		return
+	}
+
+	c.JSON(200, types.ImportExchangeRatesResponse{Imported: imported})
+}
+
+// GetExchangeRates lists the stored rates of a currency pair.
+//
+// If a query parameter is invalid, it returns a 400 error.
+// @Summary List exchange rates
+// @Description List the historical rates of a currency pair
+// @Tags currencies
+// @Produce json
+// @Security BearerAuth
+// @Param base query string true "Currency being priced (ISO 4217)"
+// @Param quote query string true "Currency the price is expressed in (ISO 4217)"
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Success 200 {object} types.ListExchangeRatesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exchange-rates [get]
+func (s *ExchangeRateService) GetExchangeRates(c *gin.Context) {
+	var req types.ListExchangeRatesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.Base.IsValid() || !req.Quote.IsValid() {
+		c.JSON(400, gin.H{"error": "base and quote must be ISO 4217 currency codes"})
+		return
+	}
+
+	from, err := parseDate(req.From)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid from date format"})
+		return
+	}
+	to, err := parseDate(req.To)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid to date format"})
+		return
+	}
+
+	rates, err := s.RateRepository.GetRates(req.Base, req.Quote, from, to)
+	if err != nil {
+		slog.Error("Failed to get exchange rates", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get exchange rates"})
+		return
+	}
+
+	c.JSON(200, types.ListExchangeRatesResponse{ExchangeRates: rates})
+}
+
+// ConvertAmount converts an amount between two currencies at the rate in effect on a day.
+//
+// If a query parameter is invalid or no rate is available, it returns a 400 error.
+// @Summary Convert an amount
+// @Description Convert an amount between two currencies with the imported exchange rates
+// @Tags currencies
+// @Produce json
+// @Security BearerAuth
+// @Param amount query number true "Amount to convert"
+// @Param from query string true "Currency of the amount (ISO 4217)"
+// @Param to query string true "Currency to convert into (ISO 4217)"
+// @Param date query string false "Day whose rate is used (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} types.ConvertResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exchange-rates/convert [get]
+func (s *ExchangeRateService) ConvertAmount(c *gin.Context) {
+	var req types.ConvertRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.From.IsSupported() || !req.To.IsSupported() {
+		c.JSON(400, gin.H{"error": "from and to must be ISO 4217 currency codes with two decimals"})
+		return
+	}
+
+	day, err := parseDate(req.Date)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if day.IsZero() {
+		day = utilitaries.LocalDate(time.Now(), time.UTC)
+	}
+
+	amount, rate, err := s.RateRepository.Convert(req.Amount, req.From, req.To, day)
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to convert amount", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to convert amount"})
+		return
+	}
+
+	c.JSON(200, types.ConvertResponse{Amount: amount, Currency: req.To, Rate: rate})
+}
+
+// parseExchangeRatesCSV reads exchange rates from a CSV file with a date, base, quote and
+// rate header. Errors mention the faulty line.
+func parseExchangeRatesCSV(r io.Reader) ([]types.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the file is empty or is not a CSV file")
+	}
+
+	index := map[string]int{}
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range exchangeRateColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing %q column", column)
+		}
+	}
+
+	rates := []types.ExchangeRate{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		date, err := time.Parse("2006-01-02", record[index["date"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date", line)
+		}
+		value, err := strconv.ParseFloat(record[index["rate"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate", line)
+		}
+
+		rate := types.ExchangeRate{
+			ID:    utilitaries.GenerateSnowflakeID(),
+			Base:  types.Currency(strings.ToUpper(record[index["base"]])),
+			Quote: types.Currency(strings.ToUpper(record[index["quote"]])),
+			Date:  date,
+			Rate:  value,
+		}
+		if err := rate.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExchangeRatesCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    int
+		wantErr string
+	}{
+		{"rates", "date,base,quote,rate\n2024-01-02,EUR,USD,1.0945\n2024-01-02,eur,jpy,155.7\n", 2, ""},
+		{"reordered columns", "Rate, Quote, Base, Date\n0.8612,GBP,EUR,2024-01-02\n", 1, ""},
+		{"no rows", "date,base,quote,rate\n", 0, ""},
+		{"empty", "", 0, "empty"},
+		{"missing column", "date,base,rate\n2024-01-02,EUR,1.09\n", 0, `missing "quote" column`},
+		{"invalid date", "date,base,quote,rate\n02/01/2024,EUR,USD,1.09\n", 0, "line 2: invalid date"},
+		{"invalid rate", "date,base,quote,rate\n2024-01-02,EUR,USD,1,09\n", 0, "line 2"},
+		{"unknown currency", "date,base,quote,rate\n2024-01-02,EUR,USD,1.09\n2024-01-03,EUR,ABC,1.09\n", 0, "line 3: base and quote"},
+		{"zero rate", "date,base,quote,rate\n2024-01-02,EUR,USD,0\n", 0, "line 2: rate must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := parseExchangeRatesCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExchangeRatesCSV: %v", err)
+			}
+			if len(rates) != tt.want {
+				t.Fatalf("parsed %d rates, want %d", len(rates), tt.want)
+			}
+		})
+	}
+
+	rates, err := parseExchangeRatesCSV(strings.NewReader("date,base,quote,rate\n2024-01-02,eur,jpy,155.7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rates[0]
+	if got.Base != "EUR" || got.Quote != "JPY" || got.Rate != 155.7 || !got.Date.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) || got.ID == 0 {
+		t.Fatalf("rate = %+v", got)
+	}
+}
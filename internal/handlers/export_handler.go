@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/exports"
+	"aibo/internal/types"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportService handles the exports of the transactions and the CatBuds.
+type ExportService struct {
+	DB                  *gorm.DB
+	ExportRepository    *database.ExportRepository
+	AnalyticsRepository *database.AnalyticsRepository
+	AiboRepository      *database.AiboRepository
+	HouseholdRepository *database.HouseholdRepository
+}
+
+// NewExportService creates a new ExportService instance.
+//
+// The ExportService instance is configured with the provided db instance.
+func NewExportService(db *gorm.DB) *ExportService {
+	return &ExportService{
+		DB:                  db,
+		ExportRepository:    database.NewExportRepository(db),
+		AnalyticsRepository: database.NewAnalyticsRepository(db),
+		AiboRepository:      database.NewAiboRepository(db),
+		HouseholdRepository: database.NewHouseholdRepository(db),
+	}
+}
+
+// ExportTransactions exports the transactions of the aibo that made the request over a range, as
+// a CSV, JSON Lines or XLSX file, one row per transaction and one per line of a split
+// transaction, whatever their status. With household_id, the export covers the amounts booked on
+// the CatBuds shared by the household, by any of its members.
+//
+// The rows are streamed from the database to the response, so that a long history is never held
+// in memory. The columns are the ones asked for, in their order. With a locale, the CSV amounts
+// are written with its decimal separator and its field delimiter, and the dates in its order, in
+// CSV and XLSX alike.
+//
+// If a query parameter is invalid, or the range holds more rows than a spreadsheet for an XLSX
+// export, it returns a 400 error. If the aibo is not a member of the household, it returns a 404
+// error.
+// @Summary Export transactions
+// @Description Transactions over a range as CSV, JSON Lines or XLSX, one row per transaction or split line
+// @Tags exports
+// @Produce text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,json
+// @Security BearerAuth
+// @Param format query string false "csv (default), jsonl or xlsx"
+// @Param from query string false "First day of the range (YYYY-MM-DD)"
+// @Param to query string false "Last day of the range (YYYY-MM-DD)"
+// @Param columns query string false "Comma-separated columns, in order"
+// @Param locale query string false "Locale of the numbers and dates, such as en-US or de-DE"
+// @Param household_id query string false "Export the amounts booked on the CatBuds shared by this household"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exports/transactions [get]
+func (s *ExportService) ExportTransactions(c *gin.Context) {
+	var req types.ExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	columns, locale, ok := parseExport(c, &req, exports.TransactionColumns)
+	if !ok {
+		return
+	}
+	scope, from, to, ok := reportRange(c, s.AiboRepository, s.HouseholdRepository, req.From, req.To, req.HouseholdID)
+	if !ok {
+		return
+	}
+
+	if req.Format == types.ExportXLSX {
+		count, err := s.ExportRepository.CountTransactions(scope, from, to)
+		if err != nil {
+			slog.Error("Failed to count transactions", "error", err)
+			c.JSON(500, gin.H{"error": "Failed to export transactions"})
+			return
+		}
+		if count > exports.MaxSpreadsheetRows {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("the range holds %d rows, more than the %d of a spreadsheet: narrow it or export as csv", count, exports.MaxSpreadsheetRows)})
+			return
+		}
+	}
+
+	writer, ok := startExport(c, "transactions", req.Format, columns, locale, from, to)
+	if !ok {
+		return
+	}
+	err := s.ExportRepository.StreamTransactions(scope, from, to, func(line *types.ExportTransaction) error {
+		return writer.WriteRow(exports.TransactionValues(line, columns))
+	})
+	finishExport(c, "transactions", writer, err)
+}
+
+// ExportCatBuds exports the CatBuds the aibo that made the request can see as a CSV, JSON Lines
+// or XLSX file, one row per CatBud, with its budget pro-rated over a range and what was actually
+// spent on it, as in the budget versus actual report. With household_id, only the CatBuds shared
+// by the household are exported.
+//
+// The columns and the locale work as for the transactions export.
+//
+// If a query parameter is invalid, it returns a 400 error. If the aibo is not a member of the
+// household, it returns a 404 error.
+// @Summary Export CatBuds
+// @Description CatBuds with their budget and actual spending over a range as CSV, JSON Lines or XLSX
+// @Tags exports
+// @Produce text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,json
+// @Security BearerAuth
+// @Param format query string false "csv (default), jsonl or xlsx"
+// @Param from query string false "First day of the range (YYYY-MM-DD)"
+// @Param to query string false "Last day of the range (YYYY-MM-DD)"
+// @Param columns query string false "Comma-separated columns, in order"
+// @Param locale query string false "Locale of the numbers and dates, such as en-US or de-DE"
+// @Param household_id query string false "Only export the CatBuds shared by this household"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exports/catbuds [get]
+func (s *ExportService) ExportCatBuds(c *gin.Context) {
+	var req types.ExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	columns, locale, ok := parseExport(c, &req, exports.CatBudColumns)
+	if !ok {
+		return
+	}
+	scope, from, to, ok := reportRange(c, s.AiboRepository, s.HouseholdRepository, req.From, req.To, req.HouseholdID)
+	if !ok {
+		return
+	}
+
+	report, err := s.AnalyticsRepository.GetBudgetReport(scope, from, to)
+	if err != nil {
+		slog.Error("Failed to get budget report", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to export cat buds"})
+		return
+	}
+	groups := make(map[snowflake.ID]string, len(report.CatBuds))
+	for _, line := range report.CatBuds {
+		groups[line.CatBudID] = line.Category
+	}
+
+	writer, ok := startExport(c, "catbuds", req.Format, columns, locale, from, to)
+	if !ok {
+		return
+	}
+	for i := range report.CatBuds {
+		if err = writer.WriteRow(exports.CatBudValues(&report.CatBuds[i], groups, columns)); err != nil {
+			break
+		}
+	}
+	finishExport(c, "cat buds", writer, err)
+}
+
+// parseExport checks the format of an export, defaulting to CSV, and returns its columns and
+// locale.
+//
+// On failure, a 400 error is written and false is returned.
+func parseExport(c *gin.Context, req *types.ExportRequest, available []exports.Column) ([]exports.Column, exports.Locale, bool) {
+	if req.Format == "" {
+		req.Format = types.ExportCSV
+	}
+	if !req.Format.IsValid() {
+		c.JSON(400, gin.H{"error": "format must be one of csv, jsonl or xlsx"})
+		return nil, exports.Locale{}, false
+	}
+	columns, err := exports.SelectColumns(available, req.Columns)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, exports.Locale{}, false
+	}
+	locale, ok := exports.LookupLocale(req.Locale)
+	if !ok {
+		c.JSON(400, gin.H{"error": "locale must be one of " + strings.Join(exports.Locales(), ", ")})
+		return nil, exports.Locale{}, false
+	}
+	return columns, locale, true
+}
+
+// startExport sets the headers of the file of an export, named after its range, and starts
+// writing it.
+//
+// On failure, a 500 error is written and false is returned.
+func startExport(c *gin.Context, name string, format types.ExportFormat, columns []exports.Column, locale exports.Locale, from, to time.Time) (exports.Writer, bool) {
+	c.Header("Content-Type", exports.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.%s"`, name, from.Format("2006-01-02"), to.Format("2006-01-02"), format))
+	c.Status(200)
+
+	writer, err := exports.NewWriter(format, c.Writer, columns, locale)
+	if err != nil {
+		slog.Error("Failed to start export", "error", err)
+		clearExportHeaders(c)
+		c.JSON(500, gin.H{"error": "Failed to start export"})
+		return nil, false
+	}
+	return writer, true
+}
+
+// finishExport ends the file of an export, given the error the rows were written with, if any.
+//
+// When the rows fail before anything reached the client, a 500 error is written instead of the
+// file. Past that point, the file is cut short and the failure is only logged.
+func finishExport(c *gin.Context, name string, writer exports.Writer, err error) {
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		return
+	}
+
+	slog.Error("Failed to export "+name, "error", err)
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+	clearExportHeaders(c)
+	c.JSON(500, gin.H{"error": "Failed to export " + name})
+}
+
+// clearExportHeaders removes the headers of the file of an export, before an error is written
+// instead.
+func clearExportHeaders(c *gin.Context) {
+	c.Header("Content-Type", "")
+	c.Header("Content-Disposition", "")
+}
@@ -0,0 +1,680 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// HouseholdService handles the shared household budgets, their members and invitations.
+type HouseholdService struct {
+	DB                  *gorm.DB
+	HouseholdRepository *database.HouseholdRepository
+	CatBudRepository    *database.CatBudRepository
+	AiboRepository      *database.AiboRepository
+}
+
+// NewHouseholdService creates a new HouseholdService instance.
+//
+// The HouseholdService instance is configured with the provided db instance.
+func NewHouseholdService(db *gorm.DB) *HouseholdService {
+	return &HouseholdService{
+		DB:                  db,
+		HouseholdRepository: database.NewHouseholdRepository(db),
+		CatBudRepository:    database.NewCatBudRepository(db),
+		AiboRepository:      database.NewAiboRepository(db),
+	}
+}
+
+// CreateHousehold creates a household with the aibo that made the request as its owner. The
+// household is in the base currency of the aibo unless the request gives another currency.
+//
+// If the request body is invalid, it returns a 400 error.
+// @Summary Create a household
+// @Description Create a shared household budget owned by the authenticated aibo
+// @Tags households
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param household body types.CreateHouseholdRequest true "Household details"
+// @Success 201 {object} types.HouseholdResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households [post]
+func (s *HouseholdService) CreateHousehold(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateHouseholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Currency != "" && !req.Currency.IsSupported() {
+		c.JSON(400, gin.H{"error": "currency must be an ISO 4217 currency code with two decimals"})
+		return
+	}
+
+	household := types.Household{ID: uuid.New(), Name: req.Name, Currency: req.Currency}
+	if err := s.HouseholdRepository.CreateHousehold(&household, aiboID); err != nil {
+		slog.Error("Failed to create household", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create household"})
+		return
+	}
+
+	c.JSON(201, types.HouseholdResponse{Household: household})
+}
+
+// GetHouseholds lists the households the aibo that made the request is a member of.
+// @Summary List households
+// @Description List the households of the authenticated aibo, with their members
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListHouseholdsResponse
+// @Failure 500 {object} map[string]string
+// @Router /households [get]
+func (s *HouseholdService) GetHouseholds(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	households, err := s.HouseholdRepository.GetHouseholdsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get households", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get households"})
+		return
+	}
+
+	c.JSON(200, types.ListHouseholdsResponse{Households: households})
+}
+
+// GetHousehold returns a household of the aibo that made the request, with its members.
+//
+// If the aibo is not a member of the household, it returns a 404 error.
+// @Summary Get a household
+// @Description Get a household of the authenticated aibo with its members
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Success 200 {object} types.HouseholdResponse
+// @Failure 404 {object} map[string]string
+// @Router /households/{id} [get]
+func (s *HouseholdService) GetHousehold(c *gin.Context) {
+	household, _, ok := s.loadHousehold(c, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, types.HouseholdResponse{Household: *household})
+}
+
+// UpdateHousehold renames a household or changes its currency. It takes the owner role.
+//
+// If the request body is invalid, or a rate is missing to convert the shared amounts into the new
+// currency, it returns a 400 error. If the aibo is not a member of the household, it returns a 404
+// error. If it is not an owner, it returns a 403 error.
+// @Summary Update a household
+// @Description Rename a household of the authenticated aibo or change its currency
+// @Tags households
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param household body types.UpdateHouseholdRequest true "Household update details"
+// @Success 200 {object} types.HouseholdResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id} [put]
+func (s *HouseholdService) UpdateHousehold(c *gin.Context) {
+	household, _, ok := s.loadHousehold(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateHouseholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Currency != "" {
+		if !req.Currency.IsSupported() {
+			c.JSON(400, gin.H{"error": "currency must be an ISO 4217 currency code with two decimals"})
+			return
+		}
+		household.Currency = req.Currency
+	}
+
+	household.Name = req.Name
+	err := s.HouseholdRepository.UpdateHousehold(household)
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to update household", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update household"})
+		return
+	}
+
+	c.JSON(200, types.HouseholdResponse{Household: *household})
+}
+
+// DeleteHousehold deletes a household. It takes the owner role.
+//
+// The CatBuds of the household become personal CatBuds of the owner deleting it, and the other
+// members lose access to them.
+//
+// If the aibo is not a member of the household, it returns a 404 error. If it is not an owner,
+// it returns a 403 error.
+// @Summary Delete a household
+// @Description Delete a household, its CatBuds become personal CatBuds of the owner
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id} [delete]
+func (s *HouseholdService) DeleteHousehold(c *gin.Context) {
+	household, aiboID, ok := s.loadHousehold(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := s.HouseholdRepository.DeleteHousehold(household, aiboID); err != nil {
+		slog.Error("Failed to delete household", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete household"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Household deleted successfully"})
+}
+
+// GetHouseholdCatBuds returns the CatBuds shared by a household as a tree of categories and
+// subcategories, with their rolled-up amounts.
+//
+// If the aibo is not a member of the household, it returns a 404 error.
+// @Summary List the CatBuds of a household
+// @Description List the CatBuds shared by a household of the authenticated aibo
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Success 200 {object} types.GetCatBudsResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/catbuds [get]
+func (s *HouseholdService) GetHouseholdCatBuds(c *gin.Context) {
+	household, _, ok := s.loadHousehold(c, types.RoleViewer)
+	if !ok {
+		return
+	}
+
+	catBuds, err := s.CatBudRepository.GetCatBudsByHouseholdID(household.ID)
+	if err != nil {
+		slog.Error("Failed to get cat buds", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get cat buds"})
+		return
+	}
+
+	c.JSON(200, types.GetCatBudsResponse{CatBuds: types.BuildCatBudTree(catBuds)})
+}
+
+// UpdateMember changes the role of a member of a household. It takes the owner role.
+//
+// If the request body is invalid, it returns a 400 error, as well as when the last owner would lose
+// the owner role. If the aibo or the member is not a member of the household, it returns a 404
+// error. If the aibo is not an owner, it returns a 403 error.
+// @Summary Change the role of a member
+// @Description Change the role of a member of a household
+// @Tags households
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param aiboId path string true "Member aibo ID"
+// @Param member body types.UpdateMemberRequest true "New role"
+// @Success 200 {object} types.HouseholdMemberResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/members/{aiboId} [put]
+func (s *HouseholdService) UpdateMember(c *gin.Context) {
+	household, _, ok := s.loadHousehold(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("aiboId"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "member not found"})
+		return
+	}
+
+	var req types.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Role.IsValid() {
+		c.JSON(400, gin.H{"error": "role must be one of owner, editor or viewer"})
+		return
+	}
+
+	member, err := s.HouseholdRepository.UpdateMemberRole(household.ID, memberID, req.Role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "member not found"})
+		return
+	}
+	if errors.Is(err, database.ErrLastOwner) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to update household member", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update household member"})
+		return
+	}
+
+	c.JSON(200, types.HouseholdMemberResponse{Member: *member})
+}
+
+// RemoveMember removes a member from a household. Owners can remove any member, and any member
+// can leave the household by removing itself.
+//
+// The shared CatBuds held by the member are handed over to an owner of the household.
+//
+// If the last owner would leave, it returns a 400 error. If the aibo or the member is not a member
+// of the household, it returns a 404 error. If the aibo removes someone else without being an
+// owner, it returns a 403 error.
+// @Summary Remove a member
+// @Description Remove a member from a household, or leave it
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param aiboId path string true "Member aibo ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/members/{aiboId} [delete]
+func (s *HouseholdService) RemoveMember(c *gin.Context) {
+	memberID, err := uuid.Parse(c.Param("aiboId"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "member not found"})
+		return
+	}
+
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+	required := types.RoleOwner
+	if aiboID == memberID {
+		required = types.RoleViewer
+	}
+
+	household, _, ok := s.loadHousehold(c, required)
+	if !ok {
+		return
+	}
+
+	err = s.HouseholdRepository.RemoveMember(household.ID, memberID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "member not found"})
+		return
+	}
+	if errors.Is(err, database.ErrLastOwner) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to remove household member", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to remove household member"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Member removed successfully"})
+}
+
+// CreateInvitation invites an email address to join a household. It takes the owner role.
+//
+// The invitation is emailed to the invitee by jobs.InvitationEmailJob. The invitee sees it once
+// signed in with that email, and can accept or decline it within types.InvitationTTL.
+//
+// If the request body is invalid, it returns a 400 error. If the aibo is not a member of the
+// household, it returns a 404 error. If it is not an owner, it returns a 403 error. If the email
+// belongs to a member or already has a pending invitation, it returns a 409 error.
+// @Summary Invite someone to a household
+// @Description Invite an email address to join a household with a role
+// @Tags households
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param invitation body types.CreateInvitationRequest true "Invitation details"
+// @Success 201 {object} types.InvitationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/invitations [post]
+func (s *HouseholdService) CreateInvitation(c *gin.Context) {
+	household, aiboID, ok := s.loadHousehold(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var req types.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = types.RoleEditor
+	}
+	if !req.Role.IsValid() {
+		c.JSON(400, gin.H{"error": "role must be one of owner, editor or viewer"})
+		return
+	}
+
+	invitation := types.HouseholdInvitation{
+		ID:            utilitaries.GenerateSnowflakeID(),
+		HouseholdID:   household.ID,
+		HouseholdName: household.Name,
+		Email:         req.Email,
+		Role:          req.Role,
+		InvitedBy:     aiboID,
+		Status:        types.InvitationPending,
+		ExpiresAt:     time.Now().Add(types.InvitationTTL),
+	}
+
+	err := s.HouseholdRepository.CreateInvitation(&invitation)
+	if errors.Is(err, database.ErrAlreadyMember) || errors.Is(err, database.ErrAlreadyInvited) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create invitation", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	c.JSON(201, types.InvitationResponse{Invitation: invitation})
+}
+
+// GetHouseholdInvitations lists the invitations sent for a household. It takes the owner role.
+//
+// If the aibo is not a member of the household, it returns a 404 error. If it is not an owner,
+// it returns a 403 error.
+// @Summary List the invitations of a household
+// @Description List the invitations sent for a household, most recent first
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Success 200 {object} types.ListInvitationsResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/invitations [get]
+func (s *HouseholdService) GetHouseholdInvitations(c *gin.Context) {
+	household, _, ok := s.loadHousehold(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	invitations, err := s.HouseholdRepository.GetInvitationsByHouseholdID(household.ID)
+	if err != nil {
+		slog.Error("Failed to get invitations", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get invitations"})
+		return
+	}
+
+	c.JSON(200, types.ListInvitationsResponse{Invitations: invitations})
+}
+
+// RevokeInvitation withdraws a pending invitation of a household. It takes the owner role.
+//
+// If the invitation is no longer pending, it returns a 409 error. If the aibo is not a member of
+// the household or the invitation is not one of the household, it returns a 404 error. If the
+// aibo is not an owner, it returns a 403 error.
+// @Summary Revoke an invitation
+// @Description Withdraw a pending invitation of a household
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Household ID"
+// @Param invitationId path string true "Invitation ID"
+// @Success 200 {object} types.InvitationResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /households/{id}/invitations/{invitationId} [delete]
+func (s *HouseholdService) RevokeInvitation(c *gin.Context) {
+	household, _, ok := s.loadHousehold(c, types.RoleOwner)
+	if !ok {
+		return
+	}
+
+	invitation, ok := s.loadInvitation(c, c.Param("invitationId"))
+	if !ok {
+		return
+	}
+	if invitation.HouseholdID != household.ID {
+		c.JSON(404, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	s.respondToInvitation(c, invitation, s.HouseholdRepository.RevokeInvitation)
+}
+
+// GetInvitations lists the pending invitations sent to the email of the aibo that made the request.
+// @Summary List my invitations
+// @Description List the pending household invitations of the authenticated aibo
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListInvitationsResponse
+// @Failure 500 {object} map[string]string
+// @Router /invitations [get]
+func (s *HouseholdService) GetInvitations(c *gin.Context) {
+	aibo, ok := s.currentAibo(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := s.HouseholdRepository.GetPendingInvitationsByEmail(aibo.Email, time.Now())
+	if err != nil {
+		slog.Error("Failed to get invitations", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get invitations"})
+		return
+	}
+
+	c.JSON(200, types.ListInvitationsResponse{Invitations: invitations})
+}
+
+// AcceptInvitation makes the aibo that made the request a member of the household it was invited
+// to, with the role of the invitation.
+//
+// If the invitation was not sent to the email of the aibo, it returns a 404 error. If it was
+// already answered, revoked or expired, or the aibo is already a member, it returns a 409 error.
+// @Summary Accept an invitation
+// @Description Join a household by accepting an invitation
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Invitation ID"
+// @Success 200 {object} types.InvitationResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /invitations/{id}/accept [post]
+func (s *HouseholdService) AcceptInvitation(c *gin.Context) {
+	invitation, aibo, ok := s.loadOwnInvitation(c)
+	if !ok {
+		return
+	}
+
+	s.respondToInvitation(c, invitation, func(invitation *types.HouseholdInvitation) error {
+		return s.HouseholdRepository.AcceptInvitation(invitation, aibo.ID)
+	})
+}
+
+// DeclineInvitation refuses an invitation sent to the aibo that made the request.
+//
+// If the invitation was not sent to the email of the aibo, it returns a 404 error. If it was
+// already answered, revoked or expired, it returns a 409 error.
+// @Summary Decline an invitation
+// @Description Refuse a household invitation
+// @Tags households
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Invitation ID"
+// @Success 200 {object} types.InvitationResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /invitations/{id}/decline [post]
+func (s *HouseholdService) DeclineInvitation(c *gin.Context) {
+	invitation, _, ok := s.loadOwnInvitation(c)
+	if !ok {
+		return
+	}
+
+	s.respondToInvitation(c, invitation, s.HouseholdRepository.DeclineInvitation)
+}
+
+// respondToInvitation applies an answer to an invitation and writes the updated invitation.
+func (s *HouseholdService) respondToInvitation(c *gin.Context, invitation *types.HouseholdInvitation, answer func(*types.HouseholdInvitation) error) {
+	err := answer(invitation)
+	if errors.Is(err, database.ErrInvitationClosed) || errors.Is(err, database.ErrAlreadyMember) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to answer invitation", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to answer invitation"})
+		return
+	}
+
+	c.JSON(200, types.InvitationResponse{Invitation: *invitation})
+}
+
+// loadHousehold fetches the household designated by the ":id" path parameter and checks that the
+// aibo that made the request is a member with at least the required role.
+//
+// On failure, the response is already written and false is returned.
+func (s *HouseholdService) loadHousehold(c *gin.Context, required types.HouseholdRole) (*types.Household, uuid.UUID, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "household not found"})
+		return nil, uuid.Nil, false
+	}
+
+	if !hasHouseholdRole(c, s.HouseholdRepository, id, aiboID, required) {
+		return nil, uuid.Nil, false
+	}
+
+	household, err := s.HouseholdRepository.GetHouseholdByID(id)
+	if err != nil {
+		slog.Error("Failed to get household", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get household"})
+		return nil, uuid.Nil, false
+	}
+	return household, aiboID, true
+}
+
+// loadOwnInvitation fetches the invitation designated by the ":id" path parameter and checks that
+// it was sent to the email of the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *HouseholdService) loadOwnInvitation(c *gin.Context) (*types.HouseholdInvitation, *types.Aibo, bool) {
+	aibo, ok := s.currentAibo(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	invitation, ok := s.loadInvitation(c, c.Param("id"))
+	if !ok {
+		return nil, nil, false
+	}
+	if !strings.EqualFold(invitation.Email, aibo.Email) {
+		c.JSON(404, gin.H{"error": "invitation not found"})
+		return nil, nil, false
+	}
+	return invitation, aibo, true
+}
+
+// loadInvitation fetches an invitation by its ID.
+//
+// On failure, the response is already written and false is returned.
+func (s *HouseholdService) loadInvitation(c *gin.Context, rawID string) (*types.HouseholdInvitation, bool) {
+	id, err := snowflake.ParseString(rawID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "invitation not found"})
+		return nil, false
+	}
+
+	invitation, err := s.HouseholdRepository.GetInvitationByID(id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get invitation", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "invitation not found"})
+		return nil, false
+	}
+	return invitation, true
+}
+
+// currentAibo fetches the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *HouseholdService) currentAibo(c *gin.Context) (*types.Aibo, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return nil, false
+	}
+	return aibo, true
+}
@@ -0,0 +1,1198 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/imports"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxImportFileSize is the largest bank statement accepted by the imports, in bytes.
+	maxImportFileSize = 5 << 20
+	// maxMigrationFileSize is the largest export of another budgeting app accepted by the
+	// imports, in bytes.
+	maxMigrationFileSize = 50 << 20
+)
+
+// ImportService handles the imports of bank statements and of the exports of other budgeting
+// apps, the saved CSV column mappings and the bank accounts of the statements.
+type ImportService struct {
+	DB                     *gorm.DB
+	AiboRepository         *database.AiboRepository
+	ImportRepository       *database.ImportRepository
+	CatBudRepository       *database.CatBudRepository
+	CategoryRuleRepository *database.CategoryRuleRepository
+}
+
+// NewImportService creates a new ImportService instance.
+//
+// The ImportService instance is configured with the provided db instance.
+func NewImportService(db *gorm.DB) *ImportService {
+	return &ImportService{
+		DB:                     db,
+		AiboRepository:         database.NewAiboRepository(db),
+		ImportRepository:       database.NewImportRepository(db),
+		CatBudRepository:       database.NewCatBudRepository(db),
+		CategoryRuleRepository: database.NewCategoryRuleRepository(db),
+	}
+}
+
+// ImportCSV imports the transactions of a bank statement exported as CSV by the aibo that made
+// the request.
+//
+// The format of the file is taken from the form fields, then from the saved mapping, and the rest
+// is detected: the encoding, the delimiter, the lines above the table, the header, the columns,
+// the date format and the decimal separator. Negative amounts are expenses. A row is booked on the
+// CatBud whose name matches its category, or else on the default CatBud, unless a CategoryRule of
+// the aibo books it elsewhere. The rows already in the ledger, recognized by their fingerprint,
+// are left out.
+//
+// With dry_run, the parsed rows are only previewed. Otherwise the new rows are recorded in a
+// single batch: either all of them are, or none is.
+//
+// If the file or a form field is invalid, or there is no exchange rate for the day of a row, it
+// returns a 400 error. If the mapping or the CatBud does not exist, it returns a 404 error.
+// @Summary Import a bank statement CSV
+// @Description Import the transactions of a bank statement CSV file, with column mapping, dry-run preview and deduplication
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV file of the bank statement"
+// @Param mapping_id formData string false "ID of a saved mapping"
+// @Param cat_bud_id formData string false "Default CatBud"
+// @Param dry_run formData bool false "Only preview the rows"
+// @Param save_mapping formData string false "Save the format as a mapping with this name"
+// @Param encoding formData string false "utf-8, utf-16le, utf-16be, windows-1252, iso-8859-1 or iso-8859-15"
+// @Param delimiter formData string false "Field delimiter"
+// @Param skip_rows formData int false "Lines before the table"
+// @Param has_header formData bool false "Whether the first row names the columns"
+// @Param date_column formData string false "Column of the date (name or position from 1)"
+// @Param amount_column formData string false "Column of the signed amount"
+// @Param debit_column formData string false "Column of the amounts paid out"
+// @Param credit_column formData string false "Column of the amounts paid in"
+// @Param payee_column formData string false "Column of the payee"
+// @Param note_column formData string false "Column of the note"
+// @Param currency_column formData string false "Column of the currency"
+// @Param category_column formData string false "Column of the category"
+// @Param date_format formData string false "Date format, such as DD.MM.YYYY"
+// @Param decimal_separator formData string false "Decimal separator, . or ,"
+// @Param invert_amounts formData bool false "Whether expenses are positive"
+// @Param currency formData string false "Currency of the amounts without currency column"
+// @Success 200 {object} types.ImportResponse
+// @Success 201 {object} types.ImportResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/csv [post]
+func (s *ImportService) ImportCSV(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ImportCSVRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.CSVFormat.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	data, fileName, ok := readImportFile(c, maxImportFileSize)
+	if !ok {
+		return
+	}
+
+	format := req.CSVFormat
+	var mappingID, catBudID *snowflake.ID
+	if req.MappingID != "" {
+		mapping, ok := s.loadMapping(c, aiboID, req.MappingID)
+		if !ok {
+			return
+		}
+		format = format.Merge(mapping.CSVFormat)
+		mappingID, catBudID = &mapping.ID, mapping.CatBudID
+	}
+	if req.CatBudID != "" {
+		id, err := snowflake.ParseString(req.CatBudID)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid cat_bud_id"})
+			return
+		}
+		catBudID = &id
+	}
+
+	statement, err := imports.ParseCSV(data, format)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch := &types.ImportBatch{
+		ID:        utilitaries.GenerateSnowflakeID(),
+		AiboID:    aiboID,
+		Source:    types.ImportSourceCSV,
+		FileName:  fileName,
+		MappingID: mappingID,
+	}
+	response, ok := s.importStatement(c, batch, statement.Rows, catBudID, nil, req.DryRun)
+	if !ok {
+		return
+	}
+	response.Format = &statement.Format
+
+	if req.SaveMapping != "" {
+		mapping, err := s.saveMappingByName(aiboID, req.SaveMapping, statement.Format, catBudID)
+		if err != nil {
+			slog.Error("Failed to save import mapping", "error", err)
+			c.JSON(500, gin.H{"error": "Failed to save import mapping"})
+			return
+		}
+		response.Mapping = mapping
+	}
+
+	if req.DryRun {
+		c.JSON(200, response)
+		return
+	}
+	c.JSON(201, response)
+}
+
+// ImportOFX imports the transactions of an OFX or QFX statement by the aibo that made the
+// request, in the SGML syntax of OFX 1.x or the XML syntax of OFX 2.x.
+//
+// Each bank or credit card account of the file is remembered, with the CatBud its transactions
+// are booked on: cat_bud_id when given, or else the CatBud remembered from the previous imports.
+// The CategoryRules of the aibo can book them elsewhere, matching the account or not.
+// The transactions already imported, recognized by the identifier the bank gave them (FITID), or
+// else by their fingerprint, are left out, so a statement can be imported again safely.
+//
+// With dry_run, the parsed rows are only previewed. Otherwise the new rows of each account are
+// recorded in a batch of their own: either all of them are, or none is.
+//
+// If the file or a form field is invalid, or there is no exchange rate for the day of a row, it
+// returns a 400 error. If the CatBud does not exist, it returns a 404 error.
+// @Summary Import an OFX or QFX statement
+// @Description Import the transactions of an OFX or QFX file, deduplicated by their FITID
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "OFX or QFX file"
+// @Param cat_bud_id formData string false "CatBud to book the transactions on"
+// @Param dry_run formData bool false "Only preview the rows"
+// @Success 200 {object} types.ImportStatementsResponse
+// @Success 201 {object} types.ImportStatementsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/ofx [post]
+func (s *ImportService) ImportOFX(c *gin.Context) {
+	s.importStatementFile(c, func(data []byte, fileName string, req *types.ImportStatementRequest) (types.ImportSource, []imports.Statement, error) {
+		source := types.ImportSourceOFX
+		if strings.HasSuffix(strings.ToLower(fileName), ".qfx") {
+			source = types.ImportSourceQFX
+		}
+		statements, err := imports.ParseOFX(data)
+		return source, statements, err
+	})
+}
+
+// ImportQIF imports the transactions of a QIF file by the aibo that made the request.
+//
+// QIF files give no currency: the amounts are in the currency given, or else in the currency
+// remembered for the account, or else in the base currency. Whether the dates read day or month
+// first is detected, unless day_first is given. A transaction is booked on the CatBud whose name
+// matches its category, or else on cat_bud_id, or else on the CatBud remembered for the account.
+// The transactions already in the ledger, recognized by their fingerprint, are left out.
+//
+// With dry_run, the parsed rows are only previewed. Otherwise the new rows of each account are
+// recorded in a batch of their own: either all of them are, or none is.
+//
+// If the file or a form field is invalid, or there is no exchange rate for the day of a row, it
+// returns a 400 error. If the CatBud does not exist, it returns a 404 error.
+// @Summary Import a QIF file
+// @Description Import the transactions of a Quicken Interchange Format file
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "QIF file"
+// @Param cat_bud_id formData string false "CatBud to book the transactions without a matching category on"
+// @Param dry_run formData bool false "Only preview the rows"
+// @Param currency formData string false "Currency of the amounts"
+// @Param day_first formData bool false "Whether the dates read day first"
+// @Success 200 {object} types.ImportStatementsResponse
+// @Success 201 {object} types.ImportStatementsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/qif [post]
+func (s *ImportService) ImportQIF(c *gin.Context) {
+	s.importStatementFile(c, func(data []byte, _ string, req *types.ImportStatementRequest) (types.ImportSource, []imports.Statement, error) {
+		if req.Currency != "" && !req.Currency.IsSupported() {
+			return "", nil, errors.New("currency must be an ISO 4217 currency code with two decimals")
+		}
+		statements, err := imports.ParseQIF(data, req.Currency, req.DayFirst)
+		return types.ImportSourceQIF, statements, err
+	})
+}
+
+// ImportYNAB imports the export of a YNAB budget by the aibo that made the request: the ZIP file
+// holding its register and its plan, or the register alone.
+//
+// The categories of the budget are created as personal CatBuds under a CatBud for their group,
+// with the amount last assigned to them as monthly budget, unless a CatBud with the same name
+// already exists; then the transactions are booked on them. Transfers between accounts, starting
+// balances and credit card payments are left out and reported as unmapped.
+//
+// With dry_run, the categories and the rows are only previewed. Otherwise everything is recorded
+// in a single batch, which can be rolled back as a whole.
+//
+// If the file or a form field is invalid, or there is no exchange rate for the day of a row, it
+// returns a 400 error.
+// @Summary Import a YNAB budget
+// @Description Import the categories, budgets and transactions of a YNAB export
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "YNAB export, ZIP or register CSV"
+// @Param dry_run formData bool false "Only preview the categories and rows"
+// @Param currency formData string false "Currency of the amounts"
+// @Param date_format formData string false "Date format, such as MM/DD/YYYY"
+// @Success 200 {object} types.ImportMigrationResponse
+// @Success 201 {object} types.ImportMigrationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/ynab [post]
+func (s *ImportService) ImportYNAB(c *gin.Context) {
+	s.importMigration(c, types.ImportSourceYNAB, imports.ParseYNAB)
+}
+
+// ImportMint imports the transactions export of Mint by the aibo that made the request.
+//
+// The categories are created as personal CatBuds, the default ones of Mint under a CatBud for
+// their parent category, unless a CatBud with the same name already exists; then the transactions
+// are booked on them. Transfers and investments are left out, and the income categories are not
+// created; both are reported as unmapped. Mint does not export the budgets.
+//
+// With dry_run, the categories and the rows are only previewed. Otherwise everything is recorded
+// in a single batch, which can be rolled back as a whole.
+//
+// If the file or a form field is invalid, or there is no exchange rate for the day of a row, it
+// returns a 400 error.
+// @Summary Import a Mint export
+// @Description Import the categories and transactions of a Mint export
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Mint transactions CSV"
+// @Param dry_run formData bool false "Only preview the categories and rows"
+// @Param currency formData string false "Currency of the amounts"
+// @Param date_format formData string false "Date format, such as M/D/YYYY"
+// @Success 200 {object} types.ImportMigrationResponse
+// @Success 201 {object} types.ImportMigrationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/mint [post]
+func (s *ImportService) ImportMint(c *gin.Context) {
+	s.importMigration(c, types.ImportSourceMint, imports.ParseMint)
+}
+
+// ImportActual imports the transactions of Actual Budget exported as CSV by the aibo that made the
+// request. The full export of a budget, holding its SQLite database, is not supported.
+//
+// The categories are created as top-level personal CatBuds, unless a CatBud with the same name
+// already exists; then the transactions are booked on them. Transfers between accounts and
+// starting balances are left out, and the income category is not created; both are reported as
+// unmapped.
+//
+// With dry_run, the categories and the rows are only previewed. Otherwise everything is recorded
+// in a single batch, which can be rolled back as a whole.
+//
+// If the file or a form field is invalid, or there is no exchange rate for the day of a row, it
+// returns a 400 error.
+// @Summary Import an Actual Budget export
+// @Description Import the categories and transactions of an Actual Budget CSV export
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Actual Budget transactions CSV"
+// @Param dry_run formData bool false "Only preview the categories and rows"
+// @Param currency formData string false "Currency of the amounts"
+// @Param date_format formData string false "Date format, such as YYYY-MM-DD"
+// @Success 200 {object} types.ImportMigrationResponse
+// @Success 201 {object} types.ImportMigrationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/actual [post]
+func (s *ImportService) ImportActual(c *gin.Context) {
+	s.importMigration(c, types.ImportSourceActual, imports.ParseActual)
+}
+
+// RollbackImport removes what an import of the aibo that made the request recorded: its
+// transactions, and the CatBuds it created that were not used since. The import stays in the list,
+// marked as rolled back.
+//
+// If the import does not exist or belongs to another aibo, it returns a 404 error. If it is
+// already rolled back, it returns a 409 error.
+// @Summary Roll back an import
+// @Description Remove the transactions and CatBuds recorded by an import
+// @Tags imports
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Import batch ID"
+// @Success 200 {object} types.RollbackImportResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/{id}/rollback [post]
+func (s *ImportService) RollbackImport(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "import not found"})
+		return
+	}
+	batch, err := s.ImportRepository.GetBatchByID(id)
+	if err != nil || batch.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get import batch", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "import not found"})
+		return
+	}
+	if batch.RolledBackAt != nil {
+		c.JSON(409, gin.H{"error": "the import is already rolled back"})
+		return
+	}
+
+	transactions, catBuds, err := s.ImportRepository.Rollback(batch, time.Now())
+	if err != nil {
+		slog.Error("Failed to roll back import", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to roll back import"})
+		return
+	}
+
+	c.JSON(200, types.RollbackImportResponse{Batch: *batch, Transactions: transactions, CatBuds: catBuds})
+}
+
+// GetImportAccounts lists the bank accounts the aibo that made the request imported statements
+// of.
+// @Summary List import accounts
+// @Description List the bank accounts of the imported statements of the authenticated aibo
+// @Tags imports
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListImportAccountsResponse
+// @Failure 500 {object} map[string]string
+// @Router /imports/accounts [get]
+func (s *ImportService) GetImportAccounts(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	accounts, err := s.ImportRepository.GetAccountsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get import accounts", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get import accounts"})
+		return
+	}
+
+	c.JSON(200, types.ListImportAccountsResponse{Accounts: accounts})
+}
+
+// UpdateImportAccount renames a bank account of the aibo that made the request, and changes the
+// CatBud its next statements are booked on.
+//
+// If the request body is invalid, it returns a 400 error. If the account or the CatBud does not
+// exist, it returns a 404 error.
+// @Summary Update an import account
+// @Description Rename a bank account and change the CatBud its transactions are booked on
+// @Tags imports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Import account ID"
+// @Param account body types.ImportAccountRequest true "Import account"
+// @Success 200 {object} types.ImportAccountResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/accounts/{id} [put]
+func (s *ImportService) UpdateImportAccount(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	account, ok := s.loadAccount(c, aiboID, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req types.ImportAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Name) > 100 {
+		c.JSON(400, gin.H{"error": "name must be at most 100 characters"})
+		return
+	}
+	if req.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *req.CatBudID) {
+		return
+	}
+
+	account.Name = req.Name
+	account.CatBudID = req.CatBudID
+	if err := s.ImportRepository.UpdateAccount(account); err != nil {
+		slog.Error("Failed to update import account", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update import account"})
+		return
+	}
+
+	c.JSON(200, types.ImportAccountResponse{Account: *account})
+}
+
+// DeleteImportAccount forgets a bank account of the aibo that made the request. The transactions
+// imported from its statements are kept, and still recognized when imported again.
+//
+// If the account does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete an import account
+// @Description Forget a bank account of the authenticated aibo
+// @Tags imports
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Import account ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/accounts/{id} [delete]
+func (s *ImportService) DeleteImportAccount(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	account, ok := s.loadAccount(c, aiboID, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := s.ImportRepository.DeleteAccount(account); err != nil {
+		slog.Error("Failed to delete import account", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete import account"})
+		return
+	}
+
+	c.Status(204)
+}
+
+// GetImportBatches lists the files imported by the aibo that made the request, most recent first.
+// @Summary List imports
+// @Description List the files imported by the authenticated aibo
+// @Tags imports
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListImportBatchesResponse
+// @Failure 500 {object} map[string]string
+// @Router /imports [get]
+func (s *ImportService) GetImportBatches(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	batches, err := s.ImportRepository.GetBatchesByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get import batches", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get imports"})
+		return
+	}
+
+	c.JSON(200, types.ListImportBatchesResponse{Batches: batches})
+}
+
+// GetImportMappings lists the CSV column mappings saved by the aibo that made the request.
+// @Summary List import mappings
+// @Description List the CSV column mappings of the authenticated aibo
+// @Tags imports
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListImportMappingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /imports/mappings [get]
+func (s *ImportService) GetImportMappings(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	mappings, err := s.ImportRepository.GetMappingsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get import mappings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get import mappings"})
+		return
+	}
+
+	c.JSON(200, types.ListImportMappingsResponse{Mappings: mappings})
+}
+
+// CreateImportMapping saves the CSV format of a bank for the aibo that made the request.
+//
+// The fields left empty are detected from each imported file.
+//
+// If the request body is invalid, it returns a 400 error. If the CatBud does not exist, it
+// returns a 404 error. If the aibo already has a mapping with the same name, it returns a 409
+// error.
+// @Summary Create an import mapping
+// @Description Save the CSV column mapping of a bank
+// @Tags imports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param mapping body types.ImportMappingRequest true "Import mapping"
+// @Success 201 {object} types.ImportMappingResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/mappings [post]
+func (s *ImportService) CreateImportMapping(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	req, ok := s.mappingFromRequest(c, aiboID)
+	if !ok {
+		return
+	}
+	if _, err := s.ImportRepository.GetMappingByName(aiboID, req.Name); err == nil {
+		c.JSON(409, gin.H{"error": "an import mapping with this name already exists"})
+		return
+	}
+
+	mapping := types.ImportMapping{
+		ID:        utilitaries.GenerateSnowflakeID(),
+		AiboID:    aiboID,
+		Name:      req.Name,
+		CSVFormat: req.CSVFormat,
+		CatBudID:  req.CatBudID,
+	}
+	if err := s.ImportRepository.CreateMapping(&mapping); err != nil {
+		slog.Error("Failed to create import mapping", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create import mapping"})
+		return
+	}
+
+	c.JSON(201, types.ImportMappingResponse{Mapping: mapping})
+}
+
+// UpdateImportMapping replaces a CSV column mapping of the aibo that made the request.
+//
+// If the request body is invalid, it returns a 400 error. If the mapping or the CatBud does not
+// exist, it returns a 404 error. If the new name is taken by another mapping, it returns a 409
+// error.
+// @Summary Update an import mapping
+// @Description Replace a CSV column mapping of the authenticated aibo
+// @Tags imports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Import mapping ID"
+// @Param mapping body types.ImportMappingRequest true "Import mapping"
+// @Success 200 {object} types.ImportMappingResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/mappings/{id} [put]
+func (s *ImportService) UpdateImportMapping(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	mapping, ok := s.loadMapping(c, aiboID, c.Param("id"))
+	if !ok {
+		return
+	}
+	req, ok := s.mappingFromRequest(c, aiboID)
+	if !ok {
+		return
+	}
+	if other, err := s.ImportRepository.GetMappingByName(aiboID, req.Name); err == nil && other.ID != mapping.ID {
+		c.JSON(409, gin.H{"error": "an import mapping with this name already exists"})
+		return
+	}
+
+	mapping.Name = req.Name
+	mapping.CSVFormat = req.CSVFormat
+	mapping.CatBudID = req.CatBudID
+	if err := s.ImportRepository.UpdateMapping(mapping); err != nil {
+		slog.Error("Failed to update import mapping", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update import mapping"})
+		return
+	}
+
+	c.JSON(200, types.ImportMappingResponse{Mapping: *mapping})
+}
+
+// DeleteImportMapping removes a CSV column mapping of the aibo that made the request.
+//
+// If the mapping does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete an import mapping
+// @Description Delete a CSV column mapping of the authenticated aibo
+// @Tags imports
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Import mapping ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /imports/mappings/{id} [delete]
+func (s *ImportService) DeleteImportMapping(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	mapping, ok := s.loadMapping(c, aiboID, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := s.ImportRepository.DeleteMapping(mapping); err != nil {
+		slog.Error("Failed to delete import mapping", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete import mapping"})
+		return
+	}
+
+	c.Status(204)
+}
+
+// readImportFile reads the uploaded file of an import, of at most maxSize bytes. The body of the
+// request is cut off past that size.
+//
+// On failure, the response is already written and false is returned.
+func readImportFile(c *gin.Context, maxSize int64) ([]byte, string, bool) {
+	tooLarge := fmt.Sprintf("file must not be larger than %d MB", maxSize>>20)
+	limitUploadBody(c, maxSize)
+	header, err := c.FormFile("file")
+	if isBodyTooLarge(err) {
+		c.JSON(400, gin.H{"error": tooLarge})
+		return nil, "", false
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file is required"})
+		return nil, "", false
+	}
+	if header.Size > maxSize {
+		c.JSON(400, gin.H{"error": tooLarge})
+		return nil, "", false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		slog.Error("Failed to open uploaded file", "error", err)
+		c.JSON(400, gin.H{"error": "Failed to read file"})
+		return nil, "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize))
+	if err != nil {
+		slog.Error("Failed to read uploaded file", "error", err)
+		c.JSON(400, gin.H{"error": "Failed to read file"})
+		return nil, "", false
+	}
+	return data, header.Filename, true
+}
+
+// importStatementFile imports a file holding the statements of one or more bank accounts, read
+// by the given parser, in a single batch. The rows of every statement and the bank accounts they
+// are of are saved in the same database transaction, so a file is either imported as a whole or
+// not at all.
+//
+// The response is written by the function.
+func (s *ImportService) importStatementFile(c *gin.Context, parse func([]byte, string, *types.ImportStatementRequest) (types.ImportSource, []imports.Statement, error)) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ImportStatementRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	req.Currency = types.Currency(strings.ToUpper(string(req.Currency)))
+	var catBudID *snowflake.ID
+	if req.CatBudID != "" {
+		id, err := snowflake.ParseString(req.CatBudID)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid cat_bud_id"})
+			return
+		}
+		if !canBookOnCatBud(c, s.CatBudRepository, aiboID, id) {
+			return
+		}
+		catBudID = &id
+	}
+	data, fileName, ok := readImportFile(c, maxImportFileSize)
+	if !ok {
+		return
+	}
+
+	source, statements, err := parse(data, fileName, &req)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch := &types.ImportBatch{
+		ID:       utilitaries.GenerateSnowflakeID(),
+		AiboID:   aiboID,
+		Source:   source,
+		FileName: fileName,
+	}
+	response := types.ImportStatementsResponse{DryRun: req.DryRun, Statements: make([]types.ImportResponse, 0, len(statements))}
+	var accounts []*types.ImportAccount
+	byNumber := make(map[[2]string]*types.ImportAccount)
+	var rows []types.ImportRow
+	for _, statement := range statements {
+		defaultID := catBudID
+		var account *types.ImportAccount
+		var accountID *snowflake.ID
+		if statement.Account != nil {
+			// A file may hold several statements of the same account.
+			key := [2]string{statement.Account.BankID, statement.Account.Number}
+			account = byNumber[key]
+			if account == nil {
+				account, err = s.rememberAccount(aiboID, statement.Account, catBudID)
+				if err != nil {
+					slog.Error("Failed to get import account", "error", err)
+					c.JSON(500, gin.H{"error": "Failed to get import account"})
+					return
+				}
+				byNumber[key] = account
+				accounts = append(accounts, account)
+			}
+			if defaultID == nil {
+				defaultID = account.CatBudID
+			}
+			accountID = &account.ID
+			for i := range statement.Rows {
+				if statement.Rows[i].Currency == "" {
+					statement.Rows[i].Currency = account.Currency
+				}
+			}
+		}
+
+		if !s.prepareRows(c, aiboID, statement.Rows, defaultID, accountID) {
+			return
+		}
+		rows = append(rows, statement.Rows...)
+		response.Statements = append(response.Statements, types.ImportResponse{DryRun: req.DryRun, Account: account, Rows: statement.Rows})
+	}
+
+	if len(accounts) == 1 && !req.DryRun {
+		batch.ImportAccountID = &accounts[0].ID
+	}
+	if !s.importRows(c, batch, rows, req.DryRun, accounts...) {
+		return
+	}
+
+	// The rows were marked as a whole: hand each statement its part back.
+	offset := 0
+	for i := range response.Statements {
+		statement := &response.Statements[i]
+		statement.Rows = rows[offset : offset+len(statement.Rows)]
+		offset += len(statement.Rows)
+		statement.New, statement.Duplicates, statement.Invalid = types.CountImportRows(statement.Rows)
+		if !req.DryRun {
+			statement.Batch = batch
+		}
+	}
+
+	if req.DryRun {
+		c.JSON(200, response)
+		return
+	}
+	c.JSON(201, response)
+}
+
+// importMigration imports the export of another budgeting app, read by the given parser, with its
+// categories, in a single batch.
+//
+// The response is written by the function.
+func (s *ImportService) importMigration(c *gin.Context, source types.ImportSource, parse func([]byte, types.Currency, string) (*imports.Migration, error)) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ImportMigrationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	req.Currency = types.Currency(strings.ToUpper(string(req.Currency)))
+	if req.Currency != "" && !req.Currency.IsSupported() {
+		c.JSON(400, gin.H{"error": "currency must be an ISO 4217 currency code with two decimals"})
+		return
+	}
+	if _, ok := types.DateFormats[req.DateFormat]; req.DateFormat != "" && !ok {
+		c.JSON(400, gin.H{"error": "date_format is not supported"})
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+	currency := req.Currency
+	if currency == "" {
+		currency = aibo.BaseCurrency
+	}
+
+	data, fileName, ok := readImportFile(c, maxMigrationFileSize)
+	if !ok {
+		return
+	}
+	migration, err := parse(data, currency, req.DateFormat)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The budgets of the CatBuds are in the base currency.
+	if currency != aibo.BaseCurrency {
+		for i := range migration.Categories {
+			if migration.Categories[i].Budget != nil {
+				migration.Categories[i].Budget = nil
+				migration.Unmapped = append(migration.Unmapped, types.ImportUnmapped{
+					Kind:   types.ImportUnmappedBudget,
+					Name:   categoryLabel(migration.Categories[i]),
+					Count:  1,
+					Reason: fmt.Sprintf("the budget is in %s, not in the base currency %s", currency, aibo.BaseCurrency),
+				})
+			}
+		}
+	}
+
+	batch := &types.ImportBatch{
+		ID:       utilitaries.GenerateSnowflakeID(),
+		AiboID:   aiboID,
+		Source:   source,
+		FileName: fileName,
+	}
+	if req.DryRun {
+		err = s.ImportRepository.PreviewMigration(aiboID, migration.Categories, migration.Rows)
+	} else {
+		err = s.ImportRepository.Migrate(batch, migration.Categories, migration.Rows)
+	}
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to import transactions", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to import transactions"})
+		return
+	}
+
+	for _, category := range migration.Categories {
+		if !category.Created && category.Budget != nil {
+			migration.Unmapped = append(migration.Unmapped, types.ImportUnmapped{
+				Kind:   types.ImportUnmappedBudget,
+				Name:   categoryLabel(category),
+				Count:  1,
+				Reason: "the CatBud already exists, its budget is kept",
+			})
+		}
+	}
+
+	response := types.ImportMigrationResponse{
+		ImportResponse: types.ImportResponse{DryRun: req.DryRun, Rows: migration.Rows},
+		Categories:     migration.Categories,
+		Unmapped:       migration.Unmapped,
+	}
+	response.New, response.Duplicates, response.Invalid = types.CountImportRows(migration.Rows)
+	if response.Categories == nil {
+		response.Categories = []types.ImportCategory{}
+	}
+	if response.Unmapped == nil {
+		response.Unmapped = []types.ImportUnmapped{}
+	}
+	if req.DryRun {
+		c.JSON(200, response)
+		return
+	}
+	response.Batch = batch
+	c.JSON(201, response)
+}
+
+// categoryLabel names a category of another budgeting app as Group: Category.
+func categoryLabel(category types.ImportCategory) string {
+	if category.Group == "" {
+		return category.Name
+	}
+	return category.Group + ": " + category.Name
+}
+
+// rememberAccount returns the saved bank account of the aibo matching the account of a statement,
+// or a new one when there is none. The type and currency are updated from the statement, and the
+// CatBud when one is given. The account is saved along with the rows of the statement.
+func (s *ImportService) rememberAccount(aiboID uuid.UUID, found *types.ImportAccount, catBudID *snowflake.ID) (*types.ImportAccount, error) {
+	account, err := s.ImportRepository.GetAccountByNumber(aiboID, found.BankID, found.Number)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		account = &types.ImportAccount{ID: utilitaries.GenerateSnowflakeID(), AiboID: aiboID, BankID: found.BankID, Number: found.Number}
+	} else if err != nil {
+		return nil, err
+	}
+	if found.Type != "" {
+		account.Type = found.Type
+	}
+	if found.Currency != "" {
+		account.Currency = found.Currency
+	}
+	if catBudID != nil {
+		account.CatBudID = catBudID
+	}
+	return account, nil
+}
+
+// importStatement books the rows on their CatBuds, applies the CategoryRules of the aibo to them,
+// with the bank account of the statement if known, marks the duplicate ones, and records the new
+// ones in the batch unless it is a dry-run.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) importStatement(c *gin.Context, batch *types.ImportBatch, rows []types.ImportRow, defaultID, accountID *snowflake.ID, dryRun bool) (*types.ImportResponse, bool) {
+	if !s.prepareRows(c, batch.AiboID, rows, defaultID, accountID) {
+		return nil, false
+	}
+	if !s.importRows(c, batch, rows, dryRun) {
+		return nil, false
+	}
+
+	response := &types.ImportResponse{DryRun: dryRun, Rows: rows}
+	response.New, response.Duplicates, response.Invalid = types.CountImportRows(rows)
+	if !dryRun {
+		response.Batch = batch
+	}
+	return response, true
+}
+
+// prepareRows books the rows on their CatBuds and applies the CategoryRules of the aibo to them,
+// with the bank account of their statement if known.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) prepareRows(c *gin.Context, aiboID uuid.UUID, rows []types.ImportRow, defaultID, accountID *snowflake.ID) bool {
+	if !s.assignCatBuds(c, aiboID, rows, defaultID) {
+		return false
+	}
+	if err := s.CategoryRuleRepository.ApplyToRows(aiboID, accountID, rows); err != nil {
+		slog.Error("Failed to apply category rules", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to import transactions"})
+		return false
+	}
+	return true
+}
+
+// importRows marks the duplicate rows, and records the new ones in the batch along with the bank
+// accounts of their statements unless it is a dry-run.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) importRows(c *gin.Context, batch *types.ImportBatch, rows []types.ImportRow, dryRun bool, accounts ...*types.ImportAccount) bool {
+	var err error
+	if dryRun {
+		err = s.ImportRepository.MarkDuplicates(batch.AiboID, rows)
+	} else {
+		err = s.ImportRepository.Import(batch, rows, accounts...)
+	}
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to import transactions", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to import transactions"})
+		return false
+	}
+	return true
+}
+
+// assignCatBuds books each row on the CatBud the aibo may book on whose name matches its category,
+// without case, or else the last part of a category written Parent:Child, as in QIF files, or
+// else on the default CatBud.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) assignCatBuds(c *gin.Context, aiboID uuid.UUID, rows []types.ImportRow, defaultID *snowflake.ID) bool {
+	if defaultID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *defaultID) {
+		return false
+	}
+
+	byName := make(map[string]snowflake.ID)
+	for _, row := range rows {
+		for _, name := range categoryNames(row.Category) {
+			byName[name] = 0
+		}
+	}
+	if len(byName) > 0 {
+		catBuds, err := s.CatBudRepository.GetAllCatBudsByAiboID(aiboID)
+		if err != nil {
+			slog.Error("Failed to get cat buds", "error", err)
+			c.JSON(500, gin.H{"error": "Failed to get cat buds"})
+			return false
+		}
+		for i := range catBuds {
+			name := strings.ToLower(catBuds[i].Category)
+			if id, wanted := byName[name]; !wanted || id != 0 {
+				continue
+			}
+			role, err := s.CatBudRepository.GetCatBudRole(aiboID, &catBuds[i])
+			if err != nil {
+				slog.Error("Failed to get household role", "error", err)
+				c.JSON(500, gin.H{"error": "Failed to check household membership"})
+				return false
+			}
+			if role.Allows(types.RoleEditor) {
+				byName[name] = catBuds[i].ID
+			}
+		}
+	}
+
+	for i := range rows {
+		rows[i].CatBudID = defaultID
+		for _, name := range categoryNames(rows[i].Category) {
+			if id := byName[name]; id != 0 {
+				rows[i].CatBudID = &id
+				break
+			}
+		}
+	}
+	return true
+}
+
+// categoryNames returns the names a category may match, lowercased: the category, then the last
+// part of a category written Parent:Child.
+func categoryNames(category string) []string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return nil
+	}
+	names := []string{category}
+	if i := strings.LastIndex(category, ":"); i >= 0 && strings.TrimSpace(category[i+1:]) != "" {
+		names = append(names, strings.TrimSpace(category[i+1:]))
+	}
+	return names
+}
+
+// saveMappingByName saves a format as the mapping of the aibo with the given name, replacing the
+// mapping of the same name.
+func (s *ImportService) saveMappingByName(aiboID uuid.UUID, name string, format types.CSVFormat, catBudID *snowflake.ID) (*types.ImportMapping, error) {
+	mapping, err := s.ImportRepository.GetMappingByName(aiboID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		mapping = &types.ImportMapping{ID: utilitaries.GenerateSnowflakeID(), AiboID: aiboID, Name: name, CSVFormat: format, CatBudID: catBudID}
+		return mapping, s.ImportRepository.CreateMapping(mapping)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mapping.CSVFormat = format
+	mapping.CatBudID = catBudID
+	return mapping, s.ImportRepository.UpdateMapping(mapping)
+}
+
+// mappingFromRequest binds and checks the body of a mapping request.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) mappingFromRequest(c *gin.Context, aiboID uuid.UUID) (*types.ImportMappingRequest, bool) {
+	var req types.ImportMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		c.JSON(400, gin.H{"error": "name must be between 1 and 100 characters"})
+		return nil, false
+	}
+	if err := req.CSVFormat.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if req.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *req.CatBudID) {
+		return nil, false
+	}
+	return &req, true
+}
+
+// loadAccount loads a bank account of the aibo from its raw ID.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) loadAccount(c *gin.Context, aiboID uuid.UUID, rawID string) (*types.ImportAccount, bool) {
+	id, err := snowflake.ParseString(rawID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "import account not found"})
+		return nil, false
+	}
+	account, err := s.ImportRepository.GetAccountByID(id)
+	if err != nil || account.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get import account", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "import account not found"})
+		return nil, false
+	}
+	return account, true
+}
+
+// loadMapping loads a CSV column mapping of the aibo from its raw ID.
+//
+// On failure, the response is already written and false is returned.
+func (s *ImportService) loadMapping(c *gin.Context, aiboID uuid.UUID, rawID string) (*types.ImportMapping, bool) {
+	id, err := snowflake.ParseString(rawID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "import mapping not found"})
+		return nil, false
+	}
+	mapping, err := s.ImportRepository.GetMappingByID(id)
+	if err != nil || mapping.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get import mapping", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "import mapping not found"})
+		return nil, false
+	}
+	return mapping, true
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/notifications"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NotificationService handles the in-app inbox, the notification settings and the Web Push
+// subscriptions.
+type NotificationService struct {
+	DB                     *gorm.DB
+	NotificationRepository *database.NotificationRepository
+	Notifier               *notifications.Service
+}
+
+// NewNotificationService creates a new NotificationService instance.
+//
+// The NotificationService instance is configured with the provided db instance and the
+// notification channels configured in the environment.
+func NewNotificationService(db *gorm.DB) *NotificationService {
+	return &NotificationService{
+		DB:                     db,
+		NotificationRepository: database.NewNotificationRepository(db),
+		Notifier:               notifications.NewService(db, notifications.ChannelsFromEnv()...),
+	}
+}
+
+// GetNotifications lists the in-app inbox of the aibo that made the request, most recent first,
+// with the number of unread notifications.
+//
+// If a query parameter is invalid, it returns a 400 error.
+// @Summary List notifications
+// @Description List the in-app notifications of the authenticated aibo
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only list the notifications not read yet"
+// @Success 200 {object} types.ListNotificationsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications [get]
+func (s *NotificationService) GetNotifications(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ListNotificationsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	inbox, err := s.NotificationRepository.GetInbox(aiboID, req.Unread)
+	if err != nil {
+		slog.Error("Failed to get notifications", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	unread, err := s.NotificationRepository.CountUnread(aiboID)
+	if err != nil {
+		slog.Error("Failed to count unread notifications", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	c.JSON(200, types.ListNotificationsResponse{Notifications: inbox, Unread: unread})
+}
+
+// ReadNotification marks a notification of the aibo that made the request as read.
+//
+// If the notification does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Mark a notification as read
+// @Description Mark an in-app notification of the authenticated aibo as read
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Notification ID"
+// @Success 200 {object} types.NotificationResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/{id}/read [post]
+func (s *NotificationService) ReadNotification(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "notification not found"})
+		return
+	}
+	n, err := s.NotificationRepository.GetNotificationByID(id)
+	if err != nil || n.AiboID != aiboID || !n.InApp {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get notification", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "notification not found"})
+		return
+	}
+
+	if err := s.NotificationRepository.MarkRead(n); err != nil {
+		slog.Error("Failed to mark notification as read", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to mark notification as read"})
+		return
+	}
+
+	c.JSON(200, types.NotificationResponse{Notification: *n})
+}
+
+// ReadAllNotifications marks every notification of the inbox of the aibo that made the request as
+// read.
+// @Summary Mark all notifications as read
+// @Description Mark every in-app notification of the authenticated aibo as read
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]int64
+// @Failure 500 {object} map[string]string
+// @Router /notifications/read [post]
+func (s *NotificationService) ReadAllNotifications(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	read, err := s.NotificationRepository.MarkAllRead(aiboID)
+	if err != nil {
+		slog.Error("Failed to mark notifications as read", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+
+	c.JSON(200, gin.H{"read": read})
+}
+
+// GetNotificationSettings returns the channel preferences and quiet hours of the aibo that made
+// the request, along with the channels the server can deliver through.
+// @Summary Get notification settings
+// @Description Get the notification channels and quiet hours of the authenticated aibo
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.NotificationSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /notifications/settings [get]
+func (s *NotificationService) GetNotificationSettings(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	settings, err := s.NotificationRepository.GetSettings(aiboID)
+	if err != nil {
+		slog.Error("Failed to get notification settings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get notification settings"})
+		return
+	}
+
+	c.JSON(200, s.settingsResponse(settings))
+}
+
+// UpdateNotificationSettings changes the channel preferences and quiet hours of the aibo that
+// made the request.
+//
+// During the quiet hours, in the timezone of the aibo, the notifications are only listed in the
+// in-app inbox; the other channels deliver them when the quiet hours end. A webhook secret is
+// generated when a webhook URL is first set, and again with rotate_webhook_secret.
+//
+// If the request body is invalid, or the webhook URL does not reach a public address, it returns
+// a 400 error.
+// @Summary Update notification settings
+// @Description Update the notification channels and quiet hours of the authenticated aibo
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body types.UpdateNotificationSettingsRequest true "Notification settings"
+// @Success 200 {object} types.NotificationSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/settings [put]
+func (s *NotificationService) UpdateNotificationSettings(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateNotificationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := s.NotificationRepository.GetSettings(aiboID)
+	if err != nil {
+		slog.Error("Failed to get notification settings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get notification settings"})
+		return
+	}
+
+	if req.InApp != nil {
+		settings.InApp = *req.InApp
+	}
+	if req.Email != nil {
+		settings.Email = *req.Email
+	}
+	if req.WebPush != nil {
+		settings.WebPush = *req.WebPush
+	}
+	if req.Webhook != nil {
+		settings.Webhook = *req.Webhook
+	}
+	if req.WebhookURL != nil {
+		if *req.WebhookURL != "" {
+			if err := notifications.CheckPublicURL(c.Request.Context(), *req.WebhookURL, "https", "http"); err != nil {
+				c.JSON(400, gin.H{"error": "webhook_url must be a public http or https URL: " + err.Error()})
+				return
+			}
+		}
+		settings.WebhookURL = *req.WebhookURL
+		if settings.WebhookURL == "" {
+			settings.Webhook = false
+		}
+	}
+	if req.ClearQuietHours {
+		settings.QuietHoursStart, settings.QuietHoursEnd = nil, nil
+	} else {
+		if req.QuietHoursStart != nil {
+			settings.QuietHoursStart = req.QuietHoursStart
+		}
+		if req.QuietHoursEnd != nil {
+			settings.QuietHoursEnd = req.QuietHoursEnd
+		}
+	}
+
+	if err := settings.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if settings.WebhookURL != "" && (settings.WebhookSecret == "" || req.RotateWebhookSecret) {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			slog.Error("Failed to generate webhook secret", "error", err)
+			c.JSON(500, gin.H{"error": "Failed to update notification settings"})
+			return
+		}
+		settings.WebhookSecret = hex.EncodeToString(secret)
+	}
+
+	if err := s.NotificationRepository.SaveSettings(settings); err != nil {
+		slog.Error("Failed to save notification settings", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update notification settings"})
+		return
+	}
+
+	c.JSON(200, s.settingsResponse(settings))
+}
+
+// CreatePushSubscription subscribes a browser of the aibo that made the request to Web Push. The
+// body is the JSON form of the PushSubscription of the browser, created with the VAPID public key
+// of the notification settings.
+//
+// If the request body is invalid, or the endpoint is not a public https URL, it returns a 400
+// error. If Web Push is not configured on the server, it returns a 501 error.
+// @Summary Subscribe a browser to Web Push
+// @Description Register a Web Push subscription for the authenticated aibo
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param subscription body types.CreatePushSubscriptionRequest true "Browser push subscription"
+// @Success 201 {object} types.PushSubscriptionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 501 {object} map[string]string
+// @Router /notifications/push-subscriptions [post]
+func (s *NotificationService) CreatePushSubscription(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	if !s.Notifier.Configured(types.ChannelWebPush) {
+		c.JSON(501, gin.H{"error": "Web Push is not available"})
+		return
+	}
+
+	var req types.CreatePushSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := notifications.CheckPublicURL(c.Request.Context(), req.Endpoint, "https"); err != nil {
+		c.JSON(400, gin.H{"error": "endpoint must be a public https URL: " + err.Error()})
+		return
+	}
+
+	subscription := types.PushSubscription{
+		ID:       utilitaries.GenerateSnowflakeID(),
+		AiboID:   aiboID,
+		Endpoint: req.Endpoint,
+		P256dh:   req.Keys.P256dh,
+		Auth:     req.Keys.Auth,
+	}
+	if err := s.NotificationRepository.SavePushSubscription(&subscription); err != nil {
+		slog.Error("Failed to save push subscription", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to save push subscription"})
+		return
+	}
+
+	c.JSON(201, types.PushSubscriptionResponse{Subscription: subscription})
+}
+
+// DeletePushSubscription unsubscribes a browser of the aibo that made the request from Web Push.
+//
+// If the subscription does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Unsubscribe a browser from Web Push
+// @Description Remove a Web Push subscription of the authenticated aibo
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Push subscription ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/push-subscriptions/{id} [delete]
+func (s *NotificationService) DeletePushSubscription(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "push subscription not found"})
+		return
+	}
+	subscription, err := s.NotificationRepository.GetPushSubscriptionByID(id)
+	if err != nil || subscription.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get push subscription", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "push subscription not found"})
+		return
+	}
+
+	if err := s.NotificationRepository.DeletePushSubscription(id); err != nil {
+		slog.Error("Failed to delete push subscription", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete push subscription"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Push subscription deleted successfully"})
+}
+
+// SendTestNotification queues a test notification for the aibo that made the request, through
+// every channel it enabled.
+// @Summary Send a test notification
+// @Description Queue a test notification for the authenticated aibo on its enabled channels
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/test [post]
+func (s *NotificationService) SendTestNotification(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	err := s.Notifier.Notify(c.Request.Context(), notifications.Notification{
+		AiboID:  aiboID,
+		Kind:    "test",
+		Subject: "Test notification",
+		Body:    "This is a test notification.",
+	})
+	if err != nil {
+		slog.Error("Failed to queue test notification", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to send test notification"})
+		return
+	}
+
+	c.JSON(202, gin.H{"message": "Test notification queued"})
+}
+
+// settingsResponse adds the channels the server can deliver through to the settings.
+func (s *NotificationService) settingsResponse(settings *types.NotificationSettings) types.NotificationSettingsResponse {
+	resp := types.NotificationSettingsResponse{
+		Settings:       *settings,
+		Channels:       []types.NotificationChannel{},
+		VAPIDPublicKey: s.Notifier.VAPIDPublicKey(),
+	}
+	for _, channel := range []types.NotificationChannel{types.ChannelInApp, types.ChannelEmail, types.ChannelWebhook, types.ChannelWebPush} {
+		if s.Notifier.Configured(channel) {
+			resp.Channels = append(resp.Channels, channel)
+		}
+	}
+	return resp
+}
@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recurringMaxBackfillDays is how far in the past the start date of a new rule can be, since its
+// past occurrences are recorded in the ledger.
+const recurringMaxBackfillDays = 366
+
+// RecurringService handles the recurring transactions and bill schedules requests.
+type RecurringService struct {
+	DB                  *gorm.DB
+	RecurringRepository *database.RecurringRepository
+	CatBudRepository    *database.CatBudRepository
+	AiboRepository      *database.AiboRepository
+	RateRepository      *database.ExchangeRateRepository
+}
+
+// NewRecurringService creates a new RecurringService instance.
+//
+// The RecurringService instance is configured with the provided db instance.
+func NewRecurringService(db *gorm.DB) *RecurringService {
+	return &RecurringService{
+		DB:                  db,
+		RecurringRepository: database.NewRecurringRepository(db),
+		CatBudRepository:    database.NewCatBudRepository(db),
+		AiboRepository:      database.NewAiboRepository(db),
+		RateRepository:      database.NewExchangeRateRepository(db),
+	}
+}
+
+// CreateRecurringRule creates a recurring rule for the aibo that made the request.
+//
+// The occurrences that are already due are recorded in the ledger right away, the
+// following ones are recorded by the background job as they come due.
+//
+// If the request body is invalid, or the start date is more than a year ago, it returns a 400
+// error. If the CatBud is not visible to the aibo, it returns a 404 error. If the household role of
+// the aibo does not allow booking on it, it returns a 403 error.
+// @Summary Create a recurring rule
+// @Description Create a recurring transaction attached to a CatBud
+// @Tags recurring
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rule body types.CreateRecurringRuleRequest true "Recurring rule details"
+// @Success 201 {object} types.RecurringRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /recurring [post]
+func (s *RecurringService) CreateRecurringRule(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateRecurringRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	startDate, err := parseDate(req.StartDate)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid start_date format"})
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+
+	today := utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	if startDate.Before(today.AddDate(0, 0, -recurringMaxBackfillDays)) {
+		c.JSON(400, gin.H{"error": "start_date must be within the last year"})
+		return
+	}
+
+	rule := types.RecurringRule{
+		ID:        utilitaries.GenerateSnowflakeID(),
+		AiboID:    aiboID,
+		CatBudID:  req.CatBudID,
+		Kind:      req.Kind,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Payee:     req.Payee,
+		Note:      req.Note,
+		Frequency: req.Frequency,
+		Interval:  req.Interval,
+		StartDate: startDate,
+		Count:     req.Count,
+	}
+	if rule.Interval == 0 {
+		rule.Interval = 1
+	}
+	if rule.Currency == "" {
+		rule.Currency = aibo.BaseCurrency
+	}
+	if req.Until != "" {
+		until, err := parseDate(req.Until)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid until format"})
+			return
+		}
+		rule.Until = &until
+	}
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !canBookOnCatBud(c, s.CatBudRepository, aiboID, rule.CatBudID) {
+		return
+	}
+
+	if !s.convertible(c, rule.Currency, aibo.BaseCurrency, rule.StartDate) {
+		return
+	}
+
+	if err := s.RecurringRepository.CreateRule(&rule); err != nil {
+		slog.Error("Failed to create recurring rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create recurring rule"})
+		return
+	}
+
+	if _, err := s.RecurringRepository.MaterializeDue(rule.ID, time.Now()); err != nil {
+		// The background job will retry.
+		slog.Error("Failed to materialize recurring rule", "error", err)
+	}
+
+	s.respondWithRule(c, 201, rule.ID)
+}
+
+// GetRecurringRules lists the recurring rules of the aibo that made the request.
+// @Summary List recurring rules
+// @Description List the recurring transactions of the authenticated aibo
+// @Tags recurring
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListRecurringRulesResponse
+// @Failure 500 {object} map[string]string
+// @Router /recurring [get]
+func (s *RecurringService) GetRecurringRules(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	rules, err := s.RecurringRepository.GetRulesByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get recurring rules", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get recurring rules"})
+		return
+	}
+
+	c.JSON(200, types.ListRecurringRulesResponse{RecurringRules: rules})
+}
+
+// GetRecurringRule returns a recurring rule of the aibo that made the request, with its
+// single occurrence overrides.
+//
+// If the rule does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Get a recurring rule
+// @Description Get a recurring transaction of the authenticated aibo
+// @Tags recurring
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Recurring rule ID"
+// @Success 200 {object} types.RecurringRuleResponse
+// @Failure 404 {object} map[string]string
+// @Router /recurring/{id} [get]
+func (s *RecurringService) GetRecurringRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	s.respondWithRule(c, 200, rule.ID)
+}
+
+// UpdateRecurringRule updates a recurring rule of the aibo that made the request.
+//
+// Only the provided fields are changed, and only the occurrences that are not in the
+// ledger yet are affected.
+//
+// If the request body is invalid, it returns a 400 error.
+// If the rule or the CatBud is not visible to the aibo, it returns a 404 error. If the
+// household role of the aibo does not allow booking on the CatBud, it returns a 403 error.
+// @Summary Update a recurring rule
+// @Description Update the future occurrences of a recurring transaction
+// @Tags recurring
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Recurring rule ID"
+// @Param rule body types.UpdateRecurringRuleRequest true "Recurring rule update details"
+// @Success 200 {object} types.RecurringRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /recurring/{id} [put]
+func (s *RecurringService) UpdateRecurringRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateRecurringRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.CatBudID != nil {
+		if !canBookOnCatBud(c, s.CatBudRepository, rule.AiboID, *req.CatBudID) {
+			return
+		}
+		rule.CatBudID = *req.CatBudID
+	}
+	if req.Amount != nil {
+		rule.Amount = *req.Amount
+	}
+	if req.Currency != "" {
+		rule.Currency = req.Currency
+	}
+	if req.Payee != nil {
+		rule.Payee = *req.Payee
+	}
+	if req.Note != nil {
+		rule.Note = *req.Note
+	}
+	if req.Until != "" {
+		until, err := parseDate(req.Until)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid until format"})
+			return
+		}
+		rule.Until = &until
+	}
+	if req.Count != nil {
+		rule.Count = req.Count
+	}
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Currency != "" {
+		aibo, err := s.AiboRepository.GetAiboByID(rule.AiboID.String())
+		if err != nil {
+			slog.Error("Failed to get aibo", "error", err)
+			c.JSON(404, gin.H{"error": "aibo not found"})
+			return
+		}
+		day := utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+		if !s.convertible(c, rule.Currency, aibo.BaseCurrency, day) {
+			return
+		}
+	}
+
+	if err := s.RecurringRepository.UpdateRule(rule); err != nil {
+		slog.Error("Failed to update recurring rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update recurring rule"})
+		return
+	}
+
+	s.respondWithRule(c, 200, rule.ID)
+}
+
+// DeleteRecurringRule deletes a recurring rule of the aibo that made the request.
+//
+// The transactions already recorded by the rule are kept in the ledger.
+//
+// If the rule does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a recurring rule
+// @Description Stop a recurring transaction, keeping its past occurrences
+// @Tags recurring
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Recurring rule ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /recurring/{id} [delete]
+func (s *RecurringService) DeleteRecurringRule(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := s.RecurringRepository.DeleteRule(rule); err != nil {
+		slog.Error("Failed to delete recurring rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete recurring rule"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Recurring rule deleted successfully"})
+}
+
+// UpdateOccurrence skips or edits a single occurrence of a recurring rule, leaving the rest
+// of the series untouched.
+//
+// The ":date" path parameter is the scheduled day of the occurrence (YYYY-MM-DD). If the
+// occurrence is already in the ledger, its transaction is updated or removed accordingly.
+//
+// If the request body is invalid, the rule has no occurrence on that day, or an occurrence that is
+// not recorded yet is moved before that day, it returns a 400 error. If the rule does not exist or
+// belongs to another aibo, it returns a 404 error.
+// @Summary Skip or edit an occurrence
+// @Description Skip or edit a single occurrence of a recurring transaction
+// @Tags recurring
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Recurring rule ID"
+// @Param date path string true "Scheduled day of the occurrence (YYYY-MM-DD)"
+// @Param occurrence body types.UpdateOccurrenceRequest true "Occurrence override"
+// @Success 200 {object} types.RecurringRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /recurring/{id}/occurrences/{date} [put]
+func (s *RecurringService) UpdateOccurrence(c *gin.Context) {
+	rule, ok := s.loadRule(c)
+	if !ok {
+		return
+	}
+
+	occurrenceDate, err := parseDate(c.Param("date"))
+	if err != nil || occurrenceDate.IsZero() {
+		c.JSON(400, gin.H{"error": "Invalid occurrence date format"})
+		return
+	}
+
+	var req types.UpdateOccurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	exception := types.RecurringException{
+		OccurrenceDate: occurrenceDate,
+		Skip:           req.Skip,
+		Amount:         req.Amount,
+		Payee:          req.Payee,
+		Note:           req.Note,
+	}
+	if req.Date != "" {
+		date, err := parseDate(req.Date)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid date format"})
+			return
+		}
+		exception.Date = &date
+	}
+
+	if err := s.RecurringRepository.SetException(rule, &exception); err != nil {
+		slog.Error("Failed to update occurrence", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.respondWithRule(c, 200, rule.ID)
+}
+
+// GetUpcoming lists the upcoming bills and incomes of the aibo that made the request.
+//
+// The "days" query parameter sets how far ahead to look, 30 days by default. Occurrences
+// that are due but not recorded yet are included.
+//
+// If the "days" parameter is invalid, it returns a 400 error.
+// @Summary List upcoming bills
+// @Description List the upcoming occurrences of the recurring transactions of the authenticated aibo
+// @Tags recurring
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Number of days to look ahead (default 30)"
+// @Success 200 {object} types.UpcomingOccurrencesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /recurring/upcoming [get]
+func (s *RecurringService) GetUpcoming(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 0 || days > 366 {
+		c.JSON(400, gin.H{"error": "days must be a number between 0 and 366"})
+		return
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+	if err != nil {
+		slog.Error("Failed to get aibo", "error", err)
+		c.JSON(404, gin.H{"error": "aibo not found"})
+		return
+	}
+
+	today := utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	occurrences, err := s.RecurringRepository.GetUpcoming(aiboID, today.AddDate(0, 0, days))
+	if err != nil {
+		slog.Error("Failed to get upcoming occurrences", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get upcoming occurrences"})
+		return
+	}
+
+	c.JSON(200, types.UpcomingOccurrencesResponse{Occurrences: occurrences})
+}
+
+// loadRule fetches the rule designated by the ":id" path parameter and checks that it
+// belongs to the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *RecurringService) loadRule(c *gin.Context) (*types.RecurringRule, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "recurring rule not found"})
+		return nil, false
+	}
+
+	rule, err := s.RecurringRepository.GetRuleByID(id)
+	if err != nil || rule.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get recurring rule", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "recurring rule not found"})
+		return nil, false
+	}
+
+	return rule, true
+}
+
+// respondWithRule writes the rule and its overrides, as freshly read from the database.
+func (s *RecurringService) respondWithRule(c *gin.Context, status int, id snowflake.ID) {
+	rule, err := s.RecurringRepository.GetRuleByID(id)
+	if err != nil {
+		slog.Error("Failed to get recurring rule", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get recurring rule"})
+		return
+	}
+
+	exceptions, err := s.RecurringRepository.GetExceptions(id)
+	if err != nil {
+		slog.Error("Failed to get recurring exceptions", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get recurring rule"})
+		return
+	}
+
+	c.JSON(status, types.RecurringRuleResponse{RecurringRule: *rule, Exceptions: exceptions})
+}
+
+// convertible checks that amounts can be converted from one currency to the other on the given
+// day, so that the occurrences can be recorded when they come due.
+//
+// On failure, the response is already written and false is returned.
+func (s *RecurringService) convertible(c *gin.Context, from, to types.Currency, day time.Time) bool {
+	_, _, err := s.RateRepository.Convert(types.Cents(100), from, to, day)
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to get exchange rate", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get exchange rate"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,468 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SavingsService handles the savings goals requests.
+type SavingsService struct {
+	DB                *gorm.DB
+	SavingsRepository *database.SavingsRepository
+	CatBudRepository  *database.CatBudRepository
+	AiboRepository    *database.AiboRepository
+}
+
+// NewSavingsService creates a new SavingsService instance.
+//
+// The SavingsService instance is configured with the provided db instance.
+func NewSavingsService(db *gorm.DB) *SavingsService {
+	return &SavingsService{
+		DB:                db,
+		SavingsRepository: database.NewSavingsRepository(db),
+		CatBudRepository:  database.NewCatBudRepository(db),
+		AiboRepository:    database.NewAiboRepository(db),
+	}
+}
+
+// CreateSavingsGoal creates a savings goal for the aibo that made the request.
+//
+// If the request body is invalid, it returns a 400 error.
+// If the linked CatBud is not visible to the aibo, it returns a 404 error. If the household
+// role of the aibo does not allow booking on it, it returns a 403 error.
+// @Summary Create a savings goal
+// @Description Create a savings goal for the authenticated aibo
+// @Tags savings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param goal body types.CreateSavingsGoalRequest true "Savings goal details"
+// @Success 201 {object} types.SavingsGoalResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /goals [post]
+func (s *SavingsService) CreateSavingsGoal(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateSavingsGoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	goal := types.SavingsGoal{
+		ID:            utilitaries.GenerateSnowflakeID(),
+		AiboID:        aiboID,
+		Name:          req.Name,
+		TargetAmount:  req.TargetAmount,
+		CatBudID:      req.CatBudID,
+		Account:       req.Account,
+		AutoAmount:    req.AutoAmount,
+		AutoFrequency: req.AutoFrequency,
+		AutoInterval:  req.AutoInterval,
+	}
+	if goal.AutoInterval == 0 {
+		goal.AutoInterval = 1
+	}
+	if req.TargetDate != "" {
+		targetDate, err := parseDate(req.TargetDate)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid target_date format"})
+			return
+		}
+		goal.TargetDate = &targetDate
+	}
+	if req.AutoStartDate != "" {
+		autoStartDate, err := parseDate(req.AutoStartDate)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid auto_start_date format"})
+			return
+		}
+		goal.AutoStartDate = &autoStartDate
+	}
+
+	if err := goal.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if goal.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *goal.CatBudID) {
+		return
+	}
+
+	if err := s.SavingsRepository.CreateGoal(&goal); err != nil {
+		slog.Error("Failed to create savings goal", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create savings goal"})
+		return
+	}
+
+	if _, err := s.SavingsRepository.ContributeDue(goal.ID, time.Now()); err != nil {
+		// The background job will retry.
+		slog.Error("Failed to record automatic contribution", "error", err)
+	}
+
+	s.respondWithGoal(c, 201, goal.ID)
+}
+
+// GetSavingsGoals lists the savings goals of the aibo that made the request, with their progress.
+// @Summary List savings goals
+// @Description List the savings goals of the authenticated aibo with their progress
+// @Tags savings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListSavingsGoalsResponse
+// @Failure 500 {object} map[string]string
+// @Router /goals [get]
+func (s *SavingsService) GetSavingsGoals(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	goals, err := s.SavingsRepository.GetGoalsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get savings goals", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get savings goals"})
+		return
+	}
+
+	today := s.today(aiboID)
+	resp := types.ListSavingsGoalsResponse{SavingsGoals: []types.SavingsGoalResponse{}}
+	for _, goal := range goals {
+		pace, err := s.SavingsRepository.GetMonthlyPace(&goal, today)
+		if err != nil {
+			slog.Error("Failed to get savings pace", "error", err)
+			c.JSON(500, gin.H{"error": "Failed to get savings goals"})
+			return
+		}
+		resp.SavingsGoals = append(resp.SavingsGoals, types.SavingsGoalResponse{
+			SavingsGoal: goal,
+			Progress:    goal.Progress(today, pace),
+		})
+	}
+
+	c.JSON(200, resp)
+}
+
+// GetSavingsGoal returns a savings goal of the aibo that made the request, with its progress.
+//
+// If the goal does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Get a savings goal
+// @Description Get a savings goal of the authenticated aibo with its progress
+// @Tags savings
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Savings goal ID"
+// @Success 200 {object} types.SavingsGoalResponse
+// @Failure 404 {object} map[string]string
+// @Router /goals/{id} [get]
+func (s *SavingsService) GetSavingsGoal(c *gin.Context) {
+	goal, ok := s.loadGoal(c)
+	if !ok {
+		return
+	}
+
+	s.respondWithGoal(c, 200, goal.ID)
+}
+
+// UpdateSavingsGoal updates a savings goal of the aibo that made the request.
+//
+// Only the provided fields are changed.
+//
+// If the request body is invalid, it returns a 400 error.
+// If the goal does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Update a savings goal
+// @Description Update a savings goal of the authenticated aibo
+// @Tags savings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Savings goal ID"
+// @Param goal body types.UpdateSavingsGoalRequest true "Savings goal update details"
+// @Success 200 {object} types.SavingsGoalResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /goals/{id} [put]
+func (s *SavingsService) UpdateSavingsGoal(c *gin.Context) {
+	goal, ok := s.loadGoal(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateSavingsGoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		goal.Name = req.Name
+	}
+	if req.TargetAmount != nil {
+		goal.TargetAmount = *req.TargetAmount
+	}
+	if req.TargetDate != "" {
+		targetDate, err := parseDate(req.TargetDate)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid target_date format"})
+			return
+		}
+		goal.TargetDate = &targetDate
+	}
+	if req.Account != nil {
+		goal.Account = *req.Account
+	}
+	if req.AutoAmount != nil {
+		goal.AutoAmount = req.AutoAmount
+	}
+	if req.StopAuto {
+		goal.AutoAmount = nil
+	}
+
+	if err := goal.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.SavingsRepository.UpdateGoal(goal); err != nil {
+		slog.Error("Failed to update savings goal", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update savings goal"})
+		return
+	}
+
+	s.respondWithGoal(c, 200, goal.ID)
+}
+
+// DeleteSavingsGoal deletes a savings goal of the aibo that made the request.
+//
+// The ledger transactions recorded for its contributions are kept.
+//
+// If the goal does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a savings goal
+// @Description Delete a savings goal of the authenticated aibo
+// @Tags savings
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Savings goal ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /goals/{id} [delete]
+func (s *SavingsService) DeleteSavingsGoal(c *gin.Context) {
+	goal, ok := s.loadGoal(c)
+	if !ok {
+		return
+	}
+
+	if err := s.SavingsRepository.DeleteGoal(goal); err != nil {
+		slog.Error("Failed to delete savings goal", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete savings goal"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Savings goal deleted successfully"})
+}
+
+// GetContributions lists the contributions of a savings goal of the aibo that made the request.
+//
+// If the goal does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary List savings contributions
+// @Description List the contributions of a savings goal
+// @Tags savings
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Savings goal ID"
+// @Success 200 {object} types.ListContributionsResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /goals/{id}/contributions [get]
+func (s *SavingsService) GetContributions(c *gin.Context) {
+	goal, ok := s.loadGoal(c)
+	if !ok {
+		return
+	}
+
+	contributions, err := s.SavingsRepository.GetContributions(goal.ID)
+	if err != nil {
+		slog.Error("Failed to get savings contributions", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get savings contributions"})
+		return
+	}
+
+	c.JSON(200, types.ListContributionsResponse{Contributions: contributions})
+}
+
+// CreateContribution records a manual contribution (or withdrawal, with a negative amount)
+// to a savings goal of the aibo that made the request.
+//
+// When the goal is linked to a CatBud, the contribution is also booked on it in the ledger.
+//
+// If the request body is invalid, it returns a 400 error.
+// If the goal does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Contribute to a savings goal
+// @Description Record a manual contribution or withdrawal on a savings goal
+// @Tags savings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Savings goal ID"
+// @Param contribution body types.CreateContributionRequest true "Contribution details"
+// @Success 201 {object} types.SavingsGoalResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /goals/{id}/contributions [post]
+func (s *SavingsService) CreateContribution(c *gin.Context) {
+	goal, ok := s.loadGoal(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateContributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	date, err := parseDate(req.Date)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if date.IsZero() {
+		date = s.today(goal.AiboID)
+	}
+
+	contribution := types.SavingsContribution{
+		ID:     utilitaries.GenerateSnowflakeID(),
+		Amount: req.Amount,
+		Date:   date,
+		Source: types.ContributionManual,
+		Note:   req.Note,
+	}
+
+	if err := s.SavingsRepository.AddContribution(goal, &contribution); err != nil {
+		slog.Error("Failed to create savings contribution", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create savings contribution"})
+		return
+	}
+
+	s.respondWithGoal(c, 201, goal.ID)
+}
+
+// DeleteContribution removes a contribution from a savings goal of the aibo that made the
+// request, along with its ledger transaction.
+//
+// If the goal or the contribution does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a savings contribution
+// @Description Remove a contribution from a savings goal
+// @Tags savings
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Savings goal ID"
+// @Param contributionId path string true "Contribution ID"
+// @Success 200 {object} types.SavingsGoalResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /goals/{id}/contributions/{contributionId} [delete]
+func (s *SavingsService) DeleteContribution(c *gin.Context) {
+	goal, ok := s.loadGoal(c)
+	if !ok {
+		return
+	}
+
+	id, err := snowflake.ParseString(c.Param("contributionId"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "contribution not found"})
+		return
+	}
+
+	contribution, err := s.SavingsRepository.GetContributionByID(id)
+	if err != nil || contribution.SavingsGoalID != goal.ID {
+		c.JSON(404, gin.H{"error": "contribution not found"})
+		return
+	}
+
+	if err := s.SavingsRepository.DeleteContribution(goal, contribution); err != nil {
+		slog.Error("Failed to delete savings contribution", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete savings contribution"})
+		return
+	}
+
+	s.respondWithGoal(c, 200, goal.ID)
+}
+
+// loadGoal fetches the goal designated by the ":id" path parameter and checks that it
+// belongs to the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *SavingsService) loadGoal(c *gin.Context) (*types.SavingsGoal, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "savings goal not found"})
+		return nil, false
+	}
+
+	goal, err := s.SavingsRepository.GetGoalByID(id)
+	if err != nil || goal.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get savings goal", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "savings goal not found"})
+		return nil, false
+	}
+
+	return goal, true
+}
+
+// respondWithGoal writes the goal, as freshly read from the database, with its progress.
+func (s *SavingsService) respondWithGoal(c *gin.Context, status int, id snowflake.ID) {
+	goal, err := s.SavingsRepository.GetGoalByID(id)
+	if err != nil {
+		slog.Error("Failed to get savings goal", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get savings goal"})
+		return
+	}
+
+	today := s.today(goal.AiboID)
+	pace, err := s.SavingsRepository.GetMonthlyPace(goal, today)
+	if err != nil {
+		slog.Error("Failed to get savings pace", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get savings goal"})
+		return
+	}
+
+	c.JSON(status, types.SavingsGoalResponse{SavingsGoal: *goal, Progress: goal.Progress(today, pace)})
+}
+
+// today returns the current day in the timezone of the aibo, or in UTC if it cannot be loaded.
+func (s *SavingsService) today(aiboID uuid.UUID) time.Time {
+	loc := time.UTC
+	if aibo, err := s.AiboRepository.GetAiboByID(aiboID.String()); err == nil {
+		loc = utilitaries.LoadLocation(aibo.Timezone)
+	}
+	return utilitaries.LocalDate(time.Now(), loc)
+}
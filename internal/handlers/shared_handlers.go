@@ -2,12 +2,22 @@ package handlers
 
 import (
 	"aibo/internal/database"
+	"aibo/internal/types"
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/bwmarrin/snowflake"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// multipartOverhead is the room left in an upload request, on top of the file, for the
+// boundaries, the headers of the parts and the other fields of the form.
+const multipartOverhead = 1 << 20
+
 // DBHealthHandler is a gin.HandlerFunc that returns the health status of the
 // database.
 //
@@ -71,3 +81,102 @@ func HandleMigrate(dbService database.Service) gin.HandlerFunc {
 		c.String(http.StatusOK, "Database migrated")
 	}
 }
+
+// currentAiboID returns the ID of the authenticated aibo, as set by the AuthMiddleware.
+//
+// If the ID is missing or malformed, it aborts the request with a 401 error and returns false.
+func currentAiboID(c *gin.Context) (uuid.UUID, bool) {
+	aiboID, err := uuid.Parse(c.GetString("aibo_id"))
+	if err != nil {
+		slog.Error("Failed to parse aibo ID", "error", err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return uuid.Nil, false
+	}
+	return aiboID, true
+}
+
+// parseDate parses an optional "YYYY-MM-DD" date. An empty string yields the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// authorizeCatBud checks that the CatBud exists and that the aibo has at least the required role
+// on it: the aibo owns its personal CatBuds, and has its membership role on the CatBuds of its
+// households.
+//
+// If the CatBud does not exist or is not visible to the aibo, a 404 error is written. If the aibo
+// can see it with a lower role, a 403 error is written. In both cases false is returned.
+func authorizeCatBud(c *gin.Context, repo *database.CatBudRepository, aiboID uuid.UUID, catBudID snowflake.ID, required types.HouseholdRole) (*types.CatBud, bool) {
+	catBud, err := repo.GetCatBudByID(catBudID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get cat bud", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "cat bud not found"})
+		return nil, false
+	}
+
+	role, err := repo.GetCatBudRole(aiboID, catBud)
+	if err != nil {
+		slog.Error("Failed to get household role", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to check household membership"})
+		return nil, false
+	}
+	if role == "" {
+		c.JSON(404, gin.H{"error": "cat bud not found"})
+		return nil, false
+	}
+	if !role.Allows(required) {
+		c.JSON(403, gin.H{"error": "your household role does not allow this"})
+		return nil, false
+	}
+	return catBud, true
+}
+
+// canBookOnCatBud checks that the aibo may book transactions on the CatBud, which takes the
+// editor role on a shared CatBud.
+//
+// If it may not, the response is already written and false is returned.
+func canBookOnCatBud(c *gin.Context, repo *database.CatBudRepository, aiboID uuid.UUID, catBudID snowflake.ID) bool {
+	_, ok := authorizeCatBud(c, repo, aiboID, catBudID, types.RoleEditor)
+	return ok
+}
+
+// hasHouseholdRole checks that the aibo is a member of the household with at least the required
+// role.
+//
+// If the aibo is not a member, a 404 error is written. If its role is too low, a 403 error is
+// written. In both cases false is returned.
+func hasHouseholdRole(c *gin.Context, repo *database.HouseholdRepository, householdID, aiboID uuid.UUID, required types.HouseholdRole) bool {
+	role, err := repo.GetRole(householdID, aiboID)
+	if err != nil {
+		slog.Error("Failed to get household role", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to check household membership"})
+		return false
+	}
+	if role == "" {
+		c.JSON(404, gin.H{"error": "household not found"})
+		return false
+	}
+	if !role.Allows(required) {
+		c.JSON(403, gin.H{"error": "your household role does not allow this"})
+		return false
+	}
+	return true
+}
+
+// limitUploadBody caps the body of an upload request at maxSize bytes of file plus
+// multipartOverhead, so that a larger body is cut off while the form is parsed instead of being
+// read into memory or spooled to disk as a whole.
+func limitUploadBody(c *gin.Context, maxSize int64) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+}
+
+// isBodyTooLarge reports whether err comes from reading past the limit set by limitUploadBody.
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadContext returns a context for a multipart request whose "file" field holds size bytes.
+func uploadContext(t *testing.T, size int) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "statement.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("a"), size))
+	form.Close()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("POST", "/", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	return c, recorder
+}
+
+func TestReadUploadedFileLimitsBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const maxSize = 1 << 10
+	tests := []struct {
+		name       string
+		size       int
+		read       func(*gin.Context, int64) ([]byte, string, bool)
+		wantOK     bool
+		wantStatus int
+	}{
+		{"import within limit", maxSize, readImportFile, true, 200},
+		{"import over limit", maxSize + 1, readImportFile, false, 400},
+		{"import body cut off", maxSize + multipartOverhead, readImportFile, false, 400},
+		{"attachment within limit", maxSize, readAttachmentFile, true, 200},
+		{"attachment over limit", maxSize + 1, readAttachmentFile, false, 413},
+		{"attachment body cut off", maxSize + multipartOverhead, readAttachmentFile, false, 413},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, recorder := uploadContext(t, tt.size)
+			data, _, ok := tt.read(c, maxSize)
+			if ok != tt.wantOK || recorder.Code != tt.wantStatus {
+				t.Fatalf("ok = %v, status = %d, want %v, %d", ok, recorder.Code, tt.wantOK, tt.wantStatus)
+			}
+			if ok && len(data) != tt.size {
+				t.Errorf("read %d bytes, want %d", len(data), tt.size)
+			}
+			if !ok && !strings.Contains(recorder.Body.String(), "must not be larger than") {
+				t.Errorf("body = %s", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/templates"
+	"aibo/internal/types"
+	"errors"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TemplateService handles the budget templates and onboarding requests.
+type TemplateService struct {
+	DB               *gorm.DB
+	CatBudRepository *database.CatBudRepository
+}
+
+// NewTemplateService creates a new TemplateService instance.
+//
+// The TemplateService instance is configured with the provided db instance.
+func NewTemplateService(db *gorm.DB) *TemplateService {
+	return &TemplateService{
+		DB:               db,
+		CatBudRepository: database.NewCatBudRepository(db),
+	}
+}
+
+// GetTemplates lists the latest version of every budget template.
+// @Summary List budget templates
+// @Description List the budget templates a new aibo can start from
+// @Tags templates
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.ListBudgetTemplatesResponse
+// @Failure 500 {object} map[string]string
+// @Router /templates [get]
+func (s *TemplateService) GetTemplates(c *gin.Context) {
+	list, err := templates.List()
+	if err != nil {
+		slog.Error("Failed to load budget templates", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to load budget templates"})
+		return
+	}
+
+	c.JSON(200, types.ListBudgetTemplatesResponse{Templates: list})
+}
+
+// GetTemplate previews a budget template, with its budgets scaled to a monthly income when one is
+// given.
+//
+// If a query parameter is invalid, it returns a 400 error. If the template or version does not
+// exist, it returns a 404 error.
+// @Summary Preview a budget template
+// @Description Get a budget template, optionally scaled to a monthly income
+// @Tags templates
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Template ID"
+// @Param version query int false "Template version, defaults to the latest"
+// @Param income query string false "Monthly income to scale the budgets to"
+// @Success 200 {object} types.BudgetTemplate
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /templates/{id} [get]
+func (s *TemplateService) GetTemplate(c *gin.Context) {
+	var req types.GetBudgetTemplateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, ok := loadTemplate(c, c.Param("id"), req.Version)
+	if !ok {
+		return
+	}
+	if req.Income != nil {
+		template = template.ScaledTo(*req.Income)
+	}
+
+	c.JSON(200, template)
+}
+
+// ApplyTemplate creates the categories of a budget template for the current aibo.
+//
+// The budgets are scaled to the monthly income when one is given. Categories the aibo already has
+// under the same parent are kept as is, so applying a template twice creates nothing the second
+// time.
+//
+// If the request body is invalid, it returns a 400 error. If the template or version does not
+// exist, it returns a 404 error.
+// @Summary Apply a budget template
+// @Description Create the categories and budgets of a template for the current aibo
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body types.ApplyBudgetTemplateRequest true "Template to apply"
+// @Success 200 {object} types.ApplyBudgetTemplateResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /onboarding/template [post]
+func (s *TemplateService) ApplyTemplate(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ApplyBudgetTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, ok := loadTemplate(c, req.Template, req.Version)
+	if !ok {
+		return
+	}
+	if req.MonthlyIncome != nil {
+		template = template.ScaledTo(*req.MonthlyIncome)
+	}
+
+	created, err := s.CatBudRepository.ApplyTemplate(aiboID, template)
+	if err != nil {
+		slog.Error("Failed to apply budget template", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to apply budget template"})
+		return
+	}
+
+	catBuds, err := s.CatBudRepository.GetAllCatBudsByAiboID(aiboID)
+	if err != nil {
+		slog.Error("Failed to get cat buds", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get cat buds"})
+		return
+	}
+
+	c.JSON(200, types.ApplyBudgetTemplateResponse{
+		Template: template,
+		Created:  created,
+		CatBuds:  types.BuildCatBudTree(catBuds),
+	})
+}
+
+// loadTemplate fetches a version of a budget template, writing a 404 or 500 response when it
+// cannot be loaded.
+func loadTemplate(c *gin.Context, id string, version int) (types.BudgetTemplate, bool) {
+	template, err := templates.Get(id, version)
+	if errors.Is(err, templates.ErrTemplateNotFound) {
+		c.JSON(404, gin.H{"error": "Budget template not found"})
+		return template, false
+	}
+	if err != nil {
+		slog.Error("Failed to load budget templates", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to load budget templates"})
+		return template, false
+	}
+	return template, true
+}
@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TransactionService handles the ledger-related requests.
+type TransactionService struct {
+	DB                    *gorm.DB
+	TransactionRepository *database.TransactionRepository
+	CatBudRepository      *database.CatBudRepository
+	AiboRepository        *database.AiboRepository
+}
+
+// NewTransactionService creates a new TransactionService instance.
+//
+// The TransactionService instance is configured with the provided db instance.
+func NewTransactionService(db *gorm.DB) *TransactionService {
+	return &TransactionService{
+		DB:                    db,
+		TransactionRepository: database.NewTransactionRepository(db),
+		CatBudRepository:      database.NewCatBudRepository(db),
+		AiboRepository:        database.NewAiboRepository(db),
+	}
+}
+
+// CreateTransaction records a new expense or income for the aibo that made the request.
+//
+// When no date is given, the transaction is dated of the current day in the aibo timezone.
+// The CatBud spent and remaining amounts and the aibo CurrentDelta are updated along with it.
+//
+// The amount is converted into the base currency of the aibo at the rate of the transaction's day.
+//
+// Instead of a single CatBud, the amount can be split between several CatBuds with split lines
+// adding up to it. Each CatBud then counts the share booked on it.
+//
+// An expense that triggers an approval rule of a household is recorded with the pending status:
+// it only counts in the budgets once the other members approved it.
+//
+// The auto-categorization rules of the aibo book the transaction when no CatBud is given and it is
+// not split, and add their tags and note.
+//
+// If the request body is invalid, the split lines do not add up to the amount or no exchange rate
+// is available, it returns a 400 error.
+// If a CatBud is not visible to the aibo, it returns a 404 error. If the household role of the
+// aibo does not allow booking on a CatBud, it returns a 403 error.
+// @Summary Record a transaction
+// @Description Record an expense or an income in the ledger of the authenticated aibo
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param transaction body types.CreateTransactionRequest true "Transaction details"
+// @Success 201 {object} types.TransactionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /transactions [post]
+func (s *TransactionService) CreateTransaction(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.Kind.IsValid() {
+		c.JSON(400, gin.H{"error": "kind must be either expense or income"})
+		return
+	}
+	if req.Currency != "" && !req.Currency.IsSupported() {
+		c.JSON(400, gin.H{"error": "currency must be an ISO 4217 currency code with two decimals"})
+		return
+	}
+
+	date, err := parseDate(req.Date)
+	if err != nil {
+		slog.Error("Failed to parse date string", "error", err)
+		c.JSON(400, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if date.IsZero() {
+		aibo, err := s.AiboRepository.GetAiboByID(aiboID.String())
+		if err != nil {
+			slog.Error("Failed to get aibo", "error", err)
+			c.JSON(404, gin.H{"error": "aibo not found"})
+			return
+		}
+		date = utilitaries.LocalDate(time.Now(), utilitaries.LoadLocation(aibo.Timezone))
+	}
+
+	if req.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *req.CatBudID) {
+		return
+	}
+	splits, ok := s.splitsFromRequest(c, aiboID, req.Splits)
+	if !ok {
+		return
+	}
+	tags, err := types.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction := types.Transaction{
+		ID:       utilitaries.GenerateSnowflakeID(),
+		AiboID:   aiboID,
+		CatBudID: req.CatBudID,
+		Kind:     req.Kind,
+		Status:   types.TransactionApproved,
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Date:     date,
+		Payee:    req.Payee,
+		Note:     req.Note,
+		Tags:     tags,
+		Splits:   splits,
+	}
+	if err := transaction.ValidateSplits(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = s.TransactionRepository.CreateTransaction(&transaction)
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create transaction", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create transaction"})
+		return
+	}
+
+	c.JSON(201, types.TransactionResponse{Transaction: transaction})
+}
+
+// GetTransactions lists the transactions of the aibo that made the request.
+//
+// The transactions can be filtered by date range and CatBud.
+//
+// If a filter is invalid, it returns a 400 error.
+// @Summary List transactions
+// @Description List the ledger entries of the authenticated aibo
+// @Tags transactions
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Param cat_bud_id query string false "Only return transactions of this CatBud"
+// @Success 200 {object} types.ListTransactionsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /transactions [get]
+func (s *TransactionService) GetTransactions(c *gin.Context) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return
+	}
+
+	var req types.ListTransactionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		slog.Error("Failed to bind query", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var filter database.TransactionFilter
+	var err error
+	if filter.From, err = parseDate(req.From); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid from date format"})
+		return
+	}
+	if filter.To, err = parseDate(req.To); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid to date format"})
+		return
+	}
+	if req.CatBudID != "" {
+		catBudID, err := snowflake.ParseString(req.CatBudID)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid cat_bud_id"})
+			return
+		}
+		filter.CatBudID = &catBudID
+	}
+
+	transactions, err := s.TransactionRepository.GetTransactionsByAiboID(aiboID, filter)
+	if err != nil {
+		slog.Error("Failed to get transactions", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to get transactions"})
+		return
+	}
+
+	c.JSON(200, types.ListTransactionsResponse{Transactions: transactions})
+}
+
+// GetTransaction returns a single transaction of the aibo that made the request.
+//
+// If the transaction does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Get a transaction
+// @Description Get a ledger entry of the authenticated aibo
+// @Tags transactions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Transaction ID"
+// @Success 200 {object} types.TransactionResponse
+// @Failure 404 {object} map[string]string
+// @Router /transactions/{id} [get]
+func (s *TransactionService) GetTransaction(c *gin.Context) {
+	transaction, ok := s.loadTransaction(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, types.TransactionResponse{Transaction: *transaction})
+}
+
+// UpdateTransaction updates a transaction of the aibo that made the request.
+//
+// Only the provided fields are changed. The derived balances are recalculated along with it.
+//
+// New split lines replace the current ones and detach the transaction from its CatBud, while a
+// new CatBud books the whole amount on it and removes the split lines. When the amount of a split
+// transaction changes, its split lines must be sent again.
+//
+// Changing the kind or the amounts booked on the CatBuds of an expense submits it again to the
+// approval rules of the households; this is how a rejected expense is proposed again.
+//
+// If the request body is invalid or the split lines do not add up to the amount, it returns a 400
+// error.
+// If the transaction or a CatBud is not visible to the aibo, it returns a 404 error. If the
+// household role of the aibo does not allow booking on the CatBud, it returns a 403 error. If the
+// transaction records a debt payment and the kind, amount, currency or day changes, it returns a
+// 409 error: the payment must be deleted instead.
+// @Summary Update a transaction
+// @Description Update a ledger entry of the authenticated aibo
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Transaction ID"
+// @Param transaction body types.UpdateTransactionRequest true "Transaction update details"
+// @Success 200 {object} types.TransactionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /transactions/{id} [put]
+func (s *TransactionService) UpdateTransaction(c *gin.Context) {
+	transaction, ok := s.loadTransaction(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("Failed to bind JSON", "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Kind != "" {
+		if !req.Kind.IsValid() {
+			c.JSON(400, gin.H{"error": "kind must be either expense or income"})
+			return
+		}
+		transaction.Kind = req.Kind
+	}
+	if req.Amount != nil {
+		transaction.Amount = *req.Amount
+	}
+	if req.Currency != "" {
+		if !req.Currency.IsSupported() {
+			c.JSON(400, gin.H{"error": "currency must be an ISO 4217 currency code with two decimals"})
+			return
+		}
+		transaction.Currency = req.Currency
+	}
+	if req.Date != "" {
+		date, err := parseDate(req.Date)
+		if err != nil {
+			slog.Error("Failed to parse date string", "error", err)
+			c.JSON(400, gin.H{"error": "Invalid date format"})
+			return
+		}
+		transaction.Date = date
+	}
+	if req.Payee != nil {
+		transaction.Payee = *req.Payee
+	}
+	if req.Note != nil {
+		transaction.Note = *req.Note
+	}
+	if req.Tags != nil {
+		tags, err := types.NormalizeTags(*req.Tags)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		transaction.Tags = tags
+	}
+	if req.ClearSplits {
+		transaction.Splits = nil
+	}
+	if req.ClearCatBud {
+		transaction.CatBudID = nil
+	} else if req.CatBudID != nil {
+		if !canBookOnCatBud(c, s.CatBudRepository, transaction.AiboID, *req.CatBudID) {
+			return
+		}
+		transaction.CatBudID = req.CatBudID
+		transaction.Splits = nil
+	}
+	if len(req.Splits) > 0 {
+		if req.CatBudID != nil {
+			c.JSON(400, gin.H{"error": "a split transaction cannot also have a cat_bud_id"})
+			return
+		}
+		splits, ok := s.splitsFromRequest(c, transaction.AiboID, req.Splits)
+		if !ok {
+			return
+		}
+		transaction.CatBudID = nil
+		transaction.Splits = splits
+	}
+	if err := transaction.ValidateSplits(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.TransactionRepository.UpdateTransaction(transaction)
+	if errors.Is(err, database.ErrNoExchangeRate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, database.ErrDebtPaymentTransaction) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to update transaction", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update transaction"})
+		return
+	}
+
+	c.JSON(200, types.TransactionResponse{Transaction: *transaction})
+}
+
+// DeleteTransaction deletes a transaction of the aibo that made the request.
+//
+// The derived balances are recalculated along with it. When the transaction records a debt
+// payment, the payment is deleted too and the balance of the debt goes back up.
+//
+// If the transaction does not exist or belongs to another aibo, it returns a 404 error.
+// @Summary Delete a transaction
+// @Description Delete a ledger entry of the authenticated aibo
+// @Tags transactions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Transaction ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /transactions/{id} [delete]
+func (s *TransactionService) DeleteTransaction(c *gin.Context) {
+	transaction, ok := s.loadTransaction(c)
+	if !ok {
+		return
+	}
+
+	if err := s.TransactionRepository.DeleteTransaction(transaction); err != nil {
+		slog.Error("Failed to delete transaction", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete transaction"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Transaction deleted successfully"})
+}
+
+// splitsFromRequest builds the split lines of a transaction and checks that their CatBuds belong
+// to the aibo.
+//
+// On failure, the response is already written and false is returned.
+func (s *TransactionService) splitsFromRequest(c *gin.Context, aiboID uuid.UUID, lines []types.TransactionSplitRequest) ([]types.TransactionSplit, bool) {
+	splits := make([]types.TransactionSplit, 0, len(lines))
+	for _, line := range lines {
+		if line.CatBudID != nil && !canBookOnCatBud(c, s.CatBudRepository, aiboID, *line.CatBudID) {
+			return nil, false
+		}
+		splits = append(splits, types.TransactionSplit{
+			CatBudID: line.CatBudID,
+			Amount:   line.Amount,
+			Note:     line.Note,
+		})
+	}
+	return splits, true
+}
+
+// loadTransaction fetches the transaction designated by the ":id" path parameter and
+// checks that it belongs to the aibo that made the request.
+//
+// On failure, the response is already written and false is returned.
+func (s *TransactionService) loadTransaction(c *gin.Context) (*types.Transaction, bool) {
+	aiboID, ok := currentAiboID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := snowflake.ParseString(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "transaction not found"})
+		return nil, false
+	}
+
+	transaction, err := s.TransactionRepository.GetTransactionByID(id)
+	if err != nil || transaction.AiboID != aiboID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to get transaction", "error", err)
+		}
+		c.JSON(404, gin.H{"error": "transaction not found"})
+		return nil, false
+	}
+
+	return transaction, true
+}
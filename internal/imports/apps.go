@@ -0,0 +1,466 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxMigrationRows is the largest number of transactions imported from the export of another
+// budgeting app, years of history included.
+const MaxMigrationRows = 50000
+
+// ynabSplit is the prefix YNAB writes in the memo of each line of a split transaction.
+var ynabSplit = regexp.MustCompile(`^\(Split \d+/\d+\)\s*`)
+
+// mintGroups maps the default categories of Mint to their parent category.
+var mintGroups = map[string]string{}
+
+func init() {
+	for group, categories := range map[string][]string{
+		"Auto & Transport":  {"Auto Insurance", "Auto Payment", "Gas & Fuel", "Parking", "Public Transportation", "Ride Share", "Service & Parts", "Tolls"},
+		"Bills & Utilities": {"Home Phone", "Internet", "Mobile Phone", "Television", "Utilities"},
+		"Business Services": {"Advertising", "Legal", "Office Supplies", "Printing", "Shipping"},
+		"Education":         {"Books & Supplies", "Student Loan", "Tuition"},
+		"Entertainment":     {"Amusement", "Arts", "Movies & DVDs", "Music", "Newspapers & Magazines"},
+		"Fees & Charges":    {"ATM Fee", "Bank Fee", "Finance Charge", "Late Fee", "Service Fee", "Trade Commissions"},
+		"Financial":         {"Financial Advisor", "Life Insurance"},
+		"Food & Dining":     {"Alcohol & Bars", "Coffee Shops", "Fast Food", "Food Delivery", "Groceries", "Restaurants"},
+		"Gifts & Donations": {"Charity", "Gift"},
+		"Health & Fitness":  {"Dentist", "Doctor", "Eyecare", "Gym", "Health Insurance", "Pharmacy", "Sports"},
+		"Home":              {"Furnishings", "Home Improvement", "Home Insurance", "Home Services", "Home Supplies", "Lawn & Garden", "Mortgage & Rent"},
+		"Income":            {"Bonus", "Interest Income", "Paycheck", "Reimbursement", "Rental Income", "Returned Purchase"},
+		"Investments":       {"Buy", "Deposit", "Dividend & Cap Gains", "Sell", "Withdrawal"},
+		"Kids":              {"Allowance", "Baby Supplies", "Babysitter & Daycare", "Child Support", "Kids Activities", "Toys"},
+		"Loans":             {"Loan Fees and Charges", "Loan Insurance", "Loan Interest", "Loan Payment", "Loan Principal"},
+		"Personal Care":     {"Hair", "Laundry", "Spa & Massage"},
+		"Pets":              {"Pet Food & Supplies", "Pet Grooming", "Veterinary"},
+		"Shopping":          {"Books", "Clothing", "Electronics & Software", "Hobbies", "Sporting Goods"},
+		"Taxes":             {"Federal Tax", "Local Tax", "Property Tax", "Sales Tax", "State Tax"},
+		"Transfer":          {"Credit Card Payment", "Transfer for Cash Spending"},
+		"Travel":            {"Air Travel", "Hotel", "Rental Car & Taxi", "Vacation"},
+		"Uncategorized":     {"Cash & ATM", "Check"},
+	} {
+		mintGroups[strings.ToLower(group)] = group
+		for _, category := range categories {
+			mintGroups[strings.ToLower(category)] = group
+		}
+	}
+}
+
+// Migration is what was read from the export of another budgeting app.
+type Migration struct {
+	// Categories are the categories of the app, with their groups and monthly budgets, in the
+	// order they were found.
+	Categories []types.ImportCategory
+	// Rows are the transactions, in the order of the file. Their category is one of the
+	// Categories, or empty.
+	Rows []types.ImportRow
+	// Unmapped are the items of the export left out of the import.
+	Unmapped []types.ImportUnmapped
+}
+
+// category adds a category, unless it is already there, and returns it.
+func (m *Migration) category(group, name string) *types.ImportCategory {
+	key := types.ImportCategoryKey(group, name)
+	for i := range m.Categories {
+		if m.Categories[i].Key() == key {
+			return &m.Categories[i]
+		}
+	}
+	m.Categories = append(m.Categories, types.ImportCategory{Group: group, Name: name})
+	return &m.Categories[len(m.Categories)-1]
+}
+
+// leaveOut counts a row of an item left out of the import.
+func (m *Migration) leaveOut(kind types.ImportUnmappedKind, name, reason string) {
+	for i := range m.Unmapped {
+		if m.Unmapped[i].Kind == kind && m.Unmapped[i].Name == name {
+			m.Unmapped[i].Count++
+			return
+		}
+	}
+	m.Unmapped = append(m.Unmapped, types.ImportUnmapped{Kind: kind, Name: name, Count: 1, Reason: reason})
+}
+
+// appTable is a CSV export of a budgeting app, read by the names of its columns.
+type appTable struct {
+	columns map[string]int
+	records []csvRecord
+}
+
+// readAppTable reads a CSV export whose first row names the columns.
+func readAppTable(data []byte) (*appTable, error) {
+	text, _, err := decode(data, "")
+	if err != nil {
+		return nil, err
+	}
+	records, err := readCSV(text, detectDelimiter(text))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file has no rows")
+	}
+	if len(records)-1 > MaxMigrationRows {
+		return nil, fmt.Errorf("the file has more than %d rows", MaxMigrationRows)
+	}
+	table := &appTable{columns: make(map[string]int), records: records[1:]}
+	for i, name := range records[0].fields {
+		table.columns[normalizeName(name)] = i
+	}
+	return table, nil
+}
+
+// has reports whether the table has all the columns.
+func (t *appTable) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := t.columns[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// cell returns the value of the first of the columns the table has, or an empty string.
+func (t *appTable) cell(record csvRecord, names ...string) string {
+	for _, name := range names {
+		if i, ok := t.columns[name]; ok {
+			if i < len(record.fields) {
+				return strings.TrimSpace(record.fields[i])
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// values returns the non-empty values of the columns.
+func (t *appTable) values(names ...string) []string {
+	var values []string
+	for _, record := range t.records {
+		for _, name := range names {
+			if value := t.cell(record, name); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// dateFormat returns the given date format, or the one detected from the dates of the column.
+func (t *appTable) dateFormat(format, column string) (string, error) {
+	if format != "" {
+		return format, nil
+	}
+	if format = detectDateFormat(t.values(column)); format == "" {
+		return "", errors.New("the date format could not be detected, set date_format")
+	}
+	return format, nil
+}
+
+// appRow builds the row of a transaction of a budgeting app, with a signed amount.
+func appRow(line int, date, dateFormat string, amount types.Money, payee, note string, currency types.Currency) types.ImportRow {
+	row := types.ImportRow{
+		Line:     line,
+		Payee:    truncate(strings.Join(strings.Fields(payee), " "), maxPayeeLength),
+		Note:     note,
+		Currency: currency,
+		Status:   types.ImportRowNew,
+	}
+	parsed, err := parseDate(date, dateFormat)
+	if err != nil {
+		row.Invalid("date %q does not match %s", date, dateFormat)
+		return row
+	}
+	row.Date = parsed
+	setSignedAmount(&row, amount)
+	return row
+}
+
+// ParseYNAB reads the export of a YNAB budget: the ZIP file holding its register and its plan, or
+// the register alone, as CSV.
+//
+// The categories keep their groups, and their budget is the most recent amount assigned to them in
+// the plan. Transfers between accounts, starting balances and credit card payments are left out.
+// The inflows to assign are imported as income without category.
+func ParseYNAB(data []byte, currency types.Currency, dateFormat string) (*Migration, error) {
+	register, plan := data, []byte(nil)
+	if isZip(data) {
+		files, err := readZip(data)
+		if err != nil {
+			return nil, err
+		}
+		register, plan = nil, nil
+		for name, content := range files {
+			switch {
+			case strings.HasSuffix(name, "register.csv"):
+				register = content
+			case strings.HasSuffix(name, "plan.csv") || strings.HasSuffix(name, "budget.csv"):
+				plan = content
+			}
+		}
+		if register == nil {
+			return nil, errors.New("the file holds no YNAB register")
+		}
+	}
+
+	table, err := readAppTable(register)
+	if err != nil {
+		return nil, err
+	}
+	if !table.has("date", "payee", "outflow", "inflow") {
+		return nil, errors.New("the file is not a YNAB register")
+	}
+	if dateFormat, err = table.dateFormat(dateFormat, "date"); err != nil {
+		return nil, err
+	}
+	decimal := detectDecimalSeparator(table.values("outflow", "inflow"))
+
+	migration := &Migration{Rows: make([]types.ImportRow, 0, len(table.records))}
+	for _, record := range table.records {
+		account, payee := table.cell(record, "account"), table.cell(record, "payee")
+		group := table.cell(record, "category group", "master category")
+		category := table.cell(record, "category", "sub category")
+		switch {
+		case strings.HasPrefix(payee, "Transfer : ") && category == "":
+			migration.leaveOut(types.ImportUnmappedTransfer, account, "transfers between accounts are not spending")
+			continue
+		case payee == "Starting Balance":
+			migration.leaveOut(types.ImportUnmappedStartingBalance, account, "the starting balance of an account is not income")
+			continue
+		case strings.EqualFold(group, "Credit Card Payments"):
+			migration.leaveOut(types.ImportUnmappedCategory, group+": "+category, "credit card payments move money between accounts")
+			continue
+		}
+
+		outflow, errOut := optionalAmount(table.cell(record, "outflow"), decimal)
+		inflow, errIn := optionalAmount(table.cell(record, "inflow"), decimal)
+		row := appRow(record.line, table.cell(record, "date"), dateFormat, inflow.Abs()-outflow.Abs(), payee, ynabSplit.ReplaceAllString(table.cell(record, "memo"), ""), currency)
+		if errOut != nil || errIn != nil {
+			row.Invalid("amount is not a number")
+		}
+		if isYNABInflow(group, category) {
+			group, category = "", ""
+		}
+		if category != "" {
+			migration.category(group, category)
+			row.CategoryGroup, row.Category = group, category
+		}
+		migration.Rows = append(migration.Rows, row)
+	}
+
+	if plan != nil {
+		if err := readYNABPlan(plan, migration); err != nil {
+			return nil, err
+		}
+	}
+	return migration, nil
+}
+
+// readYNABPlan adds the categories of a YNAB plan with their most recent non-zero assigned
+// amount.
+func readYNABPlan(data []byte, migration *Migration) error {
+	table, err := readAppTable(data)
+	if err != nil {
+		return err
+	}
+	if !table.has("month", "category") {
+		return errors.New("the file is not a YNAB plan")
+	}
+	decimal := detectDecimalSeparator(table.values("assigned", "budgeted"))
+
+	months := make(map[string]time.Time)
+	for _, record := range table.records {
+		group := table.cell(record, "category group", "master category")
+		category := table.cell(record, "category", "sub category")
+		if category == "" || isYNABInflow(group, category) || strings.EqualFold(group, "Credit Card Payments") {
+			continue
+		}
+		if strings.EqualFold(group, "Hidden Categories") {
+			migration.leaveOut(types.ImportUnmappedCategory, category, "the category is hidden in YNAB")
+			continue
+		}
+
+		imported := migration.category(group, category)
+		assigned, err := parseAmount(table.cell(record, "assigned", "budgeted"), decimal)
+		if err != nil || assigned <= 0 {
+			continue
+		}
+		// The months are in order; a month that cannot be read counts as the latest.
+		month, _ := time.Parse("Jan 2006", table.cell(record, "month"))
+		if last, ok := months[imported.Key()]; ok && month.Before(last) {
+			continue
+		}
+		months[imported.Key()] = month
+		imported.Budget = &assigned
+	}
+	return nil
+}
+
+// optionalAmount parses an amount, zero when the value is empty.
+func optionalAmount(value, decimal string) (types.Money, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return parseAmount(value, decimal)
+}
+
+// isYNABInflow reports whether a YNAB category receives the income to assign.
+func isYNABInflow(group, category string) bool {
+	return strings.EqualFold(group, "Inflow") || strings.HasPrefix(category, "Inflow:") ||
+		category == "To be Budgeted" || category == "Ready to Assign"
+}
+
+// ParseMint reads the transactions export of Mint.
+//
+// The default categories of Mint are placed under their parent category; the custom ones are
+// top-level. Transfers, credit card payments and investments are left out, and the income
+// categories are imported as income without category.
+func ParseMint(data []byte, currency types.Currency, dateFormat string) (*Migration, error) {
+	table, err := readAppTable(data)
+	if err != nil {
+		return nil, err
+	}
+	if !table.has("date", "description", "amount", "transaction type") {
+		return nil, errors.New("the file is not a Mint export")
+	}
+	if dateFormat, err = table.dateFormat(dateFormat, "date"); err != nil {
+		return nil, err
+	}
+	decimal := detectDecimalSeparator(table.values("amount"))
+
+	migration := &Migration{Rows: make([]types.ImportRow, 0, len(table.records))}
+	for _, record := range table.records {
+		category := table.cell(record, "category")
+		group := mintGroups[strings.ToLower(category)]
+		switch group {
+		case "Transfer", "Investments":
+			migration.leaveOut(types.ImportUnmappedTransfer, category, "transfers between accounts are not spending")
+			continue
+		case "Income":
+			migration.leaveOut(types.ImportUnmappedCategory, category, "income categories are not budgets, the transactions are imported without category")
+			group, category = "", ""
+		case "Uncategorized":
+			group, category = "", ""
+		}
+		if strings.EqualFold(category, "Hide from Budgets & Trends") {
+			migration.leaveOut(types.ImportUnmappedCategory, category, "the transactions are hidden in Mint")
+			continue
+		}
+		if strings.EqualFold(group, category) {
+			group = ""
+		}
+
+		amount, err := parseAmount(table.cell(record, "amount"), decimal)
+		if err == nil && strings.EqualFold(table.cell(record, "transaction type"), "debit") {
+			amount = -amount.Abs()
+		}
+		note := table.cell(record, "notes")
+		if note == "" && table.cell(record, "original description") != table.cell(record, "description") {
+			note = table.cell(record, "original description")
+		}
+		row := appRow(record.line, table.cell(record, "date"), dateFormat, amount, table.cell(record, "description"), note, currency)
+		if err != nil {
+			row.Invalid("amount %q is not a number", table.cell(record, "amount"))
+		}
+		if category != "" {
+			migration.category(group, category)
+			row.CategoryGroup, row.Category = group, category
+		}
+		migration.Rows = append(migration.Rows, row)
+	}
+	return migration, nil
+}
+
+// ParseActual reads the transactions of Actual Budget exported as CSV. The full export of a
+// budget, a ZIP file holding its SQLite database, cannot be read.
+//
+// The categories are top-level, since the CSV export does not give their group. Transfers, whose
+// payee is another account of the file, and starting balances are left out; the income category
+// is imported as income without category.
+func ParseActual(data []byte, currency types.Currency, dateFormat string) (*Migration, error) {
+	if isZip(data) {
+		return nil, errors.New("the full export of an Actual Budget budget is not supported, export its transactions as CSV")
+	}
+	table, err := readAppTable(data)
+	if err != nil {
+		return nil, err
+	}
+	if !table.has("account", "date", "payee", "category", "amount") {
+		return nil, errors.New("the file is not an Actual Budget export")
+	}
+	if dateFormat, err = table.dateFormat(dateFormat, "date"); err != nil {
+		return nil, err
+	}
+	decimal := detectDecimalSeparator(table.values("amount"))
+
+	accounts := make(map[string]bool)
+	for _, record := range table.records {
+		accounts[strings.ToLower(table.cell(record, "account"))] = true
+	}
+
+	migration := &Migration{Rows: make([]types.ImportRow, 0, len(table.records))}
+	for _, record := range table.records {
+		account, payee, category := table.cell(record, "account"), table.cell(record, "payee"), table.cell(record, "category")
+		switch {
+		case category == "" && (accounts[strings.ToLower(payee)] || strings.HasPrefix(payee, "Transfer")):
+			migration.leaveOut(types.ImportUnmappedTransfer, account, "transfers between accounts are not spending")
+			continue
+		case strings.EqualFold(payee, "Starting Balance") || strings.EqualFold(category, "Starting Balances"):
+			migration.leaveOut(types.ImportUnmappedStartingBalance, account, "the starting balance of an account is not income")
+			continue
+		case strings.EqualFold(category, "Income"):
+			migration.leaveOut(types.ImportUnmappedCategory, category, "income categories are not budgets, the transactions are imported without category")
+			category = ""
+		}
+
+		amount, err := parseAmount(table.cell(record, "amount"), decimal)
+		row := appRow(record.line, table.cell(record, "date"), dateFormat, amount, payee, table.cell(record, "notes"), currency)
+		if err != nil {
+			row.Invalid("amount %q is not a number", table.cell(record, "amount"))
+		}
+		if category != "" {
+			migration.category("", category)
+			row.Category = category
+		}
+		migration.Rows = append(migration.Rows, row)
+	}
+	return migration, nil
+}
+
+// isZip reports whether the data is a ZIP file.
+func isZip(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// readZip returns the content of the files of a ZIP file by their lowercased name.
+func readZip(data []byte) (map[string][]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("the file is not a valid ZIP file")
+	}
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || file.UncompressedSize64 > 100<<20 {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, errors.New("the file is not a valid ZIP file")
+		}
+		content, err := io.ReadAll(io.LimitReader(r, 100<<20))
+		r.Close()
+		if err != nil {
+			return nil, errors.New("the file is not a valid ZIP file")
+		}
+		files[strings.ToLower(file.Name)] = content
+	}
+	return files, nil
+}
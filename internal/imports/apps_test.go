@@ -0,0 +1,229 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipFiles returns a ZIP file holding the files.
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkMigration compares the categories and the items left out of a migration with the wanted
+// ones.
+func checkMigration(t *testing.T, migration *Migration, categories []types.ImportCategory, unmapped []types.ImportUnmapped) {
+	t.Helper()
+	if len(migration.Categories) != len(categories) {
+		t.Fatalf("Categories = %+v, want %+v", migration.Categories, categories)
+	}
+	for i, want := range categories {
+		got := migration.Categories[i]
+		if got.Group != want.Group || got.Name != want.Name || (got.Budget == nil) != (want.Budget == nil) ||
+			want.Budget != nil && *got.Budget != *want.Budget {
+			t.Errorf("Categories[%d] = %+v with budget %v, want %+v with budget %v", i, got, got.Budget, want, want.Budget)
+		}
+	}
+	if len(migration.Unmapped) != len(unmapped) {
+		t.Fatalf("Unmapped = %+v, want %+v", migration.Unmapped, unmapped)
+	}
+	for i, want := range unmapped {
+		if got := migration.Unmapped[i]; got.Kind != want.Kind || got.Name != want.Name || got.Count != want.Count {
+			t.Errorf("Unmapped[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+const ynabRegister = `"Account","Date","Payee","Category Group","Category","Memo","Outflow","Inflow"
+"Checking","01/05/2024","Grocer","Everyday","Groceries","","$45.10","$0.00"
+"Checking","01/06/2024","Employer","Inflow","Ready to Assign","","$0.00","$2,000.00"
+"Checking","01/07/2024","Transfer : Savings","","","","$100.00","$0.00"
+"Savings","01/01/2024","Starting Balance","Inflow","Ready to Assign","","$0.00","$500.00"
+"Visa","01/08/2024","Bank","Credit Card Payments","Visa","","$200.00","$0.00"
+"Checking","01/09/2024","Store","Everyday","Household","(Split 1/2) Soap","$5.00","$0.00"
+"Checking","01/09/2024","Store","Everyday","Groceries","(Split 2/2) Bread","$3.00","$0.00"
+"Checking","01/31/2024","Refund","Everyday","Groceries","","abc","$0.00"
+`
+
+const ynabPlan = `"Month","Category Group","Category","Budgeted"
+"Dec 2023","Everyday","Groceries","$400.00"
+"Jan 2024","Everyday","Groceries","$450.00"
+"Feb 2024","Everyday","Groceries","$0.00"
+"Jan 2024","Everyday","Household","$50.00"
+"Jan 2024","Fun","Games","$20.00"
+"Jan 2024","Hidden Categories","Old","$10.00"
+"Jan 2024","Inflow","Ready to Assign","$0.00"
+"Jan 2024","Credit Card Payments","Visa","$200.00"
+`
+
+func TestParseYNAB(t *testing.T) {
+	rows := []types.ImportRow{
+		{Line: 2, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 4510, Currency: "USD", Payee: "Grocer",
+			CategoryGroup: "Everyday", Category: "Groceries", Status: types.ImportRowNew},
+		{Line: 3, Date: date(2024, 1, 6), Kind: types.TransactionIncome, Amount: 200000, Currency: "USD", Payee: "Employer", Status: types.ImportRowNew},
+		{Line: 7, Date: date(2024, 1, 9), Kind: types.TransactionExpense, Amount: 500, Currency: "USD", Payee: "Store", Note: "Soap",
+			CategoryGroup: "Everyday", Category: "Household", Status: types.ImportRowNew},
+		{Line: 8, Date: date(2024, 1, 9), Kind: types.TransactionExpense, Amount: 300, Currency: "USD", Payee: "Store", Note: "Bread",
+			CategoryGroup: "Everyday", Category: "Groceries", Status: types.ImportRowNew},
+		{Line: 9, Date: date(2024, 1, 31), Currency: "USD", Payee: "Refund", CategoryGroup: "Everyday", Category: "Groceries",
+			Status: types.ImportRowInvalid, Error: "amount is not a number"},
+	}
+	registerUnmapped := []types.ImportUnmapped{
+		{Kind: types.ImportUnmappedTransfer, Name: "Checking", Count: 1},
+		{Kind: types.ImportUnmappedStartingBalance, Name: "Savings", Count: 1},
+		{Kind: types.ImportUnmappedCategory, Name: "Credit Card Payments: Visa", Count: 1},
+	}
+
+	tests := []struct {
+		name           string
+		data           []byte
+		wantCategories []types.ImportCategory
+		wantUnmapped   []types.ImportUnmapped
+	}{
+		{
+			name: "register",
+			data: []byte(ynabRegister),
+			wantCategories: []types.ImportCategory{
+				{Group: "Everyday", Name: "Groceries"},
+				{Group: "Everyday", Name: "Household"},
+			},
+			wantUnmapped: registerUnmapped,
+		},
+		{
+			name: "register and plan",
+			data: zipFiles(t, map[string]string{"My Budget/My Budget - Register.csv": ynabRegister, "My Budget/My Budget - Plan.csv": ynabPlan}),
+			wantCategories: []types.ImportCategory{
+				{Group: "Everyday", Name: "Groceries", Budget: moneyPtr(45000)},
+				{Group: "Everyday", Name: "Household", Budget: moneyPtr(5000)},
+				{Group: "Fun", Name: "Games", Budget: moneyPtr(2000)},
+			},
+			wantUnmapped: append(registerUnmapped, types.ImportUnmapped{Kind: types.ImportUnmappedCategory, Name: "Old", Count: 1}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migration, err := ParseYNAB(tt.data, "USD", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRows(t, migration.Rows, rows)
+			checkMigration(t, migration, tt.wantCategories, tt.wantUnmapped)
+		})
+	}
+}
+
+func TestParseMint(t *testing.T) {
+	data := `"Date","Description","Original Description","Amount","Transaction Type","Category","Account Name","Labels","Notes"
+"1/05/2024","Whole Foods","WHOLEFDS #123","45.10","debit","Groceries","Visa","",""
+"1/06/2024","Employer","EMPLOYER PAYROLL","2000.00","credit","Paycheck","Checking","",""
+"1/07/2024","Transfer","TRANSFER","100.00","debit","Transfer","Checking","",""
+"1/08/2024","Visa","VISA PAYMENT","200.00","debit","Credit Card Payment","Checking","",""
+"1/09/2024","Etsy","Etsy","30.00","debit","Crafts","Visa","","gift"
+"1/10/2024","ATM","ATM","60.00","debit","Cash & ATM","Checking","",""
+"1/11/2024","Hidden","Hidden","5.00","debit","Hide from Budgets & Trends","Checking","",""
+"1/12/2024","Shop","Shop","x","debit","Shopping","Checking","",""
+"1/31/2024","Refund","Refund","10.00","credit","Shopping","Visa","",""
+`
+	migration, err := ParseMint([]byte(data), "USD", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, migration.Rows, []types.ImportRow{
+		{Line: 2, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 4510, Currency: "USD", Payee: "Whole Foods", Note: "WHOLEFDS #123",
+			CategoryGroup: "Food & Dining", Category: "Groceries", Status: types.ImportRowNew},
+		{Line: 3, Date: date(2024, 1, 6), Kind: types.TransactionIncome, Amount: 200000, Currency: "USD", Payee: "Employer", Note: "EMPLOYER PAYROLL", Status: types.ImportRowNew},
+		{Line: 6, Date: date(2024, 1, 9), Kind: types.TransactionExpense, Amount: 3000, Currency: "USD", Payee: "Etsy", Note: "gift", Category: "Crafts", Status: types.ImportRowNew},
+		{Line: 7, Date: date(2024, 1, 10), Kind: types.TransactionExpense, Amount: 6000, Currency: "USD", Payee: "ATM", Status: types.ImportRowNew},
+		{Line: 9, Date: date(2024, 1, 12), Currency: "USD", Payee: "Shop", Category: "Shopping", Status: types.ImportRowInvalid, Error: `amount "x" is not a number`},
+		{Line: 10, Date: date(2024, 1, 31), Kind: types.TransactionIncome, Amount: 1000, Currency: "USD", Payee: "Refund", Category: "Shopping", Status: types.ImportRowNew},
+	})
+	checkMigration(t, migration, []types.ImportCategory{
+		{Group: "Food & Dining", Name: "Groceries"},
+		{Name: "Crafts"},
+		{Name: "Shopping"},
+	}, []types.ImportUnmapped{
+		{Kind: types.ImportUnmappedCategory, Name: "Paycheck", Count: 1},
+		{Kind: types.ImportUnmappedTransfer, Name: "Transfer", Count: 1},
+		{Kind: types.ImportUnmappedTransfer, Name: "Credit Card Payment", Count: 1},
+		{Kind: types.ImportUnmappedCategory, Name: "Hide from Budgets & Trends", Count: 1},
+	})
+}
+
+func TestParseActual(t *testing.T) {
+	data := `Account,Date,Payee,Notes,Category,Amount,Split_Amount,Cleared
+Checking,2024-01-05,Grocer,,Food,-45.10,0,Cleared
+Checking,2024-01-06,Employer,,Income,2000.00,0,Cleared
+Checking,2024-01-07,Savings,,,-100.00,0,Cleared
+Savings,2024-01-07,Checking,,,100.00,0,Cleared
+Savings,2024-01-01,Starting Balance,,Starting Balances,500.00,0,Cleared
+Checking,2024-01-08,Shop,birthday,Fun,-20.00,0,Cleared
+Checking,2024-01-09,Shop,,Fun,x,0,Cleared
+Checking,2024-01-10,Unknown,,,-3.00,0,Cleared
+`
+	migration, err := ParseActual([]byte(data), "EUR", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, migration.Rows, []types.ImportRow{
+		{Line: 2, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 4510, Currency: "EUR", Payee: "Grocer", Category: "Food", Status: types.ImportRowNew},
+		{Line: 3, Date: date(2024, 1, 6), Kind: types.TransactionIncome, Amount: 200000, Currency: "EUR", Payee: "Employer", Status: types.ImportRowNew},
+		{Line: 7, Date: date(2024, 1, 8), Kind: types.TransactionExpense, Amount: 2000, Currency: "EUR", Payee: "Shop", Note: "birthday", Category: "Fun", Status: types.ImportRowNew},
+		{Line: 8, Date: date(2024, 1, 9), Currency: "EUR", Payee: "Shop", Category: "Fun", Status: types.ImportRowInvalid, Error: `amount "x" is not a number`},
+		{Line: 9, Date: date(2024, 1, 10), Kind: types.TransactionExpense, Amount: 300, Currency: "EUR", Payee: "Unknown", Status: types.ImportRowNew},
+	})
+	checkMigration(t, migration, []types.ImportCategory{{Name: "Food"}, {Name: "Fun"}}, []types.ImportUnmapped{
+		{Kind: types.ImportUnmappedCategory, Name: "Income", Count: 1},
+		{Kind: types.ImportUnmappedTransfer, Name: "Checking", Count: 1},
+		{Kind: types.ImportUnmappedTransfer, Name: "Savings", Count: 1},
+		{Kind: types.ImportUnmappedStartingBalance, Name: "Savings", Count: 1},
+	})
+}
+
+func TestParseAppErrors(t *testing.T) {
+	parse := map[string]func([]byte, types.Currency, string) (*Migration, error){
+		"ynab": ParseYNAB, "mint": ParseMint, "actual": ParseActual,
+	}
+	tests := []struct {
+		name string
+		app  string
+		data []byte
+		want string
+	}{
+		{"ynab empty", "ynab", nil, "the file has no rows"},
+		{"ynab not a register", "ynab", []byte("Date,Amount\n2024-01-05,1.00\n"), "the file is not a YNAB register"},
+		{"ynab invalid zip", "ynab", []byte("PK\x03\x04garbage"), "the file is not a valid ZIP file"},
+		{"ynab zip without register", "ynab", zipFiles(t, map[string]string{"Budget - Plan.csv": ynabPlan}), "the file holds no YNAB register"},
+		{"ynab invalid plan", "ynab", zipFiles(t, map[string]string{"Budget - Register.csv": ynabRegister, "Budget - Plan.csv": "a,b\n1,2\n"}),
+			"the file is not a YNAB plan"},
+		{"ynab unknown date format", "ynab", []byte("Date,Payee,Outflow,Inflow\nyesterday,A,1.00,\n"), "the date format could not be detected"},
+		{"mint not an export", "mint", []byte(ynabRegister), "the file is not a Mint export"},
+		{"actual zip", "actual", zipFiles(t, map[string]string{"db.sqlite": ""}), "the full export of an Actual Budget budget is not supported"},
+		{"actual not an export", "actual", []byte(ynabRegister), "the file is not an Actual Budget export"},
+	}
+	for _, tt := range tests {
+		_, err := parse[tt.app](tt.data, "USD", "")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func moneyPtr(m types.Money) *types.Money {
+	return &m
+}
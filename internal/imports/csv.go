@@ -0,0 +1,683 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxRows is the largest number of rows imported from a single file.
+const MaxRows = 5000
+
+// maxPayeeLength is the length of the payee column of the transactions.
+const maxPayeeLength = 255
+
+// delimiters are the field delimiters tried when the format does not give one, in order of
+// preference.
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// dateFormats are the keys of types.DateFormats in the order they are tried when the format does
+// not give one. The day comes before the month when a file reads both ways.
+var dateFormats = []string{
+	"YYYY-MM-DD", "YYYY/MM/DD", "YYYYMMDD",
+	"DD.MM.YYYY", "D.M.YYYY",
+	"DD/MM/YYYY", "MM/DD/YYYY", "D/M/YYYY", "M/D/YYYY",
+	"DD-MM-YYYY", "MM-DD-YYYY",
+	"DD.MM.YY", "DD/MM/YY", "MM/DD/YY",
+}
+
+// columnNames are the header names recognized for each column: the exact names first, then the
+// fragments a longer name may contain.
+var columnNames = map[string]struct{ exact, contains []string }{
+	"date": {
+		exact:    []string{"date", "booking date", "transaction date", "posting date", "posted date", "datum", "buchungstag", "buchungsdatum", "date opération", "date operation", "fecha", "data"},
+		contains: []string{"date", "datum", "fecha"},
+	},
+	"amount": {
+		exact:    []string{"amount", "betrag", "montant", "importe", "importo", "bedrag", "kwota"},
+		contains: []string{"amount", "betrag", "montant", "importe"},
+	},
+	"debit": {
+		exact:    []string{"debit", "débit", "withdrawal", "withdrawals", "paid out", "money out", "out", "soll", "ausgang", "cargo"},
+		contains: []string{"debit", "débit", "withdraw", "paid out", "money out"},
+	},
+	"credit": {
+		exact:    []string{"credit", "crédit", "deposit", "deposits", "paid in", "money in", "in", "haben", "eingang", "abono"},
+		contains: []string{"credit", "crédit", "deposit", "paid in", "money in"},
+	},
+	"currency": {
+		exact:    []string{"currency", "ccy", "währung", "devise", "moneda"},
+		contains: []string{"currency", "währung"},
+	},
+	"category": {
+		exact:    []string{"category", "kategorie", "catégorie", "categoría", "categoria"},
+		contains: []string{"categor", "kategor", "catégor"},
+	},
+	"payee": {
+		exact:    []string{"payee", "name", "merchant", "counterparty", "beneficiary", "recipient", "description", "empfänger", "auftraggeber/empfänger", "zahlungsempfänger", "bénéficiaire", "libellé", "beschreibung", "concepto"},
+		contains: []string{"payee", "merchant", "counterpart", "beneficiary", "recipient", "empfänger", "name"},
+	},
+	"note": {
+		exact:    []string{"memo", "note", "notes", "reference", "details", "verwendungszweck", "purpose", "remittance information", "description", "libellé"},
+		contains: []string{"memo", "reference", "verwendungszweck", "note"},
+	},
+}
+
+// Statement is what was read from an imported file.
+type Statement struct {
+	// Format is the format a CSV file was read with, detected fields included, so that it can be
+	// saved as an ImportMapping.
+	Format types.CSVFormat
+	// Account is the bank account the statement is of, as far as the file tells, or nil. Only its
+	// number, bank, type and currency are set.
+	Account *types.ImportAccount
+	// Rows are the transactions of the file, in the order of the file.
+	Rows []types.ImportRow
+}
+
+// csvRecord is a record of a CSV file with the line it starts on.
+type csvRecord struct {
+	line   int
+	fields []string
+}
+
+// csvColumns are the positions of the columns of a CSV file, -1 for the missing ones.
+type csvColumns struct {
+	date, amount, debit, credit, payee, note, currency, category int
+}
+
+// ParseCSV reads the CSV export of a bank with the given format, detecting the fields the format
+// leaves empty: the encoding, the delimiter, the lines to skip before the table, the header, the
+// columns from their names or their content, the date format and the decimal separator.
+//
+// A row that cannot be read is returned as invalid, with the reason. An error is returned when
+// the file as a whole cannot be read, such as when no date or amount column is found.
+func ParseCSV(data []byte, format types.CSVFormat) (*Statement, error) {
+	text, encoding, err := decode(data, format.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	format.Encoding = encoding
+
+	for i := 0; i < format.SkipRows; i++ {
+		_, rest, found := strings.Cut(text, "\n")
+		if !found {
+			return nil, errors.New("the file has no rows")
+		}
+		text = rest
+	}
+
+	if format.Delimiter == "" {
+		format.Delimiter = string(detectDelimiter(text))
+	}
+	delimiter, _ := utf8.DecodeRuneInString(format.Delimiter)
+	records, err := readCSV(text, delimiter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		records[i].line += format.SkipRows
+	}
+
+	// Banks often write the account and the period above the table, on shorter lines.
+	if start := tableStart(records); start > 0 {
+		format.SkipRows = records[start].line - 1
+		records = records[start:]
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file has no rows")
+	}
+
+	if format.HasHeader == nil {
+		header := !rowHasDate(records[0].fields) && (len(records) == 1 || rowHasDate(records[1].fields))
+		format.HasHeader = &header
+	}
+	var header []string
+	if *format.HasHeader {
+		header = records[0].fields
+		records = records[1:]
+	}
+	if len(records) > MaxRows {
+		return nil, fmt.Errorf("the file has more than %d rows", MaxRows)
+	}
+
+	columns, err := resolveColumns(&format, header, records)
+	if err != nil {
+		return nil, err
+	}
+
+	if format.DateFormat == "" {
+		format.DateFormat = detectDateFormat(columnValues(records, columns.date))
+		if format.DateFormat == "" {
+			return nil, errors.New("the date format could not be detected, set date_format")
+		}
+	}
+	if format.DecimalSeparator == "" {
+		var amounts []string
+		for _, column := range []int{columns.amount, columns.debit, columns.credit} {
+			amounts = append(amounts, columnValues(records, column)...)
+		}
+		format.DecimalSeparator = detectDecimalSeparator(amounts)
+	}
+
+	statement := &Statement{Format: format, Rows: make([]types.ImportRow, 0, len(records))}
+	for _, record := range records {
+		statement.Rows = append(statement.Rows, parseCSVRow(record, columns, &format))
+	}
+	return statement, nil
+}
+
+// parseCSVRow builds the transaction of a record.
+func parseCSVRow(record csvRecord, columns csvColumns, format *types.CSVFormat) types.ImportRow {
+	cell := func(column int) string {
+		if column < 0 || column >= len(record.fields) {
+			return ""
+		}
+		return strings.TrimSpace(record.fields[column])
+	}
+
+	row := types.ImportRow{
+		Line:     record.line,
+		Payee:    truncate(strings.Join(strings.Fields(cell(columns.payee)), " "), maxPayeeLength),
+		Note:     cell(columns.note),
+		Category: cell(columns.category),
+		Currency: format.Currency,
+		Status:   types.ImportRowNew,
+	}
+
+	date, err := parseDate(cell(columns.date), format.DateFormat)
+	if err != nil {
+		row.Invalid("date %q does not match %s", cell(columns.date), format.DateFormat)
+		return row
+	}
+	row.Date = date
+
+	if currency := strings.ToUpper(cell(columns.currency)); currency != "" {
+		row.Currency = types.Currency(currency)
+		if !row.Currency.IsValid() {
+			row.Invalid("unknown currency %q", currency)
+			return row
+		}
+		if !row.Currency.IsSupported() {
+			row.Invalid("amounts in %s are not supported, as it does not have two decimals", currency)
+			return row
+		}
+	}
+
+	var amount types.Money
+	if columns.amount >= 0 {
+		if cell(columns.amount) == "" {
+			row.Invalid("amount is missing")
+			return row
+		}
+		if amount, err = parseAmount(cell(columns.amount), format.DecimalSeparator); err != nil {
+			row.Invalid("amount %q is not a number", cell(columns.amount))
+			return row
+		}
+		if format.InvertAmounts {
+			amount = -amount
+		}
+	} else {
+		debit, credit := cell(columns.debit), cell(columns.credit)
+		if debit == "" && credit == "" {
+			row.Invalid("amount is missing")
+			return row
+		}
+		if debit != "" {
+			value, err := parseAmount(debit, format.DecimalSeparator)
+			if err != nil {
+				row.Invalid("debit %q is not a number", debit)
+				return row
+			}
+			amount -= value.Abs()
+		}
+		if credit != "" {
+			value, err := parseAmount(credit, format.DecimalSeparator)
+			if err != nil {
+				row.Invalid("credit %q is not a number", credit)
+				return row
+			}
+			amount += value.Abs()
+		}
+	}
+
+	setSignedAmount(&row, amount)
+	return row
+}
+
+// setSignedAmount sets the kind and the amount of the row from a signed amount, negative for
+// expenses. A zero amount makes the row invalid.
+func setSignedAmount(row *types.ImportRow, amount types.Money) {
+	switch {
+	case amount < 0:
+		row.Kind, row.Amount = types.TransactionExpense, -amount
+	case amount > 0:
+		row.Kind, row.Amount = types.TransactionIncome, amount
+	default:
+		row.Invalid("amount is zero")
+	}
+}
+
+// readCSV reads every record of the text, leaving out the blank ones.
+func readCSV(text string, delimiter rune) ([]csvRecord, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	var records []csvRecord
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the file is not valid CSV: %w", err)
+		}
+		if blank(fields) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, csvRecord{line: line, fields: fields})
+	}
+}
+
+// detectDelimiter returns the delimiter that splits the first lines of the text into the most
+// lines with the same number of fields, more than one.
+func detectDelimiter(text string) rune {
+	lines := strings.SplitN(text, "\n", 31)
+	sample := strings.Join(lines[:min(len(lines), 30)], "\n")
+
+	best, bestScore := delimiters[0], 0
+	for _, delimiter := range delimiters {
+		reader := csv.NewReader(strings.NewReader(sample))
+		reader.Comma = delimiter
+		reader.LazyQuotes = true
+		reader.FieldsPerRecord = -1
+
+		counts := make(map[int]int)
+		for {
+			fields, err := reader.Read()
+			if err != nil {
+				break
+			}
+			if !blank(fields) {
+				counts[len(fields)]++
+			}
+		}
+		score := 0
+		for fields, lines := range counts {
+			if fields > 1 && lines > score {
+				score = lines
+			}
+		}
+		if score > bestScore {
+			best, bestScore = delimiter, score
+		}
+	}
+	return best
+}
+
+// tableStart returns the index of the first record of the table, skipping the shorter lines some
+// banks write above it.
+func tableStart(records []csvRecord) int {
+	counts := make(map[int]int)
+	width := 0
+	for _, record := range records {
+		counts[len(record.fields)]++
+		if counts[len(record.fields)] > counts[width] {
+			width = len(record.fields)
+		}
+	}
+	if width < 2 {
+		return 0
+	}
+	for i, record := range records {
+		if len(record.fields) >= max(width-1, 2) {
+			return i
+		}
+	}
+	return 0
+}
+
+// resolveColumns finds the positions of the columns of the format in the header, and of the
+// columns the format leaves empty from the header names or, without a header, from the content of
+// the columns. The detected columns are written back to the format.
+func resolveColumns(format *types.CSVFormat, header []string, records []csvRecord) (csvColumns, error) {
+	columns := csvColumns{-1, -1, -1, -1, -1, -1, -1, -1}
+	width := len(header)
+	for _, record := range records {
+		width = max(width, len(record.fields))
+	}
+
+	targets := []struct {
+		name   string
+		ref    *string
+		column *int
+	}{
+		{"date", &format.DateColumn, &columns.date},
+		{"amount", &format.AmountColumn, &columns.amount},
+		{"debit", &format.DebitColumn, &columns.debit},
+		{"credit", &format.CreditColumn, &columns.credit},
+		{"currency", &format.CurrencyColumn, &columns.currency},
+		{"category", &format.CategoryColumn, &columns.category},
+		{"payee", &format.PayeeColumn, &columns.payee},
+		{"note", &format.NoteColumn, &columns.note},
+	}
+
+	taken := make(map[int]bool)
+	for _, target := range targets {
+		if *target.ref == "" {
+			continue
+		}
+		column, err := columnIndex(*target.ref, header, width)
+		if err != nil {
+			return columns, err
+		}
+		*target.column = column
+		taken[column] = true
+	}
+
+	signed := format.AmountColumn != "" || format.DebitColumn != "" || format.CreditColumn != ""
+	for _, target := range targets {
+		if *target.ref != "" || (signed && (target.name == "amount" || target.name == "debit" || target.name == "credit")) {
+			continue
+		}
+		if target.name != "amount" && columns.amount >= 0 && (target.name == "debit" || target.name == "credit") {
+			continue
+		}
+		var column int
+		if header != nil {
+			column = findHeaderColumn(header, columnNames[target.name].exact, columnNames[target.name].contains, taken)
+		} else {
+			column = findContentColumn(target.name, records, width, taken)
+		}
+		if column < 0 {
+			continue
+		}
+		*target.column = column
+		taken[column] = true
+		*target.ref = columnRef(header, column)
+	}
+
+	if columns.date < 0 {
+		return columns, errors.New("the date column could not be found, set date_column")
+	}
+	if columns.amount < 0 && columns.debit < 0 && columns.credit < 0 {
+		return columns, errors.New("the amount column could not be found, set amount_column or debit_column and credit_column")
+	}
+	return columns, nil
+}
+
+// columnIndex returns the position of a column given by its name in the header, or by its
+// position from 1.
+func columnIndex(ref string, header []string, width int) (int, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > width {
+			return -1, fmt.Errorf("column %d does not exist", n)
+		}
+		return n - 1, nil
+	}
+	for i, name := range header {
+		if normalizeName(name) == normalizeName(ref) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("column %q is not in the header", ref)
+}
+
+// columnRef returns how a column is referred to in a format: by its name, or by its position
+// from 1 without a header.
+func columnRef(header []string, column int) string {
+	if header != nil && strings.TrimSpace(header[column]) != "" {
+		return strings.TrimSpace(header[column])
+	}
+	return strconv.Itoa(column + 1)
+}
+
+// findHeaderColumn returns the first column not taken yet whose name is one of the exact names,
+// or else contains one of the fragments, or -1.
+func findHeaderColumn(header []string, exact, contains []string, taken map[int]bool) int {
+	for _, want := range exact {
+		for i, name := range header {
+			if !taken[i] && normalizeName(name) == want {
+				return i
+			}
+		}
+	}
+	for _, want := range contains {
+		for i, name := range header {
+			if !taken[i] && strings.Contains(normalizeName(name), want) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// findContentColumn guesses a column of a file without header from its values: the first column
+// of dates, the first column of numbers as the amount, a column of currency codes, and the column
+// with the longest texts as the payee. Debit, credit, category and note columns are not guessed.
+func findContentColumn(name string, records []csvRecord, width int, taken map[int]bool) int {
+	best, bestLength := -1, 0
+	for column := 0; column < width; column++ {
+		if taken[column] {
+			continue
+		}
+		values := columnValues(records, column)
+		if len(values) == 0 {
+			continue
+		}
+		switch name {
+		case "date":
+			if detectDateFormat(values) != "" {
+				return column
+			}
+		case "amount":
+			if all(values, looksLikeAmount) {
+				return column
+			}
+		case "currency":
+			if all(values, func(v string) bool { return types.Currency(strings.ToUpper(v)).IsValid() }) {
+				return column
+			}
+		case "payee":
+			if all(values, looksLikeAmount) || detectDateFormat(values) != "" {
+				continue
+			}
+			length := 0
+			for _, v := range values {
+				length += utf8.RuneCountInString(v)
+			}
+			if length > bestLength {
+				best, bestLength = column, length
+			}
+		}
+	}
+	return best
+}
+
+// columnValues returns the non-empty values of a column.
+func columnValues(records []csvRecord, column int) []string {
+	if column < 0 {
+		return nil
+	}
+	var values []string
+	for _, record := range records {
+		if column < len(record.fields) {
+			if value := strings.TrimSpace(record.fields[column]); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// detectDateFormat returns the first date format all the values match, or an empty string.
+func detectDateFormat(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	for _, format := range dateFormats {
+		if all(values, func(v string) bool { _, err := parseDate(v, format); return err == nil }) {
+			return format
+		}
+	}
+	return ""
+}
+
+// rowHasDate reports whether a cell of the record reads as a date.
+func rowHasDate(fields []string) bool {
+	for _, field := range fields {
+		if detectDateFormat([]string{strings.TrimSpace(field)}) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDate parses a date in one of the types.DateFormats, ignoring a time after it.
+func parseDate(value, format string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if date, _, found := strings.Cut(value, " "); found {
+		value = date
+	}
+	if len(value) > 10 && value[10] == 'T' {
+		value = value[:10]
+	}
+	return time.Parse(types.DateFormats[format], value)
+}
+
+// detectDecimalSeparator returns the decimal separator most amounts use. When a separator appears
+// once, followed by three digits, it may as well group the thousands and the amount is not
+// counted. It defaults to ".".
+func detectDecimalSeparator(values []string) string {
+	dots, commas := 0, 0
+	for _, value := range values {
+		lastDot, lastComma := strings.LastIndex(value, "."), strings.LastIndex(value, ",")
+		switch {
+		case lastDot >= 0 && lastComma >= 0:
+			if lastDot > lastComma {
+				dots++
+			} else {
+				commas++
+			}
+		case lastDot >= 0 && strings.Count(value, ".") > 1:
+			commas++
+		case lastComma >= 0 && strings.Count(value, ",") > 1:
+			dots++
+		case lastDot >= 0 && digitsAfter(value, lastDot) != 3:
+			dots++
+		case lastComma >= 0 && digitsAfter(value, lastComma) != 3:
+			commas++
+		}
+	}
+	if commas > dots {
+		return ","
+	}
+	return "."
+}
+
+// parseAmount parses an amount written with the given decimal separator, ignoring the thousands
+// separators, spaces and currency symbols. An amount in parentheses, or with a minus sign before
+// or after it, is negative.
+func parseAmount(value, decimal string) (types.Money, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+
+	var b strings.Builder
+	digits := false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+			digits = true
+		case string(r) == decimal:
+			b.WriteRune('.')
+		case r == '-' || r == '−':
+			negative = true
+		}
+	}
+	if !digits {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	amount, err := types.ParseMoney(b.String())
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// looksLikeAmount reports whether a value is made of digits, signs, separators and currency
+// symbols only.
+func looksLikeAmount(value string) bool {
+	digits := false
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case !strings.ContainsRune(".,'-+() \u00a0\u202f−€$£¥", r):
+			return false
+		}
+	}
+	return digits
+}
+
+// digitsAfter counts the digits right after the position.
+func digitsAfter(value string, position int) int {
+	n := 0
+	for _, r := range value[position+1:] {
+		if r < '0' || r > '9' {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// normalizeName lowercases a column name and collapses its spaces.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.Trim(name, "\"' \ufeff")), " "))
+}
+
+// truncate cuts a text to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// blank reports whether every field of a record is empty.
+func blank(fields []string) bool {
+	for _, field := range fields {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// all reports whether every value satisfies the predicate.
+func all(values []string, predicate func(string) bool) bool {
+	for _, value := range values {
+		if !predicate(value) {
+			return false
+		}
+	}
+	return true
+}
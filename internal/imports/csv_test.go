@@ -0,0 +1,291 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// checkRows compares the rows read from a file with the wanted ones, field by field.
+func checkRows(t *testing.T, got, want []types.ImportRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Line != w.Line || !g.Date.Equal(w.Date) || g.Kind != w.Kind || g.Amount != w.Amount || g.Currency != w.Currency ||
+			g.Payee != w.Payee || g.Note != w.Note || g.Category != w.Category || g.CategoryGroup != w.CategoryGroup ||
+			g.ExternalID != w.ExternalID || g.Status != w.Status || g.Error != w.Error {
+			t.Errorf("row %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name       string
+		data       string
+		format     types.CSVFormat
+		wantFormat types.CSVFormat
+		wantRows   []types.ImportRow
+	}{
+		{
+			name:   "header",
+			data:   "Date,Description,Amount\n2024-01-05,Coffee  Shop,-4.50\n2024-01-06,Salary,2500.00\n",
+			format: types.CSVFormat{Currency: "EUR"},
+			wantFormat: types.CSVFormat{
+				Encoding: "utf-8", Delimiter: ",", HasHeader: &yes, DateColumn: "Date", AmountColumn: "Amount",
+				PayeeColumn: "Description", DateFormat: "YYYY-MM-DD", DecimalSeparator: ".", Currency: "EUR",
+			},
+			wantRows: []types.ImportRow{
+				{Line: 2, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 450, Currency: "EUR", Payee: "Coffee Shop", Status: types.ImportRowNew},
+				{Line: 3, Date: date(2024, 1, 6), Kind: types.TransactionIncome, Amount: 250000, Currency: "EUR", Payee: "Salary", Status: types.ImportRowNew},
+			},
+		},
+		{
+			name:   "german bank in windows-1252",
+			data:   "Buchungstag;Empf\xe4nger;Verwendungszweck;Betrag\r\n05.01.2024;REWE;Einkauf;-1.234,56\r\n",
+			format: types.CSVFormat{Currency: "EUR"},
+			wantFormat: types.CSVFormat{
+				Encoding: "windows-1252", Delimiter: ";", HasHeader: &yes, DateColumn: "Buchungstag", AmountColumn: "Betrag",
+				PayeeColumn: "Empfänger", NoteColumn: "Verwendungszweck", DateFormat: "DD.MM.YYYY", DecimalSeparator: ",", Currency: "EUR",
+			},
+			wantRows: []types.ImportRow{
+				{Line: 2, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 123456, Currency: "EUR", Payee: "REWE", Note: "Einkauf", Status: types.ImportRowNew},
+			},
+		},
+		{
+			name:   "lines above the table and debit and credit columns",
+			data:   "Account;DE123\nPeriod;January\n\nDate;Payee;Debit;Credit\n2024-01-05;Shop;12.00;\n2024-01-06;Refund;;3.50\n",
+			format: types.CSVFormat{Currency: "EUR"},
+			wantFormat: types.CSVFormat{
+				Encoding: "utf-8", Delimiter: ";", SkipRows: 3, HasHeader: &yes, DateColumn: "Date", DebitColumn: "Debit", CreditColumn: "Credit",
+				PayeeColumn: "Payee", DateFormat: "YYYY-MM-DD", DecimalSeparator: ".", Currency: "EUR",
+			},
+			wantRows: []types.ImportRow{
+				{Line: 5, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 1200, Currency: "EUR", Payee: "Shop", Status: types.ImportRowNew},
+				{Line: 6, Date: date(2024, 1, 6), Kind: types.TransactionIncome, Amount: 350, Currency: "EUR", Payee: "Refund", Status: types.ImportRowNew},
+			},
+		},
+		{
+			name:   "no header",
+			data:   "05/01/2024,Coffee,-4.50\n06/01/2024,Bakery,-3.20\n13/01/2024,Salary,100.00\n",
+			format: types.CSVFormat{Currency: "USD"},
+			wantFormat: types.CSVFormat{
+				Encoding: "utf-8", Delimiter: ",", HasHeader: &no, DateColumn: "1", AmountColumn: "3",
+				PayeeColumn: "2", DateFormat: "DD/MM/YYYY", DecimalSeparator: ".", Currency: "USD",
+			},
+			wantRows: []types.ImportRow{
+				{Line: 1, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 450, Currency: "USD", Payee: "Coffee", Status: types.ImportRowNew},
+				{Line: 2, Date: date(2024, 1, 6), Kind: types.TransactionExpense, Amount: 320, Currency: "USD", Payee: "Bakery", Status: types.ImportRowNew},
+				{Line: 3, Date: date(2024, 1, 13), Kind: types.TransactionIncome, Amount: 10000, Currency: "USD", Payee: "Salary", Status: types.ImportRowNew},
+			},
+		},
+		{
+			name:   "inverted amounts",
+			data:   "Date,Merchant,Amount\n2024-01-05,Shop,25.00\n2024-01-06,Payment,-100.00\n",
+			format: types.CSVFormat{InvertAmounts: true, Currency: "USD"},
+			wantFormat: types.CSVFormat{
+				Encoding: "utf-8", Delimiter: ",", HasHeader: &yes, DateColumn: "Date", AmountColumn: "Amount",
+				PayeeColumn: "Merchant", DateFormat: "YYYY-MM-DD", DecimalSeparator: ".", InvertAmounts: true, Currency: "USD",
+			},
+			wantRows: []types.ImportRow{
+				{Line: 2, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 2500, Currency: "USD", Payee: "Shop", Status: types.ImportRowNew},
+				{Line: 3, Date: date(2024, 1, 6), Kind: types.TransactionIncome, Amount: 10000, Currency: "USD", Payee: "Payment", Status: types.ImportRowNew},
+			},
+		},
+		{
+			name: "invalid rows",
+			data: "Date,Payee,Amount,Currency\n2024-01-05,A,abc,EUR\n2024-13-45,B,-1.00,EUR\n2024-01-07,C,0,EUR\n" +
+				"2024-01-08,D,-1.00,XYZ\n2024-01-09,E,-100,JPY\n2024-01-10,F,,EUR\n2024-01-11,G,-1.00,usd\n",
+			format: types.CSVFormat{DateFormat: "YYYY-MM-DD", Currency: "EUR"},
+			wantFormat: types.CSVFormat{
+				Encoding: "utf-8", Delimiter: ",", HasHeader: &yes, DateColumn: "Date", AmountColumn: "Amount", PayeeColumn: "Payee",
+				CurrencyColumn: "Currency", DateFormat: "YYYY-MM-DD", DecimalSeparator: ".", Currency: "EUR",
+			},
+			wantRows: []types.ImportRow{
+				{Line: 2, Date: date(2024, 1, 5), Currency: "EUR", Payee: "A", Status: types.ImportRowInvalid, Error: `amount "abc" is not a number`},
+				{Line: 3, Currency: "EUR", Payee: "B", Status: types.ImportRowInvalid, Error: `date "2024-13-45" does not match YYYY-MM-DD`},
+				{Line: 4, Date: date(2024, 1, 7), Currency: "EUR", Payee: "C", Status: types.ImportRowInvalid, Error: "amount is zero"},
+				{Line: 5, Date: date(2024, 1, 8), Currency: "XYZ", Payee: "D", Status: types.ImportRowInvalid, Error: `unknown currency "XYZ"`},
+				{Line: 6, Date: date(2024, 1, 9), Currency: "JPY", Payee: "E", Status: types.ImportRowInvalid, Error: "amounts in JPY are not supported, as it does not have two decimals"},
+				{Line: 7, Date: date(2024, 1, 10), Currency: "EUR", Payee: "F", Status: types.ImportRowInvalid, Error: "amount is missing"},
+				{Line: 8, Date: date(2024, 1, 11), Kind: types.TransactionExpense, Amount: 100, Currency: "USD", Payee: "G", Status: types.ImportRowNew},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := ParseCSV([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, want := statement.Format, tt.wantFormat
+			if got.HasHeader == nil || *got.HasHeader != *want.HasHeader {
+				t.Errorf("HasHeader = %v, want %v", got.HasHeader, *want.HasHeader)
+			}
+			got.HasHeader, want.HasHeader = nil, nil
+			if got != want {
+				t.Errorf("Format = %+v, want %+v", got, want)
+			}
+			checkRows(t, statement.Rows, tt.wantRows)
+		})
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name   string
+		data   string
+		format types.CSVFormat
+		want   string
+	}{
+		{"empty", "", types.CSVFormat{}, "the file has no rows"},
+		{"blank", "\n ,  \n", types.CSVFormat{}, "the file has no rows"},
+		{"skipped too many", "Date,Amount\n", types.CSVFormat{SkipRows: 2}, "the file has no rows"},
+		{"no date column", "Name,Amount\nA,1.00\nB,2.00\n", types.CSVFormat{}, "the date column could not be found"},
+		{"no amount column", "Date,Payee\n2024-01-05,A\n", types.CSVFormat{}, "the amount column could not be found"},
+		{"unknown column", "Date,Amount\n2024-01-05,1.00\n", types.CSVFormat{AmountColumn: "Total"}, `column "Total" is not in the header`},
+		{"column out of range", "Date,Amount\n2024-01-05,1.00\n", types.CSVFormat{AmountColumn: "3"}, "column 3 does not exist"},
+		{"unknown date format", "Date,Amount\n5 Jan 2024,1.00\n", types.CSVFormat{HasHeader: &yes}, "the date format could not be detected"},
+		{"unsupported encoding", "Date,Amount\n", types.CSVFormat{Encoding: "ebcdic"}, `unsupported encoding "ebcdic"`},
+		{"invalid utf-8", "Date,Amount\n\xff\n", types.CSVFormat{Encoding: "utf-8"}, "the file is not valid utf-8"},
+		{"too many rows", "Date,Amount\n" + strings.Repeat("2024-01-05,1.00\n", MaxRows+1), types.CSVFormat{}, "the file has more than 5000 rows"},
+	}
+	for _, tt := range tests {
+		_, err := ParseCSV([]byte(tt.data), tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		encoding     string
+		want         string
+		wantEncoding string
+	}{
+		{"utf-8", "Empfänger", "", "Empfänger", "utf-8"},
+		{"utf-8 with bom", "\xef\xbb\xbfDate", "", "Date", "utf-8"},
+		{"utf-16le with bom", "\xff\xfeD\x00\xe4\x00", "", "Dä", "utf-16le"},
+		{"utf-16be with bom", "\xfe\xff\x00D\x00\xe4", "", "Dä", "utf-16be"},
+		{"windows-1252 detected", "Empf\xe4nger \x80", "", "Empfänger €", "windows-1252"},
+		{"iso-8859-15 given", "\xa4", "ISO-8859-15", "€", "iso-8859-15"},
+		{"iso-8859-1 given", "\xa4", "iso-8859-1", "¤", "iso-8859-1"},
+	}
+	for _, tt := range tests {
+		got, encoding, err := decode([]byte(tt.data), tt.encoding)
+		if err != nil || got != tt.want || encoding != tt.wantEncoding {
+			t.Errorf("%s: decode = %q, %q, %v, want %q, %q", tt.name, got, encoding, err, tt.want, tt.wantEncoding)
+		}
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want rune
+	}{
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"semicolon with decimal commas", "a;b;c\n1,5;2,5;3\n4;5;6\n", ';'},
+		{"tab", "a\tb\n1\t2\n", '\t'},
+		{"pipe", "a|b|c\n1|2|3\n", '|'},
+		{"quoted commas", "a;b\n\"x, y\";2\n\"z, w\";3\n", ';'},
+		{"single column", "a\nb\n", ','},
+	}
+	for _, tt := range tests {
+		if got := detectDelimiter(tt.text); got != tt.want {
+			t.Errorf("%s: detectDelimiter = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectDateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{"iso", []string{"2024-01-05", "2024-12-31"}, "YYYY-MM-DD"},
+		{"iso with time", []string{"2024-01-05T10:00:00Z", "2024-01-06 08:30"}, "YYYY-MM-DD"},
+		{"compact", []string{"20240105"}, "YYYYMMDD"},
+		{"german", []string{"05.01.2024"}, "DD.MM.YYYY"},
+		{"german without zeros", []string{"5.1.2024", "15.10.2024"}, "D.M.YYYY"},
+		{"day first when ambiguous", []string{"05/01/2024", "06/01/2024"}, "DD/MM/YYYY"},
+		{"month first", []string{"01/05/2024", "12/31/2024"}, "MM/DD/YYYY"},
+		{"short year", []string{"05.01.24"}, "DD.MM.YY"},
+		{"short year month first", []string{"01/05/24", "12/31/24"}, "MM/DD/YY"},
+		{"mixed", []string{"2024-01-05", "05.01.2024"}, ""},
+		{"text", []string{"yesterday"}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := detectDateFormat(tt.values); got != tt.want {
+			t.Errorf("%s: detectDateFormat = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectDecimalSeparator(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{"dots", []string{"-4.50", "12.3"}, "."},
+		{"commas", []string{"-4,50", "12,3"}, ","},
+		{"grouped dots", []string{"1,234.56"}, "."},
+		{"grouped commas", []string{"1.234,56"}, ","},
+		{"several dot groups", []string{"1.234.567"}, ","},
+		{"several comma groups", []string{"1,234,567"}, "."},
+		{"three digits either way", []string{"1,234", "1.234"}, "."},
+		{"three digits then commas", []string{"1.234", "5,20"}, ","},
+		{"whole amounts", []string{"12", "100"}, "."},
+	}
+	for _, tt := range tests {
+		if got := detectDecimalSeparator(tt.values); got != tt.want {
+			t.Errorf("%s: detectDecimalSeparator = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value   string
+		decimal string
+		want    types.Money
+		wantErr bool
+	}{
+		{"12.34", ".", 1234, false},
+		{"-12.34", ".", -1234, false},
+		{"12.34-", ".", -1234, false},
+		{"(12.34)", ".", -1234, false},
+		{"−12,34", ",", -1234, false},
+		{"1,234.56", ".", 123456, false},
+		{"1.234,56", ",", 123456, false},
+		{"1 234,56 €", ",", 123456, false},
+		{"$1,000", ".", 100000, false},
+		{"+5", ".", 500, false},
+		{"", ".", 0, true},
+		{"abc", ".", 0, true},
+		{"1.2.3", ".", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.value, tt.decimal)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAmount(%q, %q) = %v, %v, want %v, wantErr %v", tt.value, tt.decimal, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
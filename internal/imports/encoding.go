@@ -0,0 +1,69 @@
+package imports
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decode converts the content of a file into UTF-8 and returns the encoding it was read with.
+//
+// Without an encoding, a byte order mark tells UTF-8 and UTF-16 apart; a file without one is
+// UTF-8 when it is valid UTF-8, and Windows-1252 otherwise, the usual encoding of the exports of
+// older banking software.
+func decode(data []byte, name string) (string, string, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		switch {
+		case bytes.HasPrefix(data, bomUTF8):
+			name = "utf-8"
+		case bytes.HasPrefix(data, bomUTF16LE):
+			name = "utf-16le"
+		case bytes.HasPrefix(data, bomUTF16BE):
+			name = "utf-16be"
+		case utf8.Valid(data):
+			name = "utf-8"
+		default:
+			name = "windows-1252"
+		}
+	}
+
+	var enc encoding.Encoding
+	switch name {
+	case "utf-8":
+		data = bytes.TrimPrefix(data, bomUTF8)
+		if !utf8.Valid(data) {
+			return "", name, fmt.Errorf("the file is not valid %s", name)
+		}
+		return string(data), name, nil
+	case "utf-16le":
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case "utf-16be":
+		enc = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case "windows-1252":
+		enc = charmap.Windows1252
+	case "iso-8859-1":
+		enc = charmap.ISO8859_1
+	case "iso-8859-15":
+		enc = charmap.ISO8859_15
+	default:
+		return "", name, fmt.Errorf("unsupported encoding %q", name)
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", name, fmt.Errorf("the file is not valid %s", name)
+	}
+	return string(decoded), name, nil
+}
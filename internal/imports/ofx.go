@@ -0,0 +1,258 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ofxStart finds the root element of an OFX document, after the headers.
+var ofxStart = regexp.MustCompile(`(?i)<OFX[\s>]`)
+
+// ofxNode is an element of an OFX document: an aggregate with children, or an element with a
+// value.
+type ofxNode struct {
+	name     string
+	text     string
+	line     int
+	children []*ofxNode
+}
+
+// find returns the first element with the given name below the node, depth first, or nil.
+func (n *ofxNode) find(name string) *ofxNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+		if found := child.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns the elements with the given name below the node, without looking inside them.
+func (n *ofxNode) findAll(name string) []*ofxNode {
+	var found []*ofxNode
+	for _, child := range n.children {
+		if child.name == name {
+			found = append(found, child)
+		} else {
+			found = append(found, child.findAll(name)...)
+		}
+	}
+	return found
+}
+
+// value returns the value of the first element with the given name below the node, or an empty
+// string, also when the node is nil.
+func (n *ofxNode) value(name string) string {
+	if n == nil {
+		return ""
+	}
+	if found := n.find(name); found != nil {
+		return found.text
+	}
+	return ""
+}
+
+// ParseOFX reads an OFX or QFX file, in the SGML syntax of OFX 1.x or the XML syntax of OFX 2.x,
+// and returns a statement for each bank or credit card account it holds. Investment statements
+// are left out.
+//
+// The rows carry the identifier given by the bank (FITID), qualified by the account, as external
+// ID. The amounts are in the currency of the statement unless a transaction gives its own.
+//
+// A transaction that cannot be read is returned as invalid, with the reason. An error is returned
+// when the file is not an OFX document or holds no bank or credit card statement.
+func ParseOFX(data []byte) ([]Statement, error) {
+	text, _, err := decode(data, "")
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseOFXTree(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []Statement
+	rows := 0
+	for _, name := range []string{"STMTRS", "CCSTMTRS"} {
+		for _, node := range root.findAll(name) {
+			statement := parseOFXStatement(node)
+			rows += len(statement.Rows)
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("the file holds no bank or credit card statement")
+	}
+	if rows > MaxRows {
+		return nil, fmt.Errorf("the file has more than %d transactions", MaxRows)
+	}
+	return statements, nil
+}
+
+// parseOFXTree reads the elements of an OFX document. The closing tags are optional, as in the
+// SGML syntax: an element with a value ends at the next tag, an aggregate at its closing tag.
+func parseOFXTree(text string) (*ofxNode, error) {
+	start := ofxStart.FindStringIndex(text)
+	if start == nil {
+		return nil, errors.New("the file is not an OFX statement")
+	}
+
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+	line := 1 + strings.Count(text[:start[0]], "\n")
+	for i := start[0]; i < len(text); {
+		lt := strings.IndexByte(text[i:], '<')
+		if lt < 0 {
+			break
+		}
+		if value := strings.TrimSpace(text[i : i+lt]); value != "" && len(stack) > 1 {
+			if top := stack[len(stack)-1]; len(top.children) == 0 {
+				top.text = html.UnescapeString(value)
+				stack = stack[:len(stack)-1]
+			}
+		}
+		line += strings.Count(text[i:i+lt], "\n")
+		i += lt
+
+		end := ">"
+		if strings.HasPrefix(text[i:], "<!--") {
+			end = "-->"
+		}
+		gt := strings.Index(text[i:], end)
+		if gt < 0 {
+			return nil, errors.New("the file is not a valid OFX statement")
+		}
+		tag := text[i+1 : i+gt]
+		line += strings.Count(tag, "\n")
+		i += gt + len(end)
+
+		switch {
+		case tag == "" || tag[0] == '?' || tag[0] == '!':
+		case tag[0] == '/':
+			name := strings.ToUpper(strings.TrimSpace(tag[1:]))
+			for j := len(stack) - 1; j > 0; j-- {
+				if stack[j].name == name {
+					stack = stack[:j]
+					break
+				}
+			}
+		default:
+			fields := strings.Fields(strings.TrimSuffix(tag, "/"))
+			if len(fields) == 0 {
+				continue
+			}
+			node := &ofxNode{name: strings.ToUpper(fields[0]), line: line}
+			top := stack[len(stack)-1]
+			top.children = append(top.children, node)
+			if !strings.HasSuffix(tag, "/") {
+				stack = append(stack, node)
+			}
+		}
+	}
+	return root, nil
+}
+
+// parseOFXStatement reads the account and the transactions of a bank (STMTRS) or credit card
+// (CCSTMTRS) statement.
+func parseOFXStatement(node *ofxNode) Statement {
+	account := &types.ImportAccount{Currency: types.Currency(strings.ToUpper(node.value("CURDEF")))}
+	if from := node.find("BANKACCTFROM"); from != nil {
+		account.BankID = truncate(from.value("BANKID"), 32)
+		account.Number = truncate(from.value("ACCTID"), 100)
+		account.Type = truncate(strings.ToUpper(from.value("ACCTTYPE")), 32)
+	} else if from := node.find("CCACCTFROM"); from != nil {
+		account.Number = truncate(from.value("ACCTID"), 100)
+		account.Type = "CREDITCARD"
+	}
+	if !account.Currency.IsValid() {
+		account.Currency = ""
+	}
+	statement := Statement{Account: account, Rows: []types.ImportRow{}}
+	if account.Number == "" {
+		statement.Account = nil
+	}
+
+	transactions := node.findAll("STMTTRN")
+	amounts := make([]string, 0, len(transactions))
+	for _, transaction := range transactions {
+		amounts = append(amounts, transaction.value("TRNAMT"))
+	}
+	decimal := detectDecimalSeparator(amounts)
+
+	for _, transaction := range transactions {
+		statement.Rows = append(statement.Rows, parseOFXTransaction(transaction, account, decimal))
+	}
+	return statement
+}
+
+// parseOFXTransaction builds the row of a transaction (STMTTRN).
+func parseOFXTransaction(node *ofxNode, account *types.ImportAccount, decimal string) types.ImportRow {
+	payee, note := node.value("NAME"), node.value("MEMO")
+	if payee == "" {
+		payee, note = note, ""
+	}
+	if number := node.value("CHECKNUM"); number != "" && note == "" {
+		note = "Check " + number
+	}
+	row := types.ImportRow{
+		Line:     node.line,
+		Payee:    truncate(strings.Join(strings.Fields(payee), " "), maxPayeeLength),
+		Note:     note,
+		Currency: account.Currency,
+		Status:   types.ImportRowNew,
+	}
+	if id := node.value("FITID"); id != "" && account.Number != "" {
+		row.ExternalID = account.ExternalID(id)
+	}
+
+	posted := node.value("DTPOSTED")
+	if posted == "" {
+		posted = node.value("DTUSER")
+	}
+	date, err := parseOFXDate(posted)
+	if err != nil {
+		row.Invalid("date %q is not an OFX date", posted)
+		return row
+	}
+	row.Date = date
+
+	// The amount is in the currency of the statement unless the transaction gives its own
+	// (CURRENCY); ORIGCURRENCY only tells what it was converted from.
+	if currency := strings.ToUpper(node.find("CURRENCY").value("CURSYM")); currency != "" {
+		row.Currency = types.Currency(currency)
+		if !row.Currency.IsValid() {
+			row.Invalid("unknown currency %q", currency)
+			return row
+		}
+	}
+	if row.Currency != "" && !row.Currency.IsSupported() {
+		row.Invalid("amounts in %s are not supported, as it does not have two decimals", row.Currency)
+		return row
+	}
+
+	value := node.value("TRNAMT")
+	amount, err := parseAmount(value, decimal)
+	if err != nil {
+		row.Invalid("amount %q is not a number", value)
+		return row
+	}
+	setSignedAmount(&row, amount)
+	return row
+}
+
+// parseOFXDate parses the day of an OFX date, YYYYMMDD followed by an optional time and time
+// zone.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
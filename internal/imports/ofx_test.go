@@ -0,0 +1,214 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>USD
+<BANKACCTFROM>
+<BANKID>121000248
+<ACCTID>12345678
+<ACCTTYPE>checking
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240101
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240105120000[-5:EST]
+<TRNAMT>-4.50
+<FITID>1001
+<NAME>Coffee &amp; Co
+<MEMO>Card 1234
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20240106
+<TRNAMT>-120.00
+<FITID>1002
+<CHECKNUM>305
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTUSER>20240107
+<TRNAMT>2500.00
+<FITID>1003
+<MEMO>Salary
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>POS
+<DTPOSTED>20240108
+<TRNAMT>-10.00
+<FITID>1004
+<NAME>Hotel
+<CURRENCY><CURRATE>1.1<CURSYM>EUR</CURRENCY>
+</STMTTRN>
+<STMTTRN>
+<DTPOSTED>2024
+<TRNAMT>-1.00
+<FITID>1005
+</STMTTRN>
+<STMTTRN>
+<DTPOSTED>20240109
+<TRNAMT>abc
+<FITID>1006
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="211"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <CCACCTFROM><ACCTID>4111</ACCTID></CCACCTFROM>
+        <BANKTRANLIST>
+          <!-- a comment with <TAGS> -->
+          <STMTTRN><DTPOSTED>20240210</DTPOSTED><TRNAMT>-1.234,50</TRNAMT><FITID>A1</FITID><NAME>Airline</NAME></STMTTRN>
+          <STMTTRN><DTPOSTED>20240211</DTPOSTED><TRNAMT>0,00</TRNAMT><FITID>A2</FITID><NAME>Check</NAME></STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantAccount types.ImportAccount
+		wantRows    []types.ImportRow
+	}{
+		{
+			name:        "sgml bank statement",
+			data:        ofxSGML,
+			wantAccount: types.ImportAccount{BankID: "121000248", Number: "12345678", Type: "CHECKING", Currency: "USD"},
+			wantRows: []types.ImportRow{
+				{Line: 17, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 450, Currency: "USD", Payee: "Coffee & Co", Note: "Card 1234",
+					ExternalID: "121000248/12345678/1001", Status: types.ImportRowNew},
+				{Line: 25, Date: date(2024, 1, 6), Kind: types.TransactionExpense, Amount: 12000, Currency: "USD", Note: "Check 305",
+					ExternalID: "121000248/12345678/1002", Status: types.ImportRowNew},
+				{Line: 32, Date: date(2024, 1, 7), Kind: types.TransactionIncome, Amount: 250000, Currency: "USD", Payee: "Salary",
+					ExternalID: "121000248/12345678/1003", Status: types.ImportRowNew},
+				{Line: 39, Date: date(2024, 1, 8), Kind: types.TransactionExpense, Amount: 1000, Currency: "EUR", Payee: "Hotel",
+					ExternalID: "121000248/12345678/1004", Status: types.ImportRowNew},
+				{Line: 47, Currency: "USD", ExternalID: "121000248/12345678/1005", Status: types.ImportRowInvalid, Error: `date "2024" is not an OFX date`},
+				{Line: 52, Date: date(2024, 1, 9), Currency: "USD", ExternalID: "121000248/12345678/1006", Status: types.ImportRowInvalid, Error: `amount "abc" is not a number`},
+			},
+		},
+		{
+			name:        "xml credit card statement",
+			data:        ofxXML,
+			wantAccount: types.ImportAccount{Number: "4111", Type: "CREDITCARD", Currency: "EUR"},
+			wantRows: []types.ImportRow{
+				{Line: 11, Date: date(2024, 2, 10), Kind: types.TransactionExpense, Amount: 123450, Currency: "EUR", Payee: "Airline",
+					ExternalID: "/4111/A1", Status: types.ImportRowNew},
+				{Line: 12, Date: date(2024, 2, 11), Currency: "EUR", Payee: "Check", ExternalID: "/4111/A2", Status: types.ImportRowInvalid, Error: "amount is zero"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := ParseOFX([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("%d statements, want 1", len(statements))
+			}
+			account := statements[0].Account
+			if account == nil || *account != tt.wantAccount {
+				t.Errorf("Account = %+v, want %+v", account, tt.wantAccount)
+			}
+			checkRows(t, statements[0].Rows, tt.wantRows)
+		})
+	}
+}
+
+func TestParseOFXStatements(t *testing.T) {
+	data := `<OFX>
+<STMTRS><CURDEF>JPY<BANKACCTFROM><ACCTID>1</BANKACCTFROM>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>-100<FITID>1</STMTTRN>
+</STMTRS>
+<CCSTMTRS><CURDEF>XXX
+<STMTTRN><DTPOSTED>20240105<TRNAMT>-1.00</STMTTRN>
+</CCSTMTRS>
+<INVSTMTRS><STMTTRN><DTPOSTED>20240105<TRNAMT>-1.00</STMTTRN></INVSTMTRS>
+</OFX>`
+	statements, err := ParseOFX([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("%d statements, want 2", len(statements))
+	}
+	checkRows(t, statements[0].Rows, []types.ImportRow{
+		{Line: 3, Date: date(2024, 1, 5), Currency: "JPY", ExternalID: "/1/1", Status: types.ImportRowInvalid,
+			Error: "amounts in JPY are not supported, as it does not have two decimals"},
+	})
+	if statements[1].Account != nil {
+		t.Errorf("Account = %+v, want nil without account number", statements[1].Account)
+	}
+	checkRows(t, statements[1].Rows, []types.ImportRow{
+		{Line: 6, Date: date(2024, 1, 5), Kind: types.TransactionExpense, Amount: 100, Status: types.ImportRowNew},
+	})
+}
+
+func TestParseOFXErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not ofx", "Date,Amount\n2024-01-05,1.00\n", "the file is not an OFX statement"},
+		{"unterminated tag", "<OFX><STMTRS", "the file is not a valid OFX statement"},
+		{"no statement", "<OFX><SIGNONMSGSRSV1><SONRS></SONRS></SIGNONMSGSRSV1></OFX>", "the file holds no bank or credit card statement"},
+		{"investments only", "<OFX><INVSTMTRS><STMTTRN><TRNAMT>1</STMTTRN></INVSTMTRS></OFX>", "the file holds no bank or credit card statement"},
+		{"too many transactions", "<OFX><STMTRS>" + strings.Repeat("<STMTTRN><DTPOSTED>20240105<TRNAMT>1</STMTTRN>", MaxRows+1) + "</STMTRS></OFX>",
+			"the file has more than 5000 transactions"},
+	}
+	for _, tt := range tests {
+		_, err := ParseOFX([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseOFXDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"20240105", date(2024, 1, 5), false},
+		{"20240105235959.000[-5:EST]", date(2024, 1, 5), false},
+		{"20241231120000", date(2024, 12, 31), false},
+		{"2024010", time.Time{}, true},
+		{"20241301", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOFXDate(tt.value)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseOFXDate(%q) = %v, %v, want %v, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qifTypes are the QIF account types whose transactions are imported. The investment and list
+// sections (categories, classes, memorized transactions) are left out.
+var qifTypes = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// qifRecord is a transaction of a QIF file, before its date and amount are read.
+type qifRecord struct {
+	line                                        int
+	date, amount, payee, memo, category, number string
+}
+
+// ParseQIF reads a file in the Quicken Interchange Format and returns a statement for each bank,
+// cash or credit card account it holds. The accounts are named by the !Account blocks, when the
+// file has them.
+//
+// QIF gives no currency: the amounts are in the given currency, or the base currency when it is
+// empty. Whether the dates read day or month first is given by dayFirst, or else detected from the
+// days after the 12th, month first when no date tells, as Quicken writes them. The categories (L)
+// are kept without their class; transfers between accounts have none.
+//
+// A transaction that cannot be read is returned as invalid, with the reason. An error is returned
+// when the file holds no bank, cash or credit card transaction.
+func ParseQIF(data []byte, currency types.Currency, dayFirst *bool) ([]Statement, error) {
+	text, _, err := decode(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	type section struct {
+		account *types.ImportAccount
+		records []qifRecord
+	}
+	var (
+		sections []section
+		current  *section
+		account  *types.ImportAccount
+		record   *qifRecord
+		mode     string
+		rows     int
+	)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == '!' {
+			header := strings.ToLower(strings.TrimSpace(line[1:]))
+			switch {
+			case header == "account":
+				mode, account = "account", &types.ImportAccount{}
+			case strings.HasPrefix(header, "type:"):
+				mode, record = "", nil
+				if kind := strings.TrimSpace(strings.TrimPrefix(header, "type:")); qifTypes[kind] {
+					if account != nil && account.Type == "" {
+						account.Type = strings.ToUpper(kind)
+					}
+					sections = append(sections, section{account: account})
+					current, mode, account = &sections[len(sections)-1], "transactions", nil
+				}
+			case strings.HasPrefix(header, "option:") || strings.HasPrefix(header, "clear:"):
+			default:
+				mode = ""
+			}
+			continue
+		}
+
+		code, value := line[0], strings.TrimSpace(line[1:])
+		switch mode {
+		case "account":
+			switch code {
+			case 'N':
+				account.Number = truncate(value, 100)
+			case 'T':
+				account.Type = truncate(strings.ToUpper(value), 32)
+			case '^':
+				mode = ""
+			}
+		case "transactions":
+			if record == nil {
+				record = &qifRecord{line: i + 1}
+			}
+			switch code {
+			case 'D':
+				record.date = value
+			case 'T', 'U':
+				if record.amount == "" {
+					record.amount = value
+				}
+			case 'P':
+				record.payee = value
+			case 'M':
+				record.memo = value
+			case 'N':
+				record.number = value
+			case 'L':
+				record.category = value
+			case 'S':
+				if record.category == "" {
+					record.category = value
+				}
+			case '^':
+				current.records = append(current.records, *record)
+				record = nil
+				rows++
+			}
+		}
+	}
+	if record != nil && current != nil {
+		current.records = append(current.records, *record)
+		rows++
+	}
+	if rows == 0 {
+		return nil, errors.New("the file holds no bank, cash or credit card transaction")
+	}
+	if rows > MaxRows {
+		return nil, fmt.Errorf("the file has more than %d transactions", MaxRows)
+	}
+
+	var dates, amounts []string
+	for _, s := range sections {
+		for _, r := range s.records {
+			dates, amounts = append(dates, r.date), append(amounts, r.amount)
+		}
+	}
+	readDayFirst := dayFirst != nil && *dayFirst
+	if dayFirst == nil {
+		readDayFirst = detectQIFDayFirst(dates)
+	}
+	decimal := detectDecimalSeparator(amounts)
+
+	statements := make([]Statement, 0, len(sections))
+	for _, s := range sections {
+		if len(s.records) == 0 {
+			continue
+		}
+		if s.account != nil && s.account.Number == "" {
+			s.account = nil
+		}
+		statement := Statement{Account: s.account, Rows: make([]types.ImportRow, 0, len(s.records))}
+		for _, r := range s.records {
+			statement.Rows = append(statement.Rows, parseQIFRecord(r, currency, readDayFirst, decimal))
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// parseQIFRecord builds the row of a QIF transaction.
+func parseQIFRecord(record qifRecord, currency types.Currency, dayFirst bool, decimal string) types.ImportRow {
+	payee, note := record.payee, record.memo
+	if payee == "" {
+		payee, note = note, ""
+	}
+	if record.number != "" && note == "" {
+		note = "Check " + record.number
+	}
+	category, _, _ := strings.Cut(record.category, "/")
+	if strings.HasPrefix(category, "[") {
+		category = ""
+	}
+	row := types.ImportRow{
+		Line:     record.line,
+		Payee:    truncate(strings.Join(strings.Fields(payee), " "), maxPayeeLength),
+		Note:     note,
+		Category: strings.TrimSpace(category),
+		Currency: currency,
+		Status:   types.ImportRowNew,
+	}
+
+	date, err := parseQIFDate(record.date, dayFirst)
+	if err != nil {
+		row.Invalid("date %q is not a QIF date", record.date)
+		return row
+	}
+	row.Date = date
+
+	if record.amount == "" {
+		row.Invalid("amount is missing")
+		return row
+	}
+	amount, err := parseAmount(record.amount, decimal)
+	if err != nil {
+		row.Invalid("amount %q is not a number", record.amount)
+		return row
+	}
+	setSignedAmount(&row, amount)
+	return row
+}
+
+// qifDateParts splits a QIF date, such as 1/31/2024, 1/31'24 or 31.01.2024, into its numbers.
+// Quicken pads the day and month with spaces and writes the years after 1999 after an apostrophe.
+func qifDateParts(value string) ([3]int, bool) {
+	var parts [3]int
+	fields := strings.FieldsFunc(strings.ReplaceAll(value, " ", ""), func(r rune) bool {
+		return r == '/' || r == '\'' || r == '.' || r == '-'
+	})
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// detectQIFDayFirst reports whether the dates read day first, from the first date with a number
+// after 12, which can only be the day.
+func detectQIFDayFirst(values []string) bool {
+	for _, value := range values {
+		parts, ok := qifDateParts(value)
+		if !ok || parts[0] > 31 {
+			continue
+		}
+		if parts[0] > 12 {
+			return true
+		}
+		if parts[1] > 12 {
+			return false
+		}
+	}
+	return false
+}
+
+// parseQIFDate parses a QIF date. A two-digit year is in the 1900s from 70 on, in the 2000s
+// below.
+func parseQIFDate(value string, dayFirst bool) (time.Time, error) {
+	parts, ok := qifDateParts(value)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	year, month, day := parts[2], parts[0], parts[1]
+	switch {
+	case parts[0] > 31:
+		year, month, day = parts[0], parts[1], parts[2]
+	case dayFirst:
+		month, day = parts[1], parts[0]
+	}
+	if year < 100 {
+		year += 1900
+		if year < 1970 {
+			year += 100
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
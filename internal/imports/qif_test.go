@@ -0,0 +1,177 @@
+package imports
+
+import (
+	"aibo/internal/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+const qifAccounts = `!Account
+NChecking 1234
+TBank
+^
+!Type:Bank
+D1/31'24
+T-4.50
+PCoffee
+MMorning
+LFood:Coffee/Work
+^
+D2/ 1'24
+U1,250.00
+PSalary
+^
+D2/3/2024
+T-100.00
+PTransfer
+L[Savings]
+^
+D2/30/2024
+T-1.00
+^
+D2/4/2024
+N1024
+T-20.00
+^
+!Type:CCard
+D02/05/24
+T-15.00
+PBookstore
+SBooks
+$-15.00
+^
+!Type:Invst
+D1/1/2024
+T-1.00
+^
+`
+
+func TestParseQIF(t *testing.T) {
+	statements, err := ParseQIF([]byte(qifAccounts), "EUR", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("%d statements, want 2", len(statements))
+	}
+
+	want := types.ImportAccount{Number: "Checking 1234", Type: "BANK"}
+	if account := statements[0].Account; account == nil || *account != want {
+		t.Errorf("Account = %+v, want %+v", account, want)
+	}
+	checkRows(t, statements[0].Rows, []types.ImportRow{
+		{Line: 6, Date: date(2024, 1, 31), Kind: types.TransactionExpense, Amount: 450, Currency: "EUR", Payee: "Coffee", Note: "Morning",
+			Category: "Food:Coffee", Status: types.ImportRowNew},
+		{Line: 12, Date: date(2024, 2, 1), Kind: types.TransactionIncome, Amount: 125000, Currency: "EUR", Payee: "Salary", Status: types.ImportRowNew},
+		{Line: 16, Date: date(2024, 2, 3), Kind: types.TransactionExpense, Amount: 10000, Currency: "EUR", Payee: "Transfer", Status: types.ImportRowNew},
+		{Line: 21, Currency: "EUR", Status: types.ImportRowInvalid, Error: `date "2/30/2024" is not a QIF date`},
+		{Line: 24, Date: date(2024, 2, 4), Kind: types.TransactionExpense, Amount: 2000, Currency: "EUR", Note: "Check 1024", Status: types.ImportRowNew},
+	})
+
+	if statements[1].Account != nil {
+		t.Errorf("Account = %+v, want nil without !Account block", statements[1].Account)
+	}
+	checkRows(t, statements[1].Rows, []types.ImportRow{
+		{Line: 29, Date: date(2024, 2, 5), Kind: types.TransactionExpense, Amount: 1500, Currency: "EUR", Payee: "Bookstore", Category: "Books", Status: types.ImportRowNew},
+	})
+}
+
+func TestParseQIFDayFirst(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name     string
+		data     string
+		dayFirst *bool
+		want     []time.Time
+	}{
+		{"detected from a day after the 12th", "!Type:Bank\nD05.02.2024\nT-1,00\n^\nD31.01.2024\nT-2,50\n^\n", nil, []time.Time{date(2024, 2, 5), date(2024, 1, 31)}},
+		{"month first when no date tells", "!Type:Bank\nD05/02/2024\nT-1.00\n^\n", nil, []time.Time{date(2024, 5, 2)}},
+		{"given day first", "!Type:Bank\nD05/02/2024\nT-1.00\n^\n", &yes, []time.Time{date(2024, 2, 5)}},
+		{"given month first", "!Type:Bank\nD05/02/2024\nT-1.00\n^\n", &no, []time.Time{date(2024, 5, 2)}},
+		{"last record without end", "!Type:Cash\r\nD1/2/2024\r\nT-1.00\r\n", nil, []time.Time{date(2024, 1, 2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := ParseQIF([]byte(tt.data), "USD", tt.dayFirst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := statements[0].Rows
+			if len(rows) != len(tt.want) {
+				t.Fatalf("%d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if rows[i].Status != types.ImportRowNew || !rows[i].Date.Equal(want) {
+					t.Errorf("row %d = %+v, want a new row on %v", i, rows[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseQIFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", "the file holds no bank, cash or credit card transaction"},
+		{"investments only", "!Type:Invst\nD1/1/2024\nT-1.00\n^\n", "the file holds no bank, cash or credit card transaction"},
+		{"categories only", "!Type:Cat\nNFood\nE\n^\n", "the file holds no bank, cash or credit card transaction"},
+		{"too many transactions", "!Type:Bank\n" + strings.Repeat("D1/1/2024\nT-1.00\n^\n", MaxRows+1), "the file has more than 5000 transactions"},
+	}
+	for _, tt := range tests {
+		_, err := ParseQIF([]byte(tt.data), "USD", nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		value    string
+		dayFirst bool
+		want     time.Time
+		wantErr  bool
+	}{
+		{"1/31'24", false, date(2024, 1, 31), false},
+		{" 1/ 5'24", false, date(2024, 1, 5), false},
+		{"12/31/99", false, date(1999, 12, 31), false},
+		{"1/1/69", false, date(2069, 1, 1), false},
+		{"1/1/70", false, date(1970, 1, 1), false},
+		{"05.02.2024", true, date(2024, 2, 5), false},
+		{"2024-02-05", true, date(2024, 2, 5), false},
+		{"13/1/2024", false, time.Time{}, true},
+		{"2/29/2023", false, time.Time{}, true},
+		{"1/2", false, time.Time{}, true},
+		{"a/b/c", false, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseQIFDate(tt.value, tt.dayFirst)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseQIFDate(%q, %v) = %v, %v, want %v, wantErr %v", tt.value, tt.dayFirst, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDetectQIFDayFirst(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   bool
+	}{
+		{"month first", []string{"1/31/2024"}, false},
+		{"day first", []string{"31/1/2024"}, true},
+		{"first telling date", []string{"1/2/2024", "13/2/2024"}, true},
+		{"year first skipped", []string{"2024-01-31", "31.01.2024"}, true},
+		{"no telling date", []string{"1/2/2024", "bad"}, false},
+		{"none", nil, false},
+	}
+	for _, tt := range tests {
+		if got := detectQIFDayFirst(tt.values); got != tt.want {
+			t.Errorf("%s: detectQIFDayFirst = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/notifications"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// alertBatchSize is the number of alerts delivered per pass.
+const alertBatchSize = 100
+
+// AlertDeliveryJob hands the budget alerts raised by the ledger to the notifier.
+//
+// The alerts are raised in the database transaction of the spending that crossed a limit, then
+// delivered by this job, so an alert is never sent for a change that was rolled back. An alert is
+// delivered at least once: it is retried at the next pass until the notifier accepts it.
+type AlertDeliveryJob struct {
+	Repository *database.AlertRepository
+	Notifier   notifications.Notifier
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewAlertDeliveryJob creates a new AlertDeliveryJob using the provided repository and notifier.
+func NewAlertDeliveryJob(repo *database.AlertRepository, notifier notifications.Notifier) *AlertDeliveryJob {
+	return &AlertDeliveryJob{Repository: repo, Notifier: notifier, Now: time.Now}
+}
+
+// Name identifies the job in the logs.
+func (j *AlertDeliveryJob) Name() string {
+	return "alert-delivery"
+}
+
+// Run delivers a batch of undelivered alerts.
+//
+// A failure on one alert is logged and does not prevent the others from being delivered.
+func (j *AlertDeliveryJob) Run(ctx context.Context) error {
+	alerts, err := j.Repository.GetUndeliveredAlerts(alertBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var delivered []snowflake.ID
+	for _, alert := range alerts {
+		if ctx.Err() != nil {
+			break
+		}
+
+		n := notifications.Notification{
+			AiboID:  alert.AiboID,
+			Kind:    "alert." + string(alert.Kind),
+			Subject: "Budget alert",
+			Body:    alert.Message,
+			Data:    map[string]string{"alert_id": alert.ID.String()},
+		}
+		if alert.CatBudID != nil {
+			n.Data["cat_bud_id"] = alert.CatBudID.String()
+		}
+
+		if err := j.Notifier.Notify(ctx, n); err != nil {
+			slog.Error("Failed to deliver alert", "alert_id", alert.ID, "error", err)
+			continue
+		}
+		delivered = append(delivered, alert.ID)
+	}
+
+	return j.Repository.MarkDelivered(delivered, j.Now())
+}
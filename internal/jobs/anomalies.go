@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/notifications"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// anomalyBatchSize is the number of findings delivered per pass.
+const anomalyBatchSize = 100
+
+// AnomalyDeliveryJob hands the unusual expenses found by the ledger to the notifier, for the aibos
+// that asked to be notified of them.
+//
+// The findings are made in the database transaction of the expense, then delivered by this job,
+// like the budget alerts. The findings of the aibos that did not ask to be notified, and the ones
+// already reviewed, are only marked as delivered.
+type AnomalyDeliveryJob struct {
+	Repository *database.AnomalyRepository
+	Notifier   notifications.Notifier
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewAnomalyDeliveryJob creates a new AnomalyDeliveryJob using the provided repository and notifier.
+func NewAnomalyDeliveryJob(repo *database.AnomalyRepository, notifier notifications.Notifier) *AnomalyDeliveryJob {
+	return &AnomalyDeliveryJob{Repository: repo, Notifier: notifier, Now: time.Now}
+}
+
+// Name identifies the job in the logs.
+func (j *AnomalyDeliveryJob) Name() string {
+	return "anomaly-delivery"
+}
+
+// Run delivers a batch of undelivered findings.
+//
+// A failure on one finding is logged and does not prevent the others from being delivered.
+func (j *AnomalyDeliveryJob) Run(ctx context.Context) error {
+	anomalies, err := j.Repository.GetUndeliveredAnomalies(anomalyBatchSize)
+	if err != nil {
+		return err
+	}
+
+	notify := make(map[uuid.UUID]bool)
+	var delivered []snowflake.ID
+	for _, anomaly := range anomalies {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wanted, ok := notify[anomaly.AiboID]
+		if !ok {
+			settings, err := j.Repository.GetSettings(anomaly.AiboID)
+			if err != nil {
+				slog.Error("Failed to get anomaly settings", "aibo_id", anomaly.AiboID, "error", err)
+				continue
+			}
+			wanted = settings.Notify
+			notify[anomaly.AiboID] = wanted
+		}
+
+		if wanted && anomaly.ReviewedAt == nil {
+			n := notifications.Notification{
+				AiboID:  anomaly.AiboID,
+				Kind:    "anomaly." + string(anomaly.Kind),
+				Subject: "Unusual expense",
+				Body:    anomaly.Message,
+				Data: map[string]string{
+					"anomaly_id":     anomaly.ID.String(),
+					"transaction_id": anomaly.TransactionID.String(),
+				},
+			}
+			if err := j.Notifier.Notify(ctx, n); err != nil {
+				slog.Error("Failed to deliver anomaly", "anomaly_id", anomaly.ID, "error", err)
+				continue
+			}
+		}
+		delivered = append(delivered, anomaly.ID)
+	}
+
+	return j.Repository.MarkDelivered(delivered, j.Now())
+}
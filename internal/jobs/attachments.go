@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/storage"
+	"context"
+	"log/slog"
+)
+
+// attachmentBatchSize is the number of orphaned files removed per pass.
+const attachmentBatchSize = 100
+
+// AttachmentCleanupJob removes from the storage the files whose transaction or CatBud was deleted.
+//
+// The files are detached in the database transaction of the deletion, then removed by this job,
+// so that a rolled back deletion never loses a file.
+type AttachmentCleanupJob struct {
+	Repository *database.AttachmentRepository
+	Storage    storage.Storage
+}
+
+// NewAttachmentCleanupJob creates a new AttachmentCleanupJob using the provided repository and
+// storage.
+func NewAttachmentCleanupJob(repo *database.AttachmentRepository, store storage.Storage) *AttachmentCleanupJob {
+	return &AttachmentCleanupJob{Repository: repo, Storage: store}
+}
+
+// Name identifies the job in the logs.
+func (j *AttachmentCleanupJob) Name() string {
+	return "attachment-cleanup"
+}
+
+// Run removes a batch of orphaned files, with their thumbnails.
+//
+// A failure on one file is logged and does not prevent the others from being removed; the file
+// is tried again on the next pass.
+func (j *AttachmentCleanupJob) Run(ctx context.Context) error {
+	attachments, err := j.Repository.GetOrphanedAttachments(attachmentBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range attachments {
+		if ctx.Err() != nil {
+			break
+		}
+		attachment := &attachments[i]
+
+		removed := true
+		for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey()} {
+			if key == "" {
+				continue
+			}
+			if err := j.Storage.Delete(ctx, key); err != nil {
+				slog.Error("Failed to delete attachment file", "attachment_id", attachment.ID, "key", key, "error", err)
+				removed = false
+				break
+			}
+		}
+		if !removed {
+			continue
+		}
+		if err := j.Repository.DeleteAttachment(attachment); err != nil {
+			slog.Error("Failed to delete attachment", "attachment_id", attachment.ID, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DailyRolloverJob closes the daily budget of every Aibo whose local midnight has passed.
+//
+// The surplus or deficit of each closed day is carried into CurrentDelta according to the
+// Aibo's rollover policy, and a history row is recorded for the day.
+type DailyRolloverJob struct {
+	Repository *database.DailyBudgetRepository
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewDailyRolloverJob creates a new DailyRolloverJob using the provided repository.
+func NewDailyRolloverJob(repo *database.DailyBudgetRepository) *DailyRolloverJob {
+	return &DailyRolloverJob{Repository: repo, Now: time.Now}
+}
+
+// Name identifies the job in the logs.
+func (j *DailyRolloverJob) Name() string {
+	return "daily-rollover"
+}
+
+// Run closes the due days of every Aibo.
+//
+// A failure on one Aibo is logged and does not prevent the others from being processed.
+func (j *DailyRolloverJob) Run(ctx context.Context) error {
+	now := j.Now()
+
+	aiboIDs, err := j.Repository.GetDueAiboIDs(now)
+	if err != nil {
+		return err
+	}
+
+	for _, aiboID := range aiboIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		closed, err := j.Repository.CloseDueDays(aiboID, now)
+		if err != nil {
+			slog.Error("Failed to close daily budget", "aibo_id", aiboID, "error", err)
+			continue
+		}
+		if closed > 0 {
+			slog.Info("Daily budget closed", "aibo_id", aiboID, "days", closed)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"context"
+	"log/slog"
+)
+
+// exchangeRateRefreshBatchSize is the number of Aibos refreshed per pass.
+const exchangeRateRefreshBatchSize = 50
+
+// ExchangeRateRefreshJob converts again the transactions of the Aibos queued by an import of
+// exchange rates, and recalculates their ledger.
+//
+// The import only stores the rates and queues the Aibos, so that an upload does not hold the
+// ledgers of every Aibo with foreign-currency transactions in its request.
+type ExchangeRateRefreshJob struct {
+	Repository *database.ExchangeRateRepository
+}
+
+// NewExchangeRateRefreshJob creates a new ExchangeRateRefreshJob using the provided repository.
+func NewExchangeRateRefreshJob(repo *database.ExchangeRateRepository) *ExchangeRateRefreshJob {
+	return &ExchangeRateRefreshJob{Repository: repo}
+}
+
+// Name identifies the job in the logs.
+func (j *ExchangeRateRefreshJob) Name() string {
+	return "exchange-rate-refresh"
+}
+
+// Run refreshes a batch of queued Aibos, each in its own database transaction.
+//
+// A failure on one Aibo is logged and does not prevent the others from being refreshed; the
+// Aibo stays queued and is tried again on the next pass.
+func (j *ExchangeRateRefreshJob) Run(ctx context.Context) error {
+	refreshes, err := j.Repository.GetPendingRefreshes(exchangeRateRefreshBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, refresh := range refreshes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := j.Repository.RefreshAibo(refresh.AiboID); err != nil {
+			slog.Error("Failed to refresh exchange rates", "aibo_id", refresh.AiboID, "error", err)
+		}
+	}
+	return nil
+}
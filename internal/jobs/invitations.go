@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/notifications"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// invitationBatchSize is the number of invitations emailed per pass.
+const invitationBatchSize = 50
+
+// InvitationEmailJob emails the Household invitations to their invitees.
+//
+// The invitees may not have an account yet, so the invitations are emailed to their address
+// instead of being notified to an Aibo. An invitation is retried at the next pass until the email
+// is sent, while it can still be accepted; an address rejected by the mail server is not retried.
+type InvitationEmailJob struct {
+	Repository *database.HouseholdRepository
+	Emailer    notifications.Emailer
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewInvitationEmailJob creates a new InvitationEmailJob using the provided repository and emailer.
+func NewInvitationEmailJob(repo *database.HouseholdRepository, emailer notifications.Emailer) *InvitationEmailJob {
+	return &InvitationEmailJob{Repository: repo, Emailer: emailer, Now: time.Now}
+}
+
+// Name identifies the job in the logs.
+func (j *InvitationEmailJob) Name() string {
+	return "invitation-email"
+}
+
+// Run emails a batch of the invitations not emailed yet.
+//
+// A failure on one invitation is logged and does not prevent the others from being emailed.
+func (j *InvitationEmailJob) Run(ctx context.Context) error {
+	now := j.Now()
+	invitations, err := j.Repository.GetUnsentInvitations(invitationBatchSize, now)
+	if err != nil {
+		return err
+	}
+
+	var emailed []snowflake.ID
+	for _, invitation := range invitations {
+		if ctx.Err() != nil {
+			break
+		}
+
+		n := notifications.Notification{
+			Kind:    "household.invitation",
+			Subject: "Household invitation",
+			Data: map[string]string{
+				"invitation_id":  invitation.ID.String(),
+				"household_id":   invitation.HouseholdID.String(),
+				"household_name": invitation.HouseholdName,
+				"role":           string(invitation.Role),
+				"expires_at":     invitation.ExpiresAt.UTC().Format("January 2, 2006"),
+			},
+		}
+
+		if err := j.Emailer.Email(ctx, invitation.Email, n); err != nil {
+			slog.Error("Failed to email invitation", "invitation_id", invitation.ID, "error", err)
+			if !notifications.IsPermanent(err) {
+				continue
+			}
+		}
+		emailed = append(emailed, invitation.ID)
+	}
+
+	return j.Repository.MarkInvitationsEmailed(emailed, j.Now())
+}
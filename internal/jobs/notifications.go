@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"aibo/internal/notifications"
+	"context"
+	"log/slog"
+)
+
+// NotificationDeliveryJob sends the queued notifications through their channels.
+//
+// Failed deliveries stay in the queue and are retried with backoff by the next passes.
+type NotificationDeliveryJob struct {
+	Service *notifications.Service
+}
+
+// NewNotificationDeliveryJob creates a new NotificationDeliveryJob using the provided service.
+func NewNotificationDeliveryJob(service *notifications.Service) *NotificationDeliveryJob {
+	return &NotificationDeliveryJob{Service: service}
+}
+
+// Name identifies the job in the logs.
+func (j *NotificationDeliveryJob) Name() string {
+	return "notification-delivery"
+}
+
+// Run sends a batch of due deliveries.
+func (j *NotificationDeliveryJob) Run(ctx context.Context) error {
+	sent, err := j.Service.DeliverDue(ctx)
+	if err != nil {
+		return err
+	}
+	if sent > 0 {
+		slog.Info("Notifications delivered", "deliveries", sent)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RecurringJob records in the ledger the occurrences of the recurring rules that came due.
+type RecurringJob struct {
+	Repository *database.RecurringRepository
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewRecurringJob creates a new RecurringJob using the provided repository.
+func NewRecurringJob(repo *database.RecurringRepository) *RecurringJob {
+	return &RecurringJob{Repository: repo, Now: time.Now}
+}
+
+// Name identifies the job in the logs.
+func (j *RecurringJob) Name() string {
+	return "recurring-transactions"
+}
+
+// Run materializes the due occurrences of every rule.
+//
+// A failure on one rule is logged and does not prevent the others from being processed.
+func (j *RecurringJob) Run(ctx context.Context) error {
+	now := j.Now()
+
+	ruleIDs, err := j.Repository.GetDueRuleIDs(now)
+	if err != nil {
+		return err
+	}
+
+	for _, ruleID := range ruleIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		created, err := j.Repository.MaterializeDue(ruleID, now)
+		if err != nil {
+			slog.Error("Failed to materialize recurring rule", "rule_id", ruleID, "error", err)
+			continue
+		}
+		if created > 0 {
+			slog.Info("Recurring transactions recorded", "rule_id", ruleID, "transactions", created)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"aibo/internal/database"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SavingsJob records the automatic contributions of the savings goals that came due.
+type SavingsJob struct {
+	Repository *database.SavingsRepository
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewSavingsJob creates a new SavingsJob using the provided repository.
+func NewSavingsJob(repo *database.SavingsRepository) *SavingsJob {
+	return &SavingsJob{Repository: repo, Now: time.Now}
+}
+
+// Name identifies the job in the logs.
+func (j *SavingsJob) Name() string {
+	return "savings-contributions"
+}
+
+// Run records the due automatic contributions of every goal.
+//
+// A failure on one goal is logged and does not prevent the others from being processed.
+func (j *SavingsJob) Run(ctx context.Context) error {
+	now := j.Now()
+
+	goalIDs, err := j.Repository.GetDueGoalIDs(now)
+	if err != nil {
+		return err
+	}
+
+	for _, goalID := range goalIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		created, err := j.Repository.ContributeDue(goalID, now)
+		if err != nil {
+			slog.Error("Failed to record automatic contribution", "goal_id", goalID, "error", err)
+			continue
+		}
+		if created > 0 {
+			slog.Info("Automatic contributions recorded", "goal_id", goalID, "contributions", created)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job is a unit of background work run periodically by the Scheduler.
+//
+// Jobs must be idempotent: every replica of the server runs its own Scheduler, so the
+// same job may run several times, concurrently, for the same period.
+type Job interface {
+	// Name identifies the job in the logs.
+	Name() string
+	// Run performs one pass of the job. It should return early when ctx is done.
+	Run(ctx context.Context) error
+}
+
+type scheduledJob struct {
+	job      Job
+	interval time.Duration
+}
+
+// Scheduler runs registered jobs at a fixed interval until its context is cancelled.
+type Scheduler struct {
+	jobs []scheduledJob
+	wg   sync.WaitGroup
+}
+
+// NewScheduler creates a new, empty Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every registers a job to be run once at start and then every interval.
+func (s *Scheduler) Every(interval time.Duration, job Job) {
+	s.jobs = append(s.jobs, scheduledJob{job: job, interval: interval})
+}
+
+// Start launches every registered job in its own goroutine and returns immediately.
+//
+// Errors returned by a job are logged and the job is retried at the next tick.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, sj := range s.jobs {
+		s.wg.Add(1)
+		go func(sj scheduledJob) {
+			defer s.wg.Done()
+			slog.Info("Starting job", "job", sj.job.Name(), "interval", sj.interval)
+
+			ticker := time.NewTicker(sj.interval)
+			defer ticker.Stop()
+
+			for {
+				if err := sj.job.Run(ctx); err != nil {
+					slog.Error("Job failed", "job", sj.job.Name(), "error", err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(sj)
+	}
+}
+
+// Wait blocks until every job goroutine has returned after the context was cancelled.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// IntervalFromEnv reads a duration (e.g. "1m", "30s") from the given environment
+// variable, falling back to the default when it is unset or invalid.
+func IntervalFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		slog.Error("Invalid job interval, using default", "variable", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return interval
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingJob counts its runs and fails when told to.
+type countingJob struct {
+	runs atomic.Int32
+	err  error
+}
+
+func (j *countingJob) Name() string {
+	return "counting"
+}
+
+func (j *countingJob) Run(ctx context.Context) error {
+	j.runs.Add(1)
+	return j.err
+}
+
+func TestSchedulerRunsUntilCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"succeeding", nil},
+		{"failing", errors.New("database unavailable")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &countingJob{err: tt.err}
+			scheduler := NewScheduler()
+			scheduler.Every(5*time.Millisecond, job)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			scheduler.Start(ctx)
+			deadline := time.Now().Add(time.Second)
+			for job.runs.Load() < 3 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			scheduler.Wait()
+
+			runs := job.runs.Load()
+			if runs < 3 {
+				t.Fatalf("the job ran %d times, want it retried at each tick", runs)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if job.runs.Load() != runs {
+				t.Fatal("the job ran after Wait returned")
+			}
+		})
+	}
+}
+
+func TestIntervalFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", time.Minute},
+		{"30s", 30 * time.Second},
+		{"2h", 2 * time.Hour},
+		{"often", time.Minute},
+		{"-5m", time.Minute},
+		{"0s", time.Minute},
+	}
+	for _, tt := range tests {
+		t.Setenv("AIBO_TEST_INTERVAL", tt.value)
+		if got := IntervalFromEnv("AIBO_TEST_INTERVAL", time.Minute); got != tt.want {
+			t.Errorf("IntervalFromEnv(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
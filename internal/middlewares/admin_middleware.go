@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"aibo/internal/database"
+	"aibo/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware is a middleware that checks if a user administers the instance.
+// If the user is not an administrator, it returns a 403 status with a JSON response containing the error message "This feature is restricted to administrators".
+// If the user is not found, it returns a 404 status with a JSON response containing the error message "User not found".
+// If the user is an administrator, it calls the next handler in the chain.
+func AdminMiddleware(repo *database.AiboRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("aibo_id")
+
+		user, err := repo.GetAiboByID(userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		if !user.IsAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, types.ErrorResponse{Error: "This feature is restricted to administrators"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -30,7 +30,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", claims.AiboID)
+		c.Set("aibo_id", claims.AiboID)
 		c.Next()
 	}
 }
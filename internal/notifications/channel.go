@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"context"
+	"errors"
+)
+
+// Message is a queued Notification along with what a channel needs to reach its recipient.
+type Message struct {
+	Notification *types.Notification
+	// Aibo is the recipient.
+	Aibo *types.Aibo
+	// Address is the email address of a recipient without an Aibo, such as an invitee. It is used
+	// instead of the address of Aibo.
+	Address string
+	// Settings are the notification settings of the recipient.
+	Settings *types.NotificationSettings
+	// Subscription is the browser reached by a web_push delivery.
+	Subscription *types.PushSubscription
+}
+
+// Channel sends notifications through one medium.
+type Channel interface {
+	// Name is the channel the deliveries are queued for.
+	Name() types.NotificationChannel
+	// Send delivers the message. Errors wrapped with Permanent are not retried.
+	Send(ctx context.Context, msg Message) error
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying cannot fix, such as a rejected address.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,63 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// FakeChannel is a local transport standing for a real channel. It records the messages it is
+// given instead of sending them, which lets the delivery pipeline run without any mail server,
+// webhook receiver or push service.
+type FakeChannel struct {
+	channel types.NotificationChannel
+
+	mu   sync.Mutex
+	sent []Message
+	err  error
+}
+
+// NewFakeChannel creates a fake transport for the given channel.
+func NewFakeChannel(channel types.NotificationChannel) *FakeChannel {
+	return &FakeChannel{channel: channel}
+}
+
+// Name returns the channel the fake stands for.
+func (c *FakeChannel) Name() types.NotificationChannel {
+	return c.channel
+}
+
+// Send records and logs the message, or returns the error set with FailWith.
+func (c *FakeChannel) Send(_ context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, msg)
+	slog.Info("Fake notification sent", "channel", c.channel, "aibo_id", msg.Notification.AiboID,
+		"kind", msg.Notification.Kind, "subject", msg.Notification.Subject)
+	return nil
+}
+
+// FailWith makes the next sends fail with err, or succeed again with nil.
+func (c *FakeChannel) FailWith(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Sent returns a copy of the messages sent so far.
+func (c *FakeChannel) Sent() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.sent...)
+}
+
+// Reset forgets the messages sent so far.
+func (c *FakeChannel) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = nil
+}
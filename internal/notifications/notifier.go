@@ -0,0 +1,38 @@
+// Package notifications delivers messages to the Aibos outside of the HTTP responses.
+package notifications
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Notification is a message for an Aibo, independent of the channel delivering it.
+type Notification struct {
+	// AiboID is the recipient.
+	AiboID uuid.UUID
+	// Kind identifies the event, such as "alert.budget_used".
+	Kind string
+	// Subject is a short summary of the message.
+	Subject string
+	// Body is the full message.
+	Body string
+	// Data holds the identifiers a client needs to link the message to the event.
+	Data map[string]string
+}
+
+// Notifier delivers notifications. Service is the implementation used by the application.
+//
+// Notify may be called several times for the same notification, since the callers retry until
+// it succeeds.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Emailer sends notifications to email addresses that may not belong to an Aibo, such as the
+// invitees of a Household. Service is the implementation used by the application.
+//
+// The email is sent right away instead of being queued, so the callers retry until Email succeeds.
+type Emailer interface {
+	Email(ctx context.Context, address string, n Notification) error
+}
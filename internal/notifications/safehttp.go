@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for a webhook URL or a push endpoint reaching an address that is
+// not publicly routable, such as the loopback, a private network or the cloud metadata service.
+var ErrForbiddenAddress = errors.New("the address is not publicly routable")
+
+// errRedirect is returned for a redirect answered by a webhook receiver or a push service.
+var errRedirect = errors.New("redirects are not followed")
+
+// reservedPrefixes are the ranges that are not publicly routable besides the loopback, private,
+// link-local, multicast and unspecified addresses that net/netip recognizes.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublicAddress reports whether the application may send requests to the address on behalf of
+// a user.
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// newPublicClient returns an HTTP client for the addresses given by users: it only connects to
+// public addresses, checked on the address actually dialed so that a DNS answer changing after the
+// URL was accepted cannot reach the internal network, ignores the proxy settings and does not
+// follow redirects.
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !IsPublicAddress(addrPort.Addr()) {
+				return Permanent(fmt.Errorf("%w: %s", ErrForbiddenAddress, address))
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return Permanent(errRedirect)
+		},
+	}
+}
+
+// CheckPublicURL checks that a webhook URL or a push endpoint uses an accepted scheme and that its
+// host only resolves to public addresses. The addresses are checked again on each request.
+func CheckPublicURL(ctx context.Context, rawURL string, schemes ...string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+	accepted := false
+	for _, scheme := range schemes {
+		accepted = accepted || u.Scheme == scheme
+	}
+	if !accepted {
+		return fmt.Errorf("the URL scheme must be one of %v", schemes)
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !IsPublicAddress(addr) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("the host %q cannot be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !IsPublicAddress(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		schemes []string
+		wantErr bool
+	}{
+		{"https://93.184.216.34/hook", []string{"https", "http"}, false},
+		{"http://93.184.216.34/hook", []string{"https"}, true},
+		{"https://127.0.0.1/hook", []string{"https"}, true},
+		{"https://[::1]:8443/hook", []string{"https"}, true},
+		{"http://169.254.169.254/latest/meta-data/", []string{"https", "http"}, true},
+		{"https://localhost/hook", []string{"https"}, true},
+		{"ftp://93.184.216.34/", []string{"https", "http"}, true},
+		{"not a url", []string{"https"}, true},
+	}
+	for _, tt := range tests {
+		err := CheckPublicURL(context.Background(), tt.url, tt.schemes...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckPublicURL(%q) = %v, want error %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPublicClientRefusesInternalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	_, err := newPublicClient(0).Post(server.URL, "application/json", nil)
+	if !errors.Is(err, ErrForbiddenAddress) || !IsPermanent(err) {
+		t.Fatalf("err = %v, want a permanent ErrForbiddenAddress", err)
+	}
+	if called {
+		t.Fatal("the loopback server was reached")
+	}
+}
+
+func TestPublicClientRefusesRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// The test server is on the loopback: only the redirect policy of the client is used.
+	client := server.Client()
+	client.CheckRedirect = newPublicClient(0).CheckRedirect
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, errRedirect) || !IsPermanent(err) {
+		t.Fatalf("err = %v, want a permanent errRedirect", err)
+	}
+}
@@ -0,0 +1,315 @@
+package notifications
+
+import (
+	"aibo/internal/database"
+	"aibo/internal/types"
+	"aibo/internal/utilitaries"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// deliveryBatchSize is the number of deliveries claimed per pass.
+	deliveryBatchSize = 50
+	// deliveryLease is how long a claimed delivery is hidden from the other replicas.
+	deliveryLease = 5 * time.Minute
+	// maxSubjectLength is the size of the subject column.
+	maxSubjectLength = 255
+)
+
+// Store keeps the notifications and their deliveries. The one of the application is
+// *database.NotificationRepository.
+type Store interface {
+	GetSettings(aiboID uuid.UUID) (*types.NotificationSettings, error)
+	Enqueue(n *types.Notification, channels []types.NotificationChannel, now time.Time) error
+	ClaimDueDeliveries(now time.Time, limit int, lease time.Duration) ([]types.NotificationDelivery, error)
+	MarkSent(delivery *types.NotificationDelivery, now time.Time) error
+	MarkFailedAttempt(delivery *types.NotificationDelivery, cause error, final bool, now time.Time) error
+	Postpone(delivery *types.NotificationDelivery, at time.Time) error
+	GetPushSubscriptionByID(id snowflake.ID) (*types.PushSubscription, error)
+	DeletePushSubscription(id snowflake.ID) error
+}
+
+// AiboStore finds the recipients of the notifications. The one of the application is
+// *database.AiboRepository.
+type AiboStore interface {
+	GetAiboByID(id string) (*types.Aibo, error)
+}
+
+// ErrEmailNotConfigured is returned by Email when the service has no email channel.
+var ErrEmailNotConfigured = errors.New("the email channel is not configured")
+
+// Service is the Notifier of the application. Notify renders the message from its template and
+// queues it in the database for every channel the recipient enabled; DeliverDue then sends the
+// queued deliveries, retrying the failed ones with backoff and holding them during the quiet hours
+// of the recipient.
+type Service struct {
+	Repository     Store
+	AiboRepository AiboStore
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+
+	channels map[types.NotificationChannel]Channel
+}
+
+// NewService creates a notification service delivering through the given channels. The in-app
+// inbox is always available and needs no channel.
+func NewService(db *gorm.DB, channels ...Channel) *Service {
+	s := &Service{
+		Repository:     database.NewNotificationRepository(db),
+		AiboRepository: database.NewAiboRepository(db),
+		Now:            time.Now,
+		channels:       make(map[types.NotificationChannel]Channel, len(channels)),
+	}
+	for _, channel := range channels {
+		s.channels[channel.Name()] = channel
+	}
+	return s
+}
+
+// ChannelsFromEnv builds the delivery channels configured in the environment:
+//
+// * NOTIFICATION_TRANSPORT: "fake" replaces the email, webhook and Web Push transports with
+// FakeChannel, which only logs the messages (default: the real transports).
+// * SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM: The mail server of
+// the email channel, enabled when SMTP_HOST is set.
+// * VAPID_PUBLIC_KEY, VAPID_PRIVATE_KEY, VAPID_SUBJECT: The keys of the Web Push channel, enabled
+// when VAPID_PRIVATE_KEY is set.
+//
+// The webhook channel is always enabled.
+func ChannelsFromEnv() []Channel {
+	if os.Getenv("NOTIFICATION_TRANSPORT") == "fake" {
+		return []Channel{
+			NewFakeChannel(types.ChannelEmail),
+			NewFakeChannel(types.ChannelWebhook),
+			NewFakeChannel(types.ChannelWebPush),
+		}
+	}
+
+	channels := []Channel{NewWebhookChannel()}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		channels = append(channels, NewSMTPChannel(SMTPConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}))
+	}
+
+	if private := os.Getenv("VAPID_PRIVATE_KEY"); private != "" {
+		push, err := NewWebPushChannel(VAPIDKeys{
+			PublicKey:  os.Getenv("VAPID_PUBLIC_KEY"),
+			PrivateKey: private,
+			Subject:    os.Getenv("VAPID_SUBJECT"),
+		})
+		if err != nil {
+			slog.Error("Web Push disabled", "error", err)
+		} else {
+			channels = append(channels, push)
+		}
+	}
+
+	return channels
+}
+
+// Configured reports whether the service can deliver through the channel.
+func (s *Service) Configured(channel types.NotificationChannel) bool {
+	if channel == types.ChannelInApp {
+		return true
+	}
+	_, ok := s.channels[channel]
+	return ok
+}
+
+// VAPIDPublicKey returns the key browsers subscribe to Web Push with, or an empty string when Web
+// Push is not configured.
+func (s *Service) VAPIDPublicKey() string {
+	if push, ok := s.channels[types.ChannelWebPush].(*WebPushChannel); ok {
+		return push.PublicKey()
+	}
+	return ""
+}
+
+// Notify renders the notification with the template of its kind and queues it for the channels
+// the recipient enabled among the configured ones.
+func (s *Service) Notify(ctx context.Context, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	aibo, err := s.AiboRepository.GetAiboByID(n.AiboID.String())
+	if err != nil {
+		return err
+	}
+	settings, err := s.Repository.GetSettings(n.AiboID)
+	if err != nil {
+		return err
+	}
+
+	message, err := render(n.Kind, templateData{FirstName: aibo.FirstName, Subject: n.Subject, Body: n.Body, Data: n.Data})
+	if err != nil {
+		return err
+	}
+	var data json.RawMessage
+	if len(n.Data) > 0 {
+		if data, err = json.Marshal(n.Data); err != nil {
+			return err
+		}
+	}
+
+	var channels []types.NotificationChannel
+	for _, channel := range []types.NotificationChannel{types.ChannelInApp, types.ChannelEmail, types.ChannelWebhook, types.ChannelWebPush} {
+		if settings.Enabled(channel) && s.Configured(channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	record := types.Notification{
+		ID:      utilitaries.GenerateSnowflakeID(),
+		AiboID:  n.AiboID,
+		Kind:    n.Kind,
+		Subject: truncate(message.Subject, maxSubjectLength),
+		Body:    message.Text,
+		HTML:    message.HTML,
+		Data:    data,
+	}
+	return s.Repository.Enqueue(&record, channels, s.Now())
+}
+
+// Email renders the notification with the template of its kind and sends it right away to the
+// address through the email channel. The AiboID of the notification is ignored.
+//
+// If the email channel is not configured, ErrEmailNotConfigured is returned.
+func (s *Service) Email(ctx context.Context, address string, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	channel := s.channels[types.ChannelEmail]
+	if channel == nil {
+		return ErrEmailNotConfigured
+	}
+
+	message, err := render(n.Kind, templateData{Subject: n.Subject, Body: n.Body, Data: n.Data})
+	if err != nil {
+		return err
+	}
+	record := types.Notification{
+		ID:      utilitaries.GenerateSnowflakeID(),
+		Kind:    n.Kind,
+		Subject: truncate(message.Subject, maxSubjectLength),
+		Body:    message.Text,
+		HTML:    message.HTML,
+	}
+	return channel.Send(ctx, Message{Notification: &record, Address: address})
+}
+
+// DeliverDue sends a batch of the queued deliveries that are due and returns how many were sent.
+//
+// A failure on one delivery is recorded on it and does not prevent the others from being sent.
+func (s *Service) DeliverDue(ctx context.Context) (int, error) {
+	now := s.Now()
+	deliveries, err := s.Repository.ClaimDueDeliveries(now, deliveryBatchSize, deliveryLease)
+	if err != nil {
+		return 0, err
+	}
+
+	recipients := make(map[uuid.UUID]*Message)
+	sent := 0
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			// The remaining deliveries are attempted again once their lease is over.
+			break
+		}
+		ok, err := s.deliver(ctx, &deliveries[i], recipients, now)
+		if err != nil {
+			slog.Error("Failed to record notification delivery", "delivery_id", deliveries[i].ID, "error", err)
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// deliver makes one attempt at a delivery and records its outcome. It reports whether the
+// delivery was sent.
+func (s *Service) deliver(ctx context.Context, d *types.NotificationDelivery, recipients map[uuid.UUID]*Message, now time.Time) (bool, error) {
+	if d.Notification == nil {
+		return false, s.Repository.MarkFailedAttempt(d, errors.New("notification not found"), true, now)
+	}
+
+	recipient, ok := recipients[d.Notification.AiboID]
+	if !ok {
+		aibo, err := s.AiboRepository.GetAiboByID(d.Notification.AiboID.String())
+		if err != nil {
+			return false, s.Repository.MarkFailedAttempt(d, err, errors.Is(err, gorm.ErrRecordNotFound), now)
+		}
+		settings, err := s.Repository.GetSettings(aibo.ID)
+		if err != nil {
+			return false, s.Repository.MarkFailedAttempt(d, err, false, now)
+		}
+		recipient = &Message{Aibo: aibo, Settings: settings}
+		recipients[aibo.ID] = recipient
+	}
+
+	if !recipient.Settings.Enabled(d.Channel) {
+		return false, s.Repository.MarkFailedAttempt(d, errors.New("channel disabled by the aibo"), true, now)
+	}
+	if until, quiet := recipient.Settings.QuietUntil(now, utilitaries.LoadLocation(recipient.Aibo.Timezone)); quiet {
+		return false, s.Repository.Postpone(d, until)
+	}
+
+	channel := s.channels[d.Channel]
+	if channel == nil {
+		return false, s.Repository.MarkFailedAttempt(d, errors.New("channel not configured"), true, now)
+	}
+
+	msg := Message{Notification: d.Notification, Aibo: recipient.Aibo, Settings: recipient.Settings}
+	if d.PushSubscriptionID != nil {
+		subscription, err := s.Repository.GetPushSubscriptionByID(*d.PushSubscriptionID)
+		if err != nil {
+			return false, s.Repository.MarkFailedAttempt(d, err, errors.Is(err, gorm.ErrRecordNotFound), now)
+		}
+		msg.Subscription = subscription
+	}
+
+	sendErr := channel.Send(ctx, msg)
+	if sendErr == nil {
+		return true, s.Repository.MarkSent(d, now)
+	}
+
+	slog.Warn("Notification delivery failed", "delivery_id", d.ID, "channel", d.Channel, "attempt", d.Attempts+1, "error", sendErr)
+	if err := s.Repository.MarkFailedAttempt(d, sendErr, IsPermanent(sendErr), now); err != nil {
+		return false, err
+	}
+	if errors.Is(sendErr, ErrSubscriptionGone) {
+		return false, s.Repository.DeletePushSubscription(*d.PushSubscriptionID)
+	}
+	return false, nil
+}
+
+// truncate cuts the string to at most n bytes, on a rune boundary.
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
@@ -0,0 +1,385 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memoryStore keeps the queue in memory, claiming the deliveries with a lease like the database.
+type memoryStore struct {
+	settings      map[uuid.UUID]*types.NotificationSettings
+	notifications map[snowflake.ID]*types.Notification
+	deliveries    []*types.NotificationDelivery
+	subscriptions map[snowflake.ID]*types.PushSubscription
+	nextID        snowflake.ID
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		settings:      make(map[uuid.UUID]*types.NotificationSettings),
+		notifications: make(map[snowflake.ID]*types.Notification),
+		subscriptions: make(map[snowflake.ID]*types.PushSubscription),
+	}
+}
+
+func (m *memoryStore) GetSettings(aiboID uuid.UUID) (*types.NotificationSettings, error) {
+	if settings, ok := m.settings[aiboID]; ok {
+		copied := *settings
+		return &copied, nil
+	}
+	settings := types.DefaultNotificationSettings(aiboID)
+	return &settings, nil
+}
+
+func (m *memoryStore) Enqueue(n *types.Notification, channels []types.NotificationChannel, now time.Time) error {
+	m.notifications[n.ID] = n
+	for _, channel := range channels {
+		switch channel {
+		case types.ChannelInApp:
+			n.InApp = true
+		case types.ChannelWebPush:
+			for id, subscription := range m.subscriptions {
+				if subscription.AiboID == n.AiboID {
+					subscriptionID := id
+					m.add(n, channel, &subscriptionID, now)
+				}
+			}
+		default:
+			m.add(n, channel, nil, now)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) add(n *types.Notification, channel types.NotificationChannel, subscriptionID *snowflake.ID, now time.Time) {
+	m.nextID++
+	m.deliveries = append(m.deliveries, &types.NotificationDelivery{
+		ID:                 m.nextID,
+		NotificationID:     n.ID,
+		Channel:            channel,
+		PushSubscriptionID: subscriptionID,
+		Status:             types.DeliveryPending,
+		NextAttemptAt:      now,
+	})
+}
+
+func (m *memoryStore) ClaimDueDeliveries(now time.Time, limit int, lease time.Duration) ([]types.NotificationDelivery, error) {
+	var due []*types.NotificationDelivery
+	for _, d := range m.deliveries {
+		if d.Status == types.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]types.NotificationDelivery, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		copied := *d
+		copied.Notification = m.notifications[d.NotificationID]
+		claimed = append(claimed, copied)
+	}
+	return claimed, nil
+}
+
+func (m *memoryStore) save(delivery *types.NotificationDelivery) {
+	for _, d := range m.deliveries {
+		if d.ID == delivery.ID {
+			*d = *delivery
+			d.Notification = nil
+		}
+	}
+}
+
+func (m *memoryStore) MarkSent(delivery *types.NotificationDelivery, now time.Time) error {
+	delivery.RecordSent(now)
+	m.save(delivery)
+	return nil
+}
+
+func (m *memoryStore) MarkFailedAttempt(delivery *types.NotificationDelivery, cause error, final bool, now time.Time) error {
+	delivery.RecordFailure(cause, final, now)
+	m.save(delivery)
+	return nil
+}
+
+func (m *memoryStore) Postpone(delivery *types.NotificationDelivery, at time.Time) error {
+	delivery.NextAttemptAt = at
+	m.save(delivery)
+	return nil
+}
+
+func (m *memoryStore) GetPushSubscriptionByID(id snowflake.ID) (*types.PushSubscription, error) {
+	if subscription, ok := m.subscriptions[id]; ok {
+		return subscription, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStore) DeletePushSubscription(id snowflake.ID) error {
+	delete(m.subscriptions, id)
+	for _, d := range m.deliveries {
+		if d.PushSubscriptionID != nil && *d.PushSubscriptionID == id && d.Status == types.DeliveryPending {
+			d.Status = types.DeliveryFailed
+		}
+	}
+	return nil
+}
+
+// memoryAibos finds the recipients in memory.
+type memoryAibos map[uuid.UUID]*types.Aibo
+
+func (m memoryAibos) GetAiboByID(id string) (*types.Aibo, error) {
+	aibo, ok := m[uuid.MustParse(id)]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return aibo, nil
+}
+
+// dispatcher is a Service over a memory store with fake transports and a controlled clock.
+type dispatcher struct {
+	*Service
+	store   *memoryStore
+	email   *FakeChannel
+	webhook *FakeChannel
+	push    *FakeChannel
+	aiboID  uuid.UUID
+	now     time.Time
+}
+
+func newDispatcher(t *testing.T) *dispatcher {
+	t.Helper()
+	d := &dispatcher{
+		store:   newMemoryStore(),
+		email:   NewFakeChannel(types.ChannelEmail),
+		webhook: NewFakeChannel(types.ChannelWebhook),
+		push:    NewFakeChannel(types.ChannelWebPush),
+		aiboID:  uuid.New(),
+		now:     time.Date(2024, 10, 18, 12, 0, 0, 0, time.UTC),
+	}
+	d.Service = &Service{
+		Repository:     d.store,
+		AiboRepository: memoryAibos{d.aiboID: {ID: d.aiboID, FirstName: "Ada", Email: "ada@example.com", Timezone: "UTC"}},
+		Now:            func() time.Time { return d.now },
+		channels:       make(map[types.NotificationChannel]Channel),
+	}
+	for _, channel := range []Channel{d.email, d.webhook, d.push} {
+		d.channels[channel.Name()] = channel
+	}
+	return d
+}
+
+func (d *dispatcher) notify(t *testing.T) {
+	t.Helper()
+	err := d.Notify(context.Background(), Notification{AiboID: d.aiboID, Kind: "test", Subject: "Hello", Body: "It works"})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+}
+
+func (d *dispatcher) deliverDue(t *testing.T) int {
+	t.Helper()
+	sent, err := d.DeliverDue(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	return sent
+}
+
+func (d *dispatcher) delivery(t *testing.T, channel types.NotificationChannel) *types.NotificationDelivery {
+	t.Helper()
+	for _, delivery := range d.store.deliveries {
+		if delivery.Channel == channel {
+			return delivery
+		}
+	}
+	t.Fatalf("no %s delivery queued", channel)
+	return nil
+}
+
+func TestDeliverDueSendsThroughEnabledChannels(t *testing.T) {
+	d := newDispatcher(t)
+	d.store.settings[d.aiboID] = &types.NotificationSettings{AiboID: d.aiboID, InApp: true, Email: true, Webhook: true, WebhookURL: "https://example.com/hook"}
+	d.notify(t)
+
+	if len(d.store.deliveries) != 2 {
+		t.Fatalf("queued %d deliveries, want email and webhook", len(d.store.deliveries))
+	}
+	if sent := d.deliverDue(t); sent != 2 {
+		t.Fatalf("sent %d deliveries, want 2", sent)
+	}
+	for _, channel := range []*FakeChannel{d.email, d.webhook} {
+		sent := channel.Sent()
+		if len(sent) != 1 || sent[0].Notification.AiboID != d.aiboID || sent[0].Aibo.FirstName != "Ada" {
+			t.Fatalf("%s sent %+v", channel.Name(), sent)
+		}
+	}
+	if len(d.push.Sent()) != 0 {
+		t.Fatal("web push sent without a subscription")
+	}
+	if got := d.delivery(t, types.ChannelEmail); got.Status != types.DeliverySent || got.Attempts != 1 || got.SentAt == nil {
+		t.Fatalf("email delivery = %+v, want sent after 1 attempt", got)
+	}
+	if sent := d.deliverDue(t); sent != 0 {
+		t.Fatalf("sent %d deliveries again", sent)
+	}
+}
+
+func TestDeliverDueRetriesWithBackoff(t *testing.T) {
+	d := newDispatcher(t)
+	d.notify(t)
+	d.email.FailWith(errors.New("connection refused"))
+
+	start := d.now
+	for attempt := 1; attempt <= 3; attempt++ {
+		if sent := d.deliverDue(t); sent != 0 {
+			t.Fatalf("attempt %d: sent %d deliveries", attempt, sent)
+		}
+		delivery := d.delivery(t, types.ChannelEmail)
+		if delivery.Status != types.DeliveryPending || delivery.Attempts != attempt || delivery.LastError != "connection refused" {
+			t.Fatalf("attempt %d: delivery = %+v", attempt, delivery)
+		}
+		backoff := types.DeliveryBackoff(attempt)
+		if want := d.now.Add(backoff); !delivery.NextAttemptAt.Equal(want) {
+			t.Fatalf("attempt %d: next attempt at %v, want %v", attempt, delivery.NextAttemptAt, want)
+		}
+
+		// Not due yet: nothing is claimed.
+		d.now = d.now.Add(backoff - time.Second)
+		d.deliverDue(t)
+		if got := d.delivery(t, types.ChannelEmail).Attempts; got != attempt {
+			t.Fatalf("attempt %d: retried before the backoff, %d attempts", attempt, got)
+		}
+		d.now = d.now.Add(time.Second)
+	}
+	if elapsed := d.now.Sub(start); elapsed != 30*time.Second+time.Minute+2*time.Minute {
+		t.Fatalf("retried over %v, want 3m30s", elapsed)
+	}
+
+	d.email.FailWith(nil)
+	if sent := d.deliverDue(t); sent != 1 {
+		t.Fatalf("sent %d deliveries after recovery, want 1", sent)
+	}
+	if delivery := d.delivery(t, types.ChannelEmail); delivery.Status != types.DeliverySent || delivery.Attempts != 4 || delivery.LastError != "" {
+		t.Fatalf("delivery = %+v, want sent after 4 attempts", delivery)
+	}
+}
+
+func TestDeliverDueGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"permanent error", Permanent(errors.New("mailbox unavailable")), 1},
+		{"out of attempts", errors.New("timeout"), types.MaxDeliveryAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDispatcher(t)
+			d.notify(t)
+			d.email.FailWith(tt.err)
+
+			for i := 0; i < types.MaxDeliveryAttempts+2; i++ {
+				d.deliverDue(t)
+				d.now = d.now.Add(7 * time.Hour)
+			}
+			delivery := d.delivery(t, types.ChannelEmail)
+			if delivery.Status != types.DeliveryFailed || delivery.Attempts != tt.attempts {
+				t.Fatalf("delivery = %+v, want failed after %d attempts", delivery, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestDeliverDueHoldsDuringQuietHours(t *testing.T) {
+	d := newDispatcher(t)
+	start, end := "11:00", "13:30"
+	d.store.settings[d.aiboID] = &types.NotificationSettings{AiboID: d.aiboID, InApp: true, Email: true, QuietHoursStart: &start, QuietHoursEnd: &end}
+	d.notify(t)
+
+	if sent := d.deliverDue(t); sent != 0 {
+		t.Fatalf("sent %d deliveries during the quiet hours", sent)
+	}
+	delivery := d.delivery(t, types.ChannelEmail)
+	if want := time.Date(2024, 10, 18, 13, 30, 0, 0, time.UTC); !delivery.NextAttemptAt.Equal(want) || delivery.Attempts != 0 {
+		t.Fatalf("delivery = %+v, want postponed to %v without an attempt", delivery, want)
+	}
+
+	d.now = delivery.NextAttemptAt
+	if sent := d.deliverDue(t); sent != 1 {
+		t.Fatalf("sent %d deliveries after the quiet hours, want 1", sent)
+	}
+}
+
+func TestDeliverDueRemovesGoneSubscriptions(t *testing.T) {
+	d := newDispatcher(t)
+	d.store.settings[d.aiboID] = &types.NotificationSettings{AiboID: d.aiboID, WebPush: true}
+	d.store.subscriptions[42] = &types.PushSubscription{ID: 42, AiboID: d.aiboID, Endpoint: "https://push.example.com/abc"}
+	d.notify(t)
+	d.push.FailWith(Permanent(ErrSubscriptionGone))
+
+	d.deliverDue(t)
+	if _, ok := d.store.subscriptions[42]; ok {
+		t.Fatal("the gone subscription was kept")
+	}
+	if delivery := d.delivery(t, types.ChannelWebPush); delivery.Status != types.DeliveryFailed {
+		t.Fatalf("delivery = %+v, want failed", delivery)
+	}
+}
+
+func TestEmailSendsToAddress(t *testing.T) {
+	d := newDispatcher(t)
+	err := d.Email(context.Background(), "bob@example.com", Notification{
+		Kind: "household.invitation",
+		Data: map[string]string{"household_name": "Home", "role": "editor", "expires_at": "October 25, 2024"},
+	})
+	if err != nil {
+		t.Fatalf("Email: %v", err)
+	}
+
+	sent := d.email.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	msg := sent[0]
+	if msg.Address != "bob@example.com" || msg.Aibo != nil {
+		t.Errorf("recipient = %q, %+v", msg.Address, msg.Aibo)
+	}
+	if msg.Notification.Subject != "You are invited to join Home on Aibo" {
+		t.Errorf("subject = %q", msg.Notification.Subject)
+	}
+	if !strings.Contains(msg.Notification.Body, "as editor") || !strings.Contains(msg.Notification.HTML, "<strong>Home</strong>") {
+		t.Errorf("body = %q, html = %q", msg.Notification.Body, msg.Notification.HTML)
+	}
+	if len(d.store.deliveries) != 0 {
+		t.Error("the email was queued instead of sent")
+	}
+}
+
+func TestEmailWithoutEmailChannel(t *testing.T) {
+	d := newDispatcher(t)
+	delete(d.channels, types.ChannelEmail)
+	err := d.Email(context.Background(), "bob@example.com", Notification{Kind: "test"})
+	if !errors.Is(err, ErrEmailNotConfigured) {
+		t.Fatalf("err = %v, want ErrEmailNotConfigured", err)
+	}
+}
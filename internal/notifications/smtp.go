@@ -0,0 +1,116 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// SMTPConfig is the mail server the email channel sends through.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// From is the sender address.
+	From string
+}
+
+// SMTPChannel sends the notifications by email, as a plain text and HTML multipart message.
+type SMTPChannel struct {
+	Config SMTPConfig
+	// send delivers the message, smtp.SendMail by default.
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPChannel creates an email channel sending through the given server.
+func NewSMTPChannel(config SMTPConfig) *SMTPChannel {
+	return &SMTPChannel{Config: config, send: smtp.SendMail}
+}
+
+// Name returns types.ChannelEmail.
+func (c *SMTPChannel) Name() types.NotificationChannel {
+	return types.ChannelEmail
+}
+
+// Send emails the message to its Address, or else to the address of the Aibo.
+//
+// A recipient address rejected by the server is a permanent failure.
+func (c *SMTPChannel) Send(ctx context.Context, msg Message) error {
+	to := msg.Address
+	if to == "" && msg.Aibo != nil {
+		to = msg.Aibo.Email
+	}
+	if to == "" {
+		return Permanent(errors.New("the aibo has no email address"))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	body, err := buildEmail(c.Config.From, to, msg.Notification)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	var auth smtp.Auth
+	if c.Config.Username != "" {
+		auth = smtp.PlainAuth("", c.Config.Username, c.Config.Password, c.Config.Host)
+	}
+	err = c.send(net.JoinHostPort(c.Config.Host, c.Config.Port), auth, c.Config.From, []string{to}, body)
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 550 && protoErr.Code < 560 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// buildEmail formats the notification as a MIME message with a plain text and an HTML part.
+func buildEmail(from, to string, n *types.Notification) ([]byte, error) {
+	var boundary [12]byte
+	if _, err := rand.Read(boundary[:]); err != nil {
+		return nil, err
+	}
+	mark := "aibo-" + hex.EncodeToString(boundary[:])
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@aibo>\r\n", n.ID)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mark)
+
+	parts := []struct{ contentType, content string }{{"text/plain", n.Body}}
+	if n.HTML != "" {
+		parts = append(parts, struct{ contentType, content string }{"text/html", n.HTML})
+	}
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", mark)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		w := quotedprintable.NewWriter(&buf)
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", mark)
+
+	return buf.Bytes(), nil
+}
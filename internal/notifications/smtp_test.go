@@ -0,0 +1,56 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"context"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestSMTPChannelSend(t *testing.T) {
+	tests := []struct {
+		name          string
+		msg           Message
+		sendErr       error
+		wantTo        string
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{"aibo", Message{Aibo: &types.Aibo{Email: "ada@example.com"}}, nil, "ada@example.com", false, false},
+		{"address", Message{Address: "bob@example.com"}, nil, "bob@example.com", false, false},
+		{"address over aibo", Message{Aibo: &types.Aibo{Email: "ada@example.com"}, Address: "bob@example.com"}, nil, "bob@example.com", false, false},
+		{"no address", Message{Aibo: &types.Aibo{}}, nil, "", true, true},
+		{"rejected", Message{Address: "bob@example.com"}, &textproto.Error{Code: 550, Msg: "no such user"}, "bob@example.com", true, true},
+		{"unavailable", Message{Address: "bob@example.com"}, &textproto.Error{Code: 421, Msg: "try later"}, "bob@example.com", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var to []string
+			var body []byte
+			channel := &SMTPChannel{
+				Config: SMTPConfig{Host: "mail.example.com", Port: "587", From: "aibo@example.com"},
+				send: func(addr string, auth smtp.Auth, from string, rcpt []string, msg []byte) error {
+					to, body = rcpt, msg
+					return tt.sendErr
+				},
+			}
+			tt.msg.Notification = &types.Notification{ID: 3, Subject: "Hello", Body: "It works"}
+
+			err := channel.Send(context.Background(), tt.msg)
+			if (err != nil) != tt.wantErr || IsPermanent(err) != tt.wantPermanent {
+				t.Fatalf("err = %v, want error %v, permanent %v", err, tt.wantErr, tt.wantPermanent)
+			}
+			if tt.wantTo == "" {
+				if to != nil {
+					t.Fatalf("sent to %v", to)
+				}
+				return
+			}
+			if len(to) != 1 || to[0] != tt.wantTo || !strings.Contains(string(body), "To: "+tt.wantTo+"\r\n") {
+				t.Errorf("sent to %v, body %q", to, body)
+			}
+		})
+	}
+}
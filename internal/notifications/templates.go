@@ -0,0 +1,138 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl templates/*.html
+var templateFiles embed.FS
+
+// defaultTemplate renders the notifications whose kind has no template of its own.
+const defaultTemplate = "default"
+
+var (
+	loadTemplatesOnce sync.Once
+	textTemplates     map[string]*texttemplate.Template
+	htmlTemplates     map[string]*htmltemplate.Template
+	loadTemplatesErr  error
+)
+
+// templateData is what the message templates are executed with.
+type templateData struct {
+	// FirstName of the recipient, possibly empty.
+	FirstName string
+	// Subject and Body given by the caller of Notify.
+	Subject string
+	Body    string
+	// Data given by the caller of Notify.
+	Data map[string]string
+}
+
+// rendered is a message ready to be queued.
+type rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// loadTemplates parses the embedded templates once.
+//
+// A kind is rendered by templates/<kind>.tmpl, which defines the "subject" and "text" templates,
+// and templates/<kind>.html, which holds the HTML body of the emails.
+func loadTemplates() error {
+	loadTemplatesOnce.Do(func() {
+		textTemplates = make(map[string]*texttemplate.Template)
+		htmlTemplates = make(map[string]*htmltemplate.Template)
+
+		entries, err := templateFiles.ReadDir("templates")
+		if err != nil {
+			loadTemplatesErr = err
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			path := "templates/" + name
+			switch {
+			case strings.HasSuffix(name, ".tmpl"):
+				t, err := texttemplate.ParseFS(templateFiles, path)
+				if err != nil {
+					loadTemplatesErr = err
+					return
+				}
+				if t.Lookup("subject") == nil || t.Lookup("text") == nil {
+					loadTemplatesErr = fmt.Errorf("%s must define the subject and text templates", path)
+					return
+				}
+				textTemplates[strings.TrimSuffix(name, ".tmpl")] = t
+			case strings.HasSuffix(name, ".html"):
+				t, err := htmltemplate.ParseFS(templateFiles, path)
+				if err != nil {
+					loadTemplatesErr = err
+					return
+				}
+				htmlTemplates[strings.TrimSuffix(name, ".html")] = t
+			}
+		}
+		if textTemplates[defaultTemplate] == nil || htmlTemplates[defaultTemplate] == nil {
+			loadTemplatesErr = fmt.Errorf("missing %s templates", defaultTemplate)
+		}
+	})
+	return loadTemplatesErr
+}
+
+// templateNames returns the templates that can render a kind, the most specific first: the kind
+// itself ("alert.budget_used"), its family ("alert") and the default template.
+func templateNames(kind string) []string {
+	names := []string{kind}
+	if family, _, found := strings.Cut(kind, "."); found {
+		names = append(names, family)
+	}
+	return append(names, defaultTemplate)
+}
+
+// render executes the templates of the kind with the data.
+func render(kind string, data templateData) (rendered, error) {
+	var out rendered
+	if err := loadTemplates(); err != nil {
+		return out, err
+	}
+
+	var buf bytes.Buffer
+	for _, name := range templateNames(kind) {
+		t := textTemplates[name]
+		if t == nil {
+			continue
+		}
+		if err := t.ExecuteTemplate(&buf, "subject", data); err != nil {
+			return out, err
+		}
+		out.Subject = strings.TrimSpace(buf.String())
+		buf.Reset()
+		if err := t.ExecuteTemplate(&buf, "text", data); err != nil {
+			return out, err
+		}
+		out.Text = strings.TrimSpace(buf.String())
+		buf.Reset()
+		break
+	}
+
+	for _, name := range templateNames(kind) {
+		t := htmlTemplates[name]
+		if t == nil {
+			continue
+		}
+		if err := t.Execute(&buf, data); err != nil {
+			return out, err
+		}
+		out.HTML = buf.String()
+		break
+	}
+
+	return out, nil
+}
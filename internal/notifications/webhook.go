@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WebhookChannel posts the notifications as JSON to the webhook URL of the Aibo.
+//
+// Each request carries the event kind in X-Aibo-Event and, when the Aibo has a webhook secret,
+// the hex HMAC-SHA256 of the body keyed with it in X-Aibo-Signature ("sha256=<hex>"), along with
+// the sending time in X-Aibo-Timestamp.
+type WebhookChannel struct {
+	Client *http.Client
+}
+
+// NewWebhookChannel creates a webhook channel with a 10 second timeout, which only reaches public
+// addresses and does not follow redirects.
+func NewWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{Client: newPublicClient(10 * time.Second)}
+}
+
+// webhookPayload is the body posted to the webhooks.
+type webhookPayload struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Subject   string          `json:"subject"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Name returns types.ChannelWebhook.
+func (c *WebhookChannel) Name() types.NotificationChannel {
+	return types.ChannelWebhook
+}
+
+// Send posts the message to the webhook URL of the Aibo.
+//
+// Any 2xx answer is a success. 4xx answers other than 408 and 429 are permanent failures.
+func (c *WebhookChannel) Send(ctx context.Context, msg Message) error {
+	if msg.Settings == nil || msg.Settings.WebhookURL == "" {
+		return Permanent(errors.New("the aibo has no webhook URL"))
+	}
+
+	n := msg.Notification
+	body, err := json.Marshal(webhookPayload{
+		ID:        n.ID.String(),
+		Kind:      n.Kind,
+		Subject:   n.Subject,
+		Body:      n.Body,
+		Data:      n.Data,
+		CreatedAt: n.CreatedAt,
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Settings.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Aibo-Webhook/1.0")
+	req.Header.Set("X-Aibo-Event", n.Kind)
+	req.Header.Set("X-Aibo-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	if msg.Settings.WebhookSecret != "" {
+		req.Header.Set("X-Aibo-Signature", "sha256="+signWebhook(msg.Settings.WebhookSecret, body))
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return statusError(resp.StatusCode)
+}
+
+// signWebhook returns the hex HMAC-SHA256 of the body keyed with the secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// statusError turns the HTTP status of a delivery into an error, permanent for the client errors
+// that retrying cannot fix.
+func statusError(status int) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	err := fmt.Errorf("unexpected status %d", status)
+	if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
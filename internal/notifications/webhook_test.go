@@ -0,0 +1,86 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookChannelSend(t *testing.T) {
+	tests := []struct {
+		name          string
+		secret        string
+		status        int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{"signed", "s3cret", http.StatusNoContent, false, false},
+		{"unsigned", "", http.StatusOK, false, false},
+		{"rejected", "s3cret", http.StatusBadRequest, true, true},
+		{"rate limited", "s3cret", http.StatusTooManyRequests, true, false},
+		{"server error", "s3cret", http.StatusBadGateway, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			channel := &WebhookChannel{Client: server.Client()}
+			err := channel.Send(context.Background(), Message{
+				Notification: &types.Notification{ID: 7, Kind: "alert.budget_used", Subject: "Budget", Body: "80% used", Data: json.RawMessage(`{"cat_bud_id":"1"}`)},
+				Settings:     &types.NotificationSettings{Webhook: true, WebhookURL: server.URL, WebhookSecret: tt.secret},
+			})
+			if (err != nil) != tt.wantErr || IsPermanent(err) != tt.wantPermanent {
+				t.Fatalf("err = %v, want error %v, permanent %v", err, tt.wantErr, tt.wantPermanent)
+			}
+
+			if got := header.Get("X-Aibo-Event"); got != "alert.budget_used" {
+				t.Errorf("X-Aibo-Event = %q", got)
+			}
+			if header.Get("X-Aibo-Timestamp") == "" {
+				t.Error("X-Aibo-Timestamp is missing")
+			}
+			signature := header.Get("X-Aibo-Signature")
+			if tt.secret == "" {
+				if signature != "" {
+					t.Errorf("X-Aibo-Signature = %q without a secret", signature)
+				}
+			} else {
+				mac := hmac.New(sha256.New, []byte(tt.secret))
+				mac.Write(body)
+				if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+					t.Errorf("X-Aibo-Signature = %q, want %q", signature, want)
+				}
+			}
+
+			var payload webhookPayload
+			if err := json.Unmarshal(body, &payload); err != nil {
+				t.Fatalf("invalid body %s: %v", body, err)
+			}
+			if payload.ID != "7" || payload.Kind != "alert.budget_used" || payload.Subject != "Budget" || string(payload.Data) != `{"cat_bud_id":"1"}` {
+				t.Errorf("payload = %+v", payload)
+			}
+		})
+	}
+}
+
+func TestWebhookChannelWithoutURL(t *testing.T) {
+	channel := &WebhookChannel{Client: http.DefaultClient}
+	err := channel.Send(context.Background(), Message{Notification: &types.Notification{}, Settings: &types.NotificationSettings{}})
+	if !IsPermanent(err) {
+		t.Fatalf("err = %v, want a permanent error", err)
+	}
+}
@@ -0,0 +1,265 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrSubscriptionGone is returned by the Web Push channel when the push service no longer knows
+// the subscription; the browser unsubscribed and the subscription should be removed.
+var ErrSubscriptionGone = errors.New("the push subscription expired or was removed")
+
+// webPushRecordSize is the record size announced in the aes128gcm header. The payloads always fit
+// in a single record.
+const webPushRecordSize = 4096
+
+// VAPIDKeys identify the application server to the push services (RFC 8292).
+type VAPIDKeys struct {
+	// PublicKey is the uncompressed P-256 public key, base64url encoded. Browsers subscribe with it
+	// as applicationServerKey.
+	PublicKey string
+	// PrivateKey is the P-256 private scalar, base64url encoded.
+	PrivateKey string
+	// Subject is a contact for the push services, a mailto: or https: URL.
+	Subject string
+}
+
+// WebPushChannel pushes the notifications to the subscribed browsers with the Web Push protocol
+// (RFC 8030), the payload encrypted with aes128gcm (RFC 8291) and signed with VAPID (RFC 8292).
+type WebPushChannel struct {
+	Client  *http.Client
+	keys    VAPIDKeys
+	signer  *ecdsa.PrivateKey
+	keyData string
+}
+
+// NewWebPushChannel creates a Web Push channel signing its requests with the VAPID keys. Like the
+// webhooks, it only reaches public addresses and does not follow redirects.
+func NewWebPushChannel(keys VAPIDKeys) (*WebPushChannel, error) {
+	d, err := decodeBase64URL(keys.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public := private.PublicKey().Bytes()
+	if keys.PublicKey != "" {
+		given, err := decodeBase64URL(keys.PublicKey)
+		if err != nil || !bytes.Equal(given, public) {
+			return nil, errors.New("the VAPID public key does not match the private key")
+		}
+	}
+
+	signer := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	return &WebPushChannel{
+		Client:  newPublicClient(10 * time.Second),
+		keys:    keys,
+		signer:  signer,
+		keyData: base64.RawURLEncoding.EncodeToString(public),
+	}, nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with.
+func (c *WebPushChannel) PublicKey() string {
+	return c.keyData
+}
+
+// webPushPayload is the JSON pushed to the service worker of the browsers.
+type webPushPayload struct {
+	ID    string          `json:"id"`
+	Kind  string          `json:"kind"`
+	Title string          `json:"title"`
+	Body  string          `json:"body"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Name returns types.ChannelWebPush.
+func (c *WebPushChannel) Name() types.NotificationChannel {
+	return types.ChannelWebPush
+}
+
+// Send pushes the message to the subscribed browser.
+//
+// When the push service answers 404 or 410, the error wraps ErrSubscriptionGone and is permanent.
+func (c *WebPushChannel) Send(ctx context.Context, msg Message) error {
+	if msg.Subscription == nil {
+		return Permanent(errors.New("no push subscription"))
+	}
+	n := msg.Notification
+	payload, err := json.Marshal(webPushPayload{ID: n.ID.String(), Kind: n.Kind, Title: n.Subject, Body: n.Body, Data: n.Data})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	body, err := encryptWebPush(payload, msg.Subscription)
+	if err != nil {
+		return Permanent(err)
+	}
+	token, err := c.vapidToken(msg.Subscription.Endpoint, time.Now())
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", "vapid t="+token+", k="+c.keyData)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return Permanent(ErrSubscriptionGone)
+	}
+	return statusError(resp.StatusCode)
+}
+
+// vapidToken returns the ES256 JWT authorizing a push to the origin of the endpoint for 12 hours.
+func (c *WebPushChannel) vapidToken(endpoint string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid push endpoint %q", endpoint)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": c.keys.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.signer, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// encryptWebPush encrypts the payload for the subscription with the aes128gcm content coding of
+// RFC 8291, in a single record.
+func encryptWebPush(payload []byte, subscription *types.PushSubscription) ([]byte, error) {
+	clientKey, err := decodeBase64URL(subscription.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeBase64URL(subscription.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+	clientPublic, err := ecdh.P256().NewPublicKey(clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	serverPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := serverPrivate.PublicKey().Bytes()
+	shared, err := serverPrivate.ECDH(clientPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), clientKey...)
+	keyInfo = append(keyInfo, serverPublic...)
+	ikm := hkdfExpand(hkdfExtract(authSecret, shared), keyInfo, 32)
+	prk := hkdfExtract(salt, ikm)
+	cek := hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload)+1+gcm.Overhead() > webPushRecordSize {
+		return nil, errors.New("push payload too large")
+	}
+	// The 0x02 delimiter marks the last (and only) record.
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdfExtract is the extract step of HKDF-SHA256 (RFC 5869).
+func hkdfExtract(salt, ikm []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// hkdfExpand is the expand step of HKDF-SHA256 (RFC 5869), for at most 32 bytes of output.
+func hkdfExpand(prk, info []byte, length int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:length]
+}
+
+// decodeBase64URL decodes base64url, with or without padding, as browsers and key generators use
+// both.
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
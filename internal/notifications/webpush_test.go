@@ -0,0 +1,256 @@
+package notifications
+
+import (
+	"aibo/internal/types"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pushBrowser is the browser side of a push subscription.
+type pushBrowser struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+func newPushBrowser(t *testing.T) *pushBrowser {
+	t.Helper()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		t.Fatal(err)
+	}
+	return &pushBrowser{private: private, auth: auth}
+}
+
+func (b *pushBrowser) subscription(endpoint string) *types.PushSubscription {
+	return &types.PushSubscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(b.private.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(b.auth),
+	}
+}
+
+// decrypt decodes a single record aes128gcm body as the browser does (RFC 8291).
+func (b *pushBrowser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 {
+		t.Fatalf("body of %d bytes is too short", len(body))
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != webPushRecordSize {
+		t.Fatalf("record size = %d", rs)
+	}
+	idLen := int(body[20])
+	serverKey := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	serverPublic, err := ecdh.P256().NewPublicKey(serverKey)
+	if err != nil {
+		t.Fatalf("invalid server key: %v", err)
+	}
+	shared, err := b.private.ECDH(serverPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), b.private.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, serverKey...)
+	ikm := hkdfExpand(hkdfExtract(b.auth, shared), keyInfo, 32)
+	prk := hkdfExtract(salt, ikm)
+
+	block, err := aes.NewCipher(hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12), ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatal("the record does not end with the last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func newTestVAPIDKeys(t *testing.T) VAPIDKeys {
+	t.Helper()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return VAPIDKeys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(private.PublicKey().Bytes()),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(private.Bytes()),
+		Subject:    "mailto:ops@example.com",
+	}
+}
+
+// verifyVAPID checks the Authorization header of a push request against the VAPID public key and
+// returns the JWT claims.
+func verifyVAPID(t *testing.T, authorization, publicKey string) map[string]interface{} {
+	t.Helper()
+	params, ok := strings.CutPrefix(authorization, "vapid ")
+	if !ok {
+		t.Fatalf("Authorization = %q, want the vapid scheme", authorization)
+	}
+	var token, key string
+	for _, param := range strings.Split(params, ", ") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+	if key != publicKey {
+		t.Fatalf("k = %q, want %q", key, publicKey)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed JWT %q", token)
+	}
+	header, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if string(header) != `{"typ":"JWT","alg":"ES256"}` {
+		t.Fatalf("JWT header = %s", header)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		t.Fatalf("invalid JWT signature %q", parts[2])
+	}
+	public, _ := base64.RawURLEncoding.DecodeString(publicKey)
+	verifier := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(public[1:33]),
+		Y:     new(big.Int).SetBytes(public[33:]),
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(verifier, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Fatal("the JWT signature does not verify with the VAPID public key")
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("invalid JWT claims %s: %v", payload, err)
+	}
+	return claims
+}
+
+func TestWebPushChannelSend(t *testing.T) {
+	keys := newTestVAPIDKeys(t)
+	browser := newPushBrowser(t)
+
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	channel, err := NewWebPushChannel(keys)
+	if err != nil {
+		t.Fatalf("NewWebPushChannel: %v", err)
+	}
+	channel.Client = server.Client()
+
+	err = channel.Send(context.Background(), Message{
+		Notification: &types.Notification{ID: 9, Kind: "goal.reached", Subject: "Goal reached", Body: "Holidays are funded"},
+		Subscription: browser.subscription(server.URL + "/push/abc"),
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if header.Get("Content-Encoding") != "aes128gcm" || header.Get("TTL") == "" {
+		t.Errorf("headers = %v", header)
+	}
+	var payload webPushPayload
+	if err := json.Unmarshal(browser.decrypt(t, body), &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.ID != "9" || payload.Kind != "goal.reached" || payload.Title != "Goal reached" || payload.Body != "Holidays are funded" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	claims := verifyVAPID(t, header.Get("Authorization"), keys.PublicKey)
+	if claims["aud"] != server.URL || claims["sub"] != keys.Subject {
+		t.Errorf("claims = %v, want aud %s", claims, server.URL)
+	}
+	exp, _ := claims["exp"].(float64)
+	if remaining := time.Until(time.Unix(int64(exp), 0)); remaining <= 0 || remaining > 24*time.Hour {
+		t.Errorf("exp = %v, want within 24 hours", exp)
+	}
+}
+
+func TestWebPushChannelGoneSubscription(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		channel, err := NewWebPushChannel(newTestVAPIDKeys(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel.Client = server.Client()
+		err = channel.Send(context.Background(), Message{
+			Notification: &types.Notification{Kind: "test"},
+			Subscription: newPushBrowser(t).subscription(server.URL),
+		})
+		server.Close()
+		if !errors.Is(err, ErrSubscriptionGone) || !IsPermanent(err) {
+			t.Errorf("status %d: err = %v, want a permanent ErrSubscriptionGone", status, err)
+		}
+	}
+}
+
+func TestNewWebPushChannelRejectsMismatchedKeys(t *testing.T) {
+	keys := newTestVAPIDKeys(t)
+	keys.PublicKey = newTestVAPIDKeys(t).PublicKey
+	if _, err := NewWebPushChannel(keys); err == nil {
+		t.Fatal("mismatched VAPID keys were accepted")
+	}
+}
+
+func TestEncryptWebPushUsesFreshKeys(t *testing.T) {
+	subscription := newPushBrowser(t).subscription("https://push.example.com/abc")
+	first, err := encryptWebPush([]byte("hello"), subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encryptWebPush([]byte("hello"), subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first[:16], second[:16]) || bytes.Equal(first[21:86], second[21:86]) {
+		t.Fatal("the salt or the server key was reused")
+	}
+}
@@ -23,6 +23,22 @@ func SetupRoutes(router *gin.Engine, db database.Service) {
 
 	authHandler := handlers.NewAuthService(db.GetDB())
 	cbRepo := handlers.NewCatBudService(db.GetDB())
+	txService := handlers.NewTransactionService(db.GetDB())
+	recurringService := handlers.NewRecurringService(db.GetDB())
+	savingsService := handlers.NewSavingsService(db.GetDB())
+	rateService := handlers.NewExchangeRateService(db.GetDB())
+	templateService := handlers.NewTemplateService(db.GetDB())
+	householdService := handlers.NewHouseholdService(db.GetDB())
+	approvalService := handlers.NewApprovalService(db.GetDB())
+	alertService := handlers.NewAlertService(db.GetDB())
+	notificationService := handlers.NewNotificationService(db.GetDB())
+	analyticsService := handlers.NewAnalyticsService(db.GetDB())
+	anomalyService := handlers.NewAnomalyService(db.GetDB())
+	importService := handlers.NewImportService(db.GetDB())
+	exportService := handlers.NewExportService(db.GetDB())
+	categoryRuleService := handlers.NewCategoryRuleService(db.GetDB())
+	attachmentService := handlers.NewAttachmentService(db.GetDB())
+	debtService := handlers.NewDebtService(db.GetDB())
 
 	// setupRoutes sets up the routes for the server.
 	//
@@ -36,12 +52,14 @@ func SetupRoutes(router *gin.Engine, db database.Service) {
 	// Public routes
 	router.POST("/register", authHandler.Register)
 	router.POST("/login", authHandler.Login)
+	router.GET("/files/*key", attachmentService.ServeFile)
 
 	// Protected routes
 	protected := router.Group("/")
 	protected.Use(middlewares.AuthMiddleware())
 	{
 		protected.GET("/profile", authHandler.GetProfile)
+		protected.GET("/profile/daily-history", authHandler.GetDailyHistory)
 		protected.PUT("/update-profile", authHandler.UpdateProfile)
 		protected.PUT("/update-password", authHandler.UpdatePassword)
 		protected.POST("/logout", authHandler.Logout)
@@ -49,9 +67,190 @@ func SetupRoutes(router *gin.Engine, db database.Service) {
 		catbuds := protected.Group("/catbud")
 		{
 			catbuds.GET("/:aiboId", cbRepo.GetCatBuds)
+			catbuds.GET("/balances/:id", cbRepo.GetCatBudBalances)
 			catbuds.POST("/", cbRepo.CreateCatBuds)
+			catbuds.PUT("/", cbRepo.UpdateCatBud)
+			catbuds.DELETE("/", cbRepo.DeleteCatBud)
 
 		}
+
+		transactions := protected.Group("/transactions")
+		{
+			transactions.GET("", txService.GetTransactions)
+			transactions.POST("", txService.CreateTransaction)
+			transactions.GET("/:id", txService.GetTransaction)
+			transactions.PUT("/:id", txService.UpdateTransaction)
+			transactions.DELETE("/:id", txService.DeleteTransaction)
+		}
+
+		recurring := protected.Group("/recurring")
+		{
+			recurring.GET("", recurringService.GetRecurringRules)
+			recurring.POST("", recurringService.CreateRecurringRule)
+			recurring.GET("/upcoming", recurringService.GetUpcoming)
+			recurring.GET("/:id", recurringService.GetRecurringRule)
+			recurring.PUT("/:id", recurringService.UpdateRecurringRule)
+			recurring.DELETE("/:id", recurringService.DeleteRecurringRule)
+			recurring.PUT("/:id/occurrences/:date", recurringService.UpdateOccurrence)
+		}
+
+		goals := protected.Group("/goals")
+		{
+			goals.GET("", savingsService.GetSavingsGoals)
+			goals.POST("", savingsService.CreateSavingsGoal)
+			goals.GET("/:id", savingsService.GetSavingsGoal)
+			goals.PUT("/:id", savingsService.UpdateSavingsGoal)
+			goals.DELETE("/:id", savingsService.DeleteSavingsGoal)
+			goals.GET("/:id/contributions", savingsService.GetContributions)
+			goals.POST("/:id/contributions", savingsService.CreateContribution)
+			goals.DELETE("/:id/contributions/:contributionId", savingsService.DeleteContribution)
+		}
+
+		rates := protected.Group("/exchange-rates")
+		{
+			rates.GET("", rateService.GetExchangeRates)
+			rates.GET("/convert", rateService.ConvertAmount)
+			rates.POST("/import", middlewares.AdminMiddleware(authHandler.AiboRepository), rateService.ImportExchangeRates)
+		}
+
+		households := protected.Group("/households")
+		{
+			households.GET("", householdService.GetHouseholds)
+			households.POST("", householdService.CreateHousehold)
+			households.GET("/:id", householdService.GetHousehold)
+			households.PUT("/:id", householdService.UpdateHousehold)
+			households.DELETE("/:id", householdService.DeleteHousehold)
+			households.GET("/:id/catbuds", householdService.GetHouseholdCatBuds)
+			households.PUT("/:id/members/:aiboId", householdService.UpdateMember)
+			households.DELETE("/:id/members/:aiboId", householdService.RemoveMember)
+			households.GET("/:id/invitations", householdService.GetHouseholdInvitations)
+			households.POST("/:id/invitations", householdService.CreateInvitation)
+			households.DELETE("/:id/invitations/:invitationId", householdService.RevokeInvitation)
+			households.GET("/:id/approval-rules", approvalService.GetApprovalRules)
+			households.POST("/:id/approval-rules", approvalService.CreateApprovalRule)
+			households.PUT("/:id/approval-rules/:ruleId", approvalService.UpdateApprovalRule)
+			households.DELETE("/:id/approval-rules/:ruleId", approvalService.DeleteApprovalRule)
+			households.GET("/:id/approvals", approvalService.GetHouseholdApprovals)
+		}
+
+		invitations := protected.Group("/invitations")
+		{
+			invitations.GET("", householdService.GetInvitations)
+			invitations.POST("/:id/accept", householdService.AcceptInvitation)
+			invitations.POST("/:id/decline", householdService.DeclineInvitation)
+		}
+
+		approvals := protected.Group("/approvals")
+		{
+			approvals.GET("", approvalService.GetApprovals)
+			approvals.POST("/:id/approve", approvalService.ApproveRequest)
+			approvals.POST("/:id/reject", approvalService.RejectRequest)
+		}
+
+		alertRules := protected.Group("/alert-rules")
+		{
+			alertRules.GET("", alertService.GetAlertRules)
+			alertRules.POST("", alertService.CreateAlertRule)
+			alertRules.PUT("/:id", alertService.UpdateAlertRule)
+			alertRules.DELETE("/:id", alertService.DeleteAlertRule)
+		}
+
+		alerts := protected.Group("/alerts")
+		{
+			alerts.GET("", alertService.GetAlerts)
+			alerts.POST("/read", alertService.ReadAllAlerts)
+			alerts.POST("/:id/read", alertService.ReadAlert)
+		}
+
+		notifications := protected.Group("/notifications")
+		{
+			notifications.GET("", notificationService.GetNotifications)
+			notifications.POST("/read", notificationService.ReadAllNotifications)
+			notifications.POST("/:id/read", notificationService.ReadNotification)
+			notifications.GET("/settings", notificationService.GetNotificationSettings)
+			notifications.PUT("/settings", notificationService.UpdateNotificationSettings)
+			notifications.POST("/push-subscriptions", notificationService.CreatePushSubscription)
+			notifications.DELETE("/push-subscriptions/:id", notificationService.DeletePushSubscription)
+			notifications.POST("/test", notificationService.SendTestNotification)
+		}
+
+		analytics := protected.Group("/analytics")
+		{
+			analytics.GET("/spending", analyticsService.GetSpendingReport)
+			analytics.GET("/budget-vs-actual", analyticsService.GetBudgetReport)
+			analytics.GET("/forecast", analyticsService.GetForecast)
+		}
+
+		anomalies := protected.Group("/anomalies")
+		{
+			anomalies.GET("", anomalyService.GetAnomalies)
+			anomalies.POST("/:id/confirm", anomalyService.ConfirmAnomaly)
+			anomalies.POST("/:id/dismiss", anomalyService.DismissAnomaly)
+			anomalies.GET("/settings", anomalyService.GetAnomalySettings)
+			anomalies.PUT("/settings", anomalyService.UpdateAnomalySettings)
+			anomalies.POST("/scan", anomalyService.ScanAnomalies)
+		}
+
+		imports := protected.Group("/imports")
+		{
+			imports.GET("", importService.GetImportBatches)
+			imports.POST("/csv", importService.ImportCSV)
+			imports.POST("/ofx", importService.ImportOFX)
+			imports.POST("/qif", importService.ImportQIF)
+			imports.POST("/ynab", importService.ImportYNAB)
+			imports.POST("/mint", importService.ImportMint)
+			imports.POST("/actual", importService.ImportActual)
+			imports.POST("/:id/rollback", importService.RollbackImport)
+			imports.GET("/mappings", importService.GetImportMappings)
+			imports.POST("/mappings", importService.CreateImportMapping)
+			imports.PUT("/mappings/:id", importService.UpdateImportMapping)
+			imports.DELETE("/mappings/:id", importService.DeleteImportMapping)
+			imports.GET("/accounts", importService.GetImportAccounts)
+			imports.PUT("/accounts/:id", importService.UpdateImportAccount)
+			imports.DELETE("/accounts/:id", importService.DeleteImportAccount)
+		}
+
+		categoryRules := protected.Group("/category-rules")
+		{
+			categoryRules.GET("", categoryRuleService.GetCategoryRules)
+			categoryRules.POST("", categoryRuleService.CreateCategoryRule)
+			categoryRules.GET("/suggestions", categoryRuleService.GetCategoryRuleSuggestions)
+			categoryRules.POST("/apply", categoryRuleService.ApplyCategoryRules)
+			categoryRules.PUT("/:id", categoryRuleService.UpdateCategoryRule)
+			categoryRules.DELETE("/:id", categoryRuleService.DeleteCategoryRule)
+		}
+
+		exports := protected.Group("/exports")
+		{
+			exports.GET("/transactions", exportService.ExportTransactions)
+			exports.GET("/catbuds", exportService.ExportCatBuds)
+		}
+
+		debts := protected.Group("/debts")
+		{
+			debts.GET("", debtService.GetDebts)
+			debts.POST("", debtService.CreateDebt)
+			debts.GET("/plan", debtService.GetDebtPlan)
+			debts.GET("/:id", debtService.GetDebt)
+			debts.PUT("/:id", debtService.UpdateDebt)
+			debts.DELETE("/:id", debtService.DeleteDebt)
+			debts.GET("/:id/payments", debtService.GetDebtPayments)
+			debts.POST("/:id/payments", debtService.CreateDebtPayment)
+			debts.DELETE("/:id/payments/:paymentId", debtService.DeleteDebtPayment)
+		}
+
+		attachments := protected.Group("/attachments")
+		{
+			attachments.GET("", attachmentService.GetAttachments)
+			attachments.POST("", attachmentService.UploadAttachment)
+			attachments.GET("/:id", attachmentService.GetAttachment)
+			attachments.GET("/:id/url", attachmentService.GetAttachmentURL)
+			attachments.DELETE("/:id", attachmentService.DeleteAttachment)
+		}
+
+		protected.GET("/templates", templateService.GetTemplates)
+		protected.GET("/templates/:id", templateService.GetTemplate)
+		protected.POST("/onboarding/template", templateService.ApplyTemplate)
 	}
 
 	aiborepo := authHandler.AiboRepository
@@ -1,21 +1,30 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"aibo/internal/database"
+	"aibo/internal/jobs"
+	"aibo/internal/notifications"
+	"aibo/internal/storage"
+	"aibo/internal/types"
 )
 
 // Server represents the server instance.
 //
-// It contains the gin.Engine instance for handling HTTP requests
-// and the database.Service instance for interacting with the database.
+// It contains the gin.Engine instance for handling HTTP requests,
+// the database.Service instance for interacting with the database
+// and the jobs.Scheduler instance running the background jobs.
 type Server struct {
 	Router *gin.Engine
 	DB     database.Service
+	Jobs   *jobs.Scheduler
 }
 
 // NewServer creates a new Server instance.
@@ -37,9 +46,11 @@ func NewServer() (*Server, error) {
 	server := &Server{
 		Router: gin.Default(),
 		DB:     dbservice,
+		Jobs:   jobs.NewScheduler(),
 	}
 
 	server.setupRoutes()
+	server.setupJobs()
 
 	return server, nil
 }
@@ -56,11 +67,97 @@ func (s *Server) setupRoutes() {
 	SetupRoutes(s.Router, s.DB)
 }
 
+// setupJobs registers the background jobs of the server.
+//
+// The interval of each job can be overridden with an environment variable:
+//
+// * DAILY_ROLLOVER_INTERVAL: How often the daily budgets are checked for local midnight (default 1m).
+// * RECURRING_INTERVAL: How often the recurring rules are checked for due occurrences (default 15m).
+// * SAVINGS_INTERVAL: How often the savings goals are checked for due automatic contributions (default 15m).
+// * EXCHANGE_RATE_REFRESH_INTERVAL: How often the transactions are converted again after an import of exchange rates (default 1m).
+// * ALERT_DELIVERY_INTERVAL: How often the budget alerts are handed to the notifier (default 30s).
+// * ANOMALY_DELIVERY_INTERVAL: How often the unusual expenses are handed to the notifier (default 1m).
+// * NOTIFICATION_DELIVERY_INTERVAL: How often the queued notifications are sent (default 15s).
+// * INVITATION_EMAIL_INTERVAL: How often the Household invitations are emailed to the invitees (default 30s).
+// * ATTACHMENT_CLEANUP_INTERVAL: How often the files of deleted transactions and CatBuds are removed from the storage (default 1h).
+//
+// The notification channels are configured as described by notifications.ChannelsFromEnv, and the
+// storage of the attachments as described by storage.FromEnv.
+func (s *Server) setupJobs() {
+	db := s.DB.GetDB()
+
+	s.Jobs.Every(jobs.IntervalFromEnv("DAILY_ROLLOVER_INTERVAL", time.Minute),
+		jobs.NewDailyRolloverJob(database.NewDailyBudgetRepository(db)))
+	s.Jobs.Every(jobs.IntervalFromEnv("RECURRING_INTERVAL", 15*time.Minute),
+		jobs.NewRecurringJob(database.NewRecurringRepository(db)))
+	s.Jobs.Every(jobs.IntervalFromEnv("SAVINGS_INTERVAL", 15*time.Minute),
+		jobs.NewSavingsJob(database.NewSavingsRepository(db)))
+	s.Jobs.Every(jobs.IntervalFromEnv("EXCHANGE_RATE_REFRESH_INTERVAL", time.Minute),
+		jobs.NewExchangeRateRefreshJob(database.NewExchangeRateRepository(db)))
+	notifier := notifications.NewService(db, notifications.ChannelsFromEnv()...)
+
+	s.Jobs.Every(jobs.IntervalFromEnv("ALERT_DELIVERY_INTERVAL", 30*time.Second),
+		jobs.NewAlertDeliveryJob(database.NewAlertRepository(db), notifier))
+	s.Jobs.Every(jobs.IntervalFromEnv("ANOMALY_DELIVERY_INTERVAL", time.Minute),
+		jobs.NewAnomalyDeliveryJob(database.NewAnomalyRepository(db), notifier))
+	s.Jobs.Every(jobs.IntervalFromEnv("NOTIFICATION_DELIVERY_INTERVAL", 15*time.Second),
+		jobs.NewNotificationDeliveryJob(notifier))
+	if notifier.Configured(types.ChannelEmail) {
+		s.Jobs.Every(jobs.IntervalFromEnv("INVITATION_EMAIL_INTERVAL", 30*time.Second),
+			jobs.NewInvitationEmailJob(database.NewHouseholdRepository(db), notifier))
+	} else {
+		slog.Warn("Invitation emails disabled: the email channel is not configured")
+	}
+
+	store, err := storage.FromEnv()
+	if err != nil {
+		slog.Error("Attachment cleanup disabled", "error", err)
+		return
+	}
+	s.Jobs.Every(jobs.IntervalFromEnv("ATTACHMENT_CLEANUP_INTERVAL", time.Hour),
+		jobs.NewAttachmentCleanupJob(database.NewAttachmentRepository(db), store))
+}
+
+// StartJobs starts the background jobs. They stop when the context is cancelled, which Run waits
+// for.
+func (s *Server) StartJobs(ctx context.Context) {
+	s.Jobs.Start(ctx)
+}
+
+// shutdownTimeout is how long a graceful shutdown waits for the requests in flight.
+const shutdownTimeout = 30 * time.Second
+
 // Run starts the server and listens on the given address.
 //
-// It blocks until the server is stopped.
+// It blocks until the server is stopped. When the context is cancelled, the server shuts down
+// gracefully: it stops accepting connections, waits up to shutdownTimeout for the requests in
+// flight, then waits for the background jobs started with the same context to return and closes
+// the database connection.
 //
-// If there is an error starting the server, it returns a non-nil error.
-func (s *Server) Run(addr string) error {
-	return s.Router.Run(addr)
+// If there is an error starting or stopping the server, it returns a non-nil error.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	httpServer := &http.Server{Addr: addr, Handler: s.Router}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := httpServer.Shutdown(shutdownCtx)
+
+	s.Jobs.Wait()
+	slog.Info("Background jobs stopped")
+	if closeErr := s.DB.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
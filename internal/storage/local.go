@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LocalURLPrefix is the path of the application serving the signed URLs of the local backend,
+// followed by the key of the object.
+const LocalURLPrefix = "/files/"
+
+var (
+	// ErrInvalidSignature is returned for a signed URL that was not made by the backend, or was
+	// changed since.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrExpired is returned for a signed URL past its expiry.
+	ErrExpired = errors.New("the link has expired")
+)
+
+// Local stores the objects as files under a directory, one file per key. Its signed URLs are
+// served by the application, which checks them with Verify.
+type Local struct {
+	root   string
+	secret []byte
+}
+
+// NewLocal creates a local backend storing under the directory, created if missing, and signing
+// its URLs with the secret.
+func NewLocal(root string, secret []byte) (*Local, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("the local storage needs a secret to sign its URLs")
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &Local{root: root, secret: secret}, nil
+}
+
+// Put writes the object to a temporary file renamed over its file, so that a reader never sees
+// it half written.
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Get opens the file of the object.
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete removes the file of the object.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL returns the path of the application serving the object, signed with an HMAC of the
+// key, the expiry and the way it is served.
+func (l *Local) SignedURL(ctx context.Context, key string, download Download, expires time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", errInvalidKey(key)
+	}
+	expiry := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiry)
+	query.Set("name", download.FileName)
+	query.Set("type", download.ContentType)
+	if download.Inline {
+		query.Set("inline", "1")
+	}
+	query.Set("signature", l.sign(key, expiry, download))
+	return LocalURLPrefix + key + "?" + query.Encode(), nil
+}
+
+// Verify checks the query of a signed URL of the object, and returns how to serve it.
+//
+// It returns ErrInvalidSignature when the URL was not signed by the backend, and ErrExpired
+// when it is past its expiry.
+func (l *Local) Verify(key string, query url.Values, now time.Time) (Download, error) {
+	download := Download{
+		FileName:    query.Get("name"),
+		ContentType: query.Get("type"),
+		Inline:      query.Get("inline") == "1",
+	}
+	expiry := query.Get("expires")
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !validKey(key) {
+		return download, ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(l.sign(key, expiry, download))
+	if !hmac.Equal(signature, expected) {
+		return download, ErrInvalidSignature
+	}
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return download, ErrInvalidSignature
+	}
+	if now.Unix() > seconds {
+		return download, ErrExpired
+	}
+	return download, nil
+}
+
+// sign computes the signature of a URL.
+func (l *Local) sign(key, expiry string, download Download) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%t", key, expiry, download.FileName, download.ContentType, download.Inline)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path returns the file of a key.
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", errInvalidKey(key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	t.Helper()
+	local, err := NewLocal(t.TempDir(), []byte("url secret"))
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	return local
+}
+
+func TestLocalPutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	local := newTestLocal(t)
+	key := "attachments/aibo/1.txt"
+
+	if err := local.Put(ctx, key, []byte("receipt"), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	file, err := local.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != "receipt" {
+		t.Fatalf("Get = %q", data)
+	}
+	entries, _ := os.ReadDir(filepath.Join(local.root, "attachments", "aibo"))
+	if len(entries) != 1 {
+		t.Fatalf("%d files left in the directory, want only the object", len(entries))
+	}
+
+	if err := local.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := local.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+	if _, err := local.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := local.Put(ctx, "../outside", []byte("x"), ""); err == nil {
+		t.Fatal("Put accepted a key leaving the directory")
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	local := newTestLocal(t)
+	key := "attachments/aibo/1.pdf"
+	download := Download{FileName: "reçu mars.pdf", ContentType: "application/pdf", Inline: true}
+	now := time.Now()
+
+	signed, err := local.SignedURL(context.Background(), key, download, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil || !strings.HasPrefix(u.Path, LocalURLPrefix) {
+		t.Fatalf("SignedURL = %q, want a path under %s", signed, LocalURLPrefix)
+	}
+	signedKey := strings.TrimPrefix(u.Path, LocalURLPrefix)
+
+	tampered := func(name, value string) url.Values {
+		query := u.Query()
+		query.Set(name, value)
+		return query
+	}
+	tests := []struct {
+		name    string
+		key     string
+		query   url.Values
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", signedKey, u.Query(), now, nil},
+		{"expired", signedKey, u.Query(), now.Add(16 * time.Minute), ErrExpired},
+		{"other key", "attachments/aibo/2.pdf", u.Query(), now, ErrInvalidSignature},
+		{"extended expiry", signedKey, tampered("expires", "99999999999"), now, ErrInvalidSignature},
+		{"renamed", signedKey, tampered("name", "invoice.html"), now, ErrInvalidSignature},
+		{"other type", signedKey, tampered("type", "text/html"), now, ErrInvalidSignature},
+		{"downloaded", signedKey, tampered("inline", ""), now, ErrInvalidSignature},
+		{"forged signature", signedKey, tampered("signature", strings.Repeat("00", 32)), now, ErrInvalidSignature},
+		{"malformed signature", signedKey, tampered("signature", "zz"), now, ErrInvalidSignature},
+		{"unsigned", signedKey, url.Values{}, now, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := local.Verify(tt.key, tt.query, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != download {
+				t.Fatalf("Verify = %+v, want %+v", got, download)
+			}
+		})
+	}
+
+	other, err := NewLocal(t.TempDir(), []byte("another secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Verify(signedKey, u.Query(), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify with another secret = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestNewLocalRequiresSecret(t *testing.T) {
+	if _, err := NewLocal(t.TempDir(), nil); err == nil {
+		t.Fatal("NewLocal accepted an empty secret")
+	}
+}
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3Algorithm is the signature version of the requests, AWS Signature Version 4.
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	// s3UnsignedPayload is the hash of the payload of the presigned URLs.
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// s3MaxExpiry is the longest validity of a presigned URL.
+	s3MaxExpiry = 7 * 24 * time.Hour
+)
+
+// S3Config configures an S3 backend.
+type S3Config struct {
+	// URL of an S3-compatible server, such as MinIO; empty for Amazon S3 in the region
+	Endpoint string
+	// Region of the bucket, us-east-1 when empty
+	Region string
+	// Name of the bucket
+	Bucket string
+	// Credentials signing the requests
+	AccessKeyID     string
+	SecretAccessKey string
+	// Whether the bucket is addressed in the path, as most S3-compatible servers expect, rather
+	// than in the host name
+	PathStyle bool
+}
+
+// S3 stores the objects in a bucket of Amazon S3 or of an S3-compatible server, such as MinIO,
+// through its REST API signed with AWS Signature Version 4. Its signed URLs are presigned URLs of
+// the bucket.
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	// Client sends the requests. It defaults to a client with a 30 second timeout.
+	Client *http.Client
+	// Now returns the current instant. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewS3 creates an S3 backend from its configuration.
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("the S3 storage needs a bucket, an access key ID and a secret access key")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		Now:      time.Now,
+	}, nil
+}
+
+// Put uploads the object with a single PUT request.
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp)
+}
+
+// Get downloads the object. The body is streamed from the bucket.
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s3Error(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object. S3 answers a missing object with success.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL of the object, overriding the Content-Type and the
+// Content-Disposition of the response. The expiry is capped at the 7 days S3 allows.
+func (s *S3) SignedURL(ctx context.Context, key string, download Download, expires time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", errInvalidKey(key)
+	}
+	if expires > s3MaxExpiry {
+		expires = s3MaxExpiry
+	}
+	overrides := map[string]string{"response-content-disposition": ContentDisposition(download)}
+	if download.ContentType != "" {
+		overrides["response-content-type"] = download.ContentType
+	}
+	return s.presign(key, overrides, expires), nil
+}
+
+// presign returns a presigned GET URL of the object, with the parameters added to its query.
+func (s *S3) presign(key string, params map[string]string, expires time.Duration) string {
+	target := s.objectURL(key)
+	now := s.Now().UTC()
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     s3Algorithm,
+		"X-Amz-Credential":    s.config.AccessKeyID + "/" + s.scope(now),
+		"X-Amz-Date":          now.Format("20060102T150405Z"),
+		"X-Amz-Expires":       strconv.Itoa(int(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	for name, value := range params {
+		query[name] = value
+	}
+	canonicalQuery := canonicalQueryString(query)
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		canonicalQuery,
+		"host:" + target.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	signature := s.signature(now, canonical)
+	return target.String() + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// do sends a request signed in its Authorization header.
+func (s *S3) do(ctx context.Context, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	if !validKey(key) {
+		return nil, errInvalidKey(key)
+	}
+	target := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	now := s.Now().UTC()
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 target.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           req.Header.Get("X-Amz-Date"),
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		signed = append(signed, "content-type")
+		values["content-type"] = contentType
+	}
+	sort.Strings(signed)
+	var headers strings.Builder
+	for _, name := range signed {
+		headers.WriteString(name + ":" + strings.TrimSpace(values[name]) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{method, target.EscapedPath(), "", headers.String(), signedHeaders, payloadHash}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKeyID, s.scope(now), signedHeaders, s.signature(now, canonical)))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// objectURL returns the URL of an object, with the bucket in the path or in the host name.
+func (s *S3) objectURL(key string) *url.URL {
+	target := *s.endpoint
+	if s.config.PathStyle {
+		target.Path = s.endpoint.Path + "/" + s.config.Bucket + "/" + key
+	} else {
+		target.Host = s.config.Bucket + "." + s.endpoint.Host
+		target.Path = s.endpoint.Path + "/" + key
+	}
+	return &target
+}
+
+// scope returns the credential scope of the requests signed at the instant.
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request made at the instant.
+func (s *S3) signature(now time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{s3Algorithm, now.Format("20060102T150405Z"), s.scope(now), hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// hmacSHA256 computes the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQueryString encodes a query sorted by name, with the percent-encoding of the signature:
+// spaces as %20 rather than +.
+func canonicalQueryString(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = s3Escape(name) + "=" + s3Escape(query[name])
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything but the unreserved characters of RFC 3986.
+func s3Escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// s3Error turns an error response of the bucket into an error, ErrNotFound for a missing object.
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
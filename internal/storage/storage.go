@@ -0,0 +1,136 @@
+// Package storage keeps the files uploaded by the aibos, such as the receipts attached to their
+// transactions, behind a Storage interface with a local filesystem backend and an S3-compatible
+// backend.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("object not found")
+
+// Download describes how a signed URL serves an object.
+type Download struct {
+	// Name of the file saved by the browser
+	FileName string
+	// Content type of the response
+	ContentType string
+	// Whether the browser shows the file rather than saving it
+	Inline bool
+}
+
+// Storage stores objects under keys chosen by the application, such as
+// "attachments/<aibo>/<id>". The keys are made of letters, digits, dashes, dots and slashes.
+type Storage interface {
+	// Put stores an object, replacing the one stored under the key, if any.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens an object. It returns ErrNotFound when there is none under the key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object. Removing a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL serving the object without authentication until it expires. The
+	// URL of the local backend is a path of the application, starting with a slash.
+	SignedURL(ctx context.Context, key string, download Download, expires time.Duration) (string, error)
+}
+
+// FromEnv builds the storage configured in the environment:
+//
+// * STORAGE_BACKEND: "local" (default) or "s3".
+// * STORAGE_LOCAL_DIR: The directory of the local backend (default data/uploads).
+// * STORAGE_URL_SECRET: The key signing the URLs of the local backend, required by it. It must
+// differ from JWT_SECRET_KEY, so that a leaked URL key cannot sign tokens and the other way round.
+// * S3_ENDPOINT: The URL of an S3-compatible server, such as http://localhost:9000 for MinIO
+// (default: Amazon S3 in S3_REGION).
+// * S3_REGION (default us-east-1), S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY: The bucket of
+// the S3 backend and the credentials to reach it.
+// * S3_PATH_STYLE: "true" to address the bucket in the path rather than in the host name (default:
+// true with S3_ENDPOINT, false without).
+func FromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/uploads"
+		}
+		secret := os.Getenv("STORAGE_URL_SECRET")
+		if secret == "" {
+			return nil, errors.New("STORAGE_URL_SECRET is required by the local storage")
+		}
+		if secret == os.Getenv("JWT_SECRET_KEY") {
+			return nil, errors.New("STORAGE_URL_SECRET must differ from JWT_SECRET_KEY")
+		}
+		return NewLocal(dir, []byte(secret))
+	case "s3":
+		config := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_ENDPOINT") != "",
+		}
+		if value := os.Getenv("S3_PATH_STYLE"); value != "" {
+			pathStyle, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid S3_PATH_STYLE %q", value)
+			}
+			config.PathStyle = pathStyle
+		}
+		return NewS3(config)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+// ContentDisposition returns the Content-Disposition header serving a download, with a file name
+// encoded for the browsers when it is not plain ASCII.
+func ContentDisposition(download Download) string {
+	disposition := "attachment"
+	if download.Inline {
+		disposition = "inline"
+	}
+	if download.FileName == "" {
+		return disposition
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": download.FileName}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// validKey reports whether the key is made of the allowed characters, without empty or dot-only
+// parts, so that it can neither leave the directory of the local backend nor need encoding.
+func validKey(key string) bool {
+	if key == "" || len(key) > 1024 {
+		return false
+	}
+	start := 0
+	for i := 0; i <= len(key); i++ {
+		if i < len(key) && key[i] != '/' {
+			c := key[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+				return false
+			}
+			continue
+		}
+		part := key[start:i]
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+		start = i + 1
+	}
+	return true
+}
+
+// errInvalidKey is returned for a key validKey rejects.
+func errInvalidKey(key string) error {
+	return fmt.Errorf("invalid storage key %q", key)
+}
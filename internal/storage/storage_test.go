@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"attachments/0b8e/1234567890.pdf", true},
+		{"thumbnails/a_b-c.jpg", true},
+		{"file..name.txt", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{"attachments/../../etc/passwd", false},
+		{"attachments/./file", false},
+		{"attachments/..", false},
+		{"/attachments/file", false},
+		{"attachments/file/", false},
+		{"attachments//file", false},
+		{`attachments\..\file`, false},
+		{"attachments/file name", false},
+		{"attachments/file?x=1", false},
+		{"attachments/fichier-é.pdf", false},
+	}
+	for _, tt := range tests {
+		if got := validKey(tt.key); got != tt.want {
+			t.Errorf("validKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		download Download
+		want     string
+	}{
+		{Download{}, "attachment"},
+		{Download{Inline: true}, "inline"},
+		{Download{FileName: "receipt.pdf"}, "attachment; filename=receipt.pdf"},
+		{Download{FileName: "my receipt.pdf", Inline: true}, `inline; filename="my receipt.pdf"`},
+		{Download{FileName: "reçu.pdf"}, "attachment; filename*=utf-8''re%C3%A7u.pdf"},
+	}
+	for _, tt := range tests {
+		if got := ContentDisposition(tt.download); got != tt.want {
+			t.Errorf("ContentDisposition(%+v) = %q, want %q", tt.download, got, tt.want)
+		}
+	}
+}
+
+func TestFromEnvLocalSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		jwt     string
+		wantErr string
+	}{
+		{"separate secret", "url secret", "jwt secret", ""},
+		{"missing secret", "", "jwt secret", "STORAGE_URL_SECRET is required"},
+		{"jwt secret", "jwt secret", "jwt secret", "must differ from JWT_SECRET_KEY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STORAGE_BACKEND", "local")
+			t.Setenv("STORAGE_LOCAL_DIR", t.TempDir())
+			t.Setenv("STORAGE_URL_SECRET", tt.secret)
+			t.Setenv("JWT_SECRET_KEY", tt.jwt)
+			store, err := FromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromEnv: %v", err)
+			}
+			if _, ok := store.(*Local); !ok {
+				t.Fatalf("FromEnv = %T, want *Local", store)
+			}
+		})
+	}
+}
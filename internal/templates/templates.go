@@ -0,0 +1,109 @@
+// Package templates provides the library of budget templates new Aibos can start from.
+//
+// Each template version lives in its own data file, data/<id>.v<version>.json, embedded in the
+// binary. A template is changed by adding a file with the next version, so the budgets an Aibo
+// started from can always be traced back to the exact file.
+package templates
+
+import (
+	"aibo/internal/types"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+//go:embed data/*.json
+var dataFiles embed.FS
+
+// ErrTemplateNotFound is returned when no template matches the requested id and version.
+var ErrTemplateNotFound = errors.New("budget template not found")
+
+var (
+	loadOnce sync.Once
+	library  map[string][]types.BudgetTemplate
+	loadErr  error
+)
+
+// load parses every data file once. Versions of a template are sorted in ascending order.
+func load() (map[string][]types.BudgetTemplate, error) {
+	loadOnce.Do(func() {
+		library, loadErr = parse(dataFiles)
+	})
+	return library, loadErr
+}
+
+func parse(files fs.FS) (map[string][]types.BudgetTemplate, error) {
+	paths, err := fs.Glob(files, "data/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := map[string][]types.BudgetTemplate{}
+	for _, path := range paths {
+		data, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+
+		var template types.BudgetTemplate
+		if err := json.Unmarshal(data, &template); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := template.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if expected := fmt.Sprintf("data/%s.v%d.json", template.ID, template.Version); path != expected {
+			return nil, fmt.Errorf("%s: the file of version %d of %q must be named %s", path, template.Version, template.ID, expected)
+		}
+
+		parsed[template.ID] = append(parsed[template.ID], template)
+	}
+
+	for _, versions := range parsed {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	return parsed, nil
+}
+
+// List returns the latest version of every template, sorted by id.
+func List() ([]types.BudgetTemplate, error) {
+	all, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make([]types.BudgetTemplate, 0, len(all))
+	for _, versions := range all {
+		latest = append(latest, versions[len(versions)-1])
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].ID < latest[j].ID })
+	return latest, nil
+}
+
+// Get returns a version of a template, or its latest version when version is 0.
+//
+// If there is no such template or version, ErrTemplateNotFound is returned.
+func Get(id string, version int) (types.BudgetTemplate, error) {
+	all, err := load()
+	if err != nil {
+		return types.BudgetTemplate{}, err
+	}
+
+	versions := all[id]
+	if len(versions) == 0 {
+		return types.BudgetTemplate{}, ErrTemplateNotFound
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, template := range versions {
+		if template.Version == version {
+			return template, nil
+		}
+	}
+	return types.BudgetTemplate{}, ErrTemplateNotFound
+}
@@ -0,0 +1,76 @@
+package templates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLibrary(t *testing.T) {
+	templates, err := List()
+	if err != nil {
+		t.Fatalf("the embedded templates do not load: %v", err)
+	}
+	ids := make([]string, len(templates))
+	for i, template := range templates {
+		ids[i] = template.ID
+	}
+	if got := strings.Join(ids, ","); got != "family,freelancer,student" {
+		t.Fatalf("templates = %s", got)
+	}
+
+	tests := []struct {
+		id      string
+		version int
+		wantErr error
+	}{
+		{"student", 0, nil},
+		{"student", 1, nil},
+		{"student", 2, ErrTemplateNotFound},
+		{"retired", 0, ErrTemplateNotFound},
+	}
+	for _, tt := range tests {
+		template, err := Get(tt.id, tt.version)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Get(%q, %d) = %v, want %v", tt.id, tt.version, err, tt.wantErr)
+		}
+		if err == nil && template.ID != tt.id {
+			t.Errorf("Get(%q, %d) returned %q", tt.id, tt.version, template.ID)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	const template = `{"id":"test","version":%s,"name":"Test","reference_income":"1000.00","categories":[{"category":"Food","budget":"100.00"}]}`
+	file := func(version string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(strings.Replace(template, "%s", version, 1))}
+	}
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{"versions", fstest.MapFS{"data/test.v2.json": file("2"), "data/test.v1.json": file("1")}, ""},
+		{"misnamed", fstest.MapFS{"data/test.json": file("1")}, "must be named data/test.v1.json"},
+		{"invalid", fstest.MapFS{"data/test.v0.json": file("0")}, "version must be at least 1"},
+		{"malformed", fstest.MapFS{"data/test.v1.json": {Data: []byte("{")}}, "data/test.v1.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parse(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if versions := parsed["test"]; len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+				t.Fatalf("versions = %+v, want 1 then 2", versions)
+			}
+		})
+	}
+}
@@ -27,10 +27,24 @@ type Aibo struct {
 	BirthDate time.Time `gorm:"type:date;" json:"birth_date"`
 	// Whether the Aibo has a premium account
 	IsPremium bool `gorm:"default:false" json:"is_premium"`
-	// Daily budget set by the Aibo
-	DailyBudget float64 `gorm:"default:0" json:"daily_budget"`
-	// Current delta (difference) from the daily budget
-	CurrentDelta float64 `gorm:"default:0" json:"current_delta"`
+	// Whether the Aibo administers the instance, such as importing the exchange rates shared by
+	// every Aibo. It is only ever set in the database
+	IsAdmin bool `gorm:"not null;default:false" json:"is_admin"`
+	// ISO 4217 currency every budget and summary of the Aibo is expressed in
+	BaseCurrency Currency `gorm:"type:char(3);not null;default:'EUR'" json:"base_currency" swaggertype:"string" example:"EUR"`
+	// Daily budget set by the Aibo, in its base currency
+	DailyBudget Money `gorm:"type:decimal(10,2);not null;default:0" json:"daily_budget" swaggertype:"string"`
+	// Current delta (difference) from the daily budget, derived from the ledger
+	// and the delta carried over from the previous days
+	CurrentDelta Money `gorm:"type:decimal(10,2);not null;default:0" json:"current_delta" swaggertype:"string"`
+	// IANA timezone the daily budget follows
+	Timezone string `gorm:"type:varchar(64);not null;default:'UTC'" json:"timezone"`
+	// What happens to the surplus or deficit of a day at local midnight
+	RolloverPolicy RolloverPolicy `gorm:"type:varchar(32);not null;default:'carry_all'" json:"rollover_policy" enums:"carry_all,carry_surplus,carry_deficit,reset"`
+	// Surplus or deficit carried over from the closed days
+	CarriedDelta Money `gorm:"type:decimal(10,2);not null;default:0" json:"carried_delta" swaggertype:"string"`
+	// Local day currently open for the daily budget
+	BudgetDay *time.Time `gorm:"type:date;index" json:"budget_day"`
 	// List of category-budget pairs associated with this Aibo
 	CatBuds []CatBud `gorm:"foreignKey:AiboID" json:"cat_buds"`
 }
@@ -0,0 +1,168 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// MaxAlertPercent caps the share of a budget a budget_used rule can watch.
+const MaxAlertPercent = 1000
+
+// AlertKind is what an AlertRule watches.
+type AlertKind string
+
+const (
+	// AlertBudgetUsed fires when the spent amount of a CatBud reaches a percentage of its envelope
+	// for the period, that is its budget plus the amount carried over.
+	AlertBudgetUsed AlertKind = "budget_used"
+	// AlertDailyBudgetExceeded fires when the spending of the open budget day goes over the daily
+	// budget.
+	AlertDailyBudgetExceeded AlertKind = "daily_budget_exceeded"
+	// AlertDeltaBelow fires when the CurrentDelta of the Aibo falls below a floor.
+	AlertDeltaBelow AlertKind = "delta_below"
+)
+
+// IsValid reports whether the kind is one of the known alert kinds.
+func (k AlertKind) IsValid() bool {
+	return k == AlertBudgetUsed || k == AlertDailyBudgetExceeded || k == AlertDeltaBelow
+}
+
+// AlertRule tells when an Aibo wants to be warned about its spending
+// @Description Budget alert rule model
+type AlertRule struct {
+	// Unique identifier for the AlertRule
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo warned by the rule
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// What the rule watches (budget_used, daily_budget_exceeded or delta_below)
+	Kind AlertKind `gorm:"type:varchar(32);not null" json:"kind" enums:"budget_used,daily_budget_exceeded,delta_below"`
+	// ID of the CatBud watched by a budget_used rule
+	CatBudID *snowflake.ID `gorm:"type:bigint;index;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Percentage of the envelope of the CatBud that fires a budget_used rule
+	Percent int `gorm:"not null;default:0" json:"percent"`
+	// CurrentDelta under which a delta_below rule fires
+	Floor *Money `gorm:"type:decimal(10,2);default:null" json:"floor" swaggertype:"string"`
+	// Whether the rule is temporarily silenced
+	Muted bool `gorm:"not null;default:false" json:"muted"`
+	// Timestamp of when the rule was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the rule was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate checks that the rule has the settings its kind needs.
+func (r *AlertRule) Validate() error {
+	switch r.Kind {
+	case AlertBudgetUsed:
+		if r.CatBudID == nil {
+			return errors.New("a budget_used rule needs a cat_bud_id")
+		}
+		if r.Percent < 1 || r.Percent > MaxAlertPercent {
+			return fmt.Errorf("percent must be between 1 and %d", MaxAlertPercent)
+		}
+	case AlertDailyBudgetExceeded:
+		if r.CatBudID != nil {
+			return errors.New("a daily_budget_exceeded rule applies to the daily budget, not to a cat bud")
+		}
+	case AlertDeltaBelow:
+		if r.CatBudID != nil {
+			return errors.New("a delta_below rule applies to the daily budget, not to a cat bud")
+		}
+		if r.Floor == nil {
+			return errors.New("a delta_below rule needs a floor")
+		}
+	default:
+		return fmt.Errorf("unknown alert kind %q", r.Kind)
+	}
+	return nil
+}
+
+// CatBudAlert returns the Alert a budget_used rule raises on the freshly recalculated amounts of
+// its CatBud, or nil when the spent amount is under the percentage of the envelope, or the CatBud
+// has no budget or spent nothing.
+func (r *AlertRule) CatBudAlert(cb *CatBud) *Alert {
+	if cb.Budget == nil || cb.PeriodStart == nil || cb.Spent <= 0 {
+		return nil
+	}
+	envelope := *cb.Budget + cb.CarriedOver
+	threshold := envelope.MulRatio(int64(r.Percent), 100)
+	if cb.Spent < threshold {
+		return nil
+	}
+	return &Alert{
+		AiboID:      r.AiboID,
+		RuleID:      r.ID,
+		PeriodStart: *cb.PeriodStart,
+		Kind:        r.Kind,
+		CatBudID:    &cb.ID,
+		Message:     fmt.Sprintf("%s: %d%% of the budget used (%s spent of %s)", cb.Category, r.Percent, cb.Spent, envelope),
+		Amount:      cb.Spent,
+		Threshold:   threshold,
+	}
+}
+
+// DailyAlert returns the Alert a daily_budget_exceeded or delta_below rule raises on the freshly
+// recalculated CurrentDelta of its Aibo, for the open budget day, or nil when the rule is not
+// crossed or the Aibo has no open budget day.
+func (r *AlertRule) DailyAlert(aibo *Aibo) *Alert {
+	if aibo.BudgetDay == nil {
+		return nil
+	}
+	alert := Alert{AiboID: aibo.ID, RuleID: r.ID, PeriodStart: *aibo.BudgetDay, Kind: r.Kind}
+
+	switch r.Kind {
+	case AlertDailyBudgetExceeded:
+		// CurrentDelta is the carried delta plus the daily budget minus the spending of the day.
+		spent := aibo.CarriedDelta + aibo.DailyBudget - aibo.CurrentDelta
+		if aibo.DailyBudget <= 0 || spent <= aibo.DailyBudget {
+			return nil
+		}
+		alert.Amount, alert.Threshold = spent, aibo.DailyBudget
+		alert.Message = fmt.Sprintf("Daily budget exceeded: %s spent of %s %s", spent, aibo.DailyBudget, aibo.BaseCurrency)
+	case AlertDeltaBelow:
+		if r.Floor == nil || aibo.CurrentDelta >= *r.Floor {
+			return nil
+		}
+		alert.Amount, alert.Threshold = aibo.CurrentDelta, *r.Floor
+		alert.Message = fmt.Sprintf("Current delta is %s %s, below %s", aibo.CurrentDelta, aibo.BaseCurrency, *r.Floor)
+	default:
+		return nil
+	}
+	return &alert
+}
+
+// Alert is a warning raised by an AlertRule. A rule raises at most one Alert per period: the
+// period of its CatBud, or the budget day for the daily budget rules
+// @Description Budget alert model
+type Alert struct {
+	// Unique identifier for the Alert
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the warned Aibo
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// ID of the rule that raised the Alert
+	RuleID snowflake.ID `gorm:"type:bigint;not null;uniqueIndex:idx_alerts_rule_period,priority:1" json:"rule_id"`
+	// First day of the period the Alert was raised for
+	PeriodStart time.Time `gorm:"type:date;not null;uniqueIndex:idx_alerts_rule_period,priority:2" json:"period_start"`
+	// Kind of the rule that raised the Alert
+	Kind AlertKind `gorm:"type:varchar(32);not null" json:"kind" enums:"budget_used,daily_budget_exceeded,delta_below"`
+	// ID of the CatBud concerned, if any
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Human readable description of the Alert
+	Message string `gorm:"type:varchar(255);not null" json:"message"`
+	// Watched amount when the Alert was raised: spent amount or CurrentDelta
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// Limit the amount crossed
+	Threshold Money `gorm:"type:decimal(10,2);not null" json:"threshold" swaggertype:"string"`
+	// Timestamp of when the Aibo marked the Alert as read
+	ReadAt *time.Time `gorm:"type:datetime;default:null" json:"read_at"`
+	// Timestamp of when the Alert was handed to the notifier
+	DeliveredAt *time.Time `gorm:"type:datetime;default:null;index" json:"delivered_at"`
+	// Timestamp of when the Alert was raised
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
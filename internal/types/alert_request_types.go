@@ -0,0 +1,67 @@
+package types
+
+import "github.com/bwmarrin/snowflake"
+
+// CreateAlertRuleRequest represents the request to create a budget alert rule
+// @Description Create alert rule request structure
+type CreateAlertRuleRequest struct {
+	// What the rule watches (budget_used, daily_budget_exceeded or delta_below)
+	// @example budget_used
+	Kind AlertKind `json:"kind" binding:"required"`
+	// ID of the CatBud watched by a budget_used rule
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Percentage of the envelope of the CatBud that fires a budget_used rule
+	// @example 80
+	Percent int `json:"percent"`
+	// CurrentDelta under which a delta_below rule fires
+	// @example -20.00
+	Floor *Money `json:"floor" swaggertype:"string"`
+}
+
+// UpdateAlertRuleRequest represents the request to change a budget alert rule
+// @Description Update alert rule request structure
+type UpdateAlertRuleRequest struct {
+	// New percentage of a budget_used rule
+	Percent *int `json:"percent"`
+	// New floor of a delta_below rule
+	Floor *Money `json:"floor" swaggertype:"string"`
+	// Silence or restore the rule
+	Muted *bool `json:"muted"`
+}
+
+// AlertRuleResponse represents the response containing a single alert rule
+// @Description Single alert rule response structure
+type AlertRuleResponse struct {
+	// The alert rule
+	Rule AlertRule `json:"rule"`
+}
+
+// ListAlertRulesResponse represents the response containing the alert rules of an Aibo
+// @Description List alert rules response structure
+type ListAlertRulesResponse struct {
+	// Alert rules, oldest first
+	Rules []AlertRule `json:"rules"`
+}
+
+// ListAlertsRequest represents the query parameters to list the alerts of an Aibo
+// @Description List alerts query structure
+type ListAlertsRequest struct {
+	// Only list the alerts not read yet
+	Unread bool `form:"unread"`
+}
+
+// AlertResponse represents the response containing a single alert
+// @Description Single alert response structure
+type AlertResponse struct {
+	// The alert
+	Alert Alert `json:"alert"`
+}
+
+// ListAlertsResponse represents the response containing the alerts of an Aibo
+// @Description List alerts response structure
+type ListAlertsResponse struct {
+	// Alerts, most recent first
+	Alerts []Alert `json:"alerts"`
+	// Number of alerts not read yet
+	Unread int64 `json:"unread"`
+}
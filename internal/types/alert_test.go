@@ -0,0 +1,110 @@
+package types
+
+import "testing"
+
+func TestAlertKindIsValid(t *testing.T) {
+	for kind, want := range map[AlertKind]bool{
+		AlertBudgetUsed:          true,
+		AlertDailyBudgetExceeded: true,
+		AlertDeltaBelow:          true,
+		"":                       false,
+		"budget":                 false,
+	} {
+		if got := kind.IsValid(); got != want {
+			t.Errorf("AlertKind(%q).IsValid() = %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestAlertRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    AlertRule
+		wantErr bool
+	}{
+		{"budget used", AlertRule{Kind: AlertBudgetUsed, CatBudID: idPtr(1), Percent: 80}, false},
+		{"budget used over the envelope", AlertRule{Kind: AlertBudgetUsed, CatBudID: idPtr(1), Percent: MaxAlertPercent}, false},
+		{"budget used without CatBud", AlertRule{Kind: AlertBudgetUsed, Percent: 80}, true},
+		{"budget used at 0%", AlertRule{Kind: AlertBudgetUsed, CatBudID: idPtr(1)}, true},
+		{"budget used over the cap", AlertRule{Kind: AlertBudgetUsed, CatBudID: idPtr(1), Percent: MaxAlertPercent + 1}, true},
+		{"daily budget exceeded", AlertRule{Kind: AlertDailyBudgetExceeded}, false},
+		{"daily budget exceeded on a CatBud", AlertRule{Kind: AlertDailyBudgetExceeded, CatBudID: idPtr(1)}, true},
+		{"delta below", AlertRule{Kind: AlertDeltaBelow, Floor: moneyPtr(-2000)}, false},
+		{"delta below without floor", AlertRule{Kind: AlertDeltaBelow}, true},
+		{"delta below on a CatBud", AlertRule{Kind: AlertDeltaBelow, CatBudID: idPtr(1), Floor: moneyPtr(0)}, true},
+		{"unknown kind", AlertRule{Kind: "weekly_digest"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAlertRuleCatBudAlert(t *testing.T) {
+	rule := AlertRule{ID: 7, Kind: AlertBudgetUsed, CatBudID: idPtr(1), Percent: 80}
+	tests := []struct {
+		name          string
+		catBud        CatBud
+		wantThreshold Money
+		wantAlert     bool
+	}{
+		{"under the threshold", CatBud{Budget: moneyPtr(10000), Spent: 7999}, 8000, false},
+		{"at the threshold", CatBud{Budget: moneyPtr(10000), Spent: 8000}, 8000, true},
+		{"carried over widens the envelope", CatBud{Budget: moneyPtr(10000), CarriedOver: 5000, Spent: 10000}, 12000, false},
+		{"overspent carried over narrows it", CatBud{Budget: moneyPtr(10000), CarriedOver: -5000, Spent: 4000}, 4000, true},
+		{"no budget", CatBud{Spent: 100000}, 0, false},
+		{"nothing spent", CatBud{Budget: moneyPtr(0)}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.catBud.ID, tt.catBud.Category, tt.catBud.PeriodStart = 1, "Groceries", datePtr(2024, 3, 1)
+			alert := rule.CatBudAlert(&tt.catBud)
+			if (alert != nil) != tt.wantAlert {
+				t.Fatalf("CatBudAlert = %+v, want an alert %v", alert, tt.wantAlert)
+			}
+			if alert == nil {
+				return
+			}
+			if alert.Threshold != tt.wantThreshold || alert.Amount != tt.catBud.Spent || alert.RuleID != 7 ||
+				!alert.PeriodStart.Equal(date(2024, 3, 1)) || alert.CatBudID == nil || *alert.CatBudID != 1 {
+				t.Fatalf("CatBudAlert = %+v", alert)
+			}
+		})
+	}
+}
+
+func TestAlertRuleDailyAlert(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       AlertRule
+		aibo       Aibo
+		wantAmount *Money
+	}{
+		{"within the daily budget", AlertRule{Kind: AlertDailyBudgetExceeded}, Aibo{DailyBudget: 3000, CurrentDelta: 500}, nil},
+		{"daily budget spent exactly", AlertRule{Kind: AlertDailyBudgetExceeded}, Aibo{DailyBudget: 3000, CurrentDelta: 0}, nil},
+		{"daily budget exceeded", AlertRule{Kind: AlertDailyBudgetExceeded}, Aibo{DailyBudget: 3000, CurrentDelta: -1200}, moneyPtr(4200)},
+		{"carried delta counts", AlertRule{Kind: AlertDailyBudgetExceeded}, Aibo{DailyBudget: 3000, CarriedDelta: 2000, CurrentDelta: 1000}, moneyPtr(4000)},
+		{"no daily budget", AlertRule{Kind: AlertDailyBudgetExceeded}, Aibo{CurrentDelta: -1200}, nil},
+		{"above the floor", AlertRule{Kind: AlertDeltaBelow, Floor: moneyPtr(-1000)}, Aibo{CurrentDelta: -1000}, nil},
+		{"below the floor", AlertRule{Kind: AlertDeltaBelow, Floor: moneyPtr(-1000)}, Aibo{CurrentDelta: -1001}, moneyPtr(-1001)},
+		{"budget used rule", AlertRule{Kind: AlertBudgetUsed, CatBudID: idPtr(1), Percent: 80}, Aibo{DailyBudget: 3000, CurrentDelta: -1200}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.aibo.BudgetDay = datePtr(2024, 3, 4)
+			alert := tt.rule.DailyAlert(&tt.aibo)
+			if (alert != nil) != (tt.wantAmount != nil) {
+				t.Fatalf("DailyAlert = %+v, want amount %v", alert, tt.wantAmount)
+			}
+			if alert != nil && (alert.Amount != *tt.wantAmount || !alert.PeriodStart.Equal(date(2024, 3, 4))) {
+				t.Fatalf("DailyAlert = %+v, want amount %v", alert, *tt.wantAmount)
+			}
+		})
+	}
+
+	noDay := Aibo{DailyBudget: 3000, CurrentDelta: -1200}
+	if alert := (&AlertRule{Kind: AlertDailyBudgetExceeded}).DailyAlert(&noDay); alert != nil {
+		t.Fatalf("DailyAlert without budget day = %+v", alert)
+	}
+}
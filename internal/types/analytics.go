@@ -0,0 +1,167 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// SpendingGrouping is the dimension spending totals are grouped by.
+type SpendingGrouping string
+
+const (
+	// GroupByCategory groups by the CatBud the amounts are booked on, split lines included.
+	GroupByCategory SpendingGrouping = "category"
+	// GroupByDay, GroupByWeek and GroupByMonth group by calendar bucket. Weeks start on Monday.
+	GroupByDay   SpendingGrouping = "day"
+	GroupByWeek  SpendingGrouping = "week"
+	GroupByMonth SpendingGrouping = "month"
+	// GroupByPayee groups by payee, ignoring the case and the surrounding spaces.
+	GroupByPayee SpendingGrouping = "payee"
+)
+
+// IsValid reports whether the grouping is one of the known spending groupings.
+func (g SpendingGrouping) IsValid() bool {
+	switch g {
+	case GroupByCategory, GroupByDay, GroupByWeek, GroupByMonth, GroupByPayee:
+		return true
+	}
+	return false
+}
+
+// IsTime reports whether the grouping is a calendar bucket.
+func (g SpendingGrouping) IsTime() bool {
+	return g == GroupByDay || g == GroupByWeek || g == GroupByMonth
+}
+
+// Range returns the range a report over [from, to] covers: a calendar grouping is widened to
+// whole buckets, so that the first and last buckets compare with the others.
+func (g SpendingGrouping) Range(from, to time.Time) (time.Time, time.Time) {
+	var period BudgetPeriod
+	switch g {
+	case GroupByWeek:
+		period = PeriodWeekly
+	case GroupByMonth:
+		period = PeriodMonthly
+	default:
+		return truncateDay(from), truncateDay(to)
+	}
+	start, _ := period.Bounds(nil, nil, from)
+	_, end := period.Bounds(nil, nil, to)
+	return start, end
+}
+
+// PreviousRange returns the range a report over [from, to] is compared with: as many months right
+// before it for the monthly grouping, and as many days right before it otherwise.
+func (g SpendingGrouping) PreviousRange(from, to time.Time) (time.Time, time.Time) {
+	if g != GroupByMonth {
+		return PreviousRange(from, to)
+	}
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month()) + 1
+	return from.AddDate(0, -months, 0), from.AddDate(0, 0, -1)
+}
+
+// PreviousRange returns the range of the same number of days right before [from, to].
+func PreviousRange(from, to time.Time) (time.Time, time.Time) {
+	days := PeriodDays(from, to)
+	return truncateDay(from).AddDate(0, 0, -days), truncateDay(from).AddDate(0, 0, -1)
+}
+
+// SpendingTotals sums the approved transactions of a range, in the base currency of the Aibo or
+// in the currency of the Household
+// @Description Spending totals of a range, compared with the previous range
+type SpendingTotals struct {
+	// Sum of the expenses
+	Expenses Money `json:"expenses" swaggertype:"string"`
+	// Sum of the incomes
+	Income Money `json:"income" swaggertype:"string"`
+	// Expenses minus incomes
+	Net Money `json:"net" swaggertype:"string"`
+	// Number of transactions, a split transaction counting once
+	Count int64 `gorm:"column:transaction_count" json:"count"`
+	// Net amount of the previous range, or of the previous bucket for a calendar grouping
+	PreviousNet Money `json:"previous_net" swaggertype:"string"`
+	// Net minus previous net
+	Change Money `gorm:"column:change_amount" json:"change" swaggertype:"string"`
+	// Change in percent of the previous net, null when the previous net is zero
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// SpendingGroup is the spending of one group of a SpendingReport
+// @Description Spending totals of a category, calendar bucket or payee
+type SpendingGroup struct {
+	// ID of the CatBud for the category grouping (empty when uncategorized), first day of the
+	// bucket (YYYY-MM-DD) for a calendar grouping, or the payee
+	Key string `gorm:"column:group_key" json:"key"`
+	// ID of the CatBud for the category grouping, null otherwise or when uncategorized
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Name of the category, the payee, or the key of the bucket
+	Label string `json:"label"`
+	SpendingTotals
+}
+
+// SpendingReport is the spending of a range grouped by one dimension
+// @Description Spending totals grouped by category, calendar bucket or payee
+type SpendingReport struct {
+	// Dimension of the groups
+	GroupBy SpendingGrouping `json:"group_by" enums:"category,day,week,month,payee"`
+	// First day of the range
+	From time.Time `json:"from"`
+	// Last day of the range
+	To time.Time `json:"to"`
+	// First day of the range compared with
+	PreviousFrom time.Time `json:"previous_from"`
+	// Last day of the range compared with
+	PreviousTo time.Time `json:"previous_to"`
+	// Groups with at least one transaction in the range or the range compared with
+	Groups []SpendingGroup `json:"groups"`
+	// Totals of the range
+	Total SpendingTotals `json:"total"`
+}
+
+// BudgetComparison compares the budget of a CatBud with what was actually spent on it
+// @Description Budget versus actual spending of a CatBud over a range
+type BudgetComparison struct {
+	// ID of the CatBud
+	CatBudID snowflake.ID `json:"cat_bud_id"`
+	// ID of the parent CatBud, null for a top-level category
+	ParentID *snowflake.ID `json:"parent_id" swaggertype:"integer"`
+	// ID of the Household sharing the CatBud, null for a personal CatBud
+	HouseholdID *uuid.UUID `json:"household_id" swaggertype:"string" format:"uuid"`
+	// Name of the category
+	Category string `json:"category"`
+	// Recurrence of the budget
+	Period BudgetPeriod `json:"period"`
+	// Budget per period, null when there is no budget
+	Budget *Money `json:"budget" swaggertype:"string"`
+	// Budget pro-rated over the days of the range from the current period, null when there is no budget
+	Budgeted *Money `json:"budgeted" swaggertype:"string"`
+	// Expenses minus incomes booked on the CatBud during the range, by every member for a shared CatBud
+	Actual Money `json:"actual" swaggertype:"string"`
+	// Budgeted minus actual, negative when overspent, null when there is no budget
+	Difference *Money `json:"difference" swaggertype:"string"`
+	// Actual in percent of budgeted, null when there is no budget
+	UsedPercent *float64 `json:"used_percent"`
+	// Actual amount of the previous range
+	PreviousActual Money `json:"previous_actual" swaggertype:"string"`
+	// Actual minus previous actual
+	Change Money `gorm:"column:change_amount" json:"change" swaggertype:"string"`
+	// Change in percent of the previous actual, null when the previous actual is zero
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// BudgetReport compares the budgets of the CatBuds with the actual spending of a range
+// @Description Budget versus actual spending per CatBud
+type BudgetReport struct {
+	// First day of the range
+	From time.Time `json:"from"`
+	// Last day of the range
+	To time.Time `json:"to"`
+	// First day of the range compared with
+	PreviousFrom time.Time `json:"previous_from"`
+	// Last day of the range compared with
+	PreviousTo time.Time `json:"previous_to"`
+	// One line per CatBud
+	CatBuds []BudgetComparison `json:"cat_buds"`
+}
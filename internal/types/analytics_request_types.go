@@ -0,0 +1,32 @@
+package types
+
+// SpendingReportRequest represents the query parameters of a spending report
+// @Description Spending report query structure
+type SpendingReportRequest struct {
+	// First day of the range (format: YYYY-MM-DD), defaults to the first day of the current month
+	// @example 2024-01-01
+	From string `form:"from"`
+	// Last day of the range (format: YYYY-MM-DD), defaults to the last day of the current month
+	// @example 2024-03-31
+	To string `form:"to"`
+	// Dimension of the groups: category (default), day, week, month or payee
+	// @example month
+	GroupBy SpendingGrouping `form:"group_by"`
+	// Report on the CatBuds shared by this Household instead of the transactions of the aibo
+	// @example 550e8400-e29b-41d4-a716-446655440000
+	HouseholdID string `form:"household_id"`
+}
+
+// BudgetReportRequest represents the query parameters of a budget versus actual report
+// @Description Budget versus actual report query structure
+type BudgetReportRequest struct {
+	// First day of the range (format: YYYY-MM-DD), defaults to the first day of the current month
+	// @example 2024-01-01
+	From string `form:"from"`
+	// Last day of the range (format: YYYY-MM-DD), defaults to the last day of the current month
+	// @example 2024-01-31
+	To string `form:"to"`
+	// Only compare the CatBuds shared by this Household
+	// @example 550e8400-e29b-41d4-a716-446655440000
+	HouseholdID string `form:"household_id"`
+}
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpendingGroupingIsValid(t *testing.T) {
+	tests := []struct {
+		grouping SpendingGrouping
+		valid    bool
+		time     bool
+	}{
+		{GroupByCategory, true, false},
+		{GroupByDay, true, true},
+		{GroupByWeek, true, true},
+		{GroupByMonth, true, true},
+		{GroupByPayee, true, false},
+		{"year", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.grouping.IsValid(); got != tt.valid {
+			t.Errorf("%q: IsValid = %v, want %v", tt.grouping, got, tt.valid)
+		}
+		if got := tt.grouping.IsTime(); got != tt.time {
+			t.Errorf("%q: IsTime = %v, want %v", tt.grouping, got, tt.time)
+		}
+	}
+}
+
+func TestSpendingGroupingRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		grouping     SpendingGrouping
+		from, to     time.Time
+		wantFrom     time.Time
+		wantTo       time.Time
+		wantPrevFrom time.Time
+		wantPrevTo   time.Time
+	}{
+		{"category", GroupByCategory, date(2024, 3, 10), date(2024, 3, 19), date(2024, 3, 10), date(2024, 3, 19), date(2024, 2, 29), date(2024, 3, 9)},
+		{"day", GroupByDay, time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC), date(2024, 3, 10), date(2024, 3, 10), date(2024, 3, 10), date(2024, 3, 9), date(2024, 3, 9)},
+		// 2024-03-13 is a Wednesday: the weeks run from Monday the 11th to Sunday the 24th.
+		{"week", GroupByWeek, date(2024, 3, 13), date(2024, 3, 20), date(2024, 3, 11), date(2024, 3, 24), date(2024, 2, 26), date(2024, 3, 10)},
+		{"month", GroupByMonth, date(2024, 3, 15), date(2024, 3, 20), date(2024, 3, 1), date(2024, 3, 31), date(2024, 2, 1), date(2024, 2, 29)},
+		{"months", GroupByMonth, date(2024, 2, 10), date(2024, 4, 2), date(2024, 2, 1), date(2024, 4, 30), date(2023, 11, 1), date(2024, 1, 31)},
+		{"across the year", GroupByMonth, date(2024, 1, 5), date(2024, 1, 5), date(2024, 1, 1), date(2024, 1, 31), date(2023, 12, 1), date(2023, 12, 31)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := tt.grouping.Range(tt.from, tt.to)
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Fatalf("Range = %v - %v, want %v - %v", from, to, tt.wantFrom, tt.wantTo)
+			}
+			prevFrom, prevTo := tt.grouping.PreviousRange(from, to)
+			if !prevFrom.Equal(tt.wantPrevFrom) || !prevTo.Equal(tt.wantPrevTo) {
+				t.Fatalf("PreviousRange = %v - %v, want %v - %v", prevFrom, prevTo, tt.wantPrevFrom, tt.wantPrevTo)
+			}
+		})
+	}
+}
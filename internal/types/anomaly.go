@@ -0,0 +1,176 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// AnomalyKind is the reason an expense was flagged as unusual.
+type AnomalyKind string
+
+const (
+	// AnomalyCategoryOutlier is an expense far above the usual expenses of its CatBud, measured in
+	// standard deviations (z-score).
+	AnomalyCategoryOutlier AnomalyKind = "category_outlier"
+	// AnomalyNewPayee is a large first payment to a payee.
+	AnomalyNewPayee AnomalyKind = "new_payee"
+	// AnomalyDuplicateCharge is an expense with the same amount and payee as another one a few
+	// days apart, such as a double billing.
+	AnomalyDuplicateCharge AnomalyKind = "duplicate_charge"
+	// AnomalyAmountChanged is a payment to a payee that is always charged the same amount, for a
+	// different amount, such as a subscription price hike.
+	AnomalyAmountChanged AnomalyKind = "amount_changed"
+)
+
+// AnomalyStatus is where an Anomaly stands in its review.
+type AnomalyStatus string
+
+const (
+	// AnomalyOpen has not been reviewed yet.
+	AnomalyOpen AnomalyStatus = "open"
+	// AnomalyConfirmed was confirmed as a real problem by the Aibo.
+	AnomalyConfirmed AnomalyStatus = "confirmed"
+	// AnomalyDismissed was dismissed as expected by the Aibo.
+	AnomalyDismissed AnomalyStatus = "dismissed"
+)
+
+// IsValid reports whether the status is one of the known anomaly statuses.
+func (s AnomalyStatus) IsValid() bool {
+	return s == AnomalyOpen || s == AnomalyConfirmed || s == AnomalyDismissed
+}
+
+// Anomaly is an unusual expense found in the ledger of an Aibo, to be reviewed
+// @Description Unusual expense finding
+type Anomaly struct {
+	// Unique identifier for the Anomaly
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo the expense belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// ID of the unusual Transaction
+	TransactionID snowflake.ID `gorm:"type:bigint;not null;uniqueIndex:idx_anomalies_transaction_kind,priority:1" json:"transaction_id"`
+	// Reason the expense was flagged
+	Kind AnomalyKind `gorm:"type:varchar(32);not null;uniqueIndex:idx_anomalies_transaction_kind,priority:2" json:"kind" enums:"category_outlier,new_payee,duplicate_charge,amount_changed"`
+	// ID of the Transaction the expense looks like a duplicate of (duplicate_charge only)
+	RelatedTransactionID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"related_transaction_id" swaggertype:"integer"`
+	// ID of the CatBud the unusual amount is booked on (category_outlier only)
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Payee of the expense
+	Payee string `gorm:"type:varchar(255)" json:"payee"`
+	// Day of the expense
+	Date time.Time `gorm:"type:date;not null" json:"date"`
+	// Amount of the expense in the base currency, or of the unusual split line
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// How unusual the expense is: the z-score for category_outlier, the ratio to the threshold
+	// for new_payee, the relative change for amount_changed and 1 for duplicate_charge
+	Score float64 `gorm:"not null" json:"score"`
+	// Human readable description of the finding
+	Message string `gorm:"type:varchar(512);not null" json:"message"`
+	// Review status (open, confirmed or dismissed)
+	Status AnomalyStatus `gorm:"type:varchar(16);not null;default:'open';index" json:"status" enums:"open,confirmed,dismissed"`
+	// Timestamp of when the finding was confirmed or dismissed
+	ReviewedAt *time.Time `gorm:"type:datetime;default:null" json:"reviewed_at"`
+	// Timestamp of when the finding was handed to the notifier, or passed over because the Aibo
+	// does not want to be notified
+	DeliveredAt *time.Time `gorm:"type:datetime;default:null;index" json:"delivered_at"`
+	// Timestamp of when the finding was made
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// AnomalySettings tunes the anomaly detection of an Aibo
+// @Description Anomaly detection settings
+type AnomalySettings struct {
+	// ID of the Aibo the settings belong to
+	AiboID uuid.UUID `gorm:"type:char(36);primaryKey" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Whether new expenses are checked at all
+	Enabled bool `gorm:"not null" json:"enabled"`
+	// Number of standard deviations above the mean of its CatBud an expense must reach to be flagged
+	ZScoreThreshold float64 `gorm:"not null" json:"z_score_threshold"`
+	// Smallest first payment to a payee that is flagged
+	NewPayeeMinAmount Money `gorm:"type:decimal(10,2);not null" json:"new_payee_min_amount" swaggertype:"string"`
+	// Number of days around an expense within which the same charge is a duplicate
+	DuplicateWindowDays int `gorm:"not null" json:"duplicate_window_days"`
+	// Whether the findings are sent through the notification channels
+	Notify bool `gorm:"not null" json:"notify"`
+	// Timestamp of when the settings were last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// DefaultAnomalySettings returns the settings of an Aibo that never changed them: detection on,
+// three standard deviations, first payments from 100.00, duplicates within three days, and no
+// notification.
+func DefaultAnomalySettings(aiboID uuid.UUID) AnomalySettings {
+	return AnomalySettings{
+		AiboID:              aiboID,
+		Enabled:             true,
+		ZScoreThreshold:     3,
+		NewPayeeMinAmount:   Cents(10000),
+		DuplicateWindowDays: 3,
+	}
+}
+
+// Validate checks that the thresholds of the settings are within their ranges.
+func (s *AnomalySettings) Validate() error {
+	if s.ZScoreThreshold < 1 || s.ZScoreThreshold > 10 {
+		return errors.New("z_score_threshold must be between 1 and 10")
+	}
+	if s.NewPayeeMinAmount < 0 {
+		return errors.New("new_payee_min_amount must not be negative")
+	}
+	if s.DuplicateWindowDays < 0 || s.DuplicateWindowDays > 31 {
+		return errors.New("duplicate_window_days must be between 0 and 31")
+	}
+	return nil
+}
+
+const (
+	// anomalyMinSamples is the number of past expenses a CatBud needs before its outliers are flagged.
+	anomalyMinSamples = 10
+	// anomalyMinFixedCharges is the number of identical past charges that make the amount of a payee
+	// fixed.
+	anomalyMinFixedCharges = 3
+)
+
+// ExpenseStats summarizes the past expense lines of a CatBud, in base currency units.
+type ExpenseStats struct {
+	Samples int64
+	Mean    float64
+	StdDev  float64
+}
+
+// ZScore returns how many standard deviations amount is above the mean of the past expenses, and
+// false when there are too few of them or they are all alike to tell.
+func (s ExpenseStats) ZScore(amount Money) (float64, bool) {
+	if s.Samples < anomalyMinSamples || s.StdDev <= 0 {
+		return 0, false
+	}
+	return (amount.Float64() - s.Mean) / s.StdDev, true
+}
+
+// ChargeHistory summarizes the past charges of a payee in one currency.
+type ChargeHistory struct {
+	Charges int64
+	Low     Money
+	High    Money
+}
+
+// AmountChange returns the relative change of amount from the amount the payee always charges,
+// and false when the payee does not always charge the same amount or amount is that one.
+func (h ChargeHistory) AmountChange(amount Money) (float64, bool) {
+	if h.Charges < anomalyMinFixedCharges || h.Low != h.High || h.Low <= 0 || amount == h.Low {
+		return 0, false
+	}
+	return (amount - h.Low).Float64() / h.Low.Float64(), true
+}
+
+// NewPayeeScore returns how far a first payment of amount is above the smallest one that is
+// flagged, 1 when every first payment is.
+func (s *AnomalySettings) NewPayeeScore(amount Money) float64 {
+	if s.NewPayeeMinAmount <= 0 {
+		return 1
+	}
+	return amount.Float64() / s.NewPayeeMinAmount.Float64()
+}
@@ -0,0 +1,69 @@
+package types
+
+// ListAnomaliesRequest represents the query parameters to list Anomalies
+// @Description List Anomalies query structure
+type ListAnomaliesRequest struct {
+	// Only list the findings with this status (open, confirmed or dismissed)
+	// @example open
+	Status AnomalyStatus `form:"status"`
+}
+
+// ListAnomaliesResponse represents the response containing the Anomalies of an Aibo
+// @Description List Anomalies response structure
+type ListAnomaliesResponse struct {
+	// Findings, most recent first
+	Anomalies []Anomaly `json:"anomalies"`
+	// Number of findings not reviewed yet
+	Open int64 `json:"open"`
+}
+
+// AnomalyResponse represents the response containing a single Anomaly
+// @Description Single Anomaly response structure
+type AnomalyResponse struct {
+	// The finding
+	Anomaly Anomaly `json:"anomaly"`
+}
+
+// UpdateAnomalySettingsRequest represents the request to tune the anomaly detection
+// @Description Update anomaly settings request structure
+type UpdateAnomalySettingsRequest struct {
+	// Whether new expenses are checked
+	// @example true
+	Enabled *bool `json:"enabled"`
+	// Number of standard deviations above the mean of its CatBud an expense must reach to be flagged
+	// @example 3
+	ZScoreThreshold *float64 `json:"z_score_threshold"`
+	// Smallest first payment to a payee that is flagged
+	// @example 150.00
+	NewPayeeMinAmount *Money `json:"new_payee_min_amount" swaggertype:"string"`
+	// Number of days around an expense within which the same charge is a duplicate
+	// @example 3
+	DuplicateWindowDays *int `json:"duplicate_window_days"`
+	// Whether the findings are sent through the notification channels
+	// @example true
+	Notify *bool `json:"notify"`
+}
+
+// AnomalySettingsResponse represents the response containing the anomaly detection settings
+// @Description Anomaly settings response structure
+type AnomalySettingsResponse struct {
+	// The settings
+	Settings AnomalySettings `json:"settings"`
+}
+
+// ScanAnomaliesRequest represents the request to check past expenses for anomalies
+// @Description Scan anomalies request structure
+type ScanAnomaliesRequest struct {
+	// First day to check (format: YYYY-MM-DD), defaults to 90 days ago, at most a year ago
+	// @example 2024-01-01
+	From string `json:"from"`
+}
+
+// ScanAnomaliesResponse represents the result of a scan
+// @Description Scan anomalies response structure
+type ScanAnomaliesResponse struct {
+	// Number of expenses checked
+	Checked int `json:"checked"`
+	// Number of new findings
+	Found int `json:"found"`
+}
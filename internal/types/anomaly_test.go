@@ -0,0 +1,112 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAnomalyStatusIsValid(t *testing.T) {
+	for _, status := range []AnomalyStatus{AnomalyOpen, AnomalyConfirmed, AnomalyDismissed} {
+		if !status.IsValid() {
+			t.Errorf("%s: IsValid = false", status)
+		}
+	}
+	for _, status := range []AnomalyStatus{"", "closed", "OPEN"} {
+		if status.IsValid() {
+			t.Errorf("%q: IsValid = true", status)
+		}
+	}
+}
+
+func TestAnomalySettingsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*AnomalySettings)
+		wantErr bool
+	}{
+		{"defaults", func(*AnomalySettings) {}, false},
+		{"lowest threshold", func(s *AnomalySettings) { s.ZScoreThreshold = 1 }, false},
+		{"highest threshold", func(s *AnomalySettings) { s.ZScoreThreshold = 10 }, false},
+		{"threshold too low", func(s *AnomalySettings) { s.ZScoreThreshold = 0.5 }, true},
+		{"threshold too high", func(s *AnomalySettings) { s.ZScoreThreshold = 10.5 }, true},
+		{"every first payment", func(s *AnomalySettings) { s.NewPayeeMinAmount = 0 }, false},
+		{"negative first payment", func(s *AnomalySettings) { s.NewPayeeMinAmount = -1 }, true},
+		{"same day duplicates only", func(s *AnomalySettings) { s.DuplicateWindowDays = 0 }, false},
+		{"month of duplicates", func(s *AnomalySettings) { s.DuplicateWindowDays = 31 }, false},
+		{"negative window", func(s *AnomalySettings) { s.DuplicateWindowDays = -1 }, true},
+		{"window too long", func(s *AnomalySettings) { s.DuplicateWindowDays = 32 }, true},
+	}
+	for _, tt := range tests {
+		settings := DefaultAnomalySettings(uuid.New())
+		tt.change(&settings)
+		if err := settings.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExpenseStatsZScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		stats  ExpenseStats
+		amount Money
+		want   float64
+		wantOK bool
+	}{
+		{"far above", ExpenseStats{Samples: 10, Mean: 20, StdDev: 5}, 5000, 6, true},
+		{"at the mean", ExpenseStats{Samples: 10, Mean: 20, StdDev: 5}, 2000, 0, true},
+		{"below the mean", ExpenseStats{Samples: 30, Mean: 20, StdDev: 4}, 1000, -2.5, true},
+		{"too few samples", ExpenseStats{Samples: 9, Mean: 20, StdDev: 5}, 5000, 0, false},
+		{"all alike", ExpenseStats{Samples: 50, Mean: 20}, 5000, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.stats.ZScore(tt.amount)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: ZScore = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestChargeHistoryAmountChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		history ChargeHistory
+		amount  Money
+		want    float64
+		wantOK  bool
+	}{
+		{"price hike", ChargeHistory{Charges: 3, Low: 1000, High: 1000}, 1250, 0.25, true},
+		{"price drop", ChargeHistory{Charges: 12, Low: 1000, High: 1000}, 500, -0.5, true},
+		{"same amount", ChargeHistory{Charges: 12, Low: 1000, High: 1000}, 1000, 0, false},
+		{"too few charges", ChargeHistory{Charges: 2, Low: 1000, High: 1000}, 1250, 0, false},
+		{"varying amounts", ChargeHistory{Charges: 12, Low: 900, High: 1000}, 1250, 0, false},
+		{"no charges", ChargeHistory{}, 1250, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.history.AmountChange(tt.amount)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: AmountChange = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAnomalySettingsNewPayeeScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		minAmount Money
+		amount    Money
+		want      float64
+	}{
+		{"at the threshold", 10000, 10000, 1},
+		{"above the threshold", 10000, 35000, 3.5},
+		{"every first payment", 0, 35000, 1},
+	}
+	for _, tt := range tests {
+		settings := AnomalySettings{NewPayeeMinAmount: tt.minAmount}
+		if got := settings.NewPayeeScore(tt.amount); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: NewPayeeScore = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
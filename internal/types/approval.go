@@ -0,0 +1,161 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// ApprovalStatus is the state of an ApprovalRequest.
+type ApprovalStatus string
+
+const (
+	// ApprovalPending waits for the decisions of the members.
+	ApprovalPending ApprovalStatus = "pending"
+	// ApprovalApproved received enough approvals.
+	ApprovalApproved ApprovalStatus = "approved"
+	// ApprovalRejected was rejected by a member.
+	ApprovalRejected ApprovalStatus = "rejected"
+	// ApprovalCancelled no longer applies, because its Transaction was changed or deleted.
+	ApprovalCancelled ApprovalStatus = "cancelled"
+)
+
+// ApprovalDecisionKind is the answer of a member to an ApprovalRequest.
+type ApprovalDecisionKind string
+
+const (
+	// DecisionApprove agrees with the expense.
+	DecisionApprove ApprovalDecisionKind = "approve"
+	// DecisionReject refuses the expense.
+	DecisionReject ApprovalDecisionKind = "reject"
+)
+
+// ApprovalRule makes the expenses booked on the CatBuds of a Household wait for the approval of
+// the other members when they are over a threshold
+// @Description Household approval rule model
+type ApprovalRule struct {
+	// Unique identifier for the ApprovalRule
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Household the rule applies to
+	HouseholdID uuid.UUID `gorm:"type:char(36);not null;index" json:"household_id" swaggertype:"string" format:"uuid"`
+	// ID of the CatBud the rule applies to, along with its subcategories; null for every CatBud of
+	// the Household
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Expenses booked on the CatBud for more than this amount, in the currency of the Household,
+	// need approval
+	Threshold Money `gorm:"type:decimal(10,2);not null" json:"threshold" swaggertype:"string"`
+	// Number of members who must approve, capped to the number of members who can approve
+	RequiredApprovals int `gorm:"not null;default:1" json:"required_approvals"`
+	// ID of the Aibo who created the rule
+	CreatedBy uuid.UUID `gorm:"type:char(36);not null" json:"created_by" swaggertype:"string" format:"uuid"`
+	// Timestamp of when the rule was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the rule was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate checks that the settings of the rule are consistent.
+func (r *ApprovalRule) Validate() error {
+	if r.Threshold < 0 {
+		return errors.New("threshold must not be negative")
+	}
+	if r.RequiredApprovals < 1 {
+		return errors.New("required_approvals must be at least 1")
+	}
+	return nil
+}
+
+// TriggeredApprovalRule returns the most demanding of the rules of a Household triggered by the
+// shares of an expense booked on its CatBuds, in the currency of the Household, along with the
+// amount the rule covers, or nil when no rule is triggered.
+//
+// A rule covers the shares booked on its CatBud and on the subcategories of it, found through the
+// parents of the CatBuds of the Household, or every share when it has no CatBud. It is triggered
+// when they add up to more than its threshold. Among the triggered rules, the one requiring the
+// most approvals wins, the first one on a tie.
+func TriggeredApprovalRule(rules []ApprovalRule, parents map[snowflake.ID]*snowflake.ID, shares map[snowflake.ID]Money) (*ApprovalRule, Money) {
+	var best *ApprovalRule
+	var bestAmount Money
+	for i, rule := range rules {
+		var amount Money
+		for id, share := range shares {
+			if rule.CatBudID == nil || isWithinCatBud(parents, id, *rule.CatBudID) {
+				amount += share
+			}
+		}
+		if amount > rule.Threshold && (best == nil || rule.RequiredApprovals > best.RequiredApprovals) {
+			best, bestAmount = &rules[i], amount
+		}
+	}
+	return best, bestAmount
+}
+
+// isWithinCatBud reports whether the CatBud is the ancestor CatBud or one of its subcategories,
+// walking up the parents. The walk is bounded by the size of the tree, in case the categories
+// loop.
+func isWithinCatBud(parents map[snowflake.ID]*snowflake.ID, id, ancestor snowflake.ID) bool {
+	for range len(parents) + 1 {
+		if id == ancestor {
+			return true
+		}
+		parent, ok := parents[id]
+		if !ok || parent == nil {
+			return false
+		}
+		id = *parent
+	}
+	return false
+}
+
+// ApprovalRequest asks the members of a Household to approve an expense booked on its CatBuds
+// @Description Approval request model
+type ApprovalRequest struct {
+	// Unique identifier for the ApprovalRequest
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Transaction waiting for approval
+	TransactionID snowflake.ID `gorm:"type:bigint;not null;index" json:"transaction_id"`
+	// The Transaction waiting for approval
+	Transaction *Transaction `gorm:"-" json:"transaction,omitempty"`
+	// ID of the Household whose members decide
+	HouseholdID uuid.UUID `gorm:"type:char(36);not null;index" json:"household_id" swaggertype:"string" format:"uuid"`
+	// ID of the rule that required the approval
+	RuleID snowflake.ID `gorm:"type:bigint;not null" json:"rule_id"`
+	// ID of the Aibo who recorded the expense
+	RequestedBy uuid.UUID `gorm:"type:char(36);not null" json:"requested_by" swaggertype:"string" format:"uuid"`
+	// Part of the expense booked on the CatBuds of the Household, in the currency of the Household
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// Number of approvals needed
+	RequiredApprovals int `gorm:"not null" json:"required_approvals"`
+	// Number of approvals received
+	Approvals int `gorm:"not null;default:0" json:"approvals"`
+	// State of the request (pending, approved, rejected or cancelled)
+	Status ApprovalStatus `gorm:"type:varchar(16);not null;default:'pending';index" json:"status" enums:"pending,approved,rejected,cancelled"`
+	// Decisions of the members
+	Decisions []ApprovalDecision `gorm:"foreignKey:ApprovalRequestID" json:"decisions"`
+	// Timestamp of when the request was resolved
+	ResolvedAt *time.Time `gorm:"type:datetime;default:null" json:"resolved_at"`
+	// Timestamp of when the request was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// ApprovalDecision is the answer of a member to an ApprovalRequest
+// @Description Approval decision model
+type ApprovalDecision struct {
+	// Unique identifier for the ApprovalDecision
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the ApprovalRequest
+	ApprovalRequestID snowflake.ID `gorm:"type:bigint;not null;uniqueIndex:idx_approval_decisions_member,priority:1" json:"approval_request_id"`
+	// ID of the member who decided
+	AiboID uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_approval_decisions_member,priority:2" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Answer of the member (approve or reject)
+	Decision ApprovalDecisionKind `gorm:"type:varchar(16);not null" json:"decision" enums:"approve,reject"`
+	// Free text comment
+	Comment string `gorm:"type:varchar(255)" json:"comment"`
+	// Timestamp of the decision
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
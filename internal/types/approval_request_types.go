@@ -0,0 +1,74 @@
+package types
+
+import "github.com/bwmarrin/snowflake"
+
+// CreateApprovalRuleRequest represents the request to create an approval rule for a Household
+// @Description Create approval rule request structure
+type CreateApprovalRuleRequest struct {
+	// ID of a CatBud of the household; the rule then applies to it and its subcategories only.
+	// Leave empty to apply the rule to every CatBud of the household
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Expenses over this amount need approval
+	// @example 200.00
+	Threshold *Money `json:"threshold" binding:"required" swaggertype:"string"`
+	// Number of members who must approve, defaults to 1
+	// @example 1
+	RequiredApprovals int `json:"required_approvals" binding:"omitempty,min=1"`
+}
+
+// UpdateApprovalRuleRequest represents the request to change an approval rule
+// @Description Update approval rule request structure
+type UpdateApprovalRuleRequest struct {
+	// ID of the CatBud the rule applies to
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Apply the rule to every CatBud of the household again
+	AllCatBuds bool `json:"all_cat_buds"`
+	// New threshold
+	Threshold *Money `json:"threshold" swaggertype:"string"`
+	// New number of members who must approve
+	RequiredApprovals *int `json:"required_approvals" binding:"omitempty,min=1"`
+}
+
+// ApprovalRuleResponse represents the response containing a single approval rule
+// @Description Single approval rule response structure
+type ApprovalRuleResponse struct {
+	// The approval rule
+	Rule ApprovalRule `json:"rule"`
+}
+
+// ListApprovalRulesResponse represents the response containing the approval rules of a Household
+// @Description List approval rules response structure
+type ListApprovalRulesResponse struct {
+	// Approval rules, oldest first
+	Rules []ApprovalRule `json:"rules"`
+}
+
+// ListApprovalRequestsRequest represents the query parameters to list the approval requests of a
+// Household
+// @Description List approval requests query structure
+type ListApprovalRequestsRequest struct {
+	// Only list the requests with this status (pending, approved, rejected or cancelled)
+	Status ApprovalStatus `form:"status" binding:"omitempty,oneof=pending approved rejected cancelled"`
+}
+
+// DecideApprovalRequest represents the request to approve or reject an approval request
+// @Description Approval decision request structure
+type DecideApprovalRequest struct {
+	// Optional comment for the other members
+	// @example Fine, the old one is broken
+	Comment string `json:"comment" binding:"max=255"`
+}
+
+// ApprovalRequestResponse represents the response containing a single approval request
+// @Description Single approval request response structure
+type ApprovalRequestResponse struct {
+	// The approval request with its decisions and its transaction
+	Request ApprovalRequest `json:"request"`
+}
+
+// ListApprovalRequestsResponse represents the response containing multiple approval requests
+// @Description List approval requests response structure
+type ListApprovalRequestsResponse struct {
+	// Approval requests with their decisions and their transactions
+	Requests []ApprovalRequest `json:"requests"`
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+func TestApprovalRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ApprovalRule
+		wantErr bool
+	}{
+		{"valid", ApprovalRule{Threshold: 10000, RequiredApprovals: 1}, false},
+		{"zero threshold", ApprovalRule{Threshold: 0, RequiredApprovals: 2}, false},
+		{"negative threshold", ApprovalRule{Threshold: -1, RequiredApprovals: 1}, true},
+		{"no approval", ApprovalRule{Threshold: 10000, RequiredApprovals: 0}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTriggeredApprovalRule(t *testing.T) {
+	// 1 Home > 2 Furniture > 3 Kitchen, and 4 Leisure.
+	parents := map[snowflake.ID]*snowflake.ID{1: nil, 2: idPtr(1), 3: idPtr(2), 4: nil}
+	household := ApprovalRule{ID: 10, Threshold: 50000, RequiredApprovals: 1}
+	home := ApprovalRule{ID: 11, CatBudID: idPtr(1), Threshold: 20000, RequiredApprovals: 2}
+	leisure := ApprovalRule{ID: 12, CatBudID: idPtr(4), Threshold: 5000, RequiredApprovals: 1}
+
+	tests := []struct {
+		name       string
+		rules      []ApprovalRule
+		shares     map[snowflake.ID]Money
+		wantRule   snowflake.ID
+		wantAmount Money
+	}{
+		{"no rule", nil, map[snowflake.ID]Money{1: 100000}, 0, 0},
+		{"under every threshold", []ApprovalRule{household, home, leisure}, map[snowflake.ID]Money{3: 20000}, 0, 0},
+		{"threshold is not enough", []ApprovalRule{leisure}, map[snowflake.ID]Money{4: 5000}, 0, 0},
+		{"subcategory", []ApprovalRule{household, home}, map[snowflake.ID]Money{3: 20001}, 11, 20001},
+		{"shares add up", []ApprovalRule{home}, map[snowflake.ID]Money{2: 15000, 3: 10000}, 11, 25000},
+		{"other branch", []ApprovalRule{home}, map[snowflake.ID]Money{4: 90000}, 0, 0},
+		{"every CatBud", []ApprovalRule{household}, map[snowflake.ID]Money{3: 30000, 4: 30000}, 10, 60000},
+		{"most demanding wins", []ApprovalRule{household, home, leisure}, map[snowflake.ID]Money{3: 30000, 4: 30000}, 11, 30000},
+		{"first on a tie", []ApprovalRule{leisure, household}, map[snowflake.ID]Money{4: 60000}, 12, 60000},
+		{"unknown CatBud", []ApprovalRule{home}, map[snowflake.ID]Money{99: 90000}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, amount := TriggeredApprovalRule(tt.rules, parents, tt.shares)
+			var gotRule snowflake.ID
+			if rule != nil {
+				gotRule = rule.ID
+			}
+			if gotRule != tt.wantRule || amount != tt.wantAmount {
+				t.Fatalf("TriggeredApprovalRule = %d, %v, want %d, %v", gotRule, amount, tt.wantRule, tt.wantAmount)
+			}
+		})
+	}
+
+	looping := map[snowflake.ID]*snowflake.ID{1: idPtr(2), 2: idPtr(1)}
+	if rule, _ := TriggeredApprovalRule([]ApprovalRule{leisure}, looping, map[snowflake.ID]Money{1: 90000}); rule != nil {
+		t.Fatalf("TriggeredApprovalRule on looping categories = %+v, want nil", rule)
+	}
+}
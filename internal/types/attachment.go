@@ -0,0 +1,84 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// AttachmentLimits are the sizes of the files an Aibo can attach, which depend on its plan.
+type AttachmentLimits struct {
+	// Largest file, in bytes
+	MaxFileSize int64 `json:"max_file_size"`
+	// Largest total of the files of the Aibo, in bytes
+	MaxTotalSize int64 `json:"max_total_size"`
+}
+
+var (
+	// FreeAttachmentLimits are the limits of the free plan: 5 MB per file, 100 MB in all.
+	FreeAttachmentLimits = AttachmentLimits{MaxFileSize: 5 << 20, MaxTotalSize: 100 << 20}
+	// PremiumAttachmentLimits are the limits of the premium plan: 25 MB per file, 5 GB in all.
+	PremiumAttachmentLimits = AttachmentLimits{MaxFileSize: 25 << 20, MaxTotalSize: 5 << 30}
+)
+
+// AttachmentLimitsFor returns the limits of the plan of the Aibo.
+func AttachmentLimitsFor(aibo *Aibo) AttachmentLimits {
+	if aibo.IsPremium {
+		return PremiumAttachmentLimits
+	}
+	return FreeAttachmentLimits
+}
+
+// Attachment is a file, such as the photo of a receipt or a warranty, attached to a Transaction or
+// to a CatBud. The file and its thumbnail are kept in the storage of the application; they are
+// downloaded through signed URLs valid for a limited time.
+//
+// An attachment whose Transaction or CatBud is deleted loses it, and its files are removed from
+// the storage in the background
+// @Description File attached to a transaction or a CatBud
+type Attachment struct {
+	// Unique identifier for the Attachment
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo that uploaded the file, whose storage it counts in
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// ID of the Transaction the file is attached to (can be null)
+	TransactionID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"transaction_id" swaggertype:"integer"`
+	// ID of the CatBud the file is attached to (can be null)
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"cat_bud_id" swaggertype:"integer"`
+	// Name of the file when it was uploaded
+	// @example receipt.jpg
+	FileName string `gorm:"type:varchar(255);not null" json:"file_name"`
+	// Content type found from the bytes of the file
+	// @example image/jpeg
+	ContentType string `gorm:"type:varchar(100);not null" json:"content_type"`
+	// Size of the file, in bytes
+	// @example 482133
+	Size int64 `gorm:"not null" json:"size"`
+	// SHA-256 checksum of the file, in hexadecimal
+	Checksum string `gorm:"type:char(64);not null" json:"checksum"`
+	// Key of the file in the storage
+	StorageKey string `gorm:"type:varchar(255);not null" json:"-"`
+	// Whether a thumbnail of the image can be downloaded
+	HasThumbnail bool `gorm:"not null" json:"has_thumbnail"`
+	// Size of the thumbnail, in bytes, 0 without one
+	ThumbnailSize int64 `gorm:"not null;default:0" json:"thumbnail_size"`
+	// Timestamp of when the file was uploaded
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// StoredSize returns the bytes the file and its thumbnail take in the storage, which count in the
+// storage of the plan of the Aibo.
+func (a *Attachment) StoredSize() int64 {
+	return a.Size + a.ThumbnailSize
+}
+
+// ThumbnailKey returns the key of the thumbnail in the storage, next to the file, or an empty
+// string when the file has none.
+func (a *Attachment) ThumbnailKey() string {
+	if !a.HasThumbnail {
+		return ""
+	}
+	return a.StorageKey + "-thumbnail.jpg"
+}
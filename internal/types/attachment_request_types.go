@@ -0,0 +1,69 @@
+package types
+
+import "time"
+
+// UploadAttachmentRequest represents the form fields of a file attached to a transaction or a
+// CatBud, uploaded along with them in the "file" field. Exactly one of the IDs is given.
+// @Description Upload attachment request structure
+type UploadAttachmentRequest struct {
+	// ID of the Transaction to attach the file to
+	// @example 1234567890123456
+	TransactionID string `form:"transaction_id"`
+	// ID of the CatBud to attach the file to
+	// @example 1234567890123456
+	CatBudID string `form:"cat_bud_id"`
+}
+
+// ListAttachmentsRequest represents the query parameters of the files attached to a transaction
+// or a CatBud. Exactly one of the IDs is given.
+// @Description List attachments request structure
+type ListAttachmentsRequest struct {
+	// ID of the Transaction
+	// @example 1234567890123456
+	TransactionID string `form:"transaction_id"`
+	// ID of the CatBud
+	// @example 1234567890123456
+	CatBudID string `form:"cat_bud_id"`
+}
+
+// AttachmentURLRequest represents the query parameters of a signed download URL
+// @Description Attachment download URL request structure
+type AttachmentURLRequest struct {
+	// Link the thumbnail of the image rather than the file
+	// @example false
+	Thumbnail bool `form:"thumbnail"`
+	// Let the browser show the file rather than save it
+	// @example true
+	Inline bool `form:"inline"`
+	// Validity of the URL in seconds, from 60 to 86400, defaults to 900
+	// @example 900
+	ExpiresIn int `form:"expires_in" binding:"omitempty,min=60,max=86400"`
+}
+
+// AttachmentResponse represents the response containing a single attachment
+// @Description Single attachment response structure
+type AttachmentResponse struct {
+	// The attachment
+	Attachment Attachment `json:"attachment"`
+}
+
+// ListAttachmentsResponse represents the response containing the files attached to a transaction
+// or a CatBud, with the storage used by the aibo that made the request
+// @Description List attachments response structure
+type ListAttachmentsResponse struct {
+	// Attachments, the most recent first
+	Attachments []Attachment `json:"attachments"`
+	// Total size of the files uploaded by the aibo and of their thumbnails, in bytes
+	Used int64 `json:"used"`
+	// Limits of the plan of the aibo
+	Limits AttachmentLimits `json:"limits"`
+}
+
+// AttachmentURLResponse represents a signed URL downloading an attachment without authentication
+// @Description Attachment download URL response structure
+type AttachmentURLResponse struct {
+	// The URL
+	URL string `json:"url"`
+	// Instant the URL stops working
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -19,6 +19,19 @@ type RegisterRequest struct {
 	// User's last name
 	// @example Doe
 	LastName string `json:"last_name" binding:"required"`
+	// User's IANA timezone, defaults to UTC
+	// @example Europe/Paris
+	Timezone string `json:"timezone"`
+	// ISO 4217 currency budgets are expressed in, with two decimals, defaults to EUR
+	// @example EUR
+	BaseCurrency Currency `json:"base_currency"`
+	// Budget template to create the first categories from (optional)
+	// @example student
+	Template string `json:"template"`
+	// Monthly income the budgets of the template are scaled to, defaults to the reference income
+	// of the template
+	// @example 1500.00
+	MonthlyIncome *Money `json:"monthly_income" binding:"omitempty,gt=0" swaggertype:"string"`
 }
 
 // LoginRequest represents the structure of the login request
@@ -44,6 +57,18 @@ type UpdateProfileRequest struct {
 	// User's new birth date (format: YYYY-MM-DD)
 	// @example 1990-01-01
 	BirthDate string `json:"birth_date"`
+	// User's new daily budget
+	// @example 50.00
+	DailyBudget *Money `json:"daily_budget" binding:"omitempty,gte=0" swaggertype:"string"`
+	// User's new IANA timezone
+	// @example Europe/Paris
+	Timezone string `json:"timezone"`
+	// User's new rollover policy (carry_all, carry_surplus, carry_deficit or reset)
+	// @example carry_all
+	RolloverPolicy RolloverPolicy `json:"rollover_policy"`
+	// User's new base currency (ISO 4217, with two decimals); transactions are converted, budgets keep their values
+	// @example USD
+	BaseCurrency Currency `json:"base_currency"`
 }
 
 // UpdatePasswordRequest represents the structure of the update password request
@@ -107,10 +132,10 @@ type UserResponse struct {
 	IsPremium bool `json:"is_premium"`
 	// User's daily budget
 	// @example 100.00
-	DailyBudget float64 `json:"daily_budget"`
+	DailyBudget Money `json:"daily_budget" swaggertype:"string"`
 	// Current delta from the daily budget
 	// @example -20.50
-	CurrentDelta float64 `json:"current_delta"`
+	CurrentDelta Money `json:"current_delta" swaggertype:"string"`
 	// Timestamp of when the user was created
 	// @example 2023-01-01T00:00:00Z
 	CreatedAt time.Time `json:"created_at"`
@@ -0,0 +1,170 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+// BudgetPeriod is the recurrence of a CatBud budget.
+type BudgetPeriod string
+
+const (
+	PeriodDaily     BudgetPeriod = "daily"
+	PeriodWeekly    BudgetPeriod = "weekly"
+	PeriodBiweekly  BudgetPeriod = "biweekly"
+	PeriodMonthly   BudgetPeriod = "monthly"
+	PeriodQuarterly BudgetPeriod = "quarterly"
+	PeriodYearly    BudgetPeriod = "yearly"
+	// PeriodCustom is a single range going from the anchor to the custom end, both included.
+	PeriodCustom BudgetPeriod = "custom"
+)
+
+// defaultPeriodAnchor is used when a CatBud has no anchor: periods are then aligned on
+// the calendar (Mondays for weeks, the 1st for months, January 1st for quarters and years).
+var defaultPeriodAnchor = time.Date(1970, time.January, 5, 0, 0, 0, 0, time.UTC) // a Monday
+
+// IsValid reports whether the period is one of the known budget periods.
+func (p BudgetPeriod) IsValid() bool {
+	switch p {
+	case PeriodDaily, PeriodWeekly, PeriodBiweekly, PeriodMonthly, PeriodQuarterly, PeriodYearly, PeriodCustom:
+		return true
+	}
+	return false
+}
+
+// Bounds returns the first and last day (both included) of the period that contains day.
+//
+// Day-based periods step from the anchor, month-based periods keep the anchor's day of month,
+// clamped to the last day of shorter months. A nil anchor aligns periods on the calendar.
+// For PeriodCustom, the range is always [anchor, customEnd], whatever the day.
+func (p BudgetPeriod) Bounds(anchor, customEnd *time.Time, day time.Time) (time.Time, time.Time) {
+	day = truncateDay(day)
+
+	a := defaultPeriodAnchor
+	if anchor != nil {
+		a = truncateDay(*anchor)
+	} else if p != PeriodWeekly && p != PeriodBiweekly {
+		a = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	switch p {
+	case PeriodDaily:
+		return day, day
+	case PeriodWeekly:
+		return dayStepBounds(a, day, 7)
+	case PeriodBiweekly:
+		return dayStepBounds(a, day, 14)
+	case PeriodQuarterly:
+		return monthStepBounds(a, day, 3)
+	case PeriodYearly:
+		return monthStepBounds(a, day, 12)
+	case PeriodCustom:
+		end := a
+		if customEnd != nil {
+			end = truncateDay(*customEnd)
+		}
+		return a, end
+	default:
+		return monthStepBounds(a, day, 1)
+	}
+}
+
+// PeriodDays returns the number of days between start and end, both included.
+func PeriodDays(start, end time.Time) int {
+	return int(truncateDay(end).Sub(truncateDay(start)).Hours()/24) + 1
+}
+
+// ValidatePeriod checks that the period settings of the CatBud are consistent.
+func (cb *CatBud) ValidatePeriod() error {
+	if cb.Period == "" {
+		cb.Period = PeriodMonthly
+	}
+	if !cb.Period.IsValid() {
+		return errors.New("period must be one of daily, weekly, biweekly, monthly, quarterly, yearly or custom")
+	}
+	if cb.Period == PeriodCustom {
+		if cb.PeriodAnchor == nil || cb.CustomEnd == nil {
+			return errors.New("a custom period requires both period_anchor and custom_end")
+		}
+		if cb.CustomEnd.Before(*cb.PeriodAnchor) {
+			return errors.New("custom_end must not be before period_anchor")
+		}
+	}
+	return nil
+}
+
+// CurrentBounds returns the bounds of the CatBud period containing day.
+func (cb *CatBud) CurrentBounds(day time.Time) (time.Time, time.Time) {
+	return cb.Period.Bounds(cb.PeriodAnchor, cb.CustomEnd, day)
+}
+
+// PeriodOver reports whether the stored period of the CatBud ended before day, so that it must be
+// closed. A custom period is never closed.
+func (cb *CatBud) PeriodOver(day time.Time) bool {
+	return cb.Period != PeriodCustom && cb.PeriodStart != nil && cb.PeriodEnd != nil && cb.PeriodEnd.Before(day)
+}
+
+// PeriodAfter returns the bounds of the period following the one that ended on end.
+//
+// The period settings may have changed since that period was computed, so the next period never
+// starts before the day after end.
+func (cb *CatBud) PeriodAfter(end time.Time) (time.Time, time.Time) {
+	next := end.AddDate(0, 0, 1)
+	start, last := cb.CurrentBounds(next)
+	if start.Before(next) {
+		start = next
+	}
+	return start, last
+}
+
+// AllowanceOver returns the share of the budget of the CatBud available per day over the period
+// going from start to end, or nil when the CatBud has no budget.
+func (cb *CatBud) AllowanceOver(start, end time.Time) *Money {
+	if cb.Budget == nil {
+		return nil
+	}
+	allowance := cb.Budget.Div(int64(PeriodDays(start, end)))
+	return &allowance
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func dayStepBounds(anchor, day time.Time, step int) (time.Time, time.Time) {
+	diff := int(day.Sub(anchor).Hours() / 24)
+	start := anchor.AddDate(0, 0, floorDiv(diff, step)*step)
+	return start, start.AddDate(0, 0, step-1)
+}
+
+// addMonthsClamped adds n months to the anchor, clamping its day of month to the
+// length of the target month (Jan 31 + 1 month is Feb 28 or 29).
+func addMonthsClamped(anchor time.Time, n int) time.Time {
+	first := time.Date(anchor.Year(), anchor.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	d := anchor.Day()
+	if d > lastDay {
+		d = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, time.UTC)
+}
+
+func monthStepBounds(anchor, day time.Time, step int) (time.Time, time.Time) {
+	months := (day.Year()-anchor.Year())*12 + int(day.Month()) - int(anchor.Month())
+	k := floorDiv(months, step) * step
+	start := addMonthsClamped(anchor, k)
+	if start.After(day) {
+		k -= step
+		start = addMonthsClamped(anchor, k)
+	}
+	return start, addMonthsClamped(anchor, k+step).AddDate(0, 0, -1)
+}
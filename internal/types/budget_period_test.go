@@ -0,0 +1,159 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func datePtr(year int, month time.Month, day int) *time.Time {
+	d := date(year, month, day)
+	return &d
+}
+
+func TestBudgetPeriodBounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		period    BudgetPeriod
+		anchor    *time.Time
+		customEnd *time.Time
+		day       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"daily", PeriodDaily, nil, nil, time.Date(2024, 5, 15, 18, 45, 0, 0, time.UTC), date(2024, 5, 15), date(2024, 5, 15)},
+		{"weekly on mondays", PeriodWeekly, nil, nil, date(2024, 5, 15), date(2024, 5, 13), date(2024, 5, 19)},
+		{"weekly from a friday", PeriodWeekly, datePtr(2024, 5, 3), nil, date(2024, 5, 15), date(2024, 5, 10), date(2024, 5, 16)},
+		{"weekly before the anchor", PeriodWeekly, datePtr(2024, 5, 3), nil, date(2024, 4, 30), date(2024, 4, 26), date(2024, 5, 2)},
+		{"biweekly", PeriodBiweekly, datePtr(2024, 1, 5), nil, date(2024, 1, 20), date(2024, 1, 19), date(2024, 2, 1)},
+		{"calendar month", PeriodMonthly, nil, nil, date(2024, 2, 10), date(2024, 2, 1), date(2024, 2, 29)},
+		{"payday month", PeriodMonthly, datePtr(2024, 1, 25), nil, date(2024, 3, 10), date(2024, 2, 25), date(2024, 3, 24)},
+		{"clamped to february", PeriodMonthly, datePtr(2024, 1, 31), nil, date(2024, 2, 29), date(2024, 2, 29), date(2024, 3, 30)},
+		{"clamped in a common year", PeriodMonthly, datePtr(2023, 1, 31), nil, date(2023, 3, 1), date(2023, 2, 28), date(2023, 3, 30)},
+		{"before the clamped start", PeriodMonthly, datePtr(2024, 1, 31), nil, date(2024, 2, 28), date(2024, 1, 31), date(2024, 2, 28)},
+		{"calendar quarter", PeriodQuarterly, nil, nil, date(2024, 5, 15), date(2024, 4, 1), date(2024, 6, 30)},
+		{"fiscal quarter", PeriodQuarterly, datePtr(2023, 2, 15), nil, date(2024, 5, 14), date(2024, 2, 15), date(2024, 5, 14)},
+		{"calendar year", PeriodYearly, nil, nil, date(2024, 5, 15), date(2024, 1, 1), date(2024, 12, 31)},
+		{"fiscal year", PeriodYearly, datePtr(2020, 4, 6), nil, date(2024, 1, 10), date(2023, 4, 6), date(2024, 4, 5)},
+		{"custom", PeriodCustom, datePtr(2024, 6, 1), datePtr(2024, 8, 31), date(2025, 1, 1), date(2024, 6, 1), date(2024, 8, 31)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.period.Bounds(tt.anchor, tt.customEnd, tt.day)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Fatalf("Bounds = %s..%s, want %s..%s", start.Format(time.DateOnly), end.Format(time.DateOnly),
+					tt.wantStart.Format(time.DateOnly), tt.wantEnd.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestPeriodDays(t *testing.T) {
+	tests := []struct {
+		start, end time.Time
+		want       int
+	}{
+		{date(2024, 5, 15), date(2024, 5, 15), 1},
+		{date(2024, 2, 1), date(2024, 2, 29), 29},
+		{date(2024, 1, 1), date(2024, 12, 31), 366},
+		{date(2024, 3, 25), time.Date(2024, 4, 1, 23, 0, 0, 0, time.UTC), 8},
+	}
+	for _, tt := range tests {
+		if got := PeriodDays(tt.start, tt.end); got != tt.want {
+			t.Errorf("PeriodDays(%v, %v) = %d, want %d", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestCatBudValidatePeriod(t *testing.T) {
+	tests := []struct {
+		name       string
+		catBud     CatBud
+		wantPeriod BudgetPeriod
+		wantErr    bool
+	}{
+		{"defaults to monthly", CatBud{}, PeriodMonthly, false},
+		{"weekly", CatBud{Period: PeriodWeekly}, PeriodWeekly, false},
+		{"unknown", CatBud{Period: "fortnightly"}, "fortnightly", true},
+		{"custom without end", CatBud{Period: PeriodCustom, PeriodAnchor: datePtr(2024, 1, 1)}, PeriodCustom, true},
+		{"custom ending before its start", CatBud{Period: PeriodCustom, PeriodAnchor: datePtr(2024, 2, 1), CustomEnd: datePtr(2024, 1, 1)}, PeriodCustom, true},
+		{"custom", CatBud{Period: PeriodCustom, PeriodAnchor: datePtr(2024, 1, 1), CustomEnd: datePtr(2024, 1, 1)}, PeriodCustom, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.catBud.ValidatePeriod()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidatePeriod = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.catBud.Period != tt.wantPeriod {
+				t.Fatalf("Period = %q, want %q", tt.catBud.Period, tt.wantPeriod)
+			}
+		})
+	}
+}
+
+func TestCatBudPeriodOver(t *testing.T) {
+	tests := []struct {
+		name   string
+		catBud CatBud
+		day    time.Time
+		want   bool
+	}{
+		{"ended the day before", CatBud{Period: PeriodMonthly, PeriodStart: datePtr(2024, 5, 1), PeriodEnd: datePtr(2024, 5, 31)}, date(2024, 6, 1), true},
+		{"last day", CatBud{Period: PeriodMonthly, PeriodStart: datePtr(2024, 5, 1), PeriodEnd: datePtr(2024, 5, 31)}, date(2024, 5, 31), false},
+		{"never computed", CatBud{Period: PeriodMonthly}, date(2024, 6, 1), false},
+		{"custom", CatBud{Period: PeriodCustom, PeriodStart: datePtr(2024, 5, 1), PeriodEnd: datePtr(2024, 5, 31)}, date(2024, 6, 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.catBud.PeriodOver(tt.day); got != tt.want {
+				t.Fatalf("PeriodOver(%v) = %v, want %v", tt.day, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatBudPeriodAfter(t *testing.T) {
+	tests := []struct {
+		name      string
+		catBud    CatBud
+		end       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"monthly", CatBud{Period: PeriodMonthly}, date(2024, 1, 31), date(2024, 2, 1), date(2024, 2, 29)},
+		{"monthly from the 15th", CatBud{Period: PeriodMonthly, PeriodAnchor: datePtr(2023, 11, 15)}, date(2024, 1, 14), date(2024, 1, 15), date(2024, 2, 14)},
+		{"switched to weekly mid-week", CatBud{Period: PeriodWeekly}, date(2024, 5, 15), date(2024, 5, 16), date(2024, 5, 19)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.catBud.PeriodAfter(tt.end)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Fatalf("PeriodAfter(%v) = %v, %v, want %v, %v", tt.end, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestCatBudAllowanceOver(t *testing.T) {
+	tests := []struct {
+		budget     *Money
+		start, end time.Time
+		want       *Money
+	}{
+		{moneyPtr(31000), date(2024, 5, 1), date(2024, 5, 31), moneyPtr(1000)},
+		{moneyPtr(10000), date(2024, 5, 1), date(2024, 5, 3), moneyPtr(3333)},
+		{moneyPtr(0), date(2024, 5, 1), date(2024, 5, 31), moneyPtr(0)},
+		{nil, date(2024, 5, 1), date(2024, 5, 31), nil},
+	}
+	for _, tt := range tests {
+		cb := CatBud{Budget: tt.budget}
+		got := cb.AllowanceOver(tt.start, tt.end)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("AllowanceOver(%v, %v) with budget %v = %v, want %v", tt.start, tt.end, tt.budget, got, tt.want)
+		}
+	}
+}
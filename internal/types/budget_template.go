@@ -0,0 +1,103 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BudgetTemplate is a ready-made set of categories and budgets an Aibo can start from
+// @Description Budget template
+type BudgetTemplate struct {
+	// Identifier of the template, shared by all its versions
+	ID string `json:"id" example:"student"`
+	// Version of the template, increased on every change of its data file
+	Version int `json:"version" example:"1"`
+	// Display name
+	Name string `json:"name" example:"Student"`
+	// Who the template is meant for
+	Description string `json:"description"`
+	// Monthly income the budgets of the template are sized for
+	ReferenceIncome Money `json:"reference_income" swaggertype:"string" example:"1200.00"`
+	// Top-level categories of the template
+	Categories []TemplateCategory `json:"categories"`
+}
+
+// TemplateCategory is a category of a BudgetTemplate, with its subcategories
+// @Description Budget template category
+type TemplateCategory struct {
+	// Name of the category
+	Category string `json:"category" example:"Food"`
+	// Budget of the category per period (optional)
+	Budget *Money `json:"budget,omitempty" swaggertype:"string" example:"250.00"`
+	// Recurrence of the budget, defaults to monthly
+	Period BudgetPeriod `json:"period,omitempty" example:"monthly"`
+	// Envelope rule of the category, defaults to reset
+	RolloverRule EnvelopeRule `json:"rollover_rule,omitempty" example:"reset"`
+	// Subcategories
+	Children []TemplateCategory `json:"children,omitempty"`
+}
+
+// Validate checks that the template is well-formed.
+func (t *BudgetTemplate) Validate() error {
+	if t.ID == "" || t.Name == "" {
+		return errors.New("id and name are required")
+	}
+	if t.Version < 1 {
+		return errors.New("version must be at least 1")
+	}
+	if t.ReferenceIncome <= 0 {
+		return errors.New("reference_income must be positive")
+	}
+	if len(t.Categories) == 0 {
+		return errors.New("at least one category is required")
+	}
+	return validateTemplateCategories(t.Categories)
+}
+
+func validateTemplateCategories(categories []TemplateCategory) error {
+	seen := map[string]bool{}
+	for _, category := range categories {
+		if category.Category == "" {
+			return errors.New("category names are required")
+		}
+		if seen[category.Category] {
+			return fmt.Errorf("duplicate category %q", category.Category)
+		}
+		seen[category.Category] = true
+
+		if category.Budget != nil && *category.Budget < 0 {
+			return fmt.Errorf("budget of %q must not be negative", category.Category)
+		}
+		if category.Period == PeriodCustom || category.Period != "" && !category.Period.IsValid() {
+			return fmt.Errorf("period of %q must be a recurring period", category.Category)
+		}
+		if category.RolloverRule == EnvelopeCap || category.RolloverRule != "" && !category.RolloverRule.IsValid() {
+			return fmt.Errorf("rollover_rule of %q must be reset, carry_surplus or carry_all", category.Category)
+		}
+		if err := validateTemplateCategories(category.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScaledTo returns a copy of the template with every budget scaled to the given monthly income,
+// in proportion to the reference income of the template. Each budget is rounded to the cent.
+func (t BudgetTemplate) ScaledTo(income Money) BudgetTemplate {
+	t.Categories = scaleTemplateCategories(t.Categories, income, t.ReferenceIncome)
+	t.ReferenceIncome = income
+	return t
+}
+
+func scaleTemplateCategories(categories []TemplateCategory, income, reference Money) []TemplateCategory {
+	scaled := make([]TemplateCategory, len(categories))
+	for i, category := range categories {
+		if category.Budget != nil {
+			budget := category.Budget.MulRatio(int64(income), int64(reference))
+			category.Budget = &budget
+		}
+		category.Children = scaleTemplateCategories(category.Children, income, reference)
+		scaled[i] = category
+	}
+	return scaled
+}
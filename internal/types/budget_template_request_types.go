@@ -0,0 +1,44 @@
+package types
+
+// GetBudgetTemplateRequest represents the query parameters to preview a budget template
+// @Description Budget template preview query structure
+type GetBudgetTemplateRequest struct {
+	// Version of the template, defaults to the latest
+	// @example 1
+	Version int `form:"version" binding:"omitempty,min=1"`
+	// Monthly income to scale the budgets to, defaults to the reference income of the template
+	// @example 1500.00
+	Income *Money `form:"income" binding:"omitempty,gt=0" swaggertype:"string"`
+}
+
+// ApplyBudgetTemplateRequest represents the request to apply a budget template to the current Aibo
+// @Description Apply budget template request structure
+type ApplyBudgetTemplateRequest struct {
+	// Identifier of the template
+	// @example family
+	Template string `json:"template" binding:"required"`
+	// Version of the template, defaults to the latest
+	// @example 1
+	Version int `json:"version" binding:"omitempty,min=1"`
+	// Monthly income to scale the budgets to, defaults to the reference income of the template
+	// @example 3800.00
+	MonthlyIncome *Money `json:"monthly_income" binding:"omitempty,gt=0" swaggertype:"string"`
+}
+
+// ListBudgetTemplatesResponse represents the response containing the available budget templates
+// @Description List budget templates response structure
+type ListBudgetTemplatesResponse struct {
+	// Latest version of every template
+	Templates []BudgetTemplate `json:"templates"`
+}
+
+// ApplyBudgetTemplateResponse represents the result of applying a budget template
+// @Description Apply budget template response structure
+type ApplyBudgetTemplateResponse struct {
+	// Template applied, with its budgets scaled to the monthly income
+	Template BudgetTemplate `json:"template"`
+	// Number of CatBuds created, categories that already existed are kept as is
+	Created int `json:"created"`
+	// Categories of the Aibo after the template was applied
+	CatBuds []CatBudNode `json:"cat_buds"`
+}
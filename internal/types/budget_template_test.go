@@ -0,0 +1,75 @@
+package types
+
+import "testing"
+
+func TestBudgetTemplateValidate(t *testing.T) {
+	valid := func() BudgetTemplate {
+		return BudgetTemplate{
+			ID: "student", Version: 1, Name: "Student", ReferenceIncome: 120000,
+			Categories: []TemplateCategory{
+				{Category: "Food", RolloverRule: EnvelopeCarrySurplus, Children: []TemplateCategory{
+					{Category: "Groceries", Budget: moneyPtr(20000)},
+				}},
+				{Category: "Transport", Budget: moneyPtr(5000), Period: PeriodWeekly},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		change  func(t *BudgetTemplate)
+		wantErr bool
+	}{
+		{"valid", func(t *BudgetTemplate) {}, false},
+		{"no id", func(t *BudgetTemplate) { t.ID = "" }, true},
+		{"version 0", func(t *BudgetTemplate) { t.Version = 0 }, true},
+		{"no income", func(t *BudgetTemplate) { t.ReferenceIncome = 0 }, true},
+		{"no category", func(t *BudgetTemplate) { t.Categories = nil }, true},
+		{"duplicate", func(t *BudgetTemplate) { t.Categories[1].Category = "Food" }, true},
+		{"same name in another parent", func(t *BudgetTemplate) { t.Categories[0].Children[0].Category = "Transport" }, false},
+		{"negative budget", func(t *BudgetTemplate) { t.Categories[0].Children[0].Budget = moneyPtr(-1) }, true},
+		{"custom period", func(t *BudgetTemplate) { t.Categories[1].Period = PeriodCustom }, true},
+		{"cap rule", func(t *BudgetTemplate) { t.Categories[0].RolloverRule = EnvelopeCap }, true},
+		{"unnamed child", func(t *BudgetTemplate) { t.Categories[0].Children[0].Category = "" }, true},
+	}
+	for _, tt := range tests {
+		template := valid()
+		tt.change(&template)
+		if err := template.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBudgetTemplateScaledTo(t *testing.T) {
+	template := BudgetTemplate{
+		ReferenceIncome: 120000,
+		Categories: []TemplateCategory{
+			{Category: "Food", Children: []TemplateCategory{{Category: "Groceries", Budget: moneyPtr(20000)}}},
+			{Category: "Rent", Budget: moneyPtr(45000)},
+			{Category: "Fun", Budget: moneyPtr(3333)},
+		},
+	}
+	tests := []struct {
+		income    Money
+		groceries Money
+		rent      Money
+		fun       Money
+	}{
+		{120000, 20000, 45000, 3333},
+		{180000, 30000, 67500, 5000},
+		{100000, 16667, 37500, 2778},
+	}
+	for _, tt := range tests {
+		scaled := template.ScaledTo(tt.income)
+		if scaled.ReferenceIncome != tt.income || scaled.Categories[0].Budget != nil {
+			t.Fatalf("scaled to %v: %+v", tt.income, scaled)
+		}
+		got := []Money{*scaled.Categories[0].Children[0].Budget, *scaled.Categories[1].Budget, *scaled.Categories[2].Budget}
+		if got[0] != tt.groceries || got[1] != tt.rent || got[2] != tt.fun {
+			t.Errorf("scaled to %v = %v, want %v %v %v", tt.income, got, tt.groceries, tt.rent, tt.fun)
+		}
+	}
+	if *template.Categories[1].Budget != 45000 || *template.Categories[0].Children[0].Budget != 20000 {
+		t.Fatal("scaling changed the original template")
+	}
+}
@@ -13,14 +13,47 @@ type CatBud struct {
 	// Unique identifier for the CatBud
 	// @exemple 1234567890123456
 	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
-	// ID of the Aibo this CatBud belongs to
+	// ID of the Aibo this CatBud belongs to, or whose budget days drive its periods for a CatBud
+	// of a Household
 	AiboID uuid.UUID `gorm:"type:char(36);not null;" json:"aibo_id" swaggertype:"string" format:"uuid"`
 	// Reference to the Aibo
 	Aibo Aibo `gorm:"foreignKey:AiboID" json:"-"`
+	// ID of the Household sharing this CatBud, null for a personal CatBud
+	HouseholdID *uuid.UUID `gorm:"type:char(36);default:null;index" json:"household_id" swaggertype:"string" format:"uuid"`
+	// ID of the parent CatBud, null for a top-level category
+	ParentID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"parent_id" swaggertype:"integer"`
 	// Name of the category
 	Category string `gorm:"type:varchar(255);not null;" json:"category"`
-	// Budget amount for the category (can be null)
-	Budget *float64 `gorm:"type:decimal(10,2);default:null" json:"budget" swaggertype:"number"`
+	// Budget amount for the category, in the base currency of the Aibo or in the currency of its
+	// Household (can be null)
+	Budget *Money `gorm:"type:decimal(10,2);default:null" json:"budget" swaggertype:"string"`
+	// Recurrence of the budget (daily, weekly, biweekly, monthly, quarterly, yearly or custom)
+	Period BudgetPeriod `gorm:"type:varchar(16);not null;default:'monthly'" json:"period" enums:"daily,weekly,biweekly,monthly,quarterly,yearly,custom"`
+	// Day the periods are aligned on (calendar-aligned when null, start of the range for custom)
+	PeriodAnchor *time.Time `gorm:"type:date;default:null" json:"period_anchor"`
+	// Last day of a custom period
+	CustomEnd *time.Time `gorm:"type:date;default:null" json:"custom_end"`
+	// First day of the current period, derived from the period settings
+	PeriodStart *time.Time `gorm:"type:date;default:null" json:"period_start"`
+	// Last day of the current period, derived from the period settings
+	PeriodEnd *time.Time `gorm:"type:date;default:null" json:"period_end"`
+	// Budget pro-rated per day of the current period (null when there is no budget)
+	DailyAllowance *Money `gorm:"type:decimal(10,2);default:null" json:"daily_allowance" swaggertype:"string"`
+	// What happens to the balance when a period closes (reset, carry_surplus, carry_all or cap)
+	RolloverRule EnvelopeRule `gorm:"type:varchar(16);not null;default:'reset'" json:"rollover_rule" enums:"reset,carry_surplus,carry_all,cap"`
+	// Maximum amount carried over with the cap rule
+	RolloverCap *Money `gorm:"type:decimal(10,2);default:null" json:"rollover_cap" swaggertype:"string"`
+	// Amount carried over from the previous periods into the current one
+	CarriedOver Money `gorm:"type:decimal(10,2);not null;default:0" json:"carried_over" swaggertype:"string"`
+	// Amount spent on the category during the current period, derived from the ledger (expenses minus incomes)
+	Spent Money `gorm:"type:decimal(10,2);not null;default:0" json:"spent" swaggertype:"string"`
+	// Expenses of the current period waiting for approval, not counted in spent and remaining yet
+	Pending Money `gorm:"type:decimal(10,2);not null;default:0" json:"pending" swaggertype:"string"`
+	// Amount left in the envelope for the current period (budget plus carried over minus spent), null when there is no budget
+	Remaining *Money `gorm:"type:decimal(10,2);default:null" json:"remaining" swaggertype:"string"`
+	// ID of the ImportBatch that created the CatBud from the category of another budgeting app
+	// (can be null)
+	ImportBatchID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"import_batch_id" swaggertype:"integer"`
 	// Timestamp of when the CatBud was created
 	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
 	// Timestamp of when the CatBud was last updated
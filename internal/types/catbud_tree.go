@@ -0,0 +1,85 @@
+package types
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// CategoryPathSeparator separates the category names of a CatBud path, as in "Food > Restaurants".
+const CategoryPathSeparator = " > "
+
+// CatBudNode is a CatBud with its subcategories and the amounts rolled up from them
+// @Description CatBud tree node
+type CatBudNode struct {
+	CatBud
+	// Category names from the top-level category down to this one, such as "Food > Restaurants"
+	Path string `json:"path"`
+	// Budget of the category plus the budgets of all its subcategories, null when none has a budget
+	RollupBudget *Money `json:"rollup_budget" swaggertype:"string"`
+	// Amount spent on the category plus the amounts spent on all its subcategories, each in its
+	// current period
+	RollupSpent Money `json:"rollup_spent" swaggertype:"string"`
+	// Expenses waiting for approval on the category plus the ones on all its subcategories
+	RollupPending Money `json:"rollup_pending" swaggertype:"string"`
+	// Subcategories
+	Children []CatBudNode `json:"children"`
+}
+
+// BuildCatBudTree arranges the CatBuds of an Aibo as a tree and rolls the budgets, spent and
+// pending amounts up to the parents.
+//
+// Siblings are sorted by category name. A CatBud whose parent is not in the list is treated as
+// a top-level category.
+func BuildCatBudTree(catBuds []CatBud) []CatBudNode {
+	known := make(map[snowflake.ID]bool, len(catBuds))
+	for _, cb := range catBuds {
+		known[cb.ID] = true
+	}
+
+	children := make(map[snowflake.ID][]CatBud)
+	var roots []CatBud
+	for _, cb := range catBuds {
+		if cb.ParentID != nil && known[*cb.ParentID] && *cb.ParentID != cb.ID {
+			children[*cb.ParentID] = append(children[*cb.ParentID], cb)
+		} else {
+			roots = append(roots, cb)
+		}
+	}
+
+	var build func(level []CatBud, parentPath string) []CatBudNode
+	build = func(level []CatBud, parentPath string) []CatBudNode {
+		sort.SliceStable(level, func(i, j int) bool {
+			return strings.ToLower(level[i].Category) < strings.ToLower(level[j].Category)
+		})
+
+		nodes := make([]CatBudNode, 0, len(level))
+		for _, cb := range level {
+			node := CatBudNode{CatBud: cb, Path: cb.Category, RollupSpent: cb.Spent, RollupPending: cb.Pending}
+			if parentPath != "" {
+				node.Path = parentPath + CategoryPathSeparator + cb.Category
+			}
+			if cb.Budget != nil {
+				budget := *cb.Budget
+				node.RollupBudget = &budget
+			}
+
+			node.Children = build(children[cb.ID], node.Path)
+			for _, child := range node.Children {
+				node.RollupSpent += child.RollupSpent
+				node.RollupPending += child.RollupPending
+				if child.RollupBudget != nil {
+					if node.RollupBudget == nil {
+						node.RollupBudget = new(Money)
+					}
+					*node.RollupBudget += *child.RollupBudget
+				}
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	return build(roots, "")
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+func idPtr(id snowflake.ID) *snowflake.ID {
+	return &id
+}
+
+func TestBuildCatBudTree(t *testing.T) {
+	catBuds := []CatBud{
+		{ID: 4, ParentID: idPtr(1), Category: "restaurants", Budget: moneyPtr(15000), Spent: 9000, Pending: 1000},
+		{ID: 1, Category: "Food", Budget: moneyPtr(20000), Spent: 5000},
+		{ID: 2, Category: "Housing", Spent: 95000},
+		{ID: 3, ParentID: idPtr(1), Category: "Groceries", Spent: 30000, Pending: 2500},
+		{ID: 5, ParentID: idPtr(3), Category: "Organic", Budget: moneyPtr(4000), Spent: 3500},
+		{ID: 6, ParentID: idPtr(99), Category: "Orphan", Spent: 100},
+		{ID: 7, ParentID: idPtr(7), Category: "Self", Spent: 200},
+	}
+	tree := BuildCatBudTree(catBuds)
+
+	type want struct {
+		path    string
+		budget  *Money
+		spent   Money
+		pending Money
+		kids    int
+	}
+	var got []want
+	var walk func(nodes []CatBudNode)
+	walk = func(nodes []CatBudNode) {
+		for _, node := range nodes {
+			got = append(got, want{node.Path, node.RollupBudget, node.RollupSpent, node.RollupPending, len(node.Children)})
+			walk(node.Children)
+		}
+	}
+	walk(tree)
+
+	expected := []want{
+		{"Food", moneyPtr(39000), 47500, 3500, 2},
+		{"Food > Groceries", moneyPtr(4000), 33500, 2500, 1},
+		{"Food > Groceries > Organic", moneyPtr(4000), 3500, 0, 0},
+		{"Food > restaurants", moneyPtr(15000), 9000, 1000, 0},
+		{"Housing", nil, 95000, 0, 0},
+		{"Orphan", nil, 100, 0, 0},
+		{"Self", nil, 200, 0, 0},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("tree has %d nodes, want %d: %+v", len(got), len(expected), got)
+	}
+	for i, w := range expected {
+		g := got[i]
+		if g.path != w.path || g.spent != w.spent || g.pending != w.pending || g.kids != w.kids ||
+			(g.budget == nil) != (w.budget == nil) || g.budget != nil && *g.budget != *w.budget {
+			t.Errorf("node %d = %+v (budget %v), want %+v (budget %v)", i, g, g.budget, w, w.budget)
+		}
+	}
+	if catBuds[1].Budget == nil || *catBuds[1].Budget != 20000 {
+		t.Error("the roll-up changed the budget of the CatBud")
+	}
+}
+
+func TestBuildCatBudTreeEmpty(t *testing.T) {
+	if tree := BuildCatBudTree(nil); len(tree) != 0 {
+		t.Fatalf("tree = %+v, want none", tree)
+	}
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/bwmarrin/snowflake"
 	"github.com/google/uuid"
 )
@@ -8,11 +10,63 @@ import (
 // CreateCatBudsRequest represents the request to create multiple CatBuds
 // @Description Create multiple CatBuds request structure
 type CreateCatBudsRequest struct {
-	// ID of the Aibo associated with these CatBuds
+	// ID of the Aibo associated with these CatBuds, defaults to the authenticated Aibo
 	// @example 123e4567-e89b-12d3-a456-426614174000
 	AiboID uuid.UUID `json:"aibo_id"`
+	// ID of the Household to share these CatBuds with (optional)
+	// @example 123e4567-e89b-12d3-a456-426614174001
+	HouseholdID *uuid.UUID `json:"household_id"`
 	// List of CatBuds to create
-	CatBuds []CatBud `json:"cat_buds"`
+	CatBuds []NewCatBud `json:"cat_buds"`
+}
+
+// NewCatBud represents a CatBud to create. The amounts derived from the ledger and the periods are
+// left out: they are computed once the CatBud is created.
+// @Description CatBud to create
+type NewCatBud struct {
+	// ID of the CatBud, generated when zero, so that the subcategories of a new CatBud can be
+	// created in the same request
+	// @example 1234567890123456
+	ID snowflake.ID `json:"id"`
+	// ID of the parent CatBud, null for a top-level category
+	// @example 1234567890123456
+	ParentID *snowflake.ID `json:"parent_id" swaggertype:"integer"`
+	// Name of the category
+	// @example Groceries
+	Category string `json:"category"`
+	// Budget amount for the category (can be null)
+	// @example 400.00
+	Budget *Money `json:"budget" swaggertype:"string"`
+	// Recurrence of the budget, defaults to monthly
+	// @example monthly
+	Period BudgetPeriod `json:"period" enums:"daily,weekly,biweekly,monthly,quarterly,yearly,custom"`
+	// Day the periods are aligned on (calendar-aligned when null, start of the range for custom)
+	PeriodAnchor *time.Time `json:"period_anchor"`
+	// Last day of a custom period
+	CustomEnd *time.Time `json:"custom_end"`
+	// What happens to the balance when a period closes, defaults to reset
+	// @example carry_surplus
+	RolloverRule EnvelopeRule `json:"rollover_rule" enums:"reset,carry_surplus,carry_all,cap"`
+	// Maximum amount carried over with the cap rule
+	// @example 100.00
+	RolloverCap *Money `json:"rollover_cap" swaggertype:"string"`
+}
+
+// CatBud returns the CatBud to create, of the given Aibo and Household.
+func (n *NewCatBud) CatBud(aiboID uuid.UUID, householdID *uuid.UUID) CatBud {
+	return CatBud{
+		ID:           n.ID,
+		AiboID:       aiboID,
+		HouseholdID:  householdID,
+		ParentID:     n.ParentID,
+		Category:     n.Category,
+		Budget:       n.Budget,
+		Period:       n.Period,
+		PeriodAnchor: n.PeriodAnchor,
+		CustomEnd:    n.CustomEnd,
+		RolloverRule: n.RolloverRule,
+		RolloverCap:  n.RolloverCap,
+	}
 }
 
 // UpdateCatBudRequest represents the request to update a CatBud
@@ -22,8 +76,29 @@ type UpdateCatBudRequest struct {
 	// @example 1234567890123456
 	ID snowflake.ID `json:"id"`
 	// Updated CatBud information
-	Category string   `json:"category"`
-	Budget   *float64 `json:"budget"`
+	Category string `json:"category"`
+	Budget   *Money `json:"budget" swaggertype:"string"`
+	// New recurrence of the budget
+	// @example weekly
+	Period BudgetPeriod `json:"period"`
+	// New day the periods are aligned on (format: YYYY-MM-DD)
+	// @example 2024-01-15
+	PeriodAnchor string `json:"period_anchor"`
+	// New last day of a custom period (format: YYYY-MM-DD)
+	// @example 2024-03-31
+	CustomEnd string `json:"custom_end"`
+	// New envelope rule applied when a period closes
+	// @example carry_surplus
+	RolloverRule EnvelopeRule `json:"rollover_rule"`
+	// New maximum amount carried over with the cap rule
+	// @example 100.00
+	RolloverCap *Money `json:"rollover_cap" swaggertype:"string"`
+	// New parent CatBud, moving the CatBud and its subcategories under it
+	// @example 1234567890123456
+	ParentID *snowflake.ID `json:"parent_id" swaggertype:"integer"`
+	// Set to true to move the CatBud to the top level
+	// @example false
+	MoveToRoot bool `json:"move_to_root"`
 }
 
 // DeleteCatBudRequest represents the request to delete a CatBud
@@ -45,8 +120,8 @@ type GetCatBudsRequest struct {
 // GetCatBudsResponse represents the response containing multiple CatBuds
 // @Description Get CatBuds response structure
 type GetCatBudsResponse struct {
-	// List of CatBuds
-	CatBuds []CatBud `json:"cat_buds"`
+	// Top-level CatBuds, each with its subcategories and rolled-up amounts
+	CatBuds []CatBudNode `json:"cat_buds"`
 }
 
 // GetCatBudResponse represents the response containing a single CatBud
@@ -78,3 +153,12 @@ type CreateCatBudsResponse struct {
 	// @example CatBuds successfully created
 	Message string `json:"message"`
 }
+
+// CatBudBalancesResponse represents the response containing the closed periods of a CatBud
+// @Description CatBud envelope history response structure
+type CatBudBalancesResponse struct {
+	// The CatBud, with its current envelope
+	CatBud CatBud `json:"cat_bud"`
+	// Closed periods, most recent first
+	Balances []CatBudPeriodBalance `json:"balances"`
+}
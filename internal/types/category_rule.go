@@ -0,0 +1,268 @@
+package types
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// MinCorrectionsForSuggestion is the number of transactions of a payee an Aibo has to move by
+// hand to the same CatBud before a CategoryRule is suggested for it.
+const MinCorrectionsForSuggestion = 2
+
+// CategoryRule books the transactions of an Aibo matching its conditions on a CatBud, and sets
+// their tags and note. The rules apply to the transactions recorded by hand and to the rows of the
+// bank statements imported, and can be applied again to the past transactions
+// @Description Auto-categorization rule model
+type CategoryRule struct {
+	// Unique identifier for the CategoryRule
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo the rule belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Name of the rule
+	Name string `gorm:"type:varchar(100);not null" json:"name"`
+	// Rules with a higher priority are applied first
+	Priority int `gorm:"not null;default:0" json:"priority"`
+	// Whether the rule applies
+	Enabled bool `gorm:"not null" json:"enabled"`
+	// Text the payee contains, without case
+	PayeeContains string `gorm:"type:varchar(255)" json:"payee_contains"`
+	// Regular expression the payee matches, in the RE2 syntax ((?i) for no case)
+	PayeePattern string `gorm:"type:varchar(255)" json:"payee_pattern"`
+	// Text the note (the memo of an imported row) contains, without case
+	NoteContains string `gorm:"type:varchar(255)" json:"note_contains"`
+	// Kind of the transactions matched, empty for both
+	Kind TransactionKind `gorm:"type:varchar(16)" json:"kind" enums:"expense,income"`
+	// Smallest amount matched, in the currency of the transaction
+	MinAmount *Money `gorm:"type:decimal(10,2);default:null" json:"min_amount" swaggertype:"string"`
+	// Largest amount matched, in the currency of the transaction
+	MaxAmount *Money `gorm:"type:decimal(10,2);default:null" json:"max_amount" swaggertype:"string"`
+	// ID of the ImportAccount whose imported transactions are matched
+	ImportAccountID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"import_account_id" swaggertype:"integer"`
+	// ID of the CatBud the matched transactions are booked on
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"cat_bud_id" swaggertype:"integer"`
+	// Tags added to the matched transactions
+	Tags Tags `gorm:"type:text" json:"tags" swaggertype:"array,string"`
+	// Note set on the matched transactions that have none
+	Note string `gorm:"type:varchar(255)" json:"note"`
+	// Timestamp of when the CategoryRule was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the CategoryRule was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate checks that the rule has a condition and something to set, and that its conditions
+// are consistent.
+func (r *CategoryRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.PayeeContains == "" && r.PayeePattern == "" && r.NoteContains == "" && r.Kind == "" &&
+		r.MinAmount == nil && r.MaxAmount == nil && r.ImportAccountID == nil {
+		return errors.New("a rule needs at least one condition")
+	}
+	if r.CatBudID == nil && len(r.Tags) == 0 && r.Note == "" {
+		return errors.New("a rule needs a cat_bud_id, tags or a note to set")
+	}
+	if r.PayeePattern != "" {
+		if _, err := regexp.Compile(r.PayeePattern); err != nil {
+			return errors.New("payee_pattern is not a valid regular expression")
+		}
+	}
+	if r.Kind != "" && !r.Kind.IsValid() {
+		return errors.New("kind must be either expense or income")
+	}
+	if r.MinAmount != nil && *r.MinAmount < 0 || r.MaxAmount != nil && *r.MaxAmount < 0 {
+		return errors.New("amounts must not be negative")
+	}
+	if r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount {
+		return errors.New("min_amount must not be above max_amount")
+	}
+	return nil
+}
+
+// CategoryCorrection records that an Aibo moved a transaction to another CatBud by hand. The
+// corrections are the source of the suggested rules, and keep the transactions corrected out of
+// the rules applied again
+// @Description Manual change of the CatBud of a transaction
+type CategoryCorrection struct {
+	// Unique identifier for the CategoryCorrection
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo that made the correction
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// ID of the corrected Transaction
+	TransactionID snowflake.ID `gorm:"type:bigint;not null;index" json:"transaction_id"`
+	// Payee of the Transaction when it was corrected
+	Payee string `gorm:"type:varchar(255)" json:"payee"`
+	// ID of the CatBud the Transaction was booked on before (can be null)
+	FromCatBudID *snowflake.ID `gorm:"type:bigint;default:null" json:"from_cat_bud_id" swaggertype:"integer"`
+	// ID of the CatBud the Transaction was moved to
+	ToCatBudID snowflake.ID `gorm:"type:bigint;not null" json:"to_cat_bud_id"`
+	// ID of the CategoryRule that had booked the Transaction, if any
+	CategoryRuleID *snowflake.ID `gorm:"type:bigint;default:null" json:"category_rule_id" swaggertype:"integer"`
+	// Timestamp of when the correction was made
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// CategoryRuleFields are what the rules set on a transaction
+// @Description CatBud, tags and note of a transaction
+type CategoryRuleFields struct {
+	// ID of the CatBud the transaction is booked on (can be null)
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Tags of the transaction
+	Tags Tags `json:"tags" swaggertype:"array,string"`
+	// Note of the transaction
+	Note string `json:"note"`
+}
+
+// CategoryRuleChange is the change the rules make to a past transaction
+// @Description Change made by the rules applied again to a transaction
+type CategoryRuleChange struct {
+	// ID of the Transaction
+	TransactionID snowflake.ID `json:"transaction_id"`
+	// Day of the Transaction
+	Date time.Time `json:"date"`
+	// Payee of the Transaction
+	Payee string `json:"payee"`
+	// Kind of the Transaction
+	Kind TransactionKind `json:"kind" enums:"expense,income"`
+	// Amount of the Transaction, in its currency
+	Amount Money `json:"amount" swaggertype:"string"`
+	// ISO 4217 currency of the amount
+	Currency Currency `json:"currency" swaggertype:"string"`
+	// ID of the rule booking the Transaction on its new CatBud, if it moves
+	CategoryRuleID *snowflake.ID `json:"category_rule_id" swaggertype:"integer"`
+	// Fields before the rules
+	Before CategoryRuleFields `json:"before"`
+	// Fields after the rules
+	After CategoryRuleFields `json:"after"`
+}
+
+// CategoryRuleSuggestion is a rule suggested from the corrections an Aibo made by hand
+// @Description Rule suggested from manual corrections
+type CategoryRuleSuggestion struct {
+	// Payee of the corrected transactions
+	Payee string `json:"payee"`
+	// ID of the CatBud they were moved to
+	CatBudID snowflake.ID `json:"cat_bud_id"`
+	// Name of the CatBud
+	Category string `json:"category"`
+	// Number of transactions of the payee moved to the CatBud
+	Corrections int `json:"corrections"`
+	// ID of the rule that had booked them elsewhere, if any: the suggested rule comes before it
+	ConflictingRuleID *snowflake.ID `json:"conflicting_rule_id" swaggertype:"integer"`
+	// The suggested rule, ready to be created
+	Rule CreateCategoryRuleRequest `json:"rule"`
+}
+
+// CategoryRuleTarget is what the rules read on a transaction, or on an imported row, besides the
+// fields they set.
+type CategoryRuleTarget struct {
+	// Who was paid, or who paid
+	Payee string
+	// Note of the transaction before the rules, the memo of an imported row
+	Note string
+	// Kind of the transaction
+	Kind TransactionKind
+	// Amount, in the currency of the transaction
+	Amount Money
+	// Whether the amount is split between several CatBuds, which keeps its CatBud out of the rules
+	Split bool
+	// ID of the ImportAccount the transaction was imported from (can be null)
+	ImportAccountID *snowflake.ID
+}
+
+// CategoryRuleSet applies a list of rules, compiled once.
+type CategoryRuleSet struct {
+	rules    []CategoryRule
+	patterns []*regexp.Regexp
+}
+
+// NewCategoryRuleSet compiles the enabled rules, in the given order. The rules are expected to be
+// sorted by priority, highest first.
+func NewCategoryRuleSet(rules []CategoryRule) *CategoryRuleSet {
+	set := &CategoryRuleSet{}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		var pattern *regexp.Regexp
+		if rule.PayeePattern != "" {
+			var err error
+			if pattern, err = regexp.Compile(rule.PayeePattern); err != nil {
+				continue
+			}
+		}
+		set.rules = append(set.rules, rule)
+		set.patterns = append(set.patterns, pattern)
+	}
+	return set
+}
+
+// Len returns the number of rules of the set.
+func (s *CategoryRuleSet) Len() int {
+	return len(s.rules)
+}
+
+// Apply applies the rules matching the target to its fields, highest priority first, and returns
+// the ID of the rule that booked it on its CatBud, if any.
+//
+// The first matching rule with a CatBud books the target on it, unless the target is split, or is
+// already booked on a CatBud and replace is not set. The first matching rule with a note sets it
+// when the target has none. Every matching rule adds its tags.
+func (s *CategoryRuleSet) Apply(target CategoryRuleTarget, fields *CategoryRuleFields, replace bool) *snowflake.ID {
+	var ruleID *snowflake.ID
+	setCatBud := !target.Split && (replace || fields.CatBudID == nil)
+	setNote := fields.Note == ""
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if !rule.matches(target, s.patterns[i]) {
+			continue
+		}
+		if setCatBud && rule.CatBudID != nil {
+			id, catBudID := rule.ID, *rule.CatBudID
+			fields.CatBudID, ruleID, setCatBud = &catBudID, &id, false
+		}
+		if setNote && rule.Note != "" {
+			fields.Note, setNote = rule.Note, false
+		}
+		if len(rule.Tags) > 0 {
+			fields.Tags = fields.Tags.Merge(rule.Tags)
+		}
+	}
+	return ruleID
+}
+
+// matches reports whether the target meets every condition of the rule.
+func (r *CategoryRule) matches(target CategoryRuleTarget, pattern *regexp.Regexp) bool {
+	if r.PayeeContains != "" && !containsFold(target.Payee, r.PayeeContains) {
+		return false
+	}
+	if pattern != nil && !pattern.MatchString(target.Payee) {
+		return false
+	}
+	if r.NoteContains != "" && !containsFold(target.Note, r.NoteContains) {
+		return false
+	}
+	if r.Kind != "" && r.Kind != target.Kind {
+		return false
+	}
+	if r.MinAmount != nil && target.Amount < *r.MinAmount || r.MaxAmount != nil && target.Amount > *r.MaxAmount {
+		return false
+	}
+	if r.ImportAccountID != nil && (target.ImportAccountID == nil || *target.ImportAccountID != *r.ImportAccountID) {
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether s contains substr, without case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,144 @@
+package types
+
+import "github.com/bwmarrin/snowflake"
+
+// CreateCategoryRuleRequest represents the request to create an auto-categorization rule. The
+// conditions given must all be met.
+// @Description Create category rule request structure
+type CreateCategoryRuleRequest struct {
+	// Name of the rule
+	// @example Groceries
+	Name string `json:"name" binding:"required,max=100"`
+	// Rules with a higher priority are applied first, defaults to 0
+	// @example 10
+	Priority int `json:"priority"`
+	// Whether the rule applies, defaults to true
+	// @example true
+	Enabled *bool `json:"enabled,omitempty"`
+	// Text the payee contains, without case
+	// @example supermarket
+	PayeeContains string `json:"payee_contains,omitempty" binding:"max=255"`
+	// Regular expression the payee matches, in the RE2 syntax ((?i) for no case)
+	// @example (?i)^(lidl|aldi)\b
+	PayeePattern string `json:"payee_pattern,omitempty" binding:"max=255"`
+	// Text the note (the memo of an imported row) contains, without case
+	// @example card 1234
+	NoteContains string `json:"note_contains,omitempty" binding:"max=255"`
+	// Kind of the transactions matched, expense or income, empty for both
+	// @example expense
+	Kind TransactionKind `json:"kind,omitempty"`
+	// Smallest amount matched, in the currency of the transaction
+	// @example 5.00
+	MinAmount *Money `json:"min_amount,omitempty" swaggertype:"string"`
+	// Largest amount matched, in the currency of the transaction
+	// @example 200.00
+	MaxAmount *Money `json:"max_amount,omitempty" swaggertype:"string"`
+	// ID of the ImportAccount whose imported transactions are matched
+	// @example 1234567890123456
+	ImportAccountID *snowflake.ID `json:"import_account_id,omitempty" swaggertype:"integer"`
+	// ID of the CatBud the matched transactions are booked on
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id,omitempty" swaggertype:"integer"`
+	// Tags added to the matched transactions
+	// @example ["food"]
+	Tags []string `json:"tags,omitempty"`
+	// Note set on the matched transactions that have none
+	// @example Weekly groceries
+	Note string `json:"note,omitempty" binding:"max=255"`
+}
+
+// UpdateCategoryRuleRequest represents the request to change an auto-categorization rule. Only
+// the fields given are changed; an empty string clears a condition.
+// @Description Update category rule request structure
+type UpdateCategoryRuleRequest struct {
+	// New name
+	// @example Groceries
+	Name *string `json:"name" binding:"omitempty,max=100"`
+	// New priority
+	// @example 20
+	Priority *int `json:"priority"`
+	// Enable or disable the rule
+	// @example false
+	Enabled *bool `json:"enabled"`
+	// New text the payee contains
+	PayeeContains *string `json:"payee_contains" binding:"omitempty,max=255"`
+	// New regular expression the payee matches
+	PayeePattern *string `json:"payee_pattern" binding:"omitempty,max=255"`
+	// New text the note contains
+	NoteContains *string `json:"note_contains" binding:"omitempty,max=255"`
+	// New kind of the transactions matched, empty for both
+	Kind *TransactionKind `json:"kind"`
+	// New smallest amount matched
+	MinAmount *Money `json:"min_amount" swaggertype:"string"`
+	// Set to true to remove the smallest amount
+	ClearMinAmount bool `json:"clear_min_amount"`
+	// New largest amount matched
+	MaxAmount *Money `json:"max_amount" swaggertype:"string"`
+	// Set to true to remove the largest amount
+	ClearMaxAmount bool `json:"clear_max_amount"`
+	// New ImportAccount whose imported transactions are matched
+	ImportAccountID *snowflake.ID `json:"import_account_id" swaggertype:"integer"`
+	// Set to true to match the transactions of every account
+	ClearImportAccount bool `json:"clear_import_account"`
+	// New CatBud the matched transactions are booked on
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Set to true to stop booking the matched transactions on a CatBud
+	ClearCatBud bool `json:"clear_cat_bud"`
+	// New tags added to the matched transactions, replacing the current ones
+	Tags *[]string `json:"tags"`
+	// New note set on the matched transactions that have none
+	Note *string `json:"note" binding:"omitempty,max=255"`
+}
+
+// CategoryRuleResponse represents the response containing a single auto-categorization rule
+// @Description Single category rule response structure
+type CategoryRuleResponse struct {
+	// The rule
+	Rule CategoryRule `json:"rule"`
+}
+
+// ListCategoryRulesResponse represents the response containing the auto-categorization rules of
+// an Aibo
+// @Description List category rules response structure
+type ListCategoryRulesResponse struct {
+	// Rules, in the order they are applied: highest priority first
+	Rules []CategoryRule `json:"rules"`
+}
+
+// ApplyCategoryRulesRequest represents the request to apply the rules again to the past
+// transactions
+// @Description Apply category rules request structure
+type ApplyCategoryRulesRequest struct {
+	// First day of the transactions (format: YYYY-MM-DD), defaults to a year before the last day,
+	// at most a year before it
+	// @example 2024-01-01
+	From string `json:"from"`
+	// Last day of the transactions (format: YYYY-MM-DD), defaults to today
+	// @example 2024-12-31
+	To string `json:"to"`
+	// Only apply these rules, defaults to every enabled rule
+	RuleIDs []snowflake.ID `json:"rule_ids" swaggertype:"array,integer"`
+	// Only compute the changes, without saving them
+	// @example true
+	DryRun bool `json:"dry_run"`
+}
+
+// ApplyCategoryRulesResponse represents the changes made by the rules applied again, or to make
+// in a dry-run
+// @Description Apply category rules response structure
+type ApplyCategoryRulesResponse struct {
+	// Whether nothing was saved
+	DryRun bool `json:"dry_run"`
+	// Number of transactions the rules were tried on
+	Checked int `json:"checked"`
+	// One line per transaction changed, in the order of the days
+	Changes []CategoryRuleChange `json:"changes"`
+}
+
+// ListCategoryRuleSuggestionsResponse represents the rules suggested from the manual corrections
+// of an Aibo
+// @Description List category rule suggestions response structure
+type ListCategoryRuleSuggestionsResponse struct {
+	// Suggestions, the most corrected first
+	Suggestions []CategoryRuleSuggestion `json:"suggestions"`
+}
@@ -0,0 +1,160 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+func TestCategoryRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    CategoryRule
+		wantErr bool
+	}{
+		{"payee", CategoryRule{Name: "Coffee", PayeeContains: "coffee", CatBudID: idPtr(1)}, false},
+		{"amount range setting tags", CategoryRule{Name: "Big", MinAmount: moneyPtr(10000), MaxAmount: moneyPtr(10000), Tags: Tags{"big"}}, false},
+		{"account setting a note", CategoryRule{Name: "Card", ImportAccountID: idPtr(5), Note: "card"}, false},
+		{"no name", CategoryRule{Name: " ", PayeeContains: "coffee", CatBudID: idPtr(1)}, true},
+		{"no condition", CategoryRule{Name: "All", CatBudID: idPtr(1)}, true},
+		{"nothing to set", CategoryRule{Name: "Coffee", PayeeContains: "coffee"}, true},
+		{"invalid pattern", CategoryRule{Name: "Coffee", PayeePattern: "(coffee", CatBudID: idPtr(1)}, true},
+		{"invalid kind", CategoryRule{Name: "Coffee", Kind: "transfer", CatBudID: idPtr(1)}, true},
+		{"negative amount", CategoryRule{Name: "Coffee", MinAmount: moneyPtr(-1), CatBudID: idPtr(1)}, true},
+		{"min above max", CategoryRule{Name: "Coffee", MinAmount: moneyPtr(2), MaxAmount: moneyPtr(1), CatBudID: idPtr(1)}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCategoryRuleMatches(t *testing.T) {
+	target := CategoryRuleTarget{Payee: "STARBUCKS #123 Seattle", Note: "Card payment", Kind: TransactionExpense, Amount: 450, ImportAccountID: idPtr(5)}
+	tests := []struct {
+		name string
+		rule CategoryRule
+		want bool
+	}{
+		{"payee without case", CategoryRule{PayeeContains: "starbucks"}, true},
+		{"other payee", CategoryRule{PayeeContains: "peet"}, false},
+		{"pattern", CategoryRule{PayeePattern: `(?i)^starbucks #\d+`}, true},
+		{"pattern with case", CategoryRule{PayeePattern: `^starbucks`}, false},
+		{"note", CategoryRule{NoteContains: "CARD"}, true},
+		{"other note", CategoryRule{NoteContains: "transfer"}, false},
+		{"kind", CategoryRule{Kind: TransactionExpense}, true},
+		{"other kind", CategoryRule{Kind: TransactionIncome}, false},
+		{"within range", CategoryRule{MinAmount: moneyPtr(450), MaxAmount: moneyPtr(450)}, true},
+		{"below min", CategoryRule{MinAmount: moneyPtr(451)}, false},
+		{"above max", CategoryRule{MaxAmount: moneyPtr(449)}, false},
+		{"account", CategoryRule{ImportAccountID: idPtr(5)}, true},
+		{"other account", CategoryRule{ImportAccountID: idPtr(6)}, false},
+		{"every condition", CategoryRule{PayeeContains: "starbucks", NoteContains: "card", Kind: TransactionExpense, MaxAmount: moneyPtr(1000)}, true},
+		{"one condition failing", CategoryRule{PayeeContains: "starbucks", Kind: TransactionIncome}, false},
+	}
+	for _, tt := range tests {
+		tt.rule.Enabled, tt.rule.CatBudID = true, idPtr(1)
+		set := NewCategoryRuleSet([]CategoryRule{tt.rule})
+		if got := set.Apply(target, &CategoryRuleFields{}, false) != nil; got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	manual := CategoryRuleTarget{Payee: "Starbucks"}
+	set := NewCategoryRuleSet([]CategoryRule{{Enabled: true, ImportAccountID: idPtr(5), CatBudID: idPtr(1)}})
+	if set.Apply(manual, &CategoryRuleFields{}, false) != nil {
+		t.Error("a rule on an account matches a transaction recorded by hand")
+	}
+}
+
+func TestNewCategoryRuleSet(t *testing.T) {
+	set := NewCategoryRuleSet([]CategoryRule{
+		{ID: 1, Enabled: true, PayeeContains: "a", CatBudID: idPtr(1)},
+		{ID: 2, Enabled: false, PayeeContains: "a", CatBudID: idPtr(2)},
+		{ID: 3, Enabled: true, PayeePattern: "(", CatBudID: idPtr(3)},
+	})
+	if set.Len() != 1 {
+		t.Errorf("Len() = %d, want 1: disabled rules and invalid patterns are left out", set.Len())
+	}
+}
+
+func TestCategoryRuleSetApply(t *testing.T) {
+	rules := []CategoryRule{
+		{ID: 1, Enabled: true, PayeeContains: "amazon", Kind: TransactionExpense, MinAmount: moneyPtr(10000), CatBudID: idPtr(100), Tags: Tags{"big"}},
+		{ID: 2, Enabled: true, PayeeContains: "amazon", Tags: Tags{"online", "BIG"}, Note: "Online order"},
+		{ID: 3, Enabled: true, PayeeContains: "amazon", CatBudID: idPtr(200), Note: "Shopping"},
+		{ID: 4, Enabled: true, PayeeContains: "netflix", Tags: Tags{"subscription"}},
+	}
+	set := NewCategoryRuleSet(rules)
+
+	tests := []struct {
+		name       string
+		target     CategoryRuleTarget
+		fields     CategoryRuleFields
+		replace    bool
+		wantRule   *snowflake.ID
+		wantFields CategoryRuleFields
+	}{
+		{
+			name:       "highest priority first",
+			target:     CategoryRuleTarget{Payee: "Amazon.com", Kind: TransactionExpense, Amount: 15000},
+			wantRule:   idPtr(1),
+			wantFields: CategoryRuleFields{CatBudID: idPtr(100), Tags: Tags{"big", "online"}, Note: "Online order"},
+		},
+		{
+			name:       "next rule with a CatBud",
+			target:     CategoryRuleTarget{Payee: "Amazon.com", Kind: TransactionExpense, Amount: 2000},
+			wantRule:   idPtr(3),
+			wantFields: CategoryRuleFields{CatBudID: idPtr(200), Tags: Tags{"online", "BIG"}, Note: "Online order"},
+		},
+		{
+			name:       "booked CatBud and note kept",
+			target:     CategoryRuleTarget{Payee: "Amazon.com", Kind: TransactionExpense, Amount: 2000},
+			fields:     CategoryRuleFields{CatBudID: idPtr(300), Tags: Tags{"gift"}, Note: "Birthday"},
+			wantFields: CategoryRuleFields{CatBudID: idPtr(300), Tags: Tags{"gift", "online", "BIG"}, Note: "Birthday"},
+		},
+		{
+			name:       "booked CatBud replaced",
+			target:     CategoryRuleTarget{Payee: "Amazon.com", Kind: TransactionExpense, Amount: 2000},
+			fields:     CategoryRuleFields{CatBudID: idPtr(300)},
+			replace:    true,
+			wantRule:   idPtr(3),
+			wantFields: CategoryRuleFields{CatBudID: idPtr(200), Tags: Tags{"online", "BIG"}, Note: "Online order"},
+		},
+		{
+			name:       "split kept",
+			target:     CategoryRuleTarget{Payee: "Amazon.com", Kind: TransactionExpense, Amount: 15000, Split: true},
+			replace:    true,
+			wantFields: CategoryRuleFields{Tags: Tags{"big", "online"}, Note: "Online order"},
+		},
+		{
+			name:       "tags only",
+			target:     CategoryRuleTarget{Payee: "NETFLIX.COM", Kind: TransactionExpense, Amount: 1599},
+			wantFields: CategoryRuleFields{Tags: Tags{"subscription"}},
+		},
+		{
+			name:       "no match",
+			target:     CategoryRuleTarget{Payee: "Grocer", Kind: TransactionExpense, Amount: 1599},
+			fields:     CategoryRuleFields{Tags: Tags{"food"}},
+			wantFields: CategoryRuleFields{Tags: Tags{"food"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := tt.fields
+			ruleID := set.Apply(tt.target, &fields, tt.replace)
+			if (ruleID == nil) != (tt.wantRule == nil) || ruleID != nil && *ruleID != *tt.wantRule {
+				t.Errorf("rule = %v, want %v", ruleID, tt.wantRule)
+			}
+			if (fields.CatBudID == nil) != (tt.wantFields.CatBudID == nil) ||
+				fields.CatBudID != nil && *fields.CatBudID != *tt.wantFields.CatBudID {
+				t.Errorf("CatBudID = %v, want %v", fields.CatBudID, tt.wantFields.CatBudID)
+			}
+			if !reflect.DeepEqual(fields.Tags, tt.wantFields.Tags) || fields.Note != tt.wantFields.Note {
+				t.Errorf("Tags = %v, Note = %q, want %v, %q", fields.Tags, fields.Note, tt.wantFields.Tags, tt.wantFields.Note)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// Currency is an ISO 4217 alphabetic currency code, such as "EUR" or "USD".
+type Currency string
+
+// DefaultCurrency is the base currency of the Aibos that did not choose one.
+const DefaultCurrency Currency = "EUR"
+
+// isoCurrencies lists the active ISO 4217 currency codes.
+var isoCurrencies = map[Currency]struct{}{
+	"AED": {}, "AFN": {}, "ALL": {}, "AMD": {}, "ANG": {}, "AOA": {}, "ARS": {}, "AUD": {}, "AWG": {}, "AZN": {},
+	"BAM": {}, "BBD": {}, "BDT": {}, "BGN": {}, "BHD": {}, "BIF": {}, "BMD": {}, "BND": {}, "BOB": {}, "BRL": {},
+	"BSD": {}, "BTN": {}, "BWP": {}, "BYN": {}, "BZD": {}, "CAD": {}, "CDF": {}, "CHF": {}, "CLP": {}, "CNY": {},
+	"COP": {}, "CRC": {}, "CUP": {}, "CVE": {}, "CZK": {}, "DJF": {}, "DKK": {}, "DOP": {}, "DZD": {}, "EGP": {},
+	"ERN": {}, "ETB": {}, "EUR": {}, "FJD": {}, "FKP": {}, "GBP": {}, "GEL": {}, "GHS": {}, "GIP": {}, "GMD": {},
+	"GNF": {}, "GTQ": {}, "GYD": {}, "HKD": {}, "HNL": {}, "HTG": {}, "HUF": {}, "IDR": {}, "ILS": {}, "INR": {},
+	"IQD": {}, "IRR": {}, "ISK": {}, "JMD": {}, "JOD": {}, "JPY": {}, "KES": {}, "KGS": {}, "KHR": {}, "KMF": {},
+	"KPW": {}, "KRW": {}, "KWD": {}, "KYD": {}, "KZT": {}, "LAK": {}, "LBP": {}, "LKR": {}, "LRD": {}, "LSL": {},
+	"LYD": {}, "MAD": {}, "MDL": {}, "MGA": {}, "MKD": {}, "MMK": {}, "MNT": {}, "MOP": {}, "MRU": {}, "MUR": {},
+	"MVR": {}, "MWK": {}, "MXN": {}, "MYR": {}, "MZN": {}, "NAD": {}, "NGN": {}, "NIO": {}, "NOK": {}, "NPR": {},
+	"NZD": {}, "OMR": {}, "PAB": {}, "PEN": {}, "PGK": {}, "PHP": {}, "PKR": {}, "PLN": {}, "PYG": {}, "QAR": {},
+	"RON": {}, "RSD": {}, "RUB": {}, "RWF": {}, "SAR": {}, "SBD": {}, "SCR": {}, "SDG": {}, "SEK": {}, "SGD": {},
+	"SHP": {}, "SLE": {}, "SOS": {}, "SRD": {}, "SSP": {}, "STN": {}, "SVC": {}, "SYP": {}, "SZL": {}, "THB": {},
+	"TJS": {}, "TMT": {}, "TND": {}, "TOP": {}, "TRY": {}, "TTD": {}, "TWD": {}, "TZS": {}, "UAH": {}, "UGX": {},
+	"USD": {}, "UYU": {}, "UZS": {}, "VES": {}, "VND": {}, "VUV": {}, "WST": {}, "XAF": {}, "XCD": {}, "XCG": {},
+	"XOF": {}, "XPF": {}, "YER": {}, "ZAR": {}, "ZMW": {}, "ZWG": {},
+}
+
+// minorUnits lists the active ISO 4217 currencies whose minor unit is not the hundredth, with
+// their number of decimals.
+var minorUnits = map[Currency]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0, "RWF": 0,
+	"UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// IsValid reports whether the currency is an active ISO 4217 currency code.
+func (c Currency) IsValid() bool {
+	_, ok := isoCurrencies[c]
+	return ok
+}
+
+// MinorUnits returns the number of decimals of the currency in ISO 4217, such as 2 for EUR, 0 for
+// JPY or 3 for KWD.
+func (c Currency) MinorUnits() int {
+	if n, ok := minorUnits[c]; ok {
+		return n
+	}
+	return 2
+}
+
+// IsSupported reports whether amounts can be held in the currency: Money counts hundredths, so
+// only the ISO 4217 currencies with two decimals are supported. Exchange rates may still involve
+// the other currencies.
+func (c Currency) IsSupported() bool {
+	return c.IsValid() && c.MinorUnits() == 2
+}
+
+// ExchangeRate is the value of one unit of a currency in another currency on a given day
+// @Description Exchange rate
+type ExchangeRate struct {
+	// Unique identifier for the ExchangeRate
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// Currency being priced
+	Base Currency `gorm:"type:char(3);not null;uniqueIndex:idx_exchange_rates_pair_date,priority:1" json:"base" swaggertype:"string" example:"EUR"`
+	// Currency the price is expressed in
+	Quote Currency `gorm:"type:char(3);not null;uniqueIndex:idx_exchange_rates_pair_date,priority:2" json:"quote" swaggertype:"string" example:"USD"`
+	// Day the rate applies from
+	Date time.Time `gorm:"type:date;not null;uniqueIndex:idx_exchange_rates_pair_date,priority:3" json:"date"`
+	// Value of one unit of the base currency in the quote currency
+	Rate float64 `gorm:"type:decimal(20,10);not null" json:"rate"`
+	// Timestamp of when the rate was imported
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Validate checks that the rate is usable for conversions.
+func (r *ExchangeRate) Validate() error {
+	if !r.Base.IsValid() || !r.Quote.IsValid() {
+		return errors.New("base and quote must be ISO 4217 currency codes")
+	}
+	if r.Base == r.Quote {
+		return errors.New("base and quote must differ")
+	}
+	if r.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if r.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	return nil
+}
+
+// ExchangeRateRefresh records that the rates changed from a day on for the transactions of an
+// Aibo: their base amounts are converted again, and the ledger recalculated, in the background.
+type ExchangeRateRefresh struct {
+	// ID of the Aibo whose transactions are converted again
+	AiboID uuid.UUID `gorm:"type:char(36);primaryKey"`
+	// First day whose transactions are converted again
+	From time.Time `gorm:"column:from_date;type:date;not null"`
+	// Timestamp of when the refresh was first queued
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP;index"`
+}
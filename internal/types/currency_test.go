@@ -0,0 +1,40 @@
+package types
+
+import "testing"
+
+func TestCurrencyIsValid(t *testing.T) {
+	for currency, want := range map[Currency]bool{
+		"EUR": true,
+		"JPY": true,
+		"KWD": true,
+		"eur": false,
+		"EU":  false,
+		"XXX": false,
+		"DEM": false,
+		"":    false,
+	} {
+		if got := currency.IsValid(); got != want {
+			t.Errorf("%q.IsValid() = %v, want %v", currency, got, want)
+		}
+	}
+}
+
+func TestExchangeRateValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    ExchangeRate
+		wantErr bool
+	}{
+		{"valid", ExchangeRate{Base: "EUR", Quote: "USD", Date: date(2024, 1, 2), Rate: 1.0945}, false},
+		{"unknown currency", ExchangeRate{Base: "EUR", Quote: "ABC", Date: date(2024, 1, 2), Rate: 1}, true},
+		{"same currency", ExchangeRate{Base: "EUR", Quote: "EUR", Date: date(2024, 1, 2), Rate: 1}, true},
+		{"no date", ExchangeRate{Base: "EUR", Quote: "USD", Rate: 1.0945}, true},
+		{"zero rate", ExchangeRate{Base: "EUR", Quote: "USD", Date: date(2024, 1, 2)}, true},
+		{"negative rate", ExchangeRate{Base: "EUR", Quote: "USD", Date: date(2024, 1, 2), Rate: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.rate.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
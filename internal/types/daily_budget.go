@@ -0,0 +1,77 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// RolloverPolicy decides what happens to the surplus or deficit of a day when it is closed.
+type RolloverPolicy string
+
+const (
+	// RolloverCarryAll carries both surpluses and deficits into the next day.
+	RolloverCarryAll RolloverPolicy = "carry_all"
+	// RolloverCarrySurplus only carries surpluses, deficits are forgiven.
+	RolloverCarrySurplus RolloverPolicy = "carry_surplus"
+	// RolloverCarryDeficit only carries deficits, surpluses are dropped.
+	RolloverCarryDeficit RolloverPolicy = "carry_deficit"
+	// RolloverReset starts every day from the daily budget alone.
+	RolloverReset RolloverPolicy = "reset"
+)
+
+// IsValid reports whether the policy is one of the known rollover policies.
+func (p RolloverPolicy) IsValid() bool {
+	switch p {
+	case RolloverCarryAll, RolloverCarrySurplus, RolloverCarryDeficit, RolloverReset:
+		return true
+	}
+	return false
+}
+
+// Carry returns the carried delta after closing a day that ended with dayDelta
+// (positive for a surplus, negative for a deficit).
+//
+// Unknown policies behave like RolloverCarryAll.
+func (p RolloverPolicy) Carry(carried, dayDelta Money) Money {
+	switch p {
+	case RolloverReset:
+		return 0
+	case RolloverCarrySurplus:
+		if dayDelta < 0 {
+			return carried
+		}
+	case RolloverCarryDeficit:
+		if dayDelta > 0 {
+			return carried
+		}
+	}
+	return carried + dayDelta
+}
+
+// DailyBudgetHistory records how a closed day ended for an Aibo
+// @Description Closed day of the daily budget
+type DailyBudgetHistory struct {
+	// Unique identifier for the history row
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo the day belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_daily_history_aibo_day,priority:1" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Local day that was closed
+	Day time.Time `gorm:"type:date;not null;uniqueIndex:idx_daily_history_aibo_day,priority:2" json:"day"`
+	// Daily budget in effect that day
+	DailyBudget Money `gorm:"type:decimal(10,2);not null" json:"daily_budget" swaggertype:"string"`
+	// Net amount spent that day
+	Spent Money `gorm:"type:decimal(10,2);not null" json:"spent" swaggertype:"string"`
+	// Surplus (positive) or deficit (negative) of the day
+	DayDelta Money `gorm:"type:decimal(10,2);not null" json:"day_delta" swaggertype:"string"`
+	// Carried delta before the day was closed
+	CarriedBefore Money `gorm:"type:decimal(10,2);not null" json:"carried_before" swaggertype:"string"`
+	// Carried delta after the day was closed
+	CarriedAfter Money `gorm:"type:decimal(10,2);not null" json:"carried_after" swaggertype:"string"`
+	// Rollover policy applied
+	Policy RolloverPolicy `gorm:"type:varchar(32);not null" json:"policy"`
+	// Timestamp of when the day was closed
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
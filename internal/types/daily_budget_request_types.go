@@ -0,0 +1,19 @@
+package types
+
+// DailyBudgetHistoryRequest represents the query parameters to list closed days
+// @Description Daily budget history query structure
+type DailyBudgetHistoryRequest struct {
+	// First day to include (format: YYYY-MM-DD)
+	// @example 2024-01-01
+	From string `form:"from"`
+	// Last day to include (format: YYYY-MM-DD)
+	// @example 2024-01-31
+	To string `form:"to"`
+}
+
+// DailyBudgetHistoryResponse represents the response containing the closed days of an Aibo
+// @Description Daily budget history response structure
+type DailyBudgetHistoryResponse struct {
+	// List of closed days, most recent first
+	Days []DailyBudgetHistory `json:"days"`
+}
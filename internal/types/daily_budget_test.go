@@ -0,0 +1,44 @@
+package types
+
+import "testing"
+
+func TestRolloverPolicyCarry(t *testing.T) {
+	tests := []struct {
+		policy   RolloverPolicy
+		carried  Money
+		dayDelta Money
+		want     Money
+	}{
+		{RolloverCarryAll, 500, 250, 750},
+		{RolloverCarryAll, 500, -800, -300},
+		{RolloverCarrySurplus, 500, 250, 750},
+		{RolloverCarrySurplus, 500, -800, 500},
+		{RolloverCarrySurplus, -200, -100, -200},
+		{RolloverCarryDeficit, 500, 250, 500},
+		{RolloverCarryDeficit, 500, -800, -300},
+		{RolloverCarryDeficit, 0, 0, 0},
+		{RolloverReset, 500, 250, 0},
+		{RolloverReset, -500, -250, 0},
+		{"unknown", 100, -50, 50},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Carry(tt.carried, tt.dayDelta); got != tt.want {
+			t.Errorf("%s.Carry(%v, %v) = %v, want %v", tt.policy, tt.carried, tt.dayDelta, got, tt.want)
+		}
+	}
+}
+
+func TestRolloverPolicyIsValid(t *testing.T) {
+	for policy, want := range map[RolloverPolicy]bool{
+		RolloverCarryAll:     true,
+		RolloverCarrySurplus: true,
+		RolloverCarryDeficit: true,
+		RolloverReset:        true,
+		"":                   false,
+		"carry":              false,
+	} {
+		if got := policy.IsValid(); got != want {
+			t.Errorf("%q.IsValid() = %v, want %v", policy, got, want)
+		}
+	}
+}
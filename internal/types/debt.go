@@ -0,0 +1,133 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// DebtKind tells what an Aibo owes money on.
+type DebtKind string
+
+const (
+	DebtCreditCard   DebtKind = "credit_card"
+	DebtPersonalLoan DebtKind = "personal_loan"
+	DebtStudentLoan  DebtKind = "student_loan"
+	DebtAutoLoan     DebtKind = "auto_loan"
+	DebtMortgage     DebtKind = "mortgage"
+	DebtOther        DebtKind = "other"
+)
+
+// IsValid reports whether the kind is one of the supported kinds.
+func (k DebtKind) IsValid() bool {
+	switch k {
+	case DebtCreditCard, DebtPersonalLoan, DebtStudentLoan, DebtAutoLoan, DebtMortgage, DebtOther:
+		return true
+	}
+	return false
+}
+
+// maxAPR is the highest annual percentage rate a debt can have.
+const maxAPR = 1000
+
+// Debt represents money an Aibo owes, such as a credit card or a loan, that it pays down
+// @Description Debt model
+type Debt struct {
+	// Unique identifier for the Debt
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo this debt belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Name of the debt
+	Name string `gorm:"type:varchar(255);not null" json:"name"`
+	// Kind of debt (credit_card, personal_loan, student_loan, auto_loan, mortgage or other)
+	Kind DebtKind `gorm:"type:varchar(16);not null" json:"kind" enums:"credit_card,personal_loan,student_loan,auto_loan,mortgage,other"`
+	// Name of the lender (optional)
+	Lender string `gorm:"type:varchar(255)" json:"lender"`
+	// Amount still owed, in the base currency of the Aibo. Payments lower it; it can be set from
+	// a statement to account for the interest and the new charges.
+	Balance Money `gorm:"type:decimal(10,2);not null" json:"balance" swaggertype:"string"`
+	// Annual percentage rate, in percent
+	APR float64 `gorm:"type:decimal(7,3);not null" json:"apr"`
+	// Minimum amount to pay each month
+	MinimumPayment Money `gorm:"type:decimal(10,2);not null" json:"minimum_payment" swaggertype:"string"`
+	// Day of the month the payment is due, clamped to the last day of shorter months
+	DueDay int `gorm:"not null" json:"due_day"`
+	// ID of the debt repayment CatBud the payments are booked on as expenses (optional)
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"cat_bud_id" swaggertype:"integer"`
+	// Timestamp of when the balance reached zero
+	PaidOffAt *time.Time `gorm:"type:datetime;default:null" json:"paid_off_at"`
+	// Timestamp of when the debt was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the debt was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate checks that the settings of the debt are consistent.
+func (d *Debt) Validate() error {
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	if d.Kind == "" {
+		d.Kind = DebtOther
+	}
+	if !d.Kind.IsValid() {
+		return errors.New("kind must be one of credit_card, personal_loan, student_loan, auto_loan, mortgage or other")
+	}
+	if d.Balance < 0 {
+		return errors.New("balance must not be negative")
+	}
+	if d.APR < 0 || d.APR > maxAPR {
+		return errors.New("apr must be between 0 and 1000")
+	}
+	if d.MinimumPayment < 0 {
+		return errors.New("minimum_payment must not be negative")
+	}
+	if d.DueDay < 1 || d.DueDay > 31 {
+		return errors.New("due_day must be between 1 and 31")
+	}
+	return nil
+}
+
+// DueDate returns the day the payment of the debt is due in the month of the given day.
+func (d *Debt) DueDate(month time.Time) time.Time {
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(d.DueDay, lastDay), 0, 0, 0, 0, time.UTC)
+}
+
+// NextDueDate returns the first day the payment of the debt is due, from the given day included.
+func (d *Debt) NextDueDate(today time.Time) time.Time {
+	due := d.DueDate(today)
+	if due.Before(truncateDay(today)) {
+		due = d.DueDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	return due
+}
+
+// MonthlyInterest returns the interest a balance accrues over a month at the APR of the debt.
+func (d *Debt) MonthlyInterest(balance Money) Money {
+	return balance.Mul(d.APR / 100 / 12)
+}
+
+// DebtPayment is an amount paid on a Debt
+// @Description Debt payment
+type DebtPayment struct {
+	// Unique identifier for the DebtPayment
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the debt
+	DebtID snowflake.ID `gorm:"type:bigint;not null;index" json:"debt_id"`
+	// Amount paid
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// Day of the payment
+	Date time.Time `gorm:"type:date;not null" json:"date"`
+	// Free text note
+	Note string `gorm:"type:text" json:"note"`
+	// ID of the ledger Transaction recorded on the debt's CatBud (can be null)
+	TransactionID *snowflake.ID `gorm:"type:bigint;default:null" json:"transaction_id" swaggertype:"integer"`
+	// Timestamp of when the payment was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
@@ -0,0 +1,283 @@
+package types
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// DebtStrategy tells in which order a payoff plan puts the money left after the minimum
+// payments on the debts.
+type DebtStrategy string
+
+const (
+	// DebtAvalanche pays the debt with the highest APR first, which costs the least interest.
+	DebtAvalanche DebtStrategy = "avalanche"
+	// DebtSnowball pays the debt with the smallest balance first, which pays debts off sooner.
+	DebtSnowball DebtStrategy = "snowball"
+)
+
+// IsValid reports whether the strategy is one of the supported strategies.
+func (s DebtStrategy) IsValid() bool {
+	return s == DebtAvalanche || s == DebtSnowball
+}
+
+const (
+	// maxPlanMonths is the longest payoff plan, 50 years.
+	maxPlanMonths = 600
+	// stalledPlanMonths is the number of months without the total balance going down after which
+	// a plan is deemed never to pay the debts off.
+	stalledPlanMonths = 12
+)
+
+// DebtPlan is the month by month schedule paying a set of debts off with a strategy
+// @Description Debt payoff plan
+type DebtPlan struct {
+	// Strategy of the plan, either "avalanche" or "snowball"
+	Strategy DebtStrategy `json:"strategy" enums:"avalanche,snowball"`
+	// Amount paid each month on top of the minimum payments
+	ExtraPayment Money `json:"extra_payment" swaggertype:"string"`
+	// Amount paid each month: the minimum payments plus the extra payment. The minimum payment of
+	// a debt paid off goes to the next debts.
+	MonthlyPayment Money `json:"monthly_payment" swaggertype:"string"`
+	// Whether the debts are paid off within 50 years: false when the payments do not outpace the
+	// interest
+	Feasible bool `json:"feasible"`
+	// Number of months until the last debt is paid off
+	Months int `json:"months"`
+	// Day of the last payment (null when the plan is not feasible)
+	PayoffDate *time.Time `json:"payoff_date"`
+	// Interest paid over the plan
+	TotalInterest Money `json:"total_interest" swaggertype:"string"`
+	// Amount paid over the plan
+	TotalPaid Money `json:"total_paid" swaggertype:"string"`
+	// Payoff of each debt, in the order the strategy pays them
+	Debts []DebtPayoff `json:"debts"`
+	// Payments of each month
+	Schedule []DebtPlanMonth `json:"schedule"`
+}
+
+// DebtPayoff summarizes how a plan pays off a debt
+// @Description Payoff of a debt in a plan
+type DebtPayoff struct {
+	// ID of the debt
+	DebtID snowflake.ID `json:"debt_id"`
+	// Name of the debt
+	Name string `json:"name"`
+	// Rank of the debt in the strategy, starting at 1
+	Priority int `json:"priority"`
+	// Number of months until the debt is paid off
+	Months int `json:"months"`
+	// Day of the last payment on the debt (null when it is not paid off)
+	PayoffDate *time.Time `json:"payoff_date"`
+	// Interest paid on the debt
+	TotalInterest Money `json:"total_interest" swaggertype:"string"`
+	// Amount paid on the debt
+	TotalPaid Money `json:"total_paid" swaggertype:"string"`
+}
+
+// DebtPlanMonth lists the payments of a month of a plan
+// @Description Month of a debt payoff plan
+type DebtPlanMonth struct {
+	// Number of the month, starting at 1
+	Month int `json:"month"`
+	// Amount paid over the month
+	Payment Money `json:"payment" swaggertype:"string"`
+	// Interest accrued over the month
+	Interest Money `json:"interest" swaggertype:"string"`
+	// Amount still owed at the end of the month
+	Balance Money `json:"balance" swaggertype:"string"`
+	// Payment of each debt still owed
+	Payments []DebtPlanPayment `json:"payments"`
+}
+
+// DebtPlanPayment is the payment of a debt in a month of a plan
+// @Description Payment of a debt in a payoff plan
+type DebtPlanPayment struct {
+	// ID of the debt
+	DebtID snowflake.ID `json:"debt_id"`
+	// Day the payment is due
+	Date time.Time `json:"date"`
+	// Amount paid
+	Payment Money `json:"payment" swaggertype:"string"`
+	// Interest accrued since the previous payment
+	Interest Money `json:"interest" swaggertype:"string"`
+	// Part of the payment lowering the balance
+	Principal Money `json:"principal" swaggertype:"string"`
+	// Amount still owed after the payment
+	Balance Money `json:"balance" swaggertype:"string"`
+}
+
+// DebtPlanComparison compares the avalanche and the snowball strategies on the same debts
+// @Description Comparison of debt payoff strategies
+type DebtPlanComparison struct {
+	// Plan paying the highest APR first
+	Avalanche DebtPlan `json:"avalanche"`
+	// Plan paying the smallest balance first
+	Snowball DebtPlan `json:"snowball"`
+	// Strategy costing the least interest, or paying off sooner for the same interest, the
+	// avalanche on a tie
+	Recommended DebtStrategy `json:"recommended" enums:"avalanche,snowball"`
+	// Interest the avalanche strategy saves over the snowball strategy
+	InterestSaved Money `json:"interest_saved" swaggertype:"string"`
+}
+
+// CompareDebtStrategies plans the payoff of the debts with both strategies.
+func CompareDebtStrategies(debts []Debt, extra Money, today time.Time) DebtPlanComparison {
+	comparison := DebtPlanComparison{
+		Avalanche: PlanDebtPayoff(debts, DebtAvalanche, extra, today),
+		Snowball:  PlanDebtPayoff(debts, DebtSnowball, extra, today),
+	}
+	avalanche, snowball := &comparison.Avalanche, &comparison.Snowball
+
+	comparison.Recommended = DebtAvalanche
+	if snowball.Feasible && (!avalanche.Feasible || snowball.TotalInterest < avalanche.TotalInterest ||
+		snowball.TotalInterest == avalanche.TotalInterest && snowball.Months < avalanche.Months) {
+		comparison.Recommended = DebtSnowball
+	}
+	if avalanche.Feasible && snowball.Feasible {
+		comparison.InterestSaved = snowball.TotalInterest - avalanche.TotalInterest
+	}
+	return comparison
+}
+
+// PlanDebtPayoff simulates paying the debts off month by month from the given day, paying each
+// month the minimum payments and the extra amount.
+//
+// Each month, every debt accrues a month of interest at its APR and gets its minimum payment;
+// the rest of the monthly payment goes to the debts in the order of the strategy. The minimum
+// payment of a debt paid off keeps being paid, on the next debts. The k-th payment of a debt is
+// due on its due day in the k-th month from its next due date. The debts paid off already are
+// left out.
+func PlanDebtPayoff(debts []Debt, strategy DebtStrategy, extra Money, today time.Time) DebtPlan {
+	plan := DebtPlan{Strategy: strategy, ExtraPayment: extra, Debts: []DebtPayoff{}, Schedule: []DebtPlanMonth{}}
+
+	owed := make([]Debt, 0, len(debts))
+	for _, debt := range debts {
+		if debt.Balance > 0 {
+			owed = append(owed, debt)
+		}
+	}
+	sortDebts(owed, strategy)
+
+	balances := make([]Money, len(owed))
+	firstDue := make([]time.Time, len(owed))
+	plan.MonthlyPayment = extra
+	for i := range owed {
+		balances[i] = owed[i].Balance
+		firstDue[i] = owed[i].NextDueDate(today)
+		plan.MonthlyPayment += owed[i].MinimumPayment
+		plan.Debts = append(plan.Debts, DebtPayoff{DebtID: owed[i].ID, Name: owed[i].Name, Priority: i + 1})
+	}
+
+	remaining := sumMoney(balances)
+	lowest, stalled := remaining, 0
+	for month := 1; remaining > 0; month++ {
+		if month > maxPlanMonths || stalled >= stalledPlanMonths {
+			// The payments do not outpace the interest: the schedule shows where it leads.
+			return plan
+		}
+
+		entry := DebtPlanMonth{Month: month, Payments: []DebtPlanPayment{}}
+		payments := make([]DebtPlanPayment, len(owed))
+		budget := plan.MonthlyPayment
+		for i := range owed {
+			if balances[i] == 0 {
+				continue
+			}
+			interest := owed[i].MonthlyInterest(balances[i])
+			balances[i] += interest
+			minimum := min(owed[i].MinimumPayment, balances[i])
+			payments[i] = DebtPlanPayment{
+				DebtID:   owed[i].ID,
+				Date:     owed[i].DueDate(time.Date(firstDue[i].Year(), firstDue[i].Month()+time.Month(month-1), 1, 0, 0, 0, 0, time.UTC)),
+				Payment:  minimum,
+				Interest: interest,
+			}
+			budget -= minimum
+		}
+		for i := range owed {
+			if balances[i] == 0 || budget <= 0 {
+				continue
+			}
+			more := min(budget, balances[i]-payments[i].Payment)
+			payments[i].Payment += more
+			budget -= more
+		}
+
+		for i := range owed {
+			if balances[i] == 0 {
+				continue
+			}
+			payment := &payments[i]
+			balances[i] -= payment.Payment
+			payment.Principal = payment.Payment - payment.Interest
+			payment.Balance = balances[i]
+			entry.Payments = append(entry.Payments, *payment)
+			entry.Payment += payment.Payment
+			entry.Interest += payment.Interest
+
+			payoff := &plan.Debts[i]
+			payoff.TotalPaid += payment.Payment
+			payoff.TotalInterest += payment.Interest
+			if balances[i] == 0 {
+				day := payment.Date
+				payoff.Months, payoff.PayoffDate = month, &day
+			}
+		}
+
+		remaining = sumMoney(balances)
+		entry.Balance = remaining
+		plan.Schedule = append(plan.Schedule, entry)
+		plan.Months = month
+		plan.TotalPaid += entry.Payment
+		plan.TotalInterest += entry.Interest
+
+		if remaining < lowest {
+			lowest, stalled = remaining, 0
+		} else {
+			stalled++
+		}
+	}
+
+	plan.Feasible = true
+	for _, payoff := range plan.Debts {
+		if payoff.PayoffDate != nil && (plan.PayoffDate == nil || payoff.PayoffDate.After(*plan.PayoffDate)) {
+			plan.PayoffDate = payoff.PayoffDate
+		}
+	}
+	return plan
+}
+
+// sortDebts orders the debts the way the strategy pays them. Ties are broken by the other
+// criterion, then by ID so that plans are stable.
+func sortDebts(debts []Debt, strategy DebtStrategy) {
+	sort.SliceStable(debts, func(i, j int) bool {
+		a, b := &debts[i], &debts[j]
+		if strategy == DebtSnowball {
+			if a.Balance != b.Balance {
+				return a.Balance < b.Balance
+			}
+			if a.APR != b.APR {
+				return a.APR > b.APR
+			}
+		} else {
+			if a.APR != b.APR {
+				return a.APR > b.APR
+			}
+			if a.Balance != b.Balance {
+				return a.Balance < b.Balance
+			}
+		}
+		return a.ID < b.ID
+	})
+}
+
+func sumMoney(amounts []Money) Money {
+	var total Money
+	for _, amount := range amounts {
+		total += amount
+	}
+	return total
+}
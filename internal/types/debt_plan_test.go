@@ -0,0 +1,253 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+func TestDebtDueDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		dueDay int
+		month  time.Time
+		want   time.Time
+	}{
+		{"mid month", 15, date(2024, 2, 1), date(2024, 2, 15)},
+		{"leap february", 31, date(2024, 2, 10), date(2024, 2, 29)},
+		{"february", 30, date(2023, 2, 10), date(2023, 2, 28)},
+		{"thirty days", 31, date(2024, 4, 1), date(2024, 4, 30)},
+		{"thirty one days", 31, date(2024, 5, 1), date(2024, 5, 31)},
+	}
+	for _, tt := range tests {
+		debt := Debt{DueDay: tt.dueDay}
+		if got := debt.DueDate(tt.month); !got.Equal(tt.want) {
+			t.Errorf("%s: DueDate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDebtNextDueDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		dueDay int
+		today  time.Time
+		want   time.Time
+	}{
+		{"later this month", 20, date(2024, 1, 10), date(2024, 1, 20)},
+		{"today", 10, date(2024, 1, 10), date(2024, 1, 10)},
+		{"passed", 5, date(2024, 1, 10), date(2024, 2, 5)},
+		{"passed and clamped", 31, date(2024, 1, 31).AddDate(0, 0, 1), date(2024, 2, 29)},
+	}
+	for _, tt := range tests {
+		debt := Debt{DueDay: tt.dueDay}
+		if got := debt.NextDueDate(tt.today); !got.Equal(tt.want) {
+			t.Errorf("%s: NextDueDate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlanDebtPayoffOrder(t *testing.T) {
+	debts := []Debt{
+		{ID: 1, Name: "Card", Balance: 500000, APR: 24, MinimumPayment: 15000, DueDay: 15},
+		{ID: 2, Name: "Store", Balance: 80000, APR: 12, MinimumPayment: 4000, DueDay: 15},
+		{ID: 3, Name: "Car", Balance: 300000, APR: 6, MinimumPayment: 10000, DueDay: 15},
+	}
+	tests := []struct {
+		strategy      DebtStrategy
+		wantOrder     []snowflake.ID
+		wantFirst     []Money
+		wantMonths    int
+		wantInterest  Money
+		wantTotalPaid Money
+	}{
+		{DebtAvalanche, []snowflake.ID{1, 2, 3}, []Money{45000, 4000, 10000}, 17, 97653, 977653},
+		{DebtSnowball, []snowflake.ID{2, 3, 1}, []Money{34000, 10000, 15000}, 18, 138759, 1018759},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			plan := PlanDebtPayoff(debts, tt.strategy, 30000, date(2024, 1, 10))
+			if !plan.Feasible || plan.Months != tt.wantMonths {
+				t.Fatalf("Feasible = %v, Months = %d, want true, %d", plan.Feasible, plan.Months, tt.wantMonths)
+			}
+			if plan.MonthlyPayment != 59000 {
+				t.Errorf("MonthlyPayment = %v, want 590.00", plan.MonthlyPayment)
+			}
+			if plan.TotalInterest != tt.wantInterest || plan.TotalPaid != tt.wantTotalPaid {
+				t.Errorf("TotalInterest = %v, TotalPaid = %v, want %v, %v", plan.TotalInterest, plan.TotalPaid, tt.wantInterest, tt.wantTotalPaid)
+			}
+			for i, id := range tt.wantOrder {
+				if plan.Debts[i].DebtID != id || plan.Debts[i].Priority != i+1 {
+					t.Errorf("Debts[%d] = %d with priority %d, want %d with priority %d", i, plan.Debts[i].DebtID, plan.Debts[i].Priority, id, i+1)
+				}
+				if got := plan.Schedule[0].Payments[i].Payment; got != tt.wantFirst[i] {
+					t.Errorf("first payment of debt %d = %v, want %v", id, got, tt.wantFirst[i])
+				}
+			}
+			if plan.PayoffDate == nil || !plan.PayoffDate.Equal(*plan.Debts[2].PayoffDate) {
+				t.Errorf("PayoffDate = %v, want the payoff of the last debt %v", plan.PayoffDate, plan.Debts[2].PayoffDate)
+			}
+		})
+	}
+}
+
+func TestPlanDebtPayoffFeasibility(t *testing.T) {
+	tests := []struct {
+		name         string
+		debt         Debt
+		extra        Money
+		wantFeasible bool
+		wantMonths   int
+		wantInterest Money
+		wantPaid     Money
+	}{
+		{"zero apr", Debt{ID: 1, Balance: 100000, MinimumPayment: 10000, DueDay: 1}, 0, true, 10, 0, 100000},
+		{"zero apr with extra", Debt{ID: 1, Balance: 100000, MinimumPayment: 10000, DueDay: 1}, 15000, true, 4, 0, 100000},
+		{"minimum below interest", Debt{ID: 1, Balance: 1000000, APR: 24, MinimumPayment: 10000, DueDay: 1}, 0, false, 0, 0, 0},
+		{"minimum equal to interest", Debt{ID: 1, Balance: 1000000, APR: 24, MinimumPayment: 20000, DueDay: 1}, 0, false, 0, 0, 0},
+		{"extra outpaces interest", Debt{ID: 1, Balance: 1000000, APR: 24, MinimumPayment: 10000, DueDay: 1}, 200000, true, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := PlanDebtPayoff([]Debt{tt.debt}, DebtAvalanche, tt.extra, date(2024, 1, 1))
+			if plan.Feasible != tt.wantFeasible {
+				t.Fatalf("Feasible = %v, want %v", plan.Feasible, tt.wantFeasible)
+			}
+			if !plan.Feasible {
+				if plan.PayoffDate != nil || plan.Debts[0].PayoffDate != nil {
+					t.Errorf("PayoffDate = %v, debt PayoffDate = %v, want nil", plan.PayoffDate, plan.Debts[0].PayoffDate)
+				}
+				return
+			}
+			if plan.PayoffDate == nil {
+				t.Fatal("PayoffDate = nil")
+			}
+			if tt.wantMonths == 0 {
+				return
+			}
+			if plan.Months != tt.wantMonths || plan.TotalInterest != tt.wantInterest || plan.TotalPaid != tt.wantPaid {
+				t.Errorf("Months = %d, TotalInterest = %v, TotalPaid = %v, want %d, %v, %v",
+					plan.Months, plan.TotalInterest, plan.TotalPaid, tt.wantMonths, tt.wantInterest, tt.wantPaid)
+			}
+		})
+	}
+}
+
+func TestPlanDebtPayoffRollsMinimumsOver(t *testing.T) {
+	debts := []Debt{
+		{ID: 1, Balance: 10000, MinimumPayment: 5000, DueDay: 1},
+		{ID: 2, Balance: 100000, MinimumPayment: 5000, DueDay: 1},
+	}
+	plan := PlanDebtPayoff(debts, DebtSnowball, 0, date(2024, 1, 1))
+	if !plan.Feasible || plan.Months != 11 {
+		t.Fatalf("Feasible = %v, Months = %d, want true, 11", plan.Feasible, plan.Months)
+	}
+	if plan.Debts[0].Months != 2 {
+		t.Errorf("first debt paid off in %d months, want 2", plan.Debts[0].Months)
+	}
+
+	tests := []struct {
+		month        int
+		wantPayments []Money
+	}{
+		{1, []Money{5000, 5000}},
+		{2, []Money{5000, 5000}},
+		{3, []Money{10000}},
+		{11, []Money{10000}},
+	}
+	for _, tt := range tests {
+		entry := plan.Schedule[tt.month-1]
+		if entry.Payment != 10000 {
+			t.Errorf("month %d: Payment = %v, want 100.00", tt.month, entry.Payment)
+		}
+		if len(entry.Payments) != len(tt.wantPayments) {
+			t.Fatalf("month %d: %d payments, want %d", tt.month, len(entry.Payments), len(tt.wantPayments))
+		}
+		for i, want := range tt.wantPayments {
+			if got := entry.Payments[i].Payment; got != want {
+				t.Errorf("month %d: payment %d = %v, want %v", tt.month, i, got, want)
+			}
+		}
+	}
+}
+
+func TestPlanDebtPayoffClampsDueDays(t *testing.T) {
+	debt := Debt{ID: 1, Balance: 40000, MinimumPayment: 10000, DueDay: 31}
+	plan := PlanDebtPayoff([]Debt{debt}, DebtAvalanche, 0, date(2024, 1, 15))
+	want := []time.Time{date(2024, 1, 31), date(2024, 2, 29), date(2024, 3, 31), date(2024, 4, 30)}
+	if len(plan.Schedule) != len(want) {
+		t.Fatalf("%d months, want %d", len(plan.Schedule), len(want))
+	}
+	for i, day := range want {
+		if got := plan.Schedule[i].Payments[0].Date; !got.Equal(day) {
+			t.Errorf("payment %d due on %v, want %v", i+1, got, day)
+		}
+	}
+	if plan.PayoffDate == nil || !plan.PayoffDate.Equal(date(2024, 4, 30)) {
+		t.Errorf("PayoffDate = %v, want 2024-04-30", plan.PayoffDate)
+	}
+}
+
+func TestPlanDebtPayoffSkipsPaidOffDebts(t *testing.T) {
+	debts := []Debt{
+		{ID: 1, Balance: 0, MinimumPayment: 5000, DueDay: 1},
+		{ID: 2, Balance: 10000, MinimumPayment: 5000, DueDay: 1},
+	}
+	plan := PlanDebtPayoff(debts, DebtAvalanche, 0, date(2024, 1, 1))
+	if len(plan.Debts) != 1 || plan.Debts[0].DebtID != 2 {
+		t.Fatalf("Debts = %+v, want only debt 2", plan.Debts)
+	}
+	if plan.MonthlyPayment != 5000 || plan.Months != 2 {
+		t.Errorf("MonthlyPayment = %v, Months = %d, want 50.00, 2", plan.MonthlyPayment, plan.Months)
+	}
+
+	empty := PlanDebtPayoff(nil, DebtAvalanche, 0, date(2024, 1, 1))
+	if !empty.Feasible || empty.Months != 0 || empty.PayoffDate != nil {
+		t.Errorf("plan without debts = %+v", empty)
+	}
+}
+
+func TestCompareDebtStrategies(t *testing.T) {
+	tests := []struct {
+		name      string
+		debts     []Debt
+		extra     Money
+		want      DebtStrategy
+		wantSaved Money
+	}{
+		{
+			name: "avalanche saves interest",
+			debts: []Debt{
+				{ID: 1, Balance: 500000, APR: 24, MinimumPayment: 15000, DueDay: 15},
+				{ID: 2, Balance: 80000, APR: 12, MinimumPayment: 4000, DueDay: 15},
+				{ID: 3, Balance: 300000, APR: 6, MinimumPayment: 10000, DueDay: 15},
+			},
+			extra:     30000,
+			want:      DebtAvalanche,
+			wantSaved: 41106,
+		},
+		{
+			name: "same order",
+			debts: []Debt{
+				{ID: 1, Balance: 50000, APR: 20, MinimumPayment: 5000, DueDay: 15},
+				{ID: 2, Balance: 100000, APR: 10, MinimumPayment: 5000, DueDay: 15},
+			},
+			extra: 30000,
+			want:  DebtAvalanche,
+		},
+		{
+			name:  "infeasible",
+			debts: []Debt{{ID: 1, Balance: 1000000, APR: 24, MinimumPayment: 10000, DueDay: 1}},
+			want:  DebtAvalanche,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison := CompareDebtStrategies(tt.debts, tt.extra, date(2024, 1, 10))
+			if comparison.Recommended != tt.want || comparison.InterestSaved != tt.wantSaved {
+				t.Errorf("Recommended = %s, InterestSaved = %v, want %s, %v", comparison.Recommended, comparison.InterestSaved, tt.want, tt.wantSaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// CreateDebtRequest represents the request to create a Debt
+// @Description Create debt request structure
+type CreateDebtRequest struct {
+	// Name of the debt
+	// @example Visa card
+	Name string `json:"name" binding:"required"`
+	// Kind of debt (credit_card, personal_loan, student_loan, auto_loan, mortgage or other), defaults to other
+	// @example credit_card
+	Kind DebtKind `json:"kind"`
+	// Name of the lender
+	// @example First Bank
+	Lender string `json:"lender"`
+	// Amount still owed
+	// @example 4250.00
+	Balance Money `json:"balance" binding:"gte=0" swaggertype:"string"`
+	// Annual percentage rate, in percent
+	// @example 22.9
+	APR float64 `json:"apr" binding:"gte=0,lte=1000"`
+	// Minimum amount to pay each month
+	// @example 120.00
+	MinimumPayment Money `json:"minimum_payment" binding:"gte=0" swaggertype:"string"`
+	// Day of the month the payment is due
+	// @example 25
+	DueDay int `json:"due_day" binding:"required,min=1,max=31"`
+	// ID of the debt repayment CatBud the payments are booked on as expenses
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+}
+
+// UpdateDebtRequest represents the request to update a Debt
+// @Description Update debt request structure
+type UpdateDebtRequest struct {
+	// New name of the debt
+	// @example Visa card
+	Name string `json:"name"`
+	// New kind of debt
+	// @example credit_card
+	Kind DebtKind `json:"kind"`
+	// New name of the lender
+	// @example First Bank
+	Lender *string `json:"lender"`
+	// Amount owed according to the latest statement, interest and new charges included
+	// @example 4310.42
+	Balance *Money `json:"balance" binding:"omitempty,gte=0" swaggertype:"string"`
+	// New annual percentage rate, in percent
+	// @example 19.9
+	APR *float64 `json:"apr" binding:"omitempty,gte=0,lte=1000"`
+	// New minimum amount to pay each month
+	// @example 130.00
+	MinimumPayment *Money `json:"minimum_payment" binding:"omitempty,gte=0" swaggertype:"string"`
+	// New day of the month the payment is due
+	// @example 28
+	DueDay *int `json:"due_day" binding:"omitempty,min=1,max=31"`
+	// ID of the new debt repayment CatBud
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Set to true to stop booking the payments on a CatBud
+	// @example false
+	UnlinkCatBud bool `json:"unlink_cat_bud"`
+}
+
+// CreateDebtPaymentRequest represents the request to record a payment on a Debt
+// @Description Create debt payment request structure
+type CreateDebtPaymentRequest struct {
+	// Amount paid, at most the balance of the debt
+	// @example 250.00
+	Amount Money `json:"amount" binding:"required,gt=0" swaggertype:"string"`
+	// Day of the payment (format: YYYY-MM-DD), defaults to today
+	// @example 2024-10-25
+	Date string `json:"date"`
+	// Free text note
+	// @example October payment
+	Note string `json:"note"`
+}
+
+// DebtPlanRequest represents the query parameters of a debt payoff plan
+// @Description Debt payoff plan request structure
+type DebtPlanRequest struct {
+	// Amount paid each month on top of the minimum payments, defaults to 0
+	// @example 200.00
+	ExtraPayment Money `form:"extra_payment" binding:"gte=0" swaggertype:"string"`
+}
+
+// DebtResponse represents the response containing a Debt
+// @Description Debt response structure
+type DebtResponse struct {
+	// The debt
+	Debt Debt `json:"debt"`
+	// Day the next payment is due (null when the debt is paid off)
+	NextDueDate *time.Time `json:"next_due_date"`
+	// Interest the balance accrues over a month
+	MonthlyInterest Money `json:"monthly_interest" swaggertype:"string"`
+}
+
+// ListDebtsResponse represents the response containing the Debts of an Aibo
+// @Description List debts response structure
+type ListDebtsResponse struct {
+	// List of debts
+	Debts []DebtResponse `json:"debts"`
+	// Amount owed on all the debts
+	TotalBalance Money `json:"total_balance" swaggertype:"string"`
+	// Minimum amount to pay each month on the debts still owed
+	TotalMinimumPayment Money `json:"total_minimum_payment" swaggertype:"string"`
+}
+
+// ListDebtPaymentsResponse represents the response containing the payments of a Debt
+// @Description List debt payments response structure
+type ListDebtPaymentsResponse struct {
+	// List of payments, most recent first
+	Payments []DebtPayment `json:"payments"`
+}
@@ -0,0 +1,125 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// EnvelopeRule decides what happens to the balance of a CatBud when its period closes.
+type EnvelopeRule string
+
+const (
+	// EnvelopeReset starts every period from the budget alone.
+	EnvelopeReset EnvelopeRule = "reset"
+	// EnvelopeCarrySurplus carries the unspent budget, overspending is forgiven.
+	EnvelopeCarrySurplus EnvelopeRule = "carry_surplus"
+	// EnvelopeCarryAll carries both the unspent budget and the overspending.
+	EnvelopeCarryAll EnvelopeRule = "carry_all"
+	// EnvelopeCap carries the unspent budget up to the CatBud RolloverCap, overspending is forgiven.
+	EnvelopeCap EnvelopeRule = "cap"
+)
+
+// IsValid reports whether the rule is one of the known envelope rules.
+func (r EnvelopeRule) IsValid() bool {
+	switch r {
+	case EnvelopeReset, EnvelopeCarrySurplus, EnvelopeCarryAll, EnvelopeCap:
+		return true
+	}
+	return false
+}
+
+// Carry returns the amount carried into the next period from the balance of a closed period.
+//
+// A nil cap with EnvelopeCap behaves like EnvelopeCarrySurplus.
+func (r EnvelopeRule) Carry(balance Money, limit *Money) Money {
+	switch r {
+	case EnvelopeCarryAll:
+		return balance
+	case EnvelopeCarrySurplus:
+		return max(balance, 0)
+	case EnvelopeCap:
+		carried := max(balance, 0)
+		if limit != nil {
+			carried = min(carried, *limit)
+		}
+		return carried
+	default:
+		return 0
+	}
+}
+
+// ClosePeriod returns how the period of the CatBud going from start to end ended, with the amount
+// carried in from the previous period and the net amount spent during it. The returned row has no
+// ID.
+func (cb *CatBud) ClosePeriod(start, end time.Time, carriedIn, spent Money) CatBudPeriodBalance {
+	var budget Money
+	if cb.Budget != nil {
+		budget = *cb.Budget
+	}
+	balance := budget + carriedIn - spent
+	return CatBudPeriodBalance{
+		CatBudID:    cb.ID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Budget:      budget,
+		CarriedIn:   carriedIn,
+		Spent:       spent,
+		Balance:     balance,
+		CarriedOut:  cb.RolloverRule.Carry(balance, cb.RolloverCap),
+		Rule:        cb.RolloverRule,
+	}
+}
+
+// RemainingAfter returns what is left of the budget of the CatBud and the amount carried into its
+// current period once spent is taken out, or nil when the CatBud has no budget.
+func (cb *CatBud) RemainingAfter(spent Money) *Money {
+	if cb.Budget == nil {
+		return nil
+	}
+	remaining := *cb.Budget + cb.CarriedOver - spent
+	return &remaining
+}
+
+// ValidateRollover checks that the envelope settings of the CatBud are consistent.
+func (cb *CatBud) ValidateRollover() error {
+	if cb.RolloverRule == "" {
+		cb.RolloverRule = EnvelopeReset
+	}
+	if !cb.RolloverRule.IsValid() {
+		return errors.New("rollover_rule must be one of reset, carry_surplus, carry_all or cap")
+	}
+	if cb.RolloverRule == EnvelopeCap && (cb.RolloverCap == nil || *cb.RolloverCap < 0) {
+		return errors.New("the cap rollover rule requires a non-negative rollover_cap")
+	}
+	return nil
+}
+
+// CatBudPeriodBalance records how a closed period of a CatBud ended
+// @Description Closed period of a CatBud envelope
+type CatBudPeriodBalance struct {
+	// Unique identifier for the balance row
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the CatBud the period belongs to
+	CatBudID snowflake.ID `gorm:"type:bigint;not null;uniqueIndex:idx_catbud_balances_period,priority:1" json:"cat_bud_id"`
+	// First day of the period
+	PeriodStart time.Time `gorm:"type:date;not null;uniqueIndex:idx_catbud_balances_period,priority:2" json:"period_start"`
+	// Last day of the period
+	PeriodEnd time.Time `gorm:"type:date;not null" json:"period_end"`
+	// Budget of the period
+	Budget Money `gorm:"type:decimal(10,2);not null" json:"budget" swaggertype:"string"`
+	// Amount carried in from the previous period
+	CarriedIn Money `gorm:"type:decimal(10,2);not null" json:"carried_in" swaggertype:"string"`
+	// Net amount spent during the period
+	Spent Money `gorm:"type:decimal(10,2);not null" json:"spent" swaggertype:"string"`
+	// Budget plus carried in minus spent
+	Balance Money `gorm:"type:decimal(10,2);not null" json:"balance" swaggertype:"string"`
+	// Amount carried out to the next period
+	CarriedOut Money `gorm:"type:decimal(10,2);not null" json:"carried_out" swaggertype:"string"`
+	// Envelope rule applied
+	Rule EnvelopeRule `gorm:"type:varchar(16);not null" json:"rule"`
+	// Timestamp of when the period was closed
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func moneyPtr(m Money) *Money {
+	return &m
+}
+
+func TestEnvelopeRuleCarry(t *testing.T) {
+	tests := []struct {
+		rule    EnvelopeRule
+		balance Money
+		limit   *Money
+		want    Money
+	}{
+		{EnvelopeReset, 5000, nil, 0},
+		{EnvelopeReset, -5000, nil, 0},
+		{EnvelopeCarrySurplus, 5000, nil, 5000},
+		{EnvelopeCarrySurplus, -5000, nil, 0},
+		{EnvelopeCarryAll, 5000, nil, 5000},
+		{EnvelopeCarryAll, -5000, nil, -5000},
+		{EnvelopeCap, 5000, moneyPtr(2000), 2000},
+		{EnvelopeCap, 1500, moneyPtr(2000), 1500},
+		{EnvelopeCap, -5000, moneyPtr(2000), 0},
+		{EnvelopeCap, 5000, moneyPtr(0), 0},
+		{EnvelopeCap, 5000, nil, 5000},
+		{"", 5000, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Carry(tt.balance, tt.limit); got != tt.want {
+			t.Errorf("%q.Carry(%v) = %v, want %v", tt.rule, tt.balance, got, tt.want)
+		}
+	}
+}
+
+// TestCatBudClosePeriodChain closes three monthly periods in a row, each carrying into the next.
+func TestCatBudClosePeriodChain(t *testing.T) {
+	const budget Money = 30000
+	spent := []Money{20000, 45000, 25000}
+	tests := []struct {
+		rule      EnvelopeRule
+		limit     *Money
+		wantCarry []Money
+	}{
+		{EnvelopeReset, nil, []Money{0, 0, 0}},
+		{EnvelopeCarrySurplus, nil, []Money{10000, 0, 5000}},
+		{EnvelopeCarryAll, nil, []Money{10000, -5000, 0}},
+		{EnvelopeCap, moneyPtr(7500), []Money{7500, 0, 5000}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.rule), func(t *testing.T) {
+			cb := &CatBud{ID: 1, Budget: moneyPtr(budget), RolloverRule: tt.rule, RolloverCap: tt.limit}
+			carried := Money(0)
+			for i, spentInPeriod := range spent {
+				start := date(2024, 1+time.Month(i), 1)
+				end := start.AddDate(0, 1, -1)
+				history := cb.ClosePeriod(start, end, carried, spentInPeriod)
+				if history.Budget != budget || history.CarriedIn != carried || history.Spent != spentInPeriod || history.Rule != tt.rule {
+					t.Fatalf("period %d: %+v", i, history)
+				}
+				if want := budget + carried - spentInPeriod; history.Balance != want {
+					t.Fatalf("period %d: balance %v, want %v", i, history.Balance, want)
+				}
+				if history.CarriedOut != tt.wantCarry[i] {
+					t.Fatalf("period %d: carried out %v, want %v", i, history.CarriedOut, tt.wantCarry[i])
+				}
+				carried = history.CarriedOut
+			}
+		})
+	}
+}
+
+func TestCatBudClosePeriodWithoutBudget(t *testing.T) {
+	cb := &CatBud{RolloverRule: EnvelopeCarryAll}
+	history := cb.ClosePeriod(date(2024, 1, 1), date(2024, 1, 31), 1000, 2500)
+	if history.Budget != 0 || history.Balance != -1500 || history.CarriedOut != -1500 {
+		t.Fatalf("history = %+v", history)
+	}
+}
+
+func TestCatBudValidateRollover(t *testing.T) {
+	tests := []struct {
+		name     string
+		catBud   CatBud
+		wantRule EnvelopeRule
+		wantErr  bool
+	}{
+		{"defaults to reset", CatBud{}, EnvelopeReset, false},
+		{"carry all", CatBud{RolloverRule: EnvelopeCarryAll}, EnvelopeCarryAll, false},
+		{"unknown", CatBud{RolloverRule: "carry"}, "carry", true},
+		{"cap without limit", CatBud{RolloverRule: EnvelopeCap}, EnvelopeCap, true},
+		{"negative cap", CatBud{RolloverRule: EnvelopeCap, RolloverCap: moneyPtr(-1)}, EnvelopeCap, true},
+		{"zero cap", CatBud{RolloverRule: EnvelopeCap, RolloverCap: moneyPtr(0)}, EnvelopeCap, false},
+		{"cap", CatBud{RolloverRule: EnvelopeCap, RolloverCap: moneyPtr(10000)}, EnvelopeCap, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.catBud.ValidateRollover()
+			if (err != nil) != tt.wantErr || tt.catBud.RolloverRule != tt.wantRule {
+				t.Fatalf("ValidateRollover = %v with rule %q, want error %v with rule %q", err, tt.catBud.RolloverRule, tt.wantErr, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestCatBudRemainingAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  *Money
+		carried Money
+		spent   Money
+		want    *Money
+	}{
+		{"within budget", moneyPtr(30000), 5000, 12000, moneyPtr(23000)},
+		{"overspent", moneyPtr(30000), -2000, 30000, moneyPtr(-2000)},
+		{"refunds", moneyPtr(30000), 0, -1500, moneyPtr(31500)},
+		{"no budget", nil, 5000, 12000, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := CatBud{Budget: tt.budget, CarriedOver: tt.carried}
+			got := cb.RemainingAfter(tt.spent)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Fatalf("RemainingAfter(%v) = %v, want %v", tt.spent, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package types
+
+// ListExchangeRatesRequest represents the query parameters to list ExchangeRates
+// @Description List exchange rates query structure
+type ListExchangeRatesRequest struct {
+	// Currency being priced
+	// @example EUR
+	Base Currency `form:"base" binding:"required"`
+	// Currency the price is expressed in
+	// @example USD
+	Quote Currency `form:"quote" binding:"required"`
+	// First day to include (format: YYYY-MM-DD)
+	// @example 2024-01-01
+	From string `form:"from"`
+	// Last day to include (format: YYYY-MM-DD)
+	// @example 2024-01-31
+	To string `form:"to"`
+}
+
+// ConvertRequest represents the query parameters to convert an amount between two currencies
+// @Description Currency conversion query structure
+type ConvertRequest struct {
+	// Amount to convert
+	// @example 100.00
+	Amount Money `form:"amount" binding:"required" swaggertype:"string"`
+	// Currency of the amount
+	// @example USD
+	From Currency `form:"from" binding:"required"`
+	// Currency to convert into
+	// @example EUR
+	To Currency `form:"to" binding:"required"`
+	// Day whose rate is used (format: YYYY-MM-DD), defaults to today
+	// @example 2024-01-31
+	Date string `form:"date"`
+}
+
+// ListExchangeRatesResponse represents the response containing multiple ExchangeRates
+// @Description List exchange rates response structure
+type ListExchangeRatesResponse struct {
+	// List of rates, most recent first
+	ExchangeRates []ExchangeRate `json:"exchange_rates"`
+}
+
+// ConvertResponse represents the result of a currency conversion
+// @Description Currency conversion response structure
+type ConvertResponse struct {
+	// Converted amount
+	Amount Money `json:"amount" swaggertype:"string"`
+	// Currency of the converted amount
+	Currency Currency `json:"currency" swaggertype:"string"`
+	// Rate used for the conversion
+	Rate float64 `json:"rate"`
+}
+
+// ImportExchangeRatesResponse represents the result of an exchange rates import
+// @Description Import exchange rates response structure
+type ImportExchangeRatesResponse struct {
+	// Number of rates imported
+	Imported int `json:"imported"`
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// ExportFormat is the file format of an export.
+type ExportFormat string
+
+const (
+	// ExportCSV is a comma-separated file, or semicolon-separated for the locales writing decimal
+	// commas.
+	ExportCSV ExportFormat = "csv"
+	// ExportJSONL is a JSON Lines file: one JSON object per row.
+	ExportJSONL ExportFormat = "jsonl"
+	// ExportXLSX is an Office Open XML spreadsheet, as read by Excel, LibreOffice and Google Sheets.
+	ExportXLSX ExportFormat = "xlsx"
+)
+
+// IsValid reports whether the format is one of the known export formats.
+func (f ExportFormat) IsValid() bool {
+	return f == ExportCSV || f == ExportJSONL || f == ExportXLSX
+}
+
+// ExportTransaction is a row of the transactions export: a Transaction that is not split, or a
+// line of a split Transaction, with the amount and the CatBud of the line.
+type ExportTransaction struct {
+	// ID of the Transaction
+	TransactionID snowflake.ID
+	// ID of the split line, null for a Transaction that is not split
+	SplitID *snowflake.ID
+	// ID of the Aibo the Transaction belongs to
+	AiboID uuid.UUID
+	// Day the Transaction happened on
+	Date time.Time
+	// Kind of the Transaction
+	Kind TransactionKind
+	// Whether the Transaction counts in the budgets, waits for approval or was rejected
+	Status TransactionStatus
+	// Amount of the Transaction or of the line, in its currency
+	Amount Money
+	// ISO 4217 currency of the amount
+	Currency Currency
+	// Amount converted into the base currency of the Aibo
+	BaseAmount Money
+	// Who was paid, or who paid
+	Payee string
+	// Note of the line, or of the Transaction when the line has none
+	Note string
+	// Tags of the Transaction
+	Tags Tags
+	// ID of the CatBud the Transaction or the line is booked on (can be null)
+	CatBudID *snowflake.ID
+	// Name of the CatBud, empty when there is none
+	Category string
+	// Name of the parent of the CatBud, empty for a top-level category
+	CategoryGroup string
+	// ID of the RecurringRule that generated the Transaction (can be null)
+	RecurringRuleID *snowflake.ID
+	// ID of the ImportBatch the Transaction was imported with (can be null)
+	ImportBatchID *snowflake.ID
+	// Identifier given to the Transaction by the bank it was imported from
+	ExternalID string
+}
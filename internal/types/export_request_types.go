@@ -0,0 +1,25 @@
+package types
+
+// ExportRequest represents the query parameters of an export
+// @Description Export query structure
+type ExportRequest struct {
+	// File format: csv (default), jsonl or xlsx
+	// @example xlsx
+	Format ExportFormat `form:"format"`
+	// First day of the range (format: YYYY-MM-DD), defaults to the first day of the current month
+	// @example 2024-01-01
+	From string `form:"from"`
+	// Last day of the range (format: YYYY-MM-DD), defaults to the last day of the current month
+	// @example 2024-12-31
+	To string `form:"to"`
+	// Comma-separated columns, in the order of the file, defaults to the main columns
+	// @example date,payee,amount,currency,category
+	Columns string `form:"columns"`
+	// Locale the numbers and dates are written for (CSV and XLSX), such as en-US or de-DE,
+	// defaults to ISO 8601 dates and decimal points
+	// @example de-DE
+	Locale string `form:"locale"`
+	// Only export the amounts booked on the CatBuds shared by this Household
+	// @example 550e8400-e29b-41d4-a716-446655440000
+	HouseholdID string `form:"household_id"`
+}
@@ -0,0 +1,207 @@
+package types
+
+import (
+	"math"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// ForecastLookbackDays is how many days of history the daily spending pattern is learned from.
+const ForecastLookbackDays = 90
+
+// ForecastConfidence is the probability that the final spending of a period falls within the
+// confidence range of its Forecast.
+const ForecastConfidence = 0.8
+
+// forecastZ is the normal quantile matching ForecastConfidence on both sides.
+const forecastZ = 1.2816
+
+// SpendingPattern summarizes the discretionary spending of the last days: the amounts that were
+// not generated by a RecurringRule, as those are forecast from the rules themselves.
+type SpendingPattern struct {
+	// Days is the number of days observed, days without spending included.
+	Days int
+	// Total is the net amount spent over the days.
+	Total Money
+	// SumSquares is the sum of the squared net amounts of each day, in squared currency units.
+	SumSquares float64
+}
+
+// ForecastHistory returns the first and last days of the history the spending pattern is learned
+// from on today: the last ForecastLookbackDays days, ending the day before today since today is
+// not over yet.
+func ForecastHistory(today time.Time) (time.Time, time.Time) {
+	last := truncateDay(today).AddDate(0, 0, -1)
+	return last.AddDate(0, 0, 1-ForecastLookbackDays), last
+}
+
+// NewSpendingPattern builds the pattern of a budget created at createdAt, from the net amounts
+// spent over the history of today and the first day with spending, if any. The history starts at
+// the most recent of the start of the ForecastHistory window and the creation of the budget, or
+// at the first day with spending when that is earlier.
+func NewSpendingPattern(today, createdAt time.Time, firstDay *time.Time, total Money, sumSquares float64) SpendingPattern {
+	from, to := ForecastHistory(today)
+	start := truncateDay(createdAt.UTC())
+	if firstDay != nil && truncateDay(*firstDay).Before(start) {
+		start = truncateDay(*firstDay)
+	}
+	if start.Before(from) {
+		start = from
+	}
+	if start.After(to) {
+		return SpendingPattern{}
+	}
+	return SpendingPattern{Days: PeriodDays(start, to), Total: total, SumSquares: sumSquares}
+}
+
+// Mean returns the average net amount spent per day.
+func (p SpendingPattern) Mean() Money {
+	if p.Days <= 0 {
+		return 0
+	}
+	return p.Total.Div(int64(p.Days))
+}
+
+// StdDev returns the standard deviation of the net amount spent per day, in currency units.
+func (p SpendingPattern) StdDev() float64 {
+	if p.Days <= 0 {
+		return 0
+	}
+	mean := p.Total.Float64() / float64(p.Days)
+	variance := p.SumSquares/float64(p.Days) - mean*mean
+	if variance <= 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// ScheduledAmount is a known amount to come on a given day, such as the occurrence of a
+// RecurringRule, signed as it weighs on spending and in the currency of the forecast.
+type ScheduledAmount struct {
+	Date   time.Time
+	Amount Money
+}
+
+// Forecast projects the spending of a budget to the end of its current period
+// @Description End-of-period spending projection of a budget
+type Forecast struct {
+	// ID of the CatBud, null for the forecast of the daily budget
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Name of the category, empty for the forecast of the daily budget
+	Category string `json:"category"`
+	// First day of the period
+	PeriodStart time.Time `json:"period_start"`
+	// Last day of the period
+	PeriodEnd time.Time `json:"period_end"`
+	// Amount available for the period (budget plus carried over), null when there is no budget
+	Budget *Money `json:"budget" swaggertype:"string"`
+	// Net amount spent so far in the period
+	Spent Money `json:"spent" swaggertype:"string"`
+	// Average discretionary net amount spent per day over the history
+	DailyPace Money `json:"daily_pace" swaggertype:"string"`
+	// Number of days of history the pace is learned from; a short history gives a rough forecast
+	HistoryDays int `json:"history_days"`
+	// Net amount of the recurring transactions still to come in the period
+	Recurring Money `json:"recurring" swaggertype:"string"`
+	// Projected net amount spent by the end of the period
+	Projected Money `json:"projected" swaggertype:"string"`
+	// Lower bound of the confidence range of the projection
+	ProjectedLow Money `json:"projected_low" swaggertype:"string"`
+	// Upper bound of the confidence range of the projection
+	ProjectedHigh Money `json:"projected_high" swaggertype:"string"`
+	// Budget minus projected, negative when an overspend is expected, null when there is no budget
+	ProjectedRemaining *Money `json:"projected_remaining" swaggertype:"string"`
+	// Probability that the spending of the period goes over the budget, null when there is no budget
+	OverspendProbability *float64 `json:"overspend_probability"`
+	// Day the budget is expected to run out, today when it already has, null when it is expected to
+	// last until the end of the period or when there is no budget
+	ExhaustionDate *time.Time `json:"exhaustion_date"`
+}
+
+// Project fills the projection of the Forecast from its period, budget and spent amount, the
+// discretionary spending pattern and the recurring amounts still to come.
+//
+// The rest of the period is projected at the average daily pace of the pattern, plus the scheduled
+// amounts. The confidence range assumes the days are independent, and the budget is expected to
+// run out on the first day the projected spending reaches it.
+func (f *Forecast) Project(today time.Time, pattern SpendingPattern, scheduled []ScheduledAmount) {
+	today = truncateDay(today)
+	remainingDays := 0
+	if f.PeriodEnd.After(today) {
+		remainingDays = PeriodDays(today, f.PeriodEnd) - 1
+	}
+
+	f.DailyPace = pattern.Mean()
+	f.HistoryDays = pattern.Days
+	byDay := make(map[time.Time]Money, len(scheduled))
+	f.Recurring = 0
+	for _, item := range scheduled {
+		day := truncateDay(item.Date)
+		if day.After(f.PeriodEnd) {
+			continue
+		}
+		// An occurrence that is due but not in the ledger yet is booked as soon as possible.
+		if !day.After(today) {
+			day = today
+		}
+		byDay[day] += item.Amount
+		f.Recurring += item.Amount
+	}
+
+	discretionary := f.DailyPace * Money(remainingDays)
+	f.Projected = f.Spent + f.Recurring + discretionary
+
+	spread := MoneyFromFloat(forecastZ * pattern.StdDev() * math.Sqrt(float64(remainingDays)))
+	f.ProjectedLow = f.Projected - spread
+	f.ProjectedHigh = f.Projected + spread
+	if floor := f.Spent + f.Recurring + min(discretionary, 0); f.ProjectedLow < floor {
+		f.ProjectedLow = floor
+	}
+
+	f.ProjectedRemaining, f.OverspendProbability, f.ExhaustionDate = nil, nil, nil
+	if f.Budget == nil {
+		return
+	}
+	remaining := *f.Budget - f.Projected
+	f.ProjectedRemaining = &remaining
+
+	probability := 0.0
+	if spread > 0 {
+		sigma := spread.Float64() / forecastZ
+		z := (*f.Budget - f.Projected).Float64() / sigma
+		probability = 0.5 * math.Erfc(z/math.Sqrt2)
+	} else if f.Projected > *f.Budget {
+		probability = 1
+	}
+	probability = math.Round(probability*100) / 100
+	f.OverspendProbability = &probability
+
+	spent := f.Spent + byDay[today]
+	for day := today; ; day = day.AddDate(0, 0, 1) {
+		if day.After(today) {
+			spent += f.DailyPace + byDay[day]
+		}
+		if spent >= *f.Budget && spent > 0 {
+			exhaustion := day
+			f.ExhaustionDate = &exhaustion
+			return
+		}
+		if !day.Before(f.PeriodEnd) {
+			return
+		}
+	}
+}
+
+// ForecastReport projects the spending of the daily budget and of the CatBuds to the end of their
+// periods
+// @Description End-of-period spending forecast
+type ForecastReport struct {
+	// Day the forecast is made on, the open budget day of the aibo
+	Today time.Time `json:"today"`
+	// Forecast of the daily budget over the current month, null when the aibo has no daily budget
+	// or the report is about a household
+	DailyBudget *Forecast `json:"daily_budget"`
+	// Forecast of each CatBud over its current period
+	CatBuds []Forecast `json:"cat_buds"`
+}
@@ -0,0 +1,170 @@
+package types
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSpendingPattern(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    SpendingPattern
+		wantMean   Money
+		wantStdDev float64
+	}{
+		{"no history", SpendingPattern{}, 0, 0},
+		{"steady", SpendingPattern{Days: 10, Total: 10000, SumSquares: 10 * 10 * 10}, 1000, 0},
+		{"alternating 5.00 and 15.00", SpendingPattern{Days: 10, Total: 10000, SumSquares: 5*5*5 + 5*15*15}, 1000, 5},
+		{"rounded mean", SpendingPattern{Days: 3, Total: 1000, SumSquares: 100.0 / 3}, 333, 0},
+		{"net income", SpendingPattern{Days: 4, Total: -2000, SumSquares: 4 * 5 * 5}, -500, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.pattern.Mean(); got != tt.wantMean {
+			t.Errorf("%s: Mean = %v, want %v", tt.name, got, tt.wantMean)
+		}
+		if got := tt.pattern.StdDev(); math.Abs(got-tt.wantStdDev) > 1e-9 {
+			t.Errorf("%s: StdDev = %v, want %v", tt.name, got, tt.wantStdDev)
+		}
+	}
+}
+
+func TestForecastHistory(t *testing.T) {
+	from, to := ForecastHistory(time.Date(2024, 6, 10, 15, 30, 0, 0, time.UTC))
+	if !from.Equal(date(2024, 3, 12)) || !to.Equal(date(2024, 6, 9)) {
+		t.Fatalf("ForecastHistory = %v, %v, want 2024-03-12, 2024-06-09", from, to)
+	}
+	if days := PeriodDays(from, to); days != ForecastLookbackDays {
+		t.Fatalf("history of %d days, want %d", days, ForecastLookbackDays)
+	}
+}
+
+func TestNewSpendingPattern(t *testing.T) {
+	today := date(2024, 6, 10)
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		firstDay  *time.Time
+		wantDays  int
+	}{
+		{"old budget", date(2023, 1, 1), datePtr(2024, 3, 20), ForecastLookbackDays},
+		{"created last week", date(2024, 6, 3), datePtr(2024, 6, 4), 7},
+		{"spending before the creation", date(2024, 6, 3), datePtr(2024, 6, 1), 9},
+		{"created yesterday", time.Date(2024, 6, 9, 22, 0, 0, 0, time.UTC), nil, 1},
+		{"created today", date(2024, 6, 10), nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := NewSpendingPattern(today, tt.createdAt, tt.firstDay, 5000, 250)
+			if pattern.Days != tt.wantDays {
+				t.Fatalf("Days = %d, want %d", pattern.Days, tt.wantDays)
+			}
+			if tt.wantDays == 0 && (pattern.Total != 0 || pattern.SumSquares != 0) {
+				t.Fatalf("pattern = %+v, want no history", pattern)
+			}
+			if tt.wantDays > 0 && (pattern.Total != 5000 || pattern.SumSquares != 250) {
+				t.Fatalf("pattern = %+v, want the amounts kept", pattern)
+			}
+		})
+	}
+}
+
+func TestForecastProject(t *testing.T) {
+	today := date(2024, 3, 21)
+	steady := SpendingPattern{Days: 10, Total: 10000, SumSquares: 1000}
+	varying := SpendingPattern{Days: 10, Total: 10000, SumSquares: 1250}
+	probability := func(p float64) *float64 { return &p }
+
+	tests := []struct {
+		name            string
+		budget          *Money
+		spent           Money
+		pattern         SpendingPattern
+		scheduled       []ScheduledAmount
+		today           time.Time
+		wantRecurring   Money
+		wantProjected   Money
+		wantLow         Money
+		wantHigh        Money
+		wantRemaining   *Money
+		wantProbability *float64
+		wantExhaustion  *time.Time
+	}{
+		{
+			name: "no budget", spent: 20000, pattern: steady, today: today,
+			wantProjected: 30000, wantLow: 30000, wantHigh: 30000,
+		},
+		{
+			name: "runs out", budget: moneyPtr(25000), spent: 20000, pattern: steady, today: today,
+			wantProjected: 30000, wantLow: 30000, wantHigh: 30000,
+			wantRemaining: moneyPtr(-5000), wantProbability: probability(1), wantExhaustion: datePtr(2024, 3, 26),
+		},
+		{
+			name: "lasts with a confidence range", budget: moneyPtr(40000), spent: 20000, pattern: varying, today: today,
+			wantProjected: 30000, wantLow: 27974, wantHigh: 32026,
+			wantRemaining: moneyPtr(10000), wantProbability: probability(0),
+		},
+		{
+			name: "close to the budget", budget: moneyPtr(30000), spent: 20000, pattern: varying, today: today,
+			wantProjected: 30000, wantLow: 27974, wantHigh: 32026,
+			wantRemaining: moneyPtr(0), wantProbability: probability(0.5), wantExhaustion: datePtr(2024, 3, 31),
+		},
+		{
+			name: "scheduled amounts", spent: 20000, pattern: steady, today: today,
+			scheduled: []ScheduledAmount{
+				{Date: date(2024, 3, 25), Amount: 5000},
+				{Date: date(2024, 3, 19), Amount: 1000},
+				{Date: date(2024, 4, 2), Amount: 9000},
+			},
+			wantRecurring: 6000, wantProjected: 36000, wantLow: 36000, wantHigh: 36000,
+		},
+		{
+			name: "overdue amount runs the budget out today", budget: moneyPtr(21000), spent: 20000, pattern: steady, today: today,
+			scheduled:     []ScheduledAmount{{Date: date(2024, 3, 19), Amount: 1000}},
+			wantRecurring: 1000, wantProjected: 31000, wantLow: 31000, wantHigh: 31000,
+			wantRemaining: moneyPtr(-10000), wantProbability: probability(1), wantExhaustion: datePtr(2024, 3, 21),
+		},
+		{
+			name: "already overspent", budget: moneyPtr(15000), spent: 20000, pattern: steady, today: today,
+			wantProjected: 30000, wantLow: 30000, wantHigh: 30000,
+			wantRemaining: moneyPtr(-15000), wantProbability: probability(1), wantExhaustion: datePtr(2024, 3, 21),
+		},
+		{
+			name: "last day", budget: moneyPtr(25000), spent: 20000, pattern: varying, today: date(2024, 3, 31),
+			wantProjected: 20000, wantLow: 20000, wantHigh: 20000,
+			wantRemaining: moneyPtr(5000), wantProbability: probability(0),
+		},
+		{
+			name: "net income", spent: 20000, pattern: SpendingPattern{Days: 10, Total: -5000, SumSquares: 250}, today: today,
+			wantProjected: 15000, wantLow: 15000, wantHigh: 15000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forecast := Forecast{PeriodStart: date(2024, 3, 1), PeriodEnd: date(2024, 3, 31), Budget: tt.budget, Spent: tt.spent}
+			forecast.Project(tt.today, tt.pattern, tt.scheduled)
+
+			if forecast.Recurring != tt.wantRecurring || forecast.Projected != tt.wantProjected ||
+				forecast.ProjectedLow != tt.wantLow || forecast.ProjectedHigh != tt.wantHigh {
+				t.Errorf("recurring %v, projected %v [%v, %v], want %v, %v [%v, %v]",
+					forecast.Recurring, forecast.Projected, forecast.ProjectedLow, forecast.ProjectedHigh,
+					tt.wantRecurring, tt.wantProjected, tt.wantLow, tt.wantHigh)
+			}
+			if (forecast.ProjectedRemaining == nil) != (tt.wantRemaining == nil) ||
+				tt.wantRemaining != nil && *forecast.ProjectedRemaining != *tt.wantRemaining {
+				t.Errorf("ProjectedRemaining = %v, want %v", forecast.ProjectedRemaining, tt.wantRemaining)
+			}
+			if (forecast.OverspendProbability == nil) != (tt.wantProbability == nil) ||
+				tt.wantProbability != nil && *forecast.OverspendProbability != *tt.wantProbability {
+				t.Errorf("OverspendProbability = %v, want %v", forecast.OverspendProbability, tt.wantProbability)
+			}
+			if (forecast.ExhaustionDate == nil) != (tt.wantExhaustion == nil) ||
+				tt.wantExhaustion != nil && !forecast.ExhaustionDate.Equal(*tt.wantExhaustion) {
+				t.Errorf("ExhaustionDate = %v, want %v", forecast.ExhaustionDate, tt.wantExhaustion)
+			}
+			if forecast.DailyPace != tt.pattern.Mean() || forecast.HistoryDays != tt.pattern.Days {
+				t.Errorf("DailyPace = %v, HistoryDays = %d", forecast.DailyPace, forecast.HistoryDays)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// InvitationTTL is how long a household invitation can be answered.
+const InvitationTTL = 14 * 24 * time.Hour
+
+// HouseholdRole is the role of a member in a Household.
+type HouseholdRole string
+
+const (
+	// RoleViewer can see the shared CatBuds and their balances.
+	RoleViewer HouseholdRole = "viewer"
+	// RoleEditor can also book transactions on the shared CatBuds and manage them.
+	RoleEditor HouseholdRole = "editor"
+	// RoleOwner can also manage the household, its members and its invitations.
+	RoleOwner HouseholdRole = "owner"
+)
+
+// householdRoleRanks orders the roles from the least to the most privileged.
+var householdRoleRanks = map[HouseholdRole]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// IsValid reports whether the role is one of the known household roles.
+func (r HouseholdRole) IsValid() bool {
+	_, ok := householdRoleRanks[r]
+	return ok
+}
+
+// Allows reports whether the role grants at least the rights of the required role.
+// The empty role, used for non-members, allows nothing.
+func (r HouseholdRole) Allows(required HouseholdRole) bool {
+	return householdRoleRanks[r] > 0 && householdRoleRanks[r] >= householdRoleRanks[required]
+}
+
+// InvitationStatus is the state of a household invitation.
+type InvitationStatus string
+
+const (
+	// InvitationPending is waiting for an answer.
+	InvitationPending InvitationStatus = "pending"
+	// InvitationAccepted made the invitee a member.
+	InvitationAccepted InvitationStatus = "accepted"
+	// InvitationDeclined was refused by the invitee.
+	InvitationDeclined InvitationStatus = "declined"
+	// InvitationRevoked was withdrawn by an owner of the household.
+	InvitationRevoked InvitationStatus = "revoked"
+)
+
+// Household is a budget shared by several Aibos, owning the CatBuds they manage together
+// @Description Shared household budget model
+type Household struct {
+	// Unique identifier for the Household
+	ID uuid.UUID `gorm:"type:char(36);primaryKey" json:"id" swaggertype:"string" format:"uuid"`
+	// Name of the household
+	Name string `gorm:"type:varchar(255);not null" json:"name"`
+	// ISO 4217 currency of the shared CatBuds, approval thresholds and forecasts of the household
+	Currency Currency `gorm:"type:char(3);not null;default:'EUR'" json:"currency" swaggertype:"string" example:"EUR"`
+	// Members of the household with their roles
+	Members []HouseholdMember `gorm:"foreignKey:HouseholdID" json:"members,omitempty"`
+	// Timestamp of when the Household was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the Household was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// HouseholdMember is the membership of an Aibo in a Household
+// @Description Household membership model
+type HouseholdMember struct {
+	// Unique identifier for the HouseholdMember
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Household
+	HouseholdID uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_household_members_aibo,priority:1" json:"household_id" swaggertype:"string" format:"uuid"`
+	// ID of the member Aibo
+	AiboID uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_household_members_aibo,priority:2;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Email of the member Aibo
+	Email string `gorm:"->;-:migration" json:"email,omitempty"`
+	// Role of the member (owner, editor or viewer)
+	Role HouseholdRole `gorm:"type:varchar(16);not null" json:"role" enums:"owner,editor,viewer"`
+	// Timestamp of when the Aibo joined the household
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"joined_at"`
+}
+
+// HouseholdInvitation invites the owner of an email address to join a Household
+// @Description Household invitation model
+type HouseholdInvitation struct {
+	// Unique identifier for the HouseholdInvitation
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Household
+	HouseholdID uuid.UUID `gorm:"type:char(36);not null;index" json:"household_id" swaggertype:"string" format:"uuid"`
+	// Name of the Household
+	HouseholdName string `gorm:"-" json:"household_name,omitempty"`
+	// Email address of the invitee, in lower case
+	Email string `gorm:"type:varchar(255);not null;index" json:"email"`
+	// Role the invitee gets when accepting
+	Role HouseholdRole `gorm:"type:varchar(16);not null" json:"role" enums:"owner,editor,viewer"`
+	// ID of the Aibo who sent the invitation
+	InvitedBy uuid.UUID `gorm:"type:char(36);not null" json:"invited_by" swaggertype:"string" format:"uuid"`
+	// State of the invitation (pending, accepted, declined or revoked)
+	Status InvitationStatus `gorm:"type:varchar(16);not null;default:'pending'" json:"status" enums:"pending,accepted,declined,revoked"`
+	// Timestamp after which the invitation can no longer be accepted
+	ExpiresAt time.Time `gorm:"type:datetime;not null" json:"expires_at"`
+	// Timestamp of when the invitation was answered or revoked
+	RespondedAt *time.Time `gorm:"type:datetime;default:null" json:"responded_at"`
+	// Timestamp of when the invitation was emailed to the invitee
+	EmailedAt *time.Time `gorm:"type:datetime;default:null;index" json:"-"`
+	// Timestamp of when the invitation was sent
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// IsOpen reports whether the invitation can still be answered at the given time.
+func (i *HouseholdInvitation) IsOpen(now time.Time) bool {
+	return i.Status == InvitationPending && now.Before(i.ExpiresAt)
+}
+
+// HouseholdLine is an amount booked on a CatBud of a Household, in the currency of its transaction.
+type HouseholdLine struct {
+	Kind     TransactionKind
+	Amount   Money
+	Currency Currency
+	Date     time.Time
+}
+
+// SumHouseholdLines converts each line into the currency of the Household at the rate returned for
+// its currency and day, and adds the converted amounts, incomes counting negatively.
+//
+// The members of a Household may keep their books in different base currencies, so the lines are
+// converted one by one instead of adding their base amounts.
+func SumHouseholdLines(lines []HouseholdLine, rate func(from Currency, day time.Time) (float64, error)) (Money, error) {
+	var total Money
+	for _, line := range lines {
+		factor, err := rate(line.Currency, line.Date)
+		if err != nil {
+			return 0, err
+		}
+		amount := line.Amount.Mul(factor)
+		if line.Kind == TransactionIncome {
+			amount = -amount
+		}
+		total += amount
+	}
+	return total, nil
+}
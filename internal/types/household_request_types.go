@@ -0,0 +1,78 @@
+package types
+
+// CreateHouseholdRequest represents the request to create a Household
+// @Description Create household request structure
+type CreateHouseholdRequest struct {
+	// Name of the household
+	// @example Home
+	Name string `json:"name" binding:"required,max=255"`
+	// ISO 4217 currency of the household, defaults to the base currency of the creator
+	// @example EUR
+	Currency Currency `json:"currency"`
+}
+
+// UpdateHouseholdRequest represents the request to rename a Household or change its currency
+// @Description Update household request structure
+type UpdateHouseholdRequest struct {
+	// New name of the household
+	// @example Flat share
+	Name string `json:"name" binding:"required,max=255"`
+	// New ISO 4217 currency of the household (optional). The budgets and thresholds are not
+	// converted.
+	// @example USD
+	Currency Currency `json:"currency"`
+}
+
+// CreateInvitationRequest represents the request to invite someone to a Household
+// @Description Create household invitation request structure
+type CreateInvitationRequest struct {
+	// Email address of the invitee
+	// @example partner@example.com
+	Email string `json:"email" binding:"required,email"`
+	// Role the invitee gets when accepting (owner, editor or viewer), defaults to editor
+	// @example editor
+	Role HouseholdRole `json:"role"`
+}
+
+// UpdateMemberRequest represents the request to change the role of a Household member
+// @Description Update household member request structure
+type UpdateMemberRequest struct {
+	// New role of the member (owner, editor or viewer)
+	// @example viewer
+	Role HouseholdRole `json:"role" binding:"required"`
+}
+
+// HouseholdResponse represents the response containing a single Household
+// @Description Single household response structure
+type HouseholdResponse struct {
+	// The household with its members
+	Household Household `json:"household"`
+}
+
+// ListHouseholdsResponse represents the response containing the Households of an Aibo
+// @Description List households response structure
+type ListHouseholdsResponse struct {
+	// Households the Aibo is a member of
+	Households []Household `json:"households"`
+}
+
+// HouseholdMemberResponse represents the response containing a single Household member
+// @Description Single household member response structure
+type HouseholdMemberResponse struct {
+	// The member
+	Member HouseholdMember `json:"member"`
+}
+
+// InvitationResponse represents the response containing a single Household invitation
+// @Description Single household invitation response structure
+type InvitationResponse struct {
+	// The invitation
+	Invitation HouseholdInvitation `json:"invitation"`
+}
+
+// ListInvitationsResponse represents the response containing multiple Household invitations
+// @Description List household invitations response structure
+type ListInvitationsResponse struct {
+	// Invitations, most recent first
+	Invitations []HouseholdInvitation `json:"invitations"`
+}
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHouseholdRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     HouseholdRole
+		required HouseholdRole
+		want     bool
+	}{
+		{RoleOwner, RoleOwner, true},
+		{RoleOwner, RoleEditor, true},
+		{RoleOwner, RoleViewer, true},
+		{RoleEditor, RoleOwner, false},
+		{RoleEditor, RoleEditor, true},
+		{RoleEditor, RoleViewer, true},
+		{RoleViewer, RoleEditor, false},
+		{RoleViewer, RoleViewer, true},
+		{"", RoleViewer, false},
+		{"", "", false},
+		{"admin", RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestHouseholdInvitationIsOpen(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status InvitationStatus
+		expiry time.Time
+		want   bool
+	}{
+		{"pending", InvitationPending, now.Add(time.Hour), true},
+		{"expired", InvitationPending, now.Add(-time.Hour), false},
+		{"expiring now", InvitationPending, now, false},
+		{"accepted", InvitationAccepted, now.Add(time.Hour), false},
+		{"declined", InvitationDeclined, now.Add(time.Hour), false},
+		{"revoked", InvitationRevoked, now.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		invitation := HouseholdInvitation{Status: tt.status, ExpiresAt: tt.expiry}
+		if got := invitation.IsOpen(now); got != tt.want {
+			t.Errorf("%s: IsOpen = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSumHouseholdLines(t *testing.T) {
+	// Rates into EUR: one USD is 0.90 EUR until June and 0.92 EUR from June.
+	rate := func(from Currency, day time.Time) (float64, error) {
+		switch {
+		case from == "EUR":
+			return 1, nil
+		case from == "USD" && day.Before(date(2024, 6, 1)):
+			return 0.90, nil
+		case from == "USD":
+			return 0.92, nil
+		}
+		return 0, errors.New("no rate")
+	}
+
+	tests := []struct {
+		name    string
+		lines   []HouseholdLine
+		want    Money
+		wantErr bool
+	}{
+		{"no line", nil, 0, false},
+		{"same currency", []HouseholdLine{
+			{Kind: TransactionExpense, Amount: 1000, Currency: "EUR", Date: date(2024, 5, 1)},
+			{Kind: TransactionExpense, Amount: 250, Currency: "EUR", Date: date(2024, 5, 2)},
+		}, 1250, false},
+		{"members in different currencies", []HouseholdLine{
+			{Kind: TransactionExpense, Amount: 1000, Currency: "EUR", Date: date(2024, 5, 1)},
+			{Kind: TransactionExpense, Amount: 1000, Currency: "USD", Date: date(2024, 5, 1)},
+		}, 1900, false},
+		{"rate of the day of each line", []HouseholdLine{
+			{Kind: TransactionExpense, Amount: 1000, Currency: "USD", Date: date(2024, 5, 31)},
+			{Kind: TransactionExpense, Amount: 1000, Currency: "USD", Date: date(2024, 6, 1)},
+		}, 1820, false},
+		{"income counts negatively", []HouseholdLine{
+			{Kind: TransactionExpense, Amount: 5000, Currency: "EUR", Date: date(2024, 5, 1)},
+			{Kind: TransactionIncome, Amount: 1000, Currency: "USD", Date: date(2024, 5, 1)},
+		}, 4100, false},
+		{"each line rounded to the cent", []HouseholdLine{
+			{Kind: TransactionExpense, Amount: 1, Currency: "USD", Date: date(2024, 5, 1)},
+			{Kind: TransactionExpense, Amount: 1, Currency: "USD", Date: date(2024, 5, 1)},
+		}, 2, false},
+		{"missing rate", []HouseholdLine{
+			{Kind: TransactionExpense, Amount: 1000, Currency: "GBP", Date: date(2024, 5, 1)},
+		}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SumHouseholdLines(tt.lines, rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SumHouseholdLines = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
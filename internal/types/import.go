@@ -0,0 +1,400 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// ImportSource is the kind of file a batch of transactions was imported from.
+type ImportSource string
+
+const (
+	// ImportSourceCSV is a bank statement exported as CSV.
+	ImportSourceCSV ImportSource = "csv"
+	// ImportSourceOFX is an Open Financial Exchange statement, SGML (1.x) or XML (2.x).
+	ImportSourceOFX ImportSource = "ofx"
+	// ImportSourceQFX is the OFX statement of a bank for Quicken.
+	ImportSourceQFX ImportSource = "qfx"
+	// ImportSourceQIF is a statement in the legacy Quicken Interchange Format.
+	ImportSourceQIF ImportSource = "qif"
+	// ImportSourceYNAB is the export of a YNAB budget: its register and its plan.
+	ImportSourceYNAB ImportSource = "ynab"
+	// ImportSourceMint is the transactions export of Mint.
+	ImportSourceMint ImportSource = "mint"
+	// ImportSourceActual is the transactions export of Actual Budget, as CSV.
+	ImportSourceActual ImportSource = "actual"
+)
+
+// IsMigration reports whether the source is the export of another budgeting app, bringing the
+// history of the Aibo along with its categories, rather than a bank statement.
+func (s ImportSource) IsMigration() bool {
+	return s == ImportSourceYNAB || s == ImportSourceMint || s == ImportSourceActual
+}
+
+// ImportUnmappedKind is the kind of item of an export left out of an import.
+type ImportUnmappedKind string
+
+const (
+	// ImportUnmappedTransfer moves money between two accounts of the app and is not spending.
+	ImportUnmappedTransfer ImportUnmappedKind = "transfer"
+	// ImportUnmappedStartingBalance opens an account of the app and is not income.
+	ImportUnmappedStartingBalance ImportUnmappedKind = "starting_balance"
+	// ImportUnmappedCategory is a category of the app no CatBud is created for.
+	ImportUnmappedCategory ImportUnmappedKind = "category"
+	// ImportUnmappedBudget is a budget of the app that is not applied.
+	ImportUnmappedBudget ImportUnmappedKind = "budget"
+)
+
+// ImportRowStatus tells what importing a parsed row does.
+type ImportRowStatus string
+
+const (
+	// ImportRowNew is recorded as a new transaction.
+	ImportRowNew ImportRowStatus = "new"
+	// ImportRowDuplicate matches a transaction already in the ledger and is left out.
+	ImportRowDuplicate ImportRowStatus = "duplicate"
+	// ImportRowInvalid could not be parsed and is left out.
+	ImportRowInvalid ImportRowStatus = "invalid"
+)
+
+// DateFormats maps the date formats understood by the imports to their Go layouts.
+var DateFormats = map[string]string{
+	"YYYY-MM-DD": "2006-01-02",
+	"YYYY/MM/DD": "2006/01/02",
+	"YYYYMMDD":   "20060102",
+	"DD.MM.YYYY": "02.01.2006",
+	"D.M.YYYY":   "2.1.2006",
+	"DD/MM/YYYY": "02/01/2006",
+	"MM/DD/YYYY": "01/02/2006",
+	"D/M/YYYY":   "2/1/2006",
+	"M/D/YYYY":   "1/2/2006",
+	"DD-MM-YYYY": "02-01-2006",
+	"MM-DD-YYYY": "01-02-2006",
+	"DD.MM.YY":   "02.01.06",
+	"DD/MM/YY":   "02/01/06",
+	"MM/DD/YY":   "01/02/06",
+}
+
+// ImportEncodings are the character encodings understood by the imports.
+var ImportEncodings = []string{"utf-8", "utf-16le", "utf-16be", "windows-1252", "iso-8859-1", "iso-8859-15"}
+
+// CSVFormat describes how to read the CSV export of a bank. The empty fields are detected from
+// the file.
+//
+// A column is given by its name in the header, or by its position from 1 when the file has no
+// header. The amount is either in a single signed column, negative for expenses, or in separate
+// debit and credit columns.
+type CSVFormat struct {
+	// Character encoding of the file
+	Encoding string `gorm:"type:varchar(16)" json:"encoding" form:"encoding" enums:"utf-8,utf-16le,utf-16be,windows-1252,iso-8859-1,iso-8859-15"`
+	// Field delimiter
+	Delimiter string `gorm:"type:varchar(4)" json:"delimiter" form:"delimiter" example:";"`
+	// Number of lines before the header, or before the first row without header
+	SkipRows int `gorm:"not null;default:0" json:"skip_rows" form:"skip_rows"`
+	// Whether the first row names the columns, null to detect it
+	HasHeader *bool `gorm:"default:null" json:"has_header" form:"has_header"`
+	// Column of the day of the transaction
+	DateColumn string `gorm:"type:varchar(100)" json:"date_column" form:"date_column" example:"Booking date"`
+	// Column of the signed amount
+	AmountColumn string `gorm:"type:varchar(100)" json:"amount_column" form:"amount_column" example:"Amount"`
+	// Column of the amounts paid out, instead of a signed amount
+	DebitColumn string `gorm:"type:varchar(100)" json:"debit_column" form:"debit_column"`
+	// Column of the amounts paid in, instead of a signed amount
+	CreditColumn string `gorm:"type:varchar(100)" json:"credit_column" form:"credit_column"`
+	// Column of the payee
+	PayeeColumn string `gorm:"type:varchar(100)" json:"payee_column" form:"payee_column" example:"Counterparty"`
+	// Column of the note
+	NoteColumn string `gorm:"type:varchar(100)" json:"note_column" form:"note_column"`
+	// Column of the ISO 4217 currency of the amount
+	CurrencyColumn string `gorm:"type:varchar(100)" json:"currency_column" form:"currency_column"`
+	// Column of the category, matched against the names of the CatBuds
+	CategoryColumn string `gorm:"type:varchar(100)" json:"category_column" form:"category_column"`
+	// Format of the dates, one of the keys of DateFormats
+	DateFormat string `gorm:"type:varchar(16)" json:"date_format" form:"date_format" example:"DD.MM.YYYY"`
+	// Decimal separator of the amounts, "." or ","
+	DecimalSeparator string `gorm:"type:varchar(1)" json:"decimal_separator" form:"decimal_separator" example:","`
+	// Whether the signed amounts are positive for expenses, as on some credit card statements
+	InvertAmounts bool `gorm:"not null" json:"invert_amounts" form:"invert_amounts"`
+	// Currency of the amounts when the file has no currency column, defaults to the base currency
+	Currency Currency `gorm:"type:char(3)" json:"currency" form:"currency" swaggertype:"string" example:"EUR"`
+}
+
+// Merge fills the empty fields of the format with the fields of another one.
+func (f CSVFormat) Merge(other CSVFormat) CSVFormat {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&f.Encoding, other.Encoding)
+	fill(&f.Delimiter, other.Delimiter)
+	fill(&f.DateColumn, other.DateColumn)
+	fill(&f.PayeeColumn, other.PayeeColumn)
+	fill(&f.NoteColumn, other.NoteColumn)
+	fill(&f.CurrencyColumn, other.CurrencyColumn)
+	fill(&f.CategoryColumn, other.CategoryColumn)
+	fill(&f.DateFormat, other.DateFormat)
+	fill(&f.DecimalSeparator, other.DecimalSeparator)
+	if f.AmountColumn == "" && f.DebitColumn == "" && f.CreditColumn == "" {
+		f.AmountColumn, f.DebitColumn, f.CreditColumn = other.AmountColumn, other.DebitColumn, other.CreditColumn
+	}
+	if f.SkipRows == 0 {
+		f.SkipRows = other.SkipRows
+	}
+	if f.HasHeader == nil {
+		f.HasHeader = other.HasHeader
+	}
+	if !f.InvertAmounts {
+		f.InvertAmounts = other.InvertAmounts
+	}
+	if f.Currency == "" {
+		f.Currency = other.Currency
+	}
+	return f
+}
+
+// Validate checks the fields of the format that are set. A delimiter written as \t is read as
+// a tab.
+func (f *CSVFormat) Validate() error {
+	if f.Encoding != "" {
+		known := false
+		for _, encoding := range ImportEncodings {
+			known = known || strings.EqualFold(f.Encoding, encoding)
+		}
+		if !known {
+			return fmt.Errorf("encoding must be one of %s", strings.Join(ImportEncodings, ", "))
+		}
+	}
+	if f.Delimiter != "" {
+		if f.Delimiter == `\t` {
+			f.Delimiter = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(f.Delimiter)
+		if size != len(f.Delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return errors.New("delimiter must be a single character other than a quote or a line break")
+		}
+	}
+	if f.SkipRows < 0 || f.SkipRows > 100 {
+		return errors.New("skip_rows must be between 0 and 100")
+	}
+	if f.AmountColumn != "" && (f.DebitColumn != "" || f.CreditColumn != "") {
+		return errors.New("amount_column cannot be combined with debit_column or credit_column")
+	}
+	if _, ok := DateFormats[f.DateFormat]; f.DateFormat != "" && !ok {
+		return errors.New("date_format is not supported")
+	}
+	if f.DecimalSeparator != "" && f.DecimalSeparator != "." && f.DecimalSeparator != "," {
+		return errors.New(`decimal_separator must be "." or ","`)
+	}
+	if f.Currency != "" && !f.Currency.IsSupported() {
+		return errors.New("currency must be an ISO 4217 currency code with two decimals")
+	}
+	return nil
+}
+
+// ImportMapping is the CSV format of a bank, saved by an Aibo to import its statements again
+// @Description Saved CSV column mapping
+type ImportMapping struct {
+	// Unique identifier for the ImportMapping
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo the mapping belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_import_mappings_aibo_name,priority:1" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Name of the mapping, such as the name of the bank
+	Name string `gorm:"type:varchar(100);not null;uniqueIndex:idx_import_mappings_aibo_name,priority:2" json:"name"`
+	CSVFormat
+	// ID of the CatBud the rows without a matching category are booked on (can be null)
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Timestamp of when the mapping was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the mapping was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// ImportBatch is a set of transactions imported together from a file
+// @Description Imported file
+type ImportBatch struct {
+	// Unique identifier for the ImportBatch
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo that imported the file
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Kind of file
+	Source ImportSource `gorm:"type:varchar(16);not null" json:"source" enums:"csv,ofx,qfx,qif,ynab,mint,actual"`
+	// Name of the uploaded file
+	FileName string `gorm:"type:varchar(255)" json:"file_name"`
+	// ID of the ImportMapping used to read the file (can be null)
+	MappingID *snowflake.ID `gorm:"type:bigint;default:null" json:"mapping_id" swaggertype:"integer"`
+	// ID of the ImportAccount the statement is of, null when the file holds the statements of
+	// several accounts (can be null)
+	ImportAccountID *snowflake.ID `gorm:"type:bigint;default:null" json:"import_account_id" swaggertype:"integer"`
+	// Number of transactions recorded
+	Imported int `gorm:"not null" json:"imported"`
+	// Number of rows left out because they were already in the ledger
+	Duplicates int `gorm:"not null" json:"duplicates"`
+	// Number of rows left out because they could not be parsed
+	Invalid int `gorm:"not null" json:"invalid"`
+	// Number of CatBuds created for the categories of another budgeting app
+	CatBuds int `gorm:"not null;default:0" json:"cat_buds"`
+	// Timestamp of when the file was imported
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the import was rolled back, null while it is not
+	RolledBackAt *time.Time `gorm:"type:datetime;default:null" json:"rolled_back_at"`
+}
+
+// ImportCategory is a category of another budgeting app, with the CatBud it is imported into
+// @Description Imported category
+type ImportCategory struct {
+	// Name of the group of the category, empty for a top-level category
+	Group string `json:"group" example:"Everyday Expenses"`
+	// Name of the category
+	Name string `json:"name" example:"Groceries"`
+	// Monthly budget of the category in the app, the most recent one (can be null)
+	Budget *Money `json:"budget" swaggertype:"string" example:"400.00"`
+	// ID of the CatBud the category is imported into, null until it is created
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Whether the import creates the CatBud, rather than using an existing one
+	Created bool `json:"created"`
+}
+
+// Key identifies the category by its group and name, without case.
+func (c ImportCategory) Key() string {
+	return ImportCategoryKey(c.Group, c.Name)
+}
+
+// ImportCategoryKey identifies a category by its group and name, without case.
+func ImportCategoryKey(group, name string) string {
+	return strings.ToLower(strings.TrimSpace(group)) + "/" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// ImportUnmapped is an item of the export of another budgeting app left out of the import, with
+// the reason
+// @Description Unmapped import item
+type ImportUnmapped struct {
+	// Kind of item
+	Kind ImportUnmappedKind `json:"kind" enums:"transfer,starting_balance,category,budget"`
+	// Name of the item, such as the category or the account
+	Name string `json:"name" example:"Credit Card Payments: Visa"`
+	// Number of rows of the item in the export
+	Count int `json:"count"`
+	// Why the item is left out
+	Reason string `json:"reason"`
+}
+
+// ImportAccount is a bank account whose statements an Aibo imports, remembered with the CatBud its
+// transactions are booked on
+// @Description Imported bank account
+type ImportAccount struct {
+	// Unique identifier for the ImportAccount
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo the account belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_import_accounts_number,priority:1" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Routing number of the bank, or an empty string
+	BankID string `gorm:"type:varchar(32);not null;default:'';uniqueIndex:idx_import_accounts_number,priority:2" json:"bank_id"`
+	// Number of the account as written on the statement, or the name of a QIF account
+	Number string `gorm:"type:varchar(100);not null;uniqueIndex:idx_import_accounts_number,priority:3" json:"number" example:"****1234"`
+	// Kind of account, such as CHECKING, SAVINGS or CREDITCARD
+	Type string `gorm:"type:varchar(32)" json:"type" example:"CHECKING"`
+	// Name of the account, chosen by the Aibo
+	Name string `gorm:"type:varchar(100)" json:"name" example:"Joint checking"`
+	// ISO 4217 currency of the account, empty when the statements do not give it
+	Currency Currency `gorm:"type:char(3)" json:"currency" swaggertype:"string" example:"USD"`
+	// ID of the CatBud the transactions of the account are booked on (can be null)
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Timestamp of when the account was first imported
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the account was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// ExternalID qualifies the identifier given to a transaction by the bank with the account, since
+// banks only keep them unique within an account. Identifiers too long for the column are hashed.
+func (a *ImportAccount) ExternalID(id string) string {
+	qualified := strings.Join([]string{a.BankID, a.Number, id}, "/")
+	if len(qualified) <= 255 {
+		return qualified
+	}
+	sum := sha256.Sum256([]byte(qualified))
+	return hex.EncodeToString(sum[:])
+}
+
+// ImportRow is a transaction parsed from an imported file
+// @Description Parsed import row
+type ImportRow struct {
+	// Line of the row in the file, from 1
+	Line int `json:"line"`
+	// Day of the transaction
+	Date time.Time `json:"date"`
+	// Kind of the transaction, from the sign of the amount
+	Kind TransactionKind `json:"kind" enums:"expense,income"`
+	// Amount of the transaction, always positive
+	Amount Money `json:"amount" swaggertype:"string"`
+	// ISO 4217 currency of the amount
+	Currency Currency `json:"currency" swaggertype:"string"`
+	// Who was paid, or who paid
+	Payee string `json:"payee"`
+	// Free text note
+	Note string `json:"note"`
+	// Category found in the file
+	Category string `json:"category"`
+	// Group of the category, in the export of another budgeting app
+	CategoryGroup string `json:"category_group,omitempty"`
+	// Identifier given to the transaction by the bank, qualified by its account
+	ExternalID string `json:"external_id,omitempty"`
+	// ID of the CatBud the transaction is booked on (can be null)
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// ID of the CategoryRule that booked the transaction on its CatBud, if any
+	CategoryRuleID *snowflake.ID `json:"category_rule_id,omitempty" swaggertype:"integer"`
+	// Tags set by the CategoryRules
+	Tags Tags `json:"tags,omitempty" swaggertype:"array,string"`
+	// Identifies the transaction for deduplication
+	Fingerprint string `json:"fingerprint"`
+	// What importing the row does
+	Status ImportRowStatus `json:"status" enums:"new,duplicate,invalid"`
+	// Why the row could not be parsed
+	Error string `json:"error,omitempty"`
+}
+
+// Invalid marks the row as unparseable for the given reason.
+func (r *ImportRow) Invalid(format string, args ...interface{}) {
+	r.Status = ImportRowInvalid
+	r.Error = fmt.Sprintf(format, args...)
+}
+
+// FingerprintKey identifies the transactions that look the same: same day, kind, amount,
+// currency and payee, the payee compared without case and surrounding spaces.
+func FingerprintKey(date time.Time, kind TransactionKind, amount Money, currency Currency, payee string) string {
+	return strings.Join([]string{date.Format("2006-01-02"), string(kind), amount.String(), string(currency), strings.ToLower(strings.TrimSpace(payee))}, "|")
+}
+
+// Fingerprint identifies the occurrence-th transaction, from 1, among the ones sharing a
+// FingerprintKey. Numbering the occurrences keeps two identical purchases of the same day apart,
+// while a statement imported twice gives the same fingerprints again.
+func Fingerprint(key string, occurrence int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, occurrence)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// CountImportRows counts the rows of each status.
+func CountImportRows(rows []ImportRow) (fresh, duplicates, invalid int) {
+	for _, row := range rows {
+		switch row.Status {
+		case ImportRowNew:
+			fresh++
+		case ImportRowDuplicate:
+			duplicates++
+		case ImportRowInvalid:
+			invalid++
+		}
+	}
+	return fresh, duplicates, invalid
+}
@@ -0,0 +1,166 @@
+package types
+
+import "github.com/bwmarrin/snowflake"
+
+// ImportCSVRequest represents the form fields sent along with a bank statement CSV file. The
+// fields of the format override the ones of the saved mapping, and the empty ones are detected.
+// @Description Import CSV form structure
+type ImportCSVRequest struct {
+	// ID of a saved ImportMapping to read the file with
+	// @example 1234567890123456
+	MappingID string `form:"mapping_id"`
+	// ID of the CatBud the rows without a matching category are booked on
+	// @example 1234567890123456
+	CatBudID string `form:"cat_bud_id"`
+	// Only parse the file and preview the rows, without recording anything
+	// @example true
+	DryRun bool `form:"dry_run"`
+	// Save the format the file was read with as an ImportMapping with this name, replacing the
+	// mapping of the same name
+	// @example My bank
+	SaveMapping string `form:"save_mapping"`
+	CSVFormat
+}
+
+// ImportStatementRequest represents the form fields sent along with an OFX, QFX or QIF file.
+// @Description Import statement form structure
+type ImportStatementRequest struct {
+	// ID of the CatBud the transactions are booked on, remembered for the accounts of the file
+	// @example 1234567890123456
+	CatBudID string `form:"cat_bud_id"`
+	// Only parse the file and preview the rows, without recording anything
+	// @example true
+	DryRun bool `form:"dry_run"`
+	// ISO 4217 currency of the amounts of a QIF file, defaults to the base currency
+	// @example USD
+	Currency Currency `form:"currency" swaggertype:"string"`
+	// Whether the dates of a QIF file read day first, detected when absent
+	// @example true
+	DayFirst *bool `form:"day_first"`
+}
+
+// ImportMigrationRequest represents the form fields sent along with the export of another
+// budgeting app.
+// @Description Import migration form structure
+type ImportMigrationRequest struct {
+	// Only parse the export and preview the categories and rows, without recording anything
+	// @example true
+	DryRun bool `form:"dry_run"`
+	// ISO 4217 currency of the amounts, defaults to the base currency
+	// @example USD
+	Currency Currency `form:"currency" swaggertype:"string"`
+	// Format of the dates, one of the keys of DateFormats, detected when absent
+	// @example MM/DD/YYYY
+	DateFormat string `form:"date_format"`
+}
+
+// ImportResponse represents the result of an import, or of its dry-run
+// @Description Import response structure
+type ImportResponse struct {
+	// Whether nothing was recorded
+	DryRun bool `json:"dry_run"`
+	// Format the file was read with, detected fields included (CSV only)
+	Format *CSVFormat `json:"format,omitempty"`
+	// Bank account the statement is of, if the file tells (OFX, QFX and QIF only)
+	Account *ImportAccount `json:"account,omitempty"`
+	// Parsed rows, in the order of the file
+	Rows []ImportRow `json:"rows"`
+	// Number of rows recorded, or to record in a dry-run
+	New int `json:"new"`
+	// Number of rows already in the ledger
+	Duplicates int `json:"duplicates"`
+	// Number of rows that could not be parsed
+	Invalid int `json:"invalid"`
+	// The recorded batch, null in a dry-run
+	Batch *ImportBatch `json:"batch"`
+	// The mapping saved with save_mapping, if any
+	Mapping *ImportMapping `json:"mapping,omitempty"`
+}
+
+// ImportStatementsResponse represents the result of the import of a file holding the statements
+// of several accounts, or of its dry-run
+// @Description Import statements response structure
+type ImportStatementsResponse struct {
+	// Whether nothing was recorded
+	DryRun bool `json:"dry_run"`
+	// Result for each statement of the file, in the order of the file
+	Statements []ImportResponse `json:"statements"`
+}
+
+// ImportMigrationResponse represents the result of the import of the export of another budgeting
+// app, or of its dry-run
+// @Description Import migration response structure
+type ImportMigrationResponse struct {
+	ImportResponse
+	// Categories of the app, with the CatBuds they are imported into
+	Categories []ImportCategory `json:"categories"`
+	// Items of the export left out of the import
+	Unmapped []ImportUnmapped `json:"unmapped"`
+}
+
+// RollbackImportResponse represents the result of the rollback of an import
+// @Description Rollback import response structure
+type RollbackImportResponse struct {
+	// The rolled back batch
+	Batch ImportBatch `json:"batch"`
+	// Number of transactions removed
+	Transactions int `json:"transactions"`
+	// Number of CatBuds removed, the ones used since the import are kept
+	CatBuds int `json:"cat_buds"`
+}
+
+// ImportMappingRequest represents the request to save a CSV column mapping
+// @Description Import mapping request structure
+type ImportMappingRequest struct {
+	// Name of the mapping, such as the name of the bank
+	// @example My bank
+	Name string `json:"name" binding:"required"`
+	CSVFormat
+	// ID of the CatBud the rows without a matching category are booked on (can be null)
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+}
+
+// ImportMappingResponse represents the response containing a single ImportMapping
+// @Description Single import mapping response structure
+type ImportMappingResponse struct {
+	// The mapping
+	Mapping ImportMapping `json:"mapping"`
+}
+
+// ListImportMappingsResponse represents the response containing the ImportMappings of an Aibo
+// @Description List import mappings response structure
+type ListImportMappingsResponse struct {
+	// Mappings, by name
+	Mappings []ImportMapping `json:"mappings"`
+}
+
+// ListImportBatchesResponse represents the response containing the ImportBatches of an Aibo
+// @Description List import batches response structure
+type ListImportBatchesResponse struct {
+	// Imported files, most recent first
+	Batches []ImportBatch `json:"batches"`
+}
+
+// ImportAccountRequest represents the request to update a bank account of the imports
+// @Description Import account request structure
+type ImportAccountRequest struct {
+	// Name of the account
+	// @example Joint checking
+	Name string `json:"name"`
+	// ID of the CatBud the transactions of the account are booked on (can be null)
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+}
+
+// ImportAccountResponse represents the response containing a single ImportAccount
+// @Description Single import account response structure
+type ImportAccountResponse struct {
+	// The account
+	Account ImportAccount `json:"account"`
+}
+
+// ListImportAccountsResponse represents the response containing the ImportAccounts of an Aibo
+// @Description List import accounts response structure
+type ListImportAccountsResponse struct {
+	// Accounts, by bank and number
+	Accounts []ImportAccount `json:"accounts"`
+}
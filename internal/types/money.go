@@ -0,0 +1,185 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount of money, counted in hundredths of the currency unit (cents). The
+// currencies with another minor unit, such as JPY or KWD, are not supported (see
+// Currency.IsSupported).
+//
+// Amounts are stored in DECIMAL(x,2) columns and serialized in JSON as decimal strings such
+// as "-12.50", so they never go through binary floating point. Plain JSON numbers are still
+// accepted as input.
+//
+// Rounding rule: whenever an amount has to be rounded to the cent (an input with more than two
+// decimals, a currency conversion, a pro-rated budget or an average), it is rounded half away
+// from zero.
+type Money int64
+
+// maxMoneyDigits is the number of integer digits a Money can hold without overflowing.
+const maxMoneyDigits = 16
+
+var errInvalidMoney = errors.New("invalid amount")
+
+// Cents returns the Money worth n cents.
+func Cents(n int64) Money {
+	return Money(n)
+}
+
+// MoneyFromFloat converts an approximate amount to Money, rounding it to the cent.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 100))
+}
+
+// ParseMoney parses a decimal amount such as "12", "-3.5" or "1234.567", rounding it to the cent.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	units, decimals, _ := strings.Cut(s, ".")
+	if units == "" && decimals == "" || len(units) > maxMoneyDigits || !isDigits(units) || !isDigits(decimals) {
+		return 0, fmt.Errorf("%w %q", errInvalidMoney, s)
+	}
+
+	decimals += "000"
+	cents, _ := strconv.ParseInt(units+decimals[:2], 10, 64)
+	if decimals[2] >= '5' {
+		cents++
+	}
+
+	if negative {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Float64 returns the amount as a float, for ratios and estimates only.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount with exactly two decimals, such as "-12.50".
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Abs returns the absolute value of the amount.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Mul multiplies the amount by a factor, such as an exchange rate, rounding the result to the cent.
+//
+// The product is computed exactly before rounding.
+func (m Money) Mul(factor float64) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(m)), new(big.Rat).SetFloat64(factor))
+	return roundRat(product)
+}
+
+// MulRatio multiplies the amount by num/den exactly, rounding the result to the cent.
+func (m Money) MulRatio(num, den int64) Money {
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(num))
+	return roundRat(new(big.Rat).SetFrac(product, big.NewInt(den)))
+}
+
+// Div divides the amount in n parts, rounding the result to the cent.
+func (m Money) Div(n int64) Money {
+	return roundRat(big.NewRat(int64(m), n))
+}
+
+// roundRat rounds a number of cents to the nearest integer, half away from zero.
+func roundRat(r *big.Rat) Money {
+	num := new(big.Int).Abs(r.Num())
+	quotient, remainder := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if new(big.Int).Mul(remainder, big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quotient.Neg(quotient)
+	}
+	return Money(quotient.Int64())
+}
+
+// MarshalJSON serializes the amount as a decimal string.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON reads the amount from a decimal string or a JSON number.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalParam reads the amount from a query or form parameter.
+func (m *Money) UnmarshalParam(param string) error {
+	parsed, err := ParseMoney(param)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as an exact decimal.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads the amount from a DECIMAL column, or from the result of an aggregate.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.UnmarshalParam(string(v))
+	case string:
+		return m.UnmarshalParam(v)
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = MoneyFromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
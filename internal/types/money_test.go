@@ -0,0 +1,176 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{"12", 1200, false},
+		{"12.5", 1250, false},
+		{"-3.5", -350, false},
+		{"+7.25", 725, false},
+		{" 0.01 ", 1, false},
+		{".5", 50, false},
+		{"5.", 500, false},
+		{"1234.564", 123456, false},
+		{"1234.565", 123457, false},
+		{"-1234.565", -123457, false},
+		{"0.004", 0, false},
+		{"0.005", 1, false},
+		{"9999999999999999.99", 999999999999999999, false},
+		{"", 0, true},
+		{"-", 0, true},
+		{".", 0, true},
+		{"1,50", 0, true},
+		{"1e3", 0, true},
+		{"12.3.4", 0, true},
+		{"--1", 0, true},
+		{"10000000000000000", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %v, %v, want %v, error %v", tt.input, int64(got), err, int64(tt.want), tt.wantErr)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1250, "12.50"},
+		{-123456, "-1234.56"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.money), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"div exact", Money(1000).Div(4), 250},
+		{"div half up", Money(1000).Div(16), 63},
+		{"div half away from zero", Money(-1000).Div(16), -63},
+		{"div down", Money(1000).Div(3), 333},
+		{"ratio", Money(10000).MulRatio(2, 3), 6667},
+		{"negative ratio", Money(-10000).MulRatio(2, 3), -6667},
+		{"ratio half", Money(1).MulRatio(1, 2), 1},
+		{"mul", Money(1999).Mul(0.5), 1000},
+		{"mul negative", Money(-1999).Mul(0.5), -1000},
+		{"from float", MoneyFromFloat(19.999), 2000},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, int64(tt.got), int64(tt.want))
+		}
+	}
+}
+
+// TestMoneyConversion converts amounts at exchange rates as the ledger does, with Mul.
+func TestMoneyConversion(t *testing.T) {
+	tests := []struct {
+		amount Money
+		rate   float64
+		want   Money
+	}{
+		{10000, 1.0945, 10945},
+		{1999, 1.0945, 2188},
+		{1999, 1 / 1.0945, 1826},
+		{-4550, 0.8612, -3918},
+		{1, 0.5, 1},
+		{1, 0.4999, 0},
+		{123456789, 1.1, 135802468},
+		{5000, 1, 5000},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Mul(tt.rate); got != tt.want {
+			t.Errorf("%v at %v = %v, want %v", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var decoded struct {
+		String Money  `json:"string"`
+		Number Money  `json:"number"`
+		Null   *Money `json:"null"`
+	}
+	if err := json.Unmarshal([]byte(`{"string":"-12.345","number":0.1,"null":null}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String != -1235 || decoded.Number != 10 || decoded.Null != nil {
+		t.Fatalf("decoded = %+v", decoded)
+	}
+	encoded, err := json.Marshal(map[string]Money{"amount": 1050})
+	if err != nil || string(encoded) != `{"amount":"10.50"}` {
+		t.Fatalf("encoded = %s, %v", encoded, err)
+	}
+	if err := json.Unmarshal([]byte(`{"string":"ten"}`), &decoded); err == nil {
+		t.Fatal("an invalid amount was accepted")
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+	}{
+		{nil, 0},
+		{[]byte("12.50"), 1250},
+		{"-0.07", -7},
+		{int64(3), 300},
+		{float64(2.675), 268},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.src); err != nil || m != tt.want {
+			t.Errorf("Scan(%v) = %v, %v, want %v", tt.src, int64(m), err, int64(tt.want))
+		}
+	}
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Error("Scan accepted a bool")
+	}
+}
+
+func TestCurrencyMinorUnits(t *testing.T) {
+	tests := []struct {
+		currency      Currency
+		wantUnits     int
+		wantSupported bool
+	}{
+		{"EUR", 2, true},
+		{"USD", 2, true},
+		{"JPY", 0, false},
+		{"KRW", 0, false},
+		{"KWD", 3, false},
+		{"BHD", 3, false},
+		{"OMR", 3, false},
+		{"ABC", 2, false},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.MinorUnits(); got != tt.wantUnits {
+			t.Errorf("%s.MinorUnits() = %d, want %d", tt.currency, got, tt.wantUnits)
+		}
+		if got := tt.currency.IsSupported(); got != tt.wantSupported {
+			t.Errorf("%s.IsSupported() = %v, want %v", tt.currency, got, tt.wantSupported)
+		}
+	}
+}
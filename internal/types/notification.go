@@ -0,0 +1,256 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// NotificationChannel is a way of reaching an Aibo.
+type NotificationChannel string
+
+const (
+	// ChannelInApp lists the notification in the inbox of the Aibo.
+	ChannelInApp NotificationChannel = "in_app"
+	// ChannelEmail sends the notification to the email address of the Aibo.
+	ChannelEmail NotificationChannel = "email"
+	// ChannelWebhook posts the notification to the webhook URL of the Aibo.
+	ChannelWebhook NotificationChannel = "webhook"
+	// ChannelWebPush pushes the notification to the browsers the Aibo subscribed.
+	ChannelWebPush NotificationChannel = "web_push"
+)
+
+// DeliveryStatus is the state of a NotificationDelivery.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending waits for its next attempt.
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySent was accepted by the channel.
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryFailed ran out of attempts or failed for good.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// MaxDeliveryAttempts is the number of attempts made before a delivery is given up.
+const MaxDeliveryAttempts = 8
+
+// DeliveryBackoff returns how long to wait after the given failed attempt, counted from 1: 30
+// seconds after the first one, doubling after each of the next ones, up to 6 hours.
+func DeliveryBackoff(attempt int) time.Duration {
+	const first, ceiling = 30 * time.Second, 6 * time.Hour
+	delay := first
+	for i := 1; i < attempt && delay < ceiling; i++ {
+		delay *= 2
+	}
+	return min(delay, ceiling)
+}
+
+// Notification is a message sent to an Aibo, and its entry in the in-app inbox
+// @Description Notification model
+type Notification struct {
+	// Unique identifier for the Notification
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the recipient Aibo
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Event the notification is about, such as "alert.budget_used"
+	Kind string `gorm:"type:varchar(64);not null" json:"kind"`
+	// Rendered subject
+	Subject string `gorm:"type:varchar(255);not null" json:"subject"`
+	// Rendered plain text body
+	Body string `gorm:"type:text;not null" json:"body"`
+	// Rendered HTML body, used by email
+	HTML string `gorm:"type:text" json:"-"`
+	// Identifiers linking the notification to its event, as a JSON object
+	Data json.RawMessage `gorm:"type:text" json:"data" swaggertype:"object"`
+	// Whether the notification is listed in the in-app inbox
+	InApp bool `gorm:"not null" json:"-"`
+	// Timestamp of when the Aibo read the notification in the inbox
+	ReadAt *time.Time `gorm:"type:datetime;default:null" json:"read_at"`
+	// Timestamp of when the notification was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// NotificationDelivery is the delivery of a Notification through one channel, retried with
+// backoff until it succeeds or runs out of attempts
+// @Description Notification delivery model
+type NotificationDelivery struct {
+	// Unique identifier for the NotificationDelivery
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the delivered Notification
+	NotificationID snowflake.ID `gorm:"type:bigint;not null;index" json:"notification_id"`
+	// The delivered Notification
+	Notification *Notification `gorm:"foreignKey:NotificationID" json:"-"`
+	// Channel used (email, webhook or web_push)
+	Channel NotificationChannel `gorm:"type:varchar(16);not null" json:"channel" enums:"email,webhook,web_push"`
+	// ID of the PushSubscription reached by a web_push delivery
+	PushSubscriptionID *snowflake.ID `gorm:"type:bigint;default:null" json:"push_subscription_id" swaggertype:"integer"`
+	// State of the delivery (pending, sent or failed)
+	Status DeliveryStatus `gorm:"type:varchar(16);not null;index:idx_notification_deliveries_due,priority:1" json:"status" enums:"pending,sent,failed"`
+	// Number of attempts made
+	Attempts int `gorm:"not null;default:0" json:"attempts"`
+	// Earliest time of the next attempt
+	NextAttemptAt time.Time `gorm:"type:datetime;not null;index:idx_notification_deliveries_due,priority:2" json:"next_attempt_at"`
+	// Error of the last failed attempt
+	LastError string `gorm:"type:varchar(512)" json:"last_error"`
+	// Timestamp of when the channel accepted the notification
+	SentAt *time.Time `gorm:"type:datetime;default:null" json:"sent_at"`
+	// Timestamp of when the delivery was queued
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// maxDeliveryErrorLength is the size of the last error column.
+const maxDeliveryErrorLength = 512
+
+// RecordSent records that the channel accepted the delivery.
+func (d *NotificationDelivery) RecordSent(now time.Time) {
+	d.Attempts++
+	d.Status = DeliverySent
+	d.SentAt = &now
+	d.LastError = ""
+}
+
+// RecordFailure records a failed attempt. The delivery is attempted again after the backoff
+// delay, unless the failure is final or it ran out of attempts, in which case it is given up.
+func (d *NotificationDelivery) RecordFailure(cause error, final bool, now time.Time) {
+	d.Attempts++
+	d.LastError = cause.Error()
+	if len(d.LastError) > maxDeliveryErrorLength {
+		d.LastError = d.LastError[:maxDeliveryErrorLength]
+	}
+	if final || d.Attempts >= MaxDeliveryAttempts {
+		d.Status = DeliveryFailed
+	} else {
+		d.NextAttemptAt = now.Add(DeliveryBackoff(d.Attempts))
+	}
+}
+
+// NotificationSettings are the channel preferences and quiet hours of an Aibo
+// @Description Notification settings model
+type NotificationSettings struct {
+	// ID of the Aibo
+	AiboID uuid.UUID `gorm:"type:char(36);primaryKey" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Whether notifications are listed in the in-app inbox
+	InApp bool `gorm:"not null" json:"in_app"`
+	// Whether notifications are sent by email
+	Email bool `gorm:"not null" json:"email"`
+	// Whether notifications are pushed to the subscribed browsers
+	WebPush bool `gorm:"not null" json:"web_push"`
+	// Whether notifications are posted to the webhook URL
+	Webhook bool `gorm:"not null" json:"webhook"`
+	// URL the webhook notifications are posted to
+	WebhookURL string `gorm:"type:varchar(2048)" json:"webhook_url"`
+	// Key signing the webhook requests, in the X-Aibo-Signature header
+	WebhookSecret string `gorm:"type:varchar(64)" json:"webhook_secret"`
+	// Local time (HH:MM) from which only the in-app inbox is used, null for no quiet hours
+	QuietHoursStart *string `gorm:"type:varchar(5);default:null" json:"quiet_hours_start" example:"22:00"`
+	// Local time (HH:MM) at which the other channels resume
+	QuietHoursEnd *string `gorm:"type:varchar(5);default:null" json:"quiet_hours_end" example:"07:30"`
+	// Timestamp of when the settings were last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// DefaultNotificationSettings returns the settings of an Aibo that never changed them: the
+// in-app inbox, email and web push are on, the webhook is off.
+func DefaultNotificationSettings(aiboID uuid.UUID) NotificationSettings {
+	return NotificationSettings{AiboID: aiboID, InApp: true, Email: true, WebPush: true}
+}
+
+// Enabled reports whether the Aibo wants to be reached through the channel.
+func (s *NotificationSettings) Enabled(channel NotificationChannel) bool {
+	switch channel {
+	case ChannelInApp:
+		return s.InApp
+	case ChannelEmail:
+		return s.Email
+	case ChannelWebPush:
+		return s.WebPush
+	case ChannelWebhook:
+		return s.Webhook && s.WebhookURL != ""
+	}
+	return false
+}
+
+// Validate checks the webhook and quiet hours settings.
+func (s *NotificationSettings) Validate() error {
+	if s.Webhook && s.WebhookURL == "" {
+		return errors.New("webhook_url is required to enable the webhook")
+	}
+	if (s.QuietHoursStart == nil) != (s.QuietHoursEnd == nil) {
+		return errors.New("quiet_hours_start and quiet_hours_end must be set together")
+	}
+	if s.QuietHoursStart != nil {
+		if _, err := parseClock(*s.QuietHoursStart); err != nil {
+			return fmt.Errorf("invalid quiet_hours_start: %w", err)
+		}
+		if _, err := parseClock(*s.QuietHoursEnd); err != nil {
+			return fmt.Errorf("invalid quiet_hours_end: %w", err)
+		}
+	}
+	return nil
+}
+
+// QuietUntil reports whether now falls in the quiet hours, in the given location, and when they
+// end. Quiet hours whose end is before their start span midnight.
+func (s *NotificationSettings) QuietUntil(now time.Time, loc *time.Location) (time.Time, bool) {
+	if s.QuietHoursStart == nil || s.QuietHoursEnd == nil {
+		return time.Time{}, false
+	}
+	start, err1 := parseClock(*s.QuietHoursStart)
+	end, err2 := parseClock(*s.QuietHoursEnd)
+	if err1 != nil || err2 != nil || start == end {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	endToday := midnight.Add(time.Duration(end) * time.Minute)
+
+	if start < end {
+		if minute >= start && minute < end {
+			return endToday, true
+		}
+		return time.Time{}, false
+	}
+	if minute < end {
+		return endToday, true
+	}
+	if minute >= start {
+		return midnight.AddDate(0, 0, 1).Add(time.Duration(end) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// parseClock parses a local time of day written HH:MM into minutes after midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.New("expected HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// PushSubscription is a browser subscribed to the Web Push notifications of an Aibo
+// @Description Web Push subscription model
+type PushSubscription struct {
+	// Unique identifier for the PushSubscription
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Push service URL of the subscription
+	Endpoint string `gorm:"type:varchar(1024);not null;uniqueIndex:idx_push_subscriptions_endpoint,length:255" json:"endpoint"`
+	// P-256 public key of the browser, base64url encoded
+	P256dh string `gorm:"type:varchar(128);not null" json:"p256dh"`
+	// Authentication secret of the browser, base64url encoded
+	Auth string `gorm:"type:varchar(64);not null" json:"auth"`
+	// Timestamp of when the browser subscribed
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
@@ -0,0 +1,87 @@
+package types
+
+// ListNotificationsRequest represents the query parameters to list the in-app inbox
+// @Description List notifications query structure
+type ListNotificationsRequest struct {
+	// Only list the notifications not read yet
+	Unread bool `form:"unread"`
+}
+
+// ListNotificationsResponse represents the response containing the in-app inbox of an Aibo
+// @Description List notifications response structure
+type ListNotificationsResponse struct {
+	// Notifications, most recent first
+	Notifications []Notification `json:"notifications"`
+	// Number of notifications not read yet
+	Unread int64 `json:"unread"`
+}
+
+// NotificationResponse represents the response containing a single notification
+// @Description Single notification response structure
+type NotificationResponse struct {
+	// The notification
+	Notification Notification `json:"notification"`
+}
+
+// UpdateNotificationSettingsRequest represents the request to change the notification settings
+// @Description Update notification settings request structure
+type UpdateNotificationSettingsRequest struct {
+	// List the notifications in the in-app inbox
+	InApp *bool `json:"in_app"`
+	// Send the notifications by email
+	Email *bool `json:"email"`
+	// Push the notifications to the subscribed browsers
+	WebPush *bool `json:"web_push"`
+	// Post the notifications to the webhook URL
+	Webhook *bool `json:"webhook"`
+	// Public http or https URL the webhook notifications are posted to, an empty string removes it
+	// @example https://example.com/hooks/aibo
+	WebhookURL *string `json:"webhook_url" binding:"omitempty,max=2048"`
+	// Generate a new webhook secret
+	RotateWebhookSecret bool `json:"rotate_webhook_secret"`
+	// Local time (HH:MM) from which only the in-app inbox is used
+	// @example 22:00
+	QuietHoursStart *string `json:"quiet_hours_start"`
+	// Local time (HH:MM) at which the other channels resume
+	// @example 07:30
+	QuietHoursEnd *string `json:"quiet_hours_end"`
+	// Remove the quiet hours
+	ClearQuietHours bool `json:"clear_quiet_hours"`
+}
+
+// NotificationSettingsResponse represents the response containing the notification settings
+// @Description Notification settings response structure
+type NotificationSettingsResponse struct {
+	// Settings of the Aibo
+	Settings NotificationSettings `json:"settings"`
+	// Channels the server can deliver through
+	Channels []NotificationChannel `json:"channels"`
+	// Key to subscribe the browsers to Web Push with, empty when Web Push is not available
+	VAPIDPublicKey string `json:"vapid_public_key"`
+}
+
+// PushSubscriptionKeys are the keys of a browser push subscription
+// @Description Push subscription keys structure
+type PushSubscriptionKeys struct {
+	// P-256 public key of the browser, base64url encoded
+	P256dh string `json:"p256dh" binding:"required,max=128"`
+	// Authentication secret of the browser, base64url encoded
+	Auth string `json:"auth" binding:"required,max=64"`
+}
+
+// CreatePushSubscriptionRequest represents the request to subscribe a browser to Web Push; it is
+// the JSON form of the browser PushSubscription
+// @Description Create push subscription request structure
+type CreatePushSubscriptionRequest struct {
+	// Push service URL of the subscription, a public https URL
+	Endpoint string `json:"endpoint" binding:"required,url,max=1024"`
+	// Keys of the subscription
+	Keys PushSubscriptionKeys `json:"keys" binding:"required"`
+}
+
+// PushSubscriptionResponse represents the response containing a single push subscription
+// @Description Single push subscription response structure
+type PushSubscriptionResponse struct {
+	// The push subscription
+	Subscription PushSubscription `json:"subscription"`
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliveryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := DeliveryBackoff(tt.attempt); got != tt.want {
+			t.Errorf("DeliveryBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationDeliveryRecordFailure(t *testing.T) {
+	now := time.Date(2024, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		attempts   int
+		final      bool
+		wantStatus DeliveryStatus
+		wantNext   time.Time
+	}{
+		{"first failure", 0, false, DeliveryPending, now.Add(30 * time.Second)},
+		{"third failure", 2, false, DeliveryPending, now.Add(2 * time.Minute)},
+		{"permanent failure", 0, true, DeliveryFailed, time.Time{}},
+		{"last attempt", MaxDeliveryAttempts - 1, false, DeliveryFailed, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &NotificationDelivery{Status: DeliveryPending, Attempts: tt.attempts}
+			d.RecordFailure(errors.New("timeout"), tt.final, now)
+			if d.Status != tt.wantStatus || d.Attempts != tt.attempts+1 || d.LastError != "timeout" || !d.NextAttemptAt.Equal(tt.wantNext) {
+				t.Fatalf("delivery = %+v, want %s retried at %v", d, tt.wantStatus, tt.wantNext)
+			}
+		})
+	}
+
+	d := &NotificationDelivery{Status: DeliveryPending}
+	d.RecordFailure(errors.New(strings.Repeat("x", 2000)), false, now)
+	if len(d.LastError) != maxDeliveryErrorLength {
+		t.Fatalf("last error of %d bytes, want it truncated to %d", len(d.LastError), maxDeliveryErrorLength)
+	}
+}
+
+func TestNotificationDeliveryRecordSent(t *testing.T) {
+	now := time.Date(2024, 10, 18, 12, 0, 0, 0, time.UTC)
+	d := &NotificationDelivery{Status: DeliveryPending, Attempts: 2, LastError: "timeout"}
+	d.RecordSent(now)
+	if d.Status != DeliverySent || d.Attempts != 3 || d.LastError != "" || d.SentAt == nil || !d.SentAt.Equal(now) {
+		t.Fatalf("delivery = %+v, want sent at %v", d, now)
+	}
+}
@@ -0,0 +1,233 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// RecurrenceFrequency is the base unit of a recurring rule, as in the RRULE FREQ part.
+type RecurrenceFrequency string
+
+const (
+	FrequencyDaily   RecurrenceFrequency = "daily"
+	FrequencyWeekly  RecurrenceFrequency = "weekly"
+	FrequencyMonthly RecurrenceFrequency = "monthly"
+	FrequencyYearly  RecurrenceFrequency = "yearly"
+)
+
+// IsValid reports whether the frequency is one of the known recurrence frequencies.
+func (f RecurrenceFrequency) IsValid() bool {
+	switch f {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+		return true
+	}
+	return false
+}
+
+// RecurringRule describes a transaction that repeats, such as a rent, a subscription or a salary
+// @Description Recurring transaction rule
+type RecurringRule struct {
+	// Unique identifier for the RecurringRule
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo this rule belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// ID of the CatBud the occurrences are booked on
+	CatBudID snowflake.ID `gorm:"type:bigint;not null;index" json:"cat_bud_id"`
+	// Kind of the generated transactions, either "expense" or "income"
+	Kind TransactionKind `gorm:"type:varchar(16);not null" json:"kind" enums:"expense,income"`
+	// Amount of each occurrence
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// ISO 4217 currency of the amount
+	Currency Currency `gorm:"type:char(3);not null;default:'EUR'" json:"currency" swaggertype:"string" example:"USD"`
+	// Payee of the generated transactions
+	Payee string `gorm:"type:varchar(255)" json:"payee"`
+	// Note of the generated transactions
+	Note string `gorm:"type:text" json:"note"`
+	// Base unit of the recurrence (daily, weekly, monthly or yearly)
+	Frequency RecurrenceFrequency `gorm:"type:varchar(16);not null" json:"frequency" enums:"daily,weekly,monthly,yearly"`
+	// Number of frequency units between two occurrences
+	Interval int `gorm:"not null;default:1" json:"interval"`
+	// Day of the first occurrence
+	StartDate time.Time `gorm:"type:date;not null" json:"start_date"`
+	// Last day an occurrence may happen on (optional)
+	Until *time.Time `gorm:"type:date;default:null" json:"until"`
+	// Maximum number of occurrences (optional)
+	Count *int `gorm:"default:null" json:"count"`
+	// Index of the next occurrence to materialize
+	NextIndex int `gorm:"not null;default:0" json:"-"`
+	// Day of the next occurrence to materialize, null once the series is over
+	NextOccurrence *time.Time `gorm:"type:date;default:null;index" json:"next_occurrence"`
+	// Timestamp of when the rule was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the rule was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate checks that the recurrence settings of the rule are consistent.
+func (r *RecurringRule) Validate() error {
+	if !r.Kind.IsValid() {
+		return errors.New("kind must be either expense or income")
+	}
+	if !r.Frequency.IsValid() {
+		return errors.New("frequency must be one of daily, weekly, monthly or yearly")
+	}
+	if r.Interval < 1 {
+		return errors.New("interval must be at least 1")
+	}
+	if r.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !r.Currency.IsSupported() {
+		return errors.New("currency must be an ISO 4217 currency code with two decimals")
+	}
+	if r.Until != nil && r.Until.Before(r.StartDate) {
+		return errors.New("until must not be before start_date")
+	}
+	if r.Count != nil && *r.Count < 1 {
+		return errors.New("count must be at least 1")
+	}
+	return nil
+}
+
+// Occurrence returns the day of the n-th occurrence of the rule (starting at 0) and whether
+// the series still has an n-th occurrence given its count and until limits.
+//
+// Monthly and yearly occurrences keep the day of month of the start date, clamped to the last
+// day of shorter months, so a rule starting on January 31st falls on February 28th or 29th.
+func (r *RecurringRule) Occurrence(n int) (time.Time, bool) {
+	if r.Count != nil && n >= *r.Count {
+		return time.Time{}, false
+	}
+
+	start := truncateDay(r.StartDate)
+	var day time.Time
+	switch r.Frequency {
+	case FrequencyDaily:
+		day = start.AddDate(0, 0, n*r.Interval)
+	case FrequencyWeekly:
+		day = start.AddDate(0, 0, 7*n*r.Interval)
+	case FrequencyYearly:
+		day = addMonthsClamped(start, 12*n*r.Interval)
+	default:
+		day = addMonthsClamped(start, n*r.Interval)
+	}
+
+	if r.Until != nil && day.After(truncateDay(*r.Until)) {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// IndexOf returns the index of the occurrence of the rule scheduled on day, and whether
+// there is such an occurrence.
+func (r *RecurringRule) IndexOf(day time.Time) (int, bool) {
+	day = truncateDay(day)
+	for n := 0; ; n++ {
+		occurrence, ok := r.Occurrence(n)
+		if !ok || occurrence.After(day) {
+			return 0, false
+		}
+		if occurrence.Equal(day) {
+			return n, true
+		}
+	}
+}
+
+// RecurringException overrides or skips a single occurrence of a RecurringRule
+// @Description Single occurrence override of a recurring rule
+type RecurringException struct {
+	// Unique identifier for the RecurringException
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the rule the occurrence belongs to
+	RecurringRuleID snowflake.ID `gorm:"type:bigint;not null;uniqueIndex:idx_recurring_exceptions_occurrence,priority:1" json:"recurring_rule_id"`
+	// Scheduled day of the occurrence, as computed from the rule
+	OccurrenceDate time.Time `gorm:"type:date;not null;uniqueIndex:idx_recurring_exceptions_occurrence,priority:2" json:"occurrence_date"`
+	// Whether the occurrence is skipped
+	Skip bool `gorm:"not null;default:false" json:"skip"`
+	// Day the occurrence is moved to (optional)
+	Date *time.Time `gorm:"type:date;default:null" json:"date"`
+	// Amount of this occurrence (optional)
+	Amount *Money `gorm:"type:decimal(10,2);default:null" json:"amount" swaggertype:"string"`
+	// Payee of this occurrence (optional)
+	Payee *string `gorm:"type:varchar(255);default:null" json:"payee"`
+	// Note of this occurrence (optional)
+	Note *string `gorm:"type:text" json:"note"`
+	// Timestamp of when the exception was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the exception was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// MovesEarlier reports whether the exception moves its occurrence before the day it is scheduled on.
+func (e *RecurringException) MovesEarlier() bool {
+	return e.Date != nil && truncateDay(*e.Date).Before(truncateDay(e.OccurrenceDate))
+}
+
+// Transaction builds the transaction materializing the occurrence of the rule scheduled on
+// occurrenceDate, with the overrides of the exception applied when there is one.
+//
+// The caller is responsible for skipped occurrences and for setting the ID of the transaction.
+func (r *RecurringRule) Transaction(occurrenceDate time.Time, exception *RecurringException) Transaction {
+	catBudID := r.CatBudID
+	ruleID := r.ID
+	occurrence := occurrenceDate
+
+	t := Transaction{
+		AiboID:          r.AiboID,
+		CatBudID:        &catBudID,
+		Kind:            r.Kind,
+		Status:          TransactionApproved,
+		Amount:          r.Amount,
+		Currency:        r.Currency,
+		Date:            occurrenceDate,
+		Payee:           r.Payee,
+		Note:            r.Note,
+		RecurringRuleID: &ruleID,
+		OccurrenceDate:  &occurrence,
+	}
+
+	if exception != nil {
+		if exception.Date != nil {
+			t.Date = *exception.Date
+		}
+		if exception.Amount != nil {
+			t.Amount = *exception.Amount
+		}
+		if exception.Payee != nil {
+			t.Payee = *exception.Payee
+		}
+		if exception.Note != nil {
+			t.Note = *exception.Note
+		}
+	}
+
+	return t
+}
+
+// UpcomingOccurrence is an occurrence of a recurring rule that is not in the ledger yet
+// @Description Upcoming bill or income
+type UpcomingOccurrence struct {
+	// ID of the rule
+	RecurringRuleID snowflake.ID `json:"recurring_rule_id"`
+	// ID of the CatBud the occurrence will be booked on
+	CatBudID snowflake.ID `json:"cat_bud_id"`
+	// Scheduled day of the occurrence, as computed from the rule
+	OccurrenceDate time.Time `json:"occurrence_date"`
+	// Day the occurrence will be booked on, after overrides
+	Date time.Time `json:"date"`
+	// Kind of the occurrence
+	Kind TransactionKind `json:"kind"`
+	// Amount of the occurrence, after overrides
+	Amount Money `json:"amount" swaggertype:"string"`
+	// ISO 4217 currency of the amount
+	Currency Currency `json:"currency" swaggertype:"string"`
+	// Payee of the occurrence, after overrides
+	Payee string `json:"payee"`
+	// Whether the occurrence is skipped
+	Skipped bool `json:"skipped"`
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"github.com/bwmarrin/snowflake"
+)
+
+// CreateRecurringRuleRequest represents the request to create a RecurringRule
+// @Description Create recurring rule request structure
+type CreateRecurringRuleRequest struct {
+	// ID of the CatBud the occurrences are booked on
+	// @example 1234567890123456
+	CatBudID snowflake.ID `json:"cat_bud_id" binding:"required"`
+	// Kind of the generated transactions, either "expense" or "income"
+	// @example expense
+	Kind TransactionKind `json:"kind" binding:"required"`
+	// Amount of each occurrence
+	// @example 850.00
+	Amount Money `json:"amount" binding:"required,gt=0" swaggertype:"string"`
+	// ISO 4217 currency of the amount, defaults to the base currency
+	// @example EUR
+	Currency Currency `json:"currency"`
+	// Payee of the generated transactions
+	// @example Landlord
+	Payee string `json:"payee"`
+	// Note of the generated transactions
+	// @example Rent
+	Note string `json:"note"`
+	// Base unit of the recurrence (daily, weekly, monthly or yearly)
+	// @example monthly
+	Frequency RecurrenceFrequency `json:"frequency" binding:"required"`
+	// Number of frequency units between two occurrences, defaults to 1
+	// @example 1
+	Interval int `json:"interval"`
+	// Day of the first occurrence (format: YYYY-MM-DD), at most a year ago
+	// @example 2024-01-05
+	StartDate string `json:"start_date" binding:"required"`
+	// Last day an occurrence may happen on (format: YYYY-MM-DD)
+	// @example 2024-12-31
+	Until string `json:"until"`
+	// Maximum number of occurrences
+	// @example 12
+	Count *int `json:"count"`
+}
+
+// UpdateRecurringRuleRequest represents the request to update a RecurringRule
+//
+// Changes apply to the occurrences that are not in the ledger yet.
+// @Description Update recurring rule request structure
+type UpdateRecurringRuleRequest struct {
+	// New CatBud of the rule
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// New amount of each occurrence
+	// @example 900.00
+	Amount *Money `json:"amount" binding:"omitempty,gt=0" swaggertype:"string"`
+	// New currency of the amount (ISO 4217)
+	// @example EUR
+	Currency Currency `json:"currency"`
+	// New payee
+	// @example Landlord
+	Payee *string `json:"payee"`
+	// New note
+	// @example Rent
+	Note *string `json:"note"`
+	// New last day an occurrence may happen on (format: YYYY-MM-DD)
+	// @example 2025-06-30
+	Until string `json:"until"`
+	// New maximum number of occurrences
+	// @example 18
+	Count *int `json:"count"`
+}
+
+// UpdateOccurrenceRequest represents the request to skip or edit a single occurrence
+// @Description Skip or edit a single occurrence request structure
+type UpdateOccurrenceRequest struct {
+	// Whether the occurrence is skipped
+	// @example false
+	Skip bool `json:"skip"`
+	// Day the occurrence is moved to (format: YYYY-MM-DD), not before its scheduled day unless it is already recorded
+	// @example 2024-03-06
+	Date string `json:"date"`
+	// Amount of this occurrence
+	// @example 875.00
+	Amount *Money `json:"amount" binding:"omitempty,gt=0" swaggertype:"string"`
+	// Payee of this occurrence
+	// @example Landlord
+	Payee *string `json:"payee"`
+	// Note of this occurrence
+	// @example Rent, with the parking spot
+	Note *string `json:"note"`
+}
+
+// RecurringRuleResponse represents the response containing a single RecurringRule
+// @Description Single recurring rule response structure
+type RecurringRuleResponse struct {
+	// The rule
+	RecurringRule RecurringRule `json:"recurring_rule"`
+	// The single occurrence overrides of the rule
+	Exceptions []RecurringException `json:"exceptions"`
+}
+
+// ListRecurringRulesResponse represents the response containing multiple RecurringRules
+// @Description List recurring rules response structure
+type ListRecurringRulesResponse struct {
+	// List of rules
+	RecurringRules []RecurringRule `json:"recurring_rules"`
+}
+
+// UpcomingOccurrencesResponse represents the response containing the upcoming occurrences
+// @Description Upcoming bills response structure
+type UpcomingOccurrencesResponse struct {
+	// Upcoming occurrences, in chronological order
+	Occurrences []UpcomingOccurrence `json:"occurrences"`
+}
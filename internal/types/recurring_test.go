@@ -0,0 +1,160 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestRecurringRuleOccurrence(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RecurringRule
+		want []time.Time
+	}{
+		{
+			"daily every 3 days",
+			RecurringRule{Frequency: FrequencyDaily, Interval: 3, StartDate: date(2024, 2, 27)},
+			[]time.Time{date(2024, 2, 27), date(2024, 3, 1), date(2024, 3, 4)},
+		},
+		{
+			"biweekly",
+			RecurringRule{Frequency: FrequencyWeekly, Interval: 2, StartDate: date(2024, 12, 20)},
+			[]time.Time{date(2024, 12, 20), date(2025, 1, 3), date(2025, 1, 17)},
+		},
+		{
+			"monthly on the 31st",
+			RecurringRule{Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2024, 1, 31)},
+			[]time.Time{date(2024, 1, 31), date(2024, 2, 29), date(2024, 3, 31), date(2024, 4, 30)},
+		},
+		{
+			"quarterly",
+			RecurringRule{Frequency: FrequencyMonthly, Interval: 3, StartDate: date(2024, 11, 30)},
+			[]time.Time{date(2024, 11, 30), date(2025, 2, 28), date(2025, 5, 30)},
+		},
+		{
+			"yearly on a leap day",
+			RecurringRule{Frequency: FrequencyYearly, Interval: 1, StartDate: date(2024, 2, 29)},
+			[]time.Time{date(2024, 2, 29), date(2025, 2, 28), date(2026, 2, 28), date(2027, 2, 28), date(2028, 2, 29)},
+		},
+		{
+			"limited by count",
+			RecurringRule{Frequency: FrequencyMonthly, Interval: 1, StartDate: date(2024, 1, 15), Count: intPtr(2)},
+			[]time.Time{date(2024, 1, 15), date(2024, 2, 15)},
+		},
+		{
+			"limited by until",
+			RecurringRule{Frequency: FrequencyWeekly, Interval: 1, StartDate: date(2024, 1, 1), Until: datePtr(2024, 1, 15)},
+			[]time.Time{date(2024, 1, 1), date(2024, 1, 8), date(2024, 1, 15)},
+		},
+		{
+			"start with a time of day",
+			RecurringRule{Frequency: FrequencyDaily, Interval: 1, StartDate: time.Date(2024, 1, 1, 18, 30, 0, 0, time.UTC), Count: intPtr(1)},
+			[]time.Time{date(2024, 1, 1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for n, want := range tt.want {
+				got, ok := tt.rule.Occurrence(n)
+				if !ok || !got.Equal(want) {
+					t.Fatalf("Occurrence(%d) = %v, %v, want %v", n, got.Format(time.DateOnly), ok, want.Format(time.DateOnly))
+				}
+				if index, ok := tt.rule.IndexOf(want); !ok || index != n {
+					t.Fatalf("IndexOf(%v) = %d, %v, want %d", want.Format(time.DateOnly), index, ok, n)
+				}
+			}
+			if tt.rule.Count != nil || tt.rule.Until != nil {
+				if got, ok := tt.rule.Occurrence(len(tt.want)); ok {
+					t.Fatalf("Occurrence(%d) = %v past the end of the series", len(tt.want), got)
+				}
+			}
+		})
+	}
+}
+
+func TestRecurringRuleIndexOfMissingDay(t *testing.T) {
+	rule := RecurringRule{Frequency: FrequencyWeekly, Interval: 1, StartDate: date(2024, 1, 1), Until: datePtr(2024, 3, 1)}
+	for _, day := range []time.Time{date(2023, 12, 25), date(2024, 1, 2), date(2024, 3, 4)} {
+		if index, ok := rule.IndexOf(day); ok {
+			t.Errorf("IndexOf(%v) = %d, want no occurrence", day.Format(time.DateOnly), index)
+		}
+	}
+}
+
+func TestRecurringRuleValidate(t *testing.T) {
+	valid := RecurringRule{Kind: TransactionExpense, Frequency: FrequencyMonthly, Interval: 1, Amount: 95000, Currency: "EUR", StartDate: date(2024, 1, 1)}
+	tests := []struct {
+		name    string
+		change  func(r *RecurringRule)
+		wantErr bool
+	}{
+		{"valid", func(r *RecurringRule) {}, false},
+		{"unknown kind", func(r *RecurringRule) { r.Kind = "transfer" }, true},
+		{"unknown frequency", func(r *RecurringRule) { r.Frequency = "hourly" }, true},
+		{"zero interval", func(r *RecurringRule) { r.Interval = 0 }, true},
+		{"zero amount", func(r *RecurringRule) { r.Amount = 0 }, true},
+		{"invalid currency", func(r *RecurringRule) { r.Currency = "EURO" }, true},
+		{"currency without cents", func(r *RecurringRule) { r.Currency = "JPY" }, true},
+		{"until before start", func(r *RecurringRule) { r.Until = datePtr(2023, 12, 31) }, true},
+		{"until on start", func(r *RecurringRule) { r.Until = datePtr(2024, 1, 1) }, false},
+		{"zero count", func(r *RecurringRule) { r.Count = intPtr(0) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid
+			tt.change(&rule)
+			if err := rule.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecurringRuleTransaction(t *testing.T) {
+	rule := RecurringRule{ID: 7, CatBudID: 3, Kind: TransactionExpense, Amount: 95000, Currency: "EUR", Payee: "Landlord", Note: "Rent"}
+	moved, amount, payee := date(2024, 3, 4), Money(97500), "New landlord"
+	tests := []struct {
+		name      string
+		exception *RecurringException
+		want      Transaction
+	}{
+		{"as scheduled", nil, Transaction{Date: date(2024, 3, 1), Amount: 95000, Payee: "Landlord", Note: "Rent"}},
+		{"overridden", &RecurringException{Date: &moved, Amount: &amount, Payee: &payee}, Transaction{Date: moved, Amount: 97500, Payee: "New landlord", Note: "Rent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.Transaction(date(2024, 3, 1), tt.exception)
+			if !got.Date.Equal(tt.want.Date) || got.Amount != tt.want.Amount || got.Payee != tt.want.Payee || got.Note != tt.want.Note {
+				t.Fatalf("Transaction = %+v, want %+v", got, tt.want)
+			}
+			if *got.CatBudID != 3 || *got.RecurringRuleID != 7 || !got.OccurrenceDate.Equal(date(2024, 3, 1)) || got.Status != TransactionApproved {
+				t.Fatalf("Transaction = %+v, want it linked to its rule and occurrence", got)
+			}
+		})
+	}
+}
+
+func TestRecurringExceptionMovesEarlier(t *testing.T) {
+	tests := []struct {
+		name string
+		date *time.Time
+		want bool
+	}{
+		{"not moved", nil, false},
+		{"moved earlier", datePtr(2024, 2, 28), true},
+		{"same day", datePtr(2024, 3, 1), false},
+		{"moved later", datePtr(2024, 3, 4), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exception := RecurringException{OccurrenceDate: date(2024, 3, 1), Date: tt.date}
+			if got := exception.MovesEarlier(); got != tt.want {
+				t.Fatalf("MovesEarlier = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package types
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// DaysPerMonth is the average length of a month, used to turn day counts into months.
+const DaysPerMonth = 365.25 / 12
+
+// ContributionSource tells how a contribution was made.
+type ContributionSource string
+
+const (
+	// ContributionManual is a contribution recorded by the user.
+	ContributionManual ContributionSource = "manual"
+	// ContributionAutomatic is a contribution recorded by the automatic contribution schedule.
+	ContributionAutomatic ContributionSource = "automatic"
+)
+
+// SavingsGoal represents an amount an Aibo wants to put aside
+// @Description Savings goal model
+type SavingsGoal struct {
+	// Unique identifier for the SavingsGoal
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo this goal belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// Name of the goal
+	Name string `gorm:"type:varchar(255);not null" json:"name"`
+	// Amount to save, in the base currency of the Aibo
+	TargetAmount Money `gorm:"type:decimal(10,2);not null" json:"target_amount" swaggertype:"string"`
+	// Day the amount should be saved by (optional)
+	TargetDate *time.Time `gorm:"type:date;default:null" json:"target_date"`
+	// ID of the CatBud contributions are booked on as expenses (optional)
+	CatBudID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"cat_bud_id" swaggertype:"integer"`
+	// Name of the account the money is kept on (optional)
+	Account string `gorm:"type:varchar(255)" json:"account"`
+	// Amount saved so far, derived from the contributions
+	SavedAmount Money `gorm:"type:decimal(10,2);not null;default:0" json:"saved_amount" swaggertype:"string"`
+	// Amount of each automatic contribution (optional)
+	AutoAmount *Money `gorm:"type:decimal(10,2);default:null" json:"auto_amount" swaggertype:"string"`
+	// Base unit of the automatic contributions (daily, weekly, monthly or yearly)
+	AutoFrequency RecurrenceFrequency `gorm:"type:varchar(16)" json:"auto_frequency" enums:"daily,weekly,monthly,yearly"`
+	// Number of frequency units between two automatic contributions
+	AutoInterval int `gorm:"not null;default:1" json:"auto_interval"`
+	// Day of the first automatic contribution
+	AutoStartDate *time.Time `gorm:"type:date;default:null" json:"auto_start_date"`
+	// Index of the next automatic contribution
+	AutoNextIndex int `gorm:"not null;default:0" json:"-"`
+	// Day of the next automatic contribution, null when there is none
+	NextAutoDate *time.Time `gorm:"type:date;default:null;index" json:"next_auto_date"`
+	// Timestamp of when the target amount was reached
+	CompletedAt *time.Time `gorm:"type:datetime;default:null" json:"completed_at"`
+	// Timestamp of when the goal was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the goal was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate checks that the settings of the goal are consistent.
+func (g *SavingsGoal) Validate() error {
+	if g.Name == "" {
+		return errors.New("name is required")
+	}
+	if g.TargetAmount <= 0 {
+		return errors.New("target_amount must be positive")
+	}
+	if g.AutoAmount != nil {
+		if *g.AutoAmount <= 0 {
+			return errors.New("auto_amount must be positive")
+		}
+		if !g.AutoFrequency.IsValid() {
+			return errors.New("auto_frequency must be one of daily, weekly, monthly or yearly")
+		}
+		if g.AutoInterval < 1 {
+			return errors.New("auto_interval must be at least 1")
+		}
+		if g.AutoStartDate == nil {
+			return errors.New("auto_start_date is required with automatic contributions")
+		}
+	}
+	return nil
+}
+
+// autoSchedule returns the automatic contributions of the goal as a recurring rule, so that
+// they follow the exact same calendar rules as recurring transactions.
+func (g *SavingsGoal) autoSchedule() *RecurringRule {
+	return &RecurringRule{Frequency: g.AutoFrequency, Interval: g.AutoInterval, StartDate: *g.AutoStartDate}
+}
+
+// AutoContributionDate returns the day of the n-th automatic contribution, or nil when the goal
+// has no automatic contributions or is completed.
+func (g *SavingsGoal) AutoContributionDate(n int) *time.Time {
+	if g.AutoAmount == nil || g.AutoStartDate == nil || g.CompletedAt != nil {
+		return nil
+	}
+	day, ok := g.autoSchedule().Occurrence(n)
+	if !ok {
+		return nil
+	}
+	return &day
+}
+
+// AutoMonthlyEquivalent returns the amount the automatic contributions put aside per month.
+func (g *SavingsGoal) AutoMonthlyEquivalent() Money {
+	if g.AutoAmount == nil || g.CompletedAt != nil || g.AutoInterval < 1 {
+		return 0
+	}
+
+	perMonth := 1 / float64(g.AutoInterval)
+	switch g.AutoFrequency {
+	case FrequencyDaily:
+		perMonth *= DaysPerMonth
+	case FrequencyWeekly:
+		perMonth *= DaysPerMonth / 7
+	case FrequencyYearly:
+		perMonth /= 12
+	}
+	return g.AutoAmount.Mul(perMonth)
+}
+
+// SavingsGoalProgress summarizes where a goal stands
+// @Description Savings goal progress
+type SavingsGoalProgress struct {
+	// Share of the target already saved, between 0 and 1
+	Ratio float64 `json:"ratio"`
+	// Amount still to save
+	RemainingAmount Money `json:"remaining_amount" swaggertype:"string"`
+	// Months left until the target date (null without target date)
+	MonthsLeft *float64 `json:"months_left"`
+	// Amount to save per month to reach the target on time (null without target date)
+	RequiredMonthlyContribution *Money `json:"required_monthly_contribution" swaggertype:"string"`
+	// Amount currently saved per month: automatic contributions plus the average of the
+	// manual contributions of the last three months
+	MonthlyPace Money `json:"monthly_pace" swaggertype:"string"`
+	// Day the target will be reached at the current pace (null when the pace is zero)
+	ProjectedCompletionDate *time.Time `json:"projected_completion_date"`
+	// Whether the target will be reached by the target date at the current pace
+	OnTrack bool `json:"on_track"`
+}
+
+// Progress computes where the goal stands on the given day, given the monthly pace of the
+// contributions.
+//
+// A goal without a target date is on track as long as it moves forward; a goal past its
+// target date is on track only if it is completed.
+func (g *SavingsGoal) Progress(today time.Time, pace Money) SavingsGoalProgress {
+	remaining := max(g.TargetAmount-g.SavedAmount, 0)
+	progress := SavingsGoalProgress{
+		Ratio:           math.Min(g.SavedAmount.Float64()/g.TargetAmount.Float64(), 1),
+		RemainingAmount: remaining,
+		MonthlyPace:     pace,
+	}
+
+	if remaining == 0 {
+		progress.OnTrack = true
+		done := truncateDay(today)
+		if g.CompletedAt != nil {
+			done = truncateDay(*g.CompletedAt)
+		}
+		progress.ProjectedCompletionDate = &done
+	} else if pace > 0 {
+		days := int(math.Ceil(remaining.Float64() / pace.Float64() * DaysPerMonth))
+		projected := truncateDay(today).AddDate(0, 0, days)
+		progress.ProjectedCompletionDate = &projected
+	}
+
+	if g.TargetDate == nil {
+		if remaining > 0 {
+			progress.OnTrack = pace > 0
+		}
+		return progress
+	}
+
+	monthsLeft := math.Max(float64(PeriodDays(today, *g.TargetDate)-1)/DaysPerMonth, 0)
+	progress.MonthsLeft = &monthsLeft
+
+	required := remaining
+	if monthsLeft >= 1 {
+		required = remaining.Mul(1 / monthsLeft)
+	}
+	progress.RequiredMonthlyContribution = &required
+
+	if remaining > 0 {
+		progress.OnTrack = progress.ProjectedCompletionDate != nil && !progress.ProjectedCompletionDate.After(truncateDay(*g.TargetDate))
+	}
+
+	return progress
+}
+
+// SavingsContribution is an amount put into (or taken out of) a SavingsGoal
+// @Description Savings goal contribution
+type SavingsContribution struct {
+	// Unique identifier for the SavingsContribution
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the goal
+	SavingsGoalID snowflake.ID `gorm:"type:bigint;not null;index;uniqueIndex:idx_savings_contributions_auto,priority:1" json:"savings_goal_id"`
+	// Amount contributed, negative for a withdrawal
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// Day of the contribution
+	Date time.Time `gorm:"type:date;not null" json:"date"`
+	// How the contribution was made, either "manual" or "automatic"
+	Source ContributionSource `gorm:"type:varchar(16);not null" json:"source" enums:"manual,automatic"`
+	// Scheduled day of the automatic contribution (null for manual contributions)
+	AutoDate *time.Time `gorm:"type:date;default:null;uniqueIndex:idx_savings_contributions_auto,priority:2" json:"auto_date"`
+	// Free text note
+	Note string `gorm:"type:text" json:"note"`
+	// ID of the ledger Transaction recorded on the goal's CatBud (can be null)
+	TransactionID *snowflake.ID `gorm:"type:bigint;default:null" json:"transaction_id" swaggertype:"integer"`
+	// Timestamp of when the contribution was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
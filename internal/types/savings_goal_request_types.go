@@ -0,0 +1,97 @@
+package types
+
+import (
+	"github.com/bwmarrin/snowflake"
+)
+
+// CreateSavingsGoalRequest represents the request to create a SavingsGoal
+// @Description Create savings goal request structure
+type CreateSavingsGoalRequest struct {
+	// Name of the goal
+	// @example Summer holidays
+	Name string `json:"name" binding:"required"`
+	// Amount to save
+	// @example 1500.00
+	TargetAmount Money `json:"target_amount" binding:"required,gt=0" swaggertype:"string"`
+	// Day the amount should be saved by (format: YYYY-MM-DD)
+	// @example 2025-07-01
+	TargetDate string `json:"target_date"`
+	// ID of the CatBud contributions are booked on as expenses
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Name of the account the money is kept on
+	// @example Savings account
+	Account string `json:"account"`
+	// Amount of each automatic contribution
+	// @example 100.00
+	AutoAmount *Money `json:"auto_amount" binding:"omitempty,gt=0" swaggertype:"string"`
+	// Base unit of the automatic contributions (daily, weekly, monthly or yearly)
+	// @example monthly
+	AutoFrequency RecurrenceFrequency `json:"auto_frequency"`
+	// Number of frequency units between two automatic contributions, defaults to 1
+	// @example 1
+	AutoInterval int `json:"auto_interval"`
+	// Day of the first automatic contribution (format: YYYY-MM-DD)
+	// @example 2024-11-01
+	AutoStartDate string `json:"auto_start_date"`
+}
+
+// UpdateSavingsGoalRequest represents the request to update a SavingsGoal
+// @Description Update savings goal request structure
+type UpdateSavingsGoalRequest struct {
+	// New name of the goal
+	// @example Winter holidays
+	Name string `json:"name"`
+	// New amount to save
+	// @example 2000.00
+	TargetAmount *Money `json:"target_amount" binding:"omitempty,gt=0" swaggertype:"string"`
+	// New target day (format: YYYY-MM-DD)
+	// @example 2025-12-01
+	TargetDate string `json:"target_date"`
+	// New account name
+	// @example Savings account
+	Account *string `json:"account"`
+	// New amount of each automatic contribution
+	// @example 150.00
+	AutoAmount *Money `json:"auto_amount" binding:"omitempty,gt=0" swaggertype:"string"`
+	// Set to true to stop the automatic contributions
+	// @example false
+	StopAuto bool `json:"stop_auto"`
+}
+
+// CreateContributionRequest represents the request to contribute to a SavingsGoal
+// @Description Create savings contribution request structure
+type CreateContributionRequest struct {
+	// Amount contributed, negative for a withdrawal
+	// @example 50.00
+	Amount Money `json:"amount" binding:"required,ne=0" swaggertype:"string"`
+	// Day of the contribution (format: YYYY-MM-DD), defaults to today
+	// @example 2024-10-18
+	Date string `json:"date"`
+	// Free text note
+	// @example Birthday money
+	Note string `json:"note"`
+}
+
+// SavingsGoalResponse represents the response containing a SavingsGoal and its progress
+// @Description Savings goal response structure
+type SavingsGoalResponse struct {
+	// The goal
+	SavingsGoal SavingsGoal `json:"savings_goal"`
+	// Where the goal stands
+	Progress SavingsGoalProgress `json:"progress"`
+}
+
+// ListSavingsGoalsResponse represents the response containing multiple SavingsGoals
+// @Description List savings goals response structure
+type ListSavingsGoalsResponse struct {
+	// List of goals with their progress
+	SavingsGoals []SavingsGoalResponse `json:"savings_goals"`
+}
+
+// ListContributionsResponse represents the response containing the contributions of a SavingsGoal
+// @Description List savings contributions response structure
+type ListContributionsResponse struct {
+	// List of contributions, most recent first
+	Contributions []SavingsContribution `json:"contributions"`
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSavingsGoalAutoMonthlyEquivalent(t *testing.T) {
+	completed := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		goal SavingsGoal
+		want Money
+	}{
+		{"none", SavingsGoal{}, 0},
+		{"monthly", SavingsGoal{AutoAmount: moneyPtr(5000), AutoFrequency: FrequencyMonthly, AutoInterval: 1}, 5000},
+		{"quarterly", SavingsGoal{AutoAmount: moneyPtr(5000), AutoFrequency: FrequencyMonthly, AutoInterval: 3}, 1667},
+		{"weekly", SavingsGoal{AutoAmount: moneyPtr(2500), AutoFrequency: FrequencyWeekly, AutoInterval: 1}, 10871},
+		{"every other day", SavingsGoal{AutoAmount: moneyPtr(100), AutoFrequency: FrequencyDaily, AutoInterval: 2}, 1522},
+		{"yearly", SavingsGoal{AutoAmount: moneyPtr(120000), AutoFrequency: FrequencyYearly, AutoInterval: 1}, 10000},
+		{"completed", SavingsGoal{AutoAmount: moneyPtr(5000), AutoFrequency: FrequencyMonthly, AutoInterval: 1, CompletedAt: &completed}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.goal.AutoMonthlyEquivalent(); got != tt.want {
+			t.Errorf("%s: AutoMonthlyEquivalent = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSavingsGoalAutoContributionDate(t *testing.T) {
+	goal := SavingsGoal{AutoAmount: moneyPtr(5000), AutoFrequency: FrequencyMonthly, AutoInterval: 1, AutoStartDate: datePtr(2024, 1, 31)}
+	if got := goal.AutoContributionDate(1); got == nil || !got.Equal(date(2024, 2, 29)) {
+		t.Fatalf("AutoContributionDate(1) = %v, want 2024-02-29", got)
+	}
+
+	completed := time.Now()
+	goal.CompletedAt = &completed
+	if got := goal.AutoContributionDate(1); got != nil {
+		t.Fatalf("AutoContributionDate of a completed goal = %v", got)
+	}
+	if got := (&SavingsGoal{}).AutoContributionDate(0); got != nil {
+		t.Fatalf("AutoContributionDate without schedule = %v", got)
+	}
+}
+
+func TestSavingsGoalProgress(t *testing.T) {
+	today := date(2024, 1, 1)
+	completedAt := time.Date(2023, 11, 20, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		goal          SavingsGoal
+		pace          Money
+		wantRatio     float64
+		wantRemaining Money
+		wantRequired  *Money
+		wantProjected *time.Time
+		wantOnTrack   bool
+	}{
+		{
+			"no target date",
+			SavingsGoal{TargetAmount: 100000, SavedAmount: 40000},
+			20000, 0.4, 60000, nil, datePtr(2024, 4, 2), true,
+		},
+		{
+			"stalled",
+			SavingsGoal{TargetAmount: 100000, SavedAmount: 40000},
+			0, 0.4, 60000, nil, nil, false,
+		},
+		{
+			"reached",
+			SavingsGoal{TargetAmount: 100000, SavedAmount: 120000, CompletedAt: &completedAt},
+			0, 1, 0, nil, datePtr(2023, 11, 20), true,
+		},
+		{
+			"behind",
+			SavingsGoal{TargetAmount: 100000, SavedAmount: 40000, TargetDate: datePtr(2024, 7, 1)},
+			10000, 0.4, 60000, moneyPtr(10034), datePtr(2024, 7, 2), false,
+		},
+		{
+			"on time",
+			SavingsGoal{TargetAmount: 100000, SavedAmount: 40000, TargetDate: datePtr(2024, 7, 1)},
+			10100, 0.4, 60000, moneyPtr(10034), datePtr(2024, 6, 30), true,
+		},
+		{
+			"past due",
+			SavingsGoal{TargetAmount: 100000, SavedAmount: 40000, TargetDate: datePtr(2023, 12, 1)},
+			10000, 0.4, 60000, moneyPtr(60000), datePtr(2024, 7, 2), false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.goal.Progress(today, tt.pace)
+			if math.Abs(got.Ratio-tt.wantRatio) > 1e-9 || got.RemainingAmount != tt.wantRemaining || got.MonthlyPace != tt.pace || got.OnTrack != tt.wantOnTrack {
+				t.Fatalf("Progress = %+v", got)
+			}
+			if (got.RequiredMonthlyContribution == nil) != (tt.wantRequired == nil) ||
+				tt.wantRequired != nil && *got.RequiredMonthlyContribution != *tt.wantRequired {
+				t.Fatalf("required monthly contribution = %v, want %v", got.RequiredMonthlyContribution, tt.wantRequired)
+			}
+			if (got.ProjectedCompletionDate == nil) != (tt.wantProjected == nil) ||
+				tt.wantProjected != nil && !got.ProjectedCompletionDate.Equal(*tt.wantProjected) {
+				t.Fatalf("projected completion = %v, want %v", got.ProjectedCompletionDate, tt.wantProjected)
+			}
+			if (got.MonthsLeft != nil) != (tt.goal.TargetDate != nil) {
+				t.Fatalf("months left = %v with target date %v", got.MonthsLeft, tt.goal.TargetDate)
+			}
+		})
+	}
+}
+
+func TestSavingsGoalValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		goal    SavingsGoal
+		wantErr bool
+	}{
+		{"valid", SavingsGoal{Name: "Holidays", TargetAmount: 150000}, false},
+		{"no name", SavingsGoal{TargetAmount: 150000}, true},
+		{"zero target", SavingsGoal{Name: "Holidays"}, true},
+		{"automatic", SavingsGoal{Name: "Holidays", TargetAmount: 150000, AutoAmount: moneyPtr(5000), AutoFrequency: FrequencyMonthly, AutoInterval: 1, AutoStartDate: datePtr(2024, 1, 1)}, false},
+		{"automatic without start", SavingsGoal{Name: "Holidays", TargetAmount: 150000, AutoAmount: moneyPtr(5000), AutoFrequency: FrequencyMonthly, AutoInterval: 1}, true},
+		{"automatic without frequency", SavingsGoal{Name: "Holidays", TargetAmount: 150000, AutoAmount: moneyPtr(5000), AutoInterval: 1, AutoStartDate: datePtr(2024, 1, 1)}, true},
+		{"negative automatic amount", SavingsGoal{Name: "Holidays", TargetAmount: 150000, AutoAmount: moneyPtr(-1), AutoFrequency: FrequencyMonthly, AutoInterval: 1, AutoStartDate: datePtr(2024, 1, 1)}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.goal.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTags is the largest number of tags of a Transaction.
+	MaxTags = 20
+	// MaxTagLength is the largest number of characters of a tag.
+	MaxTagLength = 50
+)
+
+// Tags are the labels of a Transaction. They are stored as a JSON array in a text column, and
+// compared without case.
+type Tags []string
+
+// NormalizeTags trims the tags and drops the empty and repeated ones, keeping the first spelling
+// of each. It returns an error when there are more than MaxTags tags or one is longer than
+// MaxTagLength.
+func NormalizeTags(values []string) (Tags, error) {
+	tags := Tags{}
+	for _, value := range values {
+		value = strings.Join(strings.Fields(value), " ")
+		if value == "" || tags.Has(value) {
+			continue
+		}
+		if utf8.RuneCountInString(value) > MaxTagLength {
+			return nil, fmt.Errorf("tags must be at most %d characters long", MaxTagLength)
+		}
+		tags = append(tags, value)
+	}
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("a transaction can have at most %d tags", MaxTags)
+	}
+	return tags, nil
+}
+
+// Has reports whether the tag is one of the tags, without case.
+func (t Tags) Has(tag string) bool {
+	for _, existing := range t {
+		if strings.EqualFold(existing, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the tags followed by the other tags they do not have yet, up to MaxTags.
+func (t Tags) Merge(other Tags) Tags {
+	merged := append(Tags{}, t...)
+	for _, tag := range other {
+		if len(merged) == MaxTags {
+			break
+		}
+		if !merged.Has(tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// MarshalJSON encodes the tags as a JSON array, empty rather than null when there is none.
+func (t Tags) MarshalJSON() ([]byte, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(t))
+}
+
+// Value implements driver.Valuer, storing the tags as a JSON array.
+func (t Tags) Value() (driver.Value, error) {
+	data, err := t.MarshalJSON()
+	return string(data), err
+}
+
+// Scan implements sql.Scanner. A null or empty column reads as no tag.
+func (t *Tags) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("invalid tags")
+	}
+	if len(data) == 0 {
+		*t = nil
+		return nil
+	}
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	*t = tags
+	return nil
+}
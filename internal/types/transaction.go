@@ -0,0 +1,175 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+)
+
+// TransactionKind distinguishes money leaving the budget from money entering it.
+type TransactionKind string
+
+const (
+	// TransactionExpense is money spent. It counts against the CatBud and the daily budget.
+	TransactionExpense TransactionKind = "expense"
+	// TransactionIncome is money received. It is subtracted from the spent amounts (refunds, salary...).
+	TransactionIncome TransactionKind = "income"
+)
+
+// IsValid reports whether the kind is one of the known transaction kinds.
+func (k TransactionKind) IsValid() bool {
+	return k == TransactionExpense || k == TransactionIncome
+}
+
+// TransactionStatus tells whether a Transaction counts in the budgets.
+type TransactionStatus string
+
+const (
+	// TransactionApproved counts in the budgets. Transactions that need no approval are approved.
+	TransactionApproved TransactionStatus = "approved"
+	// TransactionPending waits for the approval of the other members of a Household. It does not
+	// count in the budgets yet, and is shown apart on the CatBuds.
+	TransactionPending TransactionStatus = "pending"
+	// TransactionRejected was rejected by a member of a Household and never counts in the budgets.
+	TransactionRejected TransactionStatus = "rejected"
+)
+
+// Transaction represents a single ledger entry of an Aibo
+// @Description Expense or income ledger entry
+type Transaction struct {
+	// Unique identifier for the Transaction
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Aibo this Transaction belongs to
+	AiboID uuid.UUID `gorm:"type:char(36);not null;index:idx_transactions_aibo_date,priority:1" json:"aibo_id" swaggertype:"string" format:"uuid"`
+	// ID of the CatBud this Transaction is booked on (can be null, always null for a split Transaction)
+	CatBudID *snowflake.ID `gorm:"type:bigint;index;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Kind of the Transaction, either "expense" or "income"
+	Kind TransactionKind `gorm:"type:varchar(16);not null" json:"kind" enums:"expense,income"`
+	// Amount of the Transaction, always positive
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// ISO 4217 currency of the amount
+	Currency Currency `gorm:"type:char(3);not null;default:'EUR'" json:"currency" swaggertype:"string" example:"USD"`
+	// Amount converted into the base currency of the Aibo at the rate of the Transaction's day,
+	// this is the amount used by every budget calculation
+	BaseAmount Money `gorm:"type:decimal(10,2)" json:"base_amount" swaggertype:"string"`
+	// Day the Transaction happened on
+	Date time.Time `gorm:"type:date;not null;index:idx_transactions_aibo_date,priority:2" json:"date"`
+	// Who was paid, or who paid
+	Payee string `gorm:"type:varchar(255)" json:"payee"`
+	// Free text note
+	Note string `gorm:"type:text" json:"note"`
+	// Labels of the Transaction, such as "vacation" or "reimbursable"
+	Tags Tags `gorm:"type:text" json:"tags" swaggertype:"array,string"`
+	// ID of the CategoryRule that booked the Transaction on its CatBud, null when it was booked by
+	// hand
+	CategoryRuleID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"category_rule_id" swaggertype:"integer"`
+	// ID of the RecurringRule that generated the Transaction (can be null)
+	RecurringRuleID *snowflake.ID `gorm:"type:bigint;default:null;uniqueIndex:idx_transactions_occurrence,priority:1" json:"recurring_rule_id" swaggertype:"integer"`
+	// Scheduled day of the occurrence that generated the Transaction (can be null)
+	OccurrenceDate *time.Time `gorm:"type:date;default:null;uniqueIndex:idx_transactions_occurrence,priority:2" json:"occurrence_date"`
+	// ID of the ImportBatch the Transaction was imported with (can be null)
+	ImportBatchID *snowflake.ID `gorm:"type:bigint;default:null;index" json:"import_batch_id" swaggertype:"integer"`
+	// Identifier given to the Transaction by the bank it was imported from, such as the FITID of
+	// an OFX statement
+	ExternalID string `gorm:"type:varchar(255);index" json:"external_id,omitempty"`
+	// Whether the Transaction counts in the budgets (approved), waits for approval (pending) or was
+	// rejected (rejected)
+	Status TransactionStatus `gorm:"type:varchar(16);not null;default:'approved';index" json:"status" enums:"approved,pending,rejected"`
+	// Lines sharing the amount between several CatBuds, empty when the Transaction is not split
+	Splits []TransactionSplit `gorm:"foreignKey:TransactionID" json:"splits"`
+	// Timestamp of when the Transaction was created
+	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// Timestamp of when the Transaction was last updated
+	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TransactionSplit is the share of a split Transaction booked on one CatBud
+// @Description Split line of a Transaction
+type TransactionSplit struct {
+	// Unique identifier for the TransactionSplit
+	// @example 1234567890123456
+	ID snowflake.ID `gorm:"primaryKey;type:bigint" json:"id"`
+	// ID of the Transaction the line belongs to
+	TransactionID snowflake.ID `gorm:"type:bigint;not null;index" json:"transaction_id"`
+	// ID of the CatBud the line is booked on (can be null)
+	CatBudID *snowflake.ID `gorm:"type:bigint;index;default:null" json:"cat_bud_id" swaggertype:"integer"`
+	// Amount of the line in the currency of the Transaction, always positive
+	Amount Money `gorm:"type:decimal(10,2);not null" json:"amount" swaggertype:"string"`
+	// Share of the base amount of the Transaction, the base amounts of the lines add up to it
+	BaseAmount Money `gorm:"type:decimal(10,2);not null;default:0" json:"base_amount" swaggertype:"string"`
+	// Free text note
+	Note string `gorm:"type:varchar(255)" json:"note"`
+}
+
+// ValidateSplits checks that the split lines of the Transaction, if any, are positive and add up
+// to its amount, and that the Transaction is not also booked on a single CatBud.
+func (t *Transaction) ValidateSplits() error {
+	if len(t.Splits) == 0 {
+		return nil
+	}
+	if len(t.Splits) < 2 {
+		return errors.New("a split transaction needs at least two lines")
+	}
+	if t.CatBudID != nil {
+		return errors.New("a split transaction cannot also have a cat_bud_id")
+	}
+
+	var total Money
+	for _, split := range t.Splits {
+		if split.Amount <= 0 {
+			return errors.New("split amounts must be positive")
+		}
+		total += split.Amount
+	}
+	if total != t.Amount {
+		return fmt.Errorf("split amounts add up to %s instead of %s", total, t.Amount)
+	}
+	return nil
+}
+
+// AllocateBaseAmount shares the base amount of the Transaction between its split lines in
+// proportion to their amounts. Each share is rounded to the cent and the last line absorbs the
+// rounding difference, so the shares always add up to the base amount.
+func (t *Transaction) AllocateBaseAmount() {
+	if t.Amount == 0 {
+		return
+	}
+
+	allocated := Money(0)
+	for i := range t.Splits {
+		if i == len(t.Splits)-1 {
+			t.Splits[i].BaseAmount = t.BaseAmount - allocated
+			continue
+		}
+		t.Splits[i].BaseAmount = t.BaseAmount.MulRatio(int64(t.Splits[i].Amount), int64(t.Amount))
+		allocated += t.Splits[i].BaseAmount
+	}
+}
+
+// SignedAmount returns the amount in the base currency as it weighs on spending:
+// positive for an expense, negative for an income.
+func (t *Transaction) SignedAmount() Money {
+	if t.Kind == TransactionIncome {
+		return -t.BaseAmount
+	}
+	return t.BaseAmount
+}
+
+// CatBudShares returns the amount booked on each CatBud by the Transaction, in its currency: its
+// amount on its CatBud and the amounts of its split lines on theirs.
+func (t *Transaction) CatBudShares() map[snowflake.ID]Money {
+	shares := make(map[snowflake.ID]Money)
+	if t.CatBudID != nil {
+		shares[*t.CatBudID] = t.Amount
+	}
+	for _, split := range t.Splits {
+		if split.CatBudID != nil {
+			shares[*split.CatBudID] += split.Amount
+		}
+	}
+	return shares
+}
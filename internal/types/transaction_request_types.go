@@ -0,0 +1,115 @@
+package types
+
+import (
+	"github.com/bwmarrin/snowflake"
+)
+
+// CreateTransactionRequest represents the request to record a Transaction
+// @Description Create Transaction request structure
+type CreateTransactionRequest struct {
+	// ID of the CatBud to book the Transaction on (optional, not allowed with splits)
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Lines sharing the amount between several CatBuds (optional), they must add up to the amount
+	Splits []TransactionSplitRequest `json:"splits" binding:"omitempty,dive"`
+	// Kind of the Transaction, either "expense" or "income"
+	// @example expense
+	Kind TransactionKind `json:"kind" binding:"required"`
+	// Amount of the Transaction, must be positive
+	// @example 12.50
+	Amount Money `json:"amount" binding:"required,gt=0" swaggertype:"string"`
+	// ISO 4217 currency of the amount, defaults to the base currency
+	// @example USD
+	Currency Currency `json:"currency"`
+	// Day of the Transaction (format: YYYY-MM-DD), defaults to today
+	// @example 2024-01-31
+	Date string `json:"date"`
+	// Who was paid, or who paid
+	// @example Supermarket
+	Payee string `json:"payee"`
+	// Free text note
+	// @example Weekly groceries
+	Note string `json:"note"`
+	// Labels of the Transaction
+	// @example ["vacation"]
+	Tags []string `json:"tags"`
+}
+
+// UpdateTransactionRequest represents the request to update a Transaction
+// @Description Update Transaction request structure
+type UpdateTransactionRequest struct {
+	// New CatBud of the Transaction
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Set to true to detach the Transaction from its CatBud
+	// @example false
+	ClearCatBud bool `json:"clear_cat_bud"`
+	// New split lines, replacing the current ones and the CatBud of the Transaction
+	Splits []TransactionSplitRequest `json:"splits" binding:"omitempty,dive"`
+	// Set to true to remove the split lines of the Transaction
+	// @example false
+	ClearSplits bool `json:"clear_splits"`
+	// New kind of the Transaction
+	// @example income
+	Kind TransactionKind `json:"kind"`
+	// New amount of the Transaction
+	// @example 15.00
+	Amount *Money `json:"amount" binding:"omitempty,gt=0" swaggertype:"string"`
+	// New currency of the amount (ISO 4217)
+	// @example EUR
+	Currency Currency `json:"currency"`
+	// New day of the Transaction (format: YYYY-MM-DD)
+	// @example 2024-02-01
+	Date string `json:"date"`
+	// New payee
+	// @example Pharmacy
+	Payee *string `json:"payee"`
+	// New note
+	// @example Refund
+	Note *string `json:"note"`
+	// New labels, replacing the current ones
+	// @example ["reimbursable"]
+	Tags *[]string `json:"tags"`
+}
+
+// TransactionSplitRequest represents a split line of a Transaction
+// @Description Transaction split line request structure
+type TransactionSplitRequest struct {
+	// ID of the CatBud to book the line on (optional)
+	// @example 1234567890123456
+	CatBudID *snowflake.ID `json:"cat_bud_id" swaggertype:"integer"`
+	// Amount of the line in the currency of the Transaction, must be positive
+	// @example 8.20
+	Amount Money `json:"amount" binding:"required,gt=0" swaggertype:"string"`
+	// Free text note
+	// @example Toothpaste
+	Note string `json:"note"`
+}
+
+// ListTransactionsRequest represents the query parameters to list Transactions
+// @Description List Transactions query structure
+type ListTransactionsRequest struct {
+	// First day to include (format: YYYY-MM-DD)
+	// @example 2024-01-01
+	From string `form:"from"`
+	// Last day to include (format: YYYY-MM-DD)
+	// @example 2024-01-31
+	To string `form:"to"`
+	// Only return Transactions booked on this CatBud, including split Transactions with a line on it
+	// @example 1234567890123456
+	CatBudID string `form:"cat_bud_id"`
+}
+
+// TransactionResponse represents the response containing a single Transaction
+// @Description Single Transaction response structure
+type TransactionResponse struct {
+	// The Transaction
+	Transaction Transaction `json:"transaction"`
+}
+
+// ListTransactionsResponse represents the response containing multiple Transactions
+// @Description List Transactions response structure
+type ListTransactionsResponse struct {
+	// List of Transactions
+	Transactions []Transaction `json:"transactions"`
+}
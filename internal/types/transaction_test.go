@@ -0,0 +1,106 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+func TestTransactionValidateSplits(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction Transaction
+		wantErr     bool
+	}{
+		{"not split", Transaction{Amount: 1000, CatBudID: idPtr(1)}, false},
+		{"split", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 600}, {Amount: 400}}}, false},
+		{"single line", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 1000}}}, true},
+		{"also booked on a CatBud", Transaction{Amount: 1000, CatBudID: idPtr(1), Splits: []TransactionSplit{{Amount: 600}, {Amount: 400}}}, true},
+		{"zero line", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 1000}, {Amount: 0}}}, true},
+		{"negative line", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 1100}, {Amount: -100}}}, true},
+		{"short", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 600}, {Amount: 399}}}, true},
+		{"over", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 600}, {Amount: 401}}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.transaction.ValidateSplits(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateSplits = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTransactionAllocateBaseAmount(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     Money
+		baseAmount Money
+		lines      []Money
+		want       []Money
+	}{
+		{"same currency", 1000, 1000, []Money{600, 400}, []Money{600, 400}},
+		{"converted", 1000, 1095, []Money{500, 300, 200}, []Money{548, 329, 218}},
+		{"thirds", 100, 100, []Money{33, 33, 34}, []Money{33, 33, 34}},
+		{"rounding absorbed by the last line", 300, 1000, []Money{100, 100, 100}, []Money{333, 333, 334}},
+		{"zero amount", 0, 0, []Money{0, 0}, []Money{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := Transaction{Amount: tt.amount, BaseAmount: tt.baseAmount}
+			for _, line := range tt.lines {
+				transaction.Splits = append(transaction.Splits, TransactionSplit{Amount: line})
+			}
+			transaction.AllocateBaseAmount()
+
+			var total Money
+			for i, split := range transaction.Splits {
+				if split.BaseAmount != tt.want[i] {
+					t.Errorf("line %d: base amount %v, want %v", i, split.BaseAmount, tt.want[i])
+				}
+				total += split.BaseAmount
+			}
+			if total != tt.baseAmount {
+				t.Errorf("the lines add up to %v, want %v", total, tt.baseAmount)
+			}
+		})
+	}
+}
+
+func TestTransactionSignedAmount(t *testing.T) {
+	tests := []struct {
+		kind TransactionKind
+		want Money
+	}{
+		{TransactionExpense, 1250},
+		{TransactionIncome, -1250},
+	}
+	for _, tt := range tests {
+		transaction := Transaction{Kind: tt.kind, Amount: 9999, BaseAmount: 1250}
+		if got := transaction.SignedAmount(); got != tt.want {
+			t.Errorf("%s: SignedAmount = %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestTransactionCatBudShares(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction Transaction
+		want        map[snowflake.ID]Money
+	}{
+		{"not booked", Transaction{Amount: 1000}, map[snowflake.ID]Money{}},
+		{"booked", Transaction{Amount: 1000, CatBudID: idPtr(1)}, map[snowflake.ID]Money{1: 1000}},
+		{"split", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 600, CatBudID: idPtr(1)}, {Amount: 400, CatBudID: idPtr(2)}}}, map[snowflake.ID]Money{1: 600, 2: 400}},
+		{"split twice on a CatBud", Transaction{Amount: 1000, Splits: []TransactionSplit{{Amount: 600, CatBudID: idPtr(1)}, {Amount: 300, CatBudID: idPtr(1)}, {Amount: 100}}}, map[snowflake.ID]Money{1: 900}},
+	}
+	for _, tt := range tests {
+		got := tt.transaction.CatBudShares()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: CatBudShares = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for id, amount := range tt.want {
+			if got[id] != amount {
+				t.Errorf("%s: CatBudShares = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
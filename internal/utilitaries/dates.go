@@ -0,0 +1,25 @@
+package utilitaries
+
+import "time"
+
+// LocalDate returns the calendar date of the instant t in the given location.
+//
+// The result is midnight UTC of that calendar date, which is how DATE columns are
+// read back from the database, so it can be compared with them directly.
+func LocalDate(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// LoadLocation resolves an IANA timezone name, falling back to UTC when the name
+// is empty or unknown.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
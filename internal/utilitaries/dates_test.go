@@ -0,0 +1,28 @@
+package utilitaries
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestLocalDate(t *testing.T) {
+	instant := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		timezone string
+		want     time.Time
+	}{
+		{"UTC", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"Europe/Paris", time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"Pacific/Auckland", time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"America/Los_Angeles", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"Pacific/Pago_Pago", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"Mars/Olympus_Mons", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := LocalDate(instant, LoadLocation(tt.timezone)); !got.Equal(tt.want) {
+			t.Errorf("LocalDate in %q = %v, want %v", tt.timezone, got, tt.want)
+		}
+	}
+}